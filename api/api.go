@@ -0,0 +1,10 @@
+// Package api holds the daemon's API definitions: the gRPC service in v1
+// and the OpenAPI document for the JSON/HTTP API.
+package api
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI 3 document describing the JSON/HTTP API.
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
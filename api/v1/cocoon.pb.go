@@ -0,0 +1,1101 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        (unknown)
+// source: api/v1/cocoon.proto
+
+package apiv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PullImageProgress_Phase int32
+
+const (
+	PullImageProgress_PHASE_UNSPECIFIED PullImageProgress_Phase = 0
+	PullImageProgress_PHASE_RESOLVE     PullImageProgress_Phase = 1 // OCI manifest resolved, layer count known
+	PullImageProgress_PHASE_LAYER       PullImageProgress_Phase = 2 // one OCI layer processed
+	PullImageProgress_PHASE_DOWNLOAD    PullImageProgress_Phase = 3 // cloud image download progress
+	PullImageProgress_PHASE_CONVERT     PullImageProgress_Phase = 4 // cloud image qemu-img conversion
+	PullImageProgress_PHASE_COMMIT      PullImageProgress_Phase = 5
+	PullImageProgress_PHASE_DONE        PullImageProgress_Phase = 6
+)
+
+// Enum value maps for PullImageProgress_Phase.
+var (
+	PullImageProgress_Phase_name = map[int32]string{
+		0: "PHASE_UNSPECIFIED",
+		1: "PHASE_RESOLVE",
+		2: "PHASE_LAYER",
+		3: "PHASE_DOWNLOAD",
+		4: "PHASE_CONVERT",
+		5: "PHASE_COMMIT",
+		6: "PHASE_DONE",
+	}
+	PullImageProgress_Phase_value = map[string]int32{
+		"PHASE_UNSPECIFIED": 0,
+		"PHASE_RESOLVE":     1,
+		"PHASE_LAYER":       2,
+		"PHASE_DOWNLOAD":    3,
+		"PHASE_CONVERT":     4,
+		"PHASE_COMMIT":      5,
+		"PHASE_DONE":        6,
+	}
+)
+
+func (x PullImageProgress_Phase) Enum() *PullImageProgress_Phase {
+	p := new(PullImageProgress_Phase)
+	*p = x
+	return p
+}
+
+func (x PullImageProgress_Phase) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PullImageProgress_Phase) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_v1_cocoon_proto_enumTypes[0].Descriptor()
+}
+
+func (PullImageProgress_Phase) Type() protoreflect.EnumType {
+	return &file_api_v1_cocoon_proto_enumTypes[0]
+}
+
+func (x PullImageProgress_Phase) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PullImageProgress_Phase.Descriptor instead.
+func (PullImageProgress_Phase) EnumDescriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{10, 0}
+}
+
+type VMConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Cpu           int32                  `protobuf:"varint,2,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory        int64                  `protobuf:"varint,3,opt,name=memory,proto3" json:"memory,omitempty"`   // bytes
+	Storage       int64                  `protobuf:"varint,4,opt,name=storage,proto3" json:"storage,omitempty"` // COW disk size, bytes
+	Image         string                 `protobuf:"bytes,5,opt,name=image,proto3" json:"image,omitempty"`
+	Network       string                 `protobuf:"bytes,6,opt,name=network,proto3" json:"network,omitempty"`                                  // CNI conflist name; empty = default
+	RestartPolicy string                 `protobuf:"bytes,7,opt,name=restart_policy,json=restartPolicy,proto3" json:"restart_policy,omitempty"` // "no" or "always"; empty = no
+	HealthCheck   *HealthCheck           `protobuf:"bytes,8,opt,name=health_check,json=healthCheck,proto3" json:"health_check,omitempty"`       // unset = no health check
+	Labels        map[string]string      `protobuf:"bytes,9,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VMConfig) Reset() {
+	*x = VMConfig{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VMConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VMConfig) ProtoMessage() {}
+
+func (x *VMConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VMConfig.ProtoReflect.Descriptor instead.
+func (*VMConfig) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *VMConfig) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *VMConfig) GetCpu() int32 {
+	if x != nil {
+		return x.Cpu
+	}
+	return 0
+}
+
+func (x *VMConfig) GetMemory() int64 {
+	if x != nil {
+		return x.Memory
+	}
+	return 0
+}
+
+func (x *VMConfig) GetStorage() int64 {
+	if x != nil {
+		return x.Storage
+	}
+	return 0
+}
+
+func (x *VMConfig) GetImage() string {
+	if x != nil {
+		return x.Image
+	}
+	return ""
+}
+
+func (x *VMConfig) GetNetwork() string {
+	if x != nil {
+		return x.Network
+	}
+	return ""
+}
+
+func (x *VMConfig) GetRestartPolicy() string {
+	if x != nil {
+		return x.RestartPolicy
+	}
+	return ""
+}
+
+func (x *VMConfig) GetHealthCheck() *HealthCheck {
+	if x != nil {
+		return x.HealthCheck
+	}
+	return nil
+}
+
+func (x *VMConfig) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+type HealthCheck struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Type            string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"` // "tcp" or "http"
+	Port            int32                  `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Path            string                 `protobuf:"bytes,3,opt,name=path,proto3" json:"path,omitempty"` // http only
+	IntervalSeconds int32                  `protobuf:"varint,4,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+	TimeoutSeconds  int32                  `protobuf:"varint,5,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
+	Retries         int32                  `protobuf:"varint,6,opt,name=retries,proto3" json:"retries,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *HealthCheck) Reset() {
+	*x = HealthCheck{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HealthCheck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HealthCheck) ProtoMessage() {}
+
+func (x *HealthCheck) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HealthCheck.ProtoReflect.Descriptor instead.
+func (*HealthCheck) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HealthCheck) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *HealthCheck) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *HealthCheck) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *HealthCheck) GetIntervalSeconds() int32 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+func (x *HealthCheck) GetTimeoutSeconds() int32 {
+	if x != nil {
+		return x.TimeoutSeconds
+	}
+	return 0
+}
+
+func (x *HealthCheck) GetRetries() int32 {
+	if x != nil {
+		return x.Retries
+	}
+	return 0
+}
+
+type NetworkConfig struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tap           string                 `protobuf:"bytes,1,opt,name=tap,proto3" json:"tap,omitempty"`
+	Mac           string                 `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	Ip            string                 `protobuf:"bytes,3,opt,name=ip,proto3" json:"ip,omitempty"`
+	Gateway       string                 `protobuf:"bytes,4,opt,name=gateway,proto3" json:"gateway,omitempty"`
+	Prefix        int32                  `protobuf:"varint,5,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NetworkConfig) Reset() {
+	*x = NetworkConfig{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NetworkConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NetworkConfig) ProtoMessage() {}
+
+func (x *NetworkConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NetworkConfig.ProtoReflect.Descriptor instead.
+func (*NetworkConfig) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *NetworkConfig) GetTap() string {
+	if x != nil {
+		return x.Tap
+	}
+	return ""
+}
+
+func (x *NetworkConfig) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *NetworkConfig) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *NetworkConfig) GetGateway() string {
+	if x != nil {
+		return x.Gateway
+	}
+	return ""
+}
+
+func (x *NetworkConfig) GetPrefix() int32 {
+	if x != nil {
+		return x.Prefix
+	}
+	return 0
+}
+
+type VM struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	State         string                 `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	Config        *VMConfig              `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+	Pid           int32                  `protobuf:"varint,4,opt,name=pid,proto3" json:"pid,omitempty"`
+	Networks      []*NetworkConfig       `protobuf:"bytes,5,rep,name=networks,proto3" json:"networks,omitempty"`
+	CreatedAt     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt     *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	StartedAt     *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	StoppedAt     *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=stopped_at,json=stoppedAt,proto3" json:"stopped_at,omitempty"`
+	Health        string                 `protobuf:"bytes,10,opt,name=health,proto3" json:"health,omitempty"` // "starting", "healthy", "unhealthy"; empty = not checked
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VM) Reset() {
+	*x = VM{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VM) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VM) ProtoMessage() {}
+
+func (x *VM) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VM.ProtoReflect.Descriptor instead.
+func (*VM) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *VM) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *VM) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *VM) GetConfig() *VMConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *VM) GetPid() int32 {
+	if x != nil {
+		return x.Pid
+	}
+	return 0
+}
+
+func (x *VM) GetNetworks() []*NetworkConfig {
+	if x != nil {
+		return x.Networks
+	}
+	return nil
+}
+
+func (x *VM) GetCreatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return nil
+}
+
+func (x *VM) GetUpdatedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return nil
+}
+
+func (x *VM) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *VM) GetStoppedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StoppedAt
+	}
+	return nil
+}
+
+func (x *VM) GetHealth() string {
+	if x != nil {
+		return x.Health
+	}
+	return ""
+}
+
+type CreateVMRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Config        *VMConfig              `protobuf:"bytes,1,opt,name=config,proto3" json:"config,omitempty"`
+	Nics          int32                  `protobuf:"varint,2,opt,name=nics,proto3" json:"nics,omitempty"`   // number of NICs; 0 = no network
+	Start         bool                   `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"` // start the VM after creation
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateVMRequest) Reset() {
+	*x = CreateVMRequest{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateVMRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateVMRequest) ProtoMessage() {}
+
+func (x *CreateVMRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateVMRequest.ProtoReflect.Descriptor instead.
+func (*CreateVMRequest) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CreateVMRequest) GetConfig() *VMConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+func (x *CreateVMRequest) GetNics() int32 {
+	if x != nil {
+		return x.Nics
+	}
+	return 0
+}
+
+func (x *CreateVMRequest) GetStart() bool {
+	if x != nil {
+		return x.Start
+	}
+	return false
+}
+
+type VMRefsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Refs          []string               `protobuf:"bytes,1,rep,name=refs,proto3" json:"refs,omitempty"` // VM IDs, names, or ID prefixes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VMRefsRequest) Reset() {
+	*x = VMRefsRequest{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VMRefsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VMRefsRequest) ProtoMessage() {}
+
+func (x *VMRefsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VMRefsRequest.ProtoReflect.Descriptor instead.
+func (*VMRefsRequest) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *VMRefsRequest) GetRefs() []string {
+	if x != nil {
+		return x.Refs
+	}
+	return nil
+}
+
+type VMRefsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []string               `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VMRefsResponse) Reset() {
+	*x = VMRefsResponse{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VMRefsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VMRefsResponse) ProtoMessage() {}
+
+func (x *VMRefsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VMRefsResponse.ProtoReflect.Descriptor instead.
+func (*VMRefsResponse) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *VMRefsResponse) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+type ListVMsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVMsRequest) Reset() {
+	*x = ListVMsRequest{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVMsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVMsRequest) ProtoMessage() {}
+
+func (x *ListVMsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVMsRequest.ProtoReflect.Descriptor instead.
+func (*ListVMsRequest) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{7}
+}
+
+type ListVMsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Vms           []*VM                  `protobuf:"bytes,1,rep,name=vms,proto3" json:"vms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListVMsResponse) Reset() {
+	*x = ListVMsResponse{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListVMsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListVMsResponse) ProtoMessage() {}
+
+func (x *ListVMsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListVMsResponse.ProtoReflect.Descriptor instead.
+func (*ListVMsResponse) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListVMsResponse) GetVms() []*VM {
+	if x != nil {
+		return x.Vms
+	}
+	return nil
+}
+
+type PullImageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ref           string                 `protobuf:"bytes,1,opt,name=ref,proto3" json:"ref,omitempty"` // OCI reference or http(s) cloud image URL
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PullImageRequest) Reset() {
+	*x = PullImageRequest{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PullImageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullImageRequest) ProtoMessage() {}
+
+func (x *PullImageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullImageRequest.ProtoReflect.Descriptor instead.
+func (*PullImageRequest) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *PullImageRequest) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+type PullImageProgress struct {
+	state         protoimpl.MessageState  `protogen:"open.v1"`
+	Phase         PullImageProgress_Phase `protobuf:"varint,1,opt,name=phase,proto3,enum=cocoon.v1.PullImageProgress_Phase" json:"phase,omitempty"`
+	LayerIndex    int32                   `protobuf:"varint,2,opt,name=layer_index,json=layerIndex,proto3" json:"layer_index,omitempty"`
+	LayerTotal    int32                   `protobuf:"varint,3,opt,name=layer_total,json=layerTotal,proto3" json:"layer_total,omitempty"`
+	Digest        string                  `protobuf:"bytes,4,opt,name=digest,proto3" json:"digest,omitempty"`
+	BytesDone     int64                   `protobuf:"varint,5,opt,name=bytes_done,json=bytesDone,proto3" json:"bytes_done,omitempty"`
+	BytesTotal    int64                   `protobuf:"varint,6,opt,name=bytes_total,json=bytesTotal,proto3" json:"bytes_total,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PullImageProgress) Reset() {
+	*x = PullImageProgress{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PullImageProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullImageProgress) ProtoMessage() {}
+
+func (x *PullImageProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullImageProgress.ProtoReflect.Descriptor instead.
+func (*PullImageProgress) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *PullImageProgress) GetPhase() PullImageProgress_Phase {
+	if x != nil {
+		return x.Phase
+	}
+	return PullImageProgress_PHASE_UNSPECIFIED
+}
+
+func (x *PullImageProgress) GetLayerIndex() int32 {
+	if x != nil {
+		return x.LayerIndex
+	}
+	return 0
+}
+
+func (x *PullImageProgress) GetLayerTotal() int32 {
+	if x != nil {
+		return x.LayerTotal
+	}
+	return 0
+}
+
+func (x *PullImageProgress) GetDigest() string {
+	if x != nil {
+		return x.Digest
+	}
+	return ""
+}
+
+func (x *PullImageProgress) GetBytesDone() int64 {
+	if x != nil {
+		return x.BytesDone
+	}
+	return 0
+}
+
+func (x *PullImageProgress) GetBytesTotal() int64 {
+	if x != nil {
+		return x.BytesTotal
+	}
+	return 0
+}
+
+type ConsoleInput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ref           string                 `protobuf:"bytes,1,opt,name=ref,proto3" json:"ref,omitempty"` // required on the first message only
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConsoleInput) Reset() {
+	*x = ConsoleInput{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConsoleInput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConsoleInput) ProtoMessage() {}
+
+func (x *ConsoleInput) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConsoleInput.ProtoReflect.Descriptor instead.
+func (*ConsoleInput) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *ConsoleInput) GetRef() string {
+	if x != nil {
+		return x.Ref
+	}
+	return ""
+}
+
+func (x *ConsoleInput) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ConsoleOutput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConsoleOutput) Reset() {
+	*x = ConsoleOutput{}
+	mi := &file_api_v1_cocoon_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConsoleOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConsoleOutput) ProtoMessage() {}
+
+func (x *ConsoleOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_api_v1_cocoon_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConsoleOutput.ProtoReflect.Descriptor instead.
+func (*ConsoleOutput) Descriptor() ([]byte, []int) {
+	return file_api_v1_cocoon_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ConsoleOutput) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+var File_api_v1_cocoon_proto protoreflect.FileDescriptor
+
+const file_api_v1_cocoon_proto_rawDesc = "" +
+	"\n" +
+	"\x13api/v1/cocoon.proto\x12\tcocoon.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xe8\x02\n" +
+	"\bVMConfig\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03cpu\x18\x02 \x01(\x05R\x03cpu\x12\x16\n" +
+	"\x06memory\x18\x03 \x01(\x03R\x06memory\x12\x18\n" +
+	"\astorage\x18\x04 \x01(\x03R\astorage\x12\x14\n" +
+	"\x05image\x18\x05 \x01(\tR\x05image\x12\x18\n" +
+	"\anetwork\x18\x06 \x01(\tR\anetwork\x12%\n" +
+	"\x0erestart_policy\x18\a \x01(\tR\rrestartPolicy\x129\n" +
+	"\fhealth_check\x18\b \x01(\v2\x16.cocoon.v1.HealthCheckR\vhealthCheck\x127\n" +
+	"\x06labels\x18\t \x03(\v2\x1f.cocoon.v1.VMConfig.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xb7\x01\n" +
+	"\vHealthCheck\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04port\x18\x02 \x01(\x05R\x04port\x12\x12\n" +
+	"\x04path\x18\x03 \x01(\tR\x04path\x12)\n" +
+	"\x10interval_seconds\x18\x04 \x01(\x05R\x0fintervalSeconds\x12'\n" +
+	"\x0ftimeout_seconds\x18\x05 \x01(\x05R\x0etimeoutSeconds\x12\x18\n" +
+	"\aretries\x18\x06 \x01(\x05R\aretries\"u\n" +
+	"\rNetworkConfig\x12\x10\n" +
+	"\x03tap\x18\x01 \x01(\tR\x03tap\x12\x10\n" +
+	"\x03mac\x18\x02 \x01(\tR\x03mac\x12\x0e\n" +
+	"\x02ip\x18\x03 \x01(\tR\x02ip\x12\x18\n" +
+	"\agateway\x18\x04 \x01(\tR\agateway\x12\x16\n" +
+	"\x06prefix\x18\x05 \x01(\x05R\x06prefix\"\xa3\x03\n" +
+	"\x02VM\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05state\x18\x02 \x01(\tR\x05state\x12+\n" +
+	"\x06config\x18\x03 \x01(\v2\x13.cocoon.v1.VMConfigR\x06config\x12\x10\n" +
+	"\x03pid\x18\x04 \x01(\x05R\x03pid\x124\n" +
+	"\bnetworks\x18\x05 \x03(\v2\x18.cocoon.v1.NetworkConfigR\bnetworks\x129\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\tcreatedAt\x129\n" +
+	"\n" +
+	"updated_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\tupdatedAt\x129\n" +
+	"\n" +
+	"started_at\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x129\n" +
+	"\n" +
+	"stopped_at\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\tstoppedAt\x12\x16\n" +
+	"\x06health\x18\n" +
+	" \x01(\tR\x06health\"h\n" +
+	"\x0fCreateVMRequest\x12+\n" +
+	"\x06config\x18\x01 \x01(\v2\x13.cocoon.v1.VMConfigR\x06config\x12\x12\n" +
+	"\x04nics\x18\x02 \x01(\x05R\x04nics\x12\x14\n" +
+	"\x05start\x18\x03 \x01(\bR\x05start\"#\n" +
+	"\rVMRefsRequest\x12\x12\n" +
+	"\x04refs\x18\x01 \x03(\tR\x04refs\"\"\n" +
+	"\x0eVMRefsResponse\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\"\x10\n" +
+	"\x0eListVMsRequest\"2\n" +
+	"\x0fListVMsResponse\x12\x1f\n" +
+	"\x03vms\x18\x01 \x03(\v2\r.cocoon.v1.VMR\x03vms\"$\n" +
+	"\x10PullImageRequest\x12\x10\n" +
+	"\x03ref\x18\x01 \x01(\tR\x03ref\"\xf5\x02\n" +
+	"\x11PullImageProgress\x128\n" +
+	"\x05phase\x18\x01 \x01(\x0e2\".cocoon.v1.PullImageProgress.PhaseR\x05phase\x12\x1f\n" +
+	"\vlayer_index\x18\x02 \x01(\x05R\n" +
+	"layerIndex\x12\x1f\n" +
+	"\vlayer_total\x18\x03 \x01(\x05R\n" +
+	"layerTotal\x12\x16\n" +
+	"\x06digest\x18\x04 \x01(\tR\x06digest\x12\x1d\n" +
+	"\n" +
+	"bytes_done\x18\x05 \x01(\x03R\tbytesDone\x12\x1f\n" +
+	"\vbytes_total\x18\x06 \x01(\x03R\n" +
+	"bytesTotal\"\x8b\x01\n" +
+	"\x05Phase\x12\x15\n" +
+	"\x11PHASE_UNSPECIFIED\x10\x00\x12\x11\n" +
+	"\rPHASE_RESOLVE\x10\x01\x12\x0f\n" +
+	"\vPHASE_LAYER\x10\x02\x12\x12\n" +
+	"\x0ePHASE_DOWNLOAD\x10\x03\x12\x11\n" +
+	"\rPHASE_CONVERT\x10\x04\x12\x10\n" +
+	"\fPHASE_COMMIT\x10\x05\x12\x0e\n" +
+	"\n" +
+	"PHASE_DONE\x10\x06\"4\n" +
+	"\fConsoleInput\x12\x10\n" +
+	"\x03ref\x18\x01 \x01(\tR\x03ref\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"#\n" +
+	"\rConsoleOutput\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data2\x99\x03\n" +
+	"\rCocoonService\x125\n" +
+	"\bCreateVM\x12\x1a.cocoon.v1.CreateVMRequest\x1a\r.cocoon.v1.VM\x12>\n" +
+	"\aStartVM\x12\x18.cocoon.v1.VMRefsRequest\x1a\x19.cocoon.v1.VMRefsResponse\x12=\n" +
+	"\x06StopVM\x12\x18.cocoon.v1.VMRefsRequest\x1a\x19.cocoon.v1.VMRefsResponse\x12@\n" +
+	"\aListVMs\x12\x19.cocoon.v1.ListVMsRequest\x1a\x1a.cocoon.v1.ListVMsResponse\x12H\n" +
+	"\tPullImage\x12\x1b.cocoon.v1.PullImageRequest\x1a\x1c.cocoon.v1.PullImageProgress0\x01\x12F\n" +
+	"\rStreamConsole\x12\x17.cocoon.v1.ConsoleInput\x1a\x18.cocoon.v1.ConsoleOutput(\x010\x01B,Z*github.com/projecteru2/cocoon/api/v1;apiv1b\x06proto3"
+
+var (
+	file_api_v1_cocoon_proto_rawDescOnce sync.Once
+	file_api_v1_cocoon_proto_rawDescData []byte
+)
+
+func file_api_v1_cocoon_proto_rawDescGZIP() []byte {
+	file_api_v1_cocoon_proto_rawDescOnce.Do(func() {
+		file_api_v1_cocoon_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_v1_cocoon_proto_rawDesc), len(file_api_v1_cocoon_proto_rawDesc)))
+	})
+	return file_api_v1_cocoon_proto_rawDescData
+}
+
+var file_api_v1_cocoon_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_api_v1_cocoon_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_api_v1_cocoon_proto_goTypes = []any{
+	(PullImageProgress_Phase)(0),  // 0: cocoon.v1.PullImageProgress.Phase
+	(*VMConfig)(nil),              // 1: cocoon.v1.VMConfig
+	(*HealthCheck)(nil),           // 2: cocoon.v1.HealthCheck
+	(*NetworkConfig)(nil),         // 3: cocoon.v1.NetworkConfig
+	(*VM)(nil),                    // 4: cocoon.v1.VM
+	(*CreateVMRequest)(nil),       // 5: cocoon.v1.CreateVMRequest
+	(*VMRefsRequest)(nil),         // 6: cocoon.v1.VMRefsRequest
+	(*VMRefsResponse)(nil),        // 7: cocoon.v1.VMRefsResponse
+	(*ListVMsRequest)(nil),        // 8: cocoon.v1.ListVMsRequest
+	(*ListVMsResponse)(nil),       // 9: cocoon.v1.ListVMsResponse
+	(*PullImageRequest)(nil),      // 10: cocoon.v1.PullImageRequest
+	(*PullImageProgress)(nil),     // 11: cocoon.v1.PullImageProgress
+	(*ConsoleInput)(nil),          // 12: cocoon.v1.ConsoleInput
+	(*ConsoleOutput)(nil),         // 13: cocoon.v1.ConsoleOutput
+	nil,                           // 14: cocoon.v1.VMConfig.LabelsEntry
+	(*timestamppb.Timestamp)(nil), // 15: google.protobuf.Timestamp
+}
+var file_api_v1_cocoon_proto_depIdxs = []int32{
+	2,  // 0: cocoon.v1.VMConfig.health_check:type_name -> cocoon.v1.HealthCheck
+	14, // 1: cocoon.v1.VMConfig.labels:type_name -> cocoon.v1.VMConfig.LabelsEntry
+	1,  // 2: cocoon.v1.VM.config:type_name -> cocoon.v1.VMConfig
+	3,  // 3: cocoon.v1.VM.networks:type_name -> cocoon.v1.NetworkConfig
+	15, // 4: cocoon.v1.VM.created_at:type_name -> google.protobuf.Timestamp
+	15, // 5: cocoon.v1.VM.updated_at:type_name -> google.protobuf.Timestamp
+	15, // 6: cocoon.v1.VM.started_at:type_name -> google.protobuf.Timestamp
+	15, // 7: cocoon.v1.VM.stopped_at:type_name -> google.protobuf.Timestamp
+	1,  // 8: cocoon.v1.CreateVMRequest.config:type_name -> cocoon.v1.VMConfig
+	4,  // 9: cocoon.v1.ListVMsResponse.vms:type_name -> cocoon.v1.VM
+	0,  // 10: cocoon.v1.PullImageProgress.phase:type_name -> cocoon.v1.PullImageProgress.Phase
+	5,  // 11: cocoon.v1.CocoonService.CreateVM:input_type -> cocoon.v1.CreateVMRequest
+	6,  // 12: cocoon.v1.CocoonService.StartVM:input_type -> cocoon.v1.VMRefsRequest
+	6,  // 13: cocoon.v1.CocoonService.StopVM:input_type -> cocoon.v1.VMRefsRequest
+	8,  // 14: cocoon.v1.CocoonService.ListVMs:input_type -> cocoon.v1.ListVMsRequest
+	10, // 15: cocoon.v1.CocoonService.PullImage:input_type -> cocoon.v1.PullImageRequest
+	12, // 16: cocoon.v1.CocoonService.StreamConsole:input_type -> cocoon.v1.ConsoleInput
+	4,  // 17: cocoon.v1.CocoonService.CreateVM:output_type -> cocoon.v1.VM
+	7,  // 18: cocoon.v1.CocoonService.StartVM:output_type -> cocoon.v1.VMRefsResponse
+	7,  // 19: cocoon.v1.CocoonService.StopVM:output_type -> cocoon.v1.VMRefsResponse
+	9,  // 20: cocoon.v1.CocoonService.ListVMs:output_type -> cocoon.v1.ListVMsResponse
+	11, // 21: cocoon.v1.CocoonService.PullImage:output_type -> cocoon.v1.PullImageProgress
+	13, // 22: cocoon.v1.CocoonService.StreamConsole:output_type -> cocoon.v1.ConsoleOutput
+	17, // [17:23] is the sub-list for method output_type
+	11, // [11:17] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
+}
+
+func init() { file_api_v1_cocoon_proto_init() }
+func file_api_v1_cocoon_proto_init() {
+	if File_api_v1_cocoon_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_v1_cocoon_proto_rawDesc), len(file_api_v1_cocoon_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_v1_cocoon_proto_goTypes,
+		DependencyIndexes: file_api_v1_cocoon_proto_depIdxs,
+		EnumInfos:         file_api_v1_cocoon_proto_enumTypes,
+		MessageInfos:      file_api_v1_cocoon_proto_msgTypes,
+	}.Build()
+	File_api_v1_cocoon_proto = out.File
+	file_api_v1_cocoon_proto_goTypes = nil
+	file_api_v1_cocoon_proto_depIdxs = nil
+}
@@ -0,0 +1,333 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: api/v1/cocoon.proto
+
+package apiv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	CocoonService_CreateVM_FullMethodName      = "/cocoon.v1.CocoonService/CreateVM"
+	CocoonService_StartVM_FullMethodName       = "/cocoon.v1.CocoonService/StartVM"
+	CocoonService_StopVM_FullMethodName        = "/cocoon.v1.CocoonService/StopVM"
+	CocoonService_ListVMs_FullMethodName       = "/cocoon.v1.CocoonService/ListVMs"
+	CocoonService_PullImage_FullMethodName     = "/cocoon.v1.CocoonService/PullImage"
+	CocoonService_StreamConsole_FullMethodName = "/cocoon.v1.CocoonService/StreamConsole"
+)
+
+// CocoonServiceClient is the client API for CocoonService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// CocoonService is the daemon control API, served on a unix socket
+// (default: <run_dir>/cocoon.sock).
+type CocoonServiceClient interface {
+	// CreateVM resolves the image, allocates network, and registers a VM.
+	// The VM is left in created state unless start is set.
+	CreateVM(ctx context.Context, in *CreateVMRequest, opts ...grpc.CallOption) (*VM, error)
+	// StartVM starts created/stopped VMs; returns the IDs that started.
+	StartVM(ctx context.Context, in *VMRefsRequest, opts ...grpc.CallOption) (*VMRefsResponse, error)
+	// StopVM stops running VMs; returns the IDs that stopped.
+	StopVM(ctx context.Context, in *VMRefsRequest, opts ...grpc.CallOption) (*VMRefsResponse, error)
+	// ListVMs returns every known VM.
+	ListVMs(ctx context.Context, in *ListVMsRequest, opts ...grpc.CallOption) (*ListVMsResponse, error)
+	// PullImage pulls an OCI image reference or cloud image URL and streams
+	// progress until the pull completes.
+	PullImage(ctx context.Context, in *PullImageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PullImageProgress], error)
+	// StreamConsole attaches to a VM console. The first input message must
+	// carry the VM ref; subsequent messages carry keystrokes.
+	StreamConsole(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConsoleInput, ConsoleOutput], error)
+}
+
+type cocoonServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCocoonServiceClient(cc grpc.ClientConnInterface) CocoonServiceClient {
+	return &cocoonServiceClient{cc}
+}
+
+func (c *cocoonServiceClient) CreateVM(ctx context.Context, in *CreateVMRequest, opts ...grpc.CallOption) (*VM, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VM)
+	err := c.cc.Invoke(ctx, CocoonService_CreateVM_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cocoonServiceClient) StartVM(ctx context.Context, in *VMRefsRequest, opts ...grpc.CallOption) (*VMRefsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VMRefsResponse)
+	err := c.cc.Invoke(ctx, CocoonService_StartVM_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cocoonServiceClient) StopVM(ctx context.Context, in *VMRefsRequest, opts ...grpc.CallOption) (*VMRefsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(VMRefsResponse)
+	err := c.cc.Invoke(ctx, CocoonService_StopVM_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cocoonServiceClient) ListVMs(ctx context.Context, in *ListVMsRequest, opts ...grpc.CallOption) (*ListVMsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVMsResponse)
+	err := c.cc.Invoke(ctx, CocoonService_ListVMs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cocoonServiceClient) PullImage(ctx context.Context, in *PullImageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PullImageProgress], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CocoonService_ServiceDesc.Streams[0], CocoonService_PullImage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PullImageRequest, PullImageProgress]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CocoonService_PullImageClient = grpc.ServerStreamingClient[PullImageProgress]
+
+func (c *cocoonServiceClient) StreamConsole(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConsoleInput, ConsoleOutput], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CocoonService_ServiceDesc.Streams[1], CocoonService_StreamConsole_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ConsoleInput, ConsoleOutput]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CocoonService_StreamConsoleClient = grpc.BidiStreamingClient[ConsoleInput, ConsoleOutput]
+
+// CocoonServiceServer is the server API for CocoonService service.
+// All implementations must embed UnimplementedCocoonServiceServer
+// for forward compatibility.
+//
+// CocoonService is the daemon control API, served on a unix socket
+// (default: <run_dir>/cocoon.sock).
+type CocoonServiceServer interface {
+	// CreateVM resolves the image, allocates network, and registers a VM.
+	// The VM is left in created state unless start is set.
+	CreateVM(context.Context, *CreateVMRequest) (*VM, error)
+	// StartVM starts created/stopped VMs; returns the IDs that started.
+	StartVM(context.Context, *VMRefsRequest) (*VMRefsResponse, error)
+	// StopVM stops running VMs; returns the IDs that stopped.
+	StopVM(context.Context, *VMRefsRequest) (*VMRefsResponse, error)
+	// ListVMs returns every known VM.
+	ListVMs(context.Context, *ListVMsRequest) (*ListVMsResponse, error)
+	// PullImage pulls an OCI image reference or cloud image URL and streams
+	// progress until the pull completes.
+	PullImage(*PullImageRequest, grpc.ServerStreamingServer[PullImageProgress]) error
+	// StreamConsole attaches to a VM console. The first input message must
+	// carry the VM ref; subsequent messages carry keystrokes.
+	StreamConsole(grpc.BidiStreamingServer[ConsoleInput, ConsoleOutput]) error
+	mustEmbedUnimplementedCocoonServiceServer()
+}
+
+// UnimplementedCocoonServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedCocoonServiceServer struct{}
+
+func (UnimplementedCocoonServiceServer) CreateVM(context.Context, *CreateVMRequest) (*VM, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateVM not implemented")
+}
+func (UnimplementedCocoonServiceServer) StartVM(context.Context, *VMRefsRequest) (*VMRefsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartVM not implemented")
+}
+func (UnimplementedCocoonServiceServer) StopVM(context.Context, *VMRefsRequest) (*VMRefsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopVM not implemented")
+}
+func (UnimplementedCocoonServiceServer) ListVMs(context.Context, *ListVMsRequest) (*ListVMsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVMs not implemented")
+}
+func (UnimplementedCocoonServiceServer) PullImage(*PullImageRequest, grpc.ServerStreamingServer[PullImageProgress]) error {
+	return status.Errorf(codes.Unimplemented, "method PullImage not implemented")
+}
+func (UnimplementedCocoonServiceServer) StreamConsole(grpc.BidiStreamingServer[ConsoleInput, ConsoleOutput]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamConsole not implemented")
+}
+func (UnimplementedCocoonServiceServer) mustEmbedUnimplementedCocoonServiceServer() {}
+func (UnimplementedCocoonServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeCocoonServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CocoonServiceServer will
+// result in compilation errors.
+type UnsafeCocoonServiceServer interface {
+	mustEmbedUnimplementedCocoonServiceServer()
+}
+
+func RegisterCocoonServiceServer(s grpc.ServiceRegistrar, srv CocoonServiceServer) {
+	// If the following call pancis, it indicates UnimplementedCocoonServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&CocoonService_ServiceDesc, srv)
+}
+
+func _CocoonService_CreateVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateVMRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CocoonServiceServer).CreateVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CocoonService_CreateVM_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CocoonServiceServer).CreateVM(ctx, req.(*CreateVMRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CocoonService_StartVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMRefsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CocoonServiceServer).StartVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CocoonService_StartVM_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CocoonServiceServer).StartVM(ctx, req.(*VMRefsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CocoonService_StopVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VMRefsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CocoonServiceServer).StopVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CocoonService_StopVM_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CocoonServiceServer).StopVM(ctx, req.(*VMRefsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CocoonService_ListVMs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVMsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CocoonServiceServer).ListVMs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CocoonService_ListVMs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CocoonServiceServer).ListVMs(ctx, req.(*ListVMsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CocoonService_PullImage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PullImageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CocoonServiceServer).PullImage(m, &grpc.GenericServerStream[PullImageRequest, PullImageProgress]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CocoonService_PullImageServer = grpc.ServerStreamingServer[PullImageProgress]
+
+func _CocoonService_StreamConsole_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CocoonServiceServer).StreamConsole(&grpc.GenericServerStream[ConsoleInput, ConsoleOutput]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CocoonService_StreamConsoleServer = grpc.BidiStreamingServer[ConsoleInput, ConsoleOutput]
+
+// CocoonService_ServiceDesc is the grpc.ServiceDesc for CocoonService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CocoonService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cocoon.v1.CocoonService",
+	HandlerType: (*CocoonServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateVM",
+			Handler:    _CocoonService_CreateVM_Handler,
+		},
+		{
+			MethodName: "StartVM",
+			Handler:    _CocoonService_StartVM_Handler,
+		},
+		{
+			MethodName: "StopVM",
+			Handler:    _CocoonService_StopVM_Handler,
+		},
+		{
+			MethodName: "ListVMs",
+			Handler:    _CocoonService_ListVMs_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PullImage",
+			Handler:       _CocoonService_PullImage_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "StreamConsole",
+			Handler:       _CocoonService_StreamConsole_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "api/v1/cocoon.proto",
+}
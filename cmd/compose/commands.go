@@ -0,0 +1,53 @@
+package compose
+
+import (
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/compose"
+)
+
+// Actions defines multi-VM manifest operations.
+type Actions interface {
+	Up(cmd *cobra.Command, args []string) error
+	Down(cmd *cobra.Command, args []string) error
+	PS(cmd *cobra.Command, args []string) error
+}
+
+// Command builds the "compose" parent command with all subcommands.
+func Command(h Actions) *cobra.Command {
+	composeCmd := &cobra.Command{
+		Use:   "compose",
+		Short: "Manage a project of VMs described by a YAML manifest",
+	}
+	composeCmd.PersistentFlags().StringP("file", "f", compose.DefaultFile, "manifest path")
+	composeCmd.PersistentFlags().StringP("project-name", "p", "", "project name (empty = the manifest's name, else its directory's)")
+
+	upCmd := &cobra.Command{
+		Use:   "up [flags]",
+		Short: "Create and start the project's VMs, in dependency order; VMs already up are kept",
+		Args:  cobra.NoArgs,
+		RunE:  h.Up,
+	}
+	upCmd.Flags().Bool("recreate", false, "replace VMs whose manifest settings changed since they were created")
+	upCmd.Flags().Bool("remove-orphans", false, "delete project VMs no longer in the manifest")
+
+	downCmd := &cobra.Command{
+		Use:   "down [flags]",
+		Short: "Stop and delete the project's VMs, in reverse dependency order",
+		Args:  cobra.NoArgs,
+		RunE:  h.Down,
+	}
+	downCmd.Flags().Bool("volumes", false, "also delete the volumes the manifest declares")
+
+	psCmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List the project's VMs",
+		Args:  cobra.NoArgs,
+		RunE:  h.PS,
+	}
+	cmdcore.AddFormatFlag(psCmd)
+
+	composeCmd.AddCommand(upCmd, downCmd, psCmd)
+	return composeCmd
+}
@@ -0,0 +1,322 @@
+package compose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	cmdvm "github.com/projecteru2/cocoon/cmd/vm"
+	"github.com/projecteru2/cocoon/compose"
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/volume"
+)
+
+type Handler struct {
+	cmdcore.BaseHandler
+}
+
+// plan is what "compose up" applies to one VM of the manifest.
+type plan struct {
+	key   string
+	vmCfg *types.VMConfig
+	nics  int
+}
+
+func (h Handler) Up(cmd *cobra.Command, _ []string) error {
+	ctx, conf, m, hyper, err := h.init(cmd)
+	if err != nil {
+		return err
+	}
+	recreate, _ := cmd.Flags().GetBool("recreate")
+	removeOrphans, _ := cmd.Flags().GetBool("remove-orphans")
+	logger := log.WithFunc("cmd.compose.up")
+
+	// Turn every VM into its create config first, so a bad entry fails
+	// the whole manifest before anything changes.
+	order, err := m.Order()
+	if err != nil {
+		return err
+	}
+	plans := make([]plan, 0, len(order))
+	for _, key := range order {
+		vmCfg, nics, err := createConfig(conf, m, key)
+		if err != nil {
+			return fmt.Errorf("vms.%s: %w", key, err)
+		}
+		plans = append(plans, plan{key: key, vmCfg: vmCfg, nics: nics})
+	}
+
+	if err := ensureVolumes(ctx, conf, m); err != nil {
+		return err
+	}
+	existing, err := projectVMs(ctx, hyper, m.Name)
+	if err != nil {
+		return err
+	}
+	for _, p := range plans {
+		vm := existing[p.key]
+		delete(existing, p.key)
+		if vm != nil && vm.Config.Labels[compose.SpecLabel] != p.vmCfg.Labels[compose.SpecLabel] {
+			// Starting it would run the old settings as if they were current.
+			if !recreate {
+				logger.Warnf(ctx, "%s: VM %s predates the manifest's settings and is left as it is; --recreate replaces it", p.key, vm.Config.Name)
+				continue
+			}
+			if _, err := service.DeleteVMs(ctx, conf, hyper, []string{vm.ID}, true); err != nil {
+				return fmt.Errorf("%s: remove outdated VM: %w", p.key, err)
+			}
+			logger.Infof(ctx, "%s: removed outdated VM %s", p.key, vm.ID)
+			vm = nil
+		}
+		if vm == nil {
+			if vm, _, err = service.CreateVM(ctx, conf, p.vmCfg, p.nics); err != nil {
+				return fmt.Errorf("%s: %w", p.key, err)
+			}
+			logger.Infof(ctx, "%s: created VM %s (name: %s)", p.key, vm.ID, vm.Config.Name)
+		}
+		if vm.State == types.VMStateRunning {
+			continue
+		}
+		service.RecoverNetwork(ctx, conf, hyper, []string{vm.ID})
+		if _, err := hyper.Start(ctx, []string{vm.ID}); err != nil {
+			return fmt.Errorf("%s: start: %w", p.key, err)
+		}
+		logger.Infof(ctx, "%s: started VM %s", p.key, vm.Config.Name)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(existing)) {
+		vm := existing[key]
+		if !removeOrphans {
+			logger.Warnf(ctx, "%s: VM %s is not in the manifest; --remove-orphans deletes it", key, vm.Config.Name)
+			continue
+		}
+		if _, err := service.DeleteVMs(ctx, conf, hyper, []string{vm.ID}, true); err != nil {
+			return fmt.Errorf("%s: remove orphan: %w", key, err)
+		}
+		logger.Infof(ctx, "%s: removed orphan VM %s", key, vm.ID)
+	}
+	return nil
+}
+
+func (h Handler) Down(cmd *cobra.Command, _ []string) error {
+	ctx, conf, m, hyper, err := h.init(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.compose.down")
+	vms, err := projectVMs(ctx, hyper, m.Name)
+	if err != nil {
+		return err
+	}
+	keys, err := upOrder(m, vms)
+	if err != nil {
+		return err
+	}
+	slices.Reverse(keys)
+
+	// Stop one by one, dependents first, then delete them all.
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		vm := vms[key]
+		ids = append(ids, vm.ID)
+		if vm.State != types.VMStateRunning {
+			continue
+		}
+		if _, err := hyper.Stop(ctx, []string{vm.ID}); err != nil {
+			return fmt.Errorf("%s: stop: %w", key, err)
+		}
+		logger.Infof(ctx, "%s: stopped VM %s", key, vm.Config.Name)
+	}
+	deleted, err := service.DeleteVMs(ctx, conf, hyper, ids, true)
+	for _, id := range deleted {
+		logger.Infof(ctx, "deleted VM: %s", id)
+	}
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	if len(ids) == 0 {
+		logger.Infof(ctx, "no VMs in project %s", m.Name)
+	}
+
+	if withVolumes, _ := cmd.Flags().GetBool("volumes"); !withVolumes || len(m.Volumes) == 0 {
+		return nil
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.Volumes)) {
+		name := m.VolumeName(key)
+		if _, err := volumes.Delete(ctx, []string{name}); err != nil {
+			if errors.Is(err, volume.ErrNotFound) {
+				continue
+			}
+			return fmt.Errorf("delete volume %s: %w", name, err)
+		}
+		logger.Infof(ctx, "deleted volume: %s", name)
+	}
+	return nil
+}
+
+// psRow is one VM of "compose ps".
+type psRow struct {
+	Key string `json:"vm"`
+	*types.VM
+}
+
+func (h Handler) PS(cmd *cobra.Command, _ []string) error {
+	ctx, _, m, hyper, err := h.init(cmd)
+	if err != nil {
+		return err
+	}
+	vms, err := projectVMs(ctx, hyper, m.Name)
+	if err != nil {
+		return err
+	}
+	keys, err := upOrder(m, vms)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 && cmdcore.IsTableFormat(cmd) {
+		fmt.Println("No VMs found.")
+		return nil
+	}
+	rows := make([]psRow, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, psRow{Key: key, VM: vms[key].Redacted()})
+	}
+	return cmdcore.OutputFormatted(cmd, rows, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "VM\tNAME\tID\tSTATE\tIP\tIMAGE") //nolint:errcheck
+		for _, r := range rows {
+			ip := r.PrimaryIP()
+			if ip == "" {
+				ip = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				r.Key, r.Config.Name, r.ID, cmdcore.ReconcileState(r.VM), ip, r.Config.Image)
+		}
+	})
+}
+
+// init loads the manifest along with the config and hypervisor.
+func (h Handler) init(cmd *cobra.Command) (context.Context, *config.Config, *compose.Manifest, hypervisor.Hypervisor, error) {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	file, _ := cmd.Flags().GetString("file")
+	project, _ := cmd.Flags().GetString("project-name")
+	m, err := compose.Load(file, project)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return ctx, conf, m, hyper, nil
+}
+
+// createConfig runs the VM's manifest settings through the "vm create"
+// flags, so they are parsed and validated exactly like on the command
+// line, and stamps the result with its digest.
+func createConfig(conf *config.Config, m *compose.Manifest, key string) (*types.VMConfig, int, error) {
+	cmd := &cobra.Command{}
+	cmdvm.AddVMFlags(cmd)
+	for _, f := range m.CreateFlags(key) {
+		if err := cmd.Flags().Set(f.Name, f.Value); err != nil {
+			return nil, 0, fmt.Errorf("--%s %q: %w", f.Name, f.Value, err)
+		}
+	}
+	vmCfg, err := cmdcore.VMConfigFromFlags(cmd, m.VMs[key].Image)
+	if err != nil {
+		return nil, 0, err
+	}
+	nics, err := cmdcore.NICCount(cmd, conf, vmCfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	digest, err := compose.Digest(vmCfg)
+	if err != nil {
+		return nil, 0, err
+	}
+	vmCfg.Labels[compose.SpecLabel] = digest
+	return vmCfg, nics, nil
+}
+
+// ensureVolumes creates the manifest's volumes that do not exist yet.
+func ensureVolumes(ctx context.Context, conf *config.Config, m *compose.Manifest) error {
+	if len(m.Volumes) == 0 {
+		return nil
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(m.Volumes)) {
+		name := m.VolumeName(key)
+		_, err := volumes.Inspect(ctx, name)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, volume.ErrNotFound) {
+			return fmt.Errorf("inspect volume %s: %w", name, err)
+		}
+		size, err := m.VolumeSize(key)
+		if err != nil {
+			return err
+		}
+		vol, err := volumes.Create(ctx, name, size, m.Volumes[key].FS)
+		if err != nil {
+			return fmt.Errorf("create volume %s: %w", name, err)
+		}
+		log.WithFunc("cmd.compose.up").Infof(ctx, "volume created: %s (name: %s)", vol.ID, vol.Name)
+	}
+	return nil
+}
+
+// projectVMs returns the VMs labeled as the project's, by manifest key.
+func projectVMs(ctx context.Context, hyper hypervisor.Hypervisor, project string) (map[string]*types.VM, error) {
+	vms, err := hyper.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list VMs: %w", err)
+	}
+	out := map[string]*types.VM{}
+	for _, vm := range vms {
+		if vm.Config.Labels[compose.ProjectLabel] == project {
+			out[vm.Config.Labels[compose.VMLabel]] = vm
+		}
+	}
+	return out, nil
+}
+
+// upOrder returns the keys of vms in manifest order, then the VMs no
+// longer in the manifest, so those go down first.
+func upOrder(m *compose.Manifest, vms map[string]*types.VM) ([]string, error) {
+	order, err := m.Order()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, key := range order {
+		if vms[key] != nil {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(vms)) {
+		if _, ok := m.VMs[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
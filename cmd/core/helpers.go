@@ -1,27 +1,30 @@
 package core
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
+	"text/template"
 
 	units "github.com/docker/go-units"
 	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/projecteru2/core/log"
 	"github.com/spf13/cobra"
 
 	"github.com/projecteru2/cocoon/config"
-	"github.com/projecteru2/cocoon/hypervisor"
-	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
-	imagebackend "github.com/projecteru2/cocoon/images"
-	"github.com/projecteru2/cocoon/images/cloudimg"
-	"github.com/projecteru2/cocoon/images/oci"
-	"github.com/projecteru2/cocoon/network"
-	"github.com/projecteru2/cocoon/network/cni"
-	"github.com/projecteru2/cocoon/snapshot"
-	"github.com/projecteru2/cocoon/snapshot/localfile"
+	"github.com/projecteru2/cocoon/metadata"
 	"github.com/projecteru2/cocoon/types"
 	"github.com/projecteru2/cocoon/utils"
 )
@@ -65,101 +68,117 @@ func CommandContext(cmd *cobra.Command) context.Context {
 	return context.Background()
 }
 
-// InitBackends initializes all image backends and the hypervisor.
-func InitBackends(ctx context.Context, conf *config.Config) ([]imagebackend.Images, hypervisor.Hypervisor, error) {
-	backends, err := InitImageBackends(ctx, conf)
+// VMConfigFromFlags builds VMConfig for create/run commands.
+func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error) {
+	vmName, _ := cmd.Flags().GetString("name")
+	cpu, _ := cmd.Flags().GetInt("cpu")
+	maxCPU, _ := cmd.Flags().GetInt("max-cpu")
+	memStr, _ := cmd.Flags().GetString("memory")
+	storStr, _ := cmd.Flags().GetString("storage")
+	networks, _ := cmd.Flags().GetStringArray("network")
+	ip, _ := cmd.Flags().GetString("ip")
+	dhcp, _ := cmd.Flags().GetBool("dhcp")
+	restart, _ := cmd.Flags().GetString("restart")
+	autostart, _ := cmd.Flags().GetBool("autostart")
+	cpuset, _ := cmd.Flags().GetString("cpuset")
+	cpusetShared, _ := cmd.Flags().GetBool("cpuset-shared")
+	hugePages, _ := cmd.Flags().GetString("hugepages")
+	pmemLayers, _ := cmd.Flags().GetBool("pmem-layers")
+	tpm, _ := cmd.Flags().GetBool("tpm")
+	encrypt, _ := cmd.Flags().GetBool("encrypt")
+	diskBackend, _ := cmd.Flags().GetString("disk-backend")
+	dataDir, _ := cmd.Flags().GetString("data-dir")
+	pool, _ := cmd.Flags().GetString("pool")
+	ephemeralStr, _ := cmd.Flags().GetString("ephemeral-disk")
+	swapStr, _ := cmd.Flags().GetString("swap")
+	readOnly, _ := cmd.Flags().GetBool("read-only")
+	prealloc, _ := cmd.Flags().GetString("prealloc")
+	diskIOPS, _ := cmd.Flags().GetInt64("disk-iops")
+	diskBWStr, _ := cmd.Flags().GetString("disk-bandwidth")
+	confidential, _ := cmd.Flags().GetString("confidential")
+	firmwareRef, _ := cmd.Flags().GetString("firmware")
+	cmdlineAppend, _ := cmd.Flags().GetString("cmdline-append")
+	serial, _ := cmd.Flags().GetString("serial")
+	console, _ := cmd.Flags().GetString("console")
+	seccomp, _ := cmd.Flags().GetString("seccomp")
+	landlock, _ := cmd.Flags().GetString("landlock")
+	chBinary, err := BinaryFromFlag(cmd, "ch-binary")
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	ch, err := cloudhypervisor.New(conf)
+	healthCheck, err := healthCheckFromFlags(cmd)
 	if err != nil {
-		return nil, nil, fmt.Errorf("init hypervisor: %w", err)
+		return nil, err
 	}
-	return backends, ch, nil
-}
-
-// InitImageBackends initializes only image backends (no hypervisor needed).
-func InitImageBackends(ctx context.Context, conf *config.Config) ([]imagebackend.Images, error) {
-	ociStore, err := oci.New(ctx, conf)
+	bootProbe, err := bootProbeFromFlags(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("init oci backend: %w", err)
+		return nil, err
 	}
-	cloudimgStore, err := cloudimg.New(ctx, conf)
+	userData, replaceUserData, templateUserData, err := userDataFromFlags(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("init cloudimg backend: %w", err)
+		return nil, err
 	}
-	return []imagebackend.Images{ociStore, cloudimgStore}, nil
-}
-
-// InitImageBackendsForPull returns concrete backend types needed by Pull.
-func InitImageBackendsForPull(ctx context.Context, conf *config.Config) (*oci.OCI, *cloudimg.CloudImg, error) {
-	ociStore, err := oci.New(ctx, conf)
+	files, runCmds, err := provisionFromFlags(cmd)
 	if err != nil {
-		return nil, nil, fmt.Errorf("init oci backend: %w", err)
+		return nil, err
 	}
-	cloudimgStore, err := cloudimg.New(ctx, conf)
+	env, _ := cmd.Flags().GetStringArray("env")
+	timezone, _ := cmd.Flags().GetString("timezone")
+	locale, _ := cmd.Flags().GetString("locale")
+	if replaceUserData && (len(files) > 0 || len(runCmds) > 0 || len(env) > 0) {
+		return nil, errors.New("--copy-in, --run-cmd and --env are part of the generated user-data, which --replace-user-data discards")
+	}
+	metadataFormat, _ := cmd.Flags().GetString("metadata-format")
+	hostname, _ := cmd.Flags().GetString("hostname")
+	domain, _ := cmd.Flags().GetString("domain")
+	keySpecs, _ := cmd.Flags().GetStringArray("ssh-key")
+	var sshKeys []string
+	for _, spec := range keySpecs {
+		keys, keyErr := metadata.LoadSSHKeys(spec)
+		if keyErr != nil {
+			return nil, fmt.Errorf("--ssh-key: %w", keyErr)
+		}
+		sshKeys = append(sshKeys, keys...)
+	}
+	labelSpecs, _ := cmd.Flags().GetStringArray("label")
+	labels, err := types.ParseLabels(labelSpecs)
 	if err != nil {
-		return nil, nil, fmt.Errorf("init cloudimg backend: %w", err)
+		return nil, err
 	}
-	return ociStore, cloudimgStore, nil
-}
-
-// InitHypervisor initializes only the hypervisor.
-func InitHypervisor(conf *config.Config) (hypervisor.Hypervisor, error) {
-	ch, err := cloudhypervisor.New(conf)
+	volumeSpecs, _ := cmd.Flags().GetStringArray("volume")
+	volumes, err := types.ParseVolumeAttachments(volumeSpecs)
 	if err != nil {
-		return nil, fmt.Errorf("init hypervisor: %w", err)
+		return nil, err
 	}
-	return ch, nil
-}
-
-// InitNetwork creates the CNI network provider.
-func InitNetwork(conf *config.Config) (network.Network, error) {
-	p, err := cni.New(conf)
+	publishSpecs, _ := cmd.Flags().GetStringArray("publish")
+	publish, err := types.ParsePortMappings(publishSpecs)
 	if err != nil {
-		return nil, fmt.Errorf("init network: %w", err)
+		return nil, err
 	}
-	return p, nil
-}
-
-// InitSnapshot initializes the snapshot backend.
-func InitSnapshot(conf *config.Config) (snapshot.Snapshot, error) {
-	s, err := localfile.New(conf)
+	numa, err := numaFromFlags(cmd)
 	if err != nil {
-		return nil, fmt.Errorf("init snapshot backend: %w", err)
+		return nil, err
 	}
-	return s, nil
-}
-
-// ResolveImage resolves an image reference to StorageConfigs + BootConfig.
-func ResolveImage(ctx context.Context, backends []imagebackend.Images, vmCfg *types.VMConfig) ([]*types.StorageConfig, *types.BootConfig, error) {
-	vms := []*types.VMConfig{vmCfg}
-	var storageConfigs []*types.StorageConfig
-	var bootCfg *types.BootConfig
-	var backendErrs []string
-	for _, b := range backends {
-		confs, boots, err := b.Config(ctx, vms)
-		if err != nil {
-			backendErrs = append(backendErrs, fmt.Sprintf("%s: %v", b.Type(), err))
-			continue
+	limitSpecs, _ := cmd.Flags().GetStringArray("net-limit")
+	var netLimits []uint64
+	for _, spec := range limitSpecs {
+		bps, parseErr := types.ParseBandwidth(spec)
+		if parseErr != nil {
+			return nil, fmt.Errorf("--net-limit: %w", parseErr)
 		}
-		storageConfigs = confs[0]
-		bootCfg = boots[0]
-		break
-	}
-	if bootCfg == nil {
-		return nil, nil, fmt.Errorf("image %q not resolved: %s", vmCfg.Image, strings.Join(backendErrs, "; "))
+		netLimits = append(netLimits, bps)
 	}
-	return storageConfigs, bootCfg, nil
-}
 
-// VMConfigFromFlags builds VMConfig for create/run commands.
-func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error) {
-	vmName, _ := cmd.Flags().GetString("name")
-	cpu, _ := cmd.Flags().GetInt("cpu")
-	memStr, _ := cmd.Flags().GetString("memory")
-	storStr, _ := cmd.Flags().GetString("storage")
-	network, _ := cmd.Flags().GetString("network")
+	mtu, _ := cmd.Flags().GetInt("mtu")
+	vlans, _ := cmd.Flags().GetIntSlice("vlan")
+	cniArgs, _ := cmd.Flags().GetStringArray("cni-arg")
+	macs, _ := cmd.Flags().GetStringArray("mac")
+	for i, mac := range macs {
+		// Normalize so the same address in another notation still collides.
+		if hw, parseErr := net.ParseMAC(mac); parseErr == nil {
+			macs[i] = hw.String()
+		}
+	}
 
 	if vmName == "" {
 		vmName = sanitizeVMName(image)
@@ -173,14 +192,95 @@ func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error
 	if err != nil {
 		return nil, fmt.Errorf("invalid --storage %q: %w", storStr, err)
 	}
+	var ephemeralBytes int64
+	if ephemeralStr != "" {
+		if ephemeralBytes, err = units.RAMInBytes(ephemeralStr); err != nil {
+			return nil, fmt.Errorf("invalid --ephemeral-disk %q: %w", ephemeralStr, err)
+		}
+	}
+	var swapBytes int64
+	if swapStr != "" {
+		if swapBytes, err = units.RAMInBytes(swapStr); err != nil {
+			return nil, fmt.Errorf("invalid --swap %q: %w", swapStr, err)
+		}
+	}
+	var diskBW int64
+	if diskBWStr != "" {
+		if diskBW, err = units.RAMInBytes(diskBWStr); err != nil {
+			return nil, fmt.Errorf("invalid --disk-bandwidth %q: %w", diskBWStr, err)
+		}
+	}
 
 	cfg := &types.VMConfig{
 		Name:    vmName,
 		CPU:     cpu,
+		MaxCPU:  maxCPU,
 		Memory:  memBytes,
 		Storage: storBytes,
 		Image:   image,
-		Network: network,
+
+		Hostname: hostname,
+		Domain:   strings.Trim(domain, "."),
+		IP:       ip,
+		DHCP:     dhcp,
+		Publish:  publish,
+
+		NetLimits: netLimits,
+		MACs:      macs,
+		MTU:       mtu,
+		VLANs:     vlans,
+		CNIArgs:   cniArgs,
+
+		Volumes: volumes,
+
+		RestartPolicy:    types.RestartPolicy(restart),
+		Autostart:        autostart,
+		HealthCheck:      healthCheck,
+		BootProbe:        bootProbe,
+		CPUSet:           cpuset,
+		CPUSetShared:     cpusetShared,
+		NUMA:             numa,
+		HugePages:        types.HugePagesMode(hugePages),
+		PmemLayers:       pmemLayers,
+		TPM:              tpm,
+		Encrypt:          encrypt,
+		ReadOnly:         readOnly,
+		DataDir:          dataDir,
+		Pool:             pool,
+		EphemeralDisk:    ephemeralBytes,
+		Swap:             swapBytes,
+		Prealloc:         types.Prealloc(prealloc),
+		SSHKeys:          sshKeys,
+		Files:            files,
+		Env:              env,
+		Timezone:         timezone,
+		Locale:           locale,
+		RunCmds:          runCmds,
+		UserData:         userData,
+		ReplaceUserData:  replaceUserData,
+		TemplateUserData: templateUserData,
+		MetadataFormat:   types.MetadataFormat(metadataFormat),
+		DiskIOPS:         diskIOPS,
+		DiskBandwidth:    diskBW,
+		DiskBackend:      types.DiskBackend(diskBackend),
+		Confidential:     types.ConfidentialMode(confidential),
+		Firmware:         firmwareRef,
+		Serial:           types.ConsoleMode(serial),
+		Console:          types.ConsoleMode(console),
+		CmdlineAppend:    strings.Join(strings.Fields(cmdlineAppend), " "),
+		Seccomp:          types.SeccompMode(seccomp),
+		Landlock:         types.LandlockMode(landlock),
+		CHBinary:         chBinary,
+		Labels:           labels,
+	}
+	switch len(networks) {
+	case 0:
+	case 1:
+		cfg.Network = networks[0]
+	default:
+		// NICs follow flag order; the first conflist doubles as the default.
+		cfg.Network = networks[0]
+		cfg.Networks = networks
 	}
 	if err := cfg.Validate(); err != nil {
 		return nil, err
@@ -188,6 +288,191 @@ func VMConfigFromFlags(cmd *cobra.Command, image string) (*types.VMConfig, error
 	return cfg, nil
 }
 
+// NICCount returns the number of NICs a create command asks for: one per
+// repeated --network, otherwise --nics.
+func NICCount(cmd *cobra.Command, conf *config.Config, vmCfg *types.VMConfig) (int, error) {
+	nics, _ := cmd.Flags().GetInt("nics")
+	if len(vmCfg.Networks) > 0 {
+		if cmd.Flags().Changed("nics") && nics != len(vmCfg.Networks) {
+			return 0, fmt.Errorf("--nics %d does not match %d --network flags", nics, len(vmCfg.Networks))
+		}
+		return len(vmCfg.Networks), nil
+	}
+	if conf.Rootless && !cmd.Flags().Changed("nics") {
+		if conf.NetworkProvider != config.NetworkProviderUsermode {
+			return 0, nil // rootless mode has no CNI networking; don't fail on the default
+		}
+		// Don't fail on the default when usermode networking cannot run.
+		if _, err := exec.LookPath(conf.PasstBinary); err != nil {
+			log.WithFunc("cmd.NICCount").Warnf(cmd.Context(), "%s not found, creating the VM without NICs: %v", conf.PasstBinary, err)
+			return 0, nil
+		}
+	}
+	return nics, nil
+}
+
+// numaFromFlags parses --numa-nodes, --numa-memory and --numa-host-nodes.
+// Returns nil when no NUMA topology is requested.
+func numaFromFlags(cmd *cobra.Command) (*types.NUMAConfig, error) {
+	nodes, _ := cmd.Flags().GetInt("numa-nodes")
+	memSpec, _ := cmd.Flags().GetString("numa-memory")
+	hostSpec, _ := cmd.Flags().GetString("numa-host-nodes")
+	if nodes == 0 {
+		if memSpec != "" || hostSpec != "" {
+			return nil, errors.New("--numa-memory and --numa-host-nodes require --numa-nodes")
+		}
+		return nil, nil
+	}
+	numa := &types.NUMAConfig{Nodes: nodes}
+	for s := range strings.SplitSeq(memSpec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		size, err := units.RAMInBytes(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --numa-memory %q: %w", s, err)
+		}
+		numa.Memory = append(numa.Memory, size)
+	}
+	for s := range strings.SplitSeq(hostSpec, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --numa-host-nodes %q: %w", s, err)
+		}
+		numa.HostNodes = append(numa.HostNodes, n)
+	}
+	return numa, nil
+}
+
+// healthCheckFromFlags parses --health-check and its tuning flags.
+// Returns nil when no health check is requested.
+func healthCheckFromFlags(cmd *cobra.Command) (*types.HealthCheck, error) {
+	spec, _ := cmd.Flags().GetString("health-check")
+	if spec == "" {
+		return nil, nil
+	}
+	hc, err := types.ParseHealthCheck(spec)
+	if err != nil {
+		return nil, err
+	}
+	interval, _ := cmd.Flags().GetDuration("health-interval")
+	timeout, _ := cmd.Flags().GetDuration("health-timeout")
+	hc.IntervalSeconds = int(interval.Seconds())
+	hc.TimeoutSeconds = int(timeout.Seconds())
+	hc.Retries, _ = cmd.Flags().GetInt("health-retries")
+	return hc, hc.Validate()
+}
+
+// BinaryFromFlag reads an executable flag. Paths are made absolute so the
+// recorded binary does not depend on the caller's working directory; bare
+// names stay as-is and are looked up in PATH at launch.
+func BinaryFromFlag(cmd *cobra.Command, name string) (string, error) {
+	binary, _ := cmd.Flags().GetString(name)
+	if binary == "" || !strings.ContainsRune(binary, filepath.Separator) {
+		return binary, nil
+	}
+	abs, err := filepath.Abs(binary)
+	if err != nil {
+		return "", fmt.Errorf("--%s %q: %w", name, binary, err)
+	}
+	return abs, nil
+}
+
+// bootProbeFromFlags parses --boot-timeout and --boot-pattern.
+// Returns nil when no boot probe is requested.
+func bootProbeFromFlags(cmd *cobra.Command) (*types.BootProbe, error) {
+	timeout, _ := cmd.Flags().GetDuration("boot-timeout")
+	pattern, _ := cmd.Flags().GetString("boot-pattern")
+	if timeout == 0 {
+		if pattern != "" {
+			return nil, errors.New("--boot-pattern requires --boot-timeout")
+		}
+		return nil, nil
+	}
+	bp := &types.BootProbe{TimeoutSeconds: int(timeout.Seconds()), Pattern: pattern}
+	return bp, bp.Validate()
+}
+
+// userDataFromFlags reads the --user-data file ("-" = stdin) and checks
+// it can be merged with, or replace, the generated cloud-config.
+func userDataFromFlags(cmd *cobra.Command) (data string, replace, tmpl bool, err error) {
+	path, _ := cmd.Flags().GetString("user-data")
+	replace, _ = cmd.Flags().GetBool("replace-user-data")
+	tmpl, _ = cmd.Flags().GetBool("user-data-template")
+	if path == "" {
+		if replace || tmpl {
+			return "", false, false, errors.New("--replace-user-data and --user-data-template require --user-data")
+		}
+		return "", false, false, nil
+	}
+	var raw []byte
+	if path == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(path) //nolint:gosec
+	}
+	if err != nil {
+		return "", false, false, fmt.Errorf("read --user-data: %w", err)
+	}
+	if len(raw) == 0 {
+		return "", false, false, fmt.Errorf("--user-data %s is empty", path)
+	}
+	if err := metadata.ValidateUserData(string(raw), replace, tmpl); err != nil {
+		return "", false, false, fmt.Errorf("--user-data %s: %w", path, err)
+	}
+	return string(raw), replace, tmpl, nil
+}
+
+// maxCopyIn caps the --copy-in total: files travel base64-encoded in
+// user-data on the 1 MiB cidata disk.
+const maxCopyIn = 512 << 10
+
+// provisionFromFlags reads --copy-in (local:/guest/path, repeatable) and
+// --run-cmd, which become write_files and runcmd entries of the
+// generated cloud-config.
+func provisionFromFlags(cmd *cobra.Command) ([]types.GuestFile, []string, error) {
+	specs, _ := cmd.Flags().GetStringArray("copy-in")
+	runCmds, _ := cmd.Flags().GetStringArray("run-cmd")
+	var (
+		files []types.GuestFile
+		total int
+	)
+	for _, spec := range specs {
+		local, guest, ok := strings.Cut(spec, ":")
+		if !ok || local == "" || !filepath.IsAbs(guest) {
+			return nil, nil, fmt.Errorf("--copy-in %q: want local:/guest/path", spec)
+		}
+		// The initramfs reads OCI guest paths one per line.
+		if strings.ContainsAny(guest, "\r\n") {
+			return nil, nil, fmt.Errorf("--copy-in %q: the guest path has a line break", spec)
+		}
+		fi, err := os.Stat(local)
+		if err != nil {
+			return nil, nil, fmt.Errorf("--copy-in: %w", err)
+		}
+		if !fi.Mode().IsRegular() {
+			return nil, nil, fmt.Errorf("--copy-in %s: not a regular file", local)
+		}
+		data, err := os.ReadFile(local) //nolint:gosec
+		if err != nil {
+			return nil, nil, fmt.Errorf("--copy-in: %w", err)
+		}
+		if total += len(data); total > maxCopyIn {
+			return nil, nil, fmt.Errorf("--copy-in: files exceed %s in total; attach larger ones with --volume", units.BytesSize(maxCopyIn))
+		}
+		files = append(files, types.GuestFile{Path: filepath.Clean(guest), Mode: fi.Mode().Perm(), Content: data})
+	}
+	for _, c := range runCmds {
+		if strings.TrimSpace(c) == "" || strings.ContainsAny(c, "\r\n") {
+			return nil, nil, fmt.Errorf("--run-cmd %q: want a single non-empty command line", c)
+		}
+	}
+	return files, runCmds, nil
+}
+
 // CloneVMConfigFromFlags builds VMConfig for clone commands.
 // Zero-value flags inherit from the snapshot config; explicit values are validated
 // against the snapshot minimums (clone resources must be >= snapshot's).
@@ -248,62 +533,189 @@ func CloneVMConfigFromFlags(cmd *cobra.Command, snapCfg *types.SnapshotConfig) (
 	return cfg, nil
 }
 
+// UpdateVMConfigFromFlags builds the new VMConfig for update commands.
+// Keeps VM's current values by default; CLI flags override. Storage may
+// only grow: shrinking a disk would truncate guest data.
+func UpdateVMConfigFromFlags(cmd *cobra.Command, vm *types.VM) (*types.VMConfig, error) {
+	result := vm.Config // value copy — keep current VM values
+	if err := overrideResourcesFromFlags(cmd, &result); err != nil {
+		return nil, err
+	}
+	if result.Storage < vm.Config.Storage {
+		return nil, fmt.Errorf("--storage %s below current size %s (shrinking is not supported)", FormatSize(result.Storage), FormatSize(vm.Config.Storage))
+	}
+	if err := result.Validate(); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 // RestoreVMConfigFromFlags builds VMConfig for restore commands.
 // Keeps VM's current values by default; CLI flags override.
 // Validates that final values are >= snapshot minimums.
 func RestoreVMConfigFromFlags(cmd *cobra.Command, vm *types.VM, snapCfg *types.SnapshotConfig) (*types.VMConfig, error) {
+	result := vm.Config // value copy — keep current VM values
+	if err := overrideResourcesFromFlags(cmd, &result); err != nil {
+		return nil, err
+	}
+
+	if result.CPU < snapCfg.CPU {
+		return nil, fmt.Errorf("--cpu %d below snapshot minimum %d", result.CPU, snapCfg.CPU)
+	}
+	if result.Memory < snapCfg.Memory {
+		return nil, fmt.Errorf("--memory %s below snapshot minimum %s", FormatSize(result.Memory), FormatSize(snapCfg.Memory))
+	}
+	if result.Storage < snapCfg.Storage {
+		return nil, fmt.Errorf("--storage %s below snapshot minimum %s", FormatSize(result.Storage), FormatSize(snapCfg.Storage))
+	}
+
+	return &result, nil
+}
+
+// overrideResourcesFromFlags applies non-zero --cpu/--memory/--storage to cfg.
+func overrideResourcesFromFlags(cmd *cobra.Command, cfg *types.VMConfig) error {
 	cpu, _ := cmd.Flags().GetInt("cpu")
 	memStr, _ := cmd.Flags().GetString("memory")
 	storStr, _ := cmd.Flags().GetString("storage")
 
-	result := vm.Config // value copy — keep current VM values
-
 	if cpu > 0 {
-		result.CPU = cpu
+		cfg.CPU = cpu
 	}
 	if memStr != "" {
 		memBytes, err := units.RAMInBytes(memStr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid --memory %q: %w", memStr, err)
+			return fmt.Errorf("invalid --memory %q: %w", memStr, err)
 		}
-		result.Memory = memBytes
+		cfg.Memory = memBytes
 	}
 	if storStr != "" {
 		storBytes, err := units.RAMInBytes(storStr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid --storage %q: %w", storStr, err)
+			return fmt.Errorf("invalid --storage %q: %w", storStr, err)
 		}
-		result.Storage = storBytes
+		cfg.Storage = storBytes
 	}
+	return nil
+}
 
-	if result.CPU < snapCfg.CPU {
-		return nil, fmt.Errorf("--cpu %d below snapshot minimum %d", result.CPU, snapCfg.CPU)
-	}
-	if result.Memory < snapCfg.Memory {
-		return nil, fmt.Errorf("--memory %s below snapshot minimum %s", FormatSize(result.Memory), FormatSize(snapCfg.Memory))
+// ReconcileState checks actual process liveness to detect stale "running" records.
+func ReconcileState(vm *types.VM) string {
+	if effectiveState(vm) != string(vm.State) {
+		return "stopped (stale)"
 	}
-	if result.Storage < snapCfg.Storage {
-		return nil, fmt.Errorf("--storage %s below snapshot minimum %s", FormatSize(result.Storage), FormatSize(snapCfg.Storage))
+	if vm.State == types.VMStateRunning && vm.Health != nil {
+		return fmt.Sprintf("running (%s)", vm.Health.Status)
 	}
+	return string(vm.State)
+}
 
-	return &result, nil
+// VMFilter selects VMs for "vm list --filter". Every set criterion must match.
+type VMFilter struct {
+	Labels map[string]*string // key → required value; nil value = key present
+	State  string             // effective state: stale running VMs count as stopped
+	Image  string
 }
 
-// EnsureFirmwarePath sets default firmware path for cloudimg boot.
-func EnsureFirmwarePath(conf *config.Config, bootCfg *types.BootConfig) {
-	if bootCfg != nil && bootCfg.KernelPath == "" && bootCfg.FirmwarePath == "" {
-		bootCfg.FirmwarePath = cloudimg.NewConfig(conf).FirmwarePath()
+// ParseVMFilter parses repeated --filter values: "label=<key>[=<value>]",
+// "state=<state>", "image=<image>".
+func ParseVMFilter(specs []string) (*VMFilter, error) {
+	f := &VMFilter{}
+	for _, spec := range specs {
+		key, val, ok := strings.Cut(spec, "=")
+		if !ok || val == "" {
+			return nil, fmt.Errorf("--filter %q is invalid: want key=value", spec)
+		}
+		switch key {
+		case "label":
+			if f.Labels == nil {
+				f.Labels = map[string]*string{}
+			}
+			k, v, hasValue := strings.Cut(val, "=")
+			f.Labels[k] = nil
+			if hasValue {
+				f.Labels[k] = &v
+			}
+		case "state":
+			f.State = val
+		case "image":
+			f.Image = val
+		default:
+			return nil, fmt.Errorf("--filter key %q is invalid: must be label, state, or image", key)
+		}
 	}
+	return f, nil
 }
 
-// ReconcileState checks actual process liveness to detect stale "running" records.
-func ReconcileState(vm *types.VM) string {
+// Match reports whether vm satisfies every criterion of f.
+func (f *VMFilter) Match(vm *types.VM) bool {
+	if f.State != "" && f.State != effectiveState(vm) {
+		return false
+	}
+	if f.Image != "" && f.Image != vm.Config.Image {
+		return false
+	}
+	for k, want := range f.Labels {
+		got, ok := vm.Config.Labels[k]
+		if !ok || (want != nil && got != *want) {
+			return false
+		}
+	}
+	return true
+}
+
+func effectiveState(vm *types.VM) string {
 	if vm.State == types.VMStateRunning && !utils.IsProcessAlive(vm.PID) {
-		return "stopped (stale)"
+		return string(types.VMStateStopped)
 	}
 	return string(vm.State)
 }
 
+// Conditions accepted by "vm wait --for".
+const (
+	WaitRunning = "running"
+	WaitStopped = "stopped"
+	WaitHealthy = "healthy"
+	WaitIP      = "ip"
+)
+
+// WaitConditionMet reports whether vm satisfies a "vm wait --for" condition.
+// It returns an error when the condition can no longer be reached without
+// outside intervention, so callers stop waiting instead of timing out.
+func WaitConditionMet(vm *types.VM, cond string) (bool, error) {
+	if vm.State == types.VMStateError {
+		return false, fmt.Errorf("VM %s is in error state", vm.ID)
+	}
+	alive := vm.State == types.VMStateRunning && utils.IsProcessAlive(vm.PID)
+	switch cond {
+	case WaitRunning:
+		return alive, nil
+	case WaitStopped:
+		return !alive && vm.State != types.VMStateCreating, nil
+	case WaitHealthy:
+		if vm.Config.HealthCheck == nil {
+			return false, fmt.Errorf("VM %s has no health check", vm.ID)
+		}
+		return alive && vm.Health != nil && vm.Health.Status == types.HealthHealthy, nil
+	case WaitIP:
+		return alive && vm.PrimaryIP() != "", nil
+	default:
+		return false, fmt.Errorf("--for %q is invalid: must be %s, %s, %s or %s", cond, WaitRunning, WaitStopped, WaitHealthy, WaitIP)
+	}
+}
+
+// ParseSignal parses a --signal value for kill: KILL/TERM, with or
+// without the SIG prefix, or the signal number.
+func ParseSignal(s string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(s), "SIG") {
+	case "KILL", "9":
+		return syscall.SIGKILL, nil
+	case "TERM", "15":
+		return syscall.SIGTERM, nil
+	default:
+		return 0, fmt.Errorf("--signal %q is invalid: must be KILL or TERM", s)
+	}
+}
+
 // OutputJSON encodes v as indented JSON to stdout.
 func OutputJSON(v any) error {
 	enc := json.NewEncoder(os.Stdout)
@@ -311,28 +723,102 @@ func OutputJSON(v any) error {
 	return enc.Encode(v)
 }
 
-// AddFormatFlag registers the --format / -o flag on a command.
+// AddFormatFlag registers the --format / -o and --json flags on a command.
 func AddFormatFlag(cmd *cobra.Command) {
-	cmd.Flags().StringP("format", "o", "table", `output format: "table" or "json"`)
+	cmd.Flags().StringP("format", "o", "table", `output format: "table", "json", or a Go template (e.g. '{{.ID}}')`)
+	cmd.Flags().Bool("json", false, `shorthand for --format json`)
 }
 
-// OutputFormatted checks --format flag: "json" → JSON, otherwise calls tableFn.
-func OutputFormatted(cmd *cobra.Command, data any, tableFn func(w *tabwriter.Writer)) error {
+// AddInspectFormatFlag registers the --format / -f flag on an inspect command.
+func AddInspectFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("format", "f", "", `"json" or a Go template applied to the result (e.g. '{{.Config.Name}} {{.State}}'); default is JSON`)
+}
+
+// OutputInspect prints an inspect result as indented JSON, or through the
+// --format Go template when one is given.
+func OutputInspect(cmd *cobra.Command, data any) error {
+	if format, _ := cmd.Flags().GetString("format"); format != "" && format != "json" {
+		return OutputTemplate(format, data)
+	}
+	return OutputJSON(data)
+}
+
+// OutputFormat returns the effective --format value.
+func OutputFormat(cmd *cobra.Command) string {
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return "json"
+	}
 	format, _ := cmd.Flags().GetString("format")
-	if format == "json" {
+	return format
+}
+
+// IsTableFormat reports whether output goes to the human-readable table,
+// where informational messages such as "No VMs found." belong.
+func IsTableFormat(cmd *cobra.Command) bool {
+	return OutputFormat(cmd) == "table"
+}
+
+// OutputFormatted checks --format: "json" → JSON, a Go template → the
+// template applied per element (or once for a non-slice), otherwise tableFn.
+func OutputFormatted(cmd *cobra.Command, data any, tableFn func(w *tabwriter.Writer)) error {
+	switch format := OutputFormat(cmd); {
+	case format == "json":
 		return OutputJSON(data)
+	case strings.Contains(format, "{{"):
+		return OutputTemplate(format, data)
+	case format != "table":
+		return fmt.Errorf("--format %q is invalid: must be table, json, or a Go template", format)
 	}
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 	tableFn(w)
 	return w.Flush()
 }
 
-func FormatSize(bytes int64) string {
-	return units.HumanSize(float64(bytes))
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
 }
 
-func IsURL(ref string) bool {
-	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+// OutputTemplate renders data with a Go text/template, one line per element
+// when data is a slice.
+func OutputTemplate(format string, data any) error {
+	w := bufio.NewWriter(os.Stdout)
+	if err := renderTemplate(w, format, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func renderTemplate(w io.Writer, format string, data any) error {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return fmt.Errorf("parse --format template: %w", err)
+	}
+	items := []any{data}
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice {
+		items = make([]any, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).Interface()
+		}
+	}
+	for _, item := range items {
+		if err := tmpl.Execute(w, item); err != nil {
+			return fmt.Errorf("execute --format template: %w", err)
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func FormatSize(bytes int64) string {
+	return units.HumanSize(float64(bytes))
 }
 
 // sanitizeVMName derives a safe VM name from an image reference using
@@ -1,8 +1,17 @@
 package core
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
 )
 
 func TestSanitizeVMName(t *testing.T) {
@@ -39,3 +48,232 @@ func TestSanitizeVMName_Truncation(t *testing.T) {
 		t.Errorf("name too long (%d chars): %q", len(got), got)
 	}
 }
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{"KILL", syscall.SIGKILL, false},
+		{"sigkill", syscall.SIGKILL, false},
+		{"9", syscall.SIGKILL, false},
+		{"TERM", syscall.SIGTERM, false},
+		{"SIGTERM", syscall.SIGTERM, false},
+		{"15", syscall.SIGTERM, false},
+		{"HUP", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSignal(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseSignal(%q) = %v, %v; want %v, err=%v", tt.input, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitConditionMet(t *testing.T) {
+	alive, dead := os.Getpid(), 0
+	withIP := []*types.NetworkConfig{{Network: &types.Network{IP: "10.0.0.2"}}}
+	hc := &types.HealthCheck{Type: types.HealthCheckTCP, Port: 22}
+	healthy := &types.Health{Status: types.HealthHealthy}
+
+	tests := []struct {
+		name    string
+		vm      types.VM
+		cond    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "running", vm: types.VM{State: types.VMStateRunning, PID: alive}, cond: WaitRunning, want: true},
+		{name: "running but stale", vm: types.VM{State: types.VMStateRunning, PID: dead}, cond: WaitRunning},
+		{name: "stopped", vm: types.VM{State: types.VMStateStopped}, cond: WaitStopped, want: true},
+		{name: "stale counts as stopped", vm: types.VM{State: types.VMStateRunning, PID: dead}, cond: WaitStopped, want: true},
+		{name: "creating not stopped", vm: types.VM{State: types.VMStateCreating}, cond: WaitStopped},
+		{name: "ip", vm: types.VM{State: types.VMStateRunning, PID: alive, NetworkConfigs: withIP}, cond: WaitIP, want: true},
+		{name: "ip without network", vm: types.VM{State: types.VMStateRunning, PID: alive}, cond: WaitIP},
+		{
+			name: "healthy",
+			vm:   types.VM{State: types.VMStateRunning, PID: alive, Config: types.VMConfig{HealthCheck: hc}, Health: healthy},
+			cond: WaitHealthy, want: true,
+		},
+		{name: "not probed yet", vm: types.VM{State: types.VMStateRunning, PID: alive, Config: types.VMConfig{HealthCheck: hc}}, cond: WaitHealthy},
+		{name: "no health check", vm: types.VM{State: types.VMStateRunning, PID: alive}, cond: WaitHealthy, wantErr: true},
+		{name: "error state", vm: types.VM{State: types.VMStateError}, cond: WaitRunning, wantErr: true},
+		{name: "bad condition", vm: types.VM{State: types.VMStateStopped}, cond: "paused", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WaitConditionMet(&tt.vm, tt.cond)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("WaitConditionMet = %v, %v; want %v, err=%v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVMFilter(t *testing.T) {
+	vm := &types.VM{
+		State:  types.VMStateRunning,
+		PID:    os.Getpid(),
+		Config: types.VMConfig{Image: "ubuntu:24.04", Labels: map[string]string{"env": "prod", "canary": ""}},
+	}
+	stale := &types.VM{State: types.VMStateRunning, PID: 0}
+
+	tests := []struct {
+		name    string
+		specs   []string
+		vm      *types.VM
+		want    bool
+		wantErr bool
+	}{
+		{name: "no filter", vm: vm, want: true},
+		{name: "label value", specs: []string{"label=env=prod"}, vm: vm, want: true},
+		{name: "label value mismatch", specs: []string{"label=env=dev"}, vm: vm},
+		{name: "label present", specs: []string{"label=canary"}, vm: vm, want: true},
+		{name: "label missing", specs: []string{"label=team"}, vm: vm},
+		{name: "state and image", specs: []string{"state=running", "image=ubuntu:24.04"}, vm: vm, want: true},
+		{name: "image mismatch", specs: []string{"image=debian"}, vm: vm},
+		{name: "stale is stopped", specs: []string{"state=stopped"}, vm: stale, want: true},
+		{name: "stale is not running", specs: []string{"state=running"}, vm: stale},
+		{name: "unknown key", specs: []string{"host=x"}, wantErr: true},
+		{name: "missing value", specs: []string{"state="}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ParseVMFilter(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := f.Match(tt.vm); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	vms := []*types.VM{
+		{ID: "a1", Config: types.VMConfig{Name: "web", Labels: map[string]string{"env": "prod"}}},
+		{ID: "b2", Config: types.VMConfig{Name: "db"}},
+	}
+	tests := []struct {
+		name    string
+		format  string
+		data    any
+		want    string
+		wantErr bool
+	}{
+		{"slice", "{{.ID}} {{.Config.Name}}", vms, "a1 web\nb2 db\n", false},
+		{"single", "{{.Config.Name}}", vms[0], "web\n", false},
+		{"json func", "{{json .Config.Labels}}", vms[:1], `{"env":"prod"}` + "\n", false},
+		{"upper", "{{upper .Config.Name}}", vms[1:], "DB\n", false},
+		{"empty slice", "{{.ID}}", []*types.VM{}, "", false},
+		{"parse error", "{{.ID", vms, "", true},
+		{"missing field", "{{.Nope}}", vms, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			err := renderTemplate(&buf, tt.format, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderTemplate(%q) err = %v, wantErr %v", tt.format, err, tt.wantErr)
+			}
+			if !tt.wantErr && buf.String() != tt.want {
+				t.Errorf("renderTemplate(%q) = %q, want %q", tt.format, buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNICCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		rootless bool
+		provider string
+		passt    string
+		want     int
+		wantErr  bool
+	}{
+		{name: "default", want: 1},
+		{name: "nics", args: []string{"--nics", "3"}, want: 3},
+		{name: "one network", args: []string{"--network", "a", "--nics", "2"}, want: 2},
+		{name: "repeated network", args: []string{"--network", "a", "--network", "b"}, want: 2},
+		{name: "matching nics", args: []string{"--network", "a", "--network", "b", "--nics", "2"}, want: 2},
+		{name: "mismatched nics", args: []string{"--network", "a", "--network", "b", "--nics", "3"}, wantErr: true},
+		{name: "rootless default", rootless: true, want: 0},
+		{name: "rootless usermode", rootless: true, provider: config.NetworkProviderUsermode, passt: "sh", want: 1},
+		{name: "rootless usermode without passt", rootless: true, provider: config.NetworkProviderUsermode, passt: "/nonexistent/passt", want: 0},
+		{name: "rootless usermode without passt, explicit nics", args: []string{"--nics", "1"}, rootless: true, provider: config.NetworkProviderUsermode, passt: "/nonexistent/passt", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.SetContext(context.Background())
+			cmd.Flags().Int("nics", 1, "")
+			cmd.Flags().StringArray("network", nil, "")
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			networks, _ := cmd.Flags().GetStringArray("network")
+			vmCfg := &types.VMConfig{}
+			if len(networks) > 1 {
+				vmCfg.Networks = networks
+			}
+			got, err := NICCount(cmd, &config.Config{Rootless: tt.rootless, NetworkProvider: tt.provider, PasstBinary: tt.passt}, vmCfg)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("NICCount() = %d, %v; want %d, err=%v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvisionFromFlags(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "app.conf")
+	if err := os.WriteFile(local, []byte("x=1\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "copy and run", args: []string{"--copy-in", local + ":/etc/app.conf", "--run-cmd", "systemctl restart app"}},
+		{name: "relative guest path", args: []string{"--copy-in", local + ":etc/app.conf"}, wantErr: true},
+		{name: "line break in guest path", args: []string{"--copy-in", local + ":/etc/app\n1 0644 /etc/shadow"}, wantErr: true},
+		{name: "missing local", args: []string{"--copy-in", local + ".missing:/etc/app.conf"}, wantErr: true},
+		{name: "directory", args: []string{"--copy-in", filepath.Dir(local) + ":/etc/app"}, wantErr: true},
+		{name: "multi-line command", args: []string{"--run-cmd", "a\nb"}, wantErr: true},
+		{name: "empty command", args: []string{"--run-cmd", " "}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().StringArray("copy-in", nil, "")
+			cmd.Flags().StringArray("run-cmd", nil, "")
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			files, runCmds, err := provisionFromFlags(cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("provisionFromFlags() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name != "copy and run" {
+				return
+			}
+			if len(files) != 1 || files[0].Path != "/etc/app.conf" || files[0].Mode != 0o640 || string(files[0].Content) != "x=1\n" {
+				t.Errorf("files = %+v", files)
+			}
+			if len(runCmds) != 1 || runCmds[0] != "systemctl restart app" {
+				t.Errorf("runCmds = %v", runCmds)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package disk
+
+import (
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+)
+
+// Actions defines VM disk operations.
+type Actions interface {
+	Resize(cmd *cobra.Command, args []string) error
+	Compact(cmd *cobra.Command, args []string) error
+	Snapshot(cmd *cobra.Command, args []string) error
+	Snapshots(cmd *cobra.Command, args []string) error
+	Revert(cmd *cobra.Command, args []string) error
+	RMSnapshot(cmd *cobra.Command, args []string) error
+	Serve(cmd *cobra.Command, args []string) error
+}
+
+// Command builds the "disk" parent command with all subcommands.
+func Command(h Actions) *cobra.Command {
+	diskCmd := &cobra.Command{
+		Use:   "disk",
+		Short: "Manage VM root disks",
+	}
+
+	resizeCmd := &cobra.Command{
+		Use:   "resize VM SIZE",
+		Short: "Grow a stopped VM's root disk, e.g. to 40G",
+		Args:  cobra.ExactArgs(2), //nolint:mnd
+		RunE:  h.Resize,
+	}
+
+	compactCmd := &cobra.Command{
+		Use:   "compact VM [VM...]",
+		Short: "Return the space stopped VMs' root disks no longer use to the host",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.Compact,
+	}
+
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot VM NAME",
+		Short: "Save a stopped VM's root disk as a named save point",
+		Args:  cobra.ExactArgs(2), //nolint:mnd
+		RunE:  h.Snapshot,
+	}
+
+	snapshotsCmd := &cobra.Command{
+		Use:   "snapshots VM",
+		Short: "List a VM's disk snapshots",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Snapshots,
+	}
+	cmdcore.AddFormatFlag(snapshotsCmd)
+
+	revertCmd := &cobra.Command{
+		Use:   "revert VM NAME",
+		Short: "Roll a stopped VM's root disk back to a disk snapshot",
+		Args:  cobra.ExactArgs(2), //nolint:mnd
+		RunE:  h.Revert,
+	}
+
+	rmSnapshotCmd := &cobra.Command{
+		Use:   "rm-snapshot VM NAME [NAME...]",
+		Short: "Delete disk snapshot(s) of a stopped VM",
+		Args:  cobra.MinimumNArgs(2), //nolint:mnd
+		RunE:  h.RMSnapshot,
+	}
+
+	serveCmd := &cobra.Command{
+		Use:   "serve VM",
+		Short: "Export a stopped VM's root disk over NBD until interrupted",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Serve,
+	}
+	serveCmd.Flags().String("listen", "", "serve on TCP host:port instead of a unix socket (loopback only without --tls-creds)")
+	serveCmd.Flags().Bool("writable", false, "accept client writes (default: read-only)")
+	serveCmd.Flags().String("tls-creds", "", "directory of x509 server credentials (ca-cert.pem, server-cert.pem, server-key.pem) for TCP exports")
+
+	diskCmd.AddCommand(resizeCmd, compactCmd, snapshotCmd, snapshotsCmd, revertCmd, rmSnapshotCmd, serveCmd)
+	return diskCmd
+}
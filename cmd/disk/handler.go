@@ -0,0 +1,193 @@
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Handler implements Actions.
+type Handler struct {
+	cmdcore.BaseHandler
+}
+
+func (h Handler) Resize(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	size, err := units.RAMInBytes(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid size %q: %w", args[1], err)
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	resizer, ok := hyper.(hypervisor.DiskResizer)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot resize disks", hyper.Type())
+	}
+
+	vm, err := resizer.ResizeDisk(ctx, args[0], size)
+	if err != nil {
+		return fmt.Errorf("resize: %w", err)
+	}
+	log.WithFunc("cmd.disk.resize").Infof(ctx, "VM %s root disk grown to %s (applied on next start)",
+		vm.ID, cmdcore.FormatSize(vm.Config.Storage))
+	return nil
+}
+
+func (h Handler) Compact(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	compactor, ok := hyper.(hypervisor.DiskCompactor)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot compact disks", hyper.Type())
+	}
+
+	logger := log.WithFunc("cmd.disk.compact")
+	var errs []error
+	for _, ref := range args {
+		freed, compactErr := compactor.CompactDisk(ctx, ref)
+		if compactErr != nil {
+			errs = append(errs, fmt.Errorf("compact %s: %w", ref, compactErr))
+			continue
+		}
+		logger.Infof(ctx, "VM %s root disk compacted, %s freed", ref, cmdcore.FormatSize(freed))
+	}
+	return errors.Join(errs...)
+}
+
+func (h Handler) Snapshot(cmd *cobra.Command, args []string) error {
+	ctx, snapshotter, err := h.initSnapshotter(cmd)
+	if err != nil {
+		return err
+	}
+	vm, err := snapshotter.SnapshotDisk(ctx, args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	log.WithFunc("cmd.disk.snapshot").Infof(ctx, "VM %s disk saved as %s", vm.ID, args[1])
+	return nil
+}
+
+func (h Handler) Snapshots(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("inspect VM: %w", err)
+	}
+	snaps := vm.DiskSnapshots
+	if len(snaps) == 0 {
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No disk snapshots found.")
+			return nil
+		}
+		snaps = []types.DiskSnapshot{}
+	}
+	return cmdcore.OutputFormatted(cmd, snaps, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tSTORAGE\tCREATED") //nolint:errcheck
+		for _, s := range snaps {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", //nolint:errcheck
+				s.Name, cmdcore.FormatSize(s.Storage), s.CreatedAt.Local().Format(time.DateTime))
+		}
+	})
+}
+
+func (h Handler) Revert(cmd *cobra.Command, args []string) error {
+	ctx, snapshotter, err := h.initSnapshotter(cmd)
+	if err != nil {
+		return err
+	}
+	vm, err := snapshotter.RevertDisk(ctx, args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("revert: %w", err)
+	}
+	log.WithFunc("cmd.disk.revert").Infof(ctx, "VM %s disk reverted to %s (storage=%s)",
+		vm.ID, args[1], cmdcore.FormatSize(vm.Config.Storage))
+	return nil
+}
+
+func (h Handler) RMSnapshot(cmd *cobra.Command, args []string) error {
+	ctx, snapshotter, err := h.initSnapshotter(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.disk.rm-snapshot")
+	for _, name := range args[1:] {
+		if _, err := snapshotter.DeleteDiskSnapshot(ctx, args[0], name); err != nil {
+			return fmt.Errorf("delete %s: %w", name, err)
+		}
+		logger.Infof(ctx, "deleted disk snapshot %s", name)
+	}
+	return nil
+}
+
+func (h Handler) Serve(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	server, ok := hyper.(hypervisor.DiskServer)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot serve disks", hyper.Type())
+	}
+	listen, _ := cmd.Flags().GetString("listen")
+	writable, _ := cmd.Flags().GetBool("writable")
+	tlsCreds, _ := cmd.Flags().GetString("tls-creds")
+
+	logger := log.WithFunc("cmd.disk.serve")
+	if err := server.ServeDisk(ctx, args[0], hypervisor.DiskServeOptions{Listen: listen, Writable: writable, TLSCreds: tlsCreds}, func(uri string) {
+		logger.Infof(ctx, "serving VM %s root disk at %s (Ctrl-C to stop)", args[0], uri)
+		logger.Infof(ctx, "inspect with: guestfish --format=raw -a %s -i", uri)
+	}); err != nil {
+		return fmt.Errorf("serve: %w", err)
+	}
+	logger.Infof(ctx, "stopped serving VM %s root disk", args[0])
+	return nil
+}
+
+func (h Handler) initSnapshotter(cmd *cobra.Command) (context.Context, hypervisor.DiskSnapshotter, error) {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshotter, ok := hyper.(hypervisor.DiskSnapshotter)
+	if !ok {
+		return nil, nil, fmt.Errorf("the %s backend cannot snapshot disks", hyper.Type())
+	}
+	return ctx, snapshotter, nil
+}
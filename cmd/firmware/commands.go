@@ -0,0 +1,65 @@
+package firmware
+
+import (
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/firmware"
+)
+
+// Actions defines firmware store operations.
+type Actions interface {
+	List(cmd *cobra.Command, args []string) error
+	Install(cmd *cobra.Command, args []string) error
+	Import(cmd *cobra.Command, args []string) error
+	RM(cmd *cobra.Command, args []string) error
+}
+
+// Command builds the "firmware" parent command with all subcommands.
+func Command(h Actions) *cobra.Command {
+	firmwareCmd := &cobra.Command{
+		Use:   "firmware",
+		Short: "Manage UEFI firmware builds for cloud images",
+	}
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List firmware builds in the store",
+		Args:    cobra.NoArgs,
+		RunE:    h.List,
+	}
+	cmdcore.AddFormatFlag(listCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import NAME FILE",
+		Short: "Add a firmware file to the store (usable as vm create --firmware NAME)",
+		Args:  cobra.ExactArgs(2), //nolint:mnd
+		RunE:  h.Import,
+	}
+	importCmd.Flags().String("arch", "", "architecture the firmware is built for (default: host)")
+
+	rmCmd := &cobra.Command{
+		Use:   "rm NAME [NAME...]",
+		Short: "Remove firmware build(s) from the store",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.RM,
+	}
+	rmCmd.Flags().String("arch", "", "architecture of the build to remove (default: host)")
+
+	installCmd := &cobra.Command{
+		Use:   "install",
+		Short: "Download firmware (and optionally guest kernel/initramfs) for the host architecture",
+		Args:  cobra.NoArgs,
+		RunE:  h.Install,
+	}
+	installCmd.Flags().String("name", firmware.DefaultName, "store name for the firmware")
+	installCmd.Flags().String("version", firmware.DefaultVersion, "rust-hypervisor-firmware release to install")
+	installCmd.Flags().String("url", "", "download the firmware from this URL instead of the release")
+	installCmd.Flags().String("sha256", "", "expected SHA-256 of the firmware ; the install fails on mismatch")
+	installCmd.Flags().String("assets", "", "base URL with vmlinuz, initrd.img and a SHA256SUMS file to install alongside")
+	_ = installCmd.MarkFlagRequired("sha256")
+
+	firmwareCmd.AddCommand(listCmd, installCmd, importCmd, rmCmd)
+	return firmwareCmd
+}
@@ -0,0 +1,92 @@
+package firmware
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/firmware"
+)
+
+type Handler struct {
+	cmdcore.BaseHandler
+}
+
+func (h Handler) List(cmd *cobra.Command, _ []string) error {
+	_, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	entries, err := firmware.List(conf)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No firmware found.")
+			return nil
+		}
+		entries = []firmware.Entry{}
+	}
+	return cmdcore.OutputFormatted(cmd, entries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tARCH\tSIZE\tPATH") //nolint:errcheck
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Name, e.Arch, cmdcore.FormatSize(e.Size), e.Path) //nolint:errcheck
+		}
+	})
+}
+
+func (h Handler) Install(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	var opts firmware.InstallOptions
+	opts.Name, _ = cmd.Flags().GetString("name")
+	opts.Version, _ = cmd.Flags().GetString("version")
+	opts.URL, _ = cmd.Flags().GetString("url")
+	opts.SHA256, _ = cmd.Flags().GetString("sha256")
+	opts.AssetsURL, _ = cmd.Flags().GetString("assets")
+	installed, err := firmware.Install(ctx, conf, opts)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.firmware.install")
+	for _, f := range installed {
+		logger.Infof(ctx, "installed %s (sha256:%s)", f.Path, f.SHA256)
+	}
+	return nil
+}
+
+func (h Handler) Import(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	arch, _ := cmd.Flags().GetString("arch")
+	path, err := firmware.Import(conf, args[0], arch, args[1])
+	if err != nil {
+		return err
+	}
+	log.WithFunc("cmd.firmware.import").Infof(ctx, "imported %s -> %s", args[0], path)
+	return nil
+}
+
+func (h Handler) RM(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	arch, _ := cmd.Flags().GetString("arch")
+	logger := log.WithFunc("cmd.firmware.rm")
+	for _, name := range args {
+		if err := firmware.Remove(conf, name, arch); err != nil {
+			return err
+		}
+		logger.Infof(ctx, "deleted: %s", name)
+	}
+	return nil
+}
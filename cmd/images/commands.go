@@ -45,6 +45,14 @@ Mixing tar and qcow2 files is not allowed.`,
 	importCmd.Flags().StringArray("file", nil, "file(s) to import (required, repeatable)")
 	_ = importCmd.MarkFlagRequired("file")
 
+	inspectCmd := &cobra.Command{
+		Use:   "inspect IMAGE",
+		Short: "Show detailed image info (JSON)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Inspect,
+	}
+	cmdcore.AddInspectFormatFlag(inspectCmd)
+
 	imageCmd.AddCommand(
 		&cobra.Command{
 			Use:   "pull IMAGE [IMAGE...]",
@@ -60,12 +68,7 @@ Mixing tar and qcow2 files is not allowed.`,
 			Args:  cobra.MinimumNArgs(1),
 			RunE:  h.RM,
 		},
-		&cobra.Command{
-			Use:   "inspect IMAGE",
-			Short: "Show detailed image info (JSON)",
-			Args:  cobra.ExactArgs(1),
-			RunE:  h.Inspect,
-		},
+		inspectCmd,
 	)
 	return imageCmd
 }
@@ -16,6 +16,7 @@ import (
 	"github.com/projecteru2/cocoon/progress"
 	cloudimgProgress "github.com/projecteru2/cocoon/progress/cloudimg"
 	ociProgress "github.com/projecteru2/cocoon/progress/oci"
+	"github.com/projecteru2/cocoon/service"
 	"github.com/projecteru2/cocoon/types"
 )
 
@@ -31,13 +32,13 @@ func (h Handler) Pull(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	ociStore, cloudimgStore, err := cmdcore.InitImageBackendsForPull(ctx, conf)
+	ociStore, cloudimgStore, err := service.InitImageBackendsForPull(ctx, conf)
 	if err != nil {
 		return err
 	}
 
 	for _, image := range args {
-		if cmdcore.IsURL(image) {
+		if service.IsURL(image) {
 			if err := h.pullCloudimg(ctx, cloudimgStore, image); err != nil {
 				return err
 			}
@@ -125,7 +126,7 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
-	backends, err := cmdcore.InitImageBackends(ctx, conf)
+	backends, err := service.InitImageBackends(ctx, conf)
 	if err != nil {
 		return err
 	}
@@ -139,8 +140,11 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 		all = append(all, imgs...)
 	}
 	if len(all) == 0 {
-		fmt.Println("No images found.")
-		return nil
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No images found.")
+			return nil
+		}
+		all = []*types.Image{}
 	}
 
 	return cmdcore.OutputFormatted(cmd, all, func(w *tabwriter.Writer) {
@@ -164,7 +168,7 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	logger := log.WithFunc("cmd.image.rm")
-	backends, err := cmdcore.InitImageBackends(ctx, conf)
+	backends, err := service.InitImageBackends(ctx, conf)
 	if err != nil {
 		return err
 	}
@@ -191,7 +195,7 @@ func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	backends, err := cmdcore.InitImageBackends(ctx, conf)
+	backends, err := service.InitImageBackends(ctx, conf)
 	if err != nil {
 		return err
 	}
@@ -205,7 +209,7 @@ func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
 		if img == nil {
 			continue
 		}
-		return cmdcore.OutputJSON(img)
+		return cmdcore.OutputInspect(cmd, img)
 	}
 	return fmt.Errorf("image %q not found", ref)
 }
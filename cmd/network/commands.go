@@ -0,0 +1,65 @@
+package network
+
+import (
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Actions defines named network operations.
+type Actions interface {
+	Create(cmd *cobra.Command, args []string) error
+	List(cmd *cobra.Command, args []string) error
+	Inspect(cmd *cobra.Command, args []string) error
+	RM(cmd *cobra.Command, args []string) error
+}
+
+// Command builds the "network" parent command with all subcommands.
+func Command(h Actions) *cobra.Command {
+	networkCmd := &cobra.Command{
+		Use:   "network",
+		Short: "Manage named networks VMs attach to with --network",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create a bridge network with its own subnet, or a macvtap network on a host NIC (usable as vm create --network NAME)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Create,
+	}
+	createCmd.Flags().String("driver", types.NetworkDriverBridge, `"bridge" (CNI bridge with its own subnet) or "macvtap" (VMs directly on --parent's L2, addressed by DHCP)`)
+	createCmd.Flags().String("parent", "", "host interface macvtap NICs are created on (--driver macvtap)")
+	createCmd.Flags().String("subnet", "", "IPv4 subnet in CIDR form (empty = next free /24 of 10.89.0.0/16)")
+	createCmd.Flags().String("gateway", "", "gateway address on the bridge (empty = first address of the subnet)")
+	createCmd.Flags().String("bridge", "", "host bridge name, at most 15 chars (empty = cc-<name>)")
+	createCmd.Flags().Bool("isolated", false, "let VMs on the network reach the gateway but not each other")
+	createCmd.Flags().String("ip-range", "", `addresses handed to VMs, "start-end" within the subnet (empty = whole subnet)`)
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List networks, created and found in the CNI conf dir",
+		Args:    cobra.NoArgs,
+		RunE:    h.List,
+	}
+	cmdcore.AddFormatFlag(listCmd)
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect VM",
+		Short: "Show each NIC of a VM: network, netns, tap/veth or other device, MAC, IP and gateway",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Inspect,
+	}
+	cmdcore.AddFormatFlag(inspectCmd)
+
+	rmCmd := &cobra.Command{
+		Use:   "rm NAME [NAME...]",
+		Short: "Remove network(s) no VM is attached to",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.RM,
+	}
+
+	networkCmd.AddCommand(createCmd, listCmd, inspectCmd, rmCmd)
+	return networkCmd
+}
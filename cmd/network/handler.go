@@ -0,0 +1,199 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+type Handler struct {
+	cmdcore.BaseHandler
+}
+
+func (h Handler) Create(cmd *cobra.Command, args []string) error {
+	ctx, mgr, err := h.initManager(cmd)
+	if err != nil {
+		return err
+	}
+	spec := &types.NetworkSpec{Name: args[0]}
+	spec.Driver, _ = cmd.Flags().GetString("driver")
+	spec.Parent, _ = cmd.Flags().GetString("parent")
+	spec.Subnet, _ = cmd.Flags().GetString("subnet")
+	spec.Gateway, _ = cmd.Flags().GetString("gateway")
+	spec.Bridge, _ = cmd.Flags().GetString("bridge")
+	spec.Isolated, _ = cmd.Flags().GetBool("isolated")
+	if ipRange, _ := cmd.Flags().GetString("ip-range"); ipRange != "" {
+		var ok bool
+		if spec.RangeStart, spec.RangeEnd, ok = strings.Cut(ipRange, "-"); !ok {
+			return fmt.Errorf("--ip-range %q is invalid: want start-end", ipRange)
+		}
+	}
+	created, err := mgr.CreateNetwork(ctx, spec)
+	if err != nil {
+		return fmt.Errorf("create network: %w", err)
+	}
+	logger := log.WithFunc("cmd.network.create")
+	if created.IsMacvtap() {
+		logger.Infof(ctx, "network created: %s (macvtap on %s)", created.Name, created.Parent)
+		return nil
+	}
+	logger.Infof(ctx, "network created: %s (subnet %s, gateway %s, bridge %s)",
+		created.Name, created.Subnet, created.Gateway, created.Bridge)
+	return nil
+}
+
+func (h Handler) List(cmd *cobra.Command, _ []string) error {
+	ctx, mgr, err := h.initManager(cmd)
+	if err != nil {
+		return err
+	}
+	specs, err := mgr.ListNetworks(ctx)
+	if err != nil {
+		return fmt.Errorf("list networks: %w", err)
+	}
+	if len(specs) == 0 {
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No networks found.")
+			return nil
+		}
+		specs = []*types.NetworkSpec{}
+	}
+	return cmdcore.OutputFormatted(cmd, specs, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tSOURCE\tDRIVER\tSUBNET\tGATEWAY\tDEVICE\tNICS\tCREATED") //nolint:errcheck
+		for _, s := range specs {
+			source, driver, device, created := "cni-conf-dir", "-", s.Bridge, "-"
+			if s.Managed {
+				source, driver = "cocoon", types.NetworkDriverBridge
+			}
+			if s.IsMacvtap() {
+				driver, device = s.Driver, s.Parent
+			}
+			if s.Isolated {
+				driver += " (isolated)"
+			}
+			if s.CreatedAt != nil {
+				created = s.CreatedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n", //nolint:errcheck
+				s.Name, source, driver, dash(s.Subnet), dash(s.Gateway), dash(device), s.NICs, created)
+		}
+	})
+}
+
+func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+	nics := network.DescribeNICs(vm)
+	p, err := service.InitNetwork(conf)
+	if err != nil {
+		return err
+	}
+	if ni, ok := p.(network.NICInspector); ok {
+		if nics, err = ni.InspectNICs(ctx, vm); err != nil {
+			return fmt.Errorf("inspect NICs of %s: %w", vm.ID, err)
+		}
+	}
+	if len(nics) == 0 && cmdcore.IsTableFormat(cmd) {
+		fmt.Printf("VM %s has no NICs.\n", vm.Config.Name)
+		return nil
+	}
+	return cmdcore.OutputFormatted(cmd, nics, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NIC\tNETWORK\tKIND\tDEVICE\tMAC\tIP\tGATEWAY\tLIMIT\tPORTS\tNETNS") //nolint:errcheck
+		for _, n := range nics {
+			ip, limit := "", "-"
+			if n.IP != "" {
+				ip = n.IP
+				if n.Prefix > 0 {
+					ip = fmt.Sprintf("%s/%d", n.IP, n.Prefix)
+				}
+			}
+			if n.RateLimit > 0 {
+				limit = types.FormatBandwidth(n.RateLimit)
+			}
+			ports := make([]string, len(n.Ports))
+			for i, m := range n.Ports {
+				ports[i] = m.String()
+			}
+			fmt.Fprintf(w, "eth%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				n.Index, dash(n.Network), n.Kind, dash(nicDevice(n)), n.Mac, dash(ip), dash(n.Gateway),
+				limit, dash(strings.Join(ports, ",")), dash(n.NetnsPath))
+		}
+	})
+}
+
+func (h Handler) RM(cmd *cobra.Command, args []string) error {
+	ctx, mgr, err := h.initManager(cmd)
+	if err != nil {
+		return err
+	}
+	removed, err := mgr.RemoveNetworks(ctx, args)
+	logger := log.WithFunc("cmd.network.rm")
+	for _, name := range removed {
+		logger.Infof(ctx, "deleted: %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("remove network: %w", err)
+	}
+	return nil
+}
+
+func (h Handler) initManager(cmd *cobra.Command) (context.Context, network.Manager, error) {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := service.InitNetwork(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	mgr, ok := p.(network.Manager)
+	if !ok {
+		return nil, nil, fmt.Errorf("network provider %s does not manage named networks", p.Type())
+	}
+	return ctx, mgr, nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// nicDevice names the host device backing a NIC: "tap0<->eth0" for a tap
+// wired to its CNI veth, else the macvtap link, VF or passt socket.
+func nicDevice(n *types.NICInfo) string {
+	switch n.Kind {
+	case types.NICKindMacvtap:
+		return n.Macvtap
+	case types.NICKindSRIOV:
+		return filepath.Base(n.VFIODevice)
+	case types.NICKindUsermode:
+		return n.UserSocket
+	}
+	if n.Veth != "" {
+		return n.Tap + "<->" + n.Veth
+	}
+	return n.Tap
+}
@@ -3,24 +3,83 @@ package others
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
 )
 
 // Actions defines cross-cutting system operations.
 type Actions interface {
 	GC(cmd *cobra.Command, args []string) error
+	Daemon(cmd *cobra.Command, args []string) error
+	Reconcile(cmd *cobra.Command, args []string) error
 	Version(cmd *cobra.Command, args []string) error
+	Top(cmd *cobra.Command, args []string) error
+	Events(cmd *cobra.Command, args []string) error
+	DF(cmd *cobra.Command, args []string) error
 }
 
-// Commands builds system command set (gc, version, completion).
+// Commands builds system command set (gc, daemon, reconcile, top, events, system, version, completion).
 func Commands(h Actions) []*cobra.Command {
+	topCmd := &cobra.Command{
+		Use:   "top",
+		Short: "Live resource usage of all running VMs",
+		Args:  cobra.NoArgs,
+		RunE:  h.Top,
+	}
+	topCmd.Flags().String("sort", "cpu", `sort order: "cpu" or "mem"`)
+	topCmd.Flags().Duration("interval", 2*time.Second, "refresh interval") //nolint:mnd
+
+	eventsCmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show the host's VM and image lifecycle event journal",
+		Args:  cobra.NoArgs,
+		RunE:  h.Events,
+	}
+	eventsCmd.Flags().BoolP("follow", "f", false, "keep printing new events until interrupted")
+	eventsCmd.Flags().StringArray("filter", nil, `filter events: "vm=<id|name>" or "type=<event>" (repeatable)`)
+	eventsCmd.Flags().Duration("since", 0, "only show events within this duration (e.g. 1h)")
+	cmdcore.AddFormatFlag(eventsCmd)
+
+	reconcileCmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Fix VM records that disagree with live VMM processes and remove leftover runtime files",
+		Args:  cobra.NoArgs,
+		RunE:  h.Reconcile,
+	}
+	cmdcore.AddFormatFlag(reconcileCmd)
+
+	systemCmd := &cobra.Command{
+		Use:   "system",
+		Short: "Host-wide storage information",
+	}
+	dfCmd := &cobra.Command{
+		Use:   "df",
+		Short: "Show disk usage by type, what GC would reclaim, and storage pool capacity",
+		Args:  cobra.NoArgs,
+		RunE:  h.DF,
+	}
+	cmdcore.AddFormatFlag(dfCmd)
+	systemCmd.AddCommand(dfCmd)
+
 	return []*cobra.Command{
 		{
 			Use:   "gc",
 			Short: "Remove unreferenced blobs, boot files, and VM dirs",
 			RunE:  h.GC,
 		},
+		{
+			Use:   "daemon",
+			Short: "Run the background daemon (state reconciliation, restart policies, scheduled GC)",
+			Args:  cobra.NoArgs,
+			RunE:  h.Daemon,
+		},
+		reconcileCmd,
+		topCmd,
+		eventsCmd,
+		systemCmd,
 		{
 			Use:   "version",
 			Short: "Show version, git revision, and build timestamp",
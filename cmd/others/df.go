@@ -0,0 +1,88 @@
+package others
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/service"
+)
+
+// dfReport is the "system df" output: space per type of data, then the
+// storage pools.
+type dfReport struct {
+	Types []gc.Usage          `json:"types"`
+	Pools []service.PoolUsage `json:"pools"`
+}
+
+func (h Handler) DF(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	o, err := service.InitGC(ctx, conf)
+	if err != nil {
+		return err
+	}
+	var report dfReport
+	if report.Types, err = o.Usage(ctx); err != nil {
+		if len(report.Types) == 0 {
+			return err
+		}
+		log.WithFunc("cmd.df").Warnf(ctx, "partial usage: %v", err)
+	}
+	if len(conf.StoragePools) > 0 {
+		hyper, err := service.InitHypervisor(conf)
+		if err != nil {
+			return err
+		}
+		vms, err := hyper.List(ctx)
+		if err != nil {
+			return fmt.Errorf("list VMs: %w", err)
+		}
+		if report.Pools, err = service.StoragePoolUsage(conf, vms); err != nil {
+			return err
+		}
+	}
+	return cmdcore.OutputFormatted(cmd, report, func(w *tabwriter.Writer) {
+		var total gc.Usage
+		fmt.Fprintln(w, "TYPE\tCOUNT\tSIZE\tRECLAIMABLE") //nolint:errcheck
+		for _, u := range report.Types {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", u.Type, u.Count, cmdcore.FormatSize(u.Size), reclaimable(u)) //nolint:errcheck
+			total.Count += u.Count
+			total.Size += u.Size
+			total.Reclaimable += u.Reclaimable
+		}
+		fmt.Fprintf(w, "total\t%d\t%s\t%s\n", total.Count, cmdcore.FormatSize(total.Size), reclaimable(total)) //nolint:errcheck
+		if len(report.Pools) == 0 {
+			return
+		}
+
+		fmt.Fprintln(w)                                                         //nolint:errcheck
+		fmt.Fprintln(w, "POOL\tPATH\tCAPACITY\tCOMMITTED\tUSED\tFREE\tDEFAULT") //nolint:errcheck
+		for _, u := range report.Pools {
+			capacity := "-"
+			if u.Capacity > 0 {
+				capacity = cmdcore.FormatSize(u.Capacity)
+			}
+			def := ""
+			if u.Default {
+				def = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				u.Name, u.Path, capacity, cmdcore.FormatSize(u.Committed), cmdcore.FormatSize(u.Used), cmdcore.FormatSize(u.Free()), def)
+		}
+	})
+}
+
+// reclaimable formats what GC would free of u, with its share of u.
+func reclaimable(u gc.Usage) string {
+	if u.Size == 0 {
+		return cmdcore.FormatSize(u.Reclaimable)
+	}
+	return fmt.Sprintf("%s (%d%%)", cmdcore.FormatSize(u.Reclaimable), u.Reclaimable*100/u.Size) //nolint:mnd
+}
@@ -0,0 +1,63 @@
+package others
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func (h Handler) Events(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	specs, _ := cmd.Flags().GetStringArray("filter")
+	filter, err := events.ParseFilter(specs)
+	if err != nil {
+		return err
+	}
+	if since, _ := cmd.Flags().GetDuration("since"); since > 0 {
+		filter.Since = time.Now().Add(-since)
+	}
+	follow, _ := cmd.Flags().GetBool("follow")
+	format := cmdcore.OutputFormat(cmd)
+
+	emit := func(e types.Event) error { return printEvent(e, format) }
+	past, offset, err := events.Read(conf, filter)
+	if err != nil {
+		return fmt.Errorf("read events: %w", err)
+	}
+	for _, e := range past {
+		if err := emit(e); err != nil {
+			return err
+		}
+	}
+	if !follow {
+		return nil
+	}
+	return events.Follow(ctx, conf, offset, filter, emit)
+}
+
+// printEvent writes one event per line, so output can be streamed.
+func printEvent(e types.Event, format string) error {
+	switch {
+	case format == "json":
+		return json.NewEncoder(os.Stdout).Encode(e)
+	case strings.Contains(format, "{{"):
+		return cmdcore.OutputTemplate(format, e)
+	}
+	subject := e.ID
+	if e.Name != "" {
+		subject += " (" + e.Name + ")"
+	}
+	_, err := fmt.Printf("%s  %-12s  %s  %s\n", e.Time.Local().Format(time.DateTime), e.Type, subject, e.Message)
+	return err
+}
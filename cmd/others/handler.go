@@ -7,7 +7,8 @@ import (
 	"github.com/spf13/cobra"
 
 	cmdcore "github.com/projecteru2/cocoon/cmd/core"
-	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/daemon"
+	"github.com/projecteru2/cocoon/service"
 	"github.com/projecteru2/cocoon/version"
 )
 
@@ -20,31 +21,35 @@ func (h Handler) GC(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
-	backends, hyper, err := cmdcore.InitBackends(ctx, conf)
+	o, err := service.InitGC(ctx, conf)
 	if err != nil {
 		return err
 	}
-	netProvider, err := cmdcore.InitNetwork(conf)
+	if err := o.Run(ctx); err != nil {
+		return err
+	}
+	log.WithFunc("cmd.gc").Info(ctx, "GC completed")
+	return nil
+}
+
+func (h Handler) Daemon(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
 	if err != nil {
 		return err
 	}
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return err
 	}
-
-	o := gc.New()
-	for _, b := range backends {
-		b.RegisterGC(o)
+	netProvider, err := service.InitNetwork(conf)
+	if err != nil {
+		return err
 	}
-	hyper.RegisterGC(o)
-	netProvider.RegisterGC(o)
-	snapBackend.RegisterGC(o)
-	if err := o.Run(ctx); err != nil {
+	o, err := service.InitGC(ctx, conf)
+	if err != nil {
 		return err
 	}
-	log.WithFunc("cmd.gc").Info(ctx, "GC completed")
-	return nil
+	return daemon.New(conf, hyper, netProvider, o).Run(ctx)
 }
 
 func (h Handler) Version(_ *cobra.Command, _ []string) error {
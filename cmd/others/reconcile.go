@@ -0,0 +1,48 @@
+package others
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/daemon"
+	"github.com/projecteru2/cocoon/service"
+)
+
+func (h Handler) Reconcile(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	report, reconcileErr := daemon.New(conf, hyper, nil, nil).ReconcileState(ctx)
+
+	if len(report.Stale)+len(report.Adopted)+len(report.Cleaned) == 0 && cmdcore.IsTableFormat(cmd) {
+		fmt.Println("Nothing to reconcile.")
+		return reconcileErr
+	}
+	changes := []struct {
+		action string
+		ids    []string
+	}{
+		{"stale, marked stopped", report.Stale},
+		{"live VMM, marked running", report.Adopted},
+		{"runtime files removed", report.Cleaned},
+	}
+	if err := cmdcore.OutputFormatted(cmd, report, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "VM\tCHANGE") //nolint:errcheck
+		for _, c := range changes {
+			for _, id := range c.ids {
+				fmt.Fprintf(w, "%s\t%s\n", id, c.action) //nolint:errcheck
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	return reconcileErr
+}
@@ -0,0 +1,116 @@
+package others
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func (h Handler) Top(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	sortBy, _ := cmd.Flags().GetString("sort")
+	if sortBy != "cpu" && sortBy != "mem" {
+		return fmt.Errorf("--sort %q is invalid: must be cpu or mem", sortBy)
+	}
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+
+	prev, err := service.CollectStats(ctx, hyper, nil)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		cur, err := service.CollectStats(ctx, hyper, nil)
+		if err != nil {
+			return err
+		}
+		if err := renderTop(cur, prev, sortBy); err != nil {
+			return err
+		}
+		prev = cur
+	}
+}
+
+type topRow struct {
+	*types.VMStats
+	cpu                           float64
+	blockRead, blockWrite, rx, tx float64 // bytes per second
+}
+
+func renderTop(cur, prev map[string]*types.VMStats, sortBy string) error {
+	var (
+		rows     []topRow
+		totalCPU float64
+		totalRSS int64
+	)
+	for _, s := range cur {
+		row := topRow{VMStats: s, cpu: s.CPUPercent(prev[s.ID])}
+		if p := prev[s.ID]; p != nil {
+			wall := s.CollectedAt.Sub(p.CollectedAt)
+			row.blockRead = perSecond(s.BlockReadBytes, p.BlockReadBytes, wall)
+			row.blockWrite = perSecond(s.BlockWriteBytes, p.BlockWriteBytes, wall)
+			row.rx = perSecond(s.NetRxBytes, p.NetRxBytes, wall)
+			row.tx = perSecond(s.NetTxBytes, p.NetTxBytes, wall)
+		}
+		totalCPU += row.cpu
+		totalRSS += s.MemoryRSS
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b topRow) int {
+		if sortBy == "mem" {
+			return cmp.Or(cmp.Compare(b.MemoryRSS, a.MemoryRSS), cmp.Compare(a.Name, b.Name))
+		}
+		return cmp.Or(cmp.Compare(b.cpu, a.cpu), cmp.Compare(a.Name, b.Name))
+	})
+
+	fmt.Print("\033[H\033[2J") // clear screen
+	fmt.Printf("cocoon top - %s  VMs: %d  CPU: %.1f%%  RSS: %s\n\n",
+		time.Now().Format(time.TimeOnly), len(rows), totalCPU, units.BytesSize(float64(totalRSS)))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPID\tCPU%\tMEM RSS\tMEM GUEST\tBLOCK R/s\tBLOCK W/s\tNET RX/s\tNET TX/s") //nolint:errcheck
+	for _, r := range rows {
+		guest := "-"
+		if r.MemoryActual > 0 {
+			guest = units.BytesSize(float64(r.MemoryActual))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+			r.ID, r.Name, r.PID, r.cpu, units.BytesSize(float64(r.MemoryRSS)), guest,
+			units.BytesSize(r.blockRead), units.BytesSize(r.blockWrite),
+			units.BytesSize(r.rx), units.BytesSize(r.tx))
+	}
+	return w.Flush()
+}
+
+// perSecond returns the rate of a monotonic counter between two samples.
+// A counter that went backwards (VMM restarted) yields 0.
+func perSecond(cur, prev uint64, wall time.Duration) float64 {
+	if wall <= 0 || cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / wall.Seconds()
+}
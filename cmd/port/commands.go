@@ -0,0 +1,32 @@
+package port
+
+import (
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+)
+
+// Actions defines published port operations.
+type Actions interface {
+	List(cmd *cobra.Command, args []string) error
+}
+
+// Command builds the "port" parent command with all subcommands.
+func Command(h Actions) *cobra.Command {
+	portCmd := &cobra.Command{
+		Use:   "port",
+		Short: "Inspect host ports published to VMs with --publish",
+	}
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List published ports with their forwarding state and connection metrics",
+		Args:    cobra.NoArgs,
+		RunE:    h.List,
+	}
+	cmdcore.AddFormatFlag(listCmd)
+
+	portCmd.AddCommand(listCmd)
+	return portCmd
+}
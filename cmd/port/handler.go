@@ -0,0 +1,95 @@
+package port
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	units "github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/daemon"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Forwarding states of a published port.
+const (
+	stateForwarding = "forwarding" // the daemon relays it
+	statePasst      = "passt"      // the usermode VM's passt relays it
+	stateCNI        = "cni"        // the first NIC's CNI chain (e.g. portmap) maps it
+	statePending    = "pending"    // VM not running, no IP yet, or bind failed
+	stateNoDaemon   = "no-daemon"  // nothing relays it until the daemon runs
+)
+
+// entry is one published port of a VM.
+type entry struct {
+	VMID   string            `json:"vm_id"`
+	VMName string            `json:"vm_name"`
+	Port   types.PortMapping `json:"port"`
+	State  string            `json:"state"`
+	Target string            `json:"target,omitempty"` // guest ip:port the daemon dials
+	Stats  *daemon.PortStats `json:"stats,omitempty"`
+}
+
+type Handler struct {
+	cmdcore.BaseHandler
+}
+
+func (h Handler) List(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	vms, err := hyper.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	slices.SortFunc(vms, func(a, b *types.VM) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	forwarded, err := daemon.ReadPorts(conf)
+	if err != nil {
+		return fmt.Errorf("read daemon ports: %w", err)
+	}
+	_, daemonUp := daemon.Running(conf)
+
+	entries := []entry{}
+	for _, vm := range vms {
+		for _, m := range vm.Config.Publish {
+			e := entry{VMID: vm.ID, VMName: vm.Config.Name, Port: m, State: stateNoDaemon}
+			switch i := slices.IndexFunc(forwarded, func(p daemon.PortStatus) bool { return p.VMID == vm.ID && p.Mapping == m }); {
+			case daemon.UsermodeVM(vm):
+				e.State = statePasst
+			case daemon.CNIPortMapped(vm):
+				e.State = stateCNI
+			case i >= 0:
+				e.State, e.Target, e.Stats = stateForwarding, forwarded[i].Target, &forwarded[i].PortStats
+			case daemonUp:
+				e.State = statePending
+			}
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == 0 && cmdcore.IsTableFormat(cmd) {
+		fmt.Println("No published ports found.")
+		return nil
+	}
+	return cmdcore.OutputFormatted(cmd, entries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "VM\tPORT\tSTATE\tTARGET\tACTIVE\tTOTAL\tFAILED\tIN\tOUT") //nolint:errcheck
+		for _, e := range entries {
+			target, active, total, failed, in, out := "-", "-", "-", "-", "-", "-"
+			if s := e.Stats; s != nil {
+				target = e.Target
+				active, total, failed = strconv.FormatInt(s.Active, 10), strconv.FormatInt(s.Total, 10), strconv.FormatInt(s.Failed, 10)
+				in, out = units.BytesSize(float64(s.BytesIn)), units.BytesSize(float64(s.BytesOut))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				e.VMName, e.Port, e.State, target, active, total, failed, in, out)
+		}
+	})
+}
@@ -12,12 +12,19 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	cmdcompose "github.com/projecteru2/cocoon/cmd/compose"
 	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	cmddisk "github.com/projecteru2/cocoon/cmd/disk"
+	cmdfirmware "github.com/projecteru2/cocoon/cmd/firmware"
 	cmdimages "github.com/projecteru2/cocoon/cmd/images"
+	cmdnetwork "github.com/projecteru2/cocoon/cmd/network"
 	cmdothers "github.com/projecteru2/cocoon/cmd/others"
+	cmdport "github.com/projecteru2/cocoon/cmd/port"
 	cmdsnapshot "github.com/projecteru2/cocoon/cmd/snapshot"
 	cmdvm "github.com/projecteru2/cocoon/cmd/vm"
+	cmdvolume "github.com/projecteru2/cocoon/cmd/volume"
 	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
 )
 
 var (
@@ -35,9 +42,9 @@ var (
 		}
 
 		cmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file path")
-		cmd.PersistentFlags().String("root-dir", "", "root data directory")
-		cmd.PersistentFlags().String("run-dir", "", "runtime directory")
-		cmd.PersistentFlags().String("log-dir", "", "log directory")
+		cmd.PersistentFlags().String("root-dir", "", "root data directory (default: /var/lib/cocoon, rootless: $XDG_DATA_HOME/cocoon)")
+		cmd.PersistentFlags().String("run-dir", "", "runtime directory (default: /var/lib/cocoon/run, rootless: $XDG_RUNTIME_DIR/cocoon)")
+		cmd.PersistentFlags().String("log-dir", "", "log directory (default: /var/log/cocoon, rootless: $XDG_STATE_HOME/cocoon/log)")
 		cmd.PersistentFlags().String("cni-conf-dir", "", "CNI plugin config directory (default: /etc/cni/net.d)")
 		cmd.PersistentFlags().String("cni-bin-dir", "", "CNI plugin binary directory (default: /opt/cni/bin)")
 		cmd.PersistentFlags().String("root-password", "", "default root password for cloudimg VMs")
@@ -55,15 +62,28 @@ var (
 
 		viper.SetEnvPrefix("COCOON")
 		viper.AutomaticEnv()
-		viper.SetDefault("root_dir", "/var/lib/cocoon")
-		viper.SetDefault("run_dir", "/var/lib/cocoon/run")
-		viper.SetDefault("log_dir", "/var/log/cocoon")
+		viper.SetDefault("rootless", false)
 		viper.SetDefault("ch_binary", "cloud-hypervisor")
+		viper.SetDefault("swtpm_binary", "swtpm")
+		viper.SetDefault("qsd_binary", "qemu-storage-daemon")
+		viper.SetDefault("passt_binary", "passt")
+		viper.SetDefault("cgroup_cpu_overhead_percent", 25)
+		viper.SetDefault("cgroup_memory_overhead_mb", 256)
+		viper.SetDefault("ch_seccomp", string(types.SeccompOn))
+		viper.SetDefault("ch_landlock", string(types.LandlockAuto))
+		viper.SetDefault("hugepages", string(types.HugePagesAuto))
+		viper.SetDefault("hypervisor", config.HypervisorCH)
+		viper.SetDefault("keystore", config.KeystoreFile)
+		viper.SetDefault("qemu_firmware", "/usr/share/ovmf/OVMF.fd")
 		viper.SetDefault("cni_conf_dir", "/etc/cni/net.d")
 		viper.SetDefault("cni_bin_dir", "/opt/cni/bin")
+		viper.SetDefault("cni_retries", 2)
 		viper.SetDefault("dns", "8.8.8.8,1.1.1.1")
+		viper.SetDefault("dns_domain", "cocoon")
 		viper.SetDefault("stop_timeout_seconds", 30)
 		viper.SetDefault("pool_size", runtime.NumCPU())
+		viper.SetDefault("reconcile_interval_seconds", 10)
+		viper.SetDefault("gc_interval_seconds", 3600)
 		viper.SetDefault("log.level", "info")
 		viper.SetDefault("log.max_size", 500)
 		viper.SetDefault("log.max_age", 28)
@@ -74,6 +94,12 @@ var (
 		cmd.AddCommand(cmdimages.Command(cmdimages.Handler{BaseHandler: base}))
 		cmd.AddCommand(cmdvm.Command(cmdvm.Handler{BaseHandler: base}))
 		cmd.AddCommand(cmdsnapshot.Command(cmdsnapshot.Handler{BaseHandler: base}))
+		cmd.AddCommand(cmdvolume.Command(cmdvolume.Handler{BaseHandler: base}))
+		cmd.AddCommand(cmddisk.Command(cmddisk.Handler{BaseHandler: base}))
+		cmd.AddCommand(cmdfirmware.Command(cmdfirmware.Handler{BaseHandler: base}))
+		cmd.AddCommand(cmdnetwork.Command(cmdnetwork.Handler{BaseHandler: base}))
+		cmd.AddCommand(cmdport.Command(cmdport.Handler{BaseHandler: base}))
+		cmd.AddCommand(cmdcompose.Command(cmdcompose.Handler{BaseHandler: base}))
 		for _, c := range cmdothers.Commands(cmdothers.Handler{BaseHandler: base}) {
 			cmd.AddCommand(c)
 		}
@@ -100,6 +126,7 @@ func initConfig(ctx context.Context) error {
 			return fmt.Errorf("read config: %w", err)
 		}
 	}
+	setRootlessDefaults(viper.GetBool("rootless"))
 
 	conf = &config.Config{}
 	if err := viper.Unmarshal(conf); err != nil {
@@ -111,3 +138,20 @@ func initConfig(ctx context.Context) error {
 
 	return log.SetupLog(ctx, conf.Log, "")
 }
+
+// setRootlessDefaults sets the defaults that differ in rootless mode. It
+// runs once the config file is read, since rootless is only ever enabled
+// explicitly there or by COCOON_ROOTLESS.
+func setRootlessDefaults(rootless bool) {
+	rootDir, runDir, logDir := config.DefaultDirs(rootless)
+	viper.SetDefault("root_dir", rootDir)
+	viper.SetDefault("run_dir", runDir)
+	viper.SetDefault("log_dir", logDir)
+	if rootless {
+		viper.SetDefault("network_provider", config.NetworkProviderUsermode)
+		return
+	}
+	viper.SetDefault("network_provider", config.NetworkProviderCNI)
+	viper.SetDefault("cgroup_parent", "cocoon")
+	viper.SetDefault("ephemeral_dir", "/dev/shm/cocoon")
+}
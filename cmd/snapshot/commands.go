@@ -45,6 +45,7 @@ func Command(h Actions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Inspect,
 	}
+	cmdcore.AddInspectFormatFlag(inspectCmd)
 
 	rmCmd := &cobra.Command{
 		Use:   "rm SNAPSHOT [SNAPSHOT...]",
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/cobra"
 
 	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/service"
 	"github.com/projecteru2/cocoon/snapshot"
 	"github.com/projecteru2/cocoon/types"
 )
@@ -28,11 +29,11 @@ func (h Handler) Save(cmd *cobra.Command, args []string) error {
 	}
 	logger := log.WithFunc("cmd.snapshot.save")
 
-	hyper, err := cmdcore.InitHypervisor(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return err
 	}
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	snapBackend, err := service.InitSnapshot(conf)
 	if err != nil {
 		return err
 	}
@@ -84,7 +85,7 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	snapBackend, err := service.InitSnapshot(conf)
 	if err != nil {
 		return err
 	}
@@ -93,7 +94,7 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 	vmRef, _ := cmd.Flags().GetString("vm")
 	var filterIDs map[string]struct{}
 	if vmRef != "" {
-		hyper, hyperErr := cmdcore.InitHypervisor(conf)
+		hyper, hyperErr := service.InitHypervisor(conf)
 		if hyperErr != nil {
 			return hyperErr
 		}
@@ -103,6 +104,9 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 		}
 		filterIDs = vm.SnapshotIDs
 		if len(filterIDs) == 0 {
+			if !cmdcore.IsTableFormat(cmd) {
+				return cmdcore.OutputFormatted(cmd, []*types.Snapshot{}, nil)
+			}
 			fmt.Println("No snapshots found for VM.")
 			return nil
 		}
@@ -125,8 +129,11 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 	}
 
 	if len(snapshots) == 0 {
-		fmt.Println("No snapshots found.")
-		return nil
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No snapshots found.")
+			return nil
+		}
+		snapshots = []*types.Snapshot{}
 	}
 
 	slices.SortFunc(snapshots, func(a, b *types.Snapshot) int { return a.CreatedAt.Compare(b.CreatedAt) })
@@ -147,7 +154,7 @@ func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	snapBackend, err := service.InitSnapshot(conf)
 	if err != nil {
 		return err
 	}
@@ -156,7 +163,7 @@ func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("inspect: %w", err)
 	}
-	return cmdcore.OutputJSON(s)
+	return cmdcore.OutputInspect(cmd, s)
 }
 
 func (h Handler) RM(cmd *cobra.Command, args []string) error {
@@ -165,7 +172,7 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	logger := log.WithFunc("cmd.snapshot.rm")
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	snapBackend, err := service.InitSnapshot(conf)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,8 @@
 package vm
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 
 	cmdcore "github.com/projecteru2/cocoon/cmd/core"
@@ -13,11 +15,23 @@ type Actions interface {
 	Clone(cmd *cobra.Command, args []string) error
 	Start(cmd *cobra.Command, args []string) error
 	Stop(cmd *cobra.Command, args []string) error
+	Reboot(cmd *cobra.Command, args []string) error
+	Suspend(cmd *cobra.Command, args []string) error
+	ResumeFromDisk(cmd *cobra.Command, args []string) error
+	UpgradeVMM(cmd *cobra.Command, args []string) error
+	Kill(cmd *cobra.Command, args []string) error
 	List(cmd *cobra.Command, args []string) error
 	Inspect(cmd *cobra.Command, args []string) error
+	Stats(cmd *cobra.Command, args []string) error
+	Logs(cmd *cobra.Command, args []string) error
+	Credentials(cmd *cobra.Command, args []string) error
+	Wait(cmd *cobra.Command, args []string) error
 	Console(cmd *cobra.Command, args []string) error
 	RM(cmd *cobra.Command, args []string) error
+	Rename(cmd *cobra.Command, args []string) error
+	Update(cmd *cobra.Command, args []string) error
 	Restore(cmd *cobra.Command, args []string) error
+	Backup(cmd *cobra.Command, args []string) error
 	Debug(cmd *cobra.Command, args []string) error
 }
 
@@ -34,7 +48,7 @@ func Command(h Actions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Create,
 	}
-	addVMFlags(createCmd)
+	AddVMFlags(createCmd)
 
 	runCmd := &cobra.Command{
 		Use:   "run [flags] IMAGE",
@@ -42,37 +56,98 @@ func Command(h Actions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Run,
 	}
-	addVMFlags(runCmd)
+	AddVMFlags(runCmd)
+	runCmd.Flags().Bool("attach", false, "attach the console right after start to watch boot output")
+	runCmd.Flags().Bool("rm", false, "delete the VM when the attached console disconnects (requires --attach)")
+	runCmd.Flags().String("escape-char", "^]", "console escape character with --attach (single char or ^X caret notation)")
 
 	cloneCmd := &cobra.Command{
 		Use:   "clone [flags] SNAPSHOT",
-		Short: "Clone a new VM from a snapshot",
+		Short: "Clone a new VM from a snapshot (or a stopped VM with --from-vm)",
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Clone,
 	}
 	addCloneFlags(cloneCmd)
+	cloneCmd.Flags().Bool("from-vm", false, "treat the argument as a created/stopped VM and copy its disk instead of restoring a snapshot")
 
 	startCmd := &cobra.Command{
 		Use:   "start VM [VM...]",
 		Short: "Start created/stopped VM(s)",
-		Args:  cobra.MinimumNArgs(1),
-		RunE:  h.Start,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if autostarted, _ := cmd.Flags().GetBool("autostarted"); autostarted {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: h.Start,
 	}
+	startCmd.Flags().Bool("autostarted", false, "start every VM created with --autostart that is not running (for host boot)")
+	startCmd.Flags().Bool("wait-for-ip", false, "block until each VM's NIC has an address and print NAME<TAB>IP; DHCP addresses are learned from guest traffic")
+	startCmd.Flags().Duration("ip-timeout", 2*time.Minute, "give up waiting for an IP after this long") //nolint:mnd
 
 	stopCmd := &cobra.Command{
 		Use:   "stop VM [VM...]",
 		Short: "Stop running VM(s)",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all, _ := cmd.Flags().GetBool("all"); all {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
+		RunE: h.Stop,
+	}
+	stopCmd.Flags().Duration("timeout", 0, "graceful shutdown timeout before force-kill (0 = stop_timeout_seconds)")
+	stopCmd.Flags().Bool("all", false, "stop every running VM, most recently started first (for host shutdown)")
+	stopCmd.Flags().Int("parallel", 1, "number of VMs to shut down concurrently")
+	stopCmd.Flags().Duration("deadline", 0, "overall time limit; VMs still shutting down are force-stopped when it runs out (0 = none)")
+
+	killCmd := &cobra.Command{
+		Use:   "kill [flags] VM [VM...]",
+		Short: "Kill running VM(s) without a graceful guest shutdown",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.Kill,
+	}
+	killCmd.Flags().StringP("signal", "s", "KILL", "signal sent to the VMM process: KILL or TERM (TERM escalates to KILL after the grace period)")
+
+	rebootCmd := &cobra.Command{
+		Use:   "reboot VM [VM...]",
+		Short: "Reboot running VM(s) in place (keeps the VMM process and console)",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.Reboot,
+	}
+
+	suspendCmd := &cobra.Command{
+		Use:   "suspend VM [VM...]",
+		Short: "Save running VM(s) to disk and exit the VMM, freeing their memory",
 		Args:  cobra.MinimumNArgs(1),
-		RunE:  h.Stop,
+		RunE:  h.Suspend,
 	}
 
+	resumeFromDiskCmd := &cobra.Command{
+		Use:   "resume-from-disk VM [VM...]",
+		Short: "Restore suspended VM(s) from the state saved on disk",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.ResumeFromDisk,
+	}
+
+	upgradeVMMCmd := &cobra.Command{
+		Use:   "upgrade-vmm VM [VM...]",
+		Short: "Move VM(s) onto another cloud-hypervisor binary, one at a time; running guests are saved and restored on it",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.UpgradeVMM,
+	}
+	upgradeVMMCmd.Flags().String("ch-binary", "", "cloud-hypervisor binary to move to (empty = ch_binary config)")
+
 	listCmd := &cobra.Command{
 		Use:     "list",
-		Aliases: []string{"ls"},
+		Aliases: []string{"ls", "ps"},
 		Short:   "List VMs with status",
 		RunE:    h.List,
 	}
 	cmdcore.AddFormatFlag(listCmd)
+	listCmd.Flags().BoolP("quiet", "q", false, "only print VM IDs")
+	listCmd.Flags().BoolP("size", "s", false, "show the host space allocated to each VM's root disk")
+	listCmd.Flags().StringArray("filter", nil, `filter VMs: "label=<key>[=<value>]", "state=<state>", or "image=<image>" (repeatable)`)
 
 	inspectCmd := &cobra.Command{
 		Use:   "inspect VM",
@@ -80,6 +155,44 @@ func Command(h Actions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Inspect,
 	}
+	cmdcore.AddInspectFormatFlag(inspectCmd)
+	inspectCmd.Flags().BoolP("size", "s", false, "add disk_usage, the host space allocated to the VM's root disk")
+
+	statsCmd := &cobra.Command{
+		Use:   "stats [flags] [VM...]",
+		Short: "Show CPU, memory, block and network usage of running VM(s)",
+		RunE:  h.Stats,
+	}
+	statsCmd.Flags().Bool("stream", false, "keep refreshing until interrupted")
+	statsCmd.Flags().Duration("interval", 2*time.Second, "refresh interval with --stream") //nolint:mnd
+	statsCmd.Flags().Bool("nics", false, "show one row per NIC with its host device's traffic counters")
+	cmdcore.AddFormatFlag(statsCmd)
+
+	logsCmd := &cobra.Command{
+		Use:   "logs [flags] VM",
+		Short: "Show the VMM process, serial, console or boot log of a VM",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Logs,
+	}
+	logsCmd.Flags().BoolP("follow", "f", false, "keep printing new output until interrupted")
+	logsCmd.Flags().Duration("since", 0, "only show lines logged within this duration (e.g. 10m)")
+	logsCmd.Flags().String("source", "process", "log to show: process, serial (--serial file), console (--console file) or boot (boot probe)")
+
+	credentialsCmd := &cobra.Command{
+		Use:   "credentials VM",
+		Short: "Show the random root password of a cloudimg VM, once",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Credentials,
+	}
+
+	waitCmd := &cobra.Command{
+		Use:   "wait [flags] VM",
+		Short: "Block until a VM is running, stopped, healthy, or has an IP",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Wait,
+	}
+	waitCmd.Flags().String("for", "running", "condition: running, stopped, healthy, or ip (prints the IP)")
+	waitCmd.Flags().Duration("timeout", 5*time.Minute, "give up after this long (0 = wait forever)") //nolint:mnd
 
 	consoleCmd := &cobra.Command{
 		Use:   "console VM",
@@ -97,15 +210,42 @@ func Command(h Actions) *cobra.Command {
 	}
 	rmCmd.Flags().Bool("force", false, "force delete running VMs")
 
-	restoreCmd := &cobra.Command{
-		Use:   "restore [flags] VM SNAPSHOT",
-		Short: "Restore a running VM to a previous snapshot",
+	renameCmd := &cobra.Command{
+		Use:   "rename VM NEW_NAME",
+		Short: "Rename a VM",
 		Args:  cobra.ExactArgs(2),
+		RunE:  h.Rename,
+	}
+
+	updateCmd := &cobra.Command{
+		Use:   "update [flags] VM",
+		Short: "Change CPU/memory/storage of a created or stopped VM",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Update,
+	}
+	updateCmd.Flags().Int("cpu", 0, "boot CPUs (0 = keep current)")
+	updateCmd.Flags().String("memory", "", "memory size (empty = keep current)")
+	updateCmd.Flags().String("storage", "", "COW disk size, grow only (empty = keep current)")
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore [flags] VM SNAPSHOT | restore [--name NAME] BACKUP_FILE",
+		Short: "Restore a running VM to a previous snapshot, or create a VM from a backup",
+		Args:  cobra.RangeArgs(1, 2), //nolint:mnd
 		RunE:  h.Restore,
 	}
 	restoreCmd.Flags().Int("cpu", 0, "boot CPUs (0 = keep current)")
 	restoreCmd.Flags().String("memory", "", "memory size (empty = keep current)")
 	restoreCmd.Flags().String("storage", "", "COW disk size (empty = keep current)")
+	restoreCmd.Flags().String("name", "", "name of the VM created from a backup (empty = the backed-up VM's name)")
+
+	backupCmd := &cobra.Command{
+		Use:   "backup -o FILE VM",
+		Short: "Export a created or stopped VM, disks included, as an archive",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Backup,
+	}
+	backupCmd.Flags().StringP("output", "o", "", "archive path; compressed by suffix: .zst, .gz, or plain tar")
+	_ = backupCmd.MarkFlagRequired("output")
 
 	debugCmd := &cobra.Command{
 		Use:   "debug [flags] IMAGE",
@@ -113,8 +253,7 @@ func Command(h Actions) *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE:  h.Debug,
 	}
-	addVMFlags(debugCmd)
-	debugCmd.Flags().Int("max-cpu", 8, "max CPUs")           //nolint:mnd
+	AddVMFlags(debugCmd)
 	debugCmd.Flags().Int("balloon", 0, "balloon size in MB") //nolint:mnd
 	debugCmd.Flags().String("cow", "", "COW disk path")
 	debugCmd.Flags().String("ch", "cloud-hypervisor", "cloud-hypervisor binary path")
@@ -125,23 +264,94 @@ func Command(h Actions) *cobra.Command {
 		cloneCmd,
 		startCmd,
 		stopCmd,
+		rebootCmd,
+		suspendCmd,
+		resumeFromDiskCmd,
+		upgradeVMMCmd,
+		killCmd,
 		listCmd,
 		inspectCmd,
+		statsCmd,
+		logsCmd,
+		credentialsCmd,
+		waitCmd,
 		consoleCmd,
 		rmCmd,
+		renameCmd,
+		updateCmd,
 		restoreCmd,
+		backupCmd,
 		debugCmd,
 	)
 	return vmCmd
 }
 
-func addVMFlags(cmd *cobra.Command) {
+// AddVMFlags registers the VM settings of "vm create", shared by "vm run",
+// "vm debug" and the VMs of "compose up".
+func AddVMFlags(cmd *cobra.Command) {
 	cmd.Flags().String("name", "", "VM name")
-	cmd.Flags().Int("cpu", 2, "boot CPUs")                //nolint:mnd
+	cmd.Flags().Int("cpu", 2, "boot CPUs") //nolint:mnd
+	cmd.Flags().Int("max-cpu", 0, "vCPU ceiling for CPU hotplug, at least --cpu (0 = host cores)")
 	cmd.Flags().String("memory", "1G", "memory size")     //nolint:mnd
 	cmd.Flags().String("storage", "10G", "COW disk size") //nolint:mnd
 	cmd.Flags().Int("nics", 1, "number of network interfaces (0 = no network); multiple NICs with auto IP config only works for cloudimg; OCI images auto-configure only the last NIC, others require manual setup inside the guest")
-	cmd.Flags().String("network", "", "CNI conflist name (empty = default)")
+	cmd.Flags().StringArray("network", nil, `network name (empty = default conflist), or "sriov:<pf>[:<vlan>]" for a VF of an SR-IOV NIC; repeat to attach one NIC per network, eth0, eth1, ... in flag order`)
+	cmd.Flags().String("ip", "", "fixed IPv4 address for the first NIC, within its network's subnet (empty = allocated by IPAM)")
+	cmd.Flags().Bool("dhcp", false, "configure guest NICs by DHCP instead of static addresses from the CNI result (for plugins that lease by DHCP)")
+	cmd.Flags().Int("mtu", 0, "MTU of every NIC, applied to the tap/veth and the guest (0 = mtu config, else the network plugin's)")
+	cmd.Flags().IntSlice("vlan", nil, "802.1Q VLAN ID to tag NIC traffic with on the host side (0 = untagged); one value applies to every NIC, repeat to set one per NIC in order")
+	cmd.Flags().StringArray("cni-arg", nil, `extra CNI_ARGS "KEY=VALUE" passed to the plugin chain of every CNI NIC (repeatable)`)
+	cmd.Flags().StringArray("mac", nil, "pin the MAC address of a NIC, e.g. 02:42:ac:11:00:02; repeat to set one per NIC in order (must be unique across VMs)")
+	cmd.Flags().StringArray("net-limit", nil, `cap NIC bandwidth in each direction, e.g. "100mbit" or "10mbps"; one value applies to every NIC, repeat to set one per NIC in order`)
+	cmd.Flags().StringArrayP("publish", "p", nil, `forward a host port to the VM via the daemon: "[hostIP:]hostPort:guestPort[/tcp|/udp]" (repeatable)`)
+	cmd.Flags().String("restart", "", `restart policy applied by the daemon: "no" or "always" (empty = no)`)
+	cmd.Flags().Bool("autostart", false, `start the VM at host boot (via "cocoon vm start --autostarted")`)
+	cmd.Flags().String("health-check", "", `daemon health check against the VM IP: "tcp:<port>" or "http:<port>[/path]"`)
+	cmd.Flags().Duration("health-interval", 0, "health check interval (0 = 30s)")
+	cmd.Flags().Duration("health-timeout", 0, "health check timeout (0 = 5s)")
+	cmd.Flags().Int("health-retries", 0, "consecutive failures before unhealthy (0 = 3)")
+	cmd.Flags().Duration("boot-timeout", 0, "on start, wait this long for the console to show --boot-pattern; a kernel panic or timeout marks the VM error (0 = no boot probe)")
+	cmd.Flags().String("boot-pattern", "", `console regexp that marks the guest booted (empty = "login: *$")`)
+	cmd.Flags().StringArray("label", nil, "set a label key=value (repeatable)")
+	cmd.Flags().StringArray("volume", nil, `attach a volume "NAME[:/dev/vdX]"; volumes follow the VM's own disks in flag order (repeatable)`)
+	cmd.Flags().String("cpuset", "", `pin vCPUs to host CPUs, e.g. "2-5" (one CPU per vCPU when enough are given)`)
+	cmd.Flags().Bool("cpuset-shared", false, "allow other --cpuset-shared VMs to pin to the same host CPUs")
+	cmd.Flags().Int("numa-nodes", 0, "guest NUMA nodes; vCPUs and memory are split evenly across them (0 = no NUMA topology)")
+	cmd.Flags().String("numa-memory", "", `per-node memory split, e.g. "3G,1G" (must add up to --memory; empty = even split)`)
+	cmd.Flags().String("numa-host-nodes", "", `host NUMA node backing each guest node, e.g. "0,1" (empty = unbound)`)
+	cmd.Flags().String("serial", "", `serial port: "file" (log to serial.log), "socket", "pty" or "off" (empty = socket for cloud images, off for OCI)`)
+	cmd.Flags().String("console", "", `virtio console: "file" (log to console.log), "pty" or "off" (empty = pty for OCI, off for cloud images)`)
+	cmd.Flags().String("timezone", "", "guest timezone, a tz database name such as Europe/Berlin (default: default_timezone config)")
+	cmd.Flags().String("locale", "", "guest locale such as en_US.UTF-8 (default: default_locale config)")
+	cmd.Flags().String("hostname", "", "guest hostname (default: the VM name made a valid hostname)")
+	cmd.Flags().String("domain", "", "guest DNS domain; the FQDN becomes <hostname>.<domain>")
+	cmd.Flags().StringArray("ssh-key", nil, "SSH public key, or a file of them (e.g. ~/.ssh/id_ed25519.pub), authorized for the default user and root of cloud images (repeatable; default: default_ssh_key config)")
+	cmd.Flags().String("user-data", "", `cloud-init user-data file for cloud images ("-" = stdin), merged into the generated #cloud-config`)
+	cmd.Flags().Bool("replace-user-data", false, "use --user-data as the whole user-data instead of merging it (any cloud-init format, e.g. a script)")
+	cmd.Flags().Bool("user-data-template", false, "expand --user-data as a Go template with .VMName, .VMID, .Hostname, .FQDN and .IP")
+	cmd.Flags().String("metadata-format", "", `cloud-init datasource of cloud images' cidata disk: "nocloud" or "configdrive" (OpenStack; empty = nocloud)`)
+	cmd.Flags().StringArray("copy-in", nil, "copy a local file into the guest, as local:/guest/path (repeatable; 512 KiB total; OCI images need an initrd)")
+	cmd.Flags().StringArray("env", nil, "KEY=VALUE environment variable for the guest's services and login shells (repeatable)")
+	cmd.Flags().StringArray("run-cmd", nil, "shell command cloud images run once on first boot (repeatable, run in order)")
+	cmd.Flags().String("cmdline-append", "", `extra kernel arguments for OCI images, e.g. "systemd.unified_cgroup_hierarchy=1"`)
+	cmd.Flags().String("firmware", "", "UEFI firmware for cloud images: a name from 'cocoon firmware ls' or a file path (empty = CLOUDHV)")
+	cmd.Flags().String("confidential", "", `launch a confidential guest: "sev-snp" or "tdx" (empty = regular VM)`)
+	cmd.Flags().Bool("tpm", false, "attach a TPM 2.0 device backed by a per-VM swtpm (state persists across restarts)")
+	cmd.Flags().Bool("encrypt", false, "encrypt the writable disk of an OCI VM with LUKS2, keyed from the host keystore")
+	cmd.Flags().String("data-dir", "", "absolute directory to keep the VM's writable disks in instead of the run directory, e.g. on a faster filesystem")
+	cmd.Flags().String("pool", "", "storage pool to keep the VM's writable disks in (empty = the default pool, if any)")
+	cmd.Flags().Bool("read-only", false, "discard the guest's root disk changes on every start, booting the pristine image each time")
+	cmd.Flags().String("prealloc", "", `allocate the writable disk on the host at creation: "full", "metadata" (OCI images only) or "off" (empty = off, sparse)`)
+	cmd.Flags().Int64("disk-iops", 0, "cap each disk's I/O operations per second (0 = unlimited)")
+	cmd.Flags().String("disk-bandwidth", "", "cap each disk's throughput in bytes per second, e.g. 100M (empty = unlimited)")
+	cmd.Flags().String("swap", "", "attach a swap disk of this size the guest swaps to, e.g. 1G (empty = none)")
+	cmd.Flags().String("ephemeral-disk", "", "attach a RAM-backed scratch disk of this size, wiped on every stop (e.g. 2G)")
+	cmd.Flags().String("disk-backend", "", `what serves the writable disk: "builtin" or "qsd" (vhost-user-blk via qemu-storage-daemon; empty = builtin)`)
+	cmd.Flags().Bool("pmem-layers", false, "attach OCI image layers as virtio-pmem (DAX) devices instead of virtio-blk disks")
+	cmd.Flags().String("hugepages", "", `back memory with hugepages: "auto", "on", "off" or "prefault" (empty = hugepages config, default auto)`)
+	cmd.Flags().String("seccomp", "", `VMM seccomp filter: "on", "log" or "off" (empty = ch_seccomp config, default on)`)
+	cmd.Flags().String("landlock", "", `VMM landlock sandbox: "auto", "on" or "off" (empty = ch_landlock config, default auto)`)
+	cmd.Flags().String("ch-binary", "", "cloud-hypervisor binary for this VM (empty = ch_binary config)")
 }
 
 func addCloneFlags(cmd *cobra.Command) {
@@ -1,10 +1,16 @@
 package vm
 
 import (
+	"archive/tar"
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"math"
 	"os"
+	"runtime"
 	"slices"
 	"strings"
 	"text/tabwriter"
@@ -18,9 +24,11 @@ import (
 	cmdcore "github.com/projecteru2/cocoon/cmd/core"
 	"github.com/projecteru2/cocoon/config"
 	"github.com/projecteru2/cocoon/console"
+	"github.com/projecteru2/cocoon/daemon"
 	"github.com/projecteru2/cocoon/hypervisor"
 	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
 	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/service"
 	"github.com/projecteru2/cocoon/snapshot"
 	"github.com/projecteru2/cocoon/types"
 	"github.com/projecteru2/cocoon/utils"
@@ -41,13 +49,42 @@ func (h Handler) Create(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func (h Handler) Run(cmd *cobra.Command, args []string) error {
+func (h Handler) Run(cmd *cobra.Command, args []string) (err error) {
+	attach, _ := cmd.Flags().GetBool("attach")
+	rm, _ := cmd.Flags().GetBool("rm")
+	if rm && !attach {
+		return fmt.Errorf("--rm requires --attach")
+	}
+	escapeStr, _ := cmd.Flags().GetString("escape-char")
+	if attach {
+		if !term.IsTerminal(os.Stdin.Fd()) {
+			return fmt.Errorf("--attach: stdin is not a terminal")
+		}
+		if _, err := console.ParseEscapeChar(escapeStr); err != nil {
+			return err
+		}
+	}
+
 	ctx, vm, hyper, err := h.createVM(cmd, args[0])
 	if err != nil {
 		return err
 	}
 	logger := log.WithFunc("cmd.run")
 	logger.Infof(ctx, "VM created: %s (name: %s)", vm.ID, vm.Config.Name)
+	if rm {
+		defer func() {
+			conf, confErr := h.Conf()
+			if confErr != nil {
+				err = errors.Join(err, confErr)
+				return
+			}
+			if _, delErr := service.DeleteVMs(context.WithoutCancel(ctx), conf, hyper, []string{vm.ID}, true); delErr != nil {
+				err = errors.Join(err, fmt.Errorf("remove VM %s: %w", vm.ID, delErr))
+				return
+			}
+			logger.Infof(ctx, "deleted VM: %s", vm.ID)
+		}()
+	}
 
 	started, err := hyper.Start(ctx, []string{vm.ID})
 	if err != nil {
@@ -56,7 +93,10 @@ func (h Handler) Run(cmd *cobra.Command, args []string) error {
 	for _, id := range started {
 		logger.Infof(ctx, "started: %s", id)
 	}
-	return nil
+	if !attach {
+		return nil
+	}
+	return attachConsole(ctx, hyper, vm.ID, escapeStr)
 }
 
 func (h Handler) Clone(cmd *cobra.Command, args []string) error {
@@ -66,15 +106,19 @@ func (h Handler) Clone(cmd *cobra.Command, args []string) error {
 	}
 	logger := log.WithFunc("cmd.clone")
 
-	hyper, err := cmdcore.InitHypervisor(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return err
 	}
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	snapBackend, err := service.InitSnapshot(conf)
 	if err != nil {
 		return err
 	}
 
+	if fromVM, _ := cmd.Flags().GetBool("from-vm"); fromVM {
+		return h.cloneFromVM(ctx, cmd, conf, hyper, args[0], logger)
+	}
+
 	snapRef := args[0]
 
 	// Try local fast path: skip tar encode/decode entirely.
@@ -105,7 +149,7 @@ func (h Handler) Clone(cmd *cobra.Command, args []string) error {
 
 	vm, cloneErr := hyper.Clone(ctx, vmID, vmCfg, networkConfigs, cfg, stream)
 	if cloneErr != nil {
-		rollbackNetwork(ctx, netProvider, vmID)
+		service.RollbackNetwork(ctx, netProvider, vmID)
 		return fmt.Errorf("clone VM: %w", cloneErr)
 	}
 
@@ -129,7 +173,7 @@ func (h Handler) cloneDirect(ctx context.Context, cmd *cobra.Command, conf *conf
 
 	vm, cloneErr := dcr.DirectClone(ctx, vmID, vmCfg, networkConfigs, cfg, dataDir)
 	if cloneErr != nil {
-		rollbackNetwork(ctx, netProvider, vmID)
+		service.RollbackNetwork(ctx, netProvider, vmID)
 		return fmt.Errorf("clone VM: %w", cloneErr)
 	}
 
@@ -138,6 +182,132 @@ func (h Handler) cloneDirect(ctx context.Context, cmd *cobra.Command, conf *conf
 	return nil
 }
 
+// cloneFromVM clones a created or stopped VM by copying its disk. The
+// source VM's resources act as the snapshot minimums for flag inheritance.
+func (h Handler) cloneFromVM(ctx context.Context, cmd *cobra.Command, conf *config.Config, hyper hypervisor.Hypervisor, srcRef string, logger *log.Fields) error {
+	src, err := hyper.Inspect(ctx, srcRef)
+	if err != nil {
+		return fmt.Errorf("inspect VM %s: %w", srcRef, err)
+	}
+	srcCfg := &types.SnapshotConfig{
+		Image:   src.Config.Image,
+		CPU:     src.Config.CPU,
+		Memory:  src.Config.Memory,
+		Storage: src.Config.Storage,
+		NICs:    len(src.NetworkConfigs),
+	}
+	vmCfg, err := cmdcore.CloneVMConfigFromFlags(cmd, srcCfg)
+	if err != nil {
+		return err
+	}
+	if vmCfg.Network == "" {
+		// Each NIC stays on its source conflist; extra NICs use the default.
+		vmCfg.Network = src.Config.Network
+		vmCfg.Networks = slices.Clone(src.Config.Networks)
+	}
+	if err := inheritCloneConfig(src, vmCfg); err != nil {
+		return err
+	}
+	if src.Config.CPUSet != "" && vmCfg.CPUSet == "" {
+		logger.Warnf(ctx, "VM %s pins its vCPUs exclusively to host CPUs %s; the clone is not pinned", srcRef, src.Config.CPUSet)
+	}
+
+	vmID, err := utils.GenerateID()
+	if err != nil {
+		return fmt.Errorf("generate VM ID: %w", err)
+	}
+	if vmCfg.Name == "" {
+		vmCfg.Name = "cocoon-clone-" + vmID[:8]
+	}
+	nics, _ := cmd.Flags().GetInt("nics")
+	if nics == 0 {
+		nics = srcCfg.NICs
+	}
+	if nics < srcCfg.NICs {
+		return fmt.Errorf("--nics %d below source VM NIC count %d", nics, srcCfg.NICs)
+	}
+	netProvider, networkConfigs, err := service.InitVMNetwork(ctx, conf, vmID, nics, vmCfg)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "cloning VM %s ...", srcRef)
+	vm, cloneErr := hyper.CloneVM(ctx, src.ID, vmID, vmCfg, networkConfigs)
+	if cloneErr != nil {
+		service.RollbackNetwork(ctx, netProvider, vmID)
+		return fmt.Errorf("clone VM: %w", cloneErr)
+	}
+	logger.Infof(ctx, "VM cloned: %s (name: %s, state: %s)", vm.ID, vm.Config.Name, vm.State)
+	logger.Infof(ctx, "start with: cocoon vm start %s", vm.ID)
+	return nil
+}
+
+// inheritCloneConfig fills the settings of a "vm clone --from-vm" config
+// that are not taken from flags with those of the source VM src.
+func inheritCloneConfig(src *types.VM, vmCfg *types.VMConfig) error {
+	if vmCfg.MaxCPU = src.Config.MaxCPU; vmCfg.MaxCPU > 0 && vmCfg.CPU > vmCfg.MaxCPU {
+		return fmt.Errorf("--cpu %d exceeds the source VM's max CPUs %d", vmCfg.CPU, vmCfg.MaxCPU)
+	}
+	vmCfg.RestartPolicy = src.Config.RestartPolicy
+	vmCfg.HealthCheck = src.Config.HealthCheck
+	vmCfg.Autostart = src.Config.Autostart
+	if bp := src.Config.BootProbe; bp != nil {
+		probe := *bp
+		vmCfg.BootProbe = &probe
+	}
+	vmCfg.HugePages = src.Config.HugePages
+	vmCfg.PmemLayers = src.Config.PmemLayers
+	vmCfg.Confidential = src.Config.Confidential
+	vmCfg.Firmware = src.Config.Firmware
+	vmCfg.CmdlineAppend = src.Config.CmdlineAppend
+	vmCfg.Domain = src.Config.Domain // the hostname follows the clone's own name
+	vmCfg.SSHKeys = slices.Clone(src.Config.SSHKeys)
+	vmCfg.Files = slices.Clone(src.Config.Files)
+	vmCfg.RunCmds = slices.Clone(src.Config.RunCmds)
+	vmCfg.Env = slices.Clone(src.Config.Env)
+	vmCfg.Timezone = src.Config.Timezone
+	vmCfg.Locale = src.Config.Locale
+	vmCfg.MetadataFormat = src.Config.MetadataFormat
+	vmCfg.UserData = src.Config.UserData
+	vmCfg.ReplaceUserData = src.Config.ReplaceUserData
+	vmCfg.TemplateUserData = src.Config.TemplateUserData
+	vmCfg.DHCP = src.Config.DHCP
+	vmCfg.NetLimits = slices.Clone(src.Config.NetLimits)
+	vmCfg.MTU = src.Config.MTU
+	vmCfg.VLANs = slices.Clone(src.Config.VLANs)
+	vmCfg.CNIArgs = slices.Clone(src.Config.CNIArgs)
+	vmCfg.Serial = src.Config.Serial
+	vmCfg.Console = src.Config.Console
+	vmCfg.TPM = src.Config.TPM // the clone gets a fresh TPM, not the source's keys
+	vmCfg.Encrypt = src.Config.Encrypt
+	vmCfg.ReadOnly = src.Config.ReadOnly
+	vmCfg.DiskBackend = src.Config.DiskBackend
+	vmCfg.DataDir = src.Config.DataDir // keeps the reflink on one filesystem
+	vmCfg.Pool = src.Config.Pool
+	vmCfg.EphemeralDisk = src.Config.EphemeralDisk
+	vmCfg.Swap = src.Config.Swap
+	vmCfg.Prealloc = src.Config.Prealloc // honored by --read-only resets; the reflinked disk shares the source's blocks
+	vmCfg.DiskIOPS = src.Config.DiskIOPS
+	vmCfg.DiskBandwidth = src.Config.DiskBandwidth
+	vmCfg.Seccomp = src.Config.Seccomp
+	vmCfg.Landlock = src.Config.Landlock
+	vmCfg.CHBinary = src.Config.CHBinary
+	vmCfg.Labels = maps.Clone(src.Config.Labels)
+	// Published ports, a fixed IP, pinned MACs, volumes and an exclusive
+	// vCPU pin stay with the source: each has one owner.
+	if src.Config.CPUSetShared {
+		vmCfg.CPUSet, vmCfg.CPUSetShared = src.Config.CPUSet, true
+	}
+	if numa := src.Config.NUMA; numa != nil {
+		// An explicit per-node split only holds while memory is unchanged.
+		vmCfg.NUMA = &types.NUMAConfig{Nodes: numa.Nodes, HostNodes: slices.Clone(numa.HostNodes)}
+		if vmCfg.Memory == src.Config.Memory {
+			vmCfg.NUMA.Memory = slices.Clone(numa.Memory)
+		}
+	}
+	return nil
+}
+
 func (h Handler) prepareClone(cmd *cobra.Command, ctx context.Context, conf *config.Config, cfg *types.SnapshotConfig) (*types.VMConfig, string, network.Network, []*types.NetworkConfig, error) {
 	vmCfg, err := cmdcore.CloneVMConfigFromFlags(cmd, cfg)
 	if err != nil {
@@ -160,7 +330,7 @@ func (h Handler) prepareClone(cmd *cobra.Command, ctx context.Context, conf *con
 		return nil, "", nil, nil, fmt.Errorf("--nics %d below snapshot minimum %d", nics, cfg.NICs)
 	}
 
-	netProvider, networkConfigs, err := initNetwork(ctx, conf, vmID, nics, vmCfg)
+	netProvider, networkConfigs, err := service.InitVMNetwork(ctx, conf, vmID, nics, vmCfg)
 	if err != nil {
 		return nil, "", nil, nil, err
 	}
@@ -200,45 +370,345 @@ func (h Handler) Start(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	hyper, err := cmdcore.InitHypervisor(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return err
 	}
+	if autostarted, _ := cmd.Flags().GetBool("autostarted"); autostarted {
+		if args, err = autostartRefs(ctx, hyper); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			log.WithFunc("cmd.start").Info(ctx, "no autostart VMs to start")
+			return nil
+		}
+	}
 
-	// Pre-start: recover missing netns (e.g. after host reboot).
-	if netProvider, netErr := cmdcore.InitNetwork(conf); netErr == nil {
-		h.recoverNetwork(ctx, hyper, netProvider, args)
+	if waitIP, _ := cmd.Flags().GetBool("wait-for-ip"); waitIP {
+		service.RecoverNetwork(ctx, conf, hyper, args)
+		timeout, _ := cmd.Flags().GetDuration("ip-timeout")
+		return startWaitingForIP(ctx, hyper, args, timeout)
+	}
+	// With a daemon running, it starts the VMs (recovering their network
+	// first) and tracks them from the start.
+	client, err := daemon.Dial(conf)
+	if err != nil {
+		return err
+	}
+	if client != nil {
+		defer client.Close() //nolint:errcheck
+		return batchVMCmd(ctx, "start", "started", client.Start, args)
 	}
 
+	// Pre-start: recover missing netns (e.g. after host reboot).
+	service.RecoverNetwork(ctx, conf, hyper, args)
 	return batchVMCmd(ctx, "start", "started", hyper.Start, args)
 }
 
-// recoverNetwork recreates the network namespace and TC redirect for VMs
-// whose netns was lost (e.g. after host reboot). Best-effort: failures are
-// logged but do not block start — hyper.Start will report the real error.
-func (h Handler) recoverNetwork(ctx context.Context, hyper hypervisor.Hypervisor, net network.Network, refs []string) {
-	logger := log.WithFunc("cmd.recoverNetwork")
+// startWaitingForIP starts refs, then blocks until every VM with NICs has
+// an address and prints one "NAME IP" line per VM. NICs with static config
+// have theirs already; for the rest the tap is watched from before the
+// start, and the address the guest claims over DHCP or ARP is recorded on
+// the VM.
+func startWaitingForIP(ctx context.Context, hyper hypervisor.Hypervisor, refs []string, timeout time.Duration) error {
+	type pending struct {
+		id       string
+		snoopers map[string]*network.IPSnooper // by NIC MAC
+	}
+	var waits []pending
+	defer func() {
+		for _, p := range waits {
+			for _, s := range p.snoopers {
+				_ = s.Close()
+			}
+		}
+	}()
 	for _, ref := range refs {
 		vm, err := hyper.Inspect(ctx, ref)
-		if err != nil || vm == nil || len(vm.NetworkConfigs) == 0 {
+		if err != nil {
+			return fmt.Errorf("inspect VM %s: %w", ref, err)
+		}
+		if len(vm.NetworkConfigs) == 0 {
+			log.WithFunc("cmd.start").Warnf(ctx, "VM %s has no NICs, not waiting for an IP", vm.ID)
+			continue
+		}
+		if slices.ContainsFunc(vm.NetworkConfigs, func(nc *types.NetworkConfig) bool {
+			return nc != nil && nc.Network != nil && nc.Network.IP != ""
+		}) {
+			continue
+		}
+		p := pending{id: vm.ID, snoopers: map[string]*network.IPSnooper{}}
+		waits = append(waits, p)
+		for _, nc := range vm.NetworkConfigs {
+			if nc.VFIODevice != "" {
+				continue // a passed-through VF has no host side to watch
+			}
+			s, err := network.NewIPSnooper(nc)
+			if err != nil {
+				return fmt.Errorf("watch NIC %s of VM %s: %w", nc.Mac, vm.ID, err)
+			}
+			p.snoopers[nc.Mac] = s
+		}
+		if len(p.snoopers) == 0 {
+			waits = waits[:len(waits)-1]
+			log.WithFunc("cmd.start").Warnf(ctx, "VM %s has only SR-IOV NICs, not waiting for an IP", vm.ID)
+		}
+	}
+
+	if err := batchVMCmd(ctx, "start", "started", hyper.Start, refs); err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	recorder, _ := hyper.(hypervisor.GuestIPRecorder)
+	for _, p := range waits {
+		mac, ip, err := firstGuestIP(waitCtx, p.snoopers)
+		if err != nil {
+			return fmt.Errorf("wait for IP of VM %s: %w", p.id, err)
+		}
+		if recorder == nil {
 			continue
 		}
-		if net.Verify(ctx, vm.ID) == nil {
-			continue // netns exists, no recovery needed
+		if err := recorder.SetGuestIP(ctx, p.id, mac, ip); err != nil {
+			return fmt.Errorf("record IP of VM %s: %w", p.id, err)
 		}
-		logger.Warnf(ctx, "netns missing for VM %s, recovering network", vm.ID)
-		if _, recoverErr := net.Config(ctx, vm.ID, len(vm.NetworkConfigs), &vm.Config, vm.NetworkConfigs...); recoverErr != nil {
-			logger.Warnf(ctx, "recover network for VM %s: %v (start will fail)", vm.ID, recoverErr)
+	}
+	for _, ref := range refs {
+		vm, err := hyper.Inspect(ctx, ref)
+		if err != nil {
+			return fmt.Errorf("inspect VM %s: %w", ref, err)
+		}
+		if ip := vm.PrimaryIP(); ip != "" {
+			fmt.Printf("%s\t%s\n", vm.Config.Name, ip)
 		}
 	}
+	return nil
+}
+
+// firstGuestIP waits on every snooper and returns the first address seen,
+// with the MAC of the NIC it was seen on.
+func firstGuestIP(ctx context.Context, snoopers map[string]*network.IPSnooper) (string, string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		mac, ip string
+		err     error
+	}
+	results := make(chan result, len(snoopers))
+	for mac, s := range snoopers {
+		go func() {
+			ip, err := s.Wait(ctx)
+			results <- result{mac: mac, ip: ip, err: err}
+		}()
+	}
+	// Drain every result so no Wait is still reading when the caller
+	// closes the snoopers.
+	var found *result
+	var errs []error
+	for range snoopers {
+		r := <-results
+		switch {
+		case found != nil:
+		case r.err == nil:
+			found = &r
+			cancel()
+		default:
+			errs = append(errs, r.err)
+		}
+	}
+	if found != nil {
+		return found.mac, found.ip, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	return "", "", errors.Join(errs...)
+}
+
+// autostartRefs returns the --autostart VMs whose VMM is not running. VMs
+// still recorded as running from before a host reboot are stopped first,
+// which takes the dead-process fast path and clears their stale PID and
+// socket files.
+func autostartRefs(ctx context.Context, hyper hypervisor.Hypervisor) ([]string, error) {
+	vms, err := hyper.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list VMs: %w", err)
+	}
+	var refs, stale []string
+	for _, vm := range vms {
+		// Suspended VMs stay parked until resumed explicitly.
+		if !vm.Config.Autostart || vm.State == types.VMStateCreating || vm.State == types.VMStateSuspended {
+			continue
+		}
+		if vm.State == types.VMStateRunning {
+			if utils.IsProcessAlive(vm.PID) {
+				continue
+			}
+			stale = append(stale, vm.ID)
+		}
+		refs = append(refs, vm.ID)
+	}
+	if len(stale) > 0 {
+		if _, err := hyper.Stop(ctx, stale); err != nil {
+			return nil, fmt.Errorf("clean up stale VMs: %w", err)
+		}
+	}
+	return refs, nil
 }
 
 func (h Handler) Stop(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	deadline, _ := cmd.Flags().GetDuration("deadline")
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		if args, err = runningRefs(ctx, hyper); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			log.WithFunc("cmd.stop").Info(ctx, "no running VMs")
+			return nil
+		}
+	}
+	if deadline <= 0 && parallel <= 1 {
+		if timeout > 0 {
+			ctx = hypervisor.WithStopTimeout(ctx, timeout)
+			return batchVMCmd(ctx, "stop", "stopped", hyper.Stop, args)
+		}
+		client, err := daemon.Dial(conf)
+		if err != nil {
+			return err
+		}
+		if client != nil {
+			defer client.Close() //nolint:errcheck
+			return batchVMCmd(ctx, "stop", "stopped", client.Stop, args)
+		}
+		return batchVMCmd(ctx, "stop", "stopped", hyper.Stop, args)
+	}
+
+	// Each VM gets its usual graceful window, cut short by whatever is left
+	// of the deadline; once it has passed, Stop goes straight to the forced
+	// path instead of waiting for the guest.
+	graceful := cmp.Or(timeout, time.Duration(conf.StopTimeoutSeconds)*time.Second)
+	var until time.Time
+	if deadline > 0 {
+		until = time.Now().Add(deadline)
+	}
+	return batchVMCmd(ctx, "stop", "stopped", func(ctx context.Context, refs []string) ([]string, error) {
+		result := utils.ForEachParallel(ctx, refs, parallel, func(ctx context.Context, ref string) error {
+			window := graceful
+			if !until.IsZero() {
+				window = max(min(window, time.Until(until)), time.Millisecond)
+			}
+			_, err := hyper.Stop(hypervisor.WithStopTimeout(ctx, window), []string{ref})
+			return err
+		})
+		return result.Succeeded, result.Err()
+	}, args)
+}
+
+// runningRefs returns the running VMs, most recently started first, so
+// VMs brought up later (which may depend on earlier ones) go down first.
+func runningRefs(ctx context.Context, hyper hypervisor.Hypervisor) ([]string, error) {
+	vms, err := hyper.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list VMs: %w", err)
+	}
+	vms = slices.DeleteFunc(vms, func(vm *types.VM) bool { return vm.State != types.VMStateRunning })
+	slices.SortStableFunc(vms, func(a, b *types.VM) int {
+		return startedAt(b).Compare(startedAt(a))
+	})
+	refs := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		refs = append(refs, vm.ID)
+	}
+	return refs, nil
+}
+
+func startedAt(vm *types.VM) time.Time {
+	if vm.StartedAt == nil {
+		return time.Time{}
+	}
+	return *vm.StartedAt
+}
+
+func (h Handler) Kill(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	sigStr, _ := cmd.Flags().GetString("signal")
+	sig, err := cmdcore.ParseSignal(sigStr)
+	if err != nil {
+		return err
+	}
+	return batchVMCmd(ctx, "kill", "killed", func(ctx context.Context, refs []string) ([]string, error) {
+		return hyper.Kill(ctx, refs, sig)
+	}, args)
+}
+
+func (h Handler) Reboot(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	return batchVMCmd(ctx, "reboot", "rebooted", hyper.Reboot, args)
+}
+
+func (h Handler) Suspend(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	suspender, ok := hyper.(hypervisor.Suspender)
+	if !ok {
+		return fmt.Errorf("suspend is not supported by %s", hyper.Type())
+	}
+	return batchVMCmd(ctx, "suspend", "suspended", suspender.Suspend, args)
+}
+
+func (h Handler) ResumeFromDisk(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	suspender, ok := hyper.(hypervisor.Suspender)
+	if !ok {
+		return fmt.Errorf("resume-from-disk is not supported by %s", hyper.Type())
+	}
+	// The netns may be gone if the host rebooted while the VM was parked.
+	service.RecoverNetwork(ctx, conf, hyper, args)
+	return batchVMCmd(ctx, "resume-from-disk", "resumed", suspender.ResumeFromDisk, args)
+}
+
+func (h Handler) UpgradeVMM(cmd *cobra.Command, args []string) error {
 	ctx, hyper, err := h.initHyper(cmd)
 	if err != nil {
 		return err
 	}
-	return batchVMCmd(ctx, "stop", "stopped", hyper.Stop, args)
+	upgrader, ok := hyper.(hypervisor.VMMUpgrader)
+	if !ok {
+		return fmt.Errorf("upgrade-vmm is not supported by %s", hyper.Type())
+	}
+	binary, err := cmdcore.BinaryFromFlag(cmd, "ch-binary")
+	if err != nil {
+		return err
+	}
+	return batchVMCmd(ctx, "upgrade-vmm", "upgraded", func(ctx context.Context, refs []string) ([]string, error) {
+		return upgrader.UpgradeVMM(ctx, refs, binary)
+	}, args)
 }
 
 func (h Handler) List(cmd *cobra.Command, _ []string) error {
@@ -247,25 +717,66 @@ func (h Handler) List(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
+	specs, _ := cmd.Flags().GetStringArray("filter")
+	filter, err := cmdcore.ParseVMFilter(specs)
+	if err != nil {
+		return err
+	}
 	vms, err := hyper.List(ctx)
 	if err != nil {
 		return fmt.Errorf("list: %w", err)
 	}
-	if len(vms) == 0 {
-		fmt.Println("No VMs found.")
-		return nil
-	}
-
+	vms = slices.DeleteFunc(vms, func(vm *types.VM) bool { return !filter.Match(vm) })
 	slices.SortFunc(vms, func(a, b *types.VM) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	for i, vm := range vms {
+		vms[i] = vm.Redacted()
+	}
 
-	return cmdcore.OutputFormatted(cmd, vms, func(w *tabwriter.Writer) {
-		fmt.Fprintln(w, "ID\tNAME\tSTATE\tCPU\tMEMORY\tSTORAGE\tIP\tIMAGE\tCREATED") //nolint:errcheck
+	if quiet, _ := cmd.Flags().GetBool("quiet"); quiet {
+		for _, vm := range vms {
+			fmt.Println(vm.ID)
+		}
+		return nil
+	}
+	if len(vms) == 0 {
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No VMs found.")
+			return nil
+		}
+		// Scripts expect "[]" (or no lines), never a human message.
+		vms = []*types.VM{}
+	}
+
+	showSize, _ := cmd.Flags().GetBool("size")
+	var (
+		data  any = vms
+		usage map[string]int64
+	)
+	if showSize {
+		if usage, err = diskUsage(ctx, hyper, vms...); err != nil {
+			return err
+		}
+		sized := make([]sizedVM, 0, len(vms))
+		for _, vm := range vms {
+			sized = append(sized, sizedVM{VM: vm, DiskUsage: usage[vm.ID]})
+		}
+		data = sized
+	}
+	return cmdcore.OutputFormatted(cmd, data, func(w *tabwriter.Writer) {
+		sizeCol := ""
+		if showSize {
+			sizeCol = "SIZE\t"
+		}
+		fmt.Fprintf(w, "ID\tNAME\tSTATE\tCPU\tMEMORY\tSTORAGE\t%sIP\tPORTS\tIMAGE\tCREATED\n", sizeCol) //nolint:errcheck
 		for _, vm := range vms {
-			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+			if showSize {
+				sizeCol = units.BytesSize(float64(usage[vm.ID])) + "\t"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s%s\t%s\t%s\t%s\n", //nolint:errcheck
 				vm.ID, vm.Config.Name, cmdcore.ReconcileState(vm),
 				vm.Config.CPU, units.BytesSize(float64(vm.Config.Memory)),
-				units.BytesSize(float64(vm.Config.Storage)),
-				vmIPs(vm), vm.Config.Image,
+				units.BytesSize(float64(vm.Config.Storage)), sizeCol,
+				vmIPs(vm), vmPorts(vm), vm.Config.Image,
 				vm.CreatedAt.Local().Format(time.DateTime))
 		}
 	})
@@ -281,7 +792,203 @@ func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return fmt.Errorf("inspect: %w", err)
 	}
-	return cmdcore.OutputJSON(info)
+	info = info.Redacted()
+	if showSize, _ := cmd.Flags().GetBool("size"); showSize {
+		usage, err := diskUsage(ctx, hyper, info)
+		if err != nil {
+			return err
+		}
+		return cmdcore.OutputInspect(cmd, sizedVM{VM: info, DiskUsage: usage[info.ID]})
+	}
+	return cmdcore.OutputInspect(cmd, info)
+}
+
+// sizedVM is a VM with the host space allocated to its root disk, as
+// "vm list --size" and "vm inspect --size" print it. The figure is
+// measured on request and never stored in the VM record.
+type sizedVM struct {
+	*types.VM
+	DiskUsage int64 `json:"disk_usage"`
+}
+
+// diskUsage measures the root disks of vms, by VM ID.
+func diskUsage(ctx context.Context, hyper hypervisor.Hypervisor, vms ...*types.VM) (map[string]int64, error) {
+	reporter, ok := hyper.(hypervisor.DiskUsageReporter)
+	if !ok {
+		return nil, fmt.Errorf("--size is not supported by %s", hyper.Type())
+	}
+	ids := make([]string, 0, len(vms))
+	for _, vm := range vms {
+		ids = append(ids, vm.ID)
+	}
+	usage, err := reporter.DiskUsage(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("disk usage: %w", err)
+	}
+	return usage, nil
+}
+
+// statsBaseline is how long a one-shot stats call waits between its two
+// samples so CPU% has a baseline.
+const statsBaseline = time.Second
+
+func (h Handler) Stats(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	stream, _ := cmd.Flags().GetBool("stream")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	prev, err := service.CollectStats(ctx, hyper, args)
+	if err != nil {
+		return err
+	}
+	wait := statsBaseline
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		cur, err := service.CollectStats(ctx, hyper, args)
+		if err != nil {
+			return err
+		}
+		if stream && cmdcore.IsTableFormat(cmd) {
+			fmt.Print("\033[H\033[2J") // clear screen
+		}
+		if err := printStats(cmd, cur, prev); err != nil {
+			return err
+		}
+		if !stream {
+			return nil
+		}
+		prev, wait = cur, interval
+	}
+}
+
+func printStats(cmd *cobra.Command, cur, prev map[string]*types.VMStats) error {
+	samples := slices.SortedFunc(maps.Values(cur), func(a, b *types.VMStats) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+	if nics, _ := cmd.Flags().GetBool("nics"); nics {
+		return cmdcore.OutputFormatted(cmd, samples, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ID\tNAME\tNIC\tDEVICE\tRX\tTX\tRX PKTS\tTX PKTS\tDROPPED RX/TX") //nolint:errcheck
+			for _, s := range samples {
+				for _, n := range s.NICs {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%d\t%d\t%d / %d\n", //nolint:errcheck
+						s.ID, s.Name, n.Index, n.Device,
+						units.BytesSize(float64(n.RxBytes)), units.BytesSize(float64(n.TxBytes)),
+						n.RxPackets, n.TxPackets, n.RxDropped, n.TxDropped)
+				}
+			}
+		})
+	}
+	return cmdcore.OutputFormatted(cmd, samples, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tCPU%\tCPU TIME\tMEM RSS\tMEM GUEST\tBLOCK R/W\tNET RX/TX") //nolint:errcheck
+		for _, s := range samples {
+			guest := "-"
+			if s.MemoryActual > 0 {
+				guest = units.BytesSize(float64(s.MemoryActual))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%s\t%s\t%s\t%s / %s\t%s / %s\n", //nolint:errcheck
+				s.ID, s.Name, s.CPUPercent(prev[s.ID]),
+				s.CPUTime.Round(time.Second), units.BytesSize(float64(s.MemoryRSS)), guest,
+				units.BytesSize(float64(s.BlockReadBytes)), units.BytesSize(float64(s.BlockWriteBytes)),
+				units.BytesSize(float64(s.NetRxBytes)), units.BytesSize(float64(s.NetTxBytes)))
+		}
+	})
+}
+
+func (h Handler) Logs(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	follow, _ := cmd.Flags().GetBool("follow")
+	since, _ := cmd.Flags().GetDuration("since")
+	source, _ := cmd.Flags().GetString("source")
+
+	path, err := hyper.LogFile(ctx, args[0], types.LogSource(source))
+	if err != nil {
+		return fmt.Errorf("logs: %w", err)
+	}
+	var offset int64
+	data, err := os.ReadFile(path) //nolint:gosec
+	switch {
+	case err == nil:
+		offset = int64(len(data))
+		if since > 0 {
+			fi, statErr := os.Stat(path)
+			if statErr != nil {
+				return statErr
+			}
+			data = cloudhypervisor.FilterLogSince(data, fi.ModTime(), time.Now().Add(-since))
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+	case os.IsNotExist(err):
+		if !follow {
+			return fmt.Errorf("no %s log for VM %s yet (never started, or not written with its settings?)", source, args[0])
+		}
+	default:
+		return fmt.Errorf("read %s: %w", path, err)
+	}
+	if !follow {
+		return nil
+	}
+	return utils.FollowFile(ctx, path, offset, os.Stdout)
+}
+
+// Credentials prints the random root password generated for a VM
+// (config random_root_password) and forgets it, so it is shown only once.
+func (h Handler) Credentials(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	password, err := hyper.TakeRootPassword(ctx, args[0])
+	if errors.Is(err, hypervisor.ErrNoRootPassword) {
+		return fmt.Errorf("VM %s has no root password to show: none was generated, or it was shown already", args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("credentials: %w", err)
+	}
+	fmt.Printf("root:%s\n", password)
+	return nil
+}
+
+// waitPollInterval is how often "vm wait" re-reads the VM record.
+const waitPollInterval = 500 * time.Millisecond
+
+func (h Handler) Wait(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	cond, _ := cmd.Flags().GetString("for")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		timeout = math.MaxInt64
+	}
+
+	var vm *types.VM
+	if err := utils.WaitFor(ctx, timeout, waitPollInterval, func() (bool, error) {
+		if vm, err = hyper.Inspect(ctx, args[0]); err != nil {
+			return false, err
+		}
+		return cmdcore.WaitConditionMet(vm, cond)
+	}); err != nil {
+		return fmt.Errorf("wait for %s: %w", cond, err)
+	}
+	if cond == cmdcore.WaitIP {
+		fmt.Println(vm.PrimaryIP())
+	}
+	return nil
 }
 
 func (h Handler) Console(cmd *cobra.Command, args []string) error {
@@ -289,15 +996,19 @@ func (h Handler) Console(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	ref := args[0]
+	escapeStr, _ := cmd.Flags().GetString("escape-char")
+	return attachConsole(ctx, hyper, args[0], escapeStr)
+}
 
+// attachConsole relays the terminal to the VM console in raw mode until the
+// escape sequence is typed or the console closes.
+func attachConsole(ctx context.Context, hyper hypervisor.Hypervisor, ref, escapeStr string) error {
 	conn, err := hyper.Console(ctx, ref)
 	if err != nil {
 		return fmt.Errorf("console: %w", err)
 	}
 	defer conn.Close() //nolint:errcheck
 
-	escapeStr, _ := cmd.Flags().GetString("escape-char")
 	escapeChar, err := console.ParseEscapeChar(escapeStr)
 	if err != nil {
 		return err
@@ -338,15 +1049,14 @@ func (h Handler) Console(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// RM deletes VMs. hyper.Delete uses best-effort semantics: it logs successfully
-// deleted VMs in the returned slice even when later deletions fail, so we always
-// report the partial results before checking the error.
+// RM deletes VMs. Deletion is best-effort: successfully deleted VMs are
+// reported even when later deletions fail.
 func (h Handler) RM(cmd *cobra.Command, args []string) error {
 	ctx, conf, err := h.Init(cmd)
 	if err != nil {
 		return err
 	}
-	hyper, err := cmdcore.InitHypervisor(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return err
 	}
@@ -354,27 +1064,50 @@ func (h Handler) RM(cmd *cobra.Command, args []string) error {
 
 	force, _ := cmd.Flags().GetBool("force")
 
-	deleted, deleteErr := hyper.Delete(ctx, args, force)
+	deleted, err := service.DeleteVMs(ctx, conf, hyper, args, force)
 	for _, id := range deleted {
 		logger.Infof(ctx, "deleted VM: %s", id)
 	}
+	if err != nil {
+		return fmt.Errorf("rm: %w", err)
+	}
+	if len(deleted) == 0 {
+		logger.Info(ctx, "no VMs deleted")
+	}
+	return nil
+}
 
-	// Clean up network resources for successfully deleted VMs first,
-	// even if hyper.Delete returned a partial error.
-	if len(deleted) > 0 {
-		if netProvider, initErr := cmdcore.InitNetwork(conf); initErr == nil {
-			if _, delErr := netProvider.Delete(ctx, deleted); delErr != nil {
-				return fmt.Errorf("VM(s) deleted but network cleanup failed: %w", delErr)
-			}
-		}
+func (h Handler) Rename(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	if err := hyper.Rename(ctx, args[0], args[1]); err != nil {
+		return fmt.Errorf("rename: %w", err)
 	}
+	log.WithFunc("cmd.rename").Infof(ctx, "renamed %s to %s", args[0], args[1])
+	return nil
+}
 
-	if deleteErr != nil {
-		return fmt.Errorf("rm: %w", deleteErr)
+func (h Handler) Update(cmd *cobra.Command, args []string) error {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
 	}
-	if len(deleted) == 0 {
-		logger.Info(ctx, "no VMs deleted")
+	vm, err := hyper.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("inspect VM: %w", err)
+	}
+	vmCfg, err := cmdcore.UpdateVMConfigFromFlags(cmd, vm)
+	if err != nil {
+		return err
+	}
+	updated, err := hyper.Update(ctx, vm.ID, vmCfg)
+	if err != nil {
+		return fmt.Errorf("update: %w", err)
 	}
+	log.WithFunc("cmd.update").Infof(ctx, "VM %s updated: cpu=%d memory=%s storage=%s (applied on next start)",
+		updated.ID, updated.Config.CPU, cmdcore.FormatSize(updated.Config.Memory), cmdcore.FormatSize(updated.Config.Storage))
 	return nil
 }
 
@@ -385,11 +1118,14 @@ func (h Handler) Restore(cmd *cobra.Command, args []string) error {
 	}
 	logger := log.WithFunc("cmd.restore")
 
-	hyper, err := cmdcore.InitHypervisor(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return err
 	}
-	snapBackend, err := cmdcore.InitSnapshot(conf)
+	if len(args) == 1 {
+		return h.restoreBackup(ctx, cmd, conf, hyper, args[0], logger)
+	}
+	snapBackend, err := service.InitSnapshot(conf)
 	if err != nil {
 		return err
 	}
@@ -451,12 +1187,115 @@ func (h Handler) Restore(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// restoreBackup creates a VM from the backup archive at path. The VM gets a
+// new ID and fresh NICs; like a clone, it leaves the published ports, fixed
+// IP, pinned MACs and volumes to the backed-up VM. It keeps the backed-up
+// resources, so --cpu, --memory and --storage are rejected.
+func (h Handler) restoreBackup(ctx context.Context, cmd *cobra.Command, conf *config.Config, hyper hypervisor.Hypervisor, path string, logger *log.Fields) error {
+	backuper, ok := hyper.(hypervisor.Backuper)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot restore backups", hyper.Type())
+	}
+	for _, name := range []string{"cpu", "memory", "storage"} {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%s applies to snapshot restores; a VM from a backup keeps the backed-up resources", name)
+		}
+	}
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("open backup: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+	r, err := utils.DecompressReader(f)
+	if err != nil {
+		return fmt.Errorf("decompress backup: %w", err)
+	}
+	defer r.Close() //nolint:errcheck
+	tr := tar.NewReader(r)
+	m, err := hypervisor.ReadBackupManifest(tr)
+	if err != nil {
+		return err
+	}
+
+	vmCfg := m.Record.Config
+	if name, _ := cmd.Flags().GetString("name"); name != "" {
+		vmCfg.Name = name
+	}
+	vmCfg.IP, vmCfg.MACs, vmCfg.Publish, vmCfg.Volumes = "", nil, nil, nil
+	vmCfg.DataDir, vmCfg.Pool = "", "" // the backed-up --data-dir may not exist on this host
+	if err = vmCfg.Validate(); err != nil {
+		return err
+	}
+	vmID, err := utils.GenerateID()
+	if err != nil {
+		return fmt.Errorf("generate VM ID: %w", err)
+	}
+	netProvider, networkConfigs, err := service.InitVMNetwork(ctx, conf, vmID, len(m.Record.NetworkConfigs), &vmCfg)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof(ctx, "restoring VM %s from backup %s ...", m.Record.Config.Name, path)
+	vm, err := backuper.RestoreBackup(ctx, vmID, &vmCfg, networkConfigs, m, tr)
+	if err != nil {
+		service.RollbackNetwork(ctx, netProvider, vmID)
+		return fmt.Errorf("restore backup: %w", err)
+	}
+	logger.Infof(ctx, "VM restored: %s (name: %s, state: %s)", vm.ID, vm.Config.Name, vm.State)
+	logger.Infof(ctx, "start with: cocoon vm start %s", vm.ID)
+	return nil
+}
+
+func (h Handler) Backup(cmd *cobra.Command, args []string) (err error) {
+	ctx, hyper, err := h.initHyper(cmd)
+	if err != nil {
+		return err
+	}
+	backuper, ok := hyper.(hypervisor.Backuper)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot back up VMs", hyper.Type())
+	}
+	output, _ := cmd.Flags().GetString("output")
+
+	// Write beside the target and rename on success, so a failed backup
+	// never leaves a truncated archive under the requested name.
+	tmp := output + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create %s: %w", tmp, err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()      //nolint:errcheck,gosec
+			os.Remove(tmp) //nolint:errcheck,gosec
+		}
+	}()
+	w, err := utils.CompressWriter(f, output)
+	if err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	if err = backuper.Backup(ctx, args[0], w); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("compress: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", tmp, err)
+	}
+	if err = os.Rename(tmp, output); err != nil {
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+	log.WithFunc("cmd.backup").Infof(ctx, "VM %s backed up to %s", args[0], output)
+	return nil
+}
+
 func (h Handler) Debug(cmd *cobra.Command, args []string) error {
 	ctx, conf, err := h.Init(cmd)
 	if err != nil {
 		return err
 	}
-	backends, err := cmdcore.InitImageBackends(ctx, conf)
+	backends, err := service.InitImageBackends(ctx, conf)
 	if err != nil {
 		return err
 	}
@@ -466,12 +1305,12 @@ func (h Handler) Debug(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	maxCPU, _ := cmd.Flags().GetInt("max-cpu")
+	maxCPU := cmp.Or(vmCfg.MaxCPU, runtime.NumCPU())
 	balloon, _ := cmd.Flags().GetInt("balloon")
 	cowPath, _ := cmd.Flags().GetString("cow")
 	chBin, _ := cmd.Flags().GetString("ch")
 
-	storageConfigs, boot, err := cmdcore.ResolveImage(ctx, backends, vmCfg)
+	storageConfigs, boot, err := service.ResolveImage(ctx, backends, vmCfg)
 	if err != nil {
 		return err
 	}
@@ -496,7 +1335,7 @@ func (h Handler) initHyper(cmd *cobra.Command) (context.Context, hypervisor.Hype
 	if err != nil {
 		return nil, nil, err
 	}
-	hyper, err := cmdcore.InitHypervisor(conf)
+	hyper, err := service.InitHypervisor(conf)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -509,67 +1348,21 @@ func (h Handler) createVM(cmd *cobra.Command, image string) (context.Context, *t
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	backends, hyper, err := cmdcore.InitBackends(ctx, conf)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-
 	vmCfg, err := cmdcore.VMConfigFromFlags(cmd, image)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-
-	storageConfigs, bootCfg, err := cmdcore.ResolveImage(ctx, backends, vmCfg)
+	nics, err := cmdcore.NICCount(cmd, conf, vmCfg)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	cmdcore.EnsureFirmwarePath(conf, bootCfg)
-
-	vmID, err := utils.GenerateID()
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("generate VM ID: %w", err)
-	}
-
-	nics, _ := cmd.Flags().GetInt("nics")
-	netProvider, networkConfigs, err := initNetwork(ctx, conf, vmID, nics, vmCfg)
+	info, hyper, err := service.CreateVM(ctx, conf, vmCfg, nics)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-
-	info, createErr := hyper.Create(ctx, vmID, vmCfg, storageConfigs, networkConfigs, bootCfg)
-	if createErr != nil {
-		rollbackNetwork(ctx, netProvider, vmID)
-		return nil, nil, nil, fmt.Errorf("create VM: %w", createErr)
-	}
 	return ctx, info, hyper, nil
 }
 
-// initNetwork sets up network for a new VM. Returns nil provider and configs when nics == 0.
-func initNetwork(ctx context.Context, conf *config.Config, vmID string, nics int, vmCfg *types.VMConfig) (network.Network, []*types.NetworkConfig, error) {
-	if nics <= 0 {
-		return nil, nil, nil
-	}
-	netProvider, err := cmdcore.InitNetwork(conf)
-	if err != nil {
-		return nil, nil, fmt.Errorf("init network: %w", err)
-	}
-	configs, err := netProvider.Config(ctx, vmID, nics, vmCfg)
-	if err != nil {
-		return nil, nil, fmt.Errorf("configure network: %w", err)
-	}
-	return netProvider, configs, nil
-}
-
-// rollbackNetwork cleans up network resources on VM creation/clone failure.
-func rollbackNetwork(ctx context.Context, netProvider network.Network, vmID string) {
-	if netProvider == nil {
-		return
-	}
-	if _, delErr := netProvider.Delete(ctx, []string{vmID}); delErr != nil {
-		log.WithFunc("cmd.rollbackNetwork").Warnf(ctx, "rollback network for %s: %v", vmID, delErr)
-	}
-}
-
 func batchVMCmd(ctx context.Context, name, pastTense string, fn func(context.Context, []string) ([]string, error), refs []string) error {
 	logger := log.WithFunc("cmd." + name)
 	done, err := fn(ctx, refs)
@@ -767,8 +1560,8 @@ func printRunCloudimg(configs []*types.StorageConfig, boot *types.BootConfig, vm
 func vmIPs(vm *types.VM) string {
 	var ips []string
 	for _, nc := range vm.NetworkConfigs {
-		if nc != nil && nc.Network != nil && nc.Network.IP != "" {
-			ips = append(ips, nc.Network.IP)
+		if nc != nil && nc.IP() != "" {
+			ips = append(ips, nc.IP())
 		}
 	}
 	if len(ips) == 0 {
@@ -777,6 +1570,17 @@ func vmIPs(vm *types.VM) string {
 	return strings.Join(ips, ",")
 }
 
+func vmPorts(vm *types.VM) string {
+	if len(vm.Config.Publish) == 0 {
+		return "-"
+	}
+	ports := make([]string, len(vm.Config.Publish))
+	for i, m := range vm.Config.Publish {
+		ports[i] = m.String()
+	}
+	return strings.Join(ports, ",")
+}
+
 // printCommonCHArgs outputs CH args for manual debugging.
 // --serial tty outputs to the current terminal for interactive debugging,
 // which intentionally differs from the automated path (Console: Pty / Serial: Socket).
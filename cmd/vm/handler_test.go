@@ -0,0 +1,114 @@
+package vm
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestInheritCloneConfig(t *testing.T) {
+	src := &types.VM{Config: types.VMConfig{
+		CPU: 2, Memory: 1 << 30,
+		Autostart:     true,
+		BootProbe:     &types.BootProbe{TimeoutSeconds: 60, Pattern: "ready"},
+		RestartPolicy: types.RestartPolicyAlways,
+		CPUSet:        "2-3",
+		IP:            "10.0.0.5",
+		Publish:       []types.PortMapping{{HostPort: 8080, GuestPort: 80}},
+		MACs:          []string{"02:00:00:00:00:01"},
+		Volumes:       []types.VolumeAttachment{{Name: "data"}},
+	}}
+	tests := []struct {
+		name       string
+		shared     bool
+		wantCPUSet string
+	}{
+		{name: "exclusive pin stays with the source", wantCPUSet: ""},
+		{name: "shared pin is kept", shared: true, wantCPUSet: "2-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := *src
+			s.Config.CPUSetShared = tt.shared
+			vmCfg := &types.VMConfig{CPU: 2, Memory: 1 << 30}
+			if err := inheritCloneConfig(&s, vmCfg); err != nil {
+				t.Fatal(err)
+			}
+			if !vmCfg.Autostart || vmCfg.RestartPolicy != types.RestartPolicyAlways {
+				t.Errorf("autostart %v, restart %q: not kept", vmCfg.Autostart, vmCfg.RestartPolicy)
+			}
+			if vmCfg.BootProbe == nil || *vmCfg.BootProbe != *src.Config.BootProbe {
+				t.Errorf("boot probe = %+v, want %+v", vmCfg.BootProbe, src.Config.BootProbe)
+			} else if vmCfg.BootProbe == src.Config.BootProbe {
+				t.Error("boot probe shared with the source")
+			}
+			if vmCfg.CPUSet != tt.wantCPUSet || vmCfg.CPUSetShared != tt.shared {
+				t.Errorf("cpuset %q shared %v, want %q shared %v", vmCfg.CPUSet, vmCfg.CPUSetShared, tt.wantCPUSet, tt.shared)
+			}
+			if vmCfg.IP != "" || vmCfg.Publish != nil || vmCfg.MACs != nil || vmCfg.Volumes != nil {
+				t.Errorf("IP %q, ports %v, MACs %v, volumes %v: copied from the source", vmCfg.IP, vmCfg.Publish, vmCfg.MACs, vmCfg.Volumes)
+			}
+		})
+	}
+
+	src.Config.MaxCPU = 2
+	if err := inheritCloneConfig(src, &types.VMConfig{CPU: 4}); err == nil {
+		t.Error("--cpu above the source's max CPUs accepted")
+	}
+}
+
+type fakeHyper struct {
+	hypervisor.Hypervisor
+	vms     []*types.VM
+	stopped []string
+}
+
+func (f *fakeHyper) List(context.Context) ([]*types.VM, error) { return f.vms, nil }
+
+func (f *fakeHyper) Stop(_ context.Context, ids []string) ([]string, error) {
+	f.stopped = append(f.stopped, ids...)
+	return ids, nil
+}
+
+func TestAutostartRefs(t *testing.T) {
+	tests := []struct {
+		name      string
+		state     types.VMState
+		pid       int
+		autostart bool
+		wantStart bool
+		wantStop  bool
+	}{
+		{name: "running", state: types.VMStateRunning, pid: os.Getpid(), autostart: true},
+		{name: "running stale", state: types.VMStateRunning, autostart: true, wantStart: true, wantStop: true},
+		{name: "stopped", state: types.VMStateStopped, autostart: true, wantStart: true},
+		{name: "error", state: types.VMStateError, autostart: true, wantStart: true},
+		{name: "suspended", state: types.VMStateSuspended, autostart: true},
+		{name: "running without autostart", state: types.VMStateRunning, pid: os.Getpid()},
+		{name: "running stale without autostart", state: types.VMStateRunning},
+		{name: "stopped without autostart", state: types.VMStateStopped},
+		{name: "error without autostart", state: types.VMStateError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hyper := &fakeHyper{vms: []*types.VM{{
+				ID: "vm", State: tt.state, PID: tt.pid,
+				Config: types.VMConfig{Autostart: tt.autostart},
+			}}}
+			refs, err := autostartRefs(t.Context(), hyper)
+			if err != nil {
+				t.Fatalf("autostartRefs: %v", err)
+			}
+			if got := slices.Contains(refs, "vm"); got != tt.wantStart {
+				t.Errorf("started = %v, want %v", got, tt.wantStart)
+			}
+			if got := slices.Contains(hyper.stopped, "vm"); got != tt.wantStop {
+				t.Errorf("stale cleanup = %v, want %v", got, tt.wantStop)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package volume
+
+import (
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+)
+
+// Actions defines volume management operations.
+type Actions interface {
+	Create(cmd *cobra.Command, args []string) error
+	List(cmd *cobra.Command, args []string) error
+	Inspect(cmd *cobra.Command, args []string) error
+	RM(cmd *cobra.Command, args []string) error
+	Attach(cmd *cobra.Command, args []string) error
+	Detach(cmd *cobra.Command, args []string) error
+}
+
+// Command builds the "volume" parent command with all subcommands.
+func Command(h Actions) *cobra.Command {
+	volumeCmd := &cobra.Command{
+		Use:   "volume",
+		Short: "Manage volumes (disks that outlive VMs)",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create [flags] NAME",
+		Short: "Create a volume",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Create,
+	}
+	createCmd.Flags().String("size", "10G", "volume size") //nolint:mnd
+	createCmd.Flags().String("fs", "", `format the volume: "ext4" or "xfs" (empty = leave blank)`)
+
+	listCmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List all volumes",
+		RunE:    h.List,
+	}
+	cmdcore.AddFormatFlag(listCmd)
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect VOLUME",
+		Short: "Show detailed volume info (JSON)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Inspect,
+	}
+	cmdcore.AddInspectFormatFlag(inspectCmd)
+
+	rmCmd := &cobra.Command{
+		Use:   "rm VOLUME [VOLUME...]",
+		Short: "Delete volume(s) not attached to a VM",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  h.RM,
+	}
+
+	attachCmd := &cobra.Command{
+		Use:   "attach [flags] VOLUME VM",
+		Short: "Attach a volume to a VM, hot-plugging it when the VM is running",
+		Args:  cobra.ExactArgs(2), //nolint:mnd
+		RunE:  h.Attach,
+	}
+	attachCmd.Flags().String("target", "", "guest device the volume must appear as, e.g. /dev/vdc (empty = next free)")
+
+	detachCmd := &cobra.Command{
+		Use:   "detach VOLUME",
+		Short: "Detach a volume from its VM, hot-unplugging it when the VM is running",
+		Args:  cobra.ExactArgs(1),
+		RunE:  h.Detach,
+	}
+
+	volumeCmd.AddCommand(createCmd, listCmd, inspectCmd, rmCmd, attachCmd, detachCmd)
+	return volumeCmd
+}
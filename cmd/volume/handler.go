@@ -0,0 +1,259 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/projecteru2/core/log"
+	"github.com/spf13/cobra"
+
+	cmdcore "github.com/projecteru2/cocoon/cmd/core"
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Handler implements Actions.
+type Handler struct {
+	cmdcore.BaseHandler
+}
+
+func (h Handler) Create(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	sizeStr, _ := cmd.Flags().GetString("size")
+	fs, _ := cmd.Flags().GetString("fs")
+	size, err := units.RAMInBytes(sizeStr)
+	if err != nil {
+		return fmt.Errorf("invalid --size %q: %w", sizeStr, err)
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+
+	vol, err := volumes.Create(ctx, args[0], size, fs)
+	if err != nil {
+		return fmt.Errorf("create volume: %w", err)
+	}
+	log.WithFunc("cmd.volume.create").Infof(ctx, "volume created: %s (name: %s)", vol.ID, vol.Name)
+	return nil
+}
+
+func (h Handler) List(cmd *cobra.Command, _ []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+
+	vols, err := volumes.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if len(vols) == 0 {
+		if cmdcore.IsTableFormat(cmd) {
+			fmt.Println("No volumes found.")
+			return nil
+		}
+		vols = []*types.Volume{}
+	}
+
+	slices.SortFunc(vols, func(a, b *types.Volume) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	liveTargets(ctx, conf, vols)
+
+	return cmdcore.OutputFormatted(cmd, vols, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tSIZE\tFS\tVM\tTARGET\tCREATED") //nolint:errcheck
+		for _, v := range vols {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck
+				v.ID, v.Name, cmdcore.FormatSize(v.Size),
+				orDash(v.FS), orDash(v.VMID), orDash(v.Target),
+				v.CreatedAt.Local().Format(time.DateTime))
+		}
+	})
+}
+
+func (h Handler) Inspect(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+
+	v, err := volumes.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+	liveTargets(ctx, conf, []*types.Volume{v})
+	return cmdcore.OutputInspect(cmd, v)
+}
+
+func (h Handler) RM(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	logger := log.WithFunc("cmd.volume.rm")
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := volumes.Delete(ctx, args)
+	for _, id := range deleted {
+		logger.Infof(ctx, "deleted: %s", id)
+	}
+	if err != nil {
+		return fmt.Errorf("rm: %w", err)
+	}
+	if len(deleted) == 0 {
+		logger.Info(ctx, "no volumes deleted")
+	}
+	return nil
+}
+
+func (h Handler) Attach(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	volRef, vmRef := args[0], args[1]
+	target, _ := cmd.Flags().GetString("target")
+	if err = types.ValidateVolumeTarget(target); err != nil {
+		return fmt.Errorf("--target: %w", err)
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	attacher, ok := hyper.(hypervisor.VolumeAttacher)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot attach volumes to existing VMs; use --volume at create", hyper.Type())
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+	vm, err := hyper.Inspect(ctx, vmRef)
+	if err != nil {
+		return fmt.Errorf("inspect VM %s: %w", vmRef, err)
+	}
+
+	// Reserve the volume first: it is what keeps two VMs from taking it.
+	disks, err := volumes.Attach(ctx, vm.ID, []types.VolumeAttachment{{Name: volRef, Target: target}})
+	if err != nil {
+		return fmt.Errorf("attach: %w", err)
+	}
+	disk := disks[0]
+	info, err := attacher.AttachVolume(ctx, vm.ID, disk)
+	if err != nil {
+		if relErr := volumes.Detach(context.WithoutCancel(ctx), disk.Volume, vm.ID); relErr != nil {
+			log.WithFunc("cmd.volume.attach").Warnf(ctx, "release volume %s: %v", disk.Volume, relErr)
+		}
+		return fmt.Errorf("attach: %w", err)
+	}
+	if err = volumes.Attached(ctx, vm.ID, info.StorageConfigs); err != nil {
+		return fmt.Errorf("record attachment: %w", err)
+	}
+	for _, sc := range info.StorageConfigs {
+		if sc.Volume == disk.Volume {
+			log.WithFunc("cmd.volume.attach").Infof(ctx, "volume %s attached to VM %s as %s", volRef, vm.ID, sc.Target)
+		}
+	}
+	return nil
+}
+
+func (h Handler) Detach(cmd *cobra.Command, args []string) error {
+	ctx, conf, err := h.Init(cmd)
+	if err != nil {
+		return err
+	}
+	volumes, err := service.InitVolumes(conf)
+	if err != nil {
+		return err
+	}
+	vol, err := volumes.Inspect(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("inspect: %w", err)
+	}
+	if vol.VMID == "" {
+		return fmt.Errorf("volume %s is not attached", args[0])
+	}
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return err
+	}
+	attacher, ok := hyper.(hypervisor.VolumeAttacher)
+	if !ok {
+		return fmt.Errorf("the %s backend cannot detach volumes from existing VMs; delete the VM instead", hyper.Type())
+	}
+
+	info, err := attacher.DetachVolume(ctx, vol.VMID, vol.ID)
+	switch {
+	case errors.Is(err, hypervisor.ErrNotFound):
+		// The VM is gone; only the volume index still holds it.
+	case err != nil:
+		return fmt.Errorf("detach: %w", err)
+	}
+	if err = volumes.Detach(ctx, vol.ID, vol.VMID); err != nil {
+		return fmt.Errorf("record detachment: %w", err)
+	}
+	if info != nil {
+		// Detaching from a stopped VM renumbers the volumes after it.
+		if err = volumes.Attached(ctx, vol.VMID, info.StorageConfigs); err != nil {
+			return fmt.Errorf("record attachment: %w", err)
+		}
+	}
+	log.WithFunc("cmd.volume.detach").Infof(ctx, "volume %s detached from VM %s", args[0], vol.VMID)
+	return nil
+}
+
+// liveTargets takes each attached volume's Target from its VM record,
+// which tracks the renaming a cold boot does after hot-plugging; the
+// volume index keeps the name the volume got when attached.
+func liveTargets(ctx context.Context, conf *config.Config, vols []*types.Volume) {
+	hyper, err := service.InitHypervisor(conf)
+	if err != nil {
+		return
+	}
+	vms := map[string]*types.VM{}
+	for _, v := range vols {
+		if v.VMID == "" {
+			continue
+		}
+		vm, ok := vms[v.VMID]
+		if !ok {
+			vm, _ = hyper.Inspect(ctx, v.VMID)
+			vms[v.VMID] = vm
+		}
+		if vm == nil {
+			continue
+		}
+		for _, sc := range vm.StorageConfigs {
+			if sc.Volume == v.ID {
+				v.Target = sc.Target
+			}
+		}
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
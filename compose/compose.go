@@ -0,0 +1,310 @@
+// Package compose reads multi-VM manifests: the VMs of a project, the
+// "vm create" settings of each, the order they come up in, and the volumes
+// they share. The "compose" commands apply a manifest; VMs belong to their
+// project through labels, so no state is kept besides the VM records.
+package compose
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// DefaultFile is the manifest the "compose" commands read without --file.
+const DefaultFile = "cocoon-compose.yaml"
+
+// Labels a VM of a project carries. SpecLabel is a digest of the settings
+// the VM was created with, so "compose up" can tell it is out of date.
+const (
+	ProjectLabel = "cocoon.compose.project"
+	VMLabel      = "cocoon.compose.vm"
+	SpecLabel    = "cocoon.compose.spec"
+)
+
+// defaultVolumeSize matches "volume create".
+const defaultVolumeSize = "10G"
+
+// Manifest is a cocoon-compose.yaml file.
+type Manifest struct {
+	// Name is the project; empty = the manifest directory's name. VM and
+	// volume names are prefixed with it.
+	Name    string                 `yaml:"name"`
+	Volumes map[string]*VolumeSpec `yaml:"volumes"`
+	VMs     map[string]*VMSpec     `yaml:"vms"`
+
+	dir string // relative paths in the manifest resolve against it
+}
+
+// VolumeSpec is a volume created by "compose up" if missing.
+type VolumeSpec struct {
+	Size string `yaml:"size"` // empty = 10G
+	FS   string `yaml:"fs"`   // "ext4" or "xfs"; empty = leave blank
+}
+
+// VMSpec describes one VM with the settings of its "vm create" flags.
+// Empty fields keep the flag defaults.
+type VMSpec struct {
+	Image       string            `yaml:"image"`
+	Name        string            `yaml:"name"` // empty = <project>-<key>
+	CPU         int               `yaml:"cpu"`
+	Memory      string            `yaml:"memory"`
+	Storage     string            `yaml:"storage"`
+	Networks    []string          `yaml:"networks"`
+	IP          string            `yaml:"ip"`
+	Volumes     []string          `yaml:"volumes"` // "NAME[:/dev/vdX]"; NAME is a manifest volume or an existing one
+	Publish     []string          `yaml:"publish"`
+	Hostname    string            `yaml:"hostname"`
+	SSHKeys     []string          `yaml:"ssh_keys"`
+	UserData    string            `yaml:"user_data"` // file path
+	Env         []string          `yaml:"env"`
+	RunCmds     []string          `yaml:"run_cmds"`
+	Restart     string            `yaml:"restart"`
+	Autostart   bool              `yaml:"autostart"`
+	HealthCheck string            `yaml:"health_check"`
+	Labels      map[string]string `yaml:"labels"`
+	DependsOn   []string          `yaml:"depends_on"`
+}
+
+// Flag is one "vm create" flag setting.
+type Flag struct {
+	Name  string
+	Value string
+}
+
+// Load reads and validates the manifest at path. A non-empty project
+// overrides its name.
+func Load(path, project string) (*Manifest, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(data, filepath.Dir(abs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if project != "" {
+		m.Name = project
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Parse decodes a manifest whose relative paths resolve against dir.
+// Unknown keys are errors, so a typo does not silently drop a setting.
+func Parse(data []byte, dir string) (*Manifest, error) {
+	m := &Manifest{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	m.dir = dir
+	if m.Name == "" {
+		m.Name = filepath.Base(dir)
+	}
+	return m, nil
+}
+
+// Validate checks the manifest without touching any VM.
+func (m *Manifest) Validate() error {
+	if types.ValidateVMName(m.Name) != nil {
+		return fmt.Errorf("project name %q is invalid: letters, digits, '.', '_' and '-', starting with a letter or digit", m.Name)
+	}
+	if len(m.VMs) == 0 {
+		return errors.New("no VMs defined")
+	}
+	for key, vol := range m.Volumes {
+		if vol == nil { // "name:" alone takes the defaults
+			vol = &VolumeSpec{}
+			m.Volumes[key] = vol
+		}
+		if err := types.ValidateVolumeName(m.VolumeName(key)); err != nil {
+			return fmt.Errorf("volumes.%s: %w", key, err)
+		}
+		if vol.Size != "" {
+			if _, err := units.RAMInBytes(vol.Size); err != nil {
+				return fmt.Errorf("volumes.%s: invalid size %q: %w", key, vol.Size, err)
+			}
+		}
+	}
+	names := map[string]string{} // VM name → key
+	for _, key := range slices.Sorted(maps.Keys(m.VMs)) {
+		vm := m.VMs[key]
+		if vm == nil {
+			return fmt.Errorf("vms.%s: no settings", key)
+		}
+		name := m.VMName(key)
+		if err := types.ValidateVMName(name); err != nil {
+			return fmt.Errorf("vms.%s: %w", key, err)
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("vms.%s: VM name %q is taken by vms.%s", key, name, other)
+		}
+		names[name] = key
+		if vm.Image == "" {
+			return fmt.Errorf("vms.%s: image is required", key)
+		}
+		for _, dep := range vm.DependsOn {
+			if _, ok := m.VMs[dep]; !ok || dep == key {
+				return fmt.Errorf("vms.%s: depends_on %q is not another VM of the manifest", key, dep)
+			}
+		}
+	}
+	_, err := m.Order()
+	return err
+}
+
+// Order returns the VM keys in the order they come up: every VM after the
+// ones it depends on, otherwise alphabetical. Reversed, it is the order
+// they go down in.
+func (m *Manifest) Order() ([]string, error) {
+	var (
+		order []string
+		done  = map[string]bool{}
+	)
+	keys := slices.Sorted(maps.Keys(m.VMs))
+	for len(order) < len(keys) {
+		progress := false
+		for _, key := range keys {
+			if done[key] || !allDone(m.VMs[key].DependsOn, done) {
+				continue
+			}
+			order = append(order, key)
+			done[key] = true
+			progress = true
+			break // restart, so ready VMs stay in alphabetical order
+		}
+		if !progress {
+			var cycle []string
+			for _, key := range keys {
+				if !done[key] {
+					cycle = append(cycle, key)
+				}
+			}
+			return nil, fmt.Errorf("depends_on cycle among %s", strings.Join(cycle, ", "))
+		}
+	}
+	return order, nil
+}
+
+func allDone(keys []string, done map[string]bool) bool {
+	for _, k := range keys {
+		if !done[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// VMName returns the name of the VM at key.
+func (m *Manifest) VMName(key string) string {
+	if vm := m.VMs[key]; vm != nil && vm.Name != "" {
+		return vm.Name
+	}
+	return m.Name + "-" + key
+}
+
+// VolumeName returns the name of the manifest volume at key.
+func (m *Manifest) VolumeName(key string) string {
+	return m.Name + "-" + key
+}
+
+// CreateFlags returns the "vm create" flags of the VM at key, including
+// the labels that tie it to the project.
+func (m *Manifest) CreateFlags(key string) []Flag {
+	vm := m.VMs[key]
+	var flags []Flag
+	add := func(name string, values ...string) {
+		for _, v := range values {
+			if v != "" {
+				flags = append(flags, Flag{Name: name, Value: v})
+			}
+		}
+	}
+	add("name", m.VMName(key))
+	if vm.CPU > 0 {
+		add("cpu", strconv.Itoa(vm.CPU))
+	}
+	add("memory", vm.Memory)
+	add("storage", vm.Storage)
+	add("network", vm.Networks...)
+	add("ip", vm.IP)
+	for _, spec := range vm.Volumes {
+		name, target, ok := strings.Cut(spec, ":")
+		if _, declared := m.Volumes[name]; declared {
+			name = m.VolumeName(name)
+		}
+		if ok {
+			name += ":" + target
+		}
+		add("volume", name)
+	}
+	add("publish", vm.Publish...)
+	add("hostname", vm.Hostname)
+	for _, key := range vm.SSHKeys {
+		if !strings.ContainsAny(strings.TrimSpace(key), " \t") { // a file, not a key
+			key = m.path(key)
+		}
+		add("ssh-key", key)
+	}
+	add("user-data", m.path(vm.UserData))
+	add("env", vm.Env...)
+	add("run-cmd", vm.RunCmds...)
+	add("restart", vm.Restart)
+	if vm.Autostart {
+		add("autostart", "true")
+	}
+	add("health-check", vm.HealthCheck)
+	for _, k := range slices.Sorted(maps.Keys(vm.Labels)) {
+		add("label", k+"="+vm.Labels[k])
+	}
+	add("label", ProjectLabel+"="+m.Name, VMLabel+"="+key)
+	return flags
+}
+
+// path resolves a manifest path against the manifest directory.
+func (m *Manifest) path(p string) string {
+	if p == "" || p == "-" || filepath.IsAbs(p) || strings.HasPrefix(p, "~/") {
+		return p
+	}
+	return filepath.Join(m.dir, p)
+}
+
+// VolumeSize returns the size in bytes of the manifest volume at key.
+func (m *Manifest) VolumeSize(key string) (int64, error) {
+	size := m.Volumes[key].Size
+	if size == "" {
+		size = defaultVolumeSize
+	}
+	return units.RAMInBytes(size)
+}
+
+// Digest returns a short digest of vmCfg, the value of SpecLabel.
+func Digest(vmCfg *types.VMConfig) (string, error) {
+	data, err := json.Marshal(vmCfg)
+	if err != nil {
+		return "", fmt.Errorf("digest VM config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6]), nil //nolint:mnd
+}
@@ -0,0 +1,126 @@
+package compose
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testManifest = `
+name: shop
+volumes:
+  pgdata:
+    size: 20G
+    fs: ext4
+  cache:
+vms:
+  web:
+    image: ubuntu:24.04
+    cpu: 2
+    memory: 1G
+    networks: [front, back]
+    publish: ["8080:80"]
+    user_data: web.yaml
+    ssh_keys: [keys.pub, "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl me"]
+    labels: {tier: front}
+    depends_on: [api]
+  api:
+    image: ubuntu:24.04
+    volumes: [cache, shared:/dev/vdc]
+    depends_on: [db]
+  db:
+    image: ubuntu:24.04
+    name: shop-postgres
+    volumes: [pgdata]
+  adminer:
+    image: ubuntu:24.04
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testManifest), "/srv/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	order, err := m.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"adminer", "db", "api", "web"}; !slices.Equal(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if got := m.VMName("db"); got != "shop-postgres" {
+		t.Errorf("VMName(db) = %s", got)
+	}
+	if size, err := m.VolumeSize("cache"); err != nil || size != 10<<30 {
+		t.Errorf("VolumeSize(cache) = %d, %v", size, err)
+	}
+
+	flags := func(key string) []string {
+		var out []string
+		for _, f := range m.CreateFlags(key) {
+			out = append(out, f.Name+"="+f.Value)
+		}
+		return out
+	}
+	want := []string{
+		"name=shop-web", "cpu=2", "memory=1G", "network=front", "network=back",
+		"publish=8080:80",
+		"ssh-key=/srv/shop/keys.pub",
+		"ssh-key=ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl me",
+		"user-data=/srv/shop/web.yaml",
+		"label=tier=front", "label=cocoon.compose.project=shop", "label=cocoon.compose.vm=web",
+	}
+	if got := flags("web"); !slices.Equal(got, want) {
+		t.Errorf("web flags:\n got %v\nwant %v", got, want)
+	}
+	// Manifest volumes get the project prefix, others are used as named.
+	want = []string{
+		"name=shop-api", "volume=shop-cache", "volume=shared:/dev/vdc",
+		"label=cocoon.compose.project=shop", "label=cocoon.compose.vm=api",
+	}
+	if got := flags("api"); !slices.Equal(got, want) {
+		t.Errorf("api flags:\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestParse_DefaultName(t *testing.T) {
+	m, err := Parse([]byte("vms:\n  a:\n    image: x\n"), "/srv/my-app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "my-app" || m.VMName("a") != "my-app-a" {
+		t.Errorf("name = %s, VM name = %s", m.Name, m.VMName("a"))
+	}
+}
+
+func TestValidate_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"unknown key", "vms:\n  a:\n    image: x\n    cpus: 2\n", "field cpus not found"},
+		{"no VMs", "name: p\n", "no VMs"},
+		{"no image", "vms:\n  a:\n    cpu: 1\n", "image is required"},
+		{"bad project", "name: -p\nvms:\n  a:\n    image: x\n", "project name"},
+		{"unknown dependency", "vms:\n  a:\n    image: x\n    depends_on: [b]\n", `depends_on "b"`},
+		{"self dependency", "vms:\n  a:\n    image: x\n    depends_on: [a]\n", `depends_on "a"`},
+		{"cycle", "vms:\n  a:\n    image: x\n    depends_on: [b]\n  b:\n    image: x\n    depends_on: [a]\n  c:\n    image: x\n", "cycle among a, b"},
+		{"duplicate VM name", "name: p\nvms:\n  a:\n    image: x\n    name: p-b\n  b:\n    image: x\n", `VM name "p-b" is taken by vms.a`},
+		{"bad volume size", "volumes:\n  v:\n    size: lots\nvms:\n  a:\n    image: x\n", "invalid size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse([]byte(tt.manifest), "/srv/p")
+			if err == nil {
+				err = m.Validate()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
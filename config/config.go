@@ -3,9 +3,35 @@ package config
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	coretypes "github.com/projecteru2/core/types"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Hypervisor backend names accepted by Config.Hypervisor.
+const (
+	HypervisorCH   = "cloud-hypervisor"
+	HypervisorQEMU = "qemu"
+)
+
+// Network provider names accepted by Config.NetworkProvider.
+const (
+	NetworkProviderCNI      = "cni"
+	NetworkProviderUsermode = "usermode"
+)
+
+// Keystore backend names accepted by Config.Keystore.
+const (
+	KeystoreFile    = "file"
+	KeystoreTPM     = "tpm"
+	KeystoreCommand = "command"
 )
 
 // Config holds global Cocoon configuration.
@@ -20,9 +46,81 @@ type Config struct {
 	// LogDir is the base directory for VM and process logs.
 	// Env: COCOON_LOG_DIR. Default: /var/log/cocoon.
 	LogDir string `json:"log_dir" mapstructure:"log_dir"`
+	// Rootless runs cocoon as an unprivileged user: directories default to
+	// user-owned XDG paths and VMs cannot use CNI networking, which needs
+	// netns and tap devices (root only); usermode networking still works.
+	// It is never inferred from the user cocoon runs as.
+	// Env: COCOON_ROOTLESS. Default: false.
+	Rootless bool `json:"rootless" mapstructure:"rootless"`
 	// CHBinary is the path or name of the cloud-hypervisor executable.
 	// Default: "cloud-hypervisor".
 	CHBinary string `json:"ch_binary" mapstructure:"ch_binary"`
+	// TDXFirmware is the TDVF firmware that boots Intel TDX guests
+	// (--confidential tdx). It replaces the regular UEFI firmware and also
+	// loads the kernel of direct-boot VMs.
+	TDXFirmware string `json:"tdx_firmware,omitempty" mapstructure:"tdx_firmware"`
+	// SNPIGVM is the IGVM file (firmware and launch measurements) that
+	// boots AMD SEV-SNP guests (--confidential sev-snp).
+	SNPIGVM string `json:"snp_igvm,omitempty" mapstructure:"snp_igvm"`
+	// SwtpmBinary is the path or name of the swtpm executable backing
+	// VMs created with --tpm. Default: "swtpm".
+	SwtpmBinary string `json:"swtpm_binary" mapstructure:"swtpm_binary"`
+	// QSDBinary is the path or name of the qemu-storage-daemon executable
+	// serving the disks of VMs created with --disk-backend qsd.
+	// Default: "qemu-storage-daemon".
+	QSDBinary string `json:"qsd_binary" mapstructure:"qsd_binary"`
+	// CHSeccomp is the default seccomp mode for cloud-hypervisor processes:
+	// "on", "log" or "off". VMs may override it with --seccomp.
+	// Default: "on".
+	CHSeccomp string `json:"ch_seccomp,omitempty" mapstructure:"ch_seccomp"`
+	// CHLandlock is the default Landlock mode for cloud-hypervisor processes:
+	// "auto" enables it when the kernel and binary support it, "on" requires
+	// it, "off" disables it. VMs may override it with --landlock.
+	// Default: "auto".
+	CHLandlock string `json:"ch_landlock,omitempty" mapstructure:"ch_landlock"`
+	// HugePages is the default hugepages mode for VM memory: "auto" uses
+	// hugepages when the free pool can hold the whole VM, "on" and
+	// "prefault" require them, "off" disables them. VMs may override it
+	// with --hugepages.
+	// Default: "auto".
+	HugePages string `json:"hugepages,omitempty" mapstructure:"hugepages"`
+	// CgroupParent places each cloud-hypervisor process in its own cgroup v2
+	// at /sys/fs/cgroup/<cgroup_parent>/<vm-id>, with cpu.max and memory.max
+	// derived from the VM's config. Empty disables cgroup placement.
+	// Default: "cocoon" (empty in rootless mode).
+	CgroupParent string `json:"cgroup_parent" mapstructure:"cgroup_parent"`
+	// CgroupCPUOverheadPercent is the headroom added on top of the VM's
+	// vCPUs in cpu.max, for the VMM's I/O and device threads. Default: 25.
+	CgroupCPUOverheadPercent int `json:"cgroup_cpu_overhead_percent" mapstructure:"cgroup_cpu_overhead_percent"`
+	// CgroupMemoryOverheadMB is added to the VM's memory in memory.max,
+	// covering VMM overhead and disk page cache. Default: 256.
+	CgroupMemoryOverheadMB int `json:"cgroup_memory_overhead_mb" mapstructure:"cgroup_memory_overhead_mb"`
+	// CgroupIOWeight sets io.weight (1-10000); 0 keeps the kernel default.
+	CgroupIOWeight int `json:"cgroup_io_weight,omitempty" mapstructure:"cgroup_io_weight"`
+	// CgroupIOReadBPS and CgroupIOWriteBPS cap disk throughput (io.max) on
+	// the block device backing the VM's run dir; 0 means unlimited.
+	CgroupIOReadBPS  int64 `json:"cgroup_io_read_bps,omitempty" mapstructure:"cgroup_io_read_bps"`
+	CgroupIOWriteBPS int64 `json:"cgroup_io_write_bps,omitempty" mapstructure:"cgroup_io_write_bps"`
+	// Hypervisor selects the VM backend: "cloud-hypervisor" or "qemu".
+	// Each backend keeps its own VM index; VMs are not shared between them.
+	// Env: COCOON_HYPERVISOR. Default: "cloud-hypervisor".
+	Hypervisor string `json:"hypervisor" mapstructure:"hypervisor"`
+	// QEMUBinary is the path or name of the QEMU system emulator.
+	// Default: "qemu-system-<arch>" for the host architecture.
+	QEMUBinary string `json:"qemu_binary,omitempty" mapstructure:"qemu_binary"`
+	// QEMUFirmware is the UEFI firmware QEMU boots cloud images with
+	// (passed as -bios; CLOUDHV.fd only works with cloud-hypervisor).
+	// Default: /usr/share/ovmf/OVMF.fd.
+	QEMUFirmware string `json:"qemu_firmware,omitempty" mapstructure:"qemu_firmware"`
+	// VMSocketGroup is the group (name or numeric GID) given each VM's API
+	// socket, console socket or PTY and the run directories leading to
+	// them, so its members can manage VMs without root. Empty keeps them
+	// owned by the user running cocoon.
+	VMSocketGroup string `json:"vm_socket_group,omitempty" mapstructure:"vm_socket_group"`
+	// VMSocketMode is the octal mode of each VM's API and console sockets
+	// and console PTY, enforced on every start. It must not grant access
+	// to others. Default: "0600", or "0660" with vm_socket_group.
+	VMSocketMode string `json:"vm_socket_mode,omitempty" mapstructure:"vm_socket_mode"`
 	// StopTimeoutSeconds is how long to wait for a guest to respond to an
 	// ACPI power-button before falling back to SIGTERM/SIGKILL.
 	// Default: 30.
@@ -30,25 +128,110 @@ type Config struct {
 	// PoolSize is the goroutine pool size for concurrent operations.
 	// Defaults to runtime.NumCPU() if zero.
 	PoolSize int `json:"pool_size" mapstructure:"pool_size"`
+	// NetworkProvider selects how VM NICs are plumbed: "cni" (netns, TAP and
+	// CNI plugins; root only) or "usermode" (one unprivileged passt process
+	// per VM providing NAT and port forwards).
+	// Env: COCOON_NETWORK_PROVIDER. Default: "cni" ("usermode" in rootless mode).
+	NetworkProvider string `json:"network_provider" mapstructure:"network_provider"`
+	// PasstBinary is the path or name of the passt executable backing
+	// usermode networking. Default: "passt".
+	PasstBinary string `json:"passt_binary,omitempty" mapstructure:"passt_binary"`
 	// CNIConfDir is the directory for CNI plugin configuration files.
 	// Default: /etc/cni/net.d.
 	CNIConfDir string `json:"cni_conf_dir" mapstructure:"cni_conf_dir"`
 	// CNIBinDir is the directory for CNI plugin binaries.
 	// Default: /opt/cni/bin.
 	CNIBinDir string `json:"cni_bin_dir" mapstructure:"cni_bin_dir"`
+	// CNITimeoutSeconds bounds each CNI ADD/DEL attempt; a plugin still
+	// running when it expires is killed. Default: 60.
+	CNITimeoutSeconds int `json:"cni_timeout_seconds,omitempty" mapstructure:"cni_timeout_seconds"`
+	// CNIRetries is how many times a failed or timed-out CNI ADD/DEL is
+	// retried before VM networking setup gives up. Default: 2.
+	CNIRetries int `json:"cni_retries" mapstructure:"cni_retries"`
 	// DefaultRootPassword is the root password injected into cloudimg VMs
 	// via cloud-init metadata. Empty means no password is set.
 	DefaultRootPassword string `json:"default_root_password" mapstructure:"default_root_password"`
+	// RandomRootPassword gives each cloudimg VM created while
+	// DefaultRootPassword is empty a random root password of its own,
+	// shown once by "vm credentials".
+	RandomRootPassword bool `json:"random_root_password,omitempty" mapstructure:"random_root_password"`
+	// DefaultSSHKey is the absolute path of an SSH public key file (e.g.
+	// /root/.ssh/id_ed25519.pub) injected into cloudimg VMs created without
+	// --ssh-key. It is read by whichever process generates the metadata,
+	// the daemon included, so "~" is not expanded. Empty means none.
+	DefaultSSHKey string `json:"default_ssh_key,omitempty" mapstructure:"default_ssh_key"`
+	// DefaultTimezone and DefaultLocale apply to VMs created without
+	// --timezone / --locale, e.g. "Europe/Berlin" and "en_US.UTF-8".
+	// Empty leaves the image's own.
+	DefaultTimezone string `json:"default_timezone,omitempty" mapstructure:"default_timezone"`
+	DefaultLocale   string `json:"default_locale,omitempty" mapstructure:"default_locale"`
 	// DNS is a comma or semicolon separated list of DNS server addresses
 	// injected into VM network configuration.
 	// Env: COCOON_DNS. Default: "8.8.8.8,1.1.1.1".
 	DNS string `json:"dns" mapstructure:"dns"`
+	// HostsFile, when set, is a hosts(5) file the daemon keeps listing
+	// every running VM as "<name>.<dns_domain>" and "<name>" under its
+	// first IP, for a host-local resolver (e.g. dnsmasq --hostsdir) to
+	// serve. Empty disables registration.
+	HostsFile string `json:"hosts_file,omitempty" mapstructure:"hosts_file"`
+	// DNSDomain is the domain VM names are registered under in HostsFile.
+	// Default: "cocoon".
+	DNSDomain string `json:"dns_domain,omitempty" mapstructure:"dns_domain"`
+	// MTU is the default MTU of VM NICs, applied to the host device and
+	// the guest; "vm create --mtu" overrides it. Default: 0 (the MTU the
+	// network plugin gave the veth).
+	MTU int `json:"mtu,omitempty" mapstructure:"mtu"`
 	// SocketWaitTimeoutSeconds is how long to wait for the CH API socket
 	// after process start. Default: 5. Increase for slow storage.
 	SocketWaitTimeoutSeconds int `json:"socket_wait_timeout_seconds,omitempty" mapstructure:"socket_wait_timeout_seconds"`
 	// TerminateGracePeriodSeconds is the SIGTERM→SIGKILL window when
 	// force-killing a CH process. Default: 5.
 	TerminateGracePeriodSeconds int `json:"terminate_grace_period_seconds,omitempty" mapstructure:"terminate_grace_period_seconds"`
+	// ReconcileIntervalSeconds is how often the daemon compares recorded VM
+	// state against live processes and applies restart policies.
+	// Default: 10.
+	ReconcileIntervalSeconds int `json:"reconcile_interval_seconds,omitempty" mapstructure:"reconcile_interval_seconds"`
+	// GCIntervalSeconds is how often the daemon runs a GC cycle.
+	// Zero disables scheduled GC. Default: 3600.
+	GCIntervalSeconds int `json:"gc_interval_seconds,omitempty" mapstructure:"gc_interval_seconds"`
+	// APISocket is the unix socket the daemon serves the gRPC control API on.
+	// Default: <run_dir>/cocoon.sock.
+	APISocket string `json:"api_socket,omitempty" mapstructure:"api_socket"`
+	// HTTPListen enables the daemon's JSON/HTTP API. Either a unix socket
+	// ("unix:///run/cocoon-http.sock") or a TCP address ("0.0.0.0:8443");
+	// TCP requires HTTPTLSCert, HTTPTLSKey and HTTPTLSClientCA. Empty
+	// disables the HTTP API.
+	HTTPListen string `json:"http_listen,omitempty" mapstructure:"http_listen"`
+	// IMDSListen enables the daemon's cloud-init NoCloud-Net metadata
+	// service on a host IP:port VMs can reach, e.g. the CNI bridge's
+	// "10.88.0.1:8775". Cloud image VMs are pointed at it through their
+	// SMBIOS serial number. Empty disables it.
+	IMDSListen string `json:"imds_listen,omitempty" mapstructure:"imds_listen"`
+	// HTTPTLSCert and HTTPTLSKey are PEM files used to serve the HTTP API over TLS.
+	HTTPTLSCert string `json:"http_tls_cert,omitempty" mapstructure:"http_tls_cert"`
+	HTTPTLSKey  string `json:"http_tls_key,omitempty" mapstructure:"http_tls_key"`
+	// HTTPTLSClientCA is a PEM bundle of the CAs that sign client
+	// certificates; with it set, TLS clients must present one.
+	HTTPTLSClientCA string `json:"http_tls_client_ca,omitempty" mapstructure:"http_tls_client_ca"`
+	// Keystore is where the disk keys of --encrypt VMs, and those sealing
+	// random root passwords, are kept: "file"
+	// (one 0600 file per VM under <root_dir>/keys), "tpm" (the same files
+	// sealed to the host TPM with systemd-creds) or "command" (handed to
+	// KeystoreCommand). Default: "file".
+	Keystore string `json:"keystore,omitempty" mapstructure:"keystore"`
+	// KeystoreCommand is run by the "command" keystore as
+	// "<command> put|get|delete <vm-id>"; put reads the key on stdin and
+	// get writes it to stdout. Root password keys use "<vm-id>-root-password".
+	KeystoreCommand string `json:"keystore_command,omitempty" mapstructure:"keystore_command"`
+	// StoragePools are named directories, usually on separate filesystems,
+	// that VM disks ("vm create --pool") and image blobs can be placed in.
+	// Without pools everything lives under RootDir and RunDir.
+	StoragePools []StoragePool `json:"storage_pools,omitempty" mapstructure:"storage_pools"`
+	// EphemeralDir is the tmpfs directory backing "vm create
+	// --ephemeral-disk" scratch disks; their contents live in host RAM.
+	// Default: /dev/shm/cocoon (rootless: <run_dir>/ephemeral, as
+	// XDG_RUNTIME_DIR is a per-user tmpfs).
+	EphemeralDir string `json:"ephemeral_dir,omitempty" mapstructure:"ephemeral_dir"`
 	// Log configuration, uses eru core's ServerLogConfig.
 	Log *coretypes.ServerLogConfig `json:"log" mapstructure:"log"`
 }
@@ -65,15 +248,149 @@ func (c *Config) Validate() error {
 	if c.LogDir == "" {
 		return fmt.Errorf("log_dir must not be empty")
 	}
+	switch c.Hypervisor {
+	case "", HypervisorCH, HypervisorQEMU:
+	default:
+		return fmt.Errorf("hypervisor must be %q or %q, got %q", HypervisorCH, HypervisorQEMU, c.Hypervisor)
+	}
+	switch c.NetworkProvider {
+	case "", NetworkProviderCNI, NetworkProviderUsermode:
+	default:
+		return fmt.Errorf("network_provider must be %q or %q, got %q", NetworkProviderCNI, NetworkProviderUsermode, c.NetworkProvider)
+	}
+	switch c.Keystore {
+	case "", KeystoreFile, KeystoreTPM:
+	case KeystoreCommand:
+		if c.KeystoreCommand == "" {
+			return fmt.Errorf("keystore %q requires keystore_command", KeystoreCommand)
+		}
+	default:
+		return fmt.Errorf("keystore must be %q, %q or %q, got %q", KeystoreFile, KeystoreTPM, KeystoreCommand, c.Keystore)
+	}
+	if err := types.SeccompMode(c.CHSeccomp).Validate(); err != nil {
+		return fmt.Errorf("ch_seccomp: %w", err)
+	}
+	if err := types.LandlockMode(c.CHLandlock).Validate(); err != nil {
+		return fmt.Errorf("ch_landlock: %w", err)
+	}
+	if err := types.HugePagesMode(c.HugePages).Validate(); err != nil {
+		return fmt.Errorf("hugepages: %w", err)
+	}
+	if err := c.validateCgroup(); err != nil {
+		return err
+	}
+	if _, err := c.VMSocketGID(); err != nil {
+		return err
+	}
+	if _, err := c.VMSocketPerm(); err != nil {
+		return err
+	}
 	if c.StopTimeoutSeconds <= 0 {
 		return fmt.Errorf("stop_timeout_seconds must be > 0, got %d", c.StopTimeoutSeconds)
 	}
+	if c.CNITimeoutSeconds < 0 {
+		return fmt.Errorf("cni_timeout_seconds must be >= 0, got %d", c.CNITimeoutSeconds)
+	}
+	if c.CNIRetries < 0 {
+		return fmt.Errorf("cni_retries must be >= 0, got %d", c.CNIRetries)
+	}
+	if c.ReconcileIntervalSeconds < 0 {
+		return fmt.Errorf("reconcile_interval_seconds must be >= 0, got %d", c.ReconcileIntervalSeconds)
+	}
+	if c.GCIntervalSeconds < 0 {
+		return fmt.Errorf("gc_interval_seconds must be >= 0, got %d", c.GCIntervalSeconds)
+	}
+	if c.HTTPListen != "" && !strings.HasPrefix(c.HTTPListen, "unix://") && (c.HTTPTLSCert == "" || c.HTTPTLSKey == "" || c.HTTPTLSClientCA == "") {
+		return fmt.Errorf("http_listen %q is a TCP address: http_tls_cert, http_tls_key and http_tls_client_ca are required", c.HTTPListen)
+	}
+	if c.IMDSListen != "" {
+		if ap, err := netip.ParseAddrPort(c.IMDSListen); err != nil || ap.Addr().IsUnspecified() {
+			return fmt.Errorf("imds_listen %q must be a host IP:port guests can reach", c.IMDSListen)
+		}
+	}
+	if c.DefaultSSHKey != "" && !filepath.IsAbs(c.DefaultSSHKey) {
+		return fmt.Errorf("default_ssh_key %q must be an absolute path", c.DefaultSSHKey)
+	}
+	if err := types.ValidateTimezone(c.DefaultTimezone); err != nil {
+		return fmt.Errorf("default_%w", err)
+	}
+	if err := types.ValidateLocale(c.DefaultLocale); err != nil {
+		return fmt.Errorf("default_%w", err)
+	}
+	if (c.HTTPTLSCert == "") != (c.HTTPTLSKey == "") {
+		return fmt.Errorf("http_tls_cert and http_tls_key must be set together")
+	}
+	if c.HTTPTLSClientCA != "" && c.HTTPTLSCert == "" {
+		return fmt.Errorf("http_tls_client_ca needs http_tls_cert and http_tls_key")
+	}
 	if _, err := c.DNSServers(); err != nil {
 		return fmt.Errorf("dns: %w", err)
 	}
+	if err := types.ValidateMTU(c.MTU); err != nil {
+		return fmt.Errorf("mtu: %w", err)
+	}
+	if err := c.validatePools(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateCgroup checks the cgroup_* settings.
+func (c *Config) validateCgroup() error {
+	if c.CgroupParent != "" && (filepath.IsAbs(c.CgroupParent) || !filepath.IsLocal(c.CgroupParent)) {
+		return fmt.Errorf("cgroup_parent must be a relative path below /sys/fs/cgroup, got %q", c.CgroupParent)
+	}
+	if c.CgroupCPUOverheadPercent < 0 {
+		return fmt.Errorf("cgroup_cpu_overhead_percent must be >= 0, got %d", c.CgroupCPUOverheadPercent)
+	}
+	if c.CgroupMemoryOverheadMB < 0 {
+		return fmt.Errorf("cgroup_memory_overhead_mb must be >= 0, got %d", c.CgroupMemoryOverheadMB)
+	}
+	if c.CgroupIOWeight < 0 || c.CgroupIOWeight > 10000 {
+		return fmt.Errorf("cgroup_io_weight must be 0 or 1-10000, got %d", c.CgroupIOWeight)
+	}
+	if c.CgroupIOReadBPS < 0 || c.CgroupIOWriteBPS < 0 {
+		return fmt.Errorf("cgroup_io_read_bps and cgroup_io_write_bps must be >= 0")
+	}
 	return nil
 }
 
+// VMSocketGID resolves VMSocketGroup; -1 when no group is configured.
+func (c *Config) VMSocketGID() (int, error) {
+	if c.VMSocketGroup == "" {
+		return -1, nil
+	}
+	if gid, err := strconv.Atoi(c.VMSocketGroup); err == nil {
+		if gid < 0 {
+			return -1, fmt.Errorf("vm_socket_group must be a group name or a GID >= 0, got %d", gid)
+		}
+		return gid, nil
+	}
+	g, err := user.LookupGroup(c.VMSocketGroup)
+	if err != nil {
+		return -1, fmt.Errorf("vm_socket_group: %w", err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// VMSocketPerm returns the permission bits for VM sockets and PTYs.
+func (c *Config) VMSocketPerm() (os.FileMode, error) {
+	if c.VMSocketMode == "" {
+		if c.VMSocketGroup != "" {
+			return 0o660, nil //nolint:mnd
+		}
+		return 0o600, nil //nolint:mnd
+	}
+	mode, err := strconv.ParseUint(c.VMSocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, fmt.Errorf("vm_socket_mode must be an octal permission such as 0660, got %q", c.VMSocketMode)
+	}
+	if mode&0o007 != 0 {
+		return 0, fmt.Errorf("vm_socket_mode %s must not grant access to others", c.VMSocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
 // DNSServers parses the DNS string into a slice of server addresses.
 // Returns an error if any entry is not a valid IP address.
 func (c *Config) DNSServers() ([]string, error) {
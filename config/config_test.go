@@ -1,6 +1,7 @@
 package config
 
 import (
+	"os"
 	"testing"
 )
 
@@ -64,6 +65,19 @@ func TestValidate_BadTimeout(t *testing.T) {
 	}
 }
 
+func TestValidate_NegativeCNIRetries(t *testing.T) {
+	c := &Config{
+		RootDir:            "/var/lib/cocoon",
+		RunDir:             "/var/lib/cocoon/run",
+		LogDir:             "/var/log/cocoon",
+		StopTimeoutSeconds: 30,
+		CNIRetries:         -1,
+	}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for negative cni_retries")
+	}
+}
+
 func TestDNSServers(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -98,3 +112,280 @@ func TestDNSServers(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate_NegativeIntervals(t *testing.T) {
+	base := Config{
+		RootDir:            "/var/lib/cocoon",
+		RunDir:             "/var/lib/cocoon/run",
+		LogDir:             "/var/log/cocoon",
+		StopTimeoutSeconds: 30,
+	}
+	reconcile := base
+	reconcile.ReconcileIntervalSeconds = -1
+	if err := reconcile.Validate(); err == nil {
+		t.Fatal("expected error for negative reconcile_interval_seconds")
+	}
+	gcInterval := base
+	gcInterval.GCIntervalSeconds = -1
+	if err := gcInterval.Validate(); err == nil {
+		t.Fatal("expected error for negative gc_interval_seconds")
+	}
+}
+
+func TestValidate_HTTPListen(t *testing.T) {
+	tests := []struct {
+		name          string
+		listen        string
+		cert, key, ca string
+		wantErr       bool
+	}{
+		{"disabled", "", "", "", "", false},
+		{"unix socket", "unix:///run/cocoon-http.sock", "", "", "", false},
+		{"tcp without tls", "127.0.0.1:8443", "", "", "", true},
+		{"tcp without client ca", "127.0.0.1:8443", "cert.pem", "key.pem", "", true},
+		{"tcp with mutual tls", "127.0.0.1:8443", "cert.pem", "key.pem", "ca.pem", false},
+		{"cert without key", "unix:///run/c.sock", "cert.pem", "", "", true},
+		{"client ca without cert", "unix:///run/c.sock", "", "", "ca.pem", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				RootDir:            "/var/lib/cocoon",
+				RunDir:             "/var/lib/cocoon/run",
+				LogDir:             "/var/log/cocoon",
+				StopTimeoutSeconds: 30,
+				HTTPListen:         tt.listen,
+				HTTPTLSCert:        tt.cert,
+				HTTPTLSKey:         tt.key,
+				HTTPTLSClientCA:    tt.ca,
+			}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Hypervisor(t *testing.T) {
+	for _, tt := range []struct {
+		hyper   string
+		wantErr bool
+	}{
+		{"", false},
+		{HypervisorCH, false},
+		{HypervisorQEMU, false},
+		{"firecracker", true},
+	} {
+		t.Run(tt.hyper, func(t *testing.T) {
+			c := &Config{
+				RootDir:            "/var/lib/cocoon",
+				RunDir:             "/var/lib/cocoon/run",
+				LogDir:             "/var/log/cocoon",
+				StopTimeoutSeconds: 30,
+				Hypervisor:         tt.hyper,
+			}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_NetworkProvider(t *testing.T) {
+	for _, tt := range []struct {
+		provider string
+		wantErr  bool
+	}{
+		{"", false},
+		{NetworkProviderCNI, false},
+		{NetworkProviderUsermode, false},
+		{"slirp", true},
+	} {
+		t.Run(tt.provider, func(t *testing.T) {
+			c := &Config{
+				RootDir:            "/var/lib/cocoon",
+				RunDir:             "/var/lib/cocoon/run",
+				LogDir:             "/var/log/cocoon",
+				StopTimeoutSeconds: 30,
+				NetworkProvider:    tt.provider,
+			}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Sandbox(t *testing.T) {
+	for _, tt := range []struct {
+		name              string
+		seccomp, landlock string
+		wantErr           bool
+	}{
+		{"defaults", "", "", false},
+		{"explicit", "log", "on", false},
+		{"bad seccomp", "strict", "", true},
+		{"bad landlock", "on", "yes", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				RootDir:            "/var/lib/cocoon",
+				RunDir:             "/var/lib/cocoon/run",
+				LogDir:             "/var/log/cocoon",
+				StopTimeoutSeconds: 30,
+				CHSeccomp:          tt.seccomp,
+				CHLandlock:         tt.landlock,
+			}
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultDirs(t *testing.T) {
+	root, run, logDir := DefaultDirs(false)
+	if root != "/var/lib/cocoon" || run != "/var/lib/cocoon/run" || logDir != "/var/log/cocoon" {
+		t.Errorf("DefaultDirs(false) = %q, %q, %q", root, run, logDir)
+	}
+
+	t.Setenv("HOME", "/home/u")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	root, run, logDir = DefaultDirs(true)
+	if root != "/home/u/.local/share/cocoon" || run != "/home/u/.local/share/cocoon/run" || logDir != "/home/u/.local/state/cocoon/log" {
+		t.Errorf("DefaultDirs(true) without XDG = %q, %q, %q", root, run, logDir)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "/data")
+	t.Setenv("XDG_STATE_HOME", "/state")
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	root, run, logDir = DefaultDirs(true)
+	if root != "/data/cocoon" || run != "/run/user/1000/cocoon" || logDir != "/state/cocoon/log" {
+		t.Errorf("DefaultDirs(true) with XDG = %q, %q, %q", root, run, logDir)
+	}
+}
+
+func TestValidate_Cgroup(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		mutate  func(*Config)
+		wantErr bool
+	}{
+		{"defaults", func(*Config) {}, false},
+		{"nested parent", func(c *Config) { c.CgroupParent = "machine.slice/cocoon" }, false},
+		{"absolute parent", func(c *Config) { c.CgroupParent = "/sys/fs/cgroup/cocoon" }, true},
+		{"escaping parent", func(c *Config) { c.CgroupParent = "../cocoon" }, true},
+		{"negative cpu overhead", func(c *Config) { c.CgroupCPUOverheadPercent = -1 }, true},
+		{"io weight too large", func(c *Config) { c.CgroupIOWeight = 10001 }, true},
+		{"negative bps", func(c *Config) { c.CgroupIOWriteBPS = -1 }, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{
+				RootDir:            "/var/lib/cocoon",
+				RunDir:             "/var/lib/cocoon/run",
+				LogDir:             "/var/log/cocoon",
+				StopTimeoutSeconds: 30,
+				CgroupParent:       "cocoon",
+			}
+			tt.mutate(c)
+			if err := c.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVMSocketPerm(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		group   string
+		mode    string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{name: "default", want: 0o600},
+		{name: "default with group", group: "0", want: 0o660},
+		{name: "explicit", group: "0", mode: "0640", want: 0o640},
+		{name: "world accessible", mode: "0666", wantErr: true},
+		{name: "not octal", mode: "rw-rw----", wantErr: true},
+		{name: "too large", mode: "1777", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{VMSocketGroup: tt.group, VMSocketMode: tt.mode}
+			got, err := c.VMSocketPerm()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VMSocketPerm() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("VMSocketPerm() = %o, want %o", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVMSocketGID(t *testing.T) {
+	for _, tt := range []struct {
+		group   string
+		want    int
+		wantErr bool
+	}{
+		{group: "", want: -1},
+		{group: "1234", want: 1234},
+		{group: "-5", wantErr: true},
+		{group: "no-such-group-cocoon", wantErr: true},
+	} {
+		c := &Config{VMSocketGroup: tt.group}
+		got, err := c.VMSocketGID()
+		if (err != nil) != tt.wantErr || (!tt.wantErr && got != tt.want) {
+			t.Errorf("VMSocketGID(%q) = %d, %v; want %d, wantErr %v", tt.group, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidatePools(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		pools   []StoragePool
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "ok", pools: []StoragePool{
+			{Name: "nvme", Path: "/mnt/nvme", Capacity: "500G", Default: true},
+			{Name: "hdd", Path: "/mnt/hdd"},
+		}},
+		{name: "relative path", pools: []StoragePool{{Name: "nvme", Path: "mnt/nvme"}}, wantErr: true},
+		{name: "bad name", pools: []StoragePool{{Name: "-x", Path: "/mnt/x"}}, wantErr: true},
+		{name: "bad capacity", pools: []StoragePool{{Name: "x", Path: "/mnt/x", Capacity: "lots"}}, wantErr: true},
+		{name: "duplicate", pools: []StoragePool{{Name: "x", Path: "/mnt/x"}, {Name: "x", Path: "/mnt/y"}}, wantErr: true},
+		{name: "two defaults", pools: []StoragePool{
+			{Name: "x", Path: "/mnt/x", Default: true},
+			{Name: "y", Path: "/mnt/y", Default: true},
+		}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{StoragePools: tt.pools}
+			if err := c.validatePools(); (err != nil) != tt.wantErr {
+				t.Errorf("validatePools() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_DefaultSSHKey(t *testing.T) {
+	c := &Config{
+		RootDir:            "/var/lib/cocoon",
+		RunDir:             "/var/lib/cocoon/run",
+		LogDir:             "/var/log/cocoon",
+		StopTimeoutSeconds: 30,
+		DefaultSSHKey:      "~/.ssh/id_ed25519.pub",
+	}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected error for a default_ssh_key relative to the home directory")
+	}
+	c.DefaultSSHKey = "/root/.ssh/id_ed25519.pub"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("absolute default_ssh_key should be valid: %v", err)
+	}
+}
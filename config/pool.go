@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// StoragePool is a named directory that holds VM disks and image blobs,
+// typically the mount point of a dedicated filesystem.
+type StoragePool struct {
+	Name string `json:"name" mapstructure:"name"`
+	// Path is the absolute directory of the pool; it must exist.
+	Path string `json:"path" mapstructure:"path"`
+	// Capacity caps the total size of the VM disks placed in the pool,
+	// e.g. "500G". Empty = bounded by the filesystem only.
+	Capacity string `json:"capacity,omitempty" mapstructure:"capacity"`
+	// Default marks the pool new image blobs and the disks of VMs created
+	// without --pool or --data-dir go to. At most one pool is the default.
+	Default bool `json:"default,omitempty" mapstructure:"default"`
+}
+
+// CapacityBytes returns the parsed Capacity; 0 means unlimited.
+func (p *StoragePool) CapacityBytes() (int64, error) {
+	if p.Capacity == "" {
+		return 0, nil
+	}
+	n, err := units.RAMInBytes(p.Capacity)
+	if err != nil {
+		return 0, fmt.Errorf("storage pool %s: capacity %q: %w", p.Name, p.Capacity, err)
+	}
+	return n, nil
+}
+
+// Room returns the bytes a new VM disk may take in the pool: the free
+// space of its filesystem, bounded by what Capacity leaves after
+// committed, the sizes of the VM disks already placed in the pool.
+func (p *StoragePool) Room(committed int64) (int64, error) {
+	avail, err := utils.FSAvailable(p.Path)
+	if err != nil {
+		return 0, fmt.Errorf("storage pool %s: %w", p.Name, err)
+	}
+	capacity, err := p.CapacityBytes()
+	if err != nil || capacity == 0 {
+		return avail, err
+	}
+	return max(0, min(capacity-committed, avail)), nil
+}
+
+// Pool returns the storage pool named name.
+func (c *Config) Pool(name string) (*StoragePool, bool) {
+	for i := range c.StoragePools {
+		if c.StoragePools[i].Name == name {
+			return &c.StoragePools[i], true
+		}
+	}
+	return nil, false
+}
+
+// DefaultPool returns the default storage pool, if one is configured.
+func (c *Config) DefaultPool() (*StoragePool, bool) {
+	for i := range c.StoragePools {
+		if c.StoragePools[i].Default {
+			return &c.StoragePools[i], true
+		}
+	}
+	return nil, false
+}
+
+// validatePools checks the storage_pools entries.
+func (c *Config) validatePools() error {
+	names := make(map[string]struct{}, len(c.StoragePools))
+	defaults := 0
+	for i := range c.StoragePools {
+		p := &c.StoragePools[i]
+		if err := types.ValidatePoolName(p.Name); err != nil {
+			return err
+		}
+		if _, dup := names[p.Name]; dup {
+			return fmt.Errorf("storage pool %s is defined twice", p.Name)
+		}
+		names[p.Name] = struct{}{}
+		if !filepath.IsAbs(p.Path) {
+			return fmt.Errorf("storage pool %s: path %q must be absolute", p.Name, p.Path)
+		}
+		if n, err := p.CapacityBytes(); err != nil {
+			return err
+		} else if n < 0 {
+			return fmt.Errorf("storage pool %s: capacity must be >= 0", p.Name)
+		}
+		if p.Default {
+			defaults++
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("storage_pools: %d pools are marked default, at most one may be", defaults)
+	}
+	return nil
+}
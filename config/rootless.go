@@ -0,0 +1,31 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// DefaultDirs returns the default root, run and log directories. Rootless
+// mode follows the XDG base directory spec so every path is user-owned:
+// $XDG_DATA_HOME/cocoon, $XDG_RUNTIME_DIR/cocoon and $XDG_STATE_HOME/cocoon/log.
+func DefaultDirs(rootless bool) (rootDir, runDir, logDir string) {
+	if !rootless {
+		return "/var/lib/cocoon", "/var/lib/cocoon/run", "/var/log/cocoon"
+	}
+	home, _ := os.UserHomeDir()
+	rootDir = filepath.Join(xdgDir("XDG_DATA_HOME", home, ".local", "share"), "cocoon")
+	runDir = filepath.Join(rootDir, "run")
+	if xdgRun := os.Getenv("XDG_RUNTIME_DIR"); xdgRun != "" {
+		runDir = filepath.Join(xdgRun, "cocoon")
+	}
+	logDir = filepath.Join(xdgDir("XDG_STATE_HOME", home, ".local", "state"), "cocoon", "log")
+	return rootDir, runDir, logDir
+}
+
+// xdgDir returns $env, falling back to home joined with fallback.
+func xdgDir(env, home string, fallback ...string) string {
+	if dir := os.Getenv(env); dir != "" {
+		return dir
+	}
+	return filepath.Join(append([]string{home}, fallback...)...)
+}
@@ -0,0 +1,54 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	apiv1 "github.com/projecteru2/cocoon/api/v1"
+	"github.com/projecteru2/cocoon/config"
+)
+
+// Client talks to the API of a running daemon, so the CLI acts as a thin
+// client and the daemon sees lifecycle changes as they happen.
+type Client struct {
+	api  apiv1.CocoonServiceClient
+	conn *grpc.ClientConn
+}
+
+// Dial connects to the daemon that owns conf.RunDir. It returns nil
+// without error when no daemon is running.
+func Dial(conf *config.Config) (*Client, error) {
+	if _, ok := Running(conf); !ok {
+		return nil, nil
+	}
+	conn, err := grpc.NewClient("unix://"+SocketPath(conf), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("dial daemon: %w", err)
+	}
+	return &Client{api: apiv1.NewCocoonServiceClient(conn), conn: conn}, nil
+}
+
+// Close closes the connection.
+func (c *Client) Close() error { return c.conn.Close() }
+
+// Start starts refs through the daemon, which recovers their network
+// first. It has the signature of hypervisor.Hypervisor.Start.
+func (c *Client) Start(ctx context.Context, refs []string) ([]string, error) {
+	resp, err := c.api.StartVM(ctx, &apiv1.VMRefsRequest{Refs: refs})
+	if err != nil {
+		return nil, fmt.Errorf("daemon: %w", err)
+	}
+	return resp.GetIds(), nil
+}
+
+// Stop stops refs through the daemon.
+func (c *Client) Stop(ctx context.Context, refs []string) ([]string, error) {
+	resp, err := c.api.StopVM(ctx, &apiv1.VMRefsRequest{Refs: refs})
+	if err != nil {
+		return nil, fmt.Errorf("daemon: %w", err)
+	}
+	return resp.GetIds(), nil
+}
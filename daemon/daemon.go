@@ -0,0 +1,513 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/lock/flock"
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	defaultReconcileInterval = 10 * time.Second
+
+	// Restart backoff doubles per consecutive restart of the same VM,
+	// capped at maxRestartBackoff, so a crash-looping guest cannot spin
+	// the reconcile loop.
+	minRestartBackoff = 5 * time.Second
+	maxRestartBackoff = 5 * time.Minute
+
+	lockFileName   = "cocoond.lock"
+	pidFileName    = "cocoond.pid"
+	socketFileName = "cocoon.sock"
+)
+
+// Daemon owns VM lifecycle in the background: it periodically reconciles
+// recorded VM state against live processes, applies restart policies, and
+// runs scheduled GC.
+type Daemon struct {
+	conf  *config.Config
+	hyper hypervisor.Hypervisor
+	net   network.Network  // optional; nil disables network recovery
+	gc    *gc.Orchestrator // optional; nil disables scheduled GC
+
+	restarts  map[string]*restartState
+	probed    map[string]time.Time       // VM ID → last health probe
+	watchdogs map[string]watchdogState   // VM ID → watchdog resets already reported
+	ports     map[string]*publishedPorts // VM ID → listeners serving --publish
+}
+
+type restartState struct {
+	count int
+	next  time.Time
+	// retry is set while a VM is owed a start: its autostart at daemon
+	// startup or a restart failed, and it is tried again once due.
+	retry bool
+	// autostart is set while the owed start is the VM's autostart rather
+	// than a restart under its restart policy.
+	autostart bool
+}
+
+// Report summarizes a single reconcile pass.
+type Report struct {
+	// Stale lists VMs recorded as running whose process was gone;
+	// their records were moved to stopped.
+	Stale []string `json:"stale,omitempty"`
+	// Restarted lists VMs brought back up by their restart policy.
+	Restarted []string `json:"restarted,omitempty"`
+	// Unhealthy lists running VMs whose health check crossed its failure
+	// threshold in this pass.
+	Unhealthy []string `json:"unhealthy,omitempty"`
+	// WatchdogResets lists running VMs whose guest watchdog fired since the
+	// previous pass.
+	WatchdogResets []string `json:"watchdog_resets,omitempty"`
+	// Adopted lists VMs whose VMM was alive while their record was not
+	// running; the record was moved to running.
+	Adopted []string `json:"adopted,omitempty"`
+	// Cleaned lists non-running VMs whose leftover sockets and PID files
+	// were removed.
+	Cleaned []string `json:"cleaned,omitempty"`
+}
+
+// New creates a Daemon. net and orch may be nil.
+func New(conf *config.Config, hyper hypervisor.Hypervisor, net network.Network, orch *gc.Orchestrator) *Daemon {
+	return &Daemon{
+		conf:      conf,
+		hyper:     hyper,
+		net:       net,
+		gc:        orch,
+		restarts:  map[string]*restartState{},
+		probed:    map[string]time.Time{},
+		watchdogs: map[string]watchdogState{},
+		ports:     map[string]*publishedPorts{},
+	}
+}
+
+// LockFile returns the path of the flock held by a running daemon.
+func LockFile(conf *config.Config) string { return filepath.Join(conf.RunDir, lockFileName) }
+
+// PIDFile returns the path of the daemon PID file.
+func PIDFile(conf *config.Config) string { return filepath.Join(conf.RunDir, pidFileName) }
+
+// SocketPath returns the unix socket the daemon serves its API on.
+func SocketPath(conf *config.Config) string {
+	if conf.APISocket != "" {
+		return conf.APISocket
+	}
+	return filepath.Join(conf.RunDir, socketFileName)
+}
+
+// Running reports whether a daemon process currently owns conf.RunDir.
+func Running(conf *config.Config) (int, bool) {
+	pid, err := utils.ReadPIDFile(PIDFile(conf))
+	if err != nil || !utils.IsProcessAlive(pid) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// Run blocks until ctx is canceled. Only one daemon may run per RunDir;
+// a second instance fails fast instead of racing the first.
+func (d *Daemon) Run(ctx context.Context) error {
+	logger := log.WithFunc("daemon.Run")
+
+	if err := utils.EnsureDirs(d.conf.RunDir); err != nil {
+		return fmt.Errorf("ensure run dir: %w", err)
+	}
+	locker := flock.New(LockFile(d.conf))
+	ok, err := locker.TryLock(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire daemon lock: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("another daemon is already running (lock %s held)", LockFile(d.conf))
+	}
+	defer locker.Unlock(ctx) //nolint:errcheck
+
+	if err := utils.WritePIDFile(PIDFile(d.conf), os.Getpid()); err != nil {
+		return fmt.Errorf("write PID file: %w", err)
+	}
+	defer os.Remove(PIDFile(d.conf)) //nolint:errcheck
+
+	stopAPI, err := d.serveAPI(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopAPI()
+
+	stopHTTP, err := d.serveHTTP(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopHTTP()
+
+	stopIMDS, err := d.serveIMDS(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopIMDS()
+	defer d.closePorts()
+	defer os.Remove(PortsFile(d.conf)) //nolint:errcheck
+
+	reconcileTicker := time.NewTicker(d.reconcileInterval())
+	defer reconcileTicker.Stop()
+
+	var gcTick <-chan time.Time
+	if d.gc != nil && d.conf.GCIntervalSeconds > 0 {
+		gcTicker := time.NewTicker(time.Duration(d.conf.GCIntervalSeconds) * time.Second)
+		defer gcTicker.Stop()
+		gcTick = gcTicker.C
+	}
+
+	logger.Infof(ctx, "daemon started (pid %d, reconcile every %s)", os.Getpid(), d.reconcileInterval())
+	// The first pass also repairs runtime state left behind by a crash or
+	// host reboot and starts --autostart VMs; later passes only track VMs
+	// that die while we watch, and retry starts that failed.
+	if err := d.queueAutostart(ctx); err != nil {
+		logger.Warnf(ctx, "autostart: %v", err)
+	}
+	d.reconcileOnce(ctx, true)
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info(ctx, "daemon stopped")
+			return nil
+		case <-reconcileTicker.C:
+			d.reconcileOnce(ctx, false)
+		case <-gcTick:
+			if err := d.gc.Run(ctx); err != nil {
+				logger.Warnf(ctx, "scheduled GC: %v", err)
+			} else {
+				logger.Info(ctx, "scheduled GC completed")
+			}
+		}
+	}
+}
+
+// serveAPI starts the gRPC control API on the daemon socket. The returned
+// function stops the server gracefully and removes the socket.
+func (d *Daemon) serveAPI(ctx context.Context) (func(), error) {
+	sock := SocketPath(d.conf)
+	// We hold the daemon lock, so any existing socket is a leftover.
+	if err := os.Remove(sock); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("remove stale socket %s: %w", sock, err)
+	}
+	lis, err := (&net.ListenConfig{}).Listen(ctx, "unix", sock)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", sock, err)
+	}
+	if err := os.Chmod(sock, 0o660); err != nil { //nolint:mnd
+		_ = lis.Close()
+		return nil, fmt.Errorf("chmod %s: %w", sock, err)
+	}
+
+	srv := NewGRPCServer(d.conf, d.hyper)
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			log.WithFunc("daemon.serveAPI").Warnf(ctx, "API server: %v", err)
+		}
+	}()
+	log.WithFunc("daemon.serveAPI").Infof(ctx, "serving API on %s", sock)
+	return func() {
+		srv.GracefulStop()
+		_ = os.Remove(sock)
+	}, nil
+}
+
+func (d *Daemon) reconcileOnce(ctx context.Context, repair bool) {
+	logger := log.WithFunc("daemon.reconcile")
+	report, err := d.Reconcile(ctx)
+	if err != nil {
+		logger.Warnf(ctx, "reconcile: %v", err)
+	}
+	if repair {
+		if err := d.repairRuntime(ctx, report); err != nil {
+			logger.Warnf(ctx, "reconcile: %v", err)
+		}
+	}
+	for _, id := range report.Stale {
+		logger.Infof(ctx, "VM %s process exited, record marked stopped", id)
+	}
+	for _, id := range report.Unhealthy {
+		logger.Warnf(ctx, "VM %s is unhealthy", id)
+	}
+	for _, id := range report.WatchdogResets {
+		logger.Warnf(ctx, "VM %s was reset by its guest watchdog", id)
+	}
+	for _, id := range report.Restarted {
+		logger.Infof(ctx, "VM %s restarted by restart policy", id)
+	}
+	for _, id := range report.Adopted {
+		logger.Infof(ctx, "VM %s has a live VMM, record marked running", id)
+	}
+	for _, id := range report.Cleaned {
+		logger.Infof(ctx, "VM %s leftover runtime files removed", id)
+	}
+	if err := d.savePorts(); err != nil {
+		logger.Warnf(ctx, "record forwarded ports: %v", err)
+	}
+}
+
+// ReconcileState is the one-shot pass behind "cocoon reconcile": VMs
+// recorded as running whose process is gone are marked stopped, live VMMs
+// under a non-running record are adopted, and runtime files left by dead
+// processes are removed. Unlike Reconcile it never restarts or probes VMs.
+func (d *Daemon) ReconcileState(ctx context.Context) (*Report, error) {
+	report := &Report{}
+	vms, err := d.hyper.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list VMs: %w", err)
+	}
+	var errs []error
+	if stale := d.recordStale(ctx, vms); len(stale) > 0 {
+		stopped, stopErr := d.hyper.Stop(ctx, stale)
+		report.Stale = stopped
+		if stopErr != nil {
+			errs = append(errs, fmt.Errorf("mark stale VMs stopped: %w", stopErr))
+		}
+	}
+	errs = append(errs, d.repairRuntime(ctx, report))
+	return report, errors.Join(errs...)
+}
+
+// repairRuntime runs the hypervisor's runtime repair, for hypervisors that
+// implement hypervisor.RuntimeRepairer.
+func (d *Daemon) repairRuntime(ctx context.Context, report *Report) error {
+	repairer, ok := d.hyper.(hypervisor.RuntimeRepairer)
+	if !ok {
+		return nil
+	}
+	repair, err := repairer.RepairRuntime(ctx)
+	if repair != nil {
+		report.Adopted = append(report.Adopted, repair.Adopted...)
+		report.Cleaned = append(report.Cleaned, repair.Cleaned...)
+	}
+	if err != nil {
+		return fmt.Errorf("repair runtime state: %w", err)
+	}
+	return nil
+}
+
+// recordStale returns the stale VMs among vms, recording a crashed event
+// for each.
+func (d *Daemon) recordStale(ctx context.Context, vms []*types.VM) []string {
+	var stale []string
+	for _, vm := range vms {
+		if IsStale(vm) {
+			stale = append(stale, vm.ID)
+			events.Record(ctx, d.conf, types.Event{Type: types.EventCrashed, ID: vm.ID, Name: vm.Config.Name, Message: "VMM process exited"})
+		}
+	}
+	return stale
+}
+
+// Reconcile runs one pass: VMs recorded as running whose process is gone are
+// marked stopped, then those with restart policy "always" are started again
+// (subject to per-VM backoff). Running VMs with a health check are probed
+// once their interval has elapsed, guest watchdog resets are picked up from
+// the VMM, published ports follow their VM, running VMs are registered in
+// the hosts file, and oversized VMM logs are rotated. The returned report is valid even on error.
+func (d *Daemon) Reconcile(ctx context.Context) (*Report, error) {
+	report := &Report{}
+	vms, err := d.hyper.List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list VMs: %w", err)
+	}
+
+	now := time.Now()
+	return report, errors.Join(
+		d.reconcileStale(ctx, vms, now, report),
+		d.reconcileHealth(ctx, vms, now, report),
+		d.reconcileWatchdog(ctx, vms, now, report),
+		d.reconcilePorts(ctx, vms),
+		d.reconcileHosts(vms),
+		d.rotateLogs(ctx),
+	)
+}
+
+// rotateLogs rotates VMM process logs that reached the size limit, for
+// hypervisors that implement hypervisor.LogRotator.
+func (d *Daemon) rotateLogs(ctx context.Context) error {
+	rotator, ok := d.hyper.(hypervisor.LogRotator)
+	if !ok {
+		return nil
+	}
+	if err := rotator.RotateLogs(ctx); err != nil {
+		return fmt.Errorf("rotate logs: %w", err)
+	}
+	return nil
+}
+
+func (d *Daemon) reconcileStale(ctx context.Context, vms []*types.VM, now time.Time, report *Report) error {
+	restartable := map[string]*types.VM{}
+	var retries []string
+	for _, vm := range vms {
+		retry := d.wantsRetry(vm)
+		switch {
+		case IsStale(vm):
+			if retry || vm.Config.RestartPolicy == types.RestartPolicyAlways {
+				restartable[vm.ID] = vm
+			}
+		case retry && vm.State != types.VMStateRunning:
+			restartable[vm.ID] = vm
+			retries = append(retries, vm.ID)
+		default:
+			d.forgetRestart(vm, now)
+		}
+	}
+	d.dropRestarts(vms)
+
+	var errs []error
+	var stopped []string
+	if stale := d.recordStale(ctx, vms); len(stale) > 0 {
+		// Stop on a dead process takes the fast path: runtime files are
+		// cleaned and the record is moved to stopped.
+		var stopErr error
+		stopped, stopErr = d.hyper.Stop(ctx, stale)
+		report.Stale = stopped
+		if stopErr != nil {
+			errs = append(errs, fmt.Errorf("mark stale VMs stopped: %w", stopErr))
+		}
+	}
+
+	var toStart []string
+	for _, id := range append(stopped, retries...) {
+		vm, ok := restartable[id]
+		if !ok || !d.restartDue(id, now) {
+			continue
+		}
+		// Until the start succeeds, the VM is retried on later passes.
+		d.restarts[id].retry = true
+		if _, recoverErr := network.Recover(ctx, d.net, vm); recoverErr != nil {
+			errs = append(errs, recoverErr)
+			continue
+		}
+		toStart = append(toStart, id)
+	}
+	if len(toStart) > 0 {
+		started, startErr := d.startOwed(ctx, toStart)
+		report.Restarted = append(report.Restarted, started...)
+		if startErr != nil {
+			errs = append(errs, fmt.Errorf("restart VMs: %w", startErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// startOwed starts ids, which restartDue has admitted, for their restart
+// policy or autostart. Those that fail to start stay owed a start and are
+// retried on later passes.
+func (d *Daemon) startOwed(ctx context.Context, ids []string) ([]string, error) {
+	for _, id := range ids {
+		d.restarts[id].retry = true
+	}
+	started, err := d.hyper.Start(ctx, ids)
+	for _, id := range started {
+		d.restarts[id].retry, d.restarts[id].autostart = false, false
+	}
+	return started, err
+}
+
+// queueAutostart marks the --autostart VMs that are not running as owed a
+// start, so the first reconcile pass starts them and later passes retry
+// those that fail. Suspended VMs stay parked until resumed explicitly.
+func (d *Daemon) queueAutostart(ctx context.Context) error {
+	vms, err := d.hyper.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list VMs: %w", err)
+	}
+	for _, vm := range vms {
+		if !vm.Config.Autostart || vm.State == types.VMStateCreating || vm.State == types.VMStateSuspended {
+			continue
+		}
+		if vm.State == types.VMStateRunning && utils.IsProcessAlive(vm.PID) {
+			continue
+		}
+		d.restarts[vm.ID] = &restartState{retry: true, autostart: true}
+	}
+	return nil
+}
+
+// wantsRetry reports whether vm is still owed a start, checked against its
+// current config: the policy may have changed since the start failed. An
+// owed autostart stays owed while the VM keeps --autostart, a failed restart
+// while its restart policy is always; otherwise the retry is dropped.
+func (d *Daemon) wantsRetry(vm *types.VM) bool {
+	st := d.restarts[vm.ID]
+	if st == nil || !st.retry {
+		return false
+	}
+	if st.autostart && vm.Config.Autostart || vm.Config.RestartPolicy == types.RestartPolicyAlways {
+		return true
+	}
+	st.retry, st.autostart = false, false
+	return false
+}
+
+// dropRestarts forgets the restart state of VMs that no longer exist.
+func (d *Daemon) dropRestarts(vms []*types.VM) {
+	for id := range d.restarts {
+		if !slices.ContainsFunc(vms, func(vm *types.VM) bool { return vm.ID == id }) {
+			delete(d.restarts, id)
+		}
+	}
+}
+
+// IsStale reports whether a VM is recorded as running but its VMM process
+// no longer exists.
+func IsStale(vm *types.VM) bool {
+	return vm.State == types.VMStateRunning && !utils.IsProcessAlive(vm.PID)
+}
+
+// restartDue records a restart attempt for id and reports whether its
+// backoff window has elapsed.
+func (d *Daemon) restartDue(id string, now time.Time) bool {
+	st := d.restarts[id]
+	if st == nil {
+		st = &restartState{}
+		d.restarts[id] = st
+	}
+	if now.Before(st.next) {
+		return false
+	}
+	backoff := minRestartBackoff << min(st.count, 6) //nolint:mnd
+	st.count++
+	st.next = now.Add(min(backoff, maxRestartBackoff))
+	return true
+}
+
+// forgetRestart drops backoff state for VMs that stayed healthy past their
+// backoff window, or that no longer want restarts.
+func (d *Daemon) forgetRestart(vm *types.VM, now time.Time) {
+	st, ok := d.restarts[vm.ID]
+	if !ok {
+		return
+	}
+	if vm.State == types.VMStateRunning {
+		st.retry = false // started by hand meanwhile
+	}
+	if vm.State != types.VMStateRunning || now.After(st.next.Add(maxRestartBackoff)) {
+		delete(d.restarts, vm.ID)
+	}
+}
+
+func (d *Daemon) reconcileInterval() time.Duration {
+	if d.conf.ReconcileIntervalSeconds > 0 {
+		return time.Duration(d.conf.ReconcileIntervalSeconds) * time.Second
+	}
+	return defaultReconcileInterval
+}
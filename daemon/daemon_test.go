@@ -0,0 +1,259 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// fakeHyper records Stop/Start calls; unimplemented methods panic via the
+// embedded nil interface.
+type fakeHyper struct {
+	hypervisor.Hypervisor
+	vms     []*types.VM
+	stopped []string
+	started []string
+
+	watchdogResets map[string]int
+	repair         *hypervisor.RuntimeRepair
+	failStart      map[string]bool
+}
+
+func (f *fakeHyper) List(context.Context) ([]*types.VM, error) { return f.vms, nil }
+
+func (f *fakeHyper) Inspect(_ context.Context, ref string) (*types.VM, error) {
+	for _, vm := range f.vms {
+		if vm.ID == ref || vm.Config.Name == ref {
+			return vm, nil
+		}
+	}
+	return nil, fmt.Errorf("inspect %s: %w", ref, hypervisor.ErrNotFound)
+}
+
+func (f *fakeHyper) Stats(ctx context.Context, ref string) (*types.VMStats, error) {
+	vm, err := f.Inspect(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if vm.State != types.VMStateRunning {
+		return nil, fmt.Errorf("stats %s: %w", ref, hypervisor.ErrNotRunning)
+	}
+	return &types.VMStats{ID: vm.ID, Name: vm.Config.Name}, nil
+}
+
+func (f *fakeHyper) SetHealth(ctx context.Context, ref string, health *types.Health) error {
+	vm, err := f.Inspect(ctx, ref)
+	if err != nil {
+		return err
+	}
+	vm.Health = health
+	return nil
+}
+
+func (f *fakeHyper) WatchdogResets(_ context.Context, ref string) (int, error) {
+	return f.watchdogResets[ref], nil
+}
+
+func (f *fakeHyper) RepairRuntime(context.Context) (*hypervisor.RuntimeRepair, error) {
+	if f.repair == nil {
+		return &hypervisor.RuntimeRepair{}, nil
+	}
+	return f.repair, nil
+}
+
+func (f *fakeHyper) Stop(_ context.Context, ids []string) ([]string, error) {
+	f.stopped = append(f.stopped, ids...)
+	return ids, nil
+}
+
+func (f *fakeHyper) Start(_ context.Context, ids []string) ([]string, error) {
+	var started []string
+	for _, id := range ids {
+		if f.failStart[id] {
+			return started, fmt.Errorf("start %s: boom", id)
+		}
+		started = append(started, id)
+	}
+	f.started = append(f.started, started...)
+	return started, nil
+}
+
+func TestReconcile(t *testing.T) {
+	hyper := &fakeHyper{vms: []*types.VM{
+		{ID: "alive", State: types.VMStateRunning, PID: os.Getpid()},
+		{ID: "dead", State: types.VMStateRunning},
+		{ID: "dead-always", State: types.VMStateRunning, Config: types.VMConfig{RestartPolicy: types.RestartPolicyAlways}},
+		{ID: "stopped", State: types.VMStateStopped, Config: types.VMConfig{RestartPolicy: types.RestartPolicyAlways}},
+	}}
+	d := New(&config.Config{LogDir: t.TempDir()}, hyper, nil, nil)
+
+	report, err := d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !slices.Equal(report.Stale, []string{"dead", "dead-always"}) {
+		t.Errorf("stale = %v", report.Stale)
+	}
+	if !slices.Equal(report.Restarted, []string{"dead-always"}) {
+		t.Errorf("restarted = %v", report.Restarted)
+	}
+
+	// A second crash inside the backoff window must not restart again.
+	hyper.started = nil
+	if _, err := d.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(hyper.started) != 0 {
+		t.Errorf("restarted within backoff: %v", hyper.started)
+	}
+}
+
+func TestReconcileRetriesFailedStarts(t *testing.T) {
+	hyper := &fakeHyper{
+		vms: []*types.VM{
+			{ID: "boot", State: types.VMStateStopped, Config: types.VMConfig{Autostart: true}},
+			{ID: "manual", State: types.VMStateStopped},
+			{ID: "parked", State: types.VMStateSuspended, Config: types.VMConfig{Autostart: true}},
+		},
+		failStart: map[string]bool{"boot": true},
+	}
+	d := New(&config.Config{LogDir: t.TempDir()}, hyper, nil, nil)
+	if err := d.queueAutostart(t.Context()); err != nil {
+		t.Fatalf("queueAutostart: %v", err)
+	}
+
+	if _, err := d.Reconcile(t.Context()); err == nil {
+		t.Fatal("failed autostart should be reported")
+	}
+	if !d.restarts["boot"].retry {
+		t.Fatal("failed autostart should stay owed a start")
+	}
+
+	// Not retried inside the backoff window, then started once due.
+	delete(hyper.failStart, "boot")
+	if _, err := d.Reconcile(t.Context()); err != nil || len(hyper.started) != 0 {
+		t.Fatalf("retried within backoff: %v, err %v", hyper.started, err)
+	}
+	d.restarts["boot"].next = time.Now()
+	report, err := d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !slices.Equal(report.Restarted, []string{"boot"}) || d.restarts["boot"].retry {
+		t.Errorf("restarted = %v, retry = %v", report.Restarted, d.restarts["boot"].retry)
+	}
+
+	// A deleted VM is forgotten.
+	hyper.vms = hyper.vms[1:]
+	if _, err := d.Reconcile(t.Context()); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if _, ok := d.restarts["boot"]; ok {
+		t.Error("restart state of a deleted VM kept")
+	}
+}
+
+func TestReconcileRetryFollowsPolicy(t *testing.T) {
+	hyper := &fakeHyper{
+		vms: []*types.VM{
+			{ID: "crashed", State: types.VMStateRunning, Config: types.VMConfig{RestartPolicy: types.RestartPolicyAlways}},
+			{ID: "boot", State: types.VMStateStopped, Config: types.VMConfig{Autostart: true}},
+		},
+		failStart: map[string]bool{"crashed": true, "boot": true},
+	}
+	d := New(&config.Config{LogDir: t.TempDir()}, hyper, nil, nil)
+	if err := d.queueAutostart(t.Context()); err != nil {
+		t.Fatalf("queueAutostart: %v", err)
+	}
+	if _, err := d.Reconcile(t.Context()); err == nil {
+		t.Fatal("failed starts should be reported")
+	}
+	if !d.restarts["crashed"].retry || !d.restarts["boot"].retry {
+		t.Fatal("failed starts should stay owed a start")
+	}
+
+	// Dropping the restart policy drops the owed restart; the autostart
+	// does not depend on the restart policy and is still retried.
+	hyper.vms[0].State = types.VMStateStopped
+	hyper.vms[0].Config.RestartPolicy = types.RestartPolicyNo
+	hyper.failStart = nil
+	for _, id := range []string{"crashed", "boot"} {
+		d.restarts[id].next = time.Now()
+	}
+	report, err := d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !slices.Equal(report.Restarted, []string{"boot"}) {
+		t.Errorf("restarted = %v, want [boot]", report.Restarted)
+	}
+	if st := d.restarts["crashed"]; st != nil && st.retry {
+		t.Error("retry kept after the restart policy was dropped")
+	}
+
+	// An autostart turned off meanwhile is not retried either.
+	hyper.vms[1].State = types.VMStateStopped
+	hyper.vms[1].Config.Autostart = false
+	d.restarts["boot"] = &restartState{retry: true, autostart: true}
+	if report, err := d.Reconcile(t.Context()); err != nil || len(report.Restarted) != 0 {
+		t.Errorf("restarted = %v, err %v", report.Restarted, err)
+	}
+}
+
+func TestRestartDueBackoff(t *testing.T) {
+	d := New(&config.Config{}, nil, nil, nil)
+	now := time.Now()
+
+	if !d.restartDue("vm", now) {
+		t.Fatal("first restart should be due")
+	}
+	if d.restartDue("vm", now.Add(minRestartBackoff-time.Second)) {
+		t.Fatal("restart inside backoff window should not be due")
+	}
+	if !d.restartDue("vm", now.Add(minRestartBackoff)) {
+		t.Fatal("restart after backoff window should be due")
+	}
+	if got := d.restarts["vm"].next.Sub(now.Add(minRestartBackoff)); got != 2*minRestartBackoff {
+		t.Errorf("second backoff = %s, want %s", got, 2*minRestartBackoff)
+	}
+	for range 20 {
+		d.restartDue("vm", d.restarts["vm"].next)
+	}
+	at := d.restarts["vm"].next
+	d.restartDue("vm", at)
+	if got := d.restarts["vm"].next.Sub(at); got != maxRestartBackoff {
+		t.Errorf("backoff = %s, want cap %s", got, maxRestartBackoff)
+	}
+}
+
+func TestReconcileState(t *testing.T) {
+	hyper := &fakeHyper{
+		vms: []*types.VM{
+			{ID: "alive", State: types.VMStateRunning, PID: os.Getpid()},
+			{ID: "dead-always", State: types.VMStateRunning, Config: types.VMConfig{RestartPolicy: types.RestartPolicyAlways}},
+		},
+		repair: &hypervisor.RuntimeRepair{Adopted: []string{"orphan-vmm"}, Cleaned: []string{"leftover"}},
+	}
+	d := New(&config.Config{LogDir: t.TempDir()}, hyper, nil, nil)
+
+	report, err := d.ReconcileState(t.Context())
+	if err != nil {
+		t.Fatalf("ReconcileState: %v", err)
+	}
+	if !slices.Equal(report.Stale, []string{"dead-always"}) {
+		t.Errorf("stale = %v", report.Stale)
+	}
+	if len(hyper.started) != 0 || len(report.Restarted) != 0 {
+		t.Errorf("ReconcileState must not restart VMs, started %v", hyper.started)
+	}
+	if !slices.Equal(report.Adopted, []string{"orphan-vmm"}) || !slices.Equal(report.Cleaned, []string{"leftover"}) {
+		t.Errorf("adopted = %v, cleaned = %v", report.Adopted, report.Cleaned)
+	}
+}
@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+const (
+	forwardDialTimeout = 5 * time.Second
+	// udpSessionIdle is how long a UDP client may stay silent before its
+	// relay socket to the guest is released.
+	udpSessionIdle = 60 * time.Second
+	udpBufferSize  = 64 << 10
+)
+
+// forwarder relays one published host port to a guest address.
+type forwarder struct {
+	mapping types.PortMapping
+	target  string // guest ip:port
+	since   time.Time
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[io.Closer]struct{} // sockets of active TCP relays or UDP sessions
+	lis    io.Closer
+
+	// Metrics for "cocoon port ls".
+	active, total, failed atomic.Int64
+	bytesIn, bytesOut     atomic.Uint64
+}
+
+// listenForward binds m's host address and starts relaying to guestIP.
+func listenForward(ctx context.Context, m types.PortMapping, guestIP string) (*forwarder, error) {
+	f := &forwarder{
+		mapping: m,
+		target:  net.JoinHostPort(guestIP, strconv.Itoa(m.GuestPort)),
+		since:   time.Now(),
+		conns:   map[io.Closer]struct{}{},
+	}
+	lc := &net.ListenConfig{}
+	if m.Protocol == types.ProtocolUDP {
+		pc, err := lc.ListenPacket(ctx, "udp", m.HostAddr())
+		if err != nil {
+			return nil, err
+		}
+		f.lis = pc
+		go f.serveUDP(ctx, pc)
+		return f, nil
+	}
+	lis, err := lc.Listen(ctx, "tcp", m.HostAddr())
+	if err != nil {
+		return nil, err
+	}
+	f.lis = lis
+	go f.serveTCP(ctx, lis)
+	return f, nil
+}
+
+// Close stops listening and drops every active relay.
+func (f *forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	for c := range f.conns {
+		_ = c.Close()
+	}
+	return f.lis.Close()
+}
+
+// stats returns the forwarder's metrics so far.
+func (f *forwarder) stats() PortStats {
+	return PortStats{
+		Active:   f.active.Load(),
+		Total:    f.total.Load(),
+		Failed:   f.failed.Load(),
+		BytesIn:  f.bytesIn.Load(),
+		BytesOut: f.bytesOut.Load(),
+	}
+}
+
+// track registers an active relay; false means the forwarder is closed.
+func (f *forwarder) track(c io.Closer) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[c] = struct{}{}
+	return true
+}
+
+func (f *forwarder) untrack(c io.Closer) {
+	f.mu.Lock()
+	delete(f.conns, c)
+	f.mu.Unlock()
+	_ = c.Close()
+}
+
+func (f *forwarder) serveTCP(ctx context.Context, lis net.Listener) {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.WithFunc("daemon.forward").Warnf(ctx, "accept on %s: %v", f.mapping, err)
+			}
+			return
+		}
+		go f.relayTCP(ctx, conn)
+	}
+}
+
+func (f *forwarder) relayTCP(ctx context.Context, client net.Conn) {
+	dialCtx, cancel := context.WithTimeout(ctx, forwardDialTimeout)
+	guest, err := (&net.Dialer{}).DialContext(dialCtx, "tcp", f.target)
+	cancel()
+	if err != nil {
+		f.failed.Add(1)
+		log.WithFunc("daemon.forward").Debugf(ctx, "dial %s for %s: %v", f.target, f.mapping, err)
+		_ = client.Close()
+		return
+	}
+	if !f.track(client) {
+		_ = client.Close()
+		_ = guest.Close()
+		return
+	}
+	if !f.track(guest) {
+		f.untrack(client)
+		_ = guest.Close()
+		return
+	}
+	defer f.untrack(client)
+	defer f.untrack(guest)
+	f.total.Add(1)
+	f.active.Add(1)
+	defer f.active.Add(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(2) //nolint:mnd
+	go func() { defer wg.Done(); f.bytesIn.Add(pipe(guest, client)) }()
+	go func() { defer wg.Done(); f.bytesOut.Add(pipe(client, guest)) }()
+	wg.Wait()
+}
+
+// pipe copies src to dst, then half-closes dst so the peer sees EOF while
+// the other direction keeps flowing. Returns the bytes copied.
+func pipe(dst, src net.Conn) uint64 {
+	n, _ := io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		_ = dst.Close()
+	}
+	return uint64(max(n, 0))
+}
+
+// serveUDP relays datagrams through one connected socket per client, so
+// guest replies find their way back to the right sender.
+func (f *forwarder) serveUDP(ctx context.Context, pc net.PacketConn) {
+	var mu sync.Mutex
+	sessions := map[string]net.Conn{}
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, client, err := pc.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.WithFunc("daemon.forward").Warnf(ctx, "read on %s: %v", f.mapping, err)
+			}
+			return
+		}
+		key := client.String()
+		mu.Lock()
+		guest, ok := sessions[key]
+		mu.Unlock()
+		if !ok {
+			if guest, err = (&net.Dialer{}).DialContext(ctx, "udp", f.target); err != nil {
+				f.failed.Add(1)
+				log.WithFunc("daemon.forward").Debugf(ctx, "dial %s for %s: %v", f.target, f.mapping, err)
+				continue
+			}
+			if !f.track(guest) {
+				_ = guest.Close()
+				return
+			}
+			mu.Lock()
+			sessions[key] = guest
+			mu.Unlock()
+			f.total.Add(1)
+			f.active.Add(1)
+			go func() {
+				defer func() {
+					mu.Lock()
+					delete(sessions, key)
+					mu.Unlock()
+					f.untrack(guest)
+					f.active.Add(-1)
+				}()
+				f.replyUDP(pc, guest, client)
+			}()
+		}
+		_ = guest.SetReadDeadline(time.Now().Add(udpSessionIdle))
+		if _, err := guest.Write(buf[:n]); err != nil {
+			log.WithFunc("daemon.forward").Debugf(ctx, "send to %s for %s: %v", f.target, f.mapping, err)
+			continue
+		}
+		f.bytesIn.Add(uint64(n))
+	}
+}
+
+// replyUDP copies guest replies back to client until the session idles out.
+func (f *forwarder) replyUDP(pc net.PacketConn, guest net.Conn, client net.Addr) {
+	buf := make([]byte, udpBufferSize)
+	for {
+		n, err := guest.Read(buf)
+		if err != nil {
+			return
+		}
+		_ = guest.SetReadDeadline(time.Now().Add(udpSessionIdle))
+		if _, err := pc.WriteTo(buf[:n], client); err != nil {
+			return
+		}
+		f.bytesOut.Add(uint64(n))
+	}
+}
@@ -0,0 +1,334 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/projecteru2/core/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	apiv1 "github.com/projecteru2/cocoon/api/v1"
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/progress"
+	cloudimgProgress "github.com/projecteru2/cocoon/progress/cloudimg"
+	ociProgress "github.com/projecteru2/cocoon/progress/oci"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// consoleChunkSize is the read buffer for console output frames.
+const consoleChunkSize = 4096
+
+// grpcService implements apiv1.CocoonServiceServer on top of the same
+// backends the CLI uses.
+type grpcService struct {
+	apiv1.UnimplementedCocoonServiceServer
+
+	conf  *config.Config
+	hyper hypervisor.Hypervisor
+}
+
+// NewGRPCServer builds a gRPC server exposing the cocoon control API.
+func NewGRPCServer(conf *config.Config, hyper hypervisor.Hypervisor) *grpc.Server {
+	srv := grpc.NewServer()
+	apiv1.RegisterCocoonServiceServer(srv, &grpcService{conf: conf, hyper: hyper})
+	return srv
+}
+
+func (s *grpcService) CreateVM(ctx context.Context, req *apiv1.CreateVMRequest) (*apiv1.VM, error) {
+	c := req.GetConfig()
+	if c == nil {
+		return nil, status.Error(codes.InvalidArgument, "config is required")
+	}
+	vmCfg := &types.VMConfig{
+		Name:          c.GetName(),
+		CPU:           int(c.GetCpu()),
+		Memory:        c.GetMemory(),
+		Storage:       c.GetStorage(),
+		Image:         c.GetImage(),
+		Network:       c.GetNetwork(),
+		RestartPolicy: types.RestartPolicy(c.GetRestartPolicy()),
+		HealthCheck:   healthCheckFromProto(c.GetHealthCheck()),
+		Labels:        c.GetLabels(),
+	}
+	if err := vmCfg.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	vm, hyper, err := service.CreateVM(ctx, s.conf, vmCfg, int(req.GetNics()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if req.GetStart() {
+		if _, err := hyper.Start(ctx, []string{vm.ID}); err != nil {
+			return nil, toStatus(fmt.Errorf("start VM %s: %w", vm.ID, err))
+		}
+		if vm, err = hyper.Inspect(ctx, vm.ID); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return vmToProto(vm), nil
+}
+
+func (s *grpcService) StartVM(ctx context.Context, req *apiv1.VMRefsRequest) (*apiv1.VMRefsResponse, error) {
+	service.RecoverNetwork(ctx, s.conf, s.hyper, req.GetRefs())
+	ids, err := s.hyper.Start(ctx, req.GetRefs())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &apiv1.VMRefsResponse{Ids: ids}, nil
+}
+
+func (s *grpcService) StopVM(ctx context.Context, req *apiv1.VMRefsRequest) (*apiv1.VMRefsResponse, error) {
+	ids, err := s.hyper.Stop(ctx, req.GetRefs())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &apiv1.VMRefsResponse{Ids: ids}, nil
+}
+
+func (s *grpcService) ListVMs(ctx context.Context, _ *apiv1.ListVMsRequest) (*apiv1.ListVMsResponse, error) {
+	vms, err := s.hyper.List(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &apiv1.ListVMsResponse{}
+	for _, vm := range vms {
+		resp.Vms = append(resp.Vms, vmToProto(vm))
+	}
+	return resp, nil
+}
+
+func (s *grpcService) PullImage(req *apiv1.PullImageRequest, stream grpc.ServerStreamingServer[apiv1.PullImageProgress]) error {
+	ctx := stream.Context()
+	ref := req.GetRef()
+	if ref == "" {
+		return status.Error(codes.InvalidArgument, "ref is required")
+	}
+	ociStore, cloudimgStore, err := service.InitImageBackendsForPull(ctx, s.conf)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	// Trackers may fire from several goroutines; serialize sends and keep
+	// the first send error so the pull is reported as failed.
+	events := make(chan *apiv1.PullImageProgress, 16) //nolint:mnd
+	sendErr := make(chan error, 1)
+	go func() {
+		var first error
+		for ev := range events {
+			if first == nil {
+				first = stream.Send(ev)
+			}
+		}
+		sendErr <- first
+	}()
+
+	var pullErr error
+	if service.IsURL(ref) {
+		pullErr = cloudimgStore.Pull(ctx, ref, progress.NewTracker(func(e cloudimgProgress.Event) {
+			events <- cloudimgEventToProto(e)
+		}))
+	} else {
+		pullErr = ociStore.Pull(ctx, ref, progress.NewTracker(func(e ociProgress.Event) {
+			events <- ociEventToProto(e)
+		}))
+	}
+	close(events)
+	if err := <-sendErr; err != nil {
+		return err
+	}
+	if pullErr != nil {
+		return toStatus(fmt.Errorf("pull %s: %w", ref, pullErr))
+	}
+	return nil
+}
+
+func (s *grpcService) StreamConsole(stream grpc.BidiStreamingServer[apiv1.ConsoleInput, apiv1.ConsoleOutput]) error {
+	ctx := stream.Context()
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if first.GetRef() == "" {
+		return status.Error(codes.InvalidArgument, "first message must carry the VM ref")
+	}
+
+	conn, err := s.hyper.Console(ctx, first.GetRef())
+	if err != nil {
+		return toStatus(err)
+	}
+	defer conn.Close() //nolint:errcheck
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close() //nolint:errcheck,gosec
+	})
+	defer stop()
+
+	if data := first.GetData(); len(data) > 0 {
+		if _, err := conn.Write(data); err != nil {
+			return fmt.Errorf("write console: %w", err)
+		}
+	}
+
+	// Client → console. Ends when the client half-closes or the stream breaks.
+	go func() {
+		for {
+			in, recvErr := stream.Recv()
+			if recvErr != nil {
+				return
+			}
+			if _, writeErr := conn.Write(in.GetData()); writeErr != nil {
+				log.WithFunc("daemon.StreamConsole").Warnf(ctx, "write console %s: %v", first.GetRef(), writeErr)
+				return
+			}
+		}
+	}()
+
+	// Console → client.
+	buf := make([]byte, consoleChunkSize)
+	for {
+		n, readErr := conn.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&apiv1.ConsoleOutput{Data: append([]byte(nil), buf[:n]...)}); err != nil {
+				return err
+			}
+		}
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("read console: %w", readErr)
+		}
+	}
+}
+
+// toStatus maps backend sentinel errors to gRPC status codes.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, hypervisor.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, hypervisor.ErrNotRunning):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func vmToProto(vm *types.VM) *apiv1.VM {
+	out := &apiv1.VM{
+		Id:    vm.ID,
+		State: string(vm.State),
+		Config: &apiv1.VMConfig{
+			Name:          vm.Config.Name,
+			Cpu:           int32(vm.Config.CPU), //nolint:gosec
+			Memory:        vm.Config.Memory,
+			Storage:       vm.Config.Storage,
+			Image:         vm.Config.Image,
+			Network:       vm.Config.Network,
+			RestartPolicy: string(vm.Config.RestartPolicy),
+			HealthCheck:   healthCheckToProto(vm.Config.HealthCheck),
+			Labels:        vm.Config.Labels,
+		},
+		Pid:       int32(vm.PID), //nolint:gosec
+		CreatedAt: timestamppb.New(vm.CreatedAt),
+		UpdatedAt: timestamppb.New(vm.UpdatedAt),
+		StartedAt: optionalTimestamp(vm.StartedAt),
+		StoppedAt: optionalTimestamp(vm.StoppedAt),
+	}
+	if vm.Health != nil {
+		out.Health = string(vm.Health.Status)
+	}
+	for _, nc := range vm.NetworkConfigs {
+		if nc == nil {
+			continue
+		}
+		n := &apiv1.NetworkConfig{Tap: nc.Tap, Mac: nc.Mac, Ip: nc.IP()}
+		if nc.Network != nil {
+			n.Gateway = nc.Network.Gateway
+			n.Prefix = int32(nc.Network.Prefix) //nolint:gosec
+		}
+		out.Networks = append(out.Networks, n)
+	}
+	return out
+}
+
+func healthCheckFromProto(hc *apiv1.HealthCheck) *types.HealthCheck {
+	if hc == nil {
+		return nil
+	}
+	return &types.HealthCheck{
+		Type:            types.HealthCheckType(hc.GetType()),
+		Port:            int(hc.GetPort()),
+		Path:            hc.GetPath(),
+		IntervalSeconds: int(hc.GetIntervalSeconds()),
+		TimeoutSeconds:  int(hc.GetTimeoutSeconds()),
+		Retries:         int(hc.GetRetries()),
+	}
+}
+
+func healthCheckToProto(hc *types.HealthCheck) *apiv1.HealthCheck {
+	if hc == nil {
+		return nil
+	}
+	return &apiv1.HealthCheck{
+		Type:            string(hc.Type),
+		Port:            int32(hc.Port), //nolint:gosec
+		Path:            hc.Path,
+		IntervalSeconds: int32(hc.IntervalSeconds), //nolint:gosec
+		TimeoutSeconds:  int32(hc.TimeoutSeconds),  //nolint:gosec
+		Retries:         int32(hc.Retries),         //nolint:gosec
+	}
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func ociEventToProto(e ociProgress.Event) *apiv1.PullImageProgress {
+	p := &apiv1.PullImageProgress{
+		LayerIndex: int32(e.Index), //nolint:gosec
+		LayerTotal: int32(e.Total), //nolint:gosec
+		Digest:     e.Digest,
+	}
+	switch e.Phase {
+	case ociProgress.PhasePull:
+		p.Phase = apiv1.PullImageProgress_PHASE_RESOLVE
+	case ociProgress.PhaseLayer:
+		p.Phase = apiv1.PullImageProgress_PHASE_LAYER
+	case ociProgress.PhaseCommit:
+		p.Phase = apiv1.PullImageProgress_PHASE_COMMIT
+	case ociProgress.PhaseDone:
+		p.Phase = apiv1.PullImageProgress_PHASE_DONE
+	}
+	return p
+}
+
+func cloudimgEventToProto(e cloudimgProgress.Event) *apiv1.PullImageProgress {
+	p := &apiv1.PullImageProgress{
+		BytesDone:  e.BytesDone,
+		BytesTotal: e.BytesTotal,
+	}
+	switch e.Phase {
+	case cloudimgProgress.PhaseDownload:
+		p.Phase = apiv1.PullImageProgress_PHASE_DOWNLOAD
+	case cloudimgProgress.PhaseConvert:
+		p.Phase = apiv1.PullImageProgress_PHASE_CONVERT
+	case cloudimgProgress.PhaseCommit:
+		p.Phase = apiv1.PullImageProgress_PHASE_COMMIT
+	case cloudimgProgress.PhaseDone:
+		p.Phase = apiv1.PullImageProgress_PHASE_DONE
+	}
+	return p
+}
@@ -0,0 +1,117 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	apiv1 "github.com/projecteru2/cocoon/api/v1"
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func dialTestServer(t *testing.T, hyper hypervisor.Hypervisor) apiv1.CocoonServiceClient {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	lis, err := (&net.ListenConfig{}).Listen(t.Context(), "unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := NewGRPCServer(&config.Config{RootDir: t.TempDir(), RunDir: t.TempDir()}, hyper)
+	go srv.Serve(lis) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("unix://"+sock, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec
+	return apiv1.NewCocoonServiceClient(conn)
+}
+
+func TestGRPCListVMs(t *testing.T) {
+	started := time.Now()
+	hyper := &fakeHyper{vms: []*types.VM{{
+		ID:     "abc123",
+		State:  types.VMStateRunning,
+		Config: types.VMConfig{Name: "web", CPU: 2, Memory: 1 << 30},
+		NetworkConfigs: []*types.NetworkConfig{{
+			Tap: "tap0", Mac: "aa:bb:cc:dd:ee:ff",
+			Network: &types.Network{IP: "10.0.0.2", Prefix: 24},
+		}},
+		StartedAt: &started,
+	}}}
+	client := dialTestServer(t, hyper)
+
+	resp, err := client.ListVMs(t.Context(), &apiv1.ListVMsRequest{})
+	if err != nil {
+		t.Fatalf("ListVMs: %v", err)
+	}
+	if len(resp.GetVms()) != 1 {
+		t.Fatalf("got %d VMs, want 1", len(resp.GetVms()))
+	}
+	vm := resp.GetVms()[0]
+	if vm.GetId() != "abc123" || vm.GetConfig().GetName() != "web" || vm.GetState() != "running" {
+		t.Errorf("unexpected VM: %v", vm)
+	}
+	if got := vm.GetNetworks()[0].GetIp(); got != "10.0.0.2" {
+		t.Errorf("ip = %q", got)
+	}
+	if vm.GetStartedAt() == nil || vm.GetStoppedAt() != nil {
+		t.Errorf("timestamps not mapped: started=%v stopped=%v", vm.GetStartedAt(), vm.GetStoppedAt())
+	}
+}
+
+func TestGRPCStartStopVM(t *testing.T) {
+	hyper := &fakeHyper{}
+	client := dialTestServer(t, hyper)
+
+	resp, err := client.StartVM(t.Context(), &apiv1.VMRefsRequest{Refs: []string{"a", "b"}})
+	if err != nil {
+		t.Fatalf("StartVM: %v", err)
+	}
+	if !slices.Equal(resp.GetIds(), []string{"a", "b"}) || !slices.Equal(hyper.started, []string{"a", "b"}) {
+		t.Errorf("started = %v / %v", resp.GetIds(), hyper.started)
+	}
+	if _, err := client.StopVM(t.Context(), &apiv1.VMRefsRequest{Refs: []string{"a"}}); err != nil {
+		t.Fatalf("StopVM: %v", err)
+	}
+	if !slices.Equal(hyper.stopped, []string{"a"}) {
+		t.Errorf("stopped = %v", hyper.stopped)
+	}
+}
+
+func TestGRPCCreateVMValidates(t *testing.T) {
+	client := dialTestServer(t, &fakeHyper{})
+	_, err := client.CreateVM(t.Context(), &apiv1.CreateVMRequest{Config: &apiv1.VMConfig{Name: "x"}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got %v, want InvalidArgument", err)
+	}
+}
+
+func TestToStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("inspect: %w", hypervisor.ErrNotFound), codes.NotFound},
+		{fmt.Errorf("console: %w", hypervisor.ErrNotRunning), codes.FailedPrecondition},
+		{context.Canceled, codes.Canceled},
+		{fmt.Errorf("boom"), codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := status.Code(toStatus(tt.err)); got != tt.want {
+			t.Errorf("toStatus(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
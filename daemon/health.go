@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// reconcileHealth probes running VMs whose health check is due, records the
+// result via hypervisor.HealthRecorder, and restarts unhealthy VMs that have
+// restart policy "always" (sharing the crash-restart backoff).
+func (d *Daemon) reconcileHealth(ctx context.Context, vms []*types.VM, now time.Time, report *Report) error {
+	var due []*types.VM
+	for _, vm := range vms {
+		hc := vm.Config.HealthCheck
+		if hc == nil || vm.State != types.VMStateRunning || IsStale(vm) {
+			delete(d.probed, vm.ID)
+			continue
+		}
+		if last, ok := d.probed[vm.ID]; ok && now.Sub(last) < hc.Interval() {
+			continue
+		}
+		d.probed[vm.ID] = now
+		due = append(due, vm)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// Probe concurrently so one slow guest cannot delay the others by its
+	// full timeout.
+	results := make([]error, len(due))
+	var wg sync.WaitGroup
+	for i, vm := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = probe(ctx, vm)
+		}()
+	}
+	wg.Wait()
+
+	recorder, _ := d.hyper.(hypervisor.HealthRecorder)
+	var errs []error
+	var restart []string
+	for i, vm := range due {
+		health := vm.Health.Observe(vm.Config.HealthCheck, results[i], now)
+		if recorder != nil {
+			if err := recorder.SetHealth(ctx, vm.ID, health); err != nil {
+				errs = append(errs, fmt.Errorf("record health of %s: %w", vm.ID, err))
+			}
+		}
+		if health.Status != types.HealthUnhealthy {
+			continue
+		}
+		report.Unhealthy = append(report.Unhealthy, vm.ID)
+		if vm.Health == nil || vm.Health.Status != types.HealthUnhealthy {
+			events.Record(ctx, d.conf, types.Event{Type: types.EventUnhealthy, ID: vm.ID, Name: vm.Config.Name, Message: health.LastError})
+		}
+		if vm.Config.RestartPolicy == types.RestartPolicyAlways && d.restartDue(vm.ID, now) {
+			restart = append(restart, vm.ID)
+		}
+	}
+	if len(restart) == 0 {
+		return errors.Join(errs...)
+	}
+
+	stopped, stopErr := d.hyper.Stop(ctx, restart)
+	if stopErr != nil {
+		errs = append(errs, fmt.Errorf("stop unhealthy VMs: %w", stopErr))
+	}
+	if len(stopped) > 0 {
+		started, startErr := d.startOwed(ctx, stopped)
+		report.Restarted = append(report.Restarted, started...)
+		if startErr != nil {
+			errs = append(errs, fmt.Errorf("restart unhealthy VMs: %w", startErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// probeTransport reaches guests directly, never through a proxy from the
+// environment, and keeps no idle connections to them between probes.
+var probeTransport = &http.Transport{DisableKeepAlives: true}
+
+// probeClient returns the HTTP client of one probe. Redirects are not
+// followed, so a 3xx is the guest's own answer rather than that of whatever
+// it points to, and the whole exchange is bounded by timeout.
+func probeClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: probeTransport,
+		Timeout:   timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// probe runs vm's health check once against its first guest IP.
+func probe(ctx context.Context, vm *types.VM) error {
+	hc := vm.Config.HealthCheck
+	ip := vm.PrimaryIP()
+	if ip == "" {
+		return errors.New("VM has no IP address")
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(hc.Port))
+
+	ctx, cancel := context.WithTimeout(ctx, hc.Timeout())
+	defer cancel()
+
+	switch hc.Type {
+	case types.HealthCheckHTTP:
+		path := hc.Path
+		if path == "" {
+			path = "/"
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := probeClient(hc.Timeout()).Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("GET %s: HTTP %d", path, resp.StatusCode)
+		}
+		return nil
+	default:
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestReconcileHealth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	running := func(id string, hc *types.HealthCheck, policy types.RestartPolicy) *types.VM {
+		return &types.VM{
+			ID: id, State: types.VMStateRunning, PID: os.Getpid(),
+			Config:         types.VMConfig{HealthCheck: hc, RestartPolicy: policy},
+			NetworkConfigs: []*types.NetworkConfig{{Network: &types.Network{IP: host}}},
+		}
+	}
+	hyper := &fakeHyper{vms: []*types.VM{
+		running("tcp-ok", &types.HealthCheck{Type: types.HealthCheckTCP, Port: port}, ""),
+		running("http-ok", &types.HealthCheck{Type: types.HealthCheckHTTP, Port: port, Path: "/ok"}, ""),
+		running("http-bad", &types.HealthCheck{Type: types.HealthCheckHTTP, Port: port, Path: "/bad", Retries: 1}, ""),
+		running("http-bad-always", &types.HealthCheck{Type: types.HealthCheckHTTP, Port: port, Path: "/bad", Retries: 1}, types.RestartPolicyAlways),
+		running("unchecked", nil, ""),
+	}}
+	d := New(&config.Config{LogDir: t.TempDir()}, hyper, nil, nil)
+
+	report, err := d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := map[string]types.HealthStatus{
+		"tcp-ok":          types.HealthHealthy,
+		"http-ok":         types.HealthHealthy,
+		"http-bad":        types.HealthUnhealthy,
+		"http-bad-always": types.HealthUnhealthy,
+	}
+	for _, vm := range hyper.vms {
+		if w, ok := want[vm.ID]; ok {
+			if vm.Health == nil || vm.Health.Status != w {
+				t.Errorf("%s health = %+v, want %s", vm.ID, vm.Health, w)
+			}
+		} else if vm.Health != nil {
+			t.Errorf("%s should not be probed, got %+v", vm.ID, vm.Health)
+		}
+	}
+	slices.Sort(report.Unhealthy)
+	if !slices.Equal(report.Unhealthy, []string{"http-bad", "http-bad-always"}) {
+		t.Errorf("unhealthy = %v", report.Unhealthy)
+	}
+	if !slices.Equal(report.Restarted, []string{"http-bad-always"}) || !slices.Equal(hyper.stopped, []string{"http-bad-always"}) {
+		t.Errorf("restarted = %v, stopped = %v", report.Restarted, hyper.stopped)
+	}
+
+	// Within the interval nothing is probed again.
+	report, err = d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.Unhealthy) != 0 {
+		t.Errorf("probed inside interval: %v", report.Unhealthy)
+	}
+}
+
+func TestProbeNoIP(t *testing.T) {
+	vm := &types.VM{Config: types.VMConfig{HealthCheck: &types.HealthCheck{Type: types.HealthCheckTCP, Port: 22}}}
+	if err := probe(t.Context(), vm); err == nil {
+		t.Fatal("expected error for VM without IP")
+	}
+}
+
+func TestProbeHTTPRedirect(t *testing.T) {
+	followed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elsewhere" {
+			followed = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer srv.Close()
+	host, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	vm := &types.VM{
+		Config:         types.VMConfig{HealthCheck: &types.HealthCheck{Type: types.HealthCheckHTTP, Port: port, Path: "/health"}},
+		NetworkConfigs: []*types.NetworkConfig{{Network: &types.Network{IP: host}}},
+	}
+	if err := probe(t.Context(), vm); err != nil {
+		t.Errorf("probe answered with a redirect: %v", err)
+	}
+	if followed {
+		t.Error("probe followed the redirect")
+	}
+	if c := probeClient(vm.Config.HealthCheck.Timeout()); c.Timeout != types.DefaultHealthTimeout {
+		t.Errorf("probe client timeout = %v, want %v", c.Timeout, types.DefaultHealthTimeout)
+	}
+}
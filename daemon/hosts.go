@@ -0,0 +1,55 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const hostsHeader = "# Running cocoon VMs, rewritten by the cocoon daemon. Do not edit.\n"
+
+// reconcileHosts registers each running VM's name under its primary IP in
+// the hosts_file, for a host-local resolver such as dnsmasq (--hostsdir or
+// --addn-hosts) to serve. The file is only rewritten when an entry changed,
+// so resolvers watching it are not woken every pass.
+func (d *Daemon) reconcileHosts(vms []*types.VM) error {
+	path := d.conf.HostsFile
+	if path == "" {
+		return nil
+	}
+	data := hostsFile(vms, d.conf.DNSDomain)
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) { //nolint:gosec
+		return nil
+	}
+	if err := utils.AtomicWriteFile(path, data, 0o644); err != nil { //nolint:mnd
+		return fmt.Errorf("write hosts file %s: %w", path, err)
+	}
+	return nil
+}
+
+// hostsFile renders one "IP name.domain name" line per running VM that
+// has an IP, sorted by name. Usermode VMs are skipped: every one of them
+// has the same guest address behind its own passt.
+func hostsFile(vms []*types.VM, domain string) []byte {
+	domain = strings.Trim(domain, ".")
+	running := slices.DeleteFunc(slices.Clone(vms), func(vm *types.VM) bool {
+		return vm.State != types.VMStateRunning || IsStale(vm) || vm.PrimaryIP() == "" || UsermodeVM(vm)
+	})
+	slices.SortFunc(running, func(a, b *types.VM) int { return strings.Compare(a.Config.Name, b.Config.Name) })
+
+	var buf bytes.Buffer
+	buf.WriteString(hostsHeader)
+	for _, vm := range running {
+		if domain != "" {
+			fmt.Fprintf(&buf, "%s\t%s.%s %s\n", vm.PrimaryIP(), vm.Config.Name, domain, vm.Config.Name)
+			continue
+		}
+		fmt.Fprintf(&buf, "%s\t%s\n", vm.PrimaryIP(), vm.Config.Name)
+	}
+	return buf.Bytes()
+}
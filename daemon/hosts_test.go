@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestReconcileHosts(t *testing.T) {
+	vm := func(name, ip string, state types.VMState) *types.VM {
+		return &types.VM{
+			ID:             name,
+			State:          state,
+			PID:            os.Getpid(),
+			Config:         types.VMConfig{Name: name},
+			NetworkConfigs: []*types.NetworkConfig{{Network: &types.Network{IP: ip}}},
+		}
+	}
+	usermode := vm("passt", "10.0.2.15", types.VMStateRunning)
+	usermode.NetworkConfigs[0].UserSocket = "/run/usermode/passt/passt.sock"
+	vms := []*types.VM{
+		vm("web", "10.88.0.3", types.VMStateRunning),
+		vm("db", "10.88.0.2", types.VMStateRunning),
+		vm("old", "10.88.0.4", types.VMStateStopped),
+		vm("pending", "", types.VMStateRunning),
+		usermode,
+	}
+	path := filepath.Join(t.TempDir(), "hosts")
+	d := New(&config.Config{HostsFile: path, DNSDomain: "cocoon."}, &fakeHyper{}, nil, nil)
+
+	if err := d.reconcileHosts(vms); err != nil {
+		t.Fatalf("reconcileHosts: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hostsHeader + "10.88.0.2\tdb.cocoon db\n10.88.0.3\tweb.cocoon web\n"
+	if string(data) != want {
+		t.Errorf("hosts file = %q, want %q", data, want)
+	}
+
+	// An unchanged set leaves the file alone.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.reconcileHosts(vms); err != nil {
+		t.Fatalf("reconcileHosts: %v", err)
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.ModTime().Equal(old) {
+		t.Errorf("unchanged hosts file was rewritten: %v", err)
+	}
+
+	if got := string(hostsFile(vms[:1], "")); got != hostsHeader+"10.88.0.3\tweb\n" {
+		t.Errorf("hosts file without domain = %q", got)
+	}
+	if err := New(&config.Config{}, &fakeHyper{}, nil, nil).reconcileHosts(vms); err != nil {
+		t.Errorf("reconcileHosts without hosts_file: %v", err)
+	}
+}
@@ -0,0 +1,385 @@
+package daemon
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/api"
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/metadata"
+	"github.com/projecteru2/cocoon/progress"
+	"github.com/projecteru2/cocoon/service"
+	"github.com/projecteru2/cocoon/types"
+)
+
+const httpReadHeaderTimeout = 10 * time.Second
+
+// CreateVMRequest is the body of POST /v1/vms.
+type CreateVMRequest struct {
+	Config types.VMConfig `json:"config"`
+	NICs   int            `json:"nics"`
+	Start  bool           `json:"start"`
+}
+
+// PullImageRequest is the body of POST /v1/images.
+type PullImageRequest struct {
+	Ref string `json:"ref"`
+}
+
+// IDsResponse lists the VM or image IDs affected by a batch operation.
+type IDsResponse struct {
+	IDs []string `json:"ids"`
+}
+
+// ErrorResponse is returned with every non-2xx status.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// errBadRequest marks client errors (malformed body, invalid config).
+var errBadRequest = errors.New("bad request")
+
+// httpAPI exposes hypervisor.Hypervisor and images.Images operations as
+// JSON over HTTP.
+type httpAPI struct {
+	conf  *config.Config
+	hyper hypervisor.Hypervisor
+}
+
+// NewHTTPHandler returns the JSON/HTTP API handler. The OpenAPI document is
+// served at /openapi.yaml.
+func NewHTTPHandler(conf *config.Config, hyper hypervisor.Hypervisor) http.Handler {
+	a := &httpAPI{conf: conf, hyper: hyper}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.yaml", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(api.OpenAPI)
+	})
+	mux.HandleFunc("GET /v1/vms", a.listVMs)
+	mux.HandleFunc("POST /v1/vms", a.createVM)
+	mux.HandleFunc("GET /v1/vms/{ref}", a.inspectVM)
+	mux.HandleFunc("DELETE /v1/vms/{ref}", a.deleteVM)
+	mux.HandleFunc("POST /v1/vms/{ref}/start", a.startVM)
+	mux.HandleFunc("POST /v1/vms/{ref}/stop", a.stopVM)
+	mux.HandleFunc("GET /v1/vms/{ref}/stats", a.statsVM)
+	mux.HandleFunc("GET /v1/images", a.listImages)
+	mux.HandleFunc("POST /v1/images", a.pullImage)
+	mux.HandleFunc("GET /v1/images/{ref}", a.inspectImage)
+	mux.HandleFunc("DELETE /v1/images/{ref}", a.deleteImage)
+	return mux
+}
+
+func (a *httpAPI) listVMs(w http.ResponseWriter, r *http.Request) {
+	vms, err := a.hyper.List(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	out := make([]*types.VM, 0, len(vms))
+	for _, vm := range vms {
+		out = append(out, vm.Redacted())
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *httpAPI) createVM(w http.ResponseWriter, r *http.Request) {
+	var req CreateVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w: decode body: %v", errBadRequest, err))
+		return
+	}
+	// The daemon would exec the binary as itself: API clients get the
+	// host's ch_binary, and only the CLI can pick another one.
+	if req.Config.CHBinary != "" {
+		writeError(w, fmt.Errorf("%w: ch_binary cannot be set through the API", errBadRequest))
+		return
+	}
+	// A source is a host file the daemon would read into the guest as
+	// itself: API clients send contents.
+	for _, f := range req.Config.Files {
+		if f.Source != "" {
+			writeError(w, fmt.Errorf("%w: files[].source cannot be set through the API", errBadRequest))
+			return
+		}
+	}
+	if err := req.Config.Validate(); err != nil {
+		writeError(w, fmt.Errorf("%w: %v", errBadRequest, err))
+		return
+	}
+	if req.Config.UserData != "" {
+		if err := metadata.ValidateUserData(req.Config.UserData, req.Config.ReplaceUserData, req.Config.TemplateUserData); err != nil {
+			writeError(w, fmt.Errorf("%w: user_data: %v", errBadRequest, err))
+			return
+		}
+	}
+	ctx := r.Context()
+	vm, hyper, err := service.CreateVM(ctx, a.conf, &req.Config, req.NICs)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Start {
+		if _, err := hyper.Start(ctx, []string{vm.ID}); err != nil {
+			writeError(w, fmt.Errorf("start VM %s: %w", vm.ID, err))
+			return
+		}
+		if vm, err = hyper.Inspect(ctx, vm.ID); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusCreated, vm.Redacted())
+}
+
+func (a *httpAPI) inspectVM(w http.ResponseWriter, r *http.Request) {
+	vm, err := a.hyper.Inspect(r.Context(), r.PathValue("ref"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, vm.Redacted())
+}
+
+func (a *httpAPI) deleteVM(w http.ResponseWriter, r *http.Request) {
+	force := r.URL.Query().Get("force") == "true"
+	deleted, err := service.DeleteVMs(r.Context(), a.conf, a.hyper, []string{r.PathValue("ref")}, force)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, IDsResponse{IDs: deleted})
+}
+
+func (a *httpAPI) startVM(w http.ResponseWriter, r *http.Request) {
+	a.batch(w, r, func(ctx context.Context, refs []string) ([]string, error) {
+		service.RecoverNetwork(ctx, a.conf, a.hyper, refs)
+		return a.hyper.Start(ctx, refs)
+	})
+}
+
+func (a *httpAPI) stopVM(w http.ResponseWriter, r *http.Request) {
+	a.batch(w, r, a.hyper.Stop)
+}
+
+func (a *httpAPI) statsVM(w http.ResponseWriter, r *http.Request) {
+	stats, err := service.CollectStats(r.Context(), a.hyper, []string{r.PathValue("ref")})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, s := range stats {
+		writeJSON(w, http.StatusOK, s)
+	}
+}
+
+func (a *httpAPI) batch(w http.ResponseWriter, r *http.Request, fn func(context.Context, []string) ([]string, error)) {
+	ids, err := fn(r.Context(), []string{r.PathValue("ref")})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, IDsResponse{IDs: ids})
+}
+
+func (a *httpAPI) listImages(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	backends, err := service.InitImageBackends(ctx, a.conf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	all := []*types.Image{}
+	for _, b := range backends {
+		imgs, err := b.List(ctx)
+		if err != nil {
+			writeError(w, fmt.Errorf("list %s: %w", b.Type(), err))
+			return
+		}
+		all = append(all, imgs...)
+	}
+	writeJSON(w, http.StatusOK, all)
+}
+
+func (a *httpAPI) pullImage(w http.ResponseWriter, r *http.Request) {
+	var req PullImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Ref == "" {
+		writeError(w, fmt.Errorf("%w: body must be {\"ref\": \"<image>\"}", errBadRequest))
+		return
+	}
+	ctx := r.Context()
+	ociStore, cloudimgStore, err := service.InitImageBackendsForPull(ctx, a.conf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if service.IsURL(req.Ref) {
+		err = cloudimgStore.Pull(ctx, req.Ref, progress.Nop)
+	} else {
+		err = ociStore.Pull(ctx, req.Ref, progress.Nop)
+	}
+	if err != nil {
+		writeError(w, fmt.Errorf("pull %s: %w", req.Ref, err))
+		return
+	}
+	a.inspectImageRef(w, r, req.Ref, http.StatusCreated)
+}
+
+func (a *httpAPI) inspectImage(w http.ResponseWriter, r *http.Request) {
+	a.inspectImageRef(w, r, r.PathValue("ref"), http.StatusOK)
+}
+
+func (a *httpAPI) inspectImageRef(w http.ResponseWriter, r *http.Request, ref string, code int) {
+	ctx := r.Context()
+	backends, err := service.InitImageBackends(ctx, a.conf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, b := range backends {
+		img, err := b.Inspect(ctx, ref)
+		if err != nil {
+			writeError(w, fmt.Errorf("inspect %s: %w", b.Type(), err))
+			return
+		}
+		if img != nil {
+			writeJSON(w, code, img)
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("image %q not found", ref)})
+}
+
+func (a *httpAPI) deleteImage(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	backends, err := service.InitImageBackends(ctx, a.conf)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	deleted := []string{}
+	for _, b := range backends {
+		ids, err := b.Delete(ctx, []string{r.PathValue("ref")})
+		if err != nil {
+			writeError(w, fmt.Errorf("delete %s: %w", b.Type(), err))
+			return
+		}
+		deleted = append(deleted, ids...)
+	}
+	if len(deleted) == 0 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("image %q not found", r.PathValue("ref"))})
+		return
+	}
+	writeJSON(w, http.StatusOK, IDsResponse{IDs: deleted})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps backend sentinel errors to HTTP status codes, mirroring
+// toStatus for the gRPC API.
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errBadRequest):
+		code = http.StatusBadRequest
+	case errors.Is(err, hypervisor.ErrNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, hypervisor.ErrNotRunning):
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, ErrorResponse{Error: err.Error()})
+}
+
+// serveHTTP starts the HTTP API on conf.HTTPListen when configured.
+// The returned function shuts the server down.
+func (d *Daemon) serveHTTP(ctx context.Context) (func(), error) {
+	addr := d.conf.HTTPListen
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	network, address := "tcp", addr
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		network, address = "unix", path
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("remove stale socket %s: %w", path, err)
+		}
+	}
+	lis, err := (&net.ListenConfig{}).Listen(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", addr, err)
+	}
+	if network == "unix" {
+		if err := os.Chmod(address, 0o660); err != nil { //nolint:mnd
+			_ = lis.Close()
+			return nil, fmt.Errorf("chmod %s: %w", address, err)
+		}
+	}
+
+	srv := &http.Server{
+		Handler:           NewHTTPHandler(d.conf, d.hyper),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+	if d.conf.HTTPTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(d.conf.HTTPTLSCert, d.conf.HTTPTLSKey)
+		if err != nil {
+			_ = lis.Close()
+			return nil, fmt.Errorf("load TLS key pair: %w", err)
+		}
+		tlsConf := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+		if d.conf.HTTPTLSClientCA != "" {
+			if tlsConf.ClientCAs, err = loadCertPool(d.conf.HTTPTLSClientCA); err != nil {
+				_ = lis.Close()
+				return nil, err
+			}
+			tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		lis = tls.NewListener(lis, tlsConf)
+	}
+
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithFunc("daemon.serveHTTP").Warnf(ctx, "HTTP API server: %v", err)
+		}
+	}()
+	log.WithFunc("daemon.serveHTTP").Infof(ctx, "serving HTTP API on %s", addr)
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), httpReadHeaderTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+		if network == "unix" {
+			_ = os.Remove(address)
+		}
+	}, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client CA %s: no PEM certificates", path)
+	}
+	return pool, nil
+}
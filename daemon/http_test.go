@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestHTTPVMs(t *testing.T) {
+	hyper := &fakeHyper{vms: []*types.VM{
+		{ID: "abc123", State: types.VMStateStopped, Config: types.VMConfig{Name: "web", UserData: "#cloud-config\npassword: hunter2\n"}},
+		{ID: "def456", State: types.VMStateRunning, Config: types.VMConfig{Name: "db"}},
+	}}
+	h := NewHTTPHandler(&config.Config{RootDir: t.TempDir(), RunDir: t.TempDir()}, hyper)
+
+	tests := []struct {
+		method, path, body string
+		wantCode           int
+		wantBody           string
+	}{
+		{"GET", "/v1/vms", "", http.StatusOK, `"name":"web"`},
+		{"GET", "/v1/vms/web", "", http.StatusOK, `"id":"abc123"`},
+		{"GET", "/v1/vms/web", "", http.StatusOK, `"user_data":"\u003credacted: 32 bytes\u003e"`},
+		{"GET", "/v1/vms/missing", "", http.StatusNotFound, `VM not found`},
+		{"POST", "/v1/vms/web/start", "", http.StatusOK, `{"ids":["web"]}`},
+		{"POST", "/v1/vms/web/stop", "", http.StatusOK, `{"ids":["web"]}`},
+		{"GET", "/v1/vms/web/stats", "", http.StatusConflict, `not running`},
+		{"GET", "/v1/vms/db/stats", "", http.StatusOK, `"name":"db"`},
+		{"POST", "/v1/vms", "{", http.StatusBadRequest, `decode body`},
+		{"POST", "/v1/vms", `{"config":{"name":"x"}}`, http.StatusBadRequest, `--cpu`},
+		{"POST", "/v1/vms", `{"config":{"name":"x","ch_binary":"/tmp/x"}}`, http.StatusBadRequest, `ch_binary cannot be set`},
+		{"POST", "/v1/vms", `{"config":{"name":"x","files":[{"path":"/etc/x","source":"/etc/shadow"}]}}`, http.StatusBadRequest, `files[].source cannot be set`},
+		{"POST", "/v1/vms", `{"config":{"name":"x","cpu":1,"memory":536870912,"storage":10737418240,"user_data":"password: x"}}`, http.StatusBadRequest, `user_data: user-data must start with`},
+		{"POST", "/v1/images", `{}`, http.StatusBadRequest, `ref`},
+		{"GET", "/openapi.yaml", "", http.StatusOK, `openapi: 3.0.3`},
+		{"PUT", "/v1/vms", "", http.StatusMethodNotAllowed, ``},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %q does not contain %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+	list := httptest.NewRecorder()
+	h.ServeHTTP(list, httptest.NewRequest("GET", "/v1/vms", nil))
+	if strings.Contains(list.Body.String(), "hunter2") {
+		t.Errorf("list leaks user-data: %s", list.Body)
+	}
+	if !slices.Equal(hyper.started, []string{"web"}) || !slices.Equal(hyper.stopped, []string{"web"}) {
+		t.Errorf("started=%v stopped=%v", hyper.started, hyper.stopped)
+	}
+}
+
+func TestHTTPListVMsEmpty(t *testing.T) {
+	h := NewHTTPHandler(&config.Config{}, &fakeHyper{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/v1/vms", nil))
+	var vms []*types.VM
+	if err := json.Unmarshal(rec.Body.Bytes(), &vms); err != nil || vms == nil {
+		t.Fatalf("want empty JSON array, got %q (%v)", rec.Body, err)
+	}
+}
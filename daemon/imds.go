@@ -0,0 +1,176 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/metadata"
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// imdsFiles are the files a NoCloud-Net seed serves. vendor-data is
+// always empty; cloud-init fetches it regardless.
+var imdsFiles = []string{"meta-data", "user-data", "vendor-data", "network-config"}
+
+// errNotOwner refuses a guest asking for another VM's metadata.
+var errNotOwner = errors.New("client does not belong to the VM")
+
+// imds serves cloud-init NoCloud-Net seeds rendered from the VM records,
+// so they always reflect a VM's current config and a guest may fetch them
+// again after its cidata disk is gone.
+type imds struct {
+	conf  *config.Config
+	hyper hypervisor.Hypervisor
+	// neighMAC tells the MAC behind a client address; a guest taking
+	// another VM's IP still cannot take its MAC on the same link.
+	neighMAC func(netip.Addr) (net.HardwareAddr, error)
+}
+
+// NewIMDSHandler returns the NoCloud-Net metadata handler. "/<file>"
+// serves the VM owning the client's address and MAC, so every guest can
+// use the same seed URL; "/<vm>/<file>" names the VM, which must still own
+// them. Nothing else, the host included, is served.
+func NewIMDSHandler(conf *config.Config, hyper hypervisor.Hypervisor) http.Handler {
+	return (&imds{conf: conf, hyper: hyper, neighMAC: network.NeighborMAC}).handler()
+}
+
+func (m *imds) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{file}", m.serve)
+	mux.HandleFunc("GET /{ref}/{file}", m.serve)
+	return mux
+}
+
+func (m *imds) serve(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	if !slices.Contains(imdsFiles, file) {
+		http.NotFound(w, r)
+		return
+	}
+	client, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		http.Error(w, "unknown client address", http.StatusBadRequest)
+		return
+	}
+	vm, err := m.resolve(r.Context(), r.PathValue("ref"), client.Addr().Unmap())
+	switch {
+	case errors.Is(err, hypervisor.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, errNotOwner):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if file == "vendor-data" {
+		return
+	}
+	cfg, err := cloudhypervisor.CidataConfig(r.Context(), m.conf, vm.ID, &vm.Config, vm.NetworkConfigs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	files, err := metadata.Render(cfg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, ok := files[file]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(data)
+}
+
+// resolve finds the VM a request is for: ref when given, else the VM
+// owning client. A guest may only read its own metadata.
+func (m *imds) resolve(ctx context.Context, ref string, client netip.Addr) (*types.VM, error) {
+	mac, err := m.neighMAC(client)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %v", client, errNotOwner, err)
+	}
+	if ref != "" {
+		vm, err := m.hyper.Inspect(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !ownsAddr(vm, client, mac) {
+			return nil, fmt.Errorf("%s (%s), %s: %w", client, mac, ref, errNotOwner)
+		}
+		return vm, nil
+	}
+	vms, err := m.hyper.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, vm := range vms {
+		if ownsAddr(vm, client, mac) {
+			return vm, nil
+		}
+	}
+	return nil, fmt.Errorf("no VM has address %s (%s): %w", client, mac, hypervisor.ErrNotFound)
+}
+
+// ownsAddr reports whether one of vm's NICs has both addr and mac.
+// Usermode VMs never match: all of them share one guest address and MAC
+// behind passt.
+func ownsAddr(vm *types.VM, addr netip.Addr, mac net.HardwareAddr) bool {
+	if UsermodeVM(vm) {
+		return false
+	}
+	return slices.ContainsFunc(vm.NetworkConfigs, func(nc *types.NetworkConfig) bool {
+		if nc == nil {
+			return false
+		}
+		ip, err := netip.ParseAddr(nc.IP())
+		if err != nil || ip != addr {
+			return false
+		}
+		hw, err := net.ParseMAC(nc.Mac)
+		return err == nil && bytes.Equal(hw, mac)
+	})
+}
+
+// serveIMDS starts the NoCloud-Net metadata service on imds_listen. The
+// returned function stops it.
+func (d *Daemon) serveIMDS(ctx context.Context) (func(), error) {
+	addr := d.conf.IMDSListen
+	if addr == "" {
+		return func() {}, nil
+	}
+	lis, err := (&net.ListenConfig{}).Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", addr, err)
+	}
+	srv := &http.Server{
+		Handler:           NewIMDSHandler(d.conf, d.hyper),
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithFunc("daemon.serveIMDS").Warnf(ctx, "metadata server: %v", err)
+		}
+	}()
+	log.WithFunc("daemon.serveIMDS").Infof(ctx, "serving NoCloud-Net metadata on http://%s/", addr)
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), httpReadHeaderTimeout)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}, nil
+}
@@ -0,0 +1,65 @@
+package daemon
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestIMDS(t *testing.T) {
+	nic := func(ip, mac string) []*types.NetworkConfig {
+		return []*types.NetworkConfig{{Mac: mac, Network: &types.Network{IP: ip, Prefix: 24}}}
+	}
+	hyper := &fakeHyper{vms: []*types.VM{
+		{ID: "abc123", Config: types.VMConfig{Name: "web", UserData: "#cloud-config\npackages: [nginx]\n"}, NetworkConfigs: nic("10.0.0.2", "aa:bb:cc:dd:ee:02")},
+		{ID: "def456", Config: types.VMConfig{Name: "db"}, NetworkConfigs: nic("10.0.0.3", "aa:bb:cc:dd:ee:03")},
+	}}
+
+	tests := []struct {
+		client, mac, path string
+		wantCode          int
+		wantBody          string
+	}{
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/meta-data", http.StatusOK, "instance-id: abc123"},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/user-data", http.StatusOK, "nginx"},
+		{"10.0.0.3:4321", "aa:bb:cc:dd:ee:03", "/user-data", http.StatusOK, "root:pw"},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/network-config", http.StatusOK, "10.0.0.2/24"},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/vendor-data", http.StatusOK, ""},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/web/meta-data", http.StatusOK, "local-hostname: web"},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/db/user-data", http.StatusForbidden, "does not belong"},
+		// A guest that took web's address, but not its MAC.
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:99", "/user-data", http.StatusNotFound, "no VM has address"},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:99", "/web/user-data", http.StatusForbidden, "does not belong"},
+		// The host has no neighbor entry for itself, so gets nothing.
+		{"127.0.0.1:4321", "", "/db/meta-data", http.StatusForbidden, "does not belong"},
+		{"10.0.0.9:4321", "aa:bb:cc:dd:ee:09", "/meta-data", http.StatusNotFound, "no VM has address"},
+		{"10.0.0.2:4321", "aa:bb:cc:dd:ee:02", "/secrets", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.client+tt.path, func(t *testing.T) {
+			m := &imds{conf: &config.Config{DefaultRootPassword: "pw"}, hyper: hyper, neighMAC: func(netip.Addr) (net.HardwareAddr, error) {
+				if tt.mac == "" {
+					return nil, errors.New("no neighbor entry")
+				}
+				return net.ParseMAC(tt.mac)
+			}}
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.RemoteAddr = tt.client
+			rec := httptest.NewRecorder()
+			m.handler().ServeHTTP(rec, req)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d (body %s)", rec.Code, tt.wantCode, rec.Body)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %q does not contain %q", rec.Body, tt.wantBody)
+			}
+		})
+	}
+}
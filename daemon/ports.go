@@ -0,0 +1,166 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const portsFileName = "ports.json"
+
+// PortStats counts the traffic a published port has relayed since it was
+// bound. Each TCP connection and each UDP client is one relay.
+type PortStats struct {
+	Active   int64  `json:"active"`    // relays open now
+	Total    int64  `json:"total"`     // relays since the port was bound
+	Failed   int64  `json:"failed"`    // relays whose guest dial failed
+	BytesIn  uint64 `json:"bytes_in"`  // host → guest
+	BytesOut uint64 `json:"bytes_out"` // guest → host
+}
+
+// PortStatus is one port the daemon forwards, as recorded in PortsFile.
+type PortStatus struct {
+	VMID    string            `json:"vm_id"`
+	Mapping types.PortMapping `json:"mapping"`
+	Target  string            `json:"target"` // guest ip:port
+	Since   time.Time         `json:"since"`
+	PortStats
+}
+
+// PortsFile returns the file a running daemon records its forwarded ports
+// in after every reconcile pass.
+func PortsFile(conf *config.Config) string { return filepath.Join(conf.RunDir, portsFileName) }
+
+// ReadPorts returns the ports a running daemon forwards, as of its last
+// reconcile pass; nil when no daemon is running.
+func ReadPorts(conf *config.Config) ([]PortStatus, error) {
+	if _, ok := Running(conf); !ok {
+		return nil, nil
+	}
+	data, err := os.ReadFile(PortsFile(conf))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ports []PortStatus
+	if err := json.Unmarshal(data, &ports); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", PortsFile(conf), err)
+	}
+	return ports, nil
+}
+
+// publishedPorts holds the listeners serving one VM's --publish mappings.
+type publishedPorts struct {
+	ip         string
+	mappings   []types.PortMapping
+	forwarders []*forwarder
+}
+
+func (p *publishedPorts) close() {
+	for _, f := range p.forwarders {
+		_ = f.Close()
+	}
+}
+
+// reconcilePorts forwards the published ports of running VMs to their
+// current IP. Listeners of VMs that stopped, changed IP or changed
+// mappings are closed; a port that cannot be bound is retried next pass.
+// Usermode VMs are skipped: their passt process forwards the ports. So
+// are VMs whose first NIC's CNI chain took the ports as portMappings.
+func (d *Daemon) reconcilePorts(ctx context.Context, vms []*types.VM) error {
+	want := map[string]*types.VM{}
+	for _, vm := range vms {
+		if len(vm.Config.Publish) > 0 && vm.State == types.VMStateRunning && !IsStale(vm) && vm.PrimaryIP() != "" && !UsermodeVM(vm) && !CNIPortMapped(vm) {
+			want[vm.ID] = vm
+		}
+	}
+	logger := log.WithFunc("daemon.reconcilePorts")
+	for id, p := range d.ports {
+		vm := want[id]
+		if vm != nil && vm.PrimaryIP() == p.ip && slices.Equal(vm.Config.Publish, p.mappings) {
+			continue
+		}
+		p.close()
+		delete(d.ports, id)
+		logger.Infof(ctx, "VM %s published ports closed", id)
+	}
+
+	var errs []error
+	for id, vm := range want {
+		if _, ok := d.ports[id]; ok {
+			continue
+		}
+		p, err := publishPorts(ctx, vm)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("publish ports of %s: %w", id, err))
+			continue
+		}
+		d.ports[id] = p
+		logger.Infof(ctx, "VM %s ports published to %s", id, p.ip)
+	}
+	return errors.Join(errs...)
+}
+
+// UsermodeVM reports whether vm's NICs are served by passt, which
+// forwards its published ports instead of the daemon.
+func UsermodeVM(vm *types.VM) bool {
+	return slices.ContainsFunc(vm.NetworkConfigs, func(nc *types.NetworkConfig) bool {
+		return nc != nil && nc.UserSocket != ""
+	})
+}
+
+// CNIPortMapped reports whether the CNI plugin chain of vm's first NIC
+// (e.g. portmap) forwards its published ports instead of the daemon.
+func CNIPortMapped(vm *types.VM) bool {
+	return len(vm.NetworkConfigs) > 0 && vm.NetworkConfigs[0] != nil && vm.NetworkConfigs[0].HasCapability(types.CapPortMappings)
+}
+
+// publishPorts binds every mapping of vm, or none of them.
+func publishPorts(ctx context.Context, vm *types.VM) (*publishedPorts, error) {
+	p := &publishedPorts{ip: vm.PrimaryIP(), mappings: vm.Config.Publish}
+	for _, m := range vm.Config.Publish {
+		f, err := listenForward(ctx, m, p.ip)
+		if err != nil {
+			p.close()
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+		p.forwarders = append(p.forwarders, f)
+	}
+	return p, nil
+}
+
+// closePorts closes every published port.
+func (d *Daemon) closePorts() {
+	for id, p := range d.ports {
+		p.close()
+		delete(d.ports, id)
+	}
+}
+
+// savePorts records the forwarded ports and their metrics in PortsFile.
+func (d *Daemon) savePorts() error {
+	ports := []PortStatus{}
+	for id, p := range d.ports {
+		for _, f := range p.forwarders {
+			ports = append(ports, PortStatus{VMID: id, Mapping: f.mapping, Target: f.target, Since: f.since, PortStats: f.stats()})
+		}
+	}
+	data, err := json.Marshal(ports)
+	if err != nil {
+		return err
+	}
+	return utils.AtomicWriteFile(PortsFile(d.conf), data, 0o644) //nolint:mnd
+}
@@ -0,0 +1,200 @@
+package daemon
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// echoServers starts a TCP and a UDP echo server on the same loopback port.
+func echoServers(t *testing.T) int {
+	t.Helper()
+	for range 10 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := lis.Addr().(*net.TCPAddr).Port
+		pc, err := net.ListenPacket("udp", lis.Addr().String())
+		if err != nil {
+			_ = lis.Close()
+			continue
+		}
+		t.Cleanup(func() { _ = lis.Close(); _ = pc.Close() })
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				go func() { _, _ = io.Copy(conn, conn); _ = conn.Close() }()
+			}
+		}()
+		go func() {
+			buf := make([]byte, 1500)
+			for {
+				n, addr, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				_, _ = pc.WriteTo(buf[:n], addr)
+			}
+		}()
+		return port
+	}
+	t.Fatal("no free port for TCP and UDP")
+	return 0
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close() //nolint:errcheck
+	return lis.Addr().(*net.TCPAddr).Port
+}
+
+func roundTrip(t *testing.T, network, addr string) {
+	t.Helper()
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		t.Fatalf("dial %s %s: %v", network, addr, err)
+	}
+	defer conn.Close() //nolint:errcheck
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write %s: %v", network, err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %s = %q, %v; want ping", network, buf, err)
+	}
+}
+
+func TestReconcilePorts(t *testing.T) {
+	guestPort := echoServers(t)
+	hostPort := freePort(t)
+	vm := &types.VM{
+		ID:    "web",
+		State: types.VMStateRunning,
+		PID:   os.Getpid(),
+		Config: types.VMConfig{Publish: []types.PortMapping{
+			{HostIP: "127.0.0.1", HostPort: hostPort, GuestPort: guestPort, Protocol: types.ProtocolTCP},
+			{HostIP: "127.0.0.1", HostPort: hostPort, GuestPort: guestPort, Protocol: types.ProtocolUDP},
+		}},
+		NetworkConfigs: []*types.NetworkConfig{{Network: &types.Network{IP: "127.0.0.1"}}},
+	}
+	d := New(&config.Config{}, &fakeHyper{}, nil, nil)
+	defer d.closePorts()
+
+	if err := d.reconcilePorts(t.Context(), []*types.VM{vm}); err != nil {
+		t.Fatalf("reconcilePorts: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(hostPort))
+	roundTrip(t, "tcp", addr)
+	roundTrip(t, "udp", addr)
+
+	// An unchanged VM keeps its listeners.
+	first := d.ports[vm.ID]
+	if err := d.reconcilePorts(t.Context(), []*types.VM{vm}); err != nil {
+		t.Fatalf("reconcilePorts: %v", err)
+	}
+	if d.ports[vm.ID] != first {
+		t.Error("listeners of an unchanged VM were replaced")
+	}
+
+	vm.State = types.VMStateStopped
+	if err := d.reconcilePorts(t.Context(), []*types.VM{vm}); err != nil {
+		t.Fatalf("reconcilePorts: %v", err)
+	}
+	if len(d.ports) != 0 {
+		t.Fatalf("ports of a stopped VM still published: %v", d.ports)
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		_ = conn.Close()
+		t.Error("host port still accepts connections after the VM stopped")
+	}
+
+	// passt forwards a usermode VM's ports; the daemon stays out of it.
+	vm.State = types.VMStateRunning
+	vm.NetworkConfigs[0].UserSocket = "/run/usermode/web/passt.sock"
+	if err := d.reconcilePorts(t.Context(), []*types.VM{vm}); err != nil {
+		t.Fatalf("reconcilePorts: %v", err)
+	}
+	if len(d.ports) != 0 {
+		t.Errorf("ports of a usermode VM published by the daemon: %v", d.ports)
+	}
+
+	// Neither do ports the NIC's CNI chain maps itself.
+	vm.NetworkConfigs[0].UserSocket = ""
+	vm.NetworkConfigs[0].Capabilities = []string{types.CapPortMappings}
+	if err := d.reconcilePorts(t.Context(), []*types.VM{vm}); err != nil {
+		t.Fatalf("reconcilePorts: %v", err)
+	}
+	if len(d.ports) != 0 {
+		t.Errorf("ports mapped by the CNI chain published by the daemon: %v", d.ports)
+	}
+}
+
+func TestSavePorts(t *testing.T) {
+	guestPort := echoServers(t)
+	hostPort := freePort(t)
+	vm := &types.VM{
+		ID:    "web",
+		State: types.VMStateRunning,
+		PID:   os.Getpid(),
+		Config: types.VMConfig{Publish: []types.PortMapping{
+			{HostIP: "127.0.0.1", HostPort: hostPort, GuestPort: guestPort, Protocol: types.ProtocolTCP},
+			{HostIP: "127.0.0.1", HostPort: hostPort, GuestPort: guestPort, Protocol: types.ProtocolUDP},
+		}},
+		NetworkConfigs: []*types.NetworkConfig{{Network: &types.Network{IP: "127.0.0.1"}}},
+	}
+	conf := &config.Config{RunDir: t.TempDir()}
+	d := New(conf, &fakeHyper{}, nil, nil)
+	defer d.closePorts()
+
+	if err := d.reconcilePorts(t.Context(), []*types.VM{vm}); err != nil {
+		t.Fatalf("reconcilePorts: %v", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(hostPort))
+	roundTrip(t, "tcp", addr)
+	roundTrip(t, "udp", addr)
+	if err := d.savePorts(); err != nil {
+		t.Fatalf("savePorts: %v", err)
+	}
+
+	// Without a live daemon the file is ignored.
+	if ports, err := ReadPorts(conf); err != nil || ports != nil {
+		t.Fatalf("ReadPorts without daemon = %v, %v; want nil", ports, err)
+	}
+	if err := utils.WritePIDFile(PIDFile(conf), os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+	ports, err := ReadPorts(conf)
+	if err != nil {
+		t.Fatalf("ReadPorts: %v", err)
+	}
+	if len(ports) != 2 {
+		t.Fatalf("got %d ports, want 2: %+v", len(ports), ports)
+	}
+	for _, p := range ports {
+		if p.VMID != vm.ID || p.Target != net.JoinHostPort("127.0.0.1", strconv.Itoa(guestPort)) {
+			t.Errorf("port %s = %+v", p.Mapping, p)
+		}
+		if p.Total != 1 || p.Failed != 0 {
+			t.Errorf("port %s relays = %d total, %d failed; want 1, 0", p.Mapping, p.Total, p.Failed)
+		}
+		if p.Mapping.Protocol == types.ProtocolUDP && (p.BytesIn != 4 || p.Active != 1) {
+			t.Errorf("UDP port = %d bytes in, %d active; want 4, 1", p.BytesIn, p.Active)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// watchdogState is the last watchdog reset count seen for one VMM process.
+type watchdogState struct {
+	pid  int
+	seen int
+}
+
+// reconcileWatchdog detects guests reset by their watchdog since the last
+// pass, records a watchdog-reset event for each, and cold-restarts those
+// with restart policy "always" (sharing the crash-restart backoff); other
+// VMs keep running on the VMM's in-place reset.
+func (d *Daemon) reconcileWatchdog(ctx context.Context, vms []*types.VM, now time.Time, report *Report) error {
+	counter, ok := d.hyper.(hypervisor.WatchdogCounter)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	var restart []string
+	live := map[string]bool{}
+	for _, vm := range vms {
+		if vm.State != types.VMStateRunning || IsStale(vm) {
+			continue
+		}
+		live[vm.ID] = true
+		count, err := counter.WatchdogResets(ctx, vm.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("read watchdog resets of %s: %w", vm.ID, err))
+			continue
+		}
+		resets := d.observeWatchdog(vm, count)
+		if resets == 0 {
+			continue
+		}
+		report.WatchdogResets = append(report.WatchdogResets, vm.ID)
+		events.Record(ctx, d.conf, types.Event{
+			Type:    types.EventWatchdog,
+			ID:      vm.ID,
+			Name:    vm.Config.Name,
+			Message: fmt.Sprintf("guest watchdog expired %d time(s)", resets),
+		})
+		if vm.Config.RestartPolicy == types.RestartPolicyAlways && d.restartDue(vm.ID, now) {
+			restart = append(restart, vm.ID)
+		}
+	}
+	for id := range d.watchdogs {
+		if !live[id] {
+			delete(d.watchdogs, id)
+		}
+	}
+	if len(restart) == 0 {
+		return errors.Join(errs...)
+	}
+
+	stopped, stopErr := d.hyper.Stop(ctx, restart)
+	if stopErr != nil {
+		errs = append(errs, fmt.Errorf("stop watchdog-reset VMs: %w", stopErr))
+	}
+	for _, id := range stopped {
+		delete(d.watchdogs, id)
+	}
+	if len(stopped) > 0 {
+		started, startErr := d.startOwed(ctx, stopped)
+		report.Restarted = append(report.Restarted, started...)
+		if startErr != nil {
+			errs = append(errs, fmt.Errorf("restart watchdog-reset VMs: %w", startErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// observeWatchdog updates the reset count seen for vm and returns how many
+// resets are new. The first sighting of a VMM process only sets the
+// baseline unless the daemon already tracked an earlier process of the VM,
+// whose log was rotated away on relaunch; a count that drops means the live
+// log was rotated, so everything in it is new.
+func (d *Daemon) observeWatchdog(vm *types.VM, count int) int {
+	st, known := d.watchdogs[vm.ID]
+	d.watchdogs[vm.ID] = watchdogState{pid: vm.PID, seen: count}
+	switch {
+	case !known:
+		return 0
+	case st.pid != vm.PID, count < st.seen:
+		return count
+	default:
+		return count - st.seen
+	}
+}
@@ -0,0 +1,81 @@
+package daemon
+
+import (
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestReconcileWatchdog(t *testing.T) {
+	pid := os.Getpid()
+	hyper := &fakeHyper{
+		vms: []*types.VM{
+			{ID: "plain", State: types.VMStateRunning, PID: pid},
+			{ID: "always", State: types.VMStateRunning, PID: pid, Config: types.VMConfig{RestartPolicy: types.RestartPolicyAlways}},
+		},
+		watchdogResets: map[string]int{"plain": 1, "always": 1},
+	}
+	conf := &config.Config{LogDir: t.TempDir()}
+	d := New(conf, hyper, nil, nil)
+
+	// Resets logged before the daemon first sees a VMM are only a baseline.
+	report, err := d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.WatchdogResets) != 0 {
+		t.Fatalf("baseline pass reported resets %v", report.WatchdogResets)
+	}
+
+	hyper.watchdogResets = map[string]int{"plain": 2, "always": 3}
+	report, err = d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !slices.Equal(report.WatchdogResets, []string{"plain", "always"}) {
+		t.Errorf("watchdog resets = %v", report.WatchdogResets)
+	}
+	if !slices.Equal(report.Restarted, []string{"always"}) || !slices.Equal(hyper.stopped, []string{"always"}) {
+		t.Errorf("restarted = %v, stopped = %v", report.Restarted, hyper.stopped)
+	}
+	got, _, err := events.Read(conf, events.Filter{Type: types.EventWatchdog})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("watchdog events = %+v, want 2", got)
+	}
+
+	// Nothing new: no further events.
+	report, err = d.Reconcile(t.Context())
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if len(report.WatchdogResets) != 0 {
+		t.Errorf("quiet pass reported resets %v", report.WatchdogResets)
+	}
+}
+
+func TestObserveWatchdog(t *testing.T) {
+	d := New(&config.Config{}, &fakeHyper{}, nil, nil)
+	vm := &types.VM{ID: "vm", PID: 100}
+	steps := []struct {
+		pid, count, want int
+	}{
+		{100, 2, 0}, // baseline
+		{100, 3, 1},
+		{100, 1, 1}, // live log rotated
+		{200, 1, 1}, // relaunched: the new log starts empty
+		{200, 1, 0},
+	}
+	for i, s := range steps {
+		vm.PID = s.pid
+		if got := d.observeWatchdog(vm, s.count); got != s.want {
+			t.Errorf("step %d: observeWatchdog = %d, want %d", i, got, s.want)
+		}
+	}
+}
@@ -11,9 +11,27 @@ set -uo pipefail
 # ---------------------------------------------------------------------------
 # Configuration (override via environment)
 # ---------------------------------------------------------------------------
-COCOON_ROOT_DIR="${COCOON_ROOT_DIR:-/var/lib/cocoon}"
-COCOON_RUN_DIR="${COCOON_RUN_DIR:-/var/lib/cocoon/run}"
-COCOON_LOG_DIR="${COCOON_LOG_DIR:-/var/log/cocoon}"
+# Rootless mode (only when COCOON_ROOTLESS is set): user-owned XDG
+# directories and no CNI networking, so netns/sysctl/iptables/CNI checks are
+# skipped and passt (usermode networking) is checked instead.
+case "${COCOON_ROOTLESS:-}" in
+    1|true|TRUE|True) ROOTLESS=true ;;
+    *) ROOTLESS=false ;;
+esac
+
+if $ROOTLESS; then
+    COCOON_ROOT_DIR="${COCOON_ROOT_DIR:-${XDG_DATA_HOME:-$HOME/.local/share}/cocoon}"
+    if [ -n "${XDG_RUNTIME_DIR:-}" ]; then
+        COCOON_RUN_DIR="${COCOON_RUN_DIR:-${XDG_RUNTIME_DIR}/cocoon}"
+    else
+        COCOON_RUN_DIR="${COCOON_RUN_DIR:-${COCOON_ROOT_DIR}/run}"
+    fi
+    COCOON_LOG_DIR="${COCOON_LOG_DIR:-${XDG_STATE_HOME:-$HOME/.local/state}/cocoon/log}"
+else
+    COCOON_ROOT_DIR="${COCOON_ROOT_DIR:-/var/lib/cocoon}"
+    COCOON_RUN_DIR="${COCOON_RUN_DIR:-/var/lib/cocoon/run}"
+    COCOON_LOG_DIR="${COCOON_LOG_DIR:-/var/log/cocoon}"
+fi
 COCOON_CNI_CONF_DIR="${COCOON_CNI_CONF_DIR:-/etc/cni/net.d}"
 COCOON_CNI_BIN_DIR="${COCOON_CNI_BIN_DIR:-/opt/cni/bin}"
 
@@ -61,6 +79,7 @@ Environment variables:
   FW_VERSION    Firmware version            (default: ${FW_VERSION})
   CNI_VERSION   CNI plugins version         (default: ${CNI_VERSION})
   COCOON_ROOT_DIR / COCOON_RUN_DIR / COCOON_LOG_DIR
+  COCOON_ROOTLESS  Rootless mode (default: false)
   COCOON_CNI_CONF_DIR / COCOON_CNI_BIN_DIR
 EOF
             exit 0
@@ -169,16 +188,40 @@ check_binary qemu-img
 check_binary mkfs.ext4
 check_binary mkfs.erofs
 
+# swtpm is only needed for VMs created with --tpm.
+if command -v swtpm &>/dev/null; then
+    pass "swtpm ($(swtpm --version 2>/dev/null | head -1))"
+else
+    warn "swtpm not found in PATH (optional, required for --tpm)"
+fi
+
+# cryptsetup is only needed for VMs created with --encrypt.
+if command -v cryptsetup &>/dev/null; then
+    pass "cryptsetup ($(cryptsetup --version 2>/dev/null | head -1))"
+else
+    warn "cryptsetup not found in PATH (optional, required for --encrypt)"
+fi
+
+# qemu-storage-daemon is only needed for VMs created with --disk-backend qsd.
+if command -v qemu-storage-daemon &>/dev/null; then
+    pass "qemu-storage-daemon ($(qemu-storage-daemon --version 2>/dev/null | head -1))"
+else
+    warn "qemu-storage-daemon not found in PATH (optional, required for --disk-backend qsd)"
+fi
+
 # ---------------------------------------------------------------------------
 # 2. Firmware
 # ---------------------------------------------------------------------------
 header "Firmware"
 
+# Prefer the per-arch store written by `cocoon firmware install`.
+[ -f "${FIRMWARE_DIR}/${GO_ARCH}/CLOUDHV.fd" ] && FIRMWARE_PATH="${FIRMWARE_DIR}/${GO_ARCH}/CLOUDHV.fd"
+
 if [ -f "$FIRMWARE_PATH" ]; then
     local_size=$(stat -c%s "$FIRMWARE_PATH" 2>/dev/null || stat -f%z "$FIRMWARE_PATH" 2>/dev/null || echo 0)
     pass "CLOUDHV.fd (${local_size} bytes) at $FIRMWARE_PATH"
 else
-    fail "CLOUDHV.fd not found at $FIRMWARE_PATH"
+    fail "CLOUDHV.fd not found at $FIRMWARE_PATH (run: cocoon firmware install --sha256 <digest>)"
 fi
 
 # ---------------------------------------------------------------------------
@@ -191,6 +234,9 @@ if [ -e /dev/kvm ]; then
         pass "/dev/kvm accessible"
     else
         fail "/dev/kvm exists but not readable/writable by $(whoami)"
+        if $ROOTLESS; then
+            info "rootless mode: add $(whoami) to the kvm group (sudo usermod -aG kvm $(whoami)) and log in again"
+        fi
         if $FIX; then
             chmod 666 /dev/kvm 2>/dev/null && fixed "chmod 666 /dev/kvm" || warn "failed to fix (need root?)"
         fi
@@ -230,104 +276,118 @@ check_dir "${COCOON_ROOT_DIR}/cloudimg/blobs"
 check_dir "${COCOON_ROOT_DIR}/snapshot/db"
 check_dir "${COCOON_ROOT_DIR}/snapshot/localfile"
 check_dir "${FIRMWARE_DIR}"
-check_dir /var/run/netns
+if ! $ROOTLESS; then
+    check_dir /var/run/netns
+fi
 
-# ---------------------------------------------------------------------------
-# 5. Sysctl
-# ---------------------------------------------------------------------------
-header "Sysctl"
-
-check_sysctl() {
-    local key="$1"
-    local expected="$2"
-    local actual
-    actual=$(sysctl -n "$key" 2>/dev/null || echo "")
-    if [ "$actual" = "$expected" ]; then
-        pass "$key = $expected"
+if $ROOTLESS; then
+    header "Networking"
+    info "rootless mode: CNI networking unavailable, skipping sysctl, iptables and CNI checks"
+    if command -v passt &>/dev/null; then
+        pass "passt ($(passt --version 2>/dev/null | head -1)) for usermode networking"
     else
-        fail "$key = ${actual:-<unset>} (expected $expected)"
-        if $FIX; then
-            sysctl -w "${key}=${expected}" &>/dev/null && fixed "sysctl -w ${key}=${expected}" || warn "failed to set $key"
-        fi
+        warn "passt not found in PATH: install it for usermode networking, or create VMs with --nics 0"
     fi
-}
-
-check_sysctl net.ipv4.ip_forward 1
+else
 
-# br_netfilter must be loaded for bridge sysctl keys to exist.
-if ! sysctl -n net.bridge.bridge-nf-call-iptables &>/dev/null; then
-    if $FIX; then
-        modprobe br_netfilter 2>/dev/null && fixed "modprobe br_netfilter" || warn "failed to load br_netfilter"
-    fi
-fi
-check_sysctl net.bridge.bridge-nf-call-iptables 1
+    # ---------------------------------------------------------------------------
+    # 5. Sysctl
+    # ---------------------------------------------------------------------------
+    header "Sysctl"
+
+    check_sysctl() {
+        local key="$1"
+        local expected="$2"
+        local actual
+        actual=$(sysctl -n "$key" 2>/dev/null || echo "")
+        if [ "$actual" = "$expected" ]; then
+            pass "$key = $expected"
+        else
+            fail "$key = ${actual:-<unset>} (expected $expected)"
+            if $FIX; then
+                sysctl -w "${key}=${expected}" &>/dev/null && fixed "sysctl -w ${key}=${expected}" || warn "failed to set $key"
+            fi
+        fi
+    }
 
-# ---------------------------------------------------------------------------
-# 6. iptables FORWARD rules for CNI bridge
-# ---------------------------------------------------------------------------
-header "iptables FORWARD (cni0)"
+    check_sysctl net.ipv4.ip_forward 1
 
-check_iptables_rule() {
-    local desc="$1"
-    shift
-    if iptables -C "$@" 2>/dev/null; then
-        pass "$desc"
-    else
-        fail "$desc"
+    # br_netfilter must be loaded for bridge sysctl keys to exist.
+    if ! sysctl -n net.bridge.bridge-nf-call-iptables &>/dev/null; then
         if $FIX; then
-            iptables -A "$@" 2>/dev/null && fixed "iptables -A $*" || warn "failed to add rule"
+            modprobe br_netfilter 2>/dev/null && fixed "modprobe br_netfilter" || warn "failed to load br_netfilter"
         fi
     fi
-}
+    check_sysctl net.bridge.bridge-nf-call-iptables 1
+
+    # ---------------------------------------------------------------------------
+    # 6. iptables FORWARD rules for CNI bridge
+    # ---------------------------------------------------------------------------
+    header "iptables FORWARD (cni0)"
+
+    check_iptables_rule() {
+        local desc="$1"
+        shift
+        if iptables -C "$@" 2>/dev/null; then
+            pass "$desc"
+        else
+            fail "$desc"
+            if $FIX; then
+                iptables -A "$@" 2>/dev/null && fixed "iptables -A $*" || warn "failed to add rule"
+            fi
+        fi
+    }
 
-check_iptables_rule "FORWARD -i cni0 -j ACCEPT" \
-    FORWARD -i cni0 -j ACCEPT
-check_iptables_rule "FORWARD -o cni0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT" \
-    FORWARD -o cni0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+    check_iptables_rule "FORWARD -i cni0 -j ACCEPT" \
+        FORWARD -i cni0 -j ACCEPT
+    check_iptables_rule "FORWARD -o cni0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT" \
+        FORWARD -o cni0 -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
 
-# ---------------------------------------------------------------------------
-# 7. CNI configuration
-# ---------------------------------------------------------------------------
-header "CNI configuration"
+    # ---------------------------------------------------------------------------
+    # 7. CNI configuration
+    # ---------------------------------------------------------------------------
+    header "CNI configuration"
 
-CNI_CONFLIST="${COCOON_CNI_CONF_DIR}/10-cocoon.conflist"
+    CNI_CONFLIST="${COCOON_CNI_CONF_DIR}/10-cocoon.conflist"
 
-if [ -d "$COCOON_CNI_CONF_DIR" ]; then
-    conflist_count=$(find "$COCOON_CNI_CONF_DIR" -maxdepth 1 -name '*.conflist' 2>/dev/null | wc -l)
-    if [ "$conflist_count" -gt 0 ]; then
-        first=$(find "$COCOON_CNI_CONF_DIR" -maxdepth 1 -name '*.conflist' 2>/dev/null | sort | head -1)
-        pass "conflist: $(basename "$first")"
+    if [ -d "$COCOON_CNI_CONF_DIR" ]; then
+        conflist_count=$(find "$COCOON_CNI_CONF_DIR" -maxdepth 1 -name '*.conflist' 2>/dev/null | wc -l)
+        if [ "$conflist_count" -gt 0 ]; then
+            first=$(find "$COCOON_CNI_CONF_DIR" -maxdepth 1 -name '*.conflist' 2>/dev/null | sort | head -1)
+            pass "conflist: $(basename "$first")"
+        else
+            fail "no .conflist files in $COCOON_CNI_CONF_DIR"
+            if $FIX; then
+                generate_cni_conflist
+            fi
+        fi
     else
-        fail "no .conflist files in $COCOON_CNI_CONF_DIR"
+        fail "$COCOON_CNI_CONF_DIR does not exist"
         if $FIX; then
+            mkdir -p "$COCOON_CNI_CONF_DIR" && fixed "created $COCOON_CNI_CONF_DIR" || warn "failed"
             generate_cni_conflist
         fi
     fi
-else
-    fail "$COCOON_CNI_CONF_DIR does not exist"
-    if $FIX; then
-        mkdir -p "$COCOON_CNI_CONF_DIR" && fixed "created $COCOON_CNI_CONF_DIR" || warn "failed"
-        generate_cni_conflist
-    fi
-fi
 
-# ---------------------------------------------------------------------------
-# 8. CNI plugins
-# ---------------------------------------------------------------------------
-header "CNI plugins (${COCOON_CNI_BIN_DIR})"
+    # ---------------------------------------------------------------------------
+    # 8. CNI plugins
+    # ---------------------------------------------------------------------------
+    header "CNI plugins (${COCOON_CNI_BIN_DIR})"
 
-CNI_REQUIRED="bridge host-local loopback"
+    CNI_REQUIRED="bridge host-local loopback"
+
+    if [ -d "$COCOON_CNI_BIN_DIR" ]; then
+        for plugin in $CNI_REQUIRED; do
+            if [ -x "${COCOON_CNI_BIN_DIR}/${plugin}" ]; then
+                pass "$plugin"
+            else
+                fail "$plugin not found"
+            fi
+        done
+    else
+        fail "$COCOON_CNI_BIN_DIR does not exist"
+    fi
 
-if [ -d "$COCOON_CNI_BIN_DIR" ]; then
-    for plugin in $CNI_REQUIRED; do
-        if [ -x "${COCOON_CNI_BIN_DIR}/${plugin}" ]; then
-            pass "$plugin"
-        else
-            fail "$plugin not found"
-        fi
-    done
-else
-    fail "$COCOON_CNI_BIN_DIR does not exist"
 fi
 
 # ---------------------------------------------------------------------------
@@ -0,0 +1,189 @@
+// Package events records VM and image lifecycle events to an append-only
+// per-host journal (<log_dir>/events.jsonl) and reads them back.
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	journalFileName = "events.jsonl"
+
+	// Journal rotation defaults, matching lumberjack's log.* defaults like
+	// the VMM logs.
+	defaultMaxSizeMB  = 500
+	defaultMaxAgeDays = 28
+	defaultMaxBackups = 3
+)
+
+// Path returns the event journal of the host.
+func Path(conf *config.Config) string { return filepath.Join(conf.LogDir, journalFileName) }
+
+// Record appends e to the journal, stamping Time if unset. Failures are
+// logged, not returned: auditing must never fail the operation it records.
+func Record(ctx context.Context, conf *config.Config, e types.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	logger := log.WithFunc("events.Record")
+	if err := rotate(conf, Path(conf), time.Now()); err != nil {
+		logger.Warnf(ctx, "rotate event journal: %v", err)
+	}
+	if err := appendEvent(Path(conf), e); err != nil {
+		logger.Warnf(ctx, "record %s event for %s: %v", e.Type, e.ID, err)
+	}
+}
+
+// rotate moves the journal aside as a timestamped segment once it reaches
+// the log max size and removes segments beyond the log max age or backup
+// count. The journal is copy-truncated rather than renamed so a follower
+// sees it shrink and reads on from its start.
+func rotate(conf *config.Config, path string, now time.Time) error {
+	maxSize, maxAge, maxBackups := defaultMaxSizeMB, defaultMaxAgeDays, defaultMaxBackups
+	if conf.Log != nil {
+		maxSize = cmp.Or(max(conf.Log.MaxSize, 0), maxSize)
+		maxAge = cmp.Or(max(conf.Log.MaxAge, 0), maxAge)
+		maxBackups = cmp.Or(max(conf.Log.MaxBackups, 0), maxBackups)
+	}
+	rotated, err := utils.RotateLog(path, int64(maxSize)<<20, true) //nolint:mnd
+	if err != nil || !rotated {
+		return err
+	}
+	expired, err := utils.ExpiredLogBackups(path, time.Duration(maxAge)*24*time.Hour, maxBackups, now) //nolint:mnd
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range expired {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// appendEvent writes e as a single line with one write(2) on an O_APPEND
+// descriptor, so concurrent writers (CLI and daemon) never interleave.
+func appendEvent(path string, e types.Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := utils.EnsureDirs(filepath.Dir(path)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640) //nolint:gosec,mnd
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Filter selects journal entries. Zero fields match everything.
+type Filter struct {
+	VM    string          // VM ID, ID prefix (>= 3 chars), or name
+	Type  types.EventType // exact event type
+	Since time.Time
+}
+
+// ParseFilter parses repeated --filter values: "vm=<ref>", "type=<event>".
+func ParseFilter(specs []string) (Filter, error) {
+	var f Filter
+	for _, spec := range specs {
+		key, val, ok := strings.Cut(spec, "=")
+		if !ok || val == "" {
+			return f, fmt.Errorf("--filter %q is invalid: want key=value", spec)
+		}
+		switch key {
+		case "vm":
+			f.VM = val
+		case "type":
+			f.Type = types.EventType(val)
+		default:
+			return f, fmt.Errorf("--filter key %q is invalid: must be vm or type", key)
+		}
+	}
+	return f, nil
+}
+
+// Match reports whether e passes the filter.
+func (f Filter) Match(e types.Event) bool {
+	if f.Type != "" && e.Type != f.Type {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if f.VM != "" && e.ID != f.VM && e.Name != f.VM &&
+		(len(f.VM) < 3 || !strings.HasPrefix(e.ID, f.VM)) { //nolint:mnd
+		return false
+	}
+	return true
+}
+
+// Read returns the journal entries matching f, oldest first, and the
+// journal size read so far for a subsequent Follow. A missing journal is
+// empty; rotated segments are not read.
+func Read(conf *config.Config, f Filter) ([]types.Event, int64, error) {
+	data, err := os.ReadFile(Path(conf))
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	var out []types.Event
+	err = decode(bytes.NewReader(data), f, func(e types.Event) error {
+		out = append(out, e)
+		return nil
+	})
+	return out, int64(len(data)), err
+}
+
+// Follow calls fn for each matching entry appended after offset until ctx
+// is canceled.
+func Follow(ctx context.Context, conf *config.Config, offset int64, f Filter, fn func(types.Event) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(utils.FollowFile(ctx, Path(conf), offset, pw))
+	}()
+	defer pr.Close() //nolint:errcheck
+	return decode(pr, f, fn)
+}
+
+// decode feeds the matching entries of a JSON-lines stream to fn, skipping
+// lines that do not parse (e.g. a torn write after a crash).
+func decode(r io.Reader, f Filter, fn func(types.Event) error) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var e types.Event
+		if json.Unmarshal(sc.Bytes(), &e) != nil || !f.Match(e) {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	coretypes "github.com/projecteru2/core/types"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	conf := &config.Config{LogDir: t.TempDir()}
+	ctx := t.Context()
+	old := time.Now().Add(-2 * time.Hour)
+	Record(ctx, conf, types.Event{Time: old, Type: types.EventCreated, ID: "aaa111", Name: "web"})
+	Record(ctx, conf, types.Event{Type: types.EventStarted, ID: "aaa111", Name: "web"})
+	Record(ctx, conf, types.Event{Type: types.EventStarted, ID: "bbb222", Name: "db"})
+	Record(ctx, conf, types.Event{Type: types.EventImagePulled, ID: "ubuntu:24.04"})
+
+	// A torn line from a crashed writer is skipped.
+	f, err := os.OpenFile(Path(conf), os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("{\"type\":\"sto\n")
+	_ = f.Close()
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{name: "all", want: 4},
+		{name: "by name", filter: Filter{VM: "web"}, want: 2},
+		{name: "by id prefix", filter: Filter{VM: "bbb"}, want: 1},
+		{name: "short prefix", filter: Filter{VM: "bb"}, want: 0},
+		{name: "by type", filter: Filter{Type: types.EventStarted}, want: 2},
+		{name: "since", filter: Filter{Since: time.Now().Add(-time.Hour)}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, offset, err := Read(conf, tt.filter)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("got %d events, want %d: %+v", len(got), tt.want, got)
+			}
+			if fi, _ := os.Stat(Path(conf)); offset != fi.Size() {
+				t.Errorf("offset %d, want %d", offset, fi.Size())
+			}
+		})
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	got, offset, err := Read(&config.Config{LogDir: t.TempDir()}, Filter{})
+	if err != nil || len(got) != 0 || offset != 0 {
+		t.Errorf("got %v, %d, %v; want empty", got, offset, err)
+	}
+}
+
+func TestRecordRotates(t *testing.T) {
+	dir := t.TempDir()
+	conf := &config.Config{LogDir: dir, Log: &coretypes.ServerLogConfig{MaxSize: 1, MaxBackups: 1}}
+	ctx := t.Context()
+	stale := filepath.Join(dir, "events-2020-01-02T03-04-05.000.jsonl")
+	if err := os.WriteFile(stale, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Below the cap the journal keeps growing.
+	Record(ctx, conf, types.Event{Type: types.EventCreated, ID: "aaa111"})
+	if got, _, _ := Read(conf, Filter{}); len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+
+	// At the cap it is copy-truncated before the next event, and segments
+	// beyond max_backups are removed.
+	f, err := os.OpenFile(Path(conf), os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(append(bytes.Repeat([]byte{'x'}, 1<<20), '\n'))
+	_ = f.Close()
+	Record(ctx, conf, types.Event{Type: types.EventStarted, ID: "aaa111"})
+
+	got, _, err := Read(conf, Filter{})
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(got) != 1 || got[0].Type != types.EventStarted {
+		t.Errorf("journal after rotation = %+v, want only the started event", got)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "events-*.jsonl"))
+	if len(segments) != 1 || segments[0] == stale {
+		t.Fatalf("segments = %v, want the new one only", segments)
+	}
+	if fi, err := os.Stat(segments[0]); err != nil || fi.Size() <= 1<<20 {
+		t.Errorf("segment does not hold the old journal: %v, %v", fi, err)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	f, err := ParseFilter([]string{"vm=web", "type=stopped"})
+	if err != nil {
+		t.Fatalf("ParseFilter: %v", err)
+	}
+	if f.VM != "web" || f.Type != types.EventStopped {
+		t.Errorf("got %+v", f)
+	}
+	for _, bad := range []string{"vm", "vm=", "host=x"} {
+		if _, err := ParseFilter([]string{bad}); err == nil {
+			t.Errorf("ParseFilter(%q): expected error", bad)
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	conf := &config.Config{LogDir: t.TempDir()}
+	Record(t.Context(), conf, types.Event{Type: types.EventCreated, ID: "aaa111"})
+	_, offset, err := Read(conf, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	got := make(chan types.Event, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Follow(ctx, conf, offset, Filter{VM: "bbb222"}, func(e types.Event) error {
+			got <- e
+			cancel()
+			return nil
+		})
+	}()
+
+	Record(t.Context(), conf, types.Event{Type: types.EventStarted, ID: "aaa111"})
+	Record(t.Context(), conf, types.Event{Type: types.EventStarted, ID: "bbb222"})
+	select {
+	case e := <-got:
+		if e.ID != "bbb222" || e.Type != types.EventStarted {
+			t.Errorf("got %+v", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for followed event")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Follow: %v", err)
+	}
+}
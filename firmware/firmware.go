@@ -0,0 +1,154 @@
+// Package firmware manages the UEFI firmware builds VMs boot from. Builds
+// live under <root_dir>/firmware/<arch>/<name>.fd, so secure-boot or
+// arch-specific variants can coexist; the legacy flat
+// <root_dir>/firmware/CLOUDHV.fd remains the default.
+package firmware
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	// DefaultName is the firmware cloud images boot when --firmware is unset.
+	DefaultName = "CLOUDHV"
+	fileExt     = ".fd"
+)
+
+// ErrNotFound is returned when a named firmware is not in the store.
+var ErrNotFound = errors.New("firmware not found")
+
+// Entry is one firmware build in the store.
+type Entry struct {
+	Name string `json:"name"`
+	Arch string `json:"arch"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Dir returns the firmware store directory.
+func Dir(conf *config.Config) string { return filepath.Join(conf.RootDir, "firmware") }
+
+// Path returns where the store keeps firmware name for arch.
+func Path(conf *config.Config, name, arch string) string {
+	return filepath.Join(Dir(conf), arch, name+fileExt)
+}
+
+// Resolve maps a --firmware value to a firmware file. A value containing a
+// path separator is used as is; otherwise it names a store entry, looked up
+// for the host architecture first and then in the legacy flat layout.
+// Empty resolves to DefaultName.
+func Resolve(conf *config.Config, ref string) (string, error) {
+	if strings.ContainsRune(ref, os.PathSeparator) {
+		if !utils.ValidFile(ref) {
+			return "", fmt.Errorf("firmware %s: not a valid file", ref)
+		}
+		return filepath.Abs(ref)
+	}
+	name := cmp.Or(ref, DefaultName)
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	candidates := []string{
+		Path(conf, name, runtime.GOARCH),
+		filepath.Join(Dir(conf), name+fileExt),
+	}
+	for _, p := range candidates {
+		if utils.ValidFile(p) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q for %s in %s (see cocoon firmware ls)", ErrNotFound, name, runtime.GOARCH, Dir(conf))
+}
+
+// List returns every firmware build in the store, sorted by arch and name.
+// Entries in the legacy flat layout are reported for the host architecture.
+func List(conf *config.Config) ([]Entry, error) {
+	dir := Dir(conf)
+	var entries []Entry
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != fileExt {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		arch := filepath.Base(filepath.Dir(p))
+		if filepath.Dir(p) == dir {
+			arch = runtime.GOARCH
+		}
+		entries = append(entries, Entry{
+			Name: strings.TrimSuffix(d.Name(), fileExt),
+			Arch: arch,
+			Path: p,
+			Size: info.Size(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", dir, err)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Or(cmp.Compare(a.Arch, b.Arch), cmp.Compare(a.Name, b.Name))
+	})
+	return entries, nil
+}
+
+// Import copies src into the store as name for arch, replacing any existing
+// build of that name atomically. Returns the stored path.
+func Import(conf *config.Config, name, arch, src string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	dst := Path(conf, name, cmp.Or(arch, runtime.GOARCH))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil { //nolint:gosec,mnd
+		return "", fmt.Errorf("create firmware dir: %w", err)
+	}
+	data, err := os.ReadFile(src) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("read %s: %w", src, err)
+	}
+	if err := utils.AtomicWriteFile(dst, data, 0o644); err != nil { //nolint:mnd
+		return "", fmt.Errorf("write %s: %w", dst, err)
+	}
+	return dst, nil
+}
+
+// Remove deletes firmware name for arch from the store. VMs already created
+// with it keep their recorded path and fail to start until it is restored.
+func Remove(conf *config.Config, name, arch string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	p := Path(conf, name, cmp.Or(arch, runtime.GOARCH))
+	if err := os.Remove(p); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %q (%s)", ErrNotFound, name, cmp.Or(arch, runtime.GOARCH))
+		}
+		return err
+	}
+	return nil
+}
+
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid firmware name %q", name)
+	}
+	return nil
+}
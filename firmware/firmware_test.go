@@ -0,0 +1,105 @@
+package firmware
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+)
+
+func writeFile(t *testing.T, p string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte("fw"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	conf := &config.Config{RootDir: t.TempDir()}
+	dir := Dir(conf)
+	writeFile(t, filepath.Join(dir, "CLOUDHV.fd"))
+	writeFile(t, Path(conf, "secure", runtime.GOARCH))
+	writeFile(t, Path(conf, "foreign", "other-arch"))
+	external := filepath.Join(t.TempDir(), "custom.fd")
+	writeFile(t, external)
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+	}{
+		{"", filepath.Join(dir, "CLOUDHV.fd"), nil},
+		{"secure", Path(conf, "secure", runtime.GOARCH), nil},
+		{external, external, nil},
+		{"foreign", "", ErrNotFound},
+		{"missing", "", ErrNotFound},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(conf, tt.ref)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Resolve(%q) err = %v, want %v", tt.ref, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v; want %q", tt.ref, got, err, tt.want)
+		}
+	}
+
+	if _, err := Resolve(conf, filepath.Join(dir, "nope.fd")); err == nil {
+		t.Error("Resolve of a missing path: want error")
+	}
+}
+
+func TestListImportRemove(t *testing.T) {
+	conf := &config.Config{RootDir: t.TempDir()}
+	if entries, err := List(conf); err != nil || len(entries) != 0 {
+		t.Fatalf("List on empty store = %v, %v", entries, err)
+	}
+
+	writeFile(t, filepath.Join(Dir(conf), "CLOUDHV.fd"))
+	src := filepath.Join(t.TempDir(), "sb.fd")
+	writeFile(t, src)
+	if _, err := Import(conf, "secure", "arm64", src); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if _, err := Import(conf, "../escape", "", src); err == nil {
+		t.Error("Import with path in name: want error")
+	}
+
+	entries, err := List(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("List = %+v, want 2 entries", entries)
+	}
+	for _, e := range entries {
+		switch e.Name {
+		case "CLOUDHV":
+			if e.Arch != runtime.GOARCH {
+				t.Errorf("flat entry arch = %q, want %q", e.Arch, runtime.GOARCH)
+			}
+		case "secure":
+			if e.Arch != "arm64" || e.Size != 2 {
+				t.Errorf("imported entry = %+v", e)
+			}
+		default:
+			t.Errorf("unexpected entry %+v", e)
+		}
+	}
+
+	if err := Remove(conf, "secure", "arm64"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := Remove(conf, "secure", "arm64"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Remove err = %v, want ErrNotFound", err)
+	}
+}
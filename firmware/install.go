@@ -0,0 +1,206 @@
+package firmware
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+)
+
+const (
+	// DefaultVersion is the rust-hypervisor-firmware release installed when
+	// no version is given; keep in sync with FW_VERSION in doctor/check.sh.
+	DefaultVersion = "0.5.0"
+
+	releaseURL = "https://github.com/cloud-hypervisor/rust-hypervisor-firmware/releases/download/%s/hypervisor-fw%s"
+
+	// checksumsFile is fetched from the assets base URL and lists the
+	// SHA-256 of every guest asset, in sha256sum(1) format.
+	checksumsFile = "SHA256SUMS"
+
+	downloadTimeout = 10 * time.Minute
+	maxAssetBytes   = 1 << 30
+)
+
+// guestAssets are the files fetched from InstallOptions.AssetsURL.
+var guestAssets = []string{"vmlinuz", "initrd.img"}
+
+// InstallOptions selects what Install downloads.
+type InstallOptions struct {
+	Name      string // store name for the firmware (default DefaultName)
+	Version   string // rust-hypervisor-firmware release (default DefaultVersion)
+	URL       string // override the release download URL
+	SHA256    string // expected firmware digest; required
+	AssetsURL string // base URL of guest kernel/initramfs assets; skipped when empty
+}
+
+// Installed describes one file written by Install.
+type Installed struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// Install downloads the firmware for the host architecture into the store,
+// verified against opts.SHA256, and, when AssetsURL is set, the guest kernel and initramfs listed in its
+// SHA256SUMS. Every file is written atomically and only after its digest
+// has been checked.
+func Install(ctx context.Context, conf *config.Config, opts InstallOptions) ([]Installed, error) {
+	name := cmp.Or(opts.Name, DefaultName)
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	url := opts.URL
+	if url == "" {
+		suffix, err := releaseSuffix(runtime.GOARCH)
+		if err != nil {
+			return nil, err
+		}
+		url = fmt.Sprintf(releaseURL, cmp.Or(opts.Version, DefaultVersion), suffix)
+	}
+	dir := filepath.Join(Dir(conf), runtime.GOARCH)
+	if err := os.MkdirAll(dir, 0o755); err != nil { //nolint:gosec,mnd
+		return nil, fmt.Errorf("create firmware dir: %w", err)
+	}
+
+	expected := strings.ToLower(strings.TrimSpace(opts.SHA256))
+	if _, err := hex.DecodeString(expected); err != nil || len(expected) != sha256.Size*2 {
+		return nil, fmt.Errorf("a SHA-256 digest of %s is required (--sha256): got %q", url, opts.SHA256)
+	}
+	fw, err := fetch(ctx, url, Path(conf, name, runtime.GOARCH), expected)
+	if err != nil {
+		return nil, err
+	}
+	installed := []Installed{fw}
+
+	if opts.AssetsURL == "" {
+		return installed, nil
+	}
+	base := strings.TrimSuffix(opts.AssetsURL, "/")
+	sums, err := fetchChecksums(ctx, base+"/"+checksumsFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range guestAssets {
+		digest, ok := sums[asset]
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: no entry for %s", base, checksumsFile, asset)
+		}
+		got, err := fetch(ctx, base+"/"+asset, filepath.Join(dir, asset), digest)
+		if err != nil {
+			return nil, err
+		}
+		installed = append(installed, got)
+	}
+	return installed, nil
+}
+
+// releaseSuffix maps a GOARCH to the suffix of the firmware release asset.
+func releaseSuffix(arch string) (string, error) {
+	switch arch {
+	case "amd64":
+		return "", nil
+	case "arm64":
+		return "-aarch64", nil
+	}
+	return "", fmt.Errorf("no firmware release for %s: pass --url", arch)
+}
+
+// fetch downloads url to dst through a temp file in the same directory,
+// renaming it into place only when the digest matches expected.
+func fetch(ctx context.Context, url, dst, expected string) (Installed, error) {
+	body, err := httpGet(ctx, url)
+	if err != nil {
+		return Installed{}, err
+	}
+	defer body.Close() //nolint:errcheck
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".tmp-*")
+	if err != nil {
+		return Installed{}, fmt.Errorf("create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) //nolint:errcheck
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(body, maxAssetBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Installed{}, fmt.Errorf("download %s: %w", url, err)
+	}
+	if n > maxAssetBytes {
+		return Installed{}, fmt.Errorf("download %s: exceeded max size (%d bytes)", url, maxAssetBytes)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	if digest != expected {
+		return Installed{}, fmt.Errorf("download %s: sha256 mismatch: got %s, want %s", url, digest, expected)
+	}
+	if err := os.Chmod(tmpPath, 0o644); err != nil { //nolint:mnd
+		return Installed{}, fmt.Errorf("chmod %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return Installed{}, fmt.Errorf("install %s: %w", dst, err)
+	}
+	return Installed{Path: dst, SHA256: digest}, nil
+}
+
+// fetchChecksums downloads a sha256sum(1)-style file and returns the
+// digests keyed by file name.
+func fetchChecksums(ctx context.Context, url string) (map[string]string, error) {
+	body, err := httpGet(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close() //nolint:errcheck
+
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20)) //nolint:mnd
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", url, err)
+	}
+	return parseChecksums(data), nil
+}
+
+func parseChecksums(data []byte) map[string]string {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		digest, name, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok || len(digest) != sha256.Size*2 {
+			continue
+		}
+		// "*" marks binary mode in sha256sum output.
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		sums[name] = strings.ToLower(digest)
+	}
+	return sums
+}
+
+func httpGet(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP request: %w", err)
+	}
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP GET %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close() //nolint:errcheck,gosec
+		return nil, fmt.Errorf("HTTP GET %s: status %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,85 @@
+package firmware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+)
+
+func digestOf(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseChecksums(t *testing.T) {
+	data := []byte(digestOf("k") + "  vmlinuz\n" + digestOf("i") + " *initrd.img\nbogus line\n\n")
+	got := parseChecksums(data)
+	if len(got) != 2 || got["vmlinuz"] != digestOf("k") || got["initrd.img"] != digestOf("i") {
+		t.Errorf("parseChecksums = %v", got)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	files := map[string]string{
+		"/fw":                "firmware",
+		"/assets/vmlinuz":    "kernel",
+		"/assets/initrd.img": "initrd",
+		"/assets/SHA256SUMS": digestOf("kernel") + "  vmlinuz\n" + digestOf("initrd") + "  initrd.img\n",
+		"/bad/vmlinuz":       "kernel",
+		"/bad/initrd.img":    "tampered",
+		"/bad/SHA256SUMS":    digestOf("kernel") + "  vmlinuz\n" + digestOf("initrd") + "  initrd.img\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	conf := &config.Config{RootDir: t.TempDir()}
+	installed, err := Install(ctx, conf, InstallOptions{URL: srv.URL + "/fw", SHA256: digestOf("firmware"), AssetsURL: srv.URL + "/assets/"})
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if len(installed) != 3 {
+		t.Fatalf("installed = %+v, want 3 files", installed)
+	}
+	if p, err := Resolve(conf, ""); err != nil || p != Path(conf, DefaultName, runtime.GOARCH) {
+		t.Errorf("Resolve after install = %q, %v", p, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(Dir(conf), runtime.GOARCH, "vmlinuz")); string(data) != "kernel" {
+		t.Errorf("vmlinuz = %q", data)
+	}
+
+	tests := []struct {
+		name string
+		opts InstallOptions
+	}{
+		{"firmware digest mismatch", InstallOptions{Name: "x", URL: srv.URL + "/fw", SHA256: digestOf("other")}},
+		{"no firmware digest", InstallOptions{Name: "x", URL: srv.URL + "/fw"}},
+		{"malformed firmware digest", InstallOptions{Name: "x", URL: srv.URL + "/fw", SHA256: "abc"}},
+		{"asset digest mismatch", InstallOptions{Name: "y", URL: srv.URL + "/fw", SHA256: digestOf("firmware"), AssetsURL: srv.URL + "/bad"}},
+		{"missing firmware", InstallOptions{Name: "x", URL: srv.URL + "/nope", SHA256: digestOf("firmware")}},
+		{"invalid name", InstallOptions{Name: "../x", URL: srv.URL + "/fw", SHA256: digestOf("firmware")}},
+	}
+	for _, tt := range tests {
+		if _, err := Install(ctx, conf, tt.opts); err == nil {
+			t.Errorf("%s: want error", tt.name)
+		}
+	}
+	if _, err := os.Stat(Path(conf, "x", runtime.GOARCH)); !os.IsNotExist(err) {
+		t.Errorf("firmware with a bad digest was installed: %v", err)
+	}
+}
@@ -23,6 +23,27 @@ type Module[S any] struct {
 
 	// Collect removes the given IDs (called while the lock is held).
 	Collect func(ctx context.Context, ids []string) error
+
+	// Usage sizes the module's data on disk, counting what collecting ids
+	// would free as reclaimable (called while the lock is held). Optional.
+	Usage func(snap S, ids []string) ([]Usage, error)
+}
+
+// Usage is the disk space one type of a module's data takes.
+type Usage struct {
+	Type        string `json:"type"`
+	Count       int    `json:"count"`
+	Size        int64  `json:"size"`
+	Reclaimable int64  `json:"reclaimable"` // freed by the next GC
+}
+
+// Add counts one item of size bytes, reclaimable or not.
+func (u *Usage) Add(size int64, reclaimable bool) {
+	u.Count++
+	u.Size += size
+	if reclaimable {
+		u.Reclaimable += size
+	}
 }
 
 // Module[S] implements runner — internal to the gc package.
@@ -44,3 +65,11 @@ func (m Module[S]) resolveTargets(snap any, others map[string]any) []string {
 func (m Module[S]) collect(ctx context.Context, ids []string) error {
 	return m.Collect(ctx, ids)
 }
+
+func (m Module[S]) usage(snap any, ids []string) ([]Usage, error) {
+	typed, ok := snap.(S)
+	if !ok || m.Usage == nil {
+		return nil, nil
+	}
+	return m.Usage(typed, ids)
+}
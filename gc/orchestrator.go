@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/projecteru2/core/log"
@@ -38,10 +39,97 @@ func Register[S any](o *Orchestrator, m Module[S]) {
 // collect phases see a consistent view. GC runs infrequently and executes
 // fast, so the extended lock hold is acceptable.
 func (o *Orchestrator) Run(ctx context.Context) error {
-	logger := log.WithFunc("gc.Run")
+	p, err := o.plan(ctx)
+	defer p.unlock(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Phase 3: collect (skip modules with no targets).
+	var errs []error
+	for _, m := range p.locked {
+		ids := p.targets[m.getName()]
+		if len(ids) == 0 {
+			continue
+		}
+		if err := m.collect(ctx, ids); err != nil {
+			errs = append(errs, fmt.Errorf("gc %s: %w", m.getName(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Usage reports the disk space of every module that tracks it, with what
+// Run would free right now. It reads the module snapshots without taking
+// their locks, since the stores write atomically and nothing is collected,
+// so it works while other operations run. A module that fails is left out
+// and its error returned along with the others' usage; what is reclaimable
+// is only estimated from a complete set of snapshots, as GC would not run
+// without one. Entries of the same Type from different modules are merged.
+func (o *Orchestrator) Usage(ctx context.Context) ([]Usage, error) {
+	var errs []error
+	snapshots := make(map[string]any, len(o.modules))
+	for _, m := range o.modules {
+		snap, err := m.readSnapshot(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("snapshot %s: %w", m.getName(), err))
+			continue
+		}
+		snapshots[m.getName()] = snap
+	}
+	targets := map[string][]string{}
+	if len(errs) == 0 {
+		for _, m := range o.modules {
+			targets[m.getName()] = m.resolveTargets(snapshots[m.getName()], snapshots)
+		}
+	}
+
+	var result []Usage
+	for _, m := range o.modules {
+		snap, ok := snapshots[m.getName()]
+		if !ok {
+			continue
+		}
+		usage, err := m.usage(snap, targets[m.getName()])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("usage %s: %w", m.getName(), err))
+			continue
+		}
+		for _, u := range usage {
+			if i := slices.IndexFunc(result, func(r Usage) bool { return r.Type == u.Type }); i >= 0 {
+				result[i].Count += u.Count
+				result[i].Size += u.Size
+				result[i].Reclaimable += u.Reclaimable
+				continue
+			}
+			result = append(result, u)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// cycle is a planned GC cycle: the modules whose locks are held, their
+// snapshots and the IDs each would collect.
+type cycle struct {
+	locked    []runner
+	snapshots map[string]any
+	targets   map[string][]string
+}
+
+// unlock releases every lock the cycle holds.
+func (c *cycle) unlock(ctx context.Context) {
+	for _, m := range c.locked {
+		m.getLocker().Unlock(ctx) //nolint:errcheck,gosec
+	}
+}
+
+// plan locks all modules, snapshots them and resolves their targets. The
+// caller must unlock the returned cycle, even on error.
+func (o *Orchestrator) plan(ctx context.Context) (*cycle, error) {
+	logger := log.WithFunc("gc.plan")
+	p := &cycle{}
 
-	// Acquire all locks up front; hold until GC finishes.
-	var locked []runner
+	// Acquire all locks up front; hold until the caller is done.
 	var skipped []string
 	for _, m := range o.modules {
 		ok, err := m.getLocker().TryLock(ctx)
@@ -55,49 +143,32 @@ func (o *Orchestrator) Run(ctx context.Context) error {
 			skipped = append(skipped, m.getName())
 			continue
 		}
-		locked = append(locked, m)
+		p.locked = append(p.locked, m)
 	}
-	defer func() {
-		for _, m := range locked {
-			m.getLocker().Unlock(ctx) //nolint:errcheck,gosec
-		}
-	}()
 
 	// Fail-closed: if any module was skipped, abort the entire cycle.
 	// Collecting without a complete cross-module snapshot risks deleting data
 	// still protected by the missing module (e.g. blobs pinned by VMs).
 	if len(skipped) > 0 {
-		return fmt.Errorf("gc aborted: modules skipped (lock busy): %s", strings.Join(skipped, ", "))
+		return p, fmt.Errorf("gc aborted: modules skipped (lock busy): %s", strings.Join(skipped, ", "))
 	}
 
 	// Phase 1: snapshot all locked modules.
-	snapshots := make(map[string]any, len(locked))
-	for _, m := range locked {
+	p.snapshots = make(map[string]any, len(p.locked))
+	for _, m := range p.locked {
 		snap, err := m.readSnapshot(ctx)
 		if err != nil {
-			return fmt.Errorf("gc aborted: snapshot %s: %w", m.getName(), err)
+			return p, fmt.Errorf("gc aborted: snapshot %s: %w", m.getName(), err)
 		}
-		snapshots[m.getName()] = snap
+		p.snapshots[m.getName()] = snap
 	}
 
 	// Phase 2: resolve deletion targets (cross-module via snapshots).
-	targets := make(map[string][]string)
-	for _, m := range locked {
-		if ids := m.resolveTargets(snapshots[m.getName()], snapshots); len(ids) > 0 {
-			targets[m.getName()] = ids
+	p.targets = make(map[string][]string)
+	for _, m := range p.locked {
+		if ids := m.resolveTargets(p.snapshots[m.getName()], p.snapshots); len(ids) > 0 {
+			p.targets[m.getName()] = ids
 		}
 	}
-
-	// Phase 3: collect (skip modules with no targets).
-	var errs []error
-	for _, m := range locked {
-		ids := targets[m.getName()]
-		if len(ids) == 0 {
-			continue
-		}
-		if err := m.collect(ctx, ids); err != nil {
-			errs = append(errs, fmt.Errorf("gc %s: %w", m.getName(), err))
-		}
-	}
-	return errors.Join(errs...)
+	return p, nil
 }
@@ -14,4 +14,5 @@ type runner interface {
 	readSnapshot(ctx context.Context) (any, error)
 	resolveTargets(snap any, others map[string]any) []string
 	collect(ctx context.Context, ids []string) error
+	usage(snap any, ids []string) ([]Usage, error)
 }
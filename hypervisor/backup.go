@@ -0,0 +1,48 @@
+package hypervisor
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// BackupManifestName is the archive entry holding a backup's manifest;
+	// it comes first.
+	BackupManifestName = "manifest.json"
+	// BackupVersion is the current backup archive format.
+	BackupVersion = 1
+)
+
+// BackupManifest describes a VM backup archive. The archive is a flat tar:
+// the manifest, then one entry per file the record points at (disks and
+// direct-boot kernel/initrd), named after the file's base name.
+type BackupManifest struct {
+	Version    int       `json:"version"`
+	Hypervisor string    `json:"hypervisor"`
+	CreatedAt  time.Time `json:"created_at"`
+	// Record is the VM as it was backed up, minus what stays on the host:
+	// volumes, snapshots, disk snapshots and the cgroup.
+	Record VMRecord `json:"record"`
+}
+
+// ReadBackupManifest reads the manifest entry a backup archive starts with,
+// leaving tr at the first file entry.
+func ReadBackupManifest(tr *tar.Reader) (*BackupManifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("read backup: %w", err)
+	}
+	if hdr.Name != BackupManifestName {
+		return nil, fmt.Errorf("not a VM backup: first entry is %q, want %q", hdr.Name, BackupManifestName)
+	}
+	var m BackupManifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode backup manifest: %w", err)
+	}
+	if m.Version != BackupVersion {
+		return nil, fmt.Errorf("backup format version %d is not supported (want %d)", m.Version, BackupVersion)
+	}
+	return &m, nil
+}
@@ -0,0 +1,119 @@
+package hypervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+const (
+	// BootLogName is the file under a VM's log dir that holds the console
+	// output captured by the last boot probe.
+	BootLogName = "boot.log"
+
+	bootTailLines = 20
+	// maxBootBuffer bounds the console output kept in memory for matching;
+	// the full output still goes to the boot log.
+	maxBootBuffer = 64 << 10
+)
+
+// BootError reports a guest that failed its boot probe.
+type BootError struct {
+	Reason string // why the probe gave up
+	Tail   string // last lines of console output
+}
+
+func (e *BootError) Error() string {
+	if e.Tail == "" {
+		return "boot failed: " + e.Reason
+	}
+	return fmt.Sprintf("boot failed: %s; console tail:\n%s", e.Reason, e.Tail)
+}
+
+// ProbeBoot reads the guest console until probe's pattern appears, returning
+// a *BootError when the kernel panics, the console closes or the probe times
+// out first. Everything read is copied to logPath. The console is closed
+// before ProbeBoot returns.
+func ProbeBoot(ctx context.Context, console io.ReadCloser, probe *types.BootProbe, logPath string) error {
+	defer console.Close() //nolint:errcheck
+	re, err := probe.Regexp()
+	if err != nil {
+		return fmt.Errorf("boot pattern: %w", err)
+	}
+
+	var logFile *os.File
+	if logPath != "" {
+		if logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640); err != nil { //nolint:gosec,mnd
+			log.WithFunc("hypervisor.ProbeBoot").Warnf(ctx, "create boot log: %v", err)
+		} else {
+			defer logFile.Close() //nolint:errcheck
+		}
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, probe.Timeout())
+	defer cancel()
+	// Closing the console is the only portable way to interrupt a blocked
+	// read on both PTYs and sockets.
+	stop := context.AfterFunc(probeCtx, func() { _ = console.Close() })
+	defer stop()
+
+	var buf []byte
+	chunk := make([]byte, 4096) //nolint:mnd
+	for {
+		n, readErr := console.Read(chunk)
+		if n > 0 {
+			if logFile != nil {
+				_, _ = logFile.Write(chunk[:n])
+			}
+			buf = append(buf, chunk[:n]...)
+			if len(buf) > maxBootBuffer {
+				buf = buf[len(buf)-maxBootBuffer:]
+			}
+			if types.BootFailurePattern.Match(buf) {
+				return &BootError{Reason: "kernel panic", Tail: consoleTail(buf, bootTailLines)}
+			}
+			if re.Match(buf) {
+				return nil
+			}
+		}
+		if readErr == nil {
+			continue
+		}
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(probeCtx.Err(), context.DeadlineExceeded):
+			return &BootError{
+				Reason: fmt.Sprintf("no boot pattern match within %s", probe.Timeout()),
+				Tail:   consoleTail(buf, bootTailLines),
+			}
+		default:
+			return &BootError{
+				Reason: fmt.Sprintf("console closed: %v", readErr),
+				Tail:   consoleTail(buf, bootTailLines),
+			}
+		}
+	}
+}
+
+// consoleTail returns the last n non-empty lines of console output, with
+// carriage returns dropped.
+func consoleTail(buf []byte, n int) string {
+	var lines []string
+	for line := range strings.SplitSeq(strings.ReplaceAll(string(buf), "\r", ""), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
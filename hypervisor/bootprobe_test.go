@@ -0,0 +1,96 @@
+package hypervisor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestProbeBoot(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		pattern    string
+		hold       bool // keep the console open after output, as a live guest does
+		wantReason string
+		wantTail   string
+	}{
+		{name: "login prompt", output: "Booting\r\nUbuntu 24.04\r\n\r\nvm login: ", hold: true},
+		{name: "custom pattern", output: "init\nREADY\n", pattern: "^READY$", hold: true},
+		{
+			name:       "kernel panic",
+			output:     "Booting\nVFS: cannot open root device\nKernel panic - not syncing: VFS: Unable to mount root fs\n",
+			hold:       true,
+			wantReason: "kernel panic",
+			wantTail:   "Kernel panic - not syncing",
+		},
+		{name: "console closed", output: "Booting\n", wantReason: "console closed", wantTail: "Booting"},
+		{name: "timeout", output: "Booting\nstill booting\n", hold: true, wantReason: "no boot pattern match", wantTail: "still booting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w := io.Pipe()
+			go func() {
+				_, _ = w.Write([]byte(tt.output))
+				if !tt.hold {
+					_ = w.Close()
+				}
+			}()
+			t.Cleanup(func() { _ = w.Close() })
+
+			logPath := filepath.Join(t.TempDir(), BootLogName)
+			probe := &types.BootProbe{TimeoutSeconds: 1, Pattern: tt.pattern}
+			err := ProbeBoot(t.Context(), r, probe, logPath)
+
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else {
+				var bootErr *BootError
+				if !errors.As(err, &bootErr) {
+					t.Fatalf("expected *BootError, got %v", err)
+				}
+				if !strings.HasPrefix(bootErr.Reason, tt.wantReason) {
+					t.Errorf("reason %q, want prefix %q", bootErr.Reason, tt.wantReason)
+				}
+				if !strings.Contains(bootErr.Tail, tt.wantTail) {
+					t.Errorf("tail %q does not contain %q", bootErr.Tail, tt.wantTail)
+				}
+			}
+			data, readErr := os.ReadFile(logPath)
+			if readErr != nil {
+				t.Fatalf("read boot log: %v", readErr)
+			}
+			if string(data) != tt.output {
+				t.Errorf("boot log %q, want %q", data, tt.output)
+			}
+		})
+	}
+}
+
+func TestProbeBoot_Canceled(t *testing.T) {
+	r, w := io.Pipe()
+	t.Cleanup(func() { _ = w.Close() })
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	err := ProbeBoot(ctx, r, &types.BootProbe{TimeoutSeconds: 10}, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected caller's context error, got %v", err)
+	}
+}
+
+func TestConsoleTail(t *testing.T) {
+	got := consoleTail([]byte("a\r\n\r\nb\nc\n"), 2)
+	if got != "b\nc" {
+		t.Errorf("got %q, want %q", got, "b\nc")
+	}
+}
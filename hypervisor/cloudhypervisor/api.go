@@ -12,17 +12,44 @@ type chVMConfig struct {
 	Console *chRuntimeFile `json:"console,omitempty"`
 
 	// Required — value (always present).
-	CPUs     chCPUs   `json:"cpus"`
-	Memory   chMemory `json:"memory"`
-	Disks    []chDisk `json:"disks,omitempty"`
-	Nets     []chNet  `json:"net,omitempty"`
-	RNG      chRNG    `json:"rng"`
-	Watchdog bool     `json:"watchdog"`
+	CPUs     chCPUs     `json:"cpus"`
+	Memory   chMemory   `json:"memory"`
+	Disks    []chDisk   `json:"disks,omitempty"`
+	Nets     []chNet    `json:"net,omitempty"`
+	Devices  []chDevice `json:"devices,omitempty"`
+	RNG      chRNG      `json:"rng"`
+	Watchdog bool       `json:"watchdog"`
+	NUMA     []chNUMA   `json:"numa,omitempty"`
+	Pmem     []chPmem   `json:"pmem,omitempty"`
+	TPM      *chTPM     `json:"tpm,omitempty"`
+
+	Platform *chPlatform `json:"platform,omitempty"`
+}
+
+// chPlatform carries the confidential-computing switches and the SMBIOS
+// serial number of CH's platform config; other platform fields are left
+// to CH's defaults.
+type chPlatform struct {
+	SEVSNP       bool   `json:"sev_snp,omitempty"`
+	TDX          bool   `json:"tdx,omitempty"`
+	SerialNumber string `json:"serial_number,omitempty"`
+}
+
+// chDevice is a VFIO passthrough device, e.g. an SR-IOV VF.
+type chDevice struct {
+	Path string `json:"path"`
+}
+
+type chTPM struct {
+	Socket string `json:"socket"`
 }
 
 type chNet struct {
 	ID        string `json:"id,omitempty"`
 	Tap       string `json:"tap"`
+	FDs       []int  `json:"-"` // macvtap queue fds, CLI only
+	VhostUser bool   `json:"vhost_user,omitempty"`
+	Socket    string `json:"vhost_socket,omitempty"`
 	Mac       string `json:"mac,omitempty"`
 	NumQueues int    `json:"num_queues,omitempty"`
 	QueueSize int    `json:"queue_size,omitempty"`
@@ -37,21 +64,50 @@ type chPayload struct {
 	Kernel    string `json:"kernel,omitempty"`
 	Initramfs string `json:"initramfs,omitempty"`
 	Cmdline   string `json:"cmdline,omitempty"`
+	IGVM      string `json:"igvm,omitempty"`
 }
 
 type chCPUs struct {
-	BootVCPUs int `json:"boot_vcpus"`
-	MaxVCPUs  int `json:"max_vcpus"`
+	BootVCPUs int             `json:"boot_vcpus"`
+	MaxVCPUs  int             `json:"max_vcpus"`
+	Affinity  []chCPUAffinity `json:"affinity,omitempty"`
+}
+
+type chCPUAffinity struct {
+	VCPU     int   `json:"vcpu"`
+	HostCPUs []int `json:"host_cpus"`
 }
 
 type chMemory struct {
-	Size      int64 `json:"size"`
-	HugePages bool  `json:"hugepages,omitempty"`
+	Size      int64          `json:"size"`
+	HugePages bool           `json:"hugepages,omitempty"`
+	Prefault  bool           `json:"prefault,omitempty"`
+	Shared    bool           `json:"shared,omitempty"` // required by vhost-user devices
+	Zones     []chMemoryZone `json:"zones,omitempty"`
+}
+
+// chMemoryZone is a slice of guest memory backing one NUMA node; when
+// zones are used, chMemory.Size must be 0.
+type chMemoryZone struct {
+	ID           string `json:"id"`
+	Size         int64  `json:"size"`
+	HugePages    bool   `json:"hugepages,omitempty"`
+	Prefault     bool   `json:"prefault,omitempty"`
+	Shared       bool   `json:"shared,omitempty"`
+	HostNUMANode *int   `json:"host_numa_node,omitempty"`
+}
+
+type chNUMA struct {
+	GuestNUMAID int      `json:"guest_numa_id"`
+	CPUs        []int    `json:"cpus,omitempty"`
+	MemoryZones []string `json:"memory_zones,omitempty"`
 }
 
 type chDisk struct {
 	ID           string `json:"id,omitempty"`
-	Path         string `json:"path"`
+	Path         string `json:"path,omitempty"`
+	VhostUser    bool   `json:"vhost_user,omitempty"`
+	Socket       string `json:"vhost_socket,omitempty"`
 	ReadOnly     bool   `json:"readonly,omitempty"`
 	DirectIO     *bool  `json:"direct,omitempty"`
 	IoUring      bool   `json:"io_uring,omitempty"`
@@ -61,6 +117,28 @@ type chDisk struct {
 	NumQueues    int    `json:"num_queues,omitempty"`
 	QueueSize    int    `json:"queue_size,omitempty"`
 	Serial       string `json:"serial,omitempty"`
+
+	RateLimiter *chRateLimiter `json:"rate_limiter_config,omitempty"`
+}
+
+// chRateLimiter throttles a device with token buckets refilled every
+// RefillTime milliseconds; a nil bucket leaves that dimension unlimited.
+type chRateLimiter struct {
+	Bandwidth *chTokenBucket `json:"bandwidth,omitempty"`
+	Ops       *chTokenBucket `json:"ops,omitempty"`
+}
+
+type chTokenBucket struct {
+	Size       int64 `json:"size"`
+	RefillTime int64 `json:"refill_time"`
+}
+
+// chPmem maps a file into the guest as a virtio-pmem region. With
+// DiscardWrites the mapping is private, so the backing file stays pristine.
+type chPmem struct {
+	ID            string `json:"id,omitempty"`
+	File          string `json:"file"`
+	DiscardWrites bool   `json:"discard_writes,omitempty"`
 }
 
 type chBalloon struct {
@@ -84,5 +162,11 @@ type chVMInfoResponse struct {
 	Config struct {
 		Serial  chRuntimeFile `json:"serial"`
 		Console chRuntimeFile `json:"console"`
+		Disks   []chDisk      `json:"disks"`
 	} `json:"config"`
+	State            string `json:"state"`
+	MemoryActualSize int64  `json:"memory_actual_size,omitempty"`
 }
+
+// chCounters is the vm.counters response: device ID → counter name → value.
+type chCounters map[string]map[string]uint64
@@ -1,10 +1,13 @@
 package cloudhypervisor
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/projecteru2/core/log"
@@ -24,33 +27,33 @@ const (
 	// inflated to 75%, allowing OOM deflation headroom.
 	defaultBalloon = 4
 	cidataFile     = "cidata.img"
+	// rateLimiterRefillMS is the token-bucket refill period of disk rate
+	// limiters; one second makes each bucket's size a per-second rate.
+	rateLimiterRefillMS = 1000
 )
 
 func buildVMConfig(ctx context.Context, rec *hypervisor.VMRecord, consoleSockPath string) *chVMConfig {
 	cpu := rec.Config.CPU
 	mem := rec.Config.Memory
 
-	maxVCPUs := runtime.NumCPU()
-	if cpu > maxVCPUs {
+	hostCPUs := runtime.NumCPU()
+	if cpu > hostCPUs {
 		log.WithFunc("cloudhypervisor.buildVMConfig").Warnf(ctx,
-			"requested %d vCPUs exceeds host cores (%d), clamping to %d", cpu, maxVCPUs, maxVCPUs)
-		cpu = maxVCPUs
+			"requested %d vCPUs exceeds host cores (%d), clamping to %d", cpu, hostCPUs, hostCPUs)
+		cpu = hostCPUs
 	}
+	// An explicit ceiling may exceed the host cores: hotplugged vCPUs are
+	// overcommitted like any other thread.
+	maxVCPUs := cmp.Or(rec.Config.MaxCPU, hostCPUs)
 
 	cfg := &chVMConfig{
 		CPUs:     chCPUs{BootVCPUs: cpu, MaxVCPUs: maxVCPUs},
-		Memory:   chMemory{Size: mem, HugePages: utils.DetectHugePages()},
+		Memory:   chMemory{Size: mem},
 		RNG:      chRNG{Src: "/dev/urandom"},
 		Watchdog: true,
 	}
 
-	if isDirectBoot(rec.BootConfig) {
-		cfg.Serial = &chRuntimeFile{Mode: "Off"}
-		cfg.Console = &chRuntimeFile{Mode: "Pty"}
-	} else {
-		cfg.Serial = &chRuntimeFile{Mode: "Socket", Socket: consoleSockPath}
-		cfg.Console = &chRuntimeFile{Mode: "Off"}
-	}
+	cfg.Serial, cfg.Console = consoleDevices(&rec.Config, isDirectBoot(rec.BootConfig), consoleSockPath, rec.LogDir)
 
 	// Balloon: 25% of memory, only when memory >= 256 MiB.
 	if mem >= minBalloonMemory {
@@ -61,15 +64,55 @@ func buildVMConfig(ctx context.Context, rec *hypervisor.VMRecord, consoleSockPat
 		}
 	}
 
+	cfg.CPUs.Affinity = cpuAffinity(rec.Config.CPUSet, cpu)
+	if numa := rec.Config.NUMA; numa != nil {
+		if numa.Nodes > cpu {
+			log.WithFunc("cloudhypervisor.buildVMConfig").Warnf(ctx,
+				"%d NUMA nodes exceed %d vCPUs after clamping, booting without NUMA topology", numa.Nodes, cpu)
+		} else {
+			applyNUMA(cfg, numa, cpu, mem)
+		}
+	}
+
 	for _, storageConfig := range rec.StorageConfigs {
-		if rec.FirstBooted && !isDirectBoot(rec.BootConfig) && isCidataDisk(storageConfig) {
+		if bootSkipsDisk(rec)(storageConfig) {
+			continue
+		}
+		if storageConfig.Pmem {
+			cfg.Pmem = append(cfg.Pmem, chPmem{File: storageConfig.Path, DiscardWrites: true})
+			continue
+		}
+		if rec.Config.DiskBackend.VhostUser() && isBackendDisk(storageConfig) {
+			cfg.Disks = append(cfg.Disks, chDisk{
+				VhostUser: true,
+				Socket:    qsdSockPath(rec.RunDir),
+				NumQueues: cpu,
+				QueueSize: defaultDiskQueueSize,
+			})
+			shareMemory(cfg)
+			continue
+		}
+		d := storageConfigToDisk(storageConfig, cpu)
+		d.RateLimiter = diskRateLimiter(&rec.Config)
+		cfg.Disks = append(cfg.Disks, d)
+	}
+
+	fds := hypervisor.MacvtapFDs(rec.NetworkConfigs)
+	for i, nc := range rec.NetworkConfigs {
+		if nc.VFIODevice != "" {
+			cfg.Devices = append(cfg.Devices, chDevice{Path: nc.VFIODevice})
 			continue
 		}
-		cfg.Disks = append(cfg.Disks, storageConfigToDisk(storageConfig, cpu))
+		n := networkConfigToNet(nc)
+		n.FDs = fds[i]
+		cfg.Nets = append(cfg.Nets, n)
+		if n.VhostUser {
+			shareMemory(cfg)
+		}
 	}
 
-	for _, nc := range rec.NetworkConfigs {
-		cfg.Nets = append(cfg.Nets, networkConfigToNet(nc))
+	if rec.Config.TPM {
+		cfg.TPM = &chTPM{Socket: swtpmSockPath(rec.RunDir)}
 	}
 
 	if boot := rec.BootConfig; boot != nil {
@@ -88,7 +131,101 @@ func buildVMConfig(ctx context.Context, rec *hypervisor.VMRecord, consoleSockPat
 	return cfg
 }
 
+// shareMemory maps guest memory shared, so a vhost-user backend (passt,
+// qemu-storage-daemon) can access the virtqueues.
+func shareMemory(cfg *chVMConfig) {
+	cfg.Memory.Shared = true
+	for i := range cfg.Memory.Zones {
+		cfg.Memory.Zones[i].Shared = true
+	}
+}
+
+// cpuAffinity pins the boot vCPUs to the host CPUs in cpuset: one host CPU
+// per vCPU when the set is large enough, otherwise every vCPU floats over
+// the whole set. Returns nil when cpuset is empty.
+func cpuAffinity(cpuset string, vcpus int) []chCPUAffinity {
+	if cpuset == "" {
+		return nil
+	}
+	hosts, err := types.ParseCPUSet(cpuset)
+	if err != nil || len(hosts) == 0 {
+		return nil
+	}
+	affinity := make([]chCPUAffinity, vcpus)
+	for i := range affinity {
+		affinity[i] = chCPUAffinity{VCPU: i, HostCPUs: hosts}
+		if len(hosts) >= vcpus {
+			affinity[i].HostCPUs = []int{hosts[i]}
+		}
+	}
+	return affinity
+}
+
+// applyNUMA moves guest memory into one memory zone per NUMA node and
+// assigns each node its vCPU range, optionally bound to a host node.
+func applyNUMA(cfg *chVMConfig, numa *types.NUMAConfig, cpu int, mem int64) {
+	sizes := numa.NodeMemory(mem)
+	cfg.Memory.Size = 0
+	for i, r := range numa.NodeCPUs(cpu) {
+		zone := chMemoryZone{ID: fmt.Sprintf("mem%d", i), Size: sizes[i]}
+		if len(numa.HostNodes) > 0 {
+			zone.HostNUMANode = &numa.HostNodes[i]
+		}
+		cfg.Memory.Zones = append(cfg.Memory.Zones, zone)
+
+		node := chNUMA{GuestNUMAID: i, MemoryZones: []string{zone.ID}}
+		for c := r[0]; c <= r[1]; c++ {
+			node.CPUs = append(node.CPUs, c)
+		}
+		cfg.NUMA = append(cfg.NUMA, node)
+	}
+}
+
+// validateNUMA checks that every host node the guest binds to exists.
+func validateNUMA(numa *types.NUMAConfig) error {
+	if numa == nil {
+		return nil
+	}
+	for _, h := range numa.HostNodes {
+		if !utils.NUMANodeExists(h) {
+			return fmt.Errorf("--numa-host-nodes: host NUMA node %d does not exist", h)
+		}
+	}
+	return nil
+}
+
+// validateCPUSet checks that every CPU in cpuset is online on this host.
+func validateCPUSet(cpuset string) error {
+	if cpuset == "" {
+		return nil
+	}
+	cpus, err := types.ParseCPUSet(cpuset)
+	if err != nil {
+		return err
+	}
+	online, err := types.ParseCPUSet(utils.OnlineCPUs())
+	if err != nil {
+		return fmt.Errorf("read host CPUs: %w", err)
+	}
+	for _, c := range cpus {
+		if !slices.Contains(online, c) {
+			return fmt.Errorf("cpuset %s: host CPU %d is not online (online: %s)", cpuset, c, utils.OnlineCPUs())
+		}
+	}
+	return nil
+}
+
 func networkConfigToNet(nc *types.NetworkConfig) chNet {
+	if nc.UserSocket != "" {
+		// passt negotiates offloads itself over vhost-user.
+		return chNet{
+			VhostUser: true,
+			Socket:    nc.UserSocket,
+			Mac:       nc.Mac,
+			NumQueues: nc.NumQueues,
+			QueueSize: nc.QueueSize,
+		}
+	}
 	return chNet{
 		Tap:         nc.Tap,
 		Mac:         nc.Mac,
@@ -110,6 +247,10 @@ func storageConfigToDisk(storageConfig *types.StorageConfig, cpuCount int) chDis
 		NumQueues: cpuCount,
 		QueueSize: defaultDiskQueueSize,
 	}
+	if storageConfig.Volume != "" {
+		// A fixed device ID lets a volume be hot-unplugged by name.
+		d.ID = storageConfig.Serial
+	}
 
 	switch {
 	case filepath.Ext(storageConfig.Path) == ".qcow2":
@@ -117,6 +258,8 @@ func storageConfigToDisk(storageConfig *types.StorageConfig, cpuCount int) chDis
 		d.ImageType = "Qcow2"
 		d.BackingFiles = !storageConfig.RO
 		d.IoUring = !storageConfig.RO && runtime.GOARCH != "arm64"
+		// Guest discards free the overlay's clusters.
+		d.Sparse = !storageConfig.RO
 	case storageConfig.RO:
 		// OCI EROFS layer: readonly, leverage host page cache
 		d.ImageType = "Raw"
@@ -131,19 +274,57 @@ func storageConfigToDisk(storageConfig *types.StorageConfig, cpuCount int) chDis
 	return d
 }
 
+// diskRateLimiter returns the per-disk rate limiter of --disk-iops and
+// --disk-bandwidth, or nil when the VM's disks are not throttled.
+func diskRateLimiter(vmCfg *types.VMConfig) *chRateLimiter {
+	if !vmCfg.DiskThrottled() {
+		return nil
+	}
+	rl := &chRateLimiter{}
+	if vmCfg.DiskBandwidth > 0 {
+		rl.Bandwidth = &chTokenBucket{Size: vmCfg.DiskBandwidth, RefillTime: rateLimiterRefillMS}
+	}
+	if vmCfg.DiskIOPS > 0 {
+		rl.Ops = &chTokenBucket{Size: vmCfg.DiskIOPS, RefillTime: rateLimiterRefillMS}
+	}
+	return rl
+}
+
 // buildCLIArgs converts a chVMConfig into cloud-hypervisor CLI arguments.
 // The resulting args include --api-socket so the socket remains available
 // for later control operations (stop, shutdown, power-button).
 func buildCLIArgs(cfg *chVMConfig, socketPath string) []string {
 	args := []string{"--api-socket", socketPath}
 
-	args = append(args, "--cpus", fmt.Sprintf("boot=%d,max=%d", cfg.CPUs.BootVCPUs, cfg.CPUs.MaxVCPUs))
+	cpus := fmt.Sprintf("boot=%d,max=%d", cfg.CPUs.BootVCPUs, cfg.CPUs.MaxVCPUs)
+	if len(cfg.CPUs.Affinity) > 0 {
+		cpus += ",affinity=" + affinityToCLIArg(cfg.CPUs.Affinity)
+	}
+	args = append(args, "--cpus", cpus)
 
 	mem := fmt.Sprintf("size=%d", cfg.Memory.Size)
 	if cfg.Memory.HugePages {
 		mem += ",hugepages=on"
 	}
+	if cfg.Memory.Prefault {
+		mem += ",prefault=on"
+	}
+	if cfg.Memory.Shared {
+		mem += ",shared=on"
+	}
 	args = append(args, "--memory", mem)
+	if len(cfg.Memory.Zones) > 0 {
+		args = append(args, "--memory-zone")
+		for _, z := range cfg.Memory.Zones {
+			args = append(args, memoryZoneToCLIArg(z))
+		}
+	}
+	if len(cfg.NUMA) > 0 {
+		args = append(args, "--numa")
+		for _, n := range cfg.NUMA {
+			args = append(args, numaToCLIArg(n))
+		}
+	}
 
 	if len(cfg.Disks) > 0 {
 		args = append(args, "--disk")
@@ -152,6 +333,17 @@ func buildCLIArgs(cfg *chVMConfig, socketPath string) []string {
 		}
 	}
 
+	if cfg.TPM != nil {
+		args = append(args, "--tpm", "socket="+cfg.TPM.Socket)
+	}
+
+	if len(cfg.Pmem) > 0 {
+		args = append(args, "--pmem")
+		for _, p := range cfg.Pmem {
+			args = append(args, pmemToCLIArg(p))
+		}
+	}
+
 	if p := cfg.Payload; p != nil {
 		if p.Kernel != "" {
 			args = append(args, "--kernel", p.Kernel)
@@ -165,6 +357,17 @@ func buildCLIArgs(cfg *chVMConfig, socketPath string) []string {
 		if p.Cmdline != "" {
 			args = append(args, "--cmdline", p.Cmdline)
 		}
+		if p.IGVM != "" {
+			args = append(args, "--igvm", p.IGVM)
+		}
+	}
+
+	if pl := cfg.Platform; pl != nil {
+		var b kvBuilder
+		b.addIf(pl.SEVSNP, "sev_snp=on")
+		b.addIf(pl.TDX, "tdx=on")
+		b.addIf(pl.SerialNumber != "", "serial_number="+pl.SerialNumber)
+		args = append(args, "--platform", b.String())
 	}
 
 	if len(cfg.Nets) > 0 {
@@ -174,6 +377,13 @@ func buildCLIArgs(cfg *chVMConfig, socketPath string) []string {
 		}
 	}
 
+	if len(cfg.Devices) > 0 {
+		args = append(args, "--device")
+		for _, dev := range cfg.Devices {
+			args = append(args, "path="+dev.Path)
+		}
+	}
+
 	args = append(args, "--rng", fmt.Sprintf("src=%s", cfg.RNG.Src))
 
 	if cfg.Watchdog {
@@ -194,6 +404,19 @@ func buildCLIArgs(cfg *chVMConfig, socketPath string) []string {
 	return args
 }
 
+// affinityToCLIArg renders vCPU pins in CH's "[0@[2],1@[3,4]]" syntax.
+func affinityToCLIArg(affinity []chCPUAffinity) string {
+	pins := make([]string, len(affinity))
+	for i, a := range affinity {
+		hosts := make([]string, len(a.HostCPUs))
+		for j, h := range a.HostCPUs {
+			hosts[j] = strconv.Itoa(h)
+		}
+		pins[i] = fmt.Sprintf("%d@[%s]", a.VCPU, strings.Join(hosts, ","))
+	}
+	return "[" + strings.Join(pins, ",") + "]"
+}
+
 // kvBuilder accumulates key=value pairs for CH CLI arguments.
 type kvBuilder []string
 
@@ -207,7 +430,13 @@ func (b kvBuilder) String() string { return strings.Join(b, ",") }
 
 func diskToCLIArg(d chDisk) string {
 	var b kvBuilder
-	b.add("path=" + d.Path)
+	if d.VhostUser {
+		b.add("vhost_user=true")
+		b.add("socket=" + d.Socket)
+	} else {
+		b.add("path=" + d.Path)
+	}
+	b.addIf(d.ID != "", "id="+d.ID)
 	b.addIf(d.ReadOnly, "readonly=on")
 	b.addIf(d.DirectIO != nil && !*d.DirectIO, "direct=off")
 	b.addIf(d.IoUring, "io_uring=on")
@@ -217,12 +446,32 @@ func diskToCLIArg(d chDisk) string {
 	b.addIf(d.NumQueues > 0, fmt.Sprintf("num_queues=%d", d.NumQueues))
 	b.addIf(d.QueueSize > 0, fmt.Sprintf("queue_size=%d", d.QueueSize))
 	b.addIf(d.Serial != "", "serial="+d.Serial)
+	if rl := d.RateLimiter; rl != nil {
+		if bw := rl.Bandwidth; bw != nil {
+			b.add(fmt.Sprintf("bw_size=%d,bw_refill_time=%d", bw.Size, bw.RefillTime))
+		}
+		if ops := rl.Ops; ops != nil {
+			b.add(fmt.Sprintf("ops_size=%d,ops_refill_time=%d", ops.Size, ops.RefillTime))
+		}
+	}
 	return b.String()
 }
 
 func netToCLIArg(n chNet) string {
 	var b kvBuilder
-	b.add("tap=" + n.Tap)
+	switch {
+	case len(n.FDs) > 0:
+		fds := make([]string, len(n.FDs))
+		for i, fd := range n.FDs {
+			fds[i] = strconv.Itoa(fd)
+		}
+		b.add("fd=[" + strings.Join(fds, ",") + "]")
+	case n.VhostUser:
+		b.add("vhost_user=true")
+		b.add("socket=" + n.Socket)
+	default:
+		b.add("tap=" + n.Tap)
+	}
 	b.addIf(n.Mac != "", "mac="+n.Mac)
 	b.addIf(n.NumQueues > 0, fmt.Sprintf("num_queues=%d", n.NumQueues))
 	b.addIf(n.QueueSize > 0, fmt.Sprintf("queue_size=%d", n.QueueSize))
@@ -240,6 +489,36 @@ func balloonToCLIArg(b *chBalloon) string {
 	return args.String()
 }
 
+func memoryZoneToCLIArg(z chMemoryZone) string {
+	var b kvBuilder
+	b.add("id=" + z.ID)
+	b.add(fmt.Sprintf("size=%d", z.Size))
+	b.addIf(z.HugePages, "hugepages=on")
+	b.addIf(z.Prefault, "prefault=on")
+	b.addIf(z.Shared, "shared=on")
+	if z.HostNUMANode != nil {
+		b.add(fmt.Sprintf("host_numa_node=%d", *z.HostNUMANode))
+	}
+	return b.String()
+}
+
+func pmemToCLIArg(p chPmem) string {
+	var b kvBuilder
+	b.add("file=" + p.File)
+	b.addIf(p.DiscardWrites, "discard_writes=on")
+	return b.String()
+}
+
+func numaToCLIArg(n chNUMA) string {
+	var b kvBuilder
+	b.add(fmt.Sprintf("guest_numa_id=%d", n.GuestNUMAID))
+	if len(n.CPUs) > 0 {
+		b.add(fmt.Sprintf("cpus=[%d-%d]", n.CPUs[0], n.CPUs[len(n.CPUs)-1]))
+	}
+	b.addIf(len(n.MemoryZones) > 0, "memory_zones=["+strings.Join(n.MemoryZones, ",")+"]")
+	return b.String()
+}
+
 func runtimeFiletoCLIArg(c *chRuntimeFile) string {
 	switch strings.ToLower(c.Mode) {
 	case "file":
@@ -0,0 +1,280 @@
+package cloudhypervisor
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestCPUAffinity(t *testing.T) {
+	tests := []struct {
+		name   string
+		cpuset string
+		vcpus  int
+		want   string
+	}{
+		{"none", "", 2, ""},
+		{"dedicated", "2-5", 2, "[0@[2],1@[3]]"},
+		{"floating", "4-5", 3, "[0@[4,5],1@[4,5],2@[4,5]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			affinity := cpuAffinity(tt.cpuset, tt.vcpus)
+			got := ""
+			if affinity != nil {
+				got = affinityToCLIArg(affinity)
+			}
+			if got != tt.want {
+				t.Errorf("cpuAffinity(%q, %d) = %q, want %q", tt.cpuset, tt.vcpus, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyNUMA(t *testing.T) {
+	cfg := &chVMConfig{Memory: chMemory{Size: 4 << 30}}
+	applyNUMA(cfg, &types.NUMAConfig{Nodes: 2, HostNodes: []int{1, 0}}, 3, 4<<30)
+
+	if cfg.Memory.Size != 0 {
+		t.Errorf("top-level memory size = %d, want 0", cfg.Memory.Size)
+	}
+	wantZones := []string{
+		"id=mem0,size=2147483648,host_numa_node=1",
+		"id=mem1,size=2147483648,host_numa_node=0",
+	}
+	wantNodes := []string{
+		"guest_numa_id=0,cpus=[0-1],memory_zones=[mem0]",
+		"guest_numa_id=1,cpus=[2-2],memory_zones=[mem1]",
+	}
+	if len(cfg.Memory.Zones) != len(wantZones) || len(cfg.NUMA) != len(wantNodes) {
+		t.Fatalf("got %d zones / %d nodes, want %d / %d", len(cfg.Memory.Zones), len(cfg.NUMA), len(wantZones), len(wantNodes))
+	}
+	for i, want := range wantZones {
+		if got := memoryZoneToCLIArg(cfg.Memory.Zones[i]); got != want {
+			t.Errorf("zone %d = %q, want %q", i, got, want)
+		}
+	}
+	for i, want := range wantNodes {
+		if got := numaToCLIArg(cfg.NUMA[i]); got != want {
+			t.Errorf("node %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestPmemLayers(t *testing.T) {
+	storageConfigs := []*types.StorageConfig{
+		{Path: "/blobs/base.erofs", RO: true, Pmem: true},
+		{Path: "/blobs/top.erofs", RO: true, Pmem: true},
+		{Path: "/run/vm/cow.raw", Serial: CowSerial},
+	}
+	if got, want := strings.Join(ReverseLayerSerials(storageConfigs), ","), "pmem1,pmem0"; got != want {
+		t.Errorf("ReverseLayerSerials() = %q, want %q", got, want)
+	}
+
+	cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM: types.VM{Config: types.VMConfig{CPU: 1, Memory: 128 << 20}, StorageConfigs: storageConfigs},
+	}, "")
+	if len(cfg.Disks) != 1 || cfg.Disks[0].Serial != CowSerial {
+		t.Errorf("disks = %+v, want only the COW disk", cfg.Disks)
+	}
+	args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " ")
+	if want := "--pmem file=/blobs/base.erofs,discard_writes=on file=/blobs/top.erofs,discard_writes=on"; !strings.Contains(args, want) {
+		t.Errorf("args %q missing %q", args, want)
+	}
+}
+
+func TestBuildVMConfig_TPM(t *testing.T) {
+	cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM:     types.VM{Config: types.VMConfig{CPU: 1, Memory: 128 << 20, TPM: true}},
+		RunDir: "/run/vm",
+	}, "")
+	args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " ")
+	if want := "--tpm socket=/run/vm/swtpm.sock"; !strings.Contains(args, want) {
+		t.Errorf("args %q missing %q", args, want)
+	}
+}
+
+func TestBuildVMConfig_DiskBackend(t *testing.T) {
+	vmCfg := types.VMConfig{CPU: 1, Memory: 128 << 20, DiskBackend: types.DiskBackendQSD}
+	storageConfigs := []*types.StorageConfig{
+		{Path: "/blobs/base.erofs", RO: true, Serial: "layer0"},
+		{Path: "/run/vm/cow.raw", Serial: CowSerial},
+		{Path: "/volumes/data.raw", Serial: "cocoon-vol-data", Volume: "data"},
+	}
+	cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM:     types.VM{Config: vmCfg, StorageConfigs: storageConfigs},
+		RunDir: "/run/vm",
+	}, "")
+	if !cfg.Memory.Shared {
+		t.Error("memory not shared with the vhost-user backend")
+	}
+	args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " ")
+	for _, want := range []string{
+		"path=/blobs/base.erofs,readonly=on",
+		"vhost_user=true,socket=/run/vm/qsd.sock,num_queues=1",
+		"path=/volumes/data.raw,id=cocoon-vol-data",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "path=/run/vm/cow.raw") {
+		t.Errorf("args %q still serve the COW through CH", args)
+	}
+	if cmdline := BuildCmdline(storageConfigs, nil, &vmCfg, nil); !strings.Contains(cmdline, "cocoon.cow="+vhostUserBlkSerial) {
+		t.Errorf("cmdline %q does not name the vhost-user-blk serial", cmdline)
+	}
+}
+
+func TestBuildVMConfig_DiskLimits(t *testing.T) {
+	storageConfigs := []*types.StorageConfig{
+		{Path: "/blobs/base.erofs", RO: true, Serial: "layer0"},
+		{Path: "/run/vm/cow.raw", Serial: CowSerial},
+	}
+	cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM: types.VM{
+			Config:         types.VMConfig{CPU: 1, Memory: 128 << 20, DiskIOPS: 2000, DiskBandwidth: 100 << 20},
+			StorageConfigs: storageConfigs,
+		},
+		RunDir: "/run/vm",
+	}, "")
+	args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " ")
+	for _, path := range []string{"/blobs/base.erofs", "/run/vm/cow.raw"} {
+		idx := strings.Index(args, "path="+path)
+		if idx < 0 {
+			t.Fatalf("args %q missing disk %s", args, path)
+		}
+		disk, _, _ := strings.Cut(args[idx:], " ")
+		for _, want := range []string{"bw_size=104857600,bw_refill_time=1000", "ops_size=2000,ops_refill_time=1000"} {
+			if !strings.Contains(disk, want) {
+				t.Errorf("disk %q missing %q", disk, want)
+			}
+		}
+	}
+
+	cfg = buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM:     types.VM{Config: types.VMConfig{CPU: 1, Memory: 128 << 20, DiskIOPS: 500}, StorageConfigs: storageConfigs},
+		RunDir: "/run/vm",
+	}, "")
+	if rl := cfg.Disks[1].RateLimiter; rl == nil || rl.Bandwidth != nil || rl.Ops == nil {
+		t.Errorf("iops-only limiter = %+v, want ops bucket only", rl)
+	}
+}
+
+func TestBuildVMConfig_NICs(t *testing.T) {
+	cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM: types.VM{
+			Config: types.VMConfig{CPU: 2, Memory: 128 << 20},
+			NetworkConfigs: []*types.NetworkConfig{
+				{Tap: "tap0", Mac: "02:00:00:00:00:01", NumQueues: 4},
+				{Macvtap: "mvt0123456789a1", Mac: "02:00:00:00:00:02", NumQueues: 4},
+				{VFIODevice: "/sys/bus/pci/devices/0000:3b:02.1", Mac: "02:00:00:00:00:03"},
+			},
+		},
+	}, "")
+	args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " ")
+	for _, want := range []string{"tap=tap0,mac=02:00:00:00:00:01", "fd=[3,4],mac=02:00:00:00:00:02,num_queues=4", "--device path=/sys/bus/pci/devices/0000:3b:02.1"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+}
+
+func TestBuildVMConfig_UsermodeNIC(t *testing.T) {
+	cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+		VM: types.VM{
+			Config: types.VMConfig{CPU: 1, Memory: 128 << 20},
+			NetworkConfigs: []*types.NetworkConfig{
+				{UserSocket: "/run/usermode/vm1/passt.sock", Mac: "02:00:00:00:00:01", NumQueues: 2},
+			},
+		},
+	}, "")
+	args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " ")
+	for _, want := range []string{"vhost_user=true,socket=/run/usermode/vm1/passt.sock,mac=02:00:00:00:00:01,num_queues=2", "shared=on"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "offload") {
+		t.Errorf("args %q: vhost-user NIC must not set offloads", args)
+	}
+}
+
+func TestBuildVMConfig_MaxCPU(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxCPU int
+		want   int
+	}{
+		{name: "default host cores", want: runtime.NumCPU()},
+		{name: "explicit", maxCPU: 64, want: 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := buildVMConfig(t.Context(), &hypervisor.VMRecord{
+				VM: types.VM{Config: types.VMConfig{CPU: 1, MaxCPU: tt.maxCPU, Memory: 128 << 20}},
+			}, "")
+			if cfg.CPUs.BootVCPUs != 1 || cfg.CPUs.MaxVCPUs != tt.want {
+				t.Errorf("cpus = %+v, want boot=1 max=%d", cfg.CPUs, tt.want)
+			}
+		})
+	}
+}
+
+func TestKernelConsoles(t *testing.T) {
+	tests := []struct {
+		name            string
+		serial, console types.ConsoleMode
+		want            string
+	}{
+		{name: "default", want: "console=hvc0"},
+		{name: "serial log alongside pty", serial: types.ConsoleFile, want: "console=ttyS0 console=hvc0"},
+		{name: "interactive serial", serial: types.ConsolePty, console: types.ConsoleFile, want: "console=hvc0 console=ttyS0"},
+		{name: "serial only", serial: types.ConsoleSocket, console: types.ConsoleOff, want: "console=ttyS0"},
+		{name: "all off", serial: types.ConsoleOff, console: types.ConsoleOff, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kernelConsoles(&types.VMConfig{Serial: tt.serial, Console: tt.console}); got != tt.want {
+				t.Errorf("kernelConsoles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIMDSSeed(t *testing.T) {
+	conf := &config.Config{IMDSListen: "10.88.0.1:8775"}
+	rec := func(boot *types.BootConfig, format types.MetadataFormat, nc *types.NetworkConfig) *hypervisor.VMRecord {
+		return &hypervisor.VMRecord{
+			VM:         types.VM{Config: types.VMConfig{MetadataFormat: format}, NetworkConfigs: []*types.NetworkConfig{nc}},
+			BootConfig: boot,
+		}
+	}
+	tap := &types.NetworkConfig{Tap: "tap0", Mac: "02:00:00:00:00:01"}
+	uefi := &types.BootConfig{}
+	seed := IMDSSeed(conf, rec(uefi, "", tap))
+	if seed != "ds=nocloud;s=http://10.88.0.1:8775/" {
+		t.Errorf("seed = %q", seed)
+	}
+	cfg := &chVMConfig{Platform: &chPlatform{SerialNumber: seed}}
+	if args := strings.Join(buildCLIArgs(cfg, "/run/vm/api.sock"), " "); !strings.Contains(args, "--platform serial_number="+seed) {
+		t.Errorf("args %q miss the seed", args)
+	}
+
+	for name, r := range map[string]*hypervisor.VMRecord{
+		"OCI":         rec(&types.BootConfig{KernelPath: "/k"}, "", tap),
+		"ConfigDrive": rec(uefi, types.MetadataConfigDrive, tap),
+		"usermode":    rec(uefi, "", &types.NetworkConfig{UserSocket: "/run/passt.sock"}),
+	} {
+		if got := IMDSSeed(conf, r); got != "" {
+			t.Errorf("%s VM got seed %q", name, got)
+		}
+	}
+	if got := IMDSSeed(&config.Config{}, rec(uefi, "", tap)); got != "" {
+		t.Errorf("seed %q without imds_listen", got)
+	}
+}
@@ -0,0 +1,340 @@
+package cloudhypervisor
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/metadata"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Backup writes a created or stopped VM to w as a backup archive: the
+// manifest, the VM's own disks and, for direct boot, its kernel and initrd.
+// A cloud image's overlay is flattened with its base image, so the archive
+// needs nothing from the image store; an OCI image's layers are included
+// as they are. Volumes are left out.
+func (ch *CloudHypervisor) Backup(ctx context.Context, ref string, w io.Writer) error {
+	id, rec, err := ch.loadStopped(ctx, ref, "back it up")
+	if err != nil {
+		return err
+	}
+	// swtpm state lives outside the disks and is not archived.
+	if rec.Config.TPM {
+		return fmt.Errorf("VM %s has a TPM: backup is not supported", id)
+	}
+	// The disk key stays in this host's keystore.
+	if rec.Config.Encrypt {
+		return fmt.Errorf("VM %s is encrypted: backup is not supported", id)
+	}
+
+	manifest := hypervisor.BackupManifest{
+		Version:    hypervisor.BackupVersion,
+		Hypervisor: typ,
+		CreatedAt:  time.Now(),
+		Record:     rec,
+	}
+	m := &manifest.Record
+	m.StorageConfigs, m.SnapshotIDs, m.DiskSnapshots, m.CgroupPath = nil, nil, nil, ""
+	m.RootPassword = nil // its key stays in this host's keystore
+	// The --copy-in files travel inline, not as paths on this host.
+	if m.Config.Files, err = metadata.InlineGuestFiles(rec.Config.Files); err != nil {
+		return err
+	}
+
+	// entries maps archive entry names to the host files they are read from.
+	entries := map[string]string{}
+	var order []string
+	add := func(path string) error {
+		name := filepath.Base(path)
+		if _, ok := entries[name]; ok {
+			return fmt.Errorf("two files of VM %s are named %s", id, name)
+		}
+		entries[name] = path
+		order = append(order, name)
+		return nil
+	}
+
+	directBoot := isDirectBoot(rec.BootConfig)
+	cowPath := ch.cowPath(ch.diskDir(&rec), directBoot)
+	for _, sc := range rec.StorageConfigs {
+		if sc.Volume != "" {
+			continue
+		}
+		c := *sc
+		m.StorageConfigs = append(m.StorageConfigs, &c)
+		if isScratchDisk(sc) || isSwapDisk(sc) {
+			continue // wiped on every stop or cold boot: nothing to keep
+		}
+		if err = add(sc.Path); err != nil {
+			return err
+		}
+	}
+	if directBoot {
+		for _, p := range []string{rec.BootConfig.KernelPath, rec.BootConfig.InitrdPath} {
+			if p == "" {
+				continue
+			}
+			if err = add(p); err != nil {
+				return err
+			}
+		}
+	} else {
+		tmpDir, tmpErr := os.MkdirTemp(ch.conf.VMRunDir(id), "backup-")
+		if tmpErr != nil {
+			return fmt.Errorf("create temp dir: %w", tmpErr)
+		}
+		defer os.RemoveAll(tmpDir) //nolint:errcheck
+		flat := filepath.Join(tmpDir, filepath.Base(cowPath))
+		if err = flattenQcow2(ctx, cowPath, flat); err != nil {
+			return err
+		}
+		// The overlay is one of the disks added above; archive the flat copy.
+		entries[filepath.Base(cowPath)] = flat
+		// The flattened overlay no longer needs its base image.
+		m.ImageBlobIDs = nil
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+	tw := tar.NewWriter(w)
+	if err = tw.WriteHeader(&tar.Header{
+		Name: hypervisor.BackupManifestName, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return fmt.Errorf("write manifest header: %w", err)
+	}
+	if _, err = tw.Write(data); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	for _, name := range order {
+		if err = utils.TarFile(tw, entries[name], name); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// RestoreBackup creates VM vmID, in Created state, from a backup whose
+// manifest m was read from tr. The archived files are extracted into the
+// VM's run directory; OCI layers and boot files this host's image store
+// already holds (at the recorded path, with the same content) are used
+// from there instead. As with CloneVM, instance state is regenerated for vmCfg and
+// networkConfigs: OCI kernel cmdline, cloudimg cidata with a fresh
+// instance-id.
+func (ch *CloudHypervisor) RestoreBackup(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, m *hypervisor.BackupManifest, tr *tar.Reader) (_ *types.VM, err error) {
+	if m.Hypervisor != typ {
+		return nil, fmt.Errorf("backup is of a %s VM, not %s", m.Hypervisor, typ)
+	}
+	// The archive carries file contents inline; a host path in it is not
+	// to be trusted.
+	for _, f := range vmCfg.Files {
+		if f.Source != "" {
+			return nil, fmt.Errorf("backup refers to host file %s for %s", f.Source, f.Path)
+		}
+	}
+	src := &m.Record
+	now := time.Now()
+	runDir := ch.conf.VMRunDir(vmID)
+	logDir := ch.conf.VMLogDir(vmID)
+
+	defer func() {
+		if err != nil {
+			_ = removeVMDirs(runDir, logDir, "")
+			ch.rollbackCreate(ctx, vmID, vmCfg.Name)
+		}
+	}()
+
+	if err = ch.reserveVM(ctx, vmID, vmCfg, maps.Clone(src.ImageBlobIDs), runDir, logDir); err != nil {
+		return nil, fmt.Errorf("reserve VM record: %w", err)
+	}
+	if err = utils.EnsureDirs(runDir, logDir); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	if err = StoreGuestFiles(runDir, vmCfg); err != nil {
+		return nil, err
+	}
+	stage, err := os.MkdirTemp(runDir, "backup-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(stage) //nolint:errcheck
+	if err = utils.ExtractTarEntries(stage, tr); err != nil {
+		return nil, fmt.Errorf("extract backup: %w", err)
+	}
+
+	// place returns where the VM finds the image file the backed-up VM
+	// had at path. The recorded path comes from the archive, so a host file
+	// is only trusted inside the image store and with the archived content.
+	place := func(path string) (string, error) {
+		staged := filepath.Join(stage, filepath.Base(path))
+		if ch.inImageStore(path) {
+			same, sameErr := sameContent(path, staged)
+			if sameErr != nil {
+				return "", fmt.Errorf("compare %s: %w", path, sameErr)
+			}
+			if same {
+				return path, nil
+			}
+		}
+		dst := filepath.Join(runDir, filepath.Base(path))
+		if renameErr := os.Rename(staged, dst); renameErr != nil {
+			return "", fmt.Errorf("place %s: %w", filepath.Base(path), renameErr)
+		}
+		return dst, nil
+	}
+
+	directBoot := isDirectBoot(src.BootConfig)
+	cowPath := ch.cowPath(runDir, directBoot)
+	if err = os.Rename(filepath.Join(stage, filepath.Base(cowPath)), cowPath); err != nil {
+		return nil, fmt.Errorf("place COW: %w", err)
+	}
+
+	storageConfigs := make([]*types.StorageConfig, 0, len(src.StorageConfigs))
+	for _, sc := range src.StorageConfigs {
+		c := *sc
+		if c.RO && !isCidataDisk(&c) {
+			if c.Path, err = place(c.Path); err != nil {
+				return nil, err
+			}
+		}
+		storageConfigs = append(storageConfigs, &c)
+	}
+	if err = updateCOWPath(storageConfigs, cowPath, directBoot); err != nil {
+		return nil, fmt.Errorf("update COW path: %w", err)
+	}
+	updateScratchPath(storageConfigs, ch.conf.ScratchPath(vmID))
+	updateSwapPath(storageConfigs, swapPath(runDir))
+	updateCloneCidataPath(storageConfigs, directBoot, ch.conf.CidataPath(vmID))
+	if storageConfigs, err = ch.ensureCloneCidata(ctx, vmID, vmCfg, networkConfigs, storageConfigs, directBoot); err != nil {
+		return nil, err
+	}
+
+	var bootCfg *types.BootConfig
+	if src.BootConfig != nil {
+		b := *src.BootConfig
+		bootCfg = &b
+	}
+	if directBoot {
+		if bootCfg.KernelPath, err = place(bootCfg.KernelPath); err != nil {
+			return nil, err
+		}
+		if bootCfg.InitrdPath != "" {
+			if bootCfg.InitrdPath, err = place(bootCfg.InitrdPath); err != nil {
+				return nil, err
+			}
+		}
+		dns, dnsErr := ch.conf.DNSServers()
+		if dnsErr != nil {
+			return nil, fmt.Errorf("parse DNS servers: %w", dnsErr)
+		}
+		bootCfg.Cmdline = BuildCmdline(storageConfigs, networkConfigs, vmCfg, dns)
+	}
+
+	info := types.VM{
+		ID: vmID, State: types.VMStateCreated,
+		Config:         *vmCfg,
+		StorageConfigs: storageConfigs,
+		NetworkConfigs: networkConfigs,
+		CreatedAt:      now, UpdatedAt: now,
+	}
+	if err = ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[vmID]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", vmID)
+		}
+		r.VM = info
+		r.BootConfig = bootCfg
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("finalize VM record: %w", err)
+	}
+
+	log.WithFunc("cloudhypervisor.RestoreBackup").Infof(ctx, "VM %s restored from a backup of VM %s", vmID, src.ID)
+	ch.recordEvent(ctx, types.EventCreated, vmID, vmCfg.Name, "restored from a backup of VM "+src.ID)
+	return &info, nil
+}
+
+// inImageStore reports whether path lies in the directories image blobs
+// and boot files are kept in: root_dir and the storage pools.
+func (ch *CloudHypervisor) inImageStore(path string) bool {
+	if !filepath.IsAbs(path) {
+		return false
+	}
+	path = filepath.Clean(path)
+	roots := []string{ch.conf.RootDir}
+	for _, pool := range ch.conf.StoragePools {
+		roots = append(roots, pool.Path)
+	}
+	for _, root := range roots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameContent reports whether the regular files a and b hold the same
+// bytes; a missing a is not an error.
+func sameContent(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if !infoA.Mode().IsRegular() || infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+	sumA, err := fileSHA256(a)
+	if err != nil {
+		return false, err
+	}
+	sumB, err := fileSHA256(b)
+	if err != nil {
+		return false, err
+	}
+	return sumA == sumB, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer f.Close() //nolint:errcheck
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// flattenQcow2 writes the standalone qcow2 image dst holding src and
+// everything in its backing chain.
+func flattenQcow2(ctx context.Context, src, dst string) error {
+	if out, err := exec.CommandContext(ctx, "qemu-img", "convert", "-O", "qcow2", src, dst).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("qemu-img convert %s: %s: %w", src, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package cloudhypervisor
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name, data string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	rec := testRecord("aaa111", "web", types.VMStateStopped)
+	rec.BootConfig = &types.BootConfig{KernelPath: file("vmlinuz", "kernel"), InitrdPath: file("initrd.img", "initrd")}
+	rec.ImageBlobIDs = map[string]struct{}{"abc": {}}
+	rec.SnapshotIDs = map[string]struct{}{"snap1": {}}
+	rec.StorageConfigs = []*types.StorageConfig{
+		{Path: file("abc.erofs", "layer"), RO: true, Serial: "layer0"},
+		{Path: file("cow.raw", "cow"), Serial: CowSerial},
+		{Path: file("data.raw", "volume"), Serial: "vol-v1", Volume: "v1"},
+	}
+	running := testRecord("bbb222", "db", types.VMStateRunning)
+	ch := newTestCH(t, rec, running)
+
+	var buf bytes.Buffer
+	if err := ch.Backup(t.Context(), "web", &buf); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+
+	tr := tar.NewReader(&buf)
+	files := map[string]string{}
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+		files[hdr.Name] = string(data)
+	}
+	want := []string{hypervisor.BackupManifestName, "abc.erofs", "cow.raw", "vmlinuz", "initrd.img"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("entries = %v, want %v", names, want)
+	}
+	if files["cow.raw"] != "cow" || files["vmlinuz"] != "kernel" {
+		t.Errorf("entry contents = %v", files)
+	}
+
+	var m hypervisor.BackupManifest
+	if err := json.Unmarshal([]byte(files[hypervisor.BackupManifestName]), &m); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	if m.Version != hypervisor.BackupVersion || m.Record.ID != rec.ID || m.Record.SnapshotIDs != nil {
+		t.Errorf("manifest = %+v", m)
+	}
+	if len(m.Record.StorageConfigs) != 2 || types.HasVolumes(m.Record.StorageConfigs) {
+		t.Errorf("storage configs = %+v, want the VM's own disks", m.Record.StorageConfigs)
+	}
+	if _, ok := m.Record.ImageBlobIDs["abc"]; !ok {
+		t.Errorf("image blob IDs = %v, want the OCI layers kept", m.Record.ImageBlobIDs)
+	}
+
+	if err := ch.Backup(t.Context(), "db", io.Discard); err == nil {
+		t.Error("expected error backing up a running VM")
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name, data string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	layer := file("abc.erofs", "layer")
+	kernel := file("vmlinuz", "kernel")
+	rec := testRecord("aaa111", "web", types.VMStateStopped)
+	rec.BootConfig = &types.BootConfig{KernelPath: kernel}
+	rec.StorageConfigs = []*types.StorageConfig{
+		{Path: layer, RO: true, Serial: "layer0"},
+		{Path: file("cow.raw", "cow"), Serial: CowSerial},
+	}
+	ch := newTestCH(t, rec)
+	ch.conf.StoragePools = []config.StoragePool{{Path: dir}} // dir stands in for the image store
+	ctx := t.Context()
+
+	var buf bytes.Buffer
+	if err := ch.Backup(ctx, "web", &buf); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	archive := buf.Bytes()
+	// The layer is still in the image store; the kernel is not.
+	if err := os.Remove(kernel); err != nil {
+		t.Fatal(err)
+	}
+
+	tr := tar.NewReader(bytes.NewReader(archive))
+	m, err := hypervisor.ReadBackupManifest(tr)
+	if err != nil {
+		t.Fatalf("ReadBackupManifest: %v", err)
+	}
+	cfg := m.Record.Config
+	cfg.Name = "web-restored"
+	vm, err := ch.RestoreBackup(ctx, "ccc333", &cfg, nil, m, tr)
+	if err != nil {
+		t.Fatalf("RestoreBackup: %v", err)
+	}
+	if vm.State != types.VMStateCreated || vm.Config.Name != "web-restored" {
+		t.Errorf("vm = %+v", vm)
+	}
+	if len(vm.StorageConfigs) != 2 || vm.StorageConfigs[0].Path != layer || vm.StorageConfigs[1].Path != ch.conf.COWRawPath("ccc333") {
+		t.Errorf("storage configs = %+v, %+v", vm.StorageConfigs[0], vm.StorageConfigs[1])
+	}
+	if data, _ := os.ReadFile(ch.conf.COWRawPath("ccc333")); string(data) != "cow" {
+		t.Errorf("COW = %q, want %q", data, "cow")
+	}
+	restored, err := ch.loadRecord(ctx, "ccc333")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKernel := filepath.Join(ch.conf.VMRunDir("ccc333"), "vmlinuz")
+	if restored.BootConfig.KernelPath != wantKernel {
+		t.Errorf("kernel = %s, want %s", restored.BootConfig.KernelPath, wantKernel)
+	}
+	if data, _ := os.ReadFile(wantKernel); string(data) != "kernel" {
+		t.Errorf("kernel = %q, want %q", data, "kernel")
+	}
+
+	// A restore under a taken name leaves nothing behind.
+	tr = tar.NewReader(bytes.NewReader(archive))
+	if m, err = hypervisor.ReadBackupManifest(tr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ch.RestoreBackup(ctx, "ddd444", &m.Record.Config, nil, m, tr); err == nil {
+		t.Fatal("expected error restoring under a taken name")
+	}
+	if _, err := os.Stat(ch.conf.VMRunDir("ddd444")); !os.IsNotExist(err) {
+		t.Errorf("run dir left behind: %v", err)
+	}
+}
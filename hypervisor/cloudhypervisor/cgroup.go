@@ -0,0 +1,67 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// cgroupPath returns the cgroup directory of a VM's CH process, or "" when
+// cgroup placement is disabled.
+func (ch *CloudHypervisor) cgroupPath(vmID string) string {
+	if ch.conf.CgroupParent == "" {
+		return ""
+	}
+	return filepath.Join(utils.CgroupRoot, ch.conf.CgroupParent, vmID)
+}
+
+// cgroupLimits derives the CH process limits from the VM config: vCPUs and
+// memory plus the configured VMM overhead, and the host-wide io settings
+// applied to the device holding the VM's disks. The tmpfs pages of a
+// scratch disk are charged to the CH process writing them, so memory.max
+// covers its full size too.
+func (ch *CloudHypervisor) cgroupLimits(ctx context.Context, vmCfg *types.VMConfig, runDir string) utils.CgroupLimits {
+	limits := utils.CgroupLimits{
+		CPUs:      float64(vmCfg.CPU) * float64(100+ch.conf.CgroupCPUOverheadPercent) / 100,       //nolint:mnd
+		MemoryMax: vmCfg.Memory + vmCfg.EphemeralDisk + int64(ch.conf.CgroupMemoryOverheadMB)<<20, //nolint:mnd
+		IOWeight:  ch.conf.CgroupIOWeight,
+	}
+	if ch.conf.CgroupIOReadBPS > 0 || ch.conf.CgroupIOWriteBPS > 0 {
+		dev, err := utils.BlockDevice(runDir)
+		if err != nil {
+			log.WithFunc("cloudhypervisor.cgroupLimits").Warnf(ctx, "skip io.max: %v", err)
+			return limits
+		}
+		limits.IODevice = dev
+		limits.IOReadBPS = ch.conf.CgroupIOReadBPS
+		limits.IOWriteBPS = ch.conf.CgroupIOWriteBPS
+	}
+	return limits
+}
+
+// setupCgroup creates the cgroup a VM's CH process is launched into and
+// returns its path ("" when disabled).
+func (ch *CloudHypervisor) setupCgroup(ctx context.Context, vmID string, vmCfg *types.VMConfig, runDir string) (string, error) {
+	path := ch.cgroupPath(vmID)
+	if path == "" {
+		return "", nil
+	}
+	if err := utils.SetupCgroup(path, ch.cgroupLimits(ctx, vmCfg, runDir)); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// removeCgroup drops a VM's cgroup after its CH process has exited.
+func removeCgroup(ctx context.Context, path string) {
+	if path == "" {
+		return
+	}
+	if err := utils.RemoveCgroup(path); err != nil {
+		log.WithFunc("cloudhypervisor.removeCgroup").Warnf(ctx, "%v", err)
+	}
+}
@@ -23,6 +23,15 @@ import (
 // Clone creates a new VM from a snapshot tar stream via vm.restore.
 // Three phases: placeholder record → extract+prepare → launch+finalize.
 func (ch *CloudHypervisor) Clone(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, snapshotConfig *types.SnapshotConfig, snapshot io.Reader) (_ *types.VM, err error) {
+	if err = ch.requireFeature(featureSnapshot); err != nil {
+		return nil, err
+	}
+	if err = validateCHBinary(vmCfg.CHBinary); err != nil {
+		return nil, err
+	}
+	if hypervisor.HasColdBootNIC(networkConfigs) {
+		return nil, fmt.Errorf("a clone from a snapshot cannot use macvtap, SR-IOV or usermode NICs: pass --network with a CNI network")
+	}
 	if vmCfg.Image == "" && snapshotConfig.Image != "" {
 		vmCfg.Image = snapshotConfig.Image
 	}
@@ -33,7 +42,7 @@ func (ch *CloudHypervisor) Clone(ctx context.Context, vmID string, vmCfg *types.
 
 	defer func() {
 		if err != nil {
-			_ = removeVMDirs(runDir, logDir)
+			_ = removeVMDirs(runDir, logDir, "")
 			ch.rollbackCreate(ctx, vmID, vmCfg.Name)
 		}
 	}()
@@ -64,10 +73,14 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 
 	storageConfigs := rebuildStorageConfigs(chCfg)
 	bootCfg := rebuildBootConfig(chCfg)
-	blobIDs := extractBlobIDs(storageConfigs, bootCfg)
+	// Older snapshots of OCI VMs name their VM's per-boot initramfs.
+	if bootCfg != nil && filepath.Base(bootCfg.InitrdPath) == BootInitrdName {
+		return nil, fmt.Errorf("snapshot boots from the per-boot initramfs %s of its VM: take a new snapshot", bootCfg.InitrdPath)
+	}
+	blobIDs := ExtractBlobIDs(storageConfigs, bootCfg)
 	directBoot := isDirectBoot(bootCfg)
 
-	cowPath := ch.cowPath(vmID, directBoot)
+	cowPath := ch.cowPath(runDir, directBoot)
 	if err = updateCOWPath(storageConfigs, cowPath, directBoot); err != nil {
 		return nil, fmt.Errorf("update COW path: %w", err)
 	}
@@ -79,7 +92,7 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 		return nil, fmt.Errorf("verify base files: %w", err)
 	}
 	if vmCfg.Storage > 0 {
-		if err = qemuExpandImage(ctx, cowPath, vmCfg.Storage, directBoot); err != nil {
+		if err = ExpandImage(ctx, cowPath, vmCfg.Storage, directBoot); err != nil {
 			return nil, fmt.Errorf("resize COW: %w", err)
 		}
 	}
@@ -87,7 +100,7 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 	stateReplacements := buildStateReplacements(chCfg, storageConfigs)
 
 	// Cloudimg: regenerate cidata with clone's identity and network config.
-	storageConfigs, err = ch.ensureCloneCidata(vmID, vmCfg, networkConfigs, storageConfigs, directBoot)
+	storageConfigs, err = ch.ensureCloneCidata(ctx, vmID, vmCfg, networkConfigs, storageConfigs, directBoot)
 	if err != nil {
 		return nil, err
 	}
@@ -96,12 +109,14 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 	// If snapshot had no cidata disk, patch only snapshot disks and hotplug cidata later.
 	patchStorageConfigs := restorePatchStorageConfigs(storageConfigs, directBoot, hadCidataInSnapshot)
 
-	consoleSock := consoleSockPath(runDir)
+	serial, console := consoleDevices(vmCfg, directBoot, consoleSockPath(runDir), logDir)
 	if err = patchCHConfig(chConfigPath, &patchOptions{
 		storageConfigs: patchStorageConfigs,
-		consoleSock:    consoleSock,
+		serial:         serial,
+		console:        console,
 		directBoot:     directBoot,
 		cpu:            vmCfg.CPU,
+		affinity:       cpuAffinity(vmCfg.CPUSet, vmCfg.CPU),
 		memory:         vmCfg.Memory,
 	}); err != nil {
 		return nil, fmt.Errorf("patch CH config: %w", err)
@@ -119,26 +134,37 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 		if dnsErr != nil {
 			return nil, fmt.Errorf("parse DNS servers: %w", dnsErr)
 		}
-		bootCfg.Cmdline = buildCmdline(storageConfigs, networkConfigs, vmCfg.Name, dns)
+		bootCfg.Cmdline = BuildCmdline(storageConfigs, networkConfigs, vmCfg, dns)
 	}
 
 	// Launch CH, restore, finalize.
 	sockPath := socketPath(runDir)
-	args := []string{"--api-socket", sockPath}
-	ch.saveCmdline(ctx, &hypervisor.VMRecord{RunDir: runDir}, args)
-
-	withNetwork := len(networkConfigs) > 0
-	pid, err := ch.launchProcess(ctx, &hypervisor.VMRecord{
-		VM:     types.VM{NetworkConfigs: networkConfigs},
-		RunDir: runDir,
-		LogDir: logDir,
-	}, sockPath, args, withNetwork)
+	withNetwork := hypervisor.NetnsPath(networkConfigs) != ""
+	sandbox, err := ch.forVM(vmCfg).sandboxArgs(vmCfg, runDir, networkConfigs)
+	if err != nil {
+		return nil, err
+	}
+	cgroupPath, err := ch.setupCgroup(ctx, vmID, vmCfg, runDir)
 	if err != nil {
+		return nil, fmt.Errorf("setup cgroup: %w", err)
+	}
+	args := append([]string{"--api-socket", sockPath}, sandbox...)
+	launchRec := &hypervisor.VMRecord{
+		VM:         types.VM{ID: vmID, Config: *vmCfg, NetworkConfigs: networkConfigs},
+		RunDir:     runDir,
+		LogDir:     logDir,
+		CgroupPath: cgroupPath,
+	}
+	ch.saveCmdline(ctx, launchRec, args)
+
+	pid, err := ch.launchProcess(ctx, launchRec, sockPath, args, withNetwork)
+	if err != nil {
+		removeCgroup(ctx, cgroupPath)
 		ch.markError(ctx, vmID)
 		return nil, fmt.Errorf("launch CH: %w", err)
 	}
 
-	if err := ch.restoreAndResumeClone(ctx, pid, sockPath, runDir, directBoot, hadCidataInSnapshot, storageConfigs, networkConfigs, chCfg, vmCfg.CPU); err != nil {
+	if err := ch.restoreAndResumeClone(ctx, pid, launchRec, directBoot, hadCidataInSnapshot, storageConfigs, networkConfigs, chCfg, vmCfg.CPU); err != nil {
 		return nil, err
 	}
 
@@ -149,6 +175,7 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 		Config:         *vmCfg,
 		StorageConfigs: storageConfigs,
 		NetworkConfigs: networkConfigs,
+		VMM:            launchRec.VMM,
 		CreatedAt:      now,
 		UpdatedAt:      now,
 		StartedAt:      &now,
@@ -161,24 +188,27 @@ func (ch *CloudHypervisor) cloneAfterExtract(ctx context.Context, vmID string, v
 		r.VM = info
 		r.BootConfig = bootCfg
 		r.ImageBlobIDs = blobIDs
+		r.CgroupPath = cgroupPath
 		// Clone VM is already running with cidata attached; cloud-init reinit
 		// is done via post-clone hints. Mark as first-booted so the next
 		// cold boot (stop+start) skips cidata — no need for a second cloud-init run.
 		r.FirstBooted = true
 		return nil
 	}); err != nil {
-		ch.abortLaunch(ctx, pid, sockPath, runDir)
+		ch.abortLaunch(ctx, pid, launchRec)
 		return nil, fmt.Errorf("finalize VM record: %w", err)
 	}
 
 	logger.Infof(ctx, "VM %s cloned from snapshot", vmID)
+	ch.recordEvent(ctx, types.EventCreated, vmID, vmCfg.Name, "cloned from snapshot")
+	ch.recordEvent(ctx, types.EventStarted, vmID, vmCfg.Name, "")
 	return &info, nil
 }
 
 func (ch *CloudHypervisor) restoreAndResumeClone(
 	ctx context.Context,
 	pid int,
-	sockPath, runDir string,
+	rec *hypervisor.VMRecord,
 	directBoot, hadCidataInSnapshot bool,
 	storageConfigs []*types.StorageConfig,
 	networkConfigs []*types.NetworkConfig,
@@ -187,12 +217,12 @@ func (ch *CloudHypervisor) restoreAndResumeClone(
 ) (err error) {
 	defer func() {
 		if err != nil {
-			ch.abortLaunch(ctx, pid, sockPath, runDir)
+			ch.abortLaunch(ctx, pid, rec)
 		}
 	}()
 
-	hc := utils.NewSocketHTTPClient(sockPath)
-	if err = restoreVM(ctx, hc, runDir); err != nil {
+	hc := utils.NewSocketHTTPClient(socketPath(rec.RunDir))
+	if err = restoreVM(ctx, hc, rec.RunDir); err != nil {
 		return fmt.Errorf("vm.restore: %w", err)
 	}
 
@@ -215,14 +245,14 @@ func (ch *CloudHypervisor) restoreAndResumeClone(
 	if err = resumeVM(ctx, hc); err != nil {
 		return fmt.Errorf("vm.resume: %w", err)
 	}
-	return nil
+	return ch.secureRuntime(ctx, rec)
 }
 
-func (ch *CloudHypervisor) ensureCloneCidata(vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, storageConfigs []*types.StorageConfig, directBoot bool) ([]*types.StorageConfig, error) {
+func (ch *CloudHypervisor) ensureCloneCidata(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, storageConfigs []*types.StorageConfig, directBoot bool) ([]*types.StorageConfig, error) {
 	if directBoot {
 		return storageConfigs, nil
 	}
-	if err := ch.generateCidata(vmID, vmCfg, networkConfigs); err != nil {
+	if err := ch.generateCidata(ctx, vmID, vmCfg, networkConfigs); err != nil {
 		return nil, fmt.Errorf("generate cidata: %w", err)
 	}
 	cidataPath := ch.conf.CidataPath(vmID)
@@ -257,6 +287,13 @@ func rebuildStorageConfigs(cfg *chVMConfig) []*types.StorageConfig {
 			Serial: d.Serial,
 		})
 	}
+	for _, p := range cfg.Pmem {
+		configs = append(configs, &types.StorageConfig{
+			Path: p.File,
+			RO:   true,
+			Pmem: true,
+		})
+	}
 	return configs
 }
 
@@ -342,23 +379,48 @@ func updateCOWPath(configs []*types.StorageConfig, newCOWPath string, directBoot
 		return nil
 	}
 	for _, sc := range configs {
-		if !sc.RO {
+		if !sc.RO && !isScratchDisk(sc) && !isSwapDisk(sc) {
 			sc.Path = newCOWPath
 		}
 	}
 	return nil
 }
 
-func buildCmdline(storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, vmName string, dnsServers []string) string {
+// BuildCmdline returns the kernel cmdline for a direct-boot (OCI) VM: the
+// cocoon-overlay initramfs layer/COW serials plus static ip= params (none
+// with DHCP), followed by the VM's CmdlineAppend so user arguments win over
+// the defaults.
+func BuildCmdline(storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, vmCfg *types.VMConfig, dnsServers []string) string {
 	var cmdline strings.Builder
+	if consoles := kernelConsoles(vmCfg); consoles != "" {
+		cmdline.WriteString(consoles + " ")
+	}
 	fmt.Fprintf(&cmdline,
-		"console=hvc0 loglevel=3 boot=cocoon-overlay cocoon.layers=%s cocoon.cow=%s clocksource=kvm-clock rw",
-		strings.Join(ReverseLayerSerials(storageConfigs), ","), CowSerial,
+		"loglevel=3 boot=cocoon-overlay cocoon.layers=%s cocoon.cow=%s clocksource=kvm-clock rw",
+		strings.Join(ReverseLayerSerials(storageConfigs), ","), cowSerial(vmCfg),
 	)
 
+	if vmCfg.Swap > 0 {
+		cmdline.WriteString(" cocoon.swap=" + SwapSerial)
+	}
+
 	if len(networkConfigs) > 0 {
 		cmdline.WriteString(" net.ifnames=0")
-		cmdline.WriteString(buildIPParams(networkConfigs, vmName, dnsServers))
+		static := networkConfigs
+		if vmCfg.DHCP {
+			static = nil
+		}
+		cmdline.WriteString(buildIPParams(static, vmCfg.GuestHostname(), dnsServers))
+		if vmCfg.Domain != "" {
+			cmdline.WriteString(" cocoon.domain=" + vmCfg.Domain)
+		}
+		// ip= has no MTU field; the initramfs applies cocoon.mtu= to every NIC.
+		if vmCfg.MTU > 0 {
+			fmt.Fprintf(&cmdline, " cocoon.mtu=%d", vmCfg.MTU)
+		}
+	}
+	if vmCfg.CmdlineAppend != "" {
+		cmdline.WriteString(" " + vmCfg.CmdlineAppend)
 	}
 
 	return cmdline.String()
@@ -368,9 +430,14 @@ func buildCmdline(storageConfigs []*types.StorageConfig, networkConfigs []*types
 // and a cocoon.hostname= parameter for the initramfs hostname script.
 // DHCP-only NICs get no ip= param — the initramfs detects the absence of
 // static config and generates DHCP systemd-networkd units per MAC.
-func buildIPParams(networkConfigs []*types.NetworkConfig, vmName string, dnsServers []string) string {
+// cocoon.dns= carries every configured DNS server, since ip= holds only
+// two and is absent with DHCP; the initramfs writes them to resolv.conf.
+func buildIPParams(networkConfigs []*types.NetworkConfig, hostname string, dnsServers []string) string {
 	var params strings.Builder
-	fmt.Fprintf(&params, " cocoon.hostname=%s", vmName)
+	fmt.Fprintf(&params, " cocoon.hostname=%s", hostname)
+	if len(dnsServers) > 0 {
+		fmt.Fprintf(&params, " cocoon.dns=%s", strings.Join(dnsServers, ","))
+	}
 	dns0, dns1 := dnsFromConfig(dnsServers)
 	for i, n := range networkConfigs {
 		if n.Network == nil || n.Network.IP == "" {
@@ -378,7 +445,7 @@ func buildIPParams(networkConfigs []*types.NetworkConfig, vmName string, dnsServ
 		}
 		param := fmt.Sprintf(" ip=%s::%s:%s:%s:eth%d:off",
 			n.Network.IP, n.Network.Gateway,
-			prefixToNetmask(n.Network.Prefix), vmName, i)
+			prefixToNetmask(n.Network.Prefix), hostname, i)
 		if dns0 != "" {
 			param += ":" + dns0
 			if dns1 != "" {
@@ -396,10 +463,11 @@ func buildIPParams(networkConfigs []*types.NetworkConfig, vmName string, dnsServ
 // replaces the entire virtio-net device with the correct MAC.
 func buildStateReplacements(chCfg *chVMConfig, storageConfigs []*types.StorageConfig) map[string]string {
 	m := make(map[string]string, len(chCfg.Disks))
-	if len(storageConfigs) == len(chCfg.Disks) {
+	disks := blockDevices(storageConfigs)
+	if len(disks) == len(chCfg.Disks) {
 		for i, d := range chCfg.Disks {
-			if storageConfigs[i].Path != d.Path {
-				m[d.Path] = storageConfigs[i].Path
+			if disks[i].Path != d.Path {
+				m[d.Path] = disks[i].Path
 			}
 		}
 	}
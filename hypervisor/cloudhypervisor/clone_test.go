@@ -119,13 +119,15 @@ func baseCHConfig() map[string]any {
 }
 
 func basePatchOpts() *patchOptions {
+	serial, console := consoleDevices(&types.VMConfig{}, true, "/new/console.sock", "/new/log")
 	return &patchOptions{
 		storageConfigs: []*types.StorageConfig{
 			{Path: "/new/layer.erofs", RO: true, Serial: "layer0"},
 			{Path: "/new/cow.raw", RO: false, Serial: "cocoon-cow"},
 		},
-		consoleSock: "/new/console.sock",
-		directBoot:  true,
+		serial:     serial,
+		console:    console,
+		directBoot: true,
 	}
 }
 
@@ -249,7 +251,7 @@ func TestPatchCHConfig_SerialConsole(t *testing.T) {
 
 		opts := basePatchOpts()
 		opts.directBoot = false
-		opts.consoleSock = "/new/console.sock"
+		opts.serial, opts.console = consoleDevices(&types.VMConfig{}, false, "/new/console.sock", "/new/log")
 		if err := patchCHConfig(path, opts); err != nil {
 			t.Fatal(err)
 		}
@@ -267,6 +269,26 @@ func TestPatchCHConfig_SerialConsole(t *testing.T) {
 			t.Errorf("console.mode: got %v, want Off", console["mode"])
 		}
 	})
+
+	t.Run("serial_file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := writeCHConfig(t, dir, baseCHConfig())
+
+		opts := basePatchOpts()
+		opts.serial, opts.console = consoleDevices(&types.VMConfig{Serial: types.ConsoleFile}, true, "/new/console.sock", "/new/log")
+		if err := patchCHConfig(path, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		result := readRawJSON(t, path)
+		serial := result["serial"].(map[string]any)
+		if serial["mode"] != "File" || serial["file"] != "/new/log/serial.log" {
+			t.Errorf("serial: got %v, want File /new/log/serial.log", serial)
+		}
+		if console := result["console"].(map[string]any); console["mode"] != "Pty" {
+			t.Errorf("console.mode: got %v, want Pty", console["mode"])
+		}
+	})
 }
 
 func TestPatchCHConfig_CPUMemoryBalloon(t *testing.T) {
@@ -502,6 +524,32 @@ func TestRebuildBootConfig(t *testing.T) {
 	})
 }
 
+// patchPayloadInitramfs
+
+func TestPatchPayloadInitramfs(t *testing.T) {
+	cfg := baseCHConfig()
+	cfg["payload"].(map[string]any)["initramfs"] = "/run/cocoon/vm/abc/" + BootInitrdName
+	path := writeCHConfig(t, t.TempDir(), cfg)
+	if err := patchPayloadInitramfs(path, "/var/lib/cocoon/initrd.img"); err != nil {
+		t.Fatal(err)
+	}
+	result := readRawJSON(t, path)
+	payload := result["payload"].(map[string]any)
+	if payload["initramfs"] != "/var/lib/cocoon/initrd.img" || payload["kernel"] != "/boot/vmlinux" {
+		t.Errorf("payload = %v", payload)
+	}
+	if _, ok := result["platform"]; !ok {
+		t.Error("unknown field platform was dropped")
+	}
+
+	if err := patchPayloadInitramfs(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readRawJSON(t, path)["payload"].(map[string]any)["initramfs"]; ok {
+		t.Error("initramfs kept without an initrd")
+	}
+}
+
 // patchStateJSON
 
 func TestPatchStateJSON(t *testing.T) {
@@ -618,3 +666,103 @@ func TestPatchStateJSON_EmptyMap(t *testing.T) {
 		t.Errorf("file changed with empty map: %s", data)
 	}
 }
+
+func TestBuildCmdline_Append(t *testing.T) {
+	storage := []*types.StorageConfig{{Path: "/l0.erofs", RO: true, Serial: "layer0"}, {Path: "/cow.raw", Serial: CowSerial}}
+	nets := []*types.NetworkConfig{{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24}}}
+
+	plain := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm"}, nil)
+	if strings.HasSuffix(plain, " ") {
+		t.Errorf("cmdline without append has trailing space: %q", plain)
+	}
+	got := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm", CmdlineAppend: "systemd.unified_cgroup_hierarchy=1 quiet"}, nil)
+	if want := plain + " systemd.unified_cgroup_hierarchy=1 quiet"; got != want {
+		t.Errorf("cmdline = %q, want %q", got, want)
+	}
+}
+
+func TestBuildCmdline_DHCP(t *testing.T) {
+	storage := []*types.StorageConfig{{Path: "/l0.erofs", RO: true, Serial: "layer0"}, {Path: "/cow.raw", Serial: CowSerial}}
+	nets := []*types.NetworkConfig{{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24}}}
+
+	static := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm"}, nil)
+	if !strings.Contains(static, " ip=10.0.0.2::10.0.0.1:") {
+		t.Errorf("static cmdline lacks ip=: %q", static)
+	}
+	got := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm", DHCP: true}, nil)
+	if strings.Contains(got, " ip=") {
+		t.Errorf("DHCP cmdline has ip=: %q", got)
+	}
+	for _, want := range []string{" net.ifnames=0", " cocoon.hostname=vm"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("DHCP cmdline lacks %q: %q", want, got)
+		}
+	}
+}
+
+func TestBuildCmdline_Hostname(t *testing.T) {
+	storage := []*types.StorageConfig{{Path: "/l0.erofs", RO: true, Serial: "layer0"}, {Path: "/cow.raw", Serial: CowSerial}}
+	nets := []*types.NetworkConfig{{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24}}}
+
+	got := BuildCmdline(storage, nets, &types.VMConfig{Name: "cocoon-ubuntu_24.04"}, nil)
+	for _, want := range []string{" cocoon.hostname=cocoon-ubuntu-24-04", ":255.255.255.0:cocoon-ubuntu-24-04:eth0:off"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("cmdline lacks %q: %q", want, got)
+		}
+	}
+	if strings.Contains(got, "cocoon.domain=") {
+		t.Errorf("cmdline without --domain has cocoon.domain=: %q", got)
+	}
+	got = BuildCmdline(storage, nets, &types.VMConfig{Name: "vm", Hostname: "web1", Domain: "example.com"}, nil)
+	for _, want := range []string{" cocoon.hostname=web1", ":web1:eth0:off", " cocoon.domain=example.com"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("cmdline lacks %q: %q", want, got)
+		}
+	}
+}
+
+func TestBuildCmdline_DNS(t *testing.T) {
+	storage := []*types.StorageConfig{{Path: "/l0.erofs", RO: true, Serial: "layer0"}, {Path: "/cow.raw", Serial: CowSerial}}
+	nets := []*types.NetworkConfig{{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24}}}
+	dns := []string{"10.0.0.53", "8.8.8.8", "1.1.1.1"}
+
+	static := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm"}, dns)
+	for _, want := range []string{" cocoon.dns=10.0.0.53,8.8.8.8,1.1.1.1", ":eth0:off:10.0.0.53:8.8.8.8"} {
+		if !strings.Contains(static, want) {
+			t.Errorf("static cmdline lacks %q: %q", want, static)
+		}
+	}
+	if got := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm", DHCP: true}, dns); !strings.Contains(got, " cocoon.dns=10.0.0.53,8.8.8.8,1.1.1.1") {
+		t.Errorf("DHCP cmdline lacks cocoon.dns=: %q", got)
+	}
+	if got := BuildCmdline(storage, nets, &types.VMConfig{Name: "vm"}, nil); strings.Contains(got, "cocoon.dns=") {
+		t.Errorf("cmdline without DNS has cocoon.dns=: %q", got)
+	}
+	if got := BuildCmdline(storage, nil, &types.VMConfig{Name: "vm"}, dns); strings.Contains(got, "cocoon.dns=") {
+		t.Errorf("cmdline without NICs has cocoon.dns=: %q", got)
+	}
+}
+
+func TestBuildCmdline_MTU(t *testing.T) {
+	storage := []*types.StorageConfig{{Path: "/l0.erofs", RO: true, Serial: "layer0"}, {Path: "/cow.raw", Serial: CowSerial}}
+	nets := []*types.NetworkConfig{{Network: &types.Network{IP: "10.0.0.2", Gateway: "10.0.0.1", Prefix: 24}}}
+
+	for _, tt := range []struct {
+		name  string
+		nets  []*types.NetworkConfig
+		vmCfg types.VMConfig
+		want  bool
+	}{
+		{"static", nets, types.VMConfig{Name: "vm", MTU: 1400}, true},
+		{"dhcp", nets, types.VMConfig{Name: "vm", MTU: 1400, DHCP: true}, true},
+		{"no override", nets, types.VMConfig{Name: "vm"}, false},
+		{"no NICs", nil, types.VMConfig{Name: "vm", MTU: 1400}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildCmdline(storage, tt.nets, &tt.vmCfg, nil)
+			if has := strings.Contains(got, " cocoon.mtu=1400"); has != tt.want {
+				t.Errorf("cocoon.mtu= present = %v, want %v: %q", has, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package cloudhypervisor
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// CloneVM creates a new VM from a created or stopped VM's disk.
+//
+// The COW disk is reflink-copied (falling back to a sparse copy); image
+// layers and the base qcow2 are shared. Instance-specific state is
+// regenerated: the new VM gets its own ID, name, network (MAC/netns/IP from
+// networkConfigs), kernel cmdline (OCI), and cidata with a fresh instance-id
+// so cloud-init re-runs on first boot (cloudimg). The clone is left in
+// Created state.
+func (ch *CloudHypervisor) CloneVM(ctx context.Context, srcRef, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig) (_ *types.VM, err error) {
+	srcID, err := ch.resolveRef(ctx, srcRef)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ch.loadRecord(ctx, srcID)
+	if err != nil {
+		return nil, err
+	}
+	switch src.State {
+	case types.VMStateCreated, types.VMStateStopped:
+	default:
+		return nil, fmt.Errorf("VM %s is %s, must be created or stopped to clone", srcID, src.State)
+	}
+	// A volume attaches to one VM at a time; the clone cannot share it.
+	if types.HasVolumes(src.StorageConfigs) {
+		return nil, fmt.Errorf("VM %s has volumes attached: clone is not supported", srcID)
+	}
+	// The disk must be quiescent: a live CH process may still be writing it.
+	if runErr := ch.withRunningVM(ctx, &src, func(_ int) error {
+		return fmt.Errorf("VM %s process is still running", srcID)
+	}); !errors.Is(runErr, hypervisor.ErrNotRunning) {
+		return nil, runErr
+	}
+	if vmCfg.Storage < src.Config.Storage {
+		return nil, fmt.Errorf("storage %d below source VM size %d", vmCfg.Storage, src.Config.Storage)
+	}
+
+	now := time.Now()
+	runDir := ch.conf.VMRunDir(vmID)
+	logDir := ch.conf.VMLogDir(vmID)
+	dataDir := ch.vmDataDir(vmID, vmCfg)
+
+	defer func() {
+		if err != nil {
+			_ = removeVMDirs(runDir, logDir, dataDir)
+			ch.deleteKey(ctx, vmID, vmCfg.Encrypt)
+			ch.rollbackCreate(ctx, vmID, vmCfg.Name)
+		}
+	}()
+
+	blobIDs := maps.Clone(src.ImageBlobIDs)
+	if err = ch.reserveVM(ctx, vmID, vmCfg, blobIDs, runDir, logDir); err != nil {
+		return nil, fmt.Errorf("reserve VM record: %w", err)
+	}
+	diskDir := cmp.Or(dataDir, runDir)
+	if err = utils.EnsureDirs(runDir, logDir, diskDir); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	// The source's files stay with the source.
+	if err = StoreGuestFiles(runDir, vmCfg); err != nil {
+		return nil, err
+	}
+
+	directBoot := isDirectBoot(src.BootConfig)
+	cowPath := ch.cowPath(diskDir, directBoot)
+	if err = utils.ReflinkCopy(cowPath, ch.cowPath(ch.diskDir(&src), directBoot)); err != nil {
+		return nil, fmt.Errorf("copy COW: %w", err)
+	}
+	// The copy is encrypted with the source's key.
+	if vmCfg.Encrypt {
+		if err = ch.copyKey(ctx, srcID, vmID); err != nil {
+			return nil, fmt.Errorf("copy disk key: %w", err)
+		}
+	}
+	if vmCfg.Storage > src.Config.Storage {
+		if err = ExpandImage(ctx, cowPath, vmCfg.Storage, directBoot); err != nil {
+			return nil, fmt.Errorf("resize COW: %w", err)
+		}
+	}
+
+	storageConfigs := make([]*types.StorageConfig, 0, len(src.StorageConfigs))
+	for _, sc := range src.StorageConfigs {
+		c := *sc
+		storageConfigs = append(storageConfigs, &c)
+	}
+	if err = updateCOWPath(storageConfigs, cowPath, directBoot); err != nil {
+		return nil, fmt.Errorf("update COW path: %w", err)
+	}
+	updateScratchPath(storageConfigs, ch.conf.ScratchPath(vmID))
+	updateSwapPath(storageConfigs, swapPath(diskDir))
+	updateCloneCidataPath(storageConfigs, directBoot, ch.conf.CidataPath(vmID))
+	if storageConfigs, err = ch.ensureCloneCidata(ctx, vmID, vmCfg, networkConfigs, storageConfigs, directBoot); err != nil {
+		return nil, err
+	}
+
+	var bootCfg *types.BootConfig
+	if src.BootConfig != nil {
+		b := *src.BootConfig
+		bootCfg = &b
+	}
+	if directBoot {
+		dns, dnsErr := ch.conf.DNSServers()
+		if dnsErr != nil {
+			return nil, fmt.Errorf("parse DNS servers: %w", dnsErr)
+		}
+		bootCfg.Cmdline = BuildCmdline(storageConfigs, networkConfigs, vmCfg, dns)
+	}
+
+	info := types.VM{
+		ID: vmID, State: types.VMStateCreated,
+		Config:         *vmCfg,
+		StorageConfigs: storageConfigs,
+		NetworkConfigs: networkConfigs,
+		CreatedAt:      now, UpdatedAt: now,
+	}
+	if err = ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[vmID]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", vmID)
+		}
+		r.VM = info
+		r.BootConfig = bootCfg
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("finalize VM record: %w", err)
+	}
+
+	log.WithFunc("cloudhypervisor.CloneVM").Infof(ctx, "VM %s cloned from VM %s", vmID, srcID)
+	ch.recordEvent(ctx, types.EventCreated, vmID, vmCfg.Name, "cloned from VM "+srcID)
+	return &info, nil
+}
@@ -0,0 +1,74 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestCloneVM_DirectBoot(t *testing.T) {
+	src := testRecord("aaa111", "template", types.VMStateStopped)
+	src.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux", Cmdline: "cocoon.hostname=template"}
+	ch := newTestCH(t, src)
+	ctx := t.Context()
+
+	srcCOW := ch.cowPath(ch.diskDir(src), true)
+	src.StorageConfigs = []*types.StorageConfig{
+		{Path: "/blobs/layer0.erofs", RO: true, Serial: "layer0"},
+		{Path: srcCOW, Serial: CowSerial},
+	}
+	if err := ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		idx.VMs[src.ID] = src
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(srcCOW), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(srcCOW, []byte("guest data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := src.Config
+	cfg.Name = "copy"
+	nets := []*types.NetworkConfig{{Mac: "aa:bb:cc:dd:ee:01", Network: &types.Network{IP: "10.0.0.9", Gateway: "10.0.0.1", Prefix: 24}}}
+	vm, err := ch.CloneVM(ctx, "template", "bbb222", &cfg, nets)
+	if err != nil {
+		t.Fatalf("CloneVM: %v", err)
+	}
+	if vm.State != types.VMStateCreated || vm.Config.Name != "copy" || vm.FirstBooted {
+		t.Errorf("unexpected clone: %+v", vm)
+	}
+
+	dstCOW := ch.cowPath(ch.conf.VMRunDir("bbb222"), true)
+	if data, err := os.ReadFile(dstCOW); err != nil || string(data) != "guest data" {
+		t.Errorf("COW not copied: %q %v", data, err)
+	}
+	if vm.StorageConfigs[1].Path != dstCOW || src.StorageConfigs[1].Path != srcCOW {
+		t.Errorf("COW paths: clone=%s src=%s", vm.StorageConfigs[1].Path, src.StorageConfigs[1].Path)
+	}
+
+	rec, err := ch.loadRecord(ctx, "bbb222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rec.BootConfig.Cmdline, "cocoon.hostname=copy") || !strings.Contains(rec.BootConfig.Cmdline, "ip=10.0.0.9") {
+		t.Errorf("cmdline not regenerated: %s", rec.BootConfig.Cmdline)
+	}
+	if rec.RunDir != ch.conf.VMRunDir("bbb222") {
+		t.Errorf("run dir = %s", rec.RunDir)
+	}
+
+	running := testRecord("ccc333", "busy", types.VMStateRunning)
+	ch = newTestCH(t, running)
+	busyCfg := running.Config
+	busyCfg.Name = "busy-copy"
+	if _, err := ch.CloneVM(ctx, "busy", "ddd444", &busyCfg, nil); err == nil {
+		t.Error("expected error cloning a running VM")
+	}
+}
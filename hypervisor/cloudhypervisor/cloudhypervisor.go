@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/projecteru2/cocoon/config"
 	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/keystore"
 	"github.com/projecteru2/cocoon/lock"
 	"github.com/projecteru2/cocoon/lock/flock"
 	"github.com/projecteru2/cocoon/storage"
@@ -21,6 +24,10 @@ type CloudHypervisor struct {
 	conf   *Config
 	store  storage.Store[hypervisor.VMIndex]
 	locker lock.Locker
+	keys   keystore.Keystore
+	// version of the installed binary; nil when it could not be probed,
+	// in which case no feature is gated and CH reports its own errors.
+	version *chVersion
 }
 
 // New creates a CloudHypervisor backend.
@@ -34,7 +41,13 @@ func New(conf *config.Config) (*CloudHypervisor, error) {
 	}
 	locker := flock.New(cfg.IndexLock())
 	store := storejson.New[hypervisor.VMIndex](cfg.IndexFile(), locker)
-	return &CloudHypervisor{conf: cfg, store: store, locker: locker}, nil
+	keys, err := keystore.New(conf)
+	if err != nil {
+		return nil, err
+	}
+	// Best-effort: read-only commands must keep working without the binary.
+	version, _ := probeVersion(cfg.CHBinary)
+	return &CloudHypervisor{conf: cfg, store: store, locker: locker, keys: keys, version: version}, nil
 }
 
 func (ch *CloudHypervisor) Type() string { return typ }
@@ -66,6 +79,63 @@ func (ch *CloudHypervisor) List(ctx context.Context) ([]*types.VM, error) {
 	})
 }
 
+// DiskUsage implements hypervisor.DiskUsageReporter.
+func (ch *CloudHypervisor) DiskUsage(ctx context.Context, ids []string) (map[string]int64, error) {
+	usage := make(map[string]int64, len(ids))
+	return usage, ch.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		for _, id := range ids {
+			if rec := idx.VMs[id]; rec != nil {
+				usage[id] = ch.rootDiskUsage(rec)
+			}
+		}
+		return nil
+	})
+}
+
+// SetGuestIP implements hypervisor.GuestIPRecorder.
+func (ch *CloudHypervisor) SetGuestIP(ctx context.Context, ref, mac, ip string) error {
+	return ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		for _, nc := range idx.VMs[id].NetworkConfigs {
+			if nc != nil && strings.EqualFold(nc.Mac, mac) {
+				nc.GuestIP = ip
+				return nil
+			}
+		}
+		return fmt.Errorf("VM %s has no NIC %s", id, mac)
+	})
+}
+
+// SetError implements hypervisor.ErrorRecorder.
+func (ch *CloudHypervisor) SetError(ctx context.Context, ref, reason string) error {
+	return ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		rec := idx.VMs[id]
+		rec.State = types.VMStateError
+		rec.Error = reason
+		rec.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// SetHealth implements hypervisor.HealthRecorder.
+func (ch *CloudHypervisor) SetHealth(ctx context.Context, ref string, health *types.Health) error {
+	return ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		idx.VMs[id].Health = health
+		return nil
+	})
+}
+
 // Delete removes VMs. Running VMs require force=true (stops them first).
 func (ch *CloudHypervisor) Delete(ctx context.Context, refs []string, force bool) ([]string, error) {
 	ids, err := ch.resolveRefs(ctx, refs)
@@ -85,13 +155,16 @@ func (ch *CloudHypervisor) Delete(ctx context.Context, refs []string, force bool
 		}); err != nil && !errors.Is(err, hypervisor.ErrNotRunning) {
 			return fmt.Errorf("stop before delete: %w", err)
 		}
+		ch.stopSidecars(ctx, rec.RunDir)
+		ch.removeScratch(ctx, id)
+		removeCgroup(ctx, rec.CgroupPath)
 		// Remove dirs BEFORE deleting the DB record so that a dir-cleanup
 		// failure keeps the record intact and the user can retry vm rm.
 		// This also ensures the ID lands in the succeeded list for network cleanup.
-		if err := removeVMDirs(rec.RunDir, rec.LogDir); err != nil {
+		if err := removeVMDirs(rec.RunDir, rec.LogDir, rec.DataDir, ch.conf.VMStateDir(id)); err != nil {
 			return fmt.Errorf("cleanup VM dirs: %w", err)
 		}
-		return ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		if err := ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
 			r := idx.VMs[id]
 			if r == nil {
 				return hypervisor.ErrNotFound
@@ -99,7 +172,13 @@ func (ch *CloudHypervisor) Delete(ctx context.Context, refs []string, force bool
 			delete(idx.Names, r.Config.Name)
 			delete(idx.VMs, id)
 			return nil
-		})
+		}); err != nil {
+			return err
+		}
+		ch.deleteKey(ctx, id, rec.Config.Encrypt)
+		DeleteRootPasswordKey(ctx, ch.keys, id, rec.RootPassword)
+		ch.recordEvent(ctx, types.EventDeleted, id, rec.Config.Name, "")
+		return nil
 	})
 }
 
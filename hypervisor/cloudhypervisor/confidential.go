@@ -0,0 +1,59 @@
+package cloudhypervisor
+
+import (
+	"fmt"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// validateConfidential checks at create time that the host can launch the
+// requested confidential guest and that the VM avoids features that share
+// guest memory with the host.
+func (ch *CloudHypervisor) validateConfidential(vmCfg *types.VMConfig) error {
+	switch vmCfg.Confidential {
+	case "":
+		return nil
+	case types.ConfidentialSEVSNP:
+		if !utils.DetectSEVSNP() {
+			return fmt.Errorf("--confidential %s: host KVM has no SEV-SNP support (/sys/module/kvm_amd/parameters/sev_snp)", vmCfg.Confidential)
+		}
+		if !utils.ValidFile(ch.conf.SNPIGVM) {
+			return fmt.Errorf("--confidential %s: snp_igvm %q is not a valid file", vmCfg.Confidential, ch.conf.SNPIGVM)
+		}
+	case types.ConfidentialTDX:
+		if !utils.DetectTDX() {
+			return fmt.Errorf("--confidential %s: host KVM has no TDX support (/sys/module/kvm_intel/parameters/tdx)", vmCfg.Confidential)
+		}
+		if !utils.ValidFile(ch.conf.TDXFirmware) {
+			return fmt.Errorf("--confidential %s: tdx_firmware %q is not a valid file", vmCfg.Confidential, ch.conf.TDXFirmware)
+		}
+	}
+	if vmCfg.PmemLayers {
+		return fmt.Errorf("--confidential %s cannot be combined with --pmem-layers: DAX maps host memory into the guest", vmCfg.Confidential)
+	}
+	return nil
+}
+
+// applyConfidential turns cfg into a confidential guest: the platform
+// option enables memory encryption, the balloon goes away (the host can
+// neither inspect nor reclaim encrypted pages) and the payload switches to
+// the TDX firmware or the SEV-SNP IGVM image.
+func (ch *CloudHypervisor) applyConfidential(cfg *chVMConfig, mode types.ConfidentialMode) {
+	if mode == "" {
+		return
+	}
+	cfg.Balloon = nil
+	if cfg.Payload == nil {
+		cfg.Payload = &chPayload{}
+	}
+	switch mode {
+	case types.ConfidentialSEVSNP:
+		cfg.Platform = &chPlatform{SEVSNP: true}
+		cfg.Payload.IGVM = ch.conf.SNPIGVM
+		cfg.Payload.Firmware, cfg.Payload.Kernel = "", ""
+	case types.ConfidentialTDX:
+		cfg.Platform = &chPlatform{TDX: true}
+		cfg.Payload.Firmware = ch.conf.TDXFirmware
+	}
+}
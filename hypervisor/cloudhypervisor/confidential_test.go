@@ -0,0 +1,53 @@
+package cloudhypervisor
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestApplyConfidential(t *testing.T) {
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{
+		TDXFirmware: "/fw/TDVF.fd",
+		SNPIGVM:     "/fw/snp.igvm",
+	}}}
+	newCfg := func() *chVMConfig {
+		return &chVMConfig{
+			Balloon: &chBalloon{Size: 1 << 30},
+			Payload: &chPayload{Kernel: "/k", Initramfs: "/i", Cmdline: "console=hvc0"},
+		}
+	}
+
+	cfg := newCfg()
+	ch.applyConfidential(cfg, "")
+	if cfg.Platform != nil || cfg.Balloon == nil {
+		t.Errorf("regular VM changed: platform=%+v balloon=%+v", cfg.Platform, cfg.Balloon)
+	}
+
+	cfg = newCfg()
+	ch.applyConfidential(cfg, types.ConfidentialTDX)
+	args := buildCLIArgs(cfg, "/run/vm/api.sock")
+	if cfg.Balloon != nil {
+		t.Error("TDX guest kept its balloon")
+	}
+	for _, want := range []string{"--platform tdx=on", "--firmware /fw/TDVF.fd", "--kernel /k"} {
+		if !strings.Contains(strings.Join(args, " "), want) {
+			t.Errorf("TDX args %v missing %q", args, want)
+		}
+	}
+
+	cfg = newCfg()
+	ch.applyConfidential(cfg, types.ConfidentialSEVSNP)
+	args = buildCLIArgs(cfg, "/run/vm/api.sock")
+	if slices.Contains(args, "--kernel") {
+		t.Errorf("SEV-SNP args %v still load the kernel directly", args)
+	}
+	for _, want := range []string{"--platform sev_snp=on", "--igvm /fw/snp.igvm", "--initramfs /i"} {
+		if !strings.Contains(strings.Join(args, " "), want) {
+			t.Errorf("SEV-SNP args %v missing %q", args, want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package cloudhypervisor
 
 import (
+	"cmp"
 	"path/filepath"
 	"time"
 
@@ -9,8 +10,18 @@ import (
 )
 
 const (
+	cowRawName  = "cow.raw"
+	overlayName = "overlay.qcow2"
+	scratchName = "scratch.raw"
+	swapName    = "swap.raw"
+
 	defaultSocketWaitTimeout    = 5 * time.Second
 	defaultTerminateGracePeriod = 5 * time.Second
+
+	// Process log rotation defaults, matching lumberjack's log.* defaults.
+	defaultLogMaxSizeMB  = 500
+	defaultLogMaxAgeDays = 28
+	defaultLogMaxBackups = 3
 )
 
 // Config holds Cloud Hypervisor specific configuration, embedding the global config.
@@ -45,14 +56,55 @@ func (c *Config) VMRunDir(vmID string) string { return filepath.Join(c.RunDir(),
 // VMLogDir returns the per-VM log directory.
 func (c *Config) VMLogDir(vmID string) string { return filepath.Join(c.LogDir(), vmID) }
 
+// DataRoot returns the CH directory under a --data-dir.
+func (c *Config) DataRoot(dataDir string) string { return filepath.Join(dataDir, "cloudhypervisor") }
+
+// VMDataDir returns the per-VM disk directory under a --data-dir.
+func (c *Config) VMDataDir(dataDir, vmID string) string {
+	return filepath.Join(c.DataRoot(dataDir), vmID)
+}
+
+// StateDir returns the top-level CH directory for per-VM state that must
+// survive a host reboot, under root_dir.
+func (c *Config) StateDir() string { return filepath.Join(c.dir(), "state") }
+
+// VMStateDir returns the per-VM persistent state directory.
+func (c *Config) VMStateDir(vmID string) string { return filepath.Join(c.StateDir(), vmID) }
+
+// SavedStateDir returns where Suspend saves a VM's vCPU, device and memory state.
+func (c *Config) SavedStateDir(vmID string) string {
+	return filepath.Join(c.VMStateDir(vmID), "saved")
+}
+
+// TPMStateDir returns the VM's swtpm state directory (keys, NVRAM, PCR policy).
+func (c *Config) TPMStateDir(vmID string) string {
+	return filepath.Join(c.VMStateDir(vmID), tpmStateDir)
+}
+
+// EphemeralDir returns the top-level CH directory for scratch disks.
+func (c *Config) EphemeralDir() string {
+	root := cmp.Or(c.Config.EphemeralDir, filepath.Join(c.Config.RunDir, "ephemeral"))
+	return filepath.Join(root, "cloudhypervisor")
+}
+
+// VMEphemeralDir returns the per-VM scratch disk directory.
+func (c *Config) VMEphemeralDir(vmID string) string {
+	return filepath.Join(c.EphemeralDir(), vmID)
+}
+
+// ScratchPath returns the path of a VM's --ephemeral-disk file.
+func (c *Config) ScratchPath(vmID string) string {
+	return filepath.Join(c.VMEphemeralDir(vmID), scratchName)
+}
+
 // COWRawPath returns the path for the OCI COW raw disk.
 func (c *Config) COWRawPath(vmID string) string {
-	return filepath.Join(c.VMRunDir(vmID), "cow.raw")
+	return filepath.Join(c.VMRunDir(vmID), cowRawName)
 }
 
 // OverlayPath returns the path for the cloudimg qcow2 overlay.
 func (c *Config) OverlayPath(vmID string) string {
-	return filepath.Join(c.VMRunDir(vmID), "overlay.qcow2")
+	return filepath.Join(c.VMRunDir(vmID), overlayName)
 }
 
 // CidataPath returns the path for the cloud-init NoCloud cidata disk.
@@ -60,6 +112,16 @@ func (c *Config) CidataPath(vmID string) string {
 	return filepath.Join(c.VMRunDir(vmID), "cidata.img")
 }
 
+// DiskSnapshotPath returns the path of an OCI VM's raw COW save point.
+func (c *Config) DiskSnapshotPath(vmID, name string) string {
+	return diskSnapshotPath(c.VMRunDir(vmID), name)
+}
+
+// diskSnapshotPath returns the path of a raw COW save point in diskDir.
+func diskSnapshotPath(diskDir, name string) string {
+	return filepath.Join(diskDir, "disk-snapshots", name+".raw")
+}
+
 // SocketWaitTimeout returns the configured socket wait timeout or the default.
 func (c *Config) SocketWaitTimeout() time.Duration {
 	if c.SocketWaitTimeoutSeconds > 0 {
@@ -76,5 +138,31 @@ func (c *Config) TerminateGracePeriod() time.Duration {
 	return defaultTerminateGracePeriod
 }
 
+// LogMaxSize returns the process log size that triggers rotation (log.maxsize, MB).
+func (c *Config) LogMaxSize() int64 {
+	mb := defaultLogMaxSizeMB
+	if c.Log != nil && c.Log.MaxSize > 0 {
+		mb = c.Log.MaxSize
+	}
+	return int64(mb) << 20 //nolint:mnd
+}
+
+// LogMaxAge returns how long rotated process logs are kept (log.max_age, days).
+func (c *Config) LogMaxAge() time.Duration {
+	days := defaultLogMaxAgeDays
+	if c.Log != nil && c.Log.MaxAge > 0 {
+		days = c.Log.MaxAge
+	}
+	return time.Duration(days) * 24 * time.Hour //nolint:mnd
+}
+
+// LogMaxBackups returns how many rotated process logs are kept per VM (log.max_backups).
+func (c *Config) LogMaxBackups() int {
+	if c.Log != nil && c.Log.MaxBackups > 0 {
+		return c.Log.MaxBackups
+	}
+	return defaultLogMaxBackups
+}
+
 func (c *Config) dir() string   { return filepath.Join(c.RootDir, "cloudhypervisor") }
 func (c *Config) dbDir() string { return filepath.Join(c.dir(), "db") }
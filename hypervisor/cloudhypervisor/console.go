@@ -1,19 +1,25 @@
 package cloudhypervisor
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"io"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
 )
 
 // Console connects to the VM's console output and returns a bidirectional stream.
 //
-// For UEFI-boot VMs (cloudimg): connects to the serial socket (console.sock).
-// For direct-boot VMs (OCI):    opens the virtio-console PTY allocated by CH.
+// By default, for UEFI-boot VMs (cloudimg): connects to the serial socket (console.sock).
+// For direct-boot VMs (OCI):                 opens the virtio-console PTY allocated by CH.
+// --serial / --console move the session to whichever device is interactive.
 //
 // The console path is resolved lazily on first access via the CH API
 // (OCI/PTY) or the deterministic socket path (UEFI), so callers like
@@ -32,12 +38,10 @@ func (ch *CloudHypervisor) Console(ctx context.Context, ref string) (io.ReadWrit
 
 	var conn io.ReadWriteCloser
 	if err := ch.withRunningVM(ctx, &rec, func(_ int) error {
-		// Resolve on demand: query CH API for PTY (OCI) or use deterministic socket (UEFI).
-		path := resolveConsole(ctx, id, socketPath(rec.RunDir),
-			consoleSockPath(rec.RunDir),
-			isDirectBoot(rec.BootConfig))
+		// Resolve on demand: query CH API for a PTY or use the deterministic serial socket.
+		path := resolveConsole(ctx, &rec)
 		if path == "" {
-			return fmt.Errorf("no console path for VM %s", id)
+			return fmt.Errorf("no interactive console for VM %s (serial and console are off or logging to files)", id)
 		}
 
 		log.WithFunc("CloudHypervisor.Console").Infof(ctx, "Resolved console path for VM %s: %s", id, path)
@@ -65,3 +69,56 @@ func (ch *CloudHypervisor) Console(ctx context.Context, ref string) (io.ReadWrit
 	}
 	return conn, nil
 }
+
+// consoleModes returns a VM's serial port and virtio console modes, filling
+// unset ones with the boot default: direct boot (OCI) kernels run
+// console=hvc0 on a virtio console PTY, UEFI (cloudimg) guests talk on the
+// serial port, exposed as a socket.
+func consoleModes(cfg *types.VMConfig, directBoot bool) (serial, console types.ConsoleMode) {
+	if directBoot {
+		return cmp.Or(cfg.Serial, types.ConsoleOff), cmp.Or(cfg.Console, types.ConsolePty)
+	}
+	return cmp.Or(cfg.Serial, types.ConsoleSocket), cmp.Or(cfg.Console, types.ConsoleOff)
+}
+
+// consoleDevices returns the CH serial and console devices of a VM. File
+// modes write to serial.log / console.log in the VM's log directory.
+func consoleDevices(cfg *types.VMConfig, directBoot bool, consoleSock, logDir string) (serial, console *chRuntimeFile) {
+	serialMode, consoleMode := consoleModes(cfg, directBoot)
+	return runtimeFile(serialMode, consoleSock, filepath.Join(logDir, serialLogName)),
+		runtimeFile(consoleMode, "", filepath.Join(logDir, consoleLogName))
+}
+
+func runtimeFile(mode types.ConsoleMode, socket, file string) *chRuntimeFile {
+	switch mode {
+	case types.ConsoleSocket:
+		return &chRuntimeFile{Mode: "Socket", Socket: socket}
+	case types.ConsoleFile:
+		return &chRuntimeFile{Mode: "File", File: file}
+	case types.ConsolePty:
+		return &chRuntimeFile{Mode: "Pty"}
+	default:
+		return &chRuntimeFile{Mode: "Off"}
+	}
+}
+
+// kernelConsoles returns the console= arguments of a direct-boot kernel:
+// every enabled device receives kernel output, and the interactive one
+// comes last so it becomes /dev/console.
+func kernelConsoles(cfg *types.VMConfig) string {
+	serial, console := consoleModes(cfg, true)
+	devs := []struct {
+		mode types.ConsoleMode
+		name string
+	}{{serial, "ttyS0"}, {console, "hvc0"}}
+	if serial.Interactive() && !console.Interactive() {
+		devs[0], devs[1] = devs[1], devs[0]
+	}
+	var args []string
+	for _, d := range devs {
+		if d.mode != types.ConsoleOff {
+			args = append(args, "console="+d.name)
+		}
+	}
+	return strings.Join(args, " ")
+}
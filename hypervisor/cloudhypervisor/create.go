@@ -1,14 +1,19 @@
 package cloudhypervisor
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
 	"github.com/projecteru2/cocoon/hypervisor"
 	"github.com/projecteru2/cocoon/metadata"
 	"github.com/projecteru2/cocoon/types"
@@ -18,6 +23,9 @@ import (
 // CowSerial is the well-known virtio serial for the COW disk attached to OCI VMs.
 const CowSerial = "cocoon-cow"
 
+// pmemAlign is the size granularity CH requires of virtio-pmem backing files.
+const pmemAlign = 2 << 20
+
 // Create registers a new VM, prepares the COW disk, and persists the record.
 // The VM is left in Created state — call Start to launch it.
 //
@@ -25,17 +33,63 @@ const CowSerial = "cocoon-cow"
 // the DB), we write a placeholder record first, then create directories and
 // prepare disks, and finally update the record to Created state.
 func (ch *CloudHypervisor) Create(ctx context.Context, id string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, bootCfg *types.BootConfig) (_ *types.VM, err error) {
+	if err = validateCPUSet(vmCfg.CPUSet); err != nil {
+		return nil, err
+	}
+	if err = validateNUMA(vmCfg.NUMA); err != nil {
+		return nil, err
+	}
+	if err = ch.validateConfidential(vmCfg); err != nil {
+		return nil, err
+	}
+	if err = validateCHBinary(vmCfg.CHBinary); err != nil {
+		return nil, err
+	}
+	if serial, console := consoleModes(vmCfg, isDirectBoot(bootCfg)); vmCfg.BootProbe != nil && !serial.Interactive() && !console.Interactive() {
+		return nil, fmt.Errorf("--boot-timeout reads the console: --serial or --console must be pty or socket")
+	}
+	if vmCfg.TPM {
+		if _, err = exec.LookPath(ch.conf.SwtpmBinary); err != nil {
+			return nil, fmt.Errorf("--tpm requires swtpm: %w", err)
+		}
+	}
+	if vmCfg.DiskBackend.VhostUser() {
+		if _, err = exec.LookPath(ch.conf.QSDBinary); err != nil {
+			return nil, fmt.Errorf("--disk-backend %s requires qemu-storage-daemon: %w", vmCfg.DiskBackend, err)
+		}
+	}
+	if vmCfg.Encrypt && !isDirectBoot(bootCfg) {
+		return nil, fmt.Errorf("--encrypt is not supported for cloud images: it encrypts the COW disk of OCI images only")
+	}
+	if vmCfg.Encrypt && bootCfg.InitrdPath == "" {
+		return nil, fmt.Errorf("--encrypt requires an OCI image booting with an initrd")
+	}
+	if vmCfg.UsesCloudInit() && isDirectBoot(bootCfg) {
+		return nil, fmt.Errorf("--user-data, --ssh-key, --run-cmd and --metadata-format require a cloud image; OCI images do not run cloud-init")
+	}
+	if vmCfg.HasGuestFiles() && isDirectBoot(bootCfg) && bootCfg.InitrdPath == "" {
+		return nil, fmt.Errorf("--copy-in and --env require an OCI image booting with an initrd")
+	}
+	if err = checkDataDir(vmCfg.DataDir); err != nil {
+		return nil, err
+	}
 	now := time.Now()
 	runDir := ch.conf.VMRunDir(id)
 	logDir := ch.conf.VMLogDir(id)
+	dataDir := ch.vmDataDir(id, vmCfg)
+	diskDir := cmp.Or(dataDir, runDir)
+	var rootPassword []byte // sealed, for the record
 
-	blobIDs := extractBlobIDs(storageConfigs, bootCfg)
+	storageConfigs, volumes := hypervisor.SplitVolumes(storageConfigs)
+	blobIDs := ExtractBlobIDs(storageConfigs, bootCfg)
 
 	// Rollback on any failure after the placeholder is written.
 	// All cleanup ops are idempotent — safe even if dirs/records don't exist yet.
 	defer func() {
 		if err != nil {
-			_ = removeVMDirs(runDir, logDir)
+			_ = removeVMDirs(runDir, logDir, dataDir)
+			ch.deleteKey(ctx, id, vmCfg.Encrypt)
+			DeleteRootPasswordKey(ctx, ch.keys, id, rootPassword)
 			ch.rollbackCreate(ctx, id, vmCfg.Name)
 		}
 	}()
@@ -46,9 +100,12 @@ func (ch *CloudHypervisor) Create(ctx context.Context, id string, vmCfg *types.V
 	}
 
 	// Step 2: create directories and prepare disks.
-	if err = utils.EnsureDirs(runDir, logDir); err != nil {
+	if err = utils.EnsureDirs(runDir, logDir, diskDir); err != nil {
 		return nil, fmt.Errorf("ensure dirs: %w", err)
 	}
+	if err = StoreGuestFiles(runDir, vmCfg); err != nil {
+		return nil, err
+	}
 
 	var bootCopy *types.BootConfig
 	if bootCfg != nil {
@@ -58,13 +115,26 @@ func (ch *CloudHypervisor) Create(ctx context.Context, id string, vmCfg *types.V
 
 	var preparedStorage []*types.StorageConfig
 	if bootCopy != nil && bootCopy.KernelPath != "" {
-		preparedStorage, err = ch.prepareOCI(ctx, id, vmCfg, storageConfigs, networkConfigs, bootCopy)
+		preparedStorage, err = ch.prepareOCI(ctx, id, diskDir, vmCfg, storageConfigs, networkConfigs, bootCopy)
 	} else {
-		preparedStorage, err = ch.prepareCloudimg(ctx, id, vmCfg, storageConfigs, networkConfigs)
+		// Before the cidata, which carries the password's hash.
+		if rootPassword, err = SetRootPassword(ctx, ch.conf.Config, ch.keys, id, vmCfg); err != nil {
+			return nil, err
+		}
+		preparedStorage, err = ch.prepareCloudimg(ctx, id, diskDir, vmCfg, storageConfigs, networkConfigs)
 	}
 	if err != nil {
 		return nil, err
 	}
+	if vmCfg.EphemeralDisk > 0 {
+		preparedStorage = attachScratch(preparedStorage, ch.conf.ScratchPath(id))
+	}
+	if vmCfg.Swap > 0 {
+		preparedStorage = attachSwap(preparedStorage, swapPath(diskDir))
+	}
+	if preparedStorage, err = hypervisor.AttachVolumes(preparedStorage, volumes, isCidataDisk); err != nil {
+		return nil, err
+	}
 
 	// Step 3: finalize the record with full data and Created state.
 	info := types.VM{
@@ -80,6 +150,7 @@ func (ch *CloudHypervisor) Create(ctx context.Context, id string, vmCfg *types.V
 		ImageBlobIDs: blobIDs,
 		RunDir:       runDir,
 		LogDir:       logDir,
+		RootPassword: rootPassword,
 	}
 	if err := ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
 		idx.VMs[id] = &rec
@@ -88,33 +159,34 @@ func (ch *CloudHypervisor) Create(ctx context.Context, id string, vmCfg *types.V
 		return nil, fmt.Errorf("finalize VM record: %w", err)
 	}
 
+	ch.recordEvent(ctx, types.EventCreated, id, vmCfg.Name, "image "+vmCfg.Image)
 	return &info, nil
 }
 
 // prepareOCI creates a raw COW disk, appends the COW StorageConfig, and builds
 // the kernel cmdline with layer/cow serial mappings.
 // Returns the updated StorageConfig slice.
-func (ch *CloudHypervisor) prepareOCI(ctx context.Context, vmID string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, boot *types.BootConfig) ([]*types.StorageConfig, error) {
-	cowPath := ch.conf.COWRawPath(vmID)
+func (ch *CloudHypervisor) prepareOCI(ctx context.Context, vmID, diskDir string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, boot *types.BootConfig) ([]*types.StorageConfig, error) {
+	cowPath := ch.cowPath(diskDir, true)
 
-	// Create sparse COW file
-	// os.Truncate requires the file to exist; create it first.
-	f, err := os.OpenFile(cowPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec
-	if err != nil {
-		return nil, fmt.Errorf("create COW: %w", err)
-	}
-	_ = f.Close()
-	if err = os.Truncate(cowPath, vmCfg.Storage); err != nil {
-		return nil, fmt.Errorf("truncate COW: %w", err)
-	}
-	// mkfs.ext4
-	out, err := exec.CommandContext(ctx, //nolint:gosec
-		"mkfs.ext4", "-F", "-m", "0", "-q",
-		"-E", "lazy_itable_init=1,lazy_journal_init=1,discard",
-		cowPath,
-	).CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("mkfs.ext4 COW: %s: %w", strings.TrimSpace(string(out)), err)
+	var err error
+	if vmCfg.Encrypt {
+		if err = createRaw(cowPath, vmCfg.Storage, vmCfg.Prealloc); err != nil {
+			return nil, err
+		}
+		if err = ch.setupEncryptedCOW(ctx, vmID, cowPath); err != nil {
+			return nil, err
+		}
+	} else {
+		if err = CreateRawCOW(ctx, cowPath, vmCfg.Storage, vmCfg.Prealloc); err != nil {
+			return nil, err
+		}
+	}
+
+	if vmCfg.PmemLayers {
+		if storageConfigs, err = pmemLayers(ctx, storageConfigs); err != nil {
+			return nil, err
+		}
 	}
 
 	// Append COW StorageConfig.
@@ -128,18 +200,27 @@ func (ch *CloudHypervisor) prepareOCI(ctx context.Context, vmID string, vmCfg *t
 	if err != nil {
 		return nil, fmt.Errorf("parse DNS servers: %w", err)
 	}
-	boot.Cmdline = buildCmdline(storageConfigs, networkConfigs, vmCfg.Name, dns)
+	boot.Cmdline = BuildCmdline(storageConfigs, networkConfigs, vmCfg, dns)
 	return storageConfigs, nil
 }
 
 // prepareCloudimg creates a qcow2 COW overlay backed by the base image blob.
 // Returns the updated StorageConfig slice (replaced with the overlay).
-func (ch *CloudHypervisor) prepareCloudimg(ctx context.Context, vmID string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig) ([]*types.StorageConfig, error) {
+func (ch *CloudHypervisor) prepareCloudimg(ctx context.Context, vmID, diskDir string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig) ([]*types.StorageConfig, error) {
 	if len(storageConfigs) == 0 {
 		return nil, fmt.Errorf("cloudimg: no base image StorageConfig")
 	}
+	// The overlay can only be opened with backing_files=on.
+	if err := ch.requireFeature(featureBackingFiles); err != nil {
+		return nil, fmt.Errorf("cloudimg: %w", err)
+	}
+	// qemu-img refuses preallocation=metadata over a backing file (short of
+	// extended L2 entries, which CH cannot read).
+	if vmCfg.Prealloc == types.PreallocMetadata {
+		return nil, fmt.Errorf("cloudimg: --prealloc %s is not supported, use %s or %s", vmCfg.Prealloc, types.PreallocFull, types.PreallocOff)
+	}
 	basePath := storageConfigs[0].Path
-	overlayPath := ch.conf.OverlayPath(vmID)
+	overlayPath := ch.cowPath(diskDir, false)
 
 	// qemu-img create -f qcow2 -F qcow2 -b <base> <overlay>
 	if out, err := exec.CommandContext(ctx, //nolint:gosec
@@ -151,13 +232,16 @@ func (ch *CloudHypervisor) prepareCloudimg(ctx context.Context, vmID string, vmC
 
 	// Expand overlay if requested size exceeds the base image's virtual size.
 	if vmCfg.Storage > 0 {
-		if err := qemuExpandImage(ctx, overlayPath, vmCfg.Storage, false); err != nil {
+		if err := ExpandImage(ctx, overlayPath, vmCfg.Storage, false); err != nil {
 			return nil, fmt.Errorf("expand overlay: %w", err)
 		}
 	}
+	if err := preallocOverlay(ctx, overlayPath, vmCfg.Prealloc); err != nil {
+		return nil, err
+	}
 
 	// Generate cloud-init cidata disk.
-	if err := ch.generateCidata(vmID, vmCfg, networkConfigs); err != nil {
+	if err := ch.generateCidata(ctx, vmID, vmCfg, networkConfigs); err != nil {
 		return nil, err
 	}
 
@@ -169,9 +253,27 @@ func (ch *CloudHypervisor) prepareCloudimg(ctx context.Context, vmID string, vmC
 	}, nil
 }
 
-// extractBlobIDs extracts digest hexes from the original image StorageConfigs
+// preallocOverlay reserves host blocks past the end of a qcow2 overlay for
+// its full virtual size under --prealloc full. qcow2 appends new clusters
+// at EOF, so the guest's writes land in the reservation instead of
+// finding the host filesystem full.
+func preallocOverlay(ctx context.Context, path string, prealloc types.Prealloc) error {
+	if prealloc != types.PreallocFull {
+		return nil
+	}
+	info, err := readQcow2Info(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := utils.Fallocate(path, info.VirtualSize, true); err != nil {
+		return fmt.Errorf("preallocate overlay: %w", err)
+	}
+	return nil
+}
+
+// ExtractBlobIDs extracts digest hexes from the original image StorageConfigs
 // and BootConfig paths. Must be called before prepare transforms them.
-func extractBlobIDs(storageConfigs []*types.StorageConfig, boot *types.BootConfig) map[string]struct{} {
+func ExtractBlobIDs(storageConfigs []*types.StorageConfig, boot *types.BootConfig) map[string]struct{} {
 	ids := make(map[string]struct{})
 	if boot != nil && boot.KernelPath != "" {
 		// OCI: erofs layer blobs + boot dir hexes.
@@ -193,41 +295,124 @@ func extractBlobIDs(storageConfigs []*types.StorageConfig, boot *types.BootConfi
 }
 
 // generateCidata creates a fresh cloud-init NoCloud cidata disk image (FAT12)
-// at the VM's canonical cidata path. Contains instance-id, hostname,
-// root password, network-config, and write_files for cloud-init initialization.
-// Used by both Create (prepareCloudimg) and Clone.
-func (ch *CloudHypervisor) generateCidata(vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig) error {
-	dns, err := ch.conf.DNSServers()
+// at the VM's canonical cidata path. Used by both Create (prepareCloudimg) and Clone.
+func (ch *CloudHypervisor) generateCidata(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig) error {
+	return GenerateCidata(ctx, ch.conf.CidataPath(vmID), ch.conf.Config, vmID, vmCfg, networkConfigs)
+}
+
+// GenerateCidata writes a cloud-init NoCloud cidata disk image (FAT12) to
+// path. Contains instance-id, hostname, root password, SSH keys,
+// network-config, and write_files for cloud-init initialization, plus the
+// VM's own user-data.
+func GenerateCidata(ctx context.Context, path string, conf *config.Config, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig) error {
+	metaCfg, err := CidataConfig(ctx, conf, vmID, vmCfg, networkConfigs)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create cidata: %w", err)
+	}
+	if err := metadata.Generate(f, metaCfg); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("generate cidata: %w", err)
+	}
+	return f.Close()
+}
+
+// CidataConfig returns the cloud-init metadata of a VM, as written to its
+// cidata disk and served by the daemon's NoCloud-Net metadata service.
+func CidataConfig(ctx context.Context, conf *config.Config, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig) (*metadata.Config, error) {
+	dns, err := conf.DNSServers()
 	if err != nil {
-		return fmt.Errorf("parse DNS servers: %w", err)
+		return nil, fmt.Errorf("parse DNS servers: %w", err)
 	}
+	sshKeys := vmCfg.SSHKeys
+	if len(sshKeys) == 0 && conf.DefaultSSHKey != "" {
+		// A host-wide default must not fail every create: the VM goes
+		// without it, like one created before the key was configured.
+		if sshKeys, err = metadata.LoadSSHKeys(conf.DefaultSSHKey); err != nil {
+			log.WithFunc("cloudhypervisor.CidataConfig").Warnf(ctx, "VM %s gets no SSH key: default_ssh_key: %v", vmID, err)
+		}
+	}
+	files, err := metadata.GuestFiles(vmCfg)
+	if err != nil {
+		return nil, err
+	}
+	timezone, locale := guestLocale(conf, vmCfg)
 	metaCfg := &metadata.Config{
 		InstanceID:   vmID,
-		Hostname:     vmCfg.Name,
-		RootPassword: ch.conf.DefaultRootPassword,
+		VMName:       vmCfg.Name,
+		Hostname:     vmCfg.GuestHostname(),
+		FQDN:         vmCfg.FQDN(),
+		Timezone:     timezone,
+		Locale:       locale,
+		RootPassword: cmp.Or(conf.DefaultRootPassword, vmCfg.RootPasswordHash),
+		SSHKeys:      sshKeys,
 		DNS:          dns,
+		Files:        files,
+		RunCmds:      vmCfg.RunCmds,
+		Format:       vmCfg.MetadataFormat,
+
+		UserData:         vmCfg.UserData,
+		ReplaceUserData:  vmCfg.ReplaceUserData,
+		TemplateUserData: vmCfg.TemplateUserData,
+	}
+	if vmCfg.Swap > 0 {
+		metaCfg.SwapDevice = "/dev/disk/by-id/virtio-" + SwapSerial
 	}
 	for _, n := range networkConfigs {
 		if n == nil || n.Mac == "" {
 			continue
 		}
-		ni := metadata.NetworkInfo{Mac: n.Mac}
-		if n.Network != nil {
+		ni := metadata.NetworkInfo{Mac: n.Mac, MTU: n.MTU}
+		if n.Network != nil && !vmCfg.DHCP {
 			ni.IP = n.Network.IP
 			ni.Prefix = n.Network.Prefix
 			ni.Gateway = n.Network.Gateway
 		}
 		metaCfg.Networks = append(metaCfg.Networks, ni)
 	}
+	return metaCfg, nil
+}
 
-	cidataPath := ch.conf.CidataPath(vmID)
-	f, err := os.OpenFile(cidataPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec
-	if err != nil {
-		return fmt.Errorf("create cidata: %w", err)
+// IMDSSeed returns the SMBIOS serial number that points cloud-init of VM
+// rec at the daemon's metadata service, so a guest finds it without any
+// setup of its own; "" when there is no service, or the VM is an OCI
+// image, uses ConfigDrive, or has no NIC the service can tell apart.
+func IMDSSeed(conf *config.Config, rec *hypervisor.VMRecord) string {
+	if conf.IMDSListen == "" || isDirectBoot(rec.BootConfig) || rec.Config.MetadataFormat == types.MetadataConfigDrive {
+		return ""
 	}
-	if err := metadata.Generate(f, metaCfg); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("generate cidata: %w", err)
+	routed := slices.ContainsFunc(rec.NetworkConfigs, func(nc *types.NetworkConfig) bool {
+		return nc != nil && nc.UserSocket == ""
+	})
+	if !routed {
+		return ""
 	}
-	return f.Close()
+	return "ds=nocloud;s=http://" + conf.IMDSListen + "/"
+}
+
+// pmemLayers returns copies of storageConfigs with the read-only EROFS
+// layers switched to virtio-pmem. Blobs are padded to pmemAlign at import;
+// a layer from before that stays on virtio-blk, since the blob is shared
+// and must not be modified here.
+func pmemLayers(ctx context.Context, storageConfigs []*types.StorageConfig) ([]*types.StorageConfig, error) {
+	out := make([]*types.StorageConfig, 0, len(storageConfigs))
+	for _, sc := range storageConfigs {
+		c := *sc
+		if c.RO {
+			info, err := os.Stat(c.Path)
+			if err != nil {
+				return nil, fmt.Errorf("stat layer %s: %w", c.Path, err)
+			}
+			if info.Size()%pmemAlign == 0 {
+				c.Pmem = true
+			} else {
+				log.WithFunc("cloudhypervisor.pmemLayers").Warnf(ctx, "layer %s is not %d-byte aligned, attaching it as virtio-blk; remove and pull the image again to use pmem", c.Path, pmemAlign)
+			}
+		}
+		out = append(out, &c)
+	}
+	return out, nil
 }
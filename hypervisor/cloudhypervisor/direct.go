@@ -17,6 +17,9 @@ import (
 // Files are handled per-type: hardlink for memory-range-*, reflink/copy for
 // the COW disk, plain copy for small metadata, and cidata is regenerated.
 func (ch *CloudHypervisor) DirectClone(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, snapshotConfig *types.SnapshotConfig, srcDir string) (_ *types.VM, err error) {
+	if err = ch.requireFeature(featureSnapshot); err != nil {
+		return nil, err
+	}
 	if vmCfg.Image == "" && snapshotConfig.Image != "" {
 		vmCfg.Image = snapshotConfig.Image
 	}
@@ -27,7 +30,7 @@ func (ch *CloudHypervisor) DirectClone(ctx context.Context, vmID string, vmCfg *
 
 	defer func() {
 		if err != nil {
-			_ = removeVMDirs(runDir, logDir)
+			_ = removeVMDirs(runDir, logDir, "")
 			ch.rollbackCreate(ctx, vmID, vmCfg.Name)
 		}
 	}()
@@ -65,7 +68,7 @@ func (ch *CloudHypervisor) DirectRestore(ctx context.Context, vmRef string, vmCf
 		return nil, fmt.Errorf("clone snapshot files: %w", cloneErr)
 	}
 
-	return ch.restoreAfterExtract(ctx, vmID, vmCfg, rec, directBoot, cowPath)
+	return ch.restoreAfterExtract(ctx, vmID, vmCfg, rec, rec.RunDir, directBoot, cowPath)
 }
 
 // cloneSnapshotFiles copies snapshot files from srcDir to dstDir using
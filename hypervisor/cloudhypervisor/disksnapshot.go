@@ -0,0 +1,145 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// SnapshotDisk saves the root disk of a created or stopped VM as name: an
+// internal qcow2 snapshot of a cloud image's overlay, or a reflink copy
+// (a sparse copy where the filesystem cannot reflink) of an OCI image's
+// raw COW.
+func (ch *CloudHypervisor) SnapshotDisk(ctx context.Context, ref, name string) (*types.VM, error) {
+	if err := types.ValidateDiskSnapshotName(name); err != nil {
+		return nil, err
+	}
+	id, rec, err := ch.loadStopped(ctx, ref, "snapshot its disk")
+	if err != nil {
+		return nil, err
+	}
+	if findDiskSnapshot(rec.DiskSnapshots, name) >= 0 {
+		return nil, fmt.Errorf("VM %s already has a disk snapshot named %q", id, name)
+	}
+
+	directBoot := isDirectBoot(rec.BootConfig)
+	cowPath := ch.cowPath(ch.diskDir(&rec), directBoot)
+	if directBoot {
+		snapPath := diskSnapshotPath(ch.diskDir(&rec), name)
+		if err = utils.EnsureDirs(filepath.Dir(snapPath)); err != nil {
+			return nil, fmt.Errorf("ensure dirs: %w", err)
+		}
+		if err = utils.ReflinkCopy(snapPath, cowPath); err != nil {
+			return nil, fmt.Errorf("copy COW: %w", err)
+		}
+	} else if err = qemuImgSnapshot(ctx, "-c", name, cowPath); err != nil {
+		return nil, err
+	}
+
+	vm, err := ch.updateStorage(ctx, id, func(r *hypervisor.VMRecord) error {
+		if findDiskSnapshot(r.DiskSnapshots, name) >= 0 {
+			return fmt.Errorf("VM %s already has a disk snapshot named %q", id, name)
+		}
+		r.DiskSnapshots = append(r.DiskSnapshots, types.DiskSnapshot{
+			Name: name, Storage: r.Config.Storage, CreatedAt: time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		if rmErr := ch.removeDiskSnapshot(context.WithoutCancel(ctx), ch.diskDir(&rec), name, directBoot); rmErr != nil {
+			log.WithFunc("cloudhypervisor.SnapshotDisk").Warnf(ctx, "remove disk snapshot %s of VM %s: %v", name, id, rmErr)
+		}
+	}
+	return vm, err
+}
+
+// RevertDisk rolls the root disk of a created or stopped VM back to disk
+// snapshot name, along with the disk size recorded with it. The snapshot
+// is kept, as are the ones taken after it.
+func (ch *CloudHypervisor) RevertDisk(ctx context.Context, ref, name string) (*types.VM, error) {
+	id, rec, err := ch.loadStopped(ctx, ref, "revert its disk")
+	if err != nil {
+		return nil, err
+	}
+	i := findDiskSnapshot(rec.DiskSnapshots, name)
+	if i < 0 {
+		return nil, fmt.Errorf("VM %s has no disk snapshot named %q", id, name)
+	}
+	snap := rec.DiskSnapshots[i]
+
+	directBoot := isDirectBoot(rec.BootConfig)
+	cowPath := ch.cowPath(ch.diskDir(&rec), directBoot)
+	if directBoot {
+		// Copy beside the COW and rename over it, so a failed copy
+		// leaves the current disk intact.
+		tmp := cowPath + ".revert"
+		if err = utils.ReflinkCopy(tmp, diskSnapshotPath(ch.diskDir(&rec), name)); err != nil {
+			os.Remove(tmp) //nolint:errcheck,gosec
+			return nil, fmt.Errorf("copy disk snapshot: %w", err)
+		}
+		if err = os.Rename(tmp, cowPath); err != nil {
+			os.Remove(tmp) //nolint:errcheck,gosec
+			return nil, fmt.Errorf("replace COW: %w", err)
+		}
+	} else if err = qemuImgSnapshot(ctx, "-a", name, cowPath); err != nil {
+		return nil, err
+	}
+
+	return ch.updateStorage(ctx, id, func(r *hypervisor.VMRecord) error {
+		r.Config.Storage = snap.Storage
+		return nil
+	})
+}
+
+// DeleteDiskSnapshot removes disk snapshot name of a created or stopped VM.
+func (ch *CloudHypervisor) DeleteDiskSnapshot(ctx context.Context, ref, name string) (*types.VM, error) {
+	id, rec, err := ch.loadStopped(ctx, ref, "delete its disk snapshots")
+	if err != nil {
+		return nil, err
+	}
+	if findDiskSnapshot(rec.DiskSnapshots, name) < 0 {
+		return nil, fmt.Errorf("VM %s has no disk snapshot named %q", id, name)
+	}
+	if err = ch.removeDiskSnapshot(ctx, ch.diskDir(&rec), name, isDirectBoot(rec.BootConfig)); err != nil {
+		return nil, err
+	}
+	return ch.updateStorage(ctx, id, func(r *hypervisor.VMRecord) error {
+		if i := findDiskSnapshot(r.DiskSnapshots, name); i >= 0 {
+			r.DiskSnapshots = slices.Delete(r.DiskSnapshots, i, i+1)
+		}
+		return nil
+	})
+}
+
+func (ch *CloudHypervisor) removeDiskSnapshot(ctx context.Context, diskDir, name string, directBoot bool) error {
+	if !directBoot {
+		return qemuImgSnapshot(ctx, "-d", name, ch.cowPath(diskDir, false))
+	}
+	if err := os.Remove(diskSnapshotPath(diskDir, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove disk snapshot: %w", err)
+	}
+	return nil
+}
+
+func findDiskSnapshot(snaps []types.DiskSnapshot, name string) int {
+	return slices.IndexFunc(snaps, func(s types.DiskSnapshot) bool { return s.Name == name })
+}
+
+// qemuImgSnapshot runs qemu-img snapshot with op (-c, -a or -d) on a qcow2 image.
+func qemuImgSnapshot(ctx context.Context, op, name, path string) error {
+	if out, err := exec.CommandContext(ctx, "qemu-img", "snapshot", op, name, path).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("qemu-img snapshot %s %s: %s: %w", op, name, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
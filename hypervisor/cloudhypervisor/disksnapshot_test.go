@@ -0,0 +1,76 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestDiskSnapshot(t *testing.T) {
+	stopped := testRecord("aaa111", "web", types.VMStateStopped)
+	stopped.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux"}
+	running := testRecord("bbb222", "db", types.VMStateRunning)
+	ch := newTestCH(t, stopped, running)
+	ctx := t.Context()
+
+	cow := ch.cowPath(ch.diskDir(stopped), true)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cow, []byte("before"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	vm, err := ch.SnapshotDisk(ctx, "web", "pre-upgrade")
+	if err != nil {
+		t.Fatalf("SnapshotDisk: %v", err)
+	}
+	if len(vm.DiskSnapshots) != 1 || vm.DiskSnapshots[0].Name != "pre-upgrade" || vm.DiskSnapshots[0].Storage != stopped.Config.Storage {
+		t.Fatalf("disk snapshots = %+v", vm.DiskSnapshots)
+	}
+	if _, err := ch.SnapshotDisk(ctx, "web", "pre-upgrade"); err == nil {
+		t.Error("expected error for duplicate name")
+	}
+	if _, err := ch.SnapshotDisk(ctx, "web", "../escape"); err == nil {
+		t.Error("expected error for invalid name")
+	}
+	if _, err := ch.SnapshotDisk(ctx, "db", "x"); err == nil {
+		t.Error("expected error snapshotting a running VM's disk")
+	}
+
+	// A later resize is rolled back with the disk.
+	if err := os.WriteFile(cow, []byte("after"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	grown := vm.Config
+	grown.Storage = 20 << 30
+	if _, err := ch.Update(ctx, "web", &grown); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	vm, err = ch.RevertDisk(ctx, "web", "pre-upgrade")
+	if err != nil {
+		t.Fatalf("RevertDisk: %v", err)
+	}
+	if data, _ := os.ReadFile(cow); string(data) != "before" {
+		t.Errorf("COW = %q after revert, want %q", data, "before")
+	}
+	if vm.Config.Storage != stopped.Config.Storage {
+		t.Errorf("storage = %d after revert, want %d", vm.Config.Storage, stopped.Config.Storage)
+	}
+	if _, err := ch.RevertDisk(ctx, "web", "missing"); err == nil {
+		t.Error("expected error reverting to a missing snapshot")
+	}
+
+	vm, err = ch.DeleteDiskSnapshot(ctx, "web", "pre-upgrade")
+	if err != nil {
+		t.Fatalf("DeleteDiskSnapshot: %v", err)
+	}
+	if len(vm.DiskSnapshots) != 0 {
+		t.Errorf("disk snapshots = %+v after delete", vm.DiskSnapshots)
+	}
+	if _, err := os.Stat(ch.conf.DiskSnapshotPath(stopped.ID, "pre-upgrade")); !os.IsNotExist(err) {
+		t.Errorf("snapshot file still exists: %v", err)
+	}
+}
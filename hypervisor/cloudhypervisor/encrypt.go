@@ -0,0 +1,52 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/keystore"
+)
+
+// setupEncryptedCOW generates a key for VM vmID, stores it and formats the
+// COW at path as a LUKS2 container. The guest puts ext4 inside on first
+// boot: the host never maps the container.
+func (ch *CloudHypervisor) setupEncryptedCOW(ctx context.Context, vmID, path string) error {
+	key, err := keystore.Generate()
+	if err != nil {
+		return err
+	}
+	if err = ch.keys.Put(ctx, vmID, key); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "cryptsetup", "luksFormat", "--batch-mode", "--type", "luks2", //nolint:gosec
+		"--key-file", "-", path)
+	cmd.Stdin = bytes.NewReader(key)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("cryptsetup luksFormat COW: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// copyKey gives VM dstID the disk key of VM srcID, for a copy of its COW.
+func (ch *CloudHypervisor) copyKey(ctx context.Context, srcID, dstID string) error {
+	key, err := ch.keys.Get(ctx, srcID)
+	if err != nil {
+		return err
+	}
+	return ch.keys.Put(ctx, dstID, key)
+}
+
+// deleteKey forgets the disk key of VM id, if it had one.
+func (ch *CloudHypervisor) deleteKey(ctx context.Context, id string, encrypted bool) {
+	if !encrypted {
+		return
+	}
+	if err := ch.keys.Delete(ctx, id); err != nil {
+		log.WithFunc("cloudhypervisor.deleteKey").Warnf(ctx, "delete key of VM %s: %v", id, err)
+	}
+}
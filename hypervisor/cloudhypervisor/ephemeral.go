@@ -0,0 +1,75 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// ScratchSerial is the virtio serial of a VM's --ephemeral-disk, so the
+// guest finds it as /dev/disk/by-id/virtio-cocoon-scratch.
+const ScratchSerial = "cocoon-scratch"
+
+// isScratchDisk reports whether sc is the VM's --ephemeral-disk.
+func isScratchDisk(sc *types.StorageConfig) bool {
+	return sc.Serial == ScratchSerial && !sc.RO && sc.Volume == ""
+}
+
+// attachScratch adds the scratch disk after a VM's prepared disks.
+func attachScratch(prepared []*types.StorageConfig, path string) []*types.StorageConfig {
+	return attachBeforeCidata(prepared, &types.StorageConfig{Path: path, RO: false, Serial: ScratchSerial})
+}
+
+// attachBeforeCidata appends sc to a VM's prepared disks, but before a
+// trailing cidata disk, which is dropped once the guest first booted and
+// must not shift sc's device name when it is.
+func attachBeforeCidata(prepared []*types.StorageConfig, sc *types.StorageConfig) []*types.StorageConfig {
+	n := len(prepared)
+	if n > 0 && isCidataDisk(prepared[n-1]) {
+		return append(prepared[:n-1:n-1], sc, prepared[n-1])
+	}
+	return append(prepared, sc)
+}
+
+// updateScratchPath points a copied VM's scratch disk at the new VM's file.
+func updateScratchPath(storageConfigs []*types.StorageConfig, path string) {
+	for _, sc := range storageConfigs {
+		if isScratchDisk(sc) {
+			sc.Path = path
+		}
+	}
+}
+
+// prepareScratch creates a blank sparse scratch disk for a VM about to
+// boot. Any file a crashed previous run left behind is discarded.
+func (ch *CloudHypervisor) prepareScratch(rec *hypervisor.VMRecord) error {
+	if rec.Config.EphemeralDisk == 0 {
+		return nil
+	}
+	if err := utils.EnsureDirs(ch.conf.VMEphemeralDir(rec.ID)); err != nil {
+		return fmt.Errorf("ensure ephemeral dir: %w", err)
+	}
+	path := ch.conf.ScratchPath(rec.ID)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create scratch disk: %w", err)
+	}
+	_ = f.Close()
+	if err := os.Truncate(path, rec.Config.EphemeralDisk); err != nil {
+		return fmt.Errorf("truncate scratch disk: %w", err)
+	}
+	return nil
+}
+
+// removeScratch frees the RAM a VM's scratch disk holds.
+func (ch *CloudHypervisor) removeScratch(ctx context.Context, vmID string) {
+	if err := os.RemoveAll(ch.conf.VMEphemeralDir(vmID)); err != nil {
+		log.WithFunc("cloudhypervisor.removeScratch").Warnf(ctx, "remove scratch disk of %s: %v", vmID, err)
+	}
+}
@@ -0,0 +1,60 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestAttachScratch(t *testing.T) {
+	overlay := &types.StorageConfig{Path: "/run/vm/overlay.qcow2"}
+	cidata := &types.StorageConfig{Path: "/run/vm/" + cidataFile, RO: true}
+	got := attachScratch([]*types.StorageConfig{overlay, cidata}, "/dev/shm/vm/scratch.raw")
+	if len(got) != 3 || got[0] != overlay || !isScratchDisk(got[1]) || got[2] != cidata {
+		t.Fatalf("cloudimg: scratch must precede cidata, got %+v", got)
+	}
+
+	cow := &types.StorageConfig{Path: "/run/vm/cow.raw", Serial: CowSerial}
+	got = attachScratch([]*types.StorageConfig{cow}, "/dev/shm/vm/scratch.raw")
+	if len(got) != 2 || got[0] != cow || !isScratchDisk(got[1]) {
+		t.Fatalf("OCI: scratch must follow the COW, got %+v", got)
+	}
+	if isBackendDisk(got[1]) {
+		t.Error("scratch disk must not be served by the disk backend")
+	}
+
+	updateScratchPath(got, "/dev/shm/clone/scratch.raw")
+	if got[0].Path != "/run/vm/cow.raw" || got[1].Path != "/dev/shm/clone/scratch.raw" {
+		t.Errorf("updateScratchPath touched the wrong disk: %+v", got)
+	}
+}
+
+func TestPrepareScratchWipes(t *testing.T) {
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{EphemeralDir: t.TempDir()}}}
+	rec := &hypervisor.VMRecord{VM: types.VM{ID: "aaa111", Config: types.VMConfig{EphemeralDisk: 1 << 20}}}
+	if err := ch.prepareScratch(rec); err != nil {
+		t.Fatal(err)
+	}
+	path := ch.conf.ScratchPath(rec.ID)
+	if err := os.WriteFile(path, []byte("leftover"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.prepareScratch(rec); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1<<20 || string(data[:8]) != "\x00\x00\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("scratch disk not blank at %d bytes", len(data))
+	}
+
+	ch.removeScratch(t.Context(), rec.ID)
+	if _, err := os.Stat(ch.conf.VMEphemeralDir(rec.ID)); !os.IsNotExist(err) {
+		t.Errorf("ephemeral dir survives removeScratch: %v", err)
+	}
+}
@@ -3,7 +3,10 @@ package cloudhypervisor
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/projecteru2/cocoon/gc"
@@ -20,6 +23,11 @@ type chSnapshot struct {
 	staleCreate []string            // IDs in stale "creating" state (crash remnants)
 	runDirs     []string            // subdirectory names under CHRunDir
 	logDirs     []string            // subdirectory names under CHLogDir
+	dataDirs    []string            // subdirectory names under every --data-dir root
+	dataPaths   []string            // absolute paths of dataDirs
+	stateDirs   []string            // subdirectory names under the state dir
+	scratchDirs []string            // subdirectory names under the ephemeral dir
+	expiredLogs []string            // absolute paths of rotated process logs past retention
 }
 
 func (s chSnapshot) UsedBlobIDs() map[string]struct{} { return s.blobIDs }
@@ -32,6 +40,7 @@ func (ch *CloudHypervisor) GCModule() gc.Module[chSnapshot] {
 		Locker: ch.locker,
 		ReadDB: func(_ context.Context) (chSnapshot, error) {
 			var snap chSnapshot
+			var logPaths, dataRoots []string
 			cutoff := time.Now().Add(-creatingStateGCGrace)
 			if err := ch.store.ReadRaw(func(idx *hypervisor.VMIndex) error {
 				snap.blobIDs = make(map[string]struct{})
@@ -47,7 +56,13 @@ func (ch *CloudHypervisor) GCModule() gc.Module[chSnapshot] {
 					if rec.State == types.VMStateCreating && rec.UpdatedAt.Before(cutoff) {
 						snap.staleCreate = append(snap.staleCreate, id)
 					}
+					if rec.LogDir != "" {
+						for _, name := range rotatedLogs {
+							logPaths = append(logPaths, filepath.Join(rec.LogDir, name))
+						}
+					}
 				}
+				dataRoots = idx.DataRoots
 				return nil
 			}); err != nil {
 				return snap, err
@@ -59,31 +74,81 @@ func (ch *CloudHypervisor) GCModule() gc.Module[chSnapshot] {
 			if snap.logDirs, err = utils.ScanSubdirs(ch.conf.LogDir()); err != nil {
 				return snap, err
 			}
+			if snap.stateDirs, err = utils.ScanSubdirs(ch.conf.StateDir()); err != nil {
+				return snap, err
+			}
+			if snap.scratchDirs, err = utils.ScanSubdirs(ch.conf.EphemeralDir()); err != nil {
+				return snap, err
+			}
+			for _, root := range dataRoots {
+				dirs, err := utils.ScanSubdirs(root)
+				if err != nil {
+					return snap, err
+				}
+				snap.dataDirs = append(snap.dataDirs, dirs...)
+				for _, d := range dirs {
+					snap.dataPaths = append(snap.dataPaths, filepath.Join(root, d))
+				}
+			}
+			now := time.Now()
+			for _, p := range logPaths {
+				expired, err := utils.ExpiredLogBackups(p, ch.conf.LogMaxAge(), ch.conf.LogMaxBackups(), now)
+				if err != nil {
+					return snap, err
+				}
+				snap.expiredLogs = append(snap.expiredLogs, expired...)
+			}
 			return snap, nil
 		},
 		Resolve: func(snap chSnapshot, _ map[string]any) []string {
 			// "db" is a reserved system subdirectory (stores vms.json/vms.lock).
 			// When RootDir == RunDir, it lives alongside per-VM dirs and must be
-			// excluded from orphan detection.
-			reserved := map[string]struct{}{"db": {}}
+			// excluded from orphan detection, as must the COW templates.
+			reserved := map[string]struct{}{"db": {}, TemplateDirName: {}}
 			runOrphans := utils.FilterUnreferenced(snap.runDirs, snap.vmIDs, reserved)
 			logOrphans := utils.FilterUnreferenced(snap.logDirs, snap.vmIDs, reserved)
-			candidates := slices.Concat(runOrphans, logOrphans, snap.staleCreate)
+			dataOrphans := utils.FilterUnreferenced(snap.dataDirs, snap.vmIDs, reserved)
+			stateOrphans := utils.FilterUnreferenced(snap.stateDirs, snap.vmIDs, reserved)
+			scratchOrphans := utils.FilterUnreferenced(snap.scratchDirs, snap.vmIDs, reserved)
+			// Expired log segments are absolute paths; VM IDs never are.
+			candidates := slices.Concat(runOrphans, logOrphans, dataOrphans, stateOrphans, scratchOrphans, snap.staleCreate, snap.expiredLogs)
 			slices.Sort(candidates)
 			return slices.Compact(candidates)
 		},
 		Collect: func(ctx context.Context, ids []string) error {
 			var errs []error
+			dataRoots, err := ch.dataRoots()
+			if err != nil {
+				return err
+			}
 			for _, id := range ids {
-				// Try loading the DB record so we use stored RunDir/LogDir;
-				// for true orphans (no record) fall back to config-derived paths.
-				runDir, logDir := ch.conf.VMRunDir(id), ch.conf.VMLogDir(id)
+				if filepath.IsAbs(id) {
+					if err := os.Remove(id); err != nil && !os.IsNotExist(err) {
+						errs = append(errs, err)
+					}
+					continue
+				}
+				// Try loading the DB record so we use stored RunDir/LogDir/DataDir;
+				// for true orphans (no record) fall back to config-derived paths
+				// and sweep every known --data-dir root.
+				runDir, logDir, dataDir := ch.conf.VMRunDir(id), ch.conf.VMLogDir(id), ""
+				orphanData := dataRoots
 				if rec, loadErr := ch.loadRecord(ctx, id); loadErr == nil {
-					runDir, logDir = rec.RunDir, rec.LogDir
+					runDir, logDir, dataDir = rec.RunDir, rec.LogDir, rec.DataDir
+					orphanData = nil
 				}
-				if err := removeVMDirs(runDir, logDir); err != nil {
+				ch.stopSidecars(ctx, runDir)
+				ch.removeScratch(ctx, id)
+				if err := removeVMDirs(runDir, logDir, dataDir, ch.conf.VMStateDir(id)); err != nil {
 					errs = append(errs, err)
+					continue
+				}
+				for _, root := range orphanData {
+					if err := os.RemoveAll(filepath.Join(root, id)); err != nil {
+						errs = append(errs, err)
+					}
 				}
+				ch.recordEvent(ctx, types.EventGCRemoved, id, "", "")
 			}
 			// Clean up stale "creating" DB records from this GC snapshot.
 			if err := ch.cleanStalePlaceholders(ctx, ids); err != nil {
@@ -91,7 +156,81 @@ func (ch *CloudHypervisor) GCModule() gc.Module[chSnapshot] {
 			}
 			return errors.Join(errs...)
 		},
+		Usage: func(snap chSnapshot, ids []string) ([]gc.Usage, error) {
+			var vmDirs []string
+			for _, d := range snap.runDirs {
+				if d != "db" {
+					vmDirs = append(vmDirs, filepath.Join(ch.conf.RunDir(), d))
+				}
+			}
+			for _, d := range snap.stateDirs {
+				vmDirs = append(vmDirs, filepath.Join(ch.conf.StateDir(), d))
+			}
+			for _, d := range snap.scratchDirs {
+				vmDirs = append(vmDirs, ch.conf.VMEphemeralDir(d))
+			}
+			return VMDirUsage(append(vmDirs, snap.dataPaths...), ch.conf.LogDir(), utils.SetOf(ids))
+		},
+	}
+}
+
+// VMDirUsage sizes the VM directories vmDirs, each named by its VM ID, and
+// the log files under logRoot for system df. Files of the VMs in collected,
+// and collected absolute paths, are reclaimable.
+func VMDirUsage(vmDirs []string, logRoot string, collected map[string]struct{}) ([]gc.Usage, error) {
+	cows := gc.Usage{Type: "COW disks"}
+	overlays := gc.Usage{Type: "overlays"}
+	others := gc.Usage{Type: "VM files"}
+	for _, dir := range vmDirs {
+		_, orphan := collected[filepath.Base(dir)]
+		if err := walkFiles(dir, func(path string, size int64) {
+			switch filepath.Base(path) {
+			case cowRawName:
+				cows.Add(size, orphan)
+			case overlayName:
+				overlays.Add(size, orphan)
+			default:
+				others.Add(size, orphan)
+			}
+		}); err != nil {
+			return nil, err
+		}
 	}
+	logs := gc.Usage{Type: "logs"}
+	if err := walkFiles(logRoot, func(path string, size int64) {
+		_, expired := collected[path]
+		rel, _ := filepath.Rel(logRoot, path)
+		_, orphan := collected[strings.SplitN(rel, string(filepath.Separator), 2)[0]] //nolint:mnd
+		logs.Add(size, expired || orphan)
+	}); err != nil {
+		return nil, err
+	}
+	return []gc.Usage{cows, overlays, others, logs}, nil
+}
+
+// walkFiles calls fn with the allocated size of every regular file under
+// root; a missing root has none.
+func walkFiles(root string, fn func(path string, size int64)) error {
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		size, err := utils.AllocatedSize(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		fn(path, size)
+		return nil
+	})
 }
 
 // RegisterGC registers the Cloud Hypervisor GC module with the given Orchestrator.
@@ -99,6 +238,16 @@ func (ch *CloudHypervisor) RegisterGC(orch *gc.Orchestrator) {
 	gc.Register(orch, ch.GCModule())
 }
 
+// dataRoots returns the --data-dir roots recorded in the DB.
+func (ch *CloudHypervisor) dataRoots() ([]string, error) {
+	var roots []string
+	err := ch.store.ReadRaw(func(idx *hypervisor.VMIndex) error {
+		roots = slices.Clone(idx.DataRoots)
+		return nil
+	})
+	return roots, err
+}
+
 // cleanStalePlaceholders removes selected DB records stuck in stale "creating"
 // state. IDs not found (or no longer stale) are skipped.
 func (ch *CloudHypervisor) cleanStalePlaceholders(_ context.Context, ids []string) error {
@@ -0,0 +1,69 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestVMDirUsage(t *testing.T) {
+	root := t.TempDir()
+	write := func(path string, size int) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	live, orphan := filepath.Join(root, "run", "live1"), filepath.Join(root, "run", "orphan1")
+	write(filepath.Join(live, cowRawName), 8192)
+	write(filepath.Join(live, cidataFile), 4096)
+	write(filepath.Join(orphan, overlayName), 8192)
+	logRoot := filepath.Join(root, "log")
+	expired := filepath.Join(logRoot, "live1", processLogName+".1")
+	write(filepath.Join(logRoot, "live1", processLogName), 4096)
+	write(expired, 4096)
+	write(filepath.Join(logRoot, "orphan1", processLogName), 4096)
+
+	usage, err := VMDirUsage([]string{live, orphan}, logRoot, map[string]struct{}{"orphan1": {}, expired: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][3]int64{}
+	for _, u := range usage {
+		got[u.Type] = [3]int64{int64(u.Count), u.Size, u.Reclaimable}
+	}
+	want := map[string][3]int64{
+		"COW disks": {1, 8192, 0},
+		"overlays":  {1, 8192, 8192},
+		"VM files":  {1, 4096, 0},
+		"logs":      {3, 12288, 8192},
+	}
+	for typ, w := range want {
+		if got[typ] != w {
+			t.Errorf("%s: got count/size/reclaimable %v, want %v", typ, got[typ], w)
+		}
+	}
+}
+
+func TestGCModule_ScratchOrphans(t *testing.T) {
+	ch := newTestCH(t, testRecord("live1", "web", types.VMStateStopped))
+	for _, id := range []string{"live1", "orphan2"} {
+		if err := os.MkdirAll(ch.conf.VMEphemeralDir(id), 0o750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := ch.GCModule()
+	snap, err := m.ReadDB(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Resolve(snap, nil); !slices.Equal(got, []string{"orphan2"}) {
+		t.Errorf("candidates = %v, want [orphan2]", got)
+	}
+}
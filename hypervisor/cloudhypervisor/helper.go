@@ -1,6 +1,7 @@
 package cloudhypervisor
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/projecteru2/core/log"
 
+	"github.com/projecteru2/cocoon/events"
 	"github.com/projecteru2/cocoon/hypervisor"
 	"github.com/projecteru2/cocoon/types"
 	"github.com/projecteru2/cocoon/utils"
@@ -24,16 +26,30 @@ const (
 	pidFileName     = "ch.pid"
 	cmdlineFileName = "cmdline"
 	consoleSockName = "console.sock"
+	processLogName  = "cloud-hypervisor.log"
+	serialLogName   = "serial.log"  // --serial file
+	consoleLogName  = "console.log" // --console file
 )
 
-var runtimeFiles = []string{apiSockName, pidFileName, cmdlineFileName, consoleSockName}
+// rotatedLogs are the log files a running VMM keeps appending to, which
+// RotateLogs copy-truncates and GC trims the segments of.
+var rotatedLogs = []string{processLogName, serialLogName, consoleLogName}
+
+var runtimeFiles = []string{apiSockName, pidFileName, cmdlineFileName, consoleSockName, BootInitrdName}
 
 // ReverseLayerSerials extracts read-only layer serial names from StorageConfigs
 // and returns them in reverse order (top layer first for overlayfs lowerdir).
+// Pmem layers are named by their pmem region ("pmem0", "pmem1", …), which
+// follows the order of the --pmem devices.
 func ReverseLayerSerials(storageConfigs []*types.StorageConfig) []string {
 	var serials []string
+	pmem := 0
 	for _, s := range storageConfigs {
-		if s.RO {
+		switch {
+		case s.Pmem:
+			serials = append(serials, fmt.Sprintf("pmem%d", pmem))
+			pmem++
+		case s.RO:
 			serials = append(serials, s.Serial)
 		}
 	}
@@ -41,6 +57,18 @@ func ReverseLayerSerials(storageConfigs []*types.StorageConfig) []string {
 	return serials
 }
 
+// blockDevices returns the StorageConfigs attached as virtio-blk disks, in
+// the order of the CH config's disks array.
+func blockDevices(storageConfigs []*types.StorageConfig) []*types.StorageConfig {
+	var disks []*types.StorageConfig
+	for _, s := range storageConfigs {
+		if !s.Pmem {
+			disks = append(disks, s)
+		}
+	}
+	return disks
+}
+
 // vmAPI sends a PUT request to a Cloud Hypervisor REST API endpoint.
 // Reuses the provided http.Client to avoid creating a new client per call.
 func vmAPI(ctx context.Context, hc *http.Client, endpoint string, body []byte, successCodes ...int) error {
@@ -67,6 +95,10 @@ func shutdownVM(ctx context.Context, hc *http.Client) error {
 	return vmAPI(ctx, hc, "vm.shutdown", nil)
 }
 
+func rebootVM(ctx context.Context, hc *http.Client) error {
+	return vmAPI(ctx, hc, "vm.reboot", nil)
+}
+
 func pauseVM(ctx context.Context, hc *http.Client) error {
 	return vmAPI(ctx, hc, "vm.pause", nil)
 }
@@ -123,22 +155,35 @@ func powerButton(ctx context.Context, hc *http.Client) error {
 	return vmAPI(ctx, hc, "vm.power-button", nil)
 }
 
-// queryConsolePTY retrieves the virtio-console PTY path from a running CH instance
-// via GET /api/v1/vm.info. Returns empty string if the console is not in Pty mode.
-func queryConsolePTY(ctx context.Context, apiSocketPath string) (string, error) {
-	hc := utils.NewSocketHTTPClient(apiSocketPath)
+// queryVMInfo fetches GET /api/v1/vm.info from a running CH instance.
+func queryVMInfo(ctx context.Context, hc *http.Client) (*chVMInfoResponse, error) {
 	body, err := utils.DoAPI(ctx, hc, http.MethodGet, "http://localhost/api/v1/vm.info", nil, http.StatusOK)
 	if err != nil {
-		return "", fmt.Errorf("query vm.info: %w", err)
+		return nil, fmt.Errorf("query vm.info: %w", err)
 	}
 	var info chVMInfoResponse
 	if err := json.Unmarshal(body, &info); err != nil {
-		return "", fmt.Errorf("decode vm.info: %w", err)
+		return nil, fmt.Errorf("decode vm.info: %w", err)
 	}
-	if info.Config.Console.File == "" {
-		return "", fmt.Errorf("console PTY not available (mode=%s)", info.Config.Console.Mode)
+	return &info, nil
+}
+
+// queryPTY retrieves the PTY path of the virtio console (or, with serial,
+// the serial port) from a running CH instance via GET /api/v1/vm.info.
+// Fails if the device is not in Pty mode.
+func queryPTY(ctx context.Context, apiSocketPath string, serial bool) (string, error) {
+	info, err := queryVMInfo(ctx, utils.NewSocketHTTPClient(apiSocketPath))
+	if err != nil {
+		return "", err
 	}
-	return info.Config.Console.File, nil
+	dev, name := info.Config.Console, "console"
+	if serial {
+		dev, name = info.Config.Serial, "serial"
+	}
+	if dev.File == "" {
+		return "", fmt.Errorf("%s PTY not available (mode=%s)", name, dev.Mode)
+	}
+	return dev.File, nil
 }
 
 // blobHexFromPath extracts the digest hex from a blob file path.
@@ -160,6 +205,11 @@ func forEachVM(ctx context.Context, ids []string, op string, fn func(context.Con
 	return result.Succeeded, result.Err()
 }
 
+// recordEvent appends a lifecycle event for a VM to the host journal.
+func (ch *CloudHypervisor) recordEvent(ctx context.Context, typ types.EventType, id, name, msg string) {
+	events.Record(ctx, ch.conf.Config, types.Event{Type: typ, ID: id, Name: name, Message: msg})
+}
+
 func toVM(rec *hypervisor.VMRecord) *types.VM {
 	info := rec.VM // value copy — detached from the DB record
 	if info.State == types.VMStateRunning {
@@ -169,6 +219,13 @@ func toVM(rec *hypervisor.VMRecord) *types.VM {
 	return &info
 }
 
+// rootDiskUsage returns the host space allocated to a VM's COW or
+// overlay; 0 when the disk is missing.
+func (ch *CloudHypervisor) rootDiskUsage(rec *hypervisor.VMRecord) int64 {
+	size, _ := utils.AllocatedSize(ch.cowPath(ch.diskDir(rec), isDirectBoot(rec.BootConfig)))
+	return size
+}
+
 // socketPath returns the API socket path under a VM's run directory.
 func socketPath(runDir string) string { return filepath.Join(runDir, apiSockName) }
 
@@ -178,19 +235,49 @@ func pidFile(runDir string) string { return filepath.Join(runDir, pidFileName) }
 // consoleSockPath returns the console socket path under a VM's run directory.
 func consoleSockPath(runDir string) string { return filepath.Join(runDir, consoleSockName) }
 
-// resolveConsole determines the console path for a VM after launch.
-// Direct-boot (OCI) VMs use a PTY allocated by CH; UEFI VMs use a Unix socket.
-func resolveConsole(ctx context.Context, vmID, sockPath, consoleSock string, directBoot bool) string {
-	if directBoot {
-		consolePath, err := utils.DoWithRetry(ctx, func() (string, error) {
-			return queryConsolePTY(ctx, sockPath)
-		})
-		if err != nil {
-			log.WithFunc("cloudhypervisor.resolveConsole").Warnf(ctx, "query console PTY for %s: %v", vmID, err)
-		}
-		return consolePath
+// resolveConsole determines the interactive console path for a VM after
+// launch: the serial socket, or a PTY allocated by CH. When both devices
+// are interactive, the boot default wins — the virtio console for direct
+// boot (OCI), the serial port for UEFI. Empty when neither is interactive.
+func resolveConsole(ctx context.Context, rec *hypervisor.VMRecord) string {
+	directBoot := isDirectBoot(rec.BootConfig)
+	serial, console := consoleModes(&rec.Config, directBoot)
+	useSerial := serial.Interactive() && (!directBoot || !console.Interactive())
+	switch {
+	case useSerial && serial == types.ConsoleSocket:
+		return consoleSockPath(rec.RunDir)
+	case useSerial:
+		return resolvePTY(ctx, rec, true)
+	case console.Interactive():
+		return resolvePTY(ctx, rec, false)
+	}
+	return ""
+}
+
+// resolvePTY queries a device's PTY, retrying while CH sets it up.
+func resolvePTY(ctx context.Context, rec *hypervisor.VMRecord, serial bool) string {
+	pty, err := utils.DoWithRetry(ctx, func() (string, error) {
+		return queryPTY(ctx, socketPath(rec.RunDir), serial)
+	})
+	if err != nil {
+		log.WithFunc("cloudhypervisor.resolvePTY").Warnf(ctx, "query PTY for %s: %v", rec.ID, err)
 	}
-	return consoleSock
+	return pty
+}
+
+// secureRuntime enforces the configured ownership and mode on a launched
+// VM's API socket and its serial socket and PTYs.
+func (ch *CloudHypervisor) secureRuntime(ctx context.Context, rec *hypervisor.VMRecord) error {
+	endpoints := []string{socketPath(rec.RunDir), consoleSockPath(rec.RunDir)}
+	serial, console := consoleModes(&rec.Config, isDirectBoot(rec.BootConfig))
+	if serial == types.ConsolePty {
+		endpoints = append(endpoints, resolvePTY(ctx, rec, true))
+	}
+	if console == types.ConsolePty {
+		endpoints = append(endpoints, resolvePTY(ctx, rec, false))
+	}
+	dirs := []string{ch.conf.Config.RunDir, ch.conf.RunDir(), rec.RunDir}
+	return hypervisor.SecureRuntime(ch.conf.Config, dirs, endpoints...)
 }
 
 func cleanupRuntimeFiles(ctx context.Context, runDir string) {
@@ -202,10 +289,46 @@ func cleanupRuntimeFiles(ctx context.Context, runDir string) {
 	}
 }
 
-// qemuExpandImage expands a disk image to targetSize if its current virtual
+// requireStopped fails unless rec is created or stopped with no CH process
+// left behind and no "disk serve" export; op names the refused operation.
+func (ch *CloudHypervisor) requireStopped(ctx context.Context, rec *hypervisor.VMRecord, op string) error {
+	switch rec.State {
+	case types.VMStateCreated, types.VMStateStopped:
+	default:
+		return fmt.Errorf("VM %s is %s, must be created or stopped to %s", rec.ID, rec.State, op)
+	}
+	if runErr := ch.withRunningVM(ctx, rec, func(_ int) error {
+		return fmt.Errorf("VM %s process is still running", rec.ID)
+	}); !errors.Is(runErr, hypervisor.ErrNotRunning) {
+		return runErr
+	}
+	if pid, ok := servingDisk(rec.RunDir); ok {
+		return fmt.Errorf("VM %s disk is served over NBD by %s %d: stop \"disk serve\" first", rec.ID, nbdBinary, pid)
+	}
+	return nil
+}
+
+// loadStopped resolves ref and loads its record, failing unless the VM is
+// stopped (see requireStopped).
+func (ch *CloudHypervisor) loadStopped(ctx context.Context, ref, op string) (string, hypervisor.VMRecord, error) {
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return "", hypervisor.VMRecord{}, err
+	}
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return "", rec, err
+	}
+	if err := ch.requireStopped(ctx, &rec, op); err != nil {
+		return "", rec, err
+	}
+	return id, rec, nil
+}
+
+// ExpandImage expands a disk image to targetSize if its current virtual
 // size is smaller. For raw/sparse files (directBoot), os.Truncate is used;
 // for qcow2 images, qemu-img resize is used. No-op if already large enough.
-func qemuExpandImage(ctx context.Context, path string, targetSize int64, directBoot bool) error {
+func ExpandImage(ctx context.Context, path string, targetSize int64, directBoot bool) error {
 	if directBoot {
 		fi, err := os.Stat(path)
 		if err != nil {
@@ -220,15 +343,9 @@ func qemuExpandImage(ctx context.Context, path string, targetSize int64, directB
 		return nil
 	}
 
-	out, err := exec.CommandContext(ctx, "qemu-img", "info", "--output=json", path).Output() //nolint:gosec
+	info, err := readQcow2Info(ctx, path)
 	if err != nil {
-		return fmt.Errorf("qemu-img info %s: %w", path, err)
-	}
-	var info struct {
-		VirtualSize int64 `json:"virtual-size"`
-	}
-	if err := json.Unmarshal(out, &info); err != nil {
-		return fmt.Errorf("parse qemu-img info %s: %w", path, err)
+		return err
 	}
 	if targetSize <= info.VirtualSize {
 		return nil
@@ -241,9 +358,113 @@ func qemuExpandImage(ctx context.Context, path string, targetSize int64, directB
 	return nil
 }
 
-func removeVMDirs(runDir, logDir string) error {
-	return errors.Join(
+// GrowRootDisk grows a VM's root COW disk to targetSize. A raw COW
+// (directBoot) holds a bare ext4 filesystem, which is grown offline along
+// with the file; the VM must not be running. A qcow2 overlay holds a
+// partitioned cloud image whose root partition the guest grows itself
+// (cloud-init growpart) on its next boot.
+func GrowRootDisk(ctx context.Context, path string, targetSize int64, directBoot bool) error {
+	if err := ExpandImage(ctx, path, targetSize, directBoot); err != nil {
+		return err
+	}
+	if !directBoot {
+		return nil
+	}
+	// resize2fs insists on a freshly checked filesystem. e2fsck exits 1 or 2
+	// when it fixed something, which is fine for an unmounted image.
+	if out, err := exec.CommandContext(ctx, "e2fsck", "-f", "-p", path).CombinedOutput(); err != nil { //nolint:gosec
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() > 2 { //nolint:mnd
+			return fmt.Errorf("e2fsck %s: %s: %w", path, strings.TrimSpace(string(out)), err)
+		}
+	}
+	if out, err := exec.CommandContext(ctx, "resize2fs", path).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("resize2fs %s: %s: %w", path, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// CompactRootDisk returns the space a stopped VM's root COW disk no longer
+// uses to the host and reports how many bytes were freed. A raw COW
+// (directBoot) has the free blocks of its ext4 filesystem punched out; a
+// qcow2 overlay is rewritten against its base, dropping the clusters the
+// guest discarded, and loses any internal snapshots.
+func CompactRootDisk(ctx context.Context, path string, directBoot bool) (int64, error) {
+	before, err := utils.AllocatedSize(path)
+	if err != nil {
+		return 0, err
+	}
+	if directBoot {
+		// e2fsck discards free blocks only on a clean filesystem; exit
+		// codes 1 and 2 report fixes, after which it skips the discard.
+		if out, err := exec.CommandContext(ctx, "e2fsck", "-f", "-p", "-E", "discard", path).CombinedOutput(); err != nil { //nolint:gosec
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() > 2 { //nolint:mnd
+				return 0, fmt.Errorf("e2fsck %s: %s: %w", path, strings.TrimSpace(string(out)), err)
+			}
+		}
+	} else if err := rewriteQcow2(ctx, path); err != nil {
+		return 0, err
+	}
+	after, err := utils.AllocatedSize(path)
+	if err != nil {
+		return 0, err
+	}
+	return max(before-after, 0), nil
+}
+
+// qcow2Info is the part of "qemu-img info" cocoon reads.
+type qcow2Info struct {
+	VirtualSize   int64  `json:"virtual-size"`
+	Backing       string `json:"full-backing-filename"`
+	BackingFormat string `json:"backing-filename-format"`
+}
+
+func readQcow2Info(ctx context.Context, path string) (*qcow2Info, error) {
+	out, err := exec.CommandContext(ctx, "qemu-img", "info", "--output=json", path).Output() //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("qemu-img info %s: %w", path, err)
+	}
+	var info qcow2Info
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, fmt.Errorf("parse qemu-img info %s: %w", path, err)
+	}
+	return &info, nil
+}
+
+// rewriteQcow2 replaces the qcow2 image at path with a copy holding only
+// the clusters that differ from its backing file, if any.
+func rewriteQcow2(ctx context.Context, path string) error {
+	info, err := readQcow2Info(ctx, path)
+	if err != nil {
+		return err
+	}
+	args := []string{"convert", "-O", "qcow2"}
+	if info.Backing != "" {
+		args = append(args, "-B", info.Backing, "-F", cmp.Or(info.BackingFormat, "qcow2"))
+	}
+	tmp := path + ".compact"
+	args = append(args, path, tmp)
+	if out, err := exec.CommandContext(ctx, "qemu-img", args...).CombinedOutput(); err != nil { //nolint:gosec
+		_ = os.Remove(tmp)
+		return fmt.Errorf("qemu-img convert %s: %s: %w", path, strings.TrimSpace(string(out)), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// removeVMDirs removes a VM's directories; an empty dataDir is skipped.
+func removeVMDirs(runDir, logDir, dataDir string, more ...string) error {
+	errs := []error{
 		os.RemoveAll(runDir),
 		os.RemoveAll(logDir),
-	)
+		os.RemoveAll(dataDir), // no-op when ""
+	}
+	for _, dir := range more {
+		errs = append(errs, os.RemoveAll(dir))
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,36 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestRootDiskUsage(t *testing.T) {
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{RunDir: t.TempDir()}}}
+	rec := &hypervisor.VMRecord{
+		VM:         types.VM{ID: "aaa111", Config: types.VMConfig{Storage: 64 << 20}},
+		BootConfig: &types.BootConfig{KernelPath: "/boot/vmlinuz"},
+	}
+	if got := ch.rootDiskUsage(rec); got != 0 {
+		t.Errorf("missing disk: usage %d, want 0", got)
+	}
+	cow := ch.cowPath(ch.diskDir(rec), true)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cow, bytes.Repeat([]byte{1}, 1<<20), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(cow, rec.Config.Storage); err != nil {
+		t.Fatal(err)
+	}
+	if got := ch.rootDiskUsage(rec); got < 1<<20 || got >= rec.Config.Storage {
+		t.Errorf("usage %d: want the 1 MiB written, not the %d virtual size", got, rec.Config.Storage)
+	}
+}
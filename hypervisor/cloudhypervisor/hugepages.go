@@ -0,0 +1,47 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// applyHugePages resolves the VM's hugepages mode against the host default
+// and the free hugepage pool, then backs guest memory (or every NUMA
+// memory zone) accordingly. "auto" quietly falls back to regular pages
+// when the pool is too small; "on" and "prefault" fail instead, before CH
+// gets to abort half-way through allocating guest memory.
+func (ch *CloudHypervisor) applyHugePages(ctx context.Context, cfg *chVMConfig, vmCfg *types.VMConfig) error {
+	mode := vmCfg.HugePages
+	if mode == "" {
+		mode = types.HugePagesMode(ch.conf.HugePages)
+	}
+	if mode == types.HugePagesOff {
+		return nil
+	}
+
+	if avail := utils.HugePagesAvailable(); avail < vmCfg.Memory {
+		if mode.Required() {
+			return fmt.Errorf("--hugepages %s: VM needs %d bytes of hugepages, host pool has %d free (see /proc/meminfo)", mode, vmCfg.Memory, avail)
+		}
+		if avail > 0 {
+			log.WithFunc("cloudhypervisor.applyHugePages").Warnf(ctx,
+				"hugepage pool has %d free bytes, VM needs %d: using regular pages", avail, vmCfg.Memory)
+		}
+		return nil
+	}
+
+	prefault := mode == types.HugePagesPrefault
+	if len(cfg.Memory.Zones) == 0 {
+		cfg.Memory.HugePages, cfg.Memory.Prefault = true, prefault
+		return nil
+	}
+	for i := range cfg.Memory.Zones {
+		cfg.Memory.Zones[i].HugePages, cfg.Memory.Zones[i].Prefault = true, prefault
+	}
+	return nil
+}
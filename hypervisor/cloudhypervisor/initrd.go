@@ -0,0 +1,181 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/metadata"
+	"github.com/projecteru2/cocoon/types"
+)
+
+const (
+	// BootInitrdName is the per-boot initramfs of an OCI VM that needs host
+	// data before its root is mounted: the image's initrd with the disk key
+	// and guest files appended. It exists while the VM runs, since
+	// cloud-hypervisor reloads it on every guest-initiated reset.
+	BootInitrdName = "initrd-boot.img"
+	// filesDirName is the directory of a VM's run dir holding the contents
+	// of its --copy-in files.
+	filesDirName = "files"
+	// guestKeyName is where the guest's initramfs finds the COW key.
+	guestKeyName = "cocoon.key"
+	// guestFilesDir is where the guest's initramfs finds the guest files,
+	// named by index, and their "manifest" of "<index> <mode> <path>"
+	// lines; mode "link" makes the file's content a symlink target.
+	guestFilesDir = "cocoon.d"
+)
+
+// cpioEntry is one member of a newc cpio archive.
+type cpioEntry struct {
+	name string
+	mode int // file type and permission bits, e.g. 0o100400
+	data []byte
+}
+
+// OCIGuestFiles returns the files the initramfs of OCI VM rec installs:
+// its guest files, then its timezone and locale, or the config's
+// defaults. Cloud images get none: cloud-init places them.
+func OCIGuestFiles(conf *config.Config, rec *hypervisor.VMRecord) ([]types.GuestFile, error) {
+	if !isDirectBoot(rec.BootConfig) {
+		return nil, nil
+	}
+	files, err := metadata.GuestFiles(&rec.Config)
+	if err != nil {
+		return nil, err
+	}
+	timezone, locale := guestLocale(conf, &rec.Config)
+	return append(files, metadata.LocaleFiles(timezone, locale)...), nil
+}
+
+// StoreGuestFiles moves the contents of vmCfg's --copy-in files into
+// runDir, leaving the config with references to them.
+func StoreGuestFiles(runDir string, vmCfg *types.VMConfig) (err error) {
+	vmCfg.Files, err = metadata.StoreGuestFiles(filepath.Join(runDir, filesDirName), vmCfg.Files)
+	return err
+}
+
+// guestLocale returns the timezone and locale of a VM, falling back to the
+// config's defaults.
+func guestLocale(conf *config.Config, vmCfg *types.VMConfig) (timezone, locale string) {
+	timezone, locale = vmCfg.Timezone, vmCfg.Locale
+	if timezone == "" {
+		timezone = conf.DefaultTimezone
+	}
+	if locale == "" {
+		locale = conf.DefaultLocale
+	}
+	return timezone, locale
+}
+
+// needsBootInitrd reports whether rec boots from a per-boot initramfs.
+// Without an initrd, files only the config's defaults add are skipped:
+// create rejects the VM's own.
+func needsBootInitrd(rec *hypervisor.VMRecord, files []types.GuestFile) bool {
+	return rec.Config.Encrypt || (len(files) > 0 && rec.BootConfig.InitrdPath != "")
+}
+
+// bootInitrd writes the per-boot initramfs of rec with files, and the disk
+// key of an encrypted VM.
+func (ch *CloudHypervisor) bootInitrd(ctx context.Context, rec *hypervisor.VMRecord, files []types.GuestFile) (string, error) {
+	var key []byte
+	if rec.Config.Encrypt {
+		if rec.BootConfig == nil || rec.BootConfig.InitrdPath == "" {
+			return "", fmt.Errorf("VM %s is encrypted but boots without an initrd", rec.ID)
+		}
+		var err error
+		if key, err = ch.keys.Get(ctx, rec.ID); err != nil {
+			return "", fmt.Errorf("fetch disk key: %w", err)
+		}
+	}
+	return BootInitrd(rec, files, key)
+}
+
+// BootInitrd writes the initramfs an OCI VM boots with into its run
+// directory: its image's initrd followed by a cpio archive, which the
+// kernel unpacks into the same rootfs. The archive holds key, when given,
+// and files (see OCIGuestFiles), which the initramfs installs into the
+// root before switching to it. Neither thus shows on the kernel cmdline,
+// which the host's process list and the guest's /proc expose.
+func BootInitrd(rec *hypervisor.VMRecord, files []types.GuestFile, key []byte) (string, error) {
+	if rec.BootConfig == nil || rec.BootConfig.InitrdPath == "" {
+		return "", fmt.Errorf("VM %s needs an initrd to receive its key or files", rec.ID)
+	}
+	var entries []cpioEntry
+	if key != nil {
+		entries = append(entries, cpioEntry{guestKeyName, 0o100400, key})
+	}
+	if len(files) > 0 {
+		var manifest bytes.Buffer
+		entries = append(entries, cpioEntry{guestFilesDir, 0o040700, nil})
+		for i, f := range files {
+			name := strconv.Itoa(i)
+			mode := fmt.Sprintf("%04o", f.Mode.Perm())
+			if f.Mode&os.ModeSymlink != 0 {
+				mode = "link"
+			}
+			fmt.Fprintf(&manifest, "%s %s %s\n", name, mode, f.Path)
+			entries = append(entries, cpioEntry{guestFilesDir + "/" + name, 0o100600, f.Content})
+		}
+		entries = append(entries, cpioEntry{guestFilesDir + "/manifest", 0o100600, manifest.Bytes()})
+	}
+
+	src, err := os.Open(rec.BootConfig.InitrdPath)
+	if err != nil {
+		return "", fmt.Errorf("open initrd: %w", err)
+	}
+	defer src.Close() //nolint:errcheck
+
+	path := filepath.Join(rec.RunDir, BootInitrdName)
+	_ = os.Remove(path)
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("create boot initrd: %w", err)
+	}
+	n, err := io.Copy(dst, src)
+	if err == nil {
+		// Each archive of a concatenated initramfs starts 4-byte aligned.
+		_, err = dst.Write(make([]byte, (4-n%4)%4))
+	}
+	if err == nil {
+		err = writeCPIO(dst, entries)
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", fmt.Errorf("write boot initrd: %w", err)
+	}
+	return path, nil
+}
+
+// writeCPIO writes a newc cpio archive of entries.
+func writeCPIO(w io.Writer, entries []cpioEntry) error {
+	entry := func(ino int, e cpioEntry) error {
+		var b bytes.Buffer
+		// magic, ino, mode, uid, gid, nlink, mtime, filesize, devmajor,
+		// devminor, rdevmajor, rdevminor, namesize, check.
+		fmt.Fprintf(&b, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+			ino, e.mode, 0, 0, 1, 0, len(e.data), 0, 0, 0, 0, len(e.name)+1, 0)
+		b.WriteString(e.name)
+		b.WriteByte(0)
+		b.Write(make([]byte, (4-b.Len()%4)%4))
+		b.Write(e.data)
+		b.Write(make([]byte, (4-len(e.data)%4)%4))
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+	for i, e := range entries {
+		if err := entry(i+1, e); err != nil {
+			return err
+		}
+	}
+	return entry(0, cpioEntry{name: "TRAILER!!!"})
+}
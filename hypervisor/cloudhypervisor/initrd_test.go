@@ -0,0 +1,184 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// readCPIO returns the members of the newc archive at the start of data.
+func readCPIO(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	if string(data[:6]) != "070701" {
+		t.Fatalf("no newc archive: %q", data[:6])
+	}
+	files := map[string][]byte{}
+	for off := 0; ; {
+		field := func(i int) int {
+			n, _ := strconv.ParseInt(string(data[off+6+8*i:off+14+8*i]), 16, 64)
+			return int(n)
+		}
+		size, nameSize := field(6), field(11)
+		name := string(data[off+110 : off+110+nameSize-1])
+		start := (off + 110 + nameSize + 3) &^ 3
+		if name == "TRAILER!!!" {
+			return files
+		}
+		files[name] = data[start : start+size]
+		off = (start + size + 3) &^ 3
+	}
+}
+
+func TestBootInitrd(t *testing.T) {
+	rec := testRecord("aaa111", "web", types.VMStateStopped)
+	rec.Config.Encrypt = true
+	ch := newTestCH(t, rec)
+	ctx := t.Context()
+	rec.RunDir = ch.conf.VMRunDir(rec.ID)
+	if err := os.MkdirAll(rec.RunDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	base := []byte("initrd")
+	rec.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux", InitrdPath: filepath.Join(t.TempDir(), "initrd.img")}
+	if err := os.WriteFile(rec.BootConfig.InitrdPath, base, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ch.bootInitrd(ctx, rec, nil); err == nil {
+		t.Fatal("expected error without a stored key")
+	}
+	key := []byte("0123456789")
+	if err := ch.keys.Put(ctx, rec.ID, key); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := ch.bootInitrd(ctx, rec, nil)
+	if err != nil {
+		t.Fatalf("bootInitrd: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("mode = %o, want 600", perm)
+	}
+	data, _ := os.ReadFile(path)
+	if !bytes.HasPrefix(data, base) {
+		t.Fatalf("boot initrd does not start with the image's initrd")
+	}
+
+	// The cpio archive starts at the next 4-byte boundary.
+	files := readCPIO(t, data[(len(base)+3)&^3:])
+	if len(files) != 1 || !bytes.Equal(files[guestKeyName], key) {
+		t.Errorf("archive = %q, want only %s = %q", files, guestKeyName, key)
+	}
+}
+
+// A guest-initiated reset (in-guest reboot, panic=N, watchdog) makes
+// cloud-hypervisor load the payload initramfs from its path again, so the
+// keyed copy must outlive the boot and only go when the VM stops.
+func TestBootInitrd_GuestReset(t *testing.T) {
+	rec := testRecord("aaa111", "web", types.VMStateStopped)
+	rec.Config.Encrypt = true
+	ch := newTestCH(t, rec)
+	ctx := t.Context()
+	rec.RunDir = ch.conf.VMRunDir(rec.ID)
+	if err := os.MkdirAll(rec.RunDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	rec.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux", InitrdPath: filepath.Join(t.TempDir(), "initrd.img")}
+	if err := os.WriteFile(rec.BootConfig.InitrdPath, []byte("initrd!!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key := []byte("0123456789")
+	if err := ch.keys.Put(ctx, rec.ID, key); err != nil {
+		t.Fatal(err)
+	}
+	path, err := ch.bootInitrd(ctx, rec, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each reset reads the payload again; every read must still unlock.
+	for range 2 {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("payload gone after boot: %v", err)
+		}
+		if got := readCPIO(t, data[8:])[guestKeyName]; !bytes.Equal(got, key) {
+			t.Fatalf("key after reset = %q, want %q", got, key)
+		}
+	}
+
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("boot initrd left after stop: %v", err)
+	}
+}
+
+func TestBootInitrd_GuestFiles(t *testing.T) {
+	rec := testRecord("bbb222", "web", types.VMStateStopped)
+	rec.RunDir = t.TempDir()
+	rec.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux", InitrdPath: filepath.Join(t.TempDir(), "initrd.img")}
+	if err := os.WriteFile(rec.BootConfig.InitrdPath, []byte("initrd!!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rec.Config.Files = []types.GuestFile{{Path: "/etc/my app.conf", Mode: 0o640, Content: []byte("x=1\n")}}
+	rec.Config.Env = []string{"FOO=bar"}
+	rec.Config.Timezone = "Europe/Berlin"
+	// The record keeps a reference; the initrd gets the stored content.
+	if err := StoreGuestFiles(rec.RunDir, &rec.Config); err != nil {
+		t.Fatal(err)
+	}
+	if f := rec.Config.Files[0]; f.Content != nil || !strings.HasPrefix(f.Source, filepath.Join(rec.RunDir, filesDirName)) {
+		t.Fatalf("stored file = %+v", f)
+	}
+	files, err := OCIGuestFiles(&config.Config{DefaultLocale: "C.UTF-8"}, rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !needsBootInitrd(rec, files) {
+		t.Fatal("an OCI VM with guest files needs a boot initrd")
+	}
+
+	path, err := BootInitrd(rec, files, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	archive := readCPIO(t, data[8:])
+	if _, ok := archive[guestKeyName]; ok {
+		t.Error("unencrypted VM got a key")
+	}
+	if got := string(archive["cocoon.d/0"]); got != "x=1\n" {
+		t.Errorf("cocoon.d/0 = %q", got)
+	}
+	if got := string(archive["cocoon.d/3"]); got != "/usr/share/zoneinfo/Europe/Berlin" {
+		t.Errorf("cocoon.d/3 = %q, want the zoneinfo symlink target", got)
+	}
+	want := "0 0640 /etc/my app.conf\n" +
+		"1 0644 /etc/systemd/system.conf.d/90-cocoon-env.conf\n" +
+		"2 0644 /etc/profile.d/90-cocoon-env.sh\n" +
+		"3 link /etc/localtime\n" +
+		"4 0644 /etc/timezone\n" +
+		"5 0644 /etc/default/locale\n" +
+		"6 0644 /etc/locale.conf\n"
+	if got := string(archive["cocoon.d/manifest"]); got != want {
+		t.Errorf("manifest = %q, want %q", got, want)
+	}
+
+	rec.BootConfig.InitrdPath = ""
+	if files, _ := OCIGuestFiles(&config.Config{DefaultTimezone: "UTC"}, &hypervisor.VMRecord{BootConfig: rec.BootConfig}); needsBootInitrd(rec, files) {
+		t.Error("config defaults alone must not need an initrd the image lacks")
+	}
+	if _, err := BootInitrd(rec, files, nil); err == nil {
+		t.Error("expected error without an initrd")
+	}
+}
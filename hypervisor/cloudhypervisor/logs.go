@@ -0,0 +1,131 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// chLogPrefix starts every line CH's logger writes:
+// "cloud-hypervisor: 3.015742ms: <vmm> INFO:vmm/src/lib.rs:123 -- ...".
+const chLogPrefix = "cloud-hypervisor: "
+
+// logNames maps each log source to its file under the VM's log dir.
+var logNames = map[types.LogSource]string{
+	"":                processLogName,
+	types.LogProcess: processLogName,
+	types.LogSerial:  serialLogName,
+	types.LogConsole: consoleLogName,
+	types.LogBoot:    hypervisor.BootLogName,
+}
+
+// LogFile returns the path of the VM's log of the given source: the
+// cloud-hypervisor process log (stdout and stderr of the last launch), the
+// serial or virtio console file, or the boot probe's console capture.
+func (ch *CloudHypervisor) LogFile(ctx context.Context, ref string, source types.LogSource) (string, error) {
+	name, ok := logNames[source]
+	if !ok {
+		return "", source.Validate()
+	}
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(rec.LogDir, name), nil
+}
+
+// FilterLogSince returns the lines of a CH process log written at or after
+// cutoff. CH stamps lines with the time elapsed since process start, not wall
+// time, so the start is anchored by assuming the last stamped line was
+// written at modTime. Unstamped lines (panics, multi-line messages) follow
+// the decision of the line before them.
+func FilterLogSince(data []byte, modTime, cutoff time.Time) []byte {
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	var last time.Duration
+	stamped := false
+	for _, line := range lines {
+		if d, ok := parseLogElapsed(string(line)); ok {
+			last, stamped = d, true
+		}
+	}
+	if !stamped {
+		if modTime.Before(cutoff) {
+			return nil
+		}
+		return data
+	}
+
+	start := modTime.Add(-last)
+	var out bytes.Buffer
+	keep := false
+	for _, line := range lines {
+		if d, ok := parseLogElapsed(string(line)); ok {
+			keep = !start.Add(d).Before(cutoff)
+		}
+		if keep {
+			out.Write(line)
+		}
+	}
+	return out.Bytes()
+}
+
+// parseLogElapsed extracts the elapsed-since-start stamp of a CH log line.
+func parseLogElapsed(line string) (time.Duration, bool) {
+	rest, ok := strings.CutPrefix(line, chLogPrefix)
+	if !ok {
+		return 0, false
+	}
+	stamp, _, ok := strings.Cut(rest, ": ")
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(stamp)
+	if err != nil {
+		return 0, false
+	}
+	return d, true
+}
+
+// RotateLogs copy-truncates the process, serial and console logs of every
+// running VM that have reached LogMaxSize. Expired segments are removed by GC.
+func (ch *CloudHypervisor) RotateLogs(ctx context.Context) error {
+	var paths []string
+	if err := ch.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		for _, rec := range idx.VMs {
+			if rec != nil && rec.State == types.VMStateRunning {
+				for _, name := range rotatedLogs {
+					paths = append(paths, filepath.Join(rec.LogDir, name))
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range paths {
+		rotated, err := utils.RotateLog(path, ch.conf.LogMaxSize(), true)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rotate %s: %w", path, err))
+			continue
+		}
+		if rotated {
+			log.WithFunc("cloudhypervisor.RotateLogs").Infof(ctx, "rotated %s", path)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,142 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	coretypes "github.com/projecteru2/core/types"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestFilterLogSince(t *testing.T) {
+	log := "cloud-hypervisor: 1.000000s: <vmm> INFO:vmm/src/lib.rs:1 -- boot\n" +
+		"cloud-hypervisor: 50.000000s: <vmm> WARN:vmm/src/lib.rs:2 -- slow\n" +
+		"  continuation of slow\n" +
+		"cloud-hypervisor: 60.000000s: <vmm> ERROR:vmm/src/lib.rs:3 -- fail\n"
+	mod := time.Unix(10_000, 0) // last line (60s) written here → start = mod-60s
+
+	tests := []struct {
+		name  string
+		data  string
+		since time.Duration
+		want  string
+	}{
+		{
+			name:  "last 15s",
+			data:  log,
+			since: 15 * time.Second,
+			want: "cloud-hypervisor: 50.000000s: <vmm> WARN:vmm/src/lib.rs:2 -- slow\n" +
+				"  continuation of slow\n" +
+				"cloud-hypervisor: 60.000000s: <vmm> ERROR:vmm/src/lib.rs:3 -- fail\n",
+		},
+		{name: "everything", data: log, since: time.Hour, want: log},
+		{name: "nothing", data: log, since: -time.Second, want: ""},
+		{name: "unstamped recent", data: "panic\n", since: time.Minute, want: "panic\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(FilterLogSince([]byte(tt.data), mod, mod.Add(-tt.since)))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	rec := testRecord("vm-1", "web", types.VMStateStopped)
+	rec.LogDir = t.TempDir()
+	ch := newTestCH(t, rec)
+	written := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		source types.LogSource
+		file   string
+		data   string
+	}{
+		{"", processLogName, "cloud-hypervisor: 1.000000s: <vmm> INFO:vmm/src/lib.rs:1 -- boot\n"},
+		{types.LogProcess, processLogName, "cloud-hypervisor: 1.000000s: <vmm> INFO:vmm/src/lib.rs:1 -- boot\n"},
+		{types.LogSerial, serialLogName, "Linux version 6.1\n"},
+		{types.LogConsole, consoleLogName, "login: \n"},
+		{types.LogBoot, hypervisor.BootLogName, "Reached target multi-user.target\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.source), func(t *testing.T) {
+			got, err := ch.LogFile(t.Context(), "web", tt.source)
+			if err != nil {
+				t.Fatalf("LogFile: %v", err)
+			}
+			if want := filepath.Join(rec.LogDir, tt.file); got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+			if err := os.WriteFile(got, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(got, written, written); err != nil {
+				t.Fatal(err)
+			}
+			// --since keeps the file written within the window and drops it
+			// when older.
+			data, err := os.ReadFile(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out := FilterLogSince(data, written, written.Add(-time.Minute)); string(out) != tt.data {
+				t.Errorf("since before the write: got %q, want %q", out, tt.data)
+			}
+			if out := FilterLogSince(data, written, time.Now().Add(-time.Minute)); len(out) != 0 {
+				t.Errorf("since after the write: got %q, want nothing", out)
+			}
+		})
+	}
+
+	if _, err := ch.LogFile(t.Context(), "web", "kernel"); err == nil {
+		t.Error("unknown source accepted")
+	}
+}
+
+func TestRotateLogs(t *testing.T) {
+	rec := testRecord("vm-1", "web", types.VMStateRunning)
+	rec.LogDir = t.TempDir()
+	ch := newTestCH(t, rec)
+	ch.conf.Log = &coretypes.ServerLogConfig{MaxSize: 1, MaxBackups: 1}
+	full := make([]byte, 1<<20)
+
+	// Rotate twice so each log has one segment past max_backups.
+	for range 2 {
+		for _, name := range rotatedLogs {
+			if err := os.WriteFile(filepath.Join(rec.LogDir, name), full, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ch.RotateLogs(t.Context()); err != nil {
+			t.Fatalf("RotateLogs: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond) // distinct segment stamps
+	}
+	for _, name := range rotatedLogs {
+		path := filepath.Join(rec.LogDir, name)
+		if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+			t.Errorf("%s not truncated in place: %v", name, err)
+		}
+		ext := filepath.Ext(name)
+		segments, _ := filepath.Glob(strings.TrimSuffix(path, ext) + "-*" + ext)
+		if len(segments) != 2 {
+			t.Errorf("%s segments = %v, want 2", name, segments)
+		}
+	}
+
+	m := ch.GCModule()
+	snap, err := m.ReadDB(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.expiredLogs) != len(rotatedLogs) {
+		t.Errorf("expired segments = %v, want the older one of each log", snap.expiredLogs)
+	}
+}
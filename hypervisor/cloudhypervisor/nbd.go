@@ -0,0 +1,186 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/lock/flock"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	nbdBinary   = "qemu-nbd"
+	nbdSockName = "nbd.sock"
+	nbdPIDName  = "nbd.pid"
+	vmLockName  = "vm.lock"
+
+	nbdPollInterval = time.Second
+)
+
+// ServeDisk exports a stopped VM's root disk with qemu-nbd until ctx is
+// done. qemu-nbd forks once it listens, so ready is only called when
+// clients can connect. The VM lock is held from the stopped check until
+// qemu-nbd has written its PID file, so a concurrent start sees it.
+func (ch *CloudHypervisor) ServeDisk(ctx context.Context, ref string, opts hypervisor.DiskServeOptions, ready func(uri string)) error {
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return err
+	}
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	runDir := rec.RunDir
+	args, uri, err := nbdListenArgs(opts, runDir)
+	if err != nil {
+		return err
+	}
+	if err = utils.EnsureDirs(runDir); err != nil {
+		return fmt.Errorf("ensure run dir: %w", err)
+	}
+	unlock, err := LockVM(ctx, runDir)
+	if err != nil {
+		return err
+	}
+	pid, err := ch.startNBD(ctx, id, args)
+	unlock()
+	if err != nil {
+		return err
+	}
+	defer ch.stopNBD(context.WithoutCancel(ctx), runDir)
+	ready(uri)
+
+	ticker := time.NewTicker(nbdPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if !utils.IsProcessAlive(pid) {
+				return fmt.Errorf("%s %d exited", nbdBinary, pid)
+			}
+		}
+	}
+}
+
+// nbdListenArgs returns the qemu-nbd arguments and URI of the export opts
+// describe for the VM with runDir. TCP exports bind to the loopback unless
+// TLS credentials are given.
+func nbdListenArgs(opts hypervisor.DiskServeOptions, runDir string) ([]string, string, error) {
+	var args []string
+	if opts.Writable {
+		args = append(args, "--discard=unmap")
+	} else {
+		args = append(args, "--read-only")
+	}
+	if opts.TLSCreds != "" {
+		if !filepath.IsAbs(opts.TLSCreds) {
+			return nil, "", fmt.Errorf("--tls-creds %q must be an absolute path", opts.TLSCreds)
+		}
+		if opts.Listen == "" {
+			return nil, "", fmt.Errorf("--tls-creds applies to TCP exports: give --listen")
+		}
+		args = append(args, "--object", "tls-creds-x509,id=tls0,endpoint=server,dir="+opts.TLSCreds, "--tls-creds", "tls0")
+	}
+	if opts.Listen == "" {
+		sock := filepath.Join(runDir, nbdSockName)
+		return append(args, "--socket", sock), "nbd+unix:///?socket=" + sock, nil
+	}
+	host, port, err := net.SplitHostPort(opts.Listen)
+	if err != nil {
+		return nil, "", fmt.Errorf("--listen %q is invalid: %w", opts.Listen, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if ip := net.ParseIP(host); opts.TLSCreds == "" && host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, "", fmt.Errorf("--listen %s is not a loopback address: serving the disk beyond this host needs --tls-creds", opts.Listen)
+	}
+	scheme := "nbd"
+	if opts.TLSCreds != "" {
+		scheme = "nbds"
+	}
+	args = append(args, "--port", port, "--bind", host)
+	return args, scheme + "://" + net.JoinHostPort(host, port), nil
+}
+
+// startNBD checks that VM id is stopped and forks a qemu-nbd exporting its
+// root disk with listenArgs. The caller holds the VM lock.
+func (ch *CloudHypervisor) startNBD(ctx context.Context, id string, listenArgs []string) (int, error) {
+	_, rec, err := ch.loadStopped(ctx, id, "serve its disk")
+	if err != nil {
+		return 0, err
+	}
+	directBoot := isDirectBoot(rec.BootConfig)
+	path := ch.cowPath(ch.diskDir(&rec), directBoot)
+	format := "qcow2"
+	if directBoot {
+		format = "raw"
+	}
+	pidPath := filepath.Join(rec.RunDir, nbdPIDName)
+	args := slices.Concat([]string{"--fork", "--persistent", "--pid-file", pidPath, "--format", format}, listenArgs, []string{path})
+	_ = os.Remove(filepath.Join(rec.RunDir, nbdSockName))
+
+	if out, runErr := exec.CommandContext(ctx, nbdBinary, args...).CombinedOutput(); runErr != nil { //nolint:gosec
+		return 0, fmt.Errorf("%s: %s: %w", nbdBinary, strings.TrimSpace(string(out)), runErr)
+	}
+	pid, err := utils.ReadPIDFile(pidPath)
+	if err != nil {
+		ch.stopNBD(context.WithoutCancel(ctx), rec.RunDir)
+		return 0, fmt.Errorf("read %s PID file: %w", nbdBinary, err)
+	}
+	return pid, nil
+}
+
+// LockVM takes the lock of the VM with runDir that start and "disk serve"
+// hold from checking that nothing else uses the VM's disk until their
+// process has written its PID file, and update holds while it changes a
+// stopped VM's disk and record.
+func LockVM(ctx context.Context, runDir string) (func(), error) {
+	l := flock.New(filepath.Join(runDir, vmLockName))
+	if err := l.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := l.Unlock(ctx); err != nil {
+			log.WithFunc("cloudhypervisor.LockVM").Warnf(ctx, "unlock %s: %v", runDir, err)
+		}
+	}, nil
+}
+
+// servingDisk returns the PID of the qemu-nbd exporting the disk of the
+// VM with runDir, if one is running.
+func servingDisk(runDir string) (int, bool) {
+	pidPath := filepath.Join(runDir, nbdPIDName)
+	pid, err := utils.ReadPIDFile(pidPath)
+	if err != nil || !utils.VerifyProcessCmdline(pid, nbdBinary, pidPath) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// stopNBD terminates a VM's qemu-nbd, if any, and removes its runtime files.
+func (ch *CloudHypervisor) stopNBD(ctx context.Context, runDir string) {
+	pidPath := filepath.Join(runDir, nbdPIDName)
+	if pid, err := utils.ReadPIDFile(pidPath); err == nil {
+		if err := utils.TerminateProcess(ctx, pid, nbdBinary, pidPath, ch.conf.TerminateGracePeriod()); err != nil {
+			log.WithFunc("cloudhypervisor.stopNBD").Warnf(ctx, "kill %s %d: %v", nbdBinary, pid, err)
+		}
+	}
+	for _, p := range []string{pidPath, filepath.Join(runDir, nbdSockName)} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("cloudhypervisor.stopNBD").Warnf(ctx, "cleanup %s: %v", p, err)
+		}
+	}
+}
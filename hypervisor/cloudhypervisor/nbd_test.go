@@ -0,0 +1,64 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+func TestServingDisk(t *testing.T) {
+	runDir := t.TempDir()
+	if _, ok := servingDisk(runDir); ok {
+		t.Fatal("serving without a PID file")
+	}
+	// A live PID that is not qemu-nbd, e.g. after PID reuse.
+	if err := utils.WritePIDFile(filepath.Join(runDir, nbdPIDName), os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+	if pid, ok := servingDisk(runDir); ok {
+		t.Errorf("stale PID file reported as serving by %d", pid)
+	}
+}
+
+func TestNBDListenArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    hypervisor.DiskServeOptions
+		args    string
+		uri     string
+		wantErr bool
+	}{
+		{name: "unix socket", opts: hypervisor.DiskServeOptions{},
+			args: "--read-only --socket /run/vm/nbd.sock", uri: "nbd+unix:///?socket=/run/vm/nbd.sock"},
+		{name: "writable", opts: hypervisor.DiskServeOptions{Writable: true},
+			args: "--discard=unmap --socket /run/vm/nbd.sock", uri: "nbd+unix:///?socket=/run/vm/nbd.sock"},
+		{name: "port only binds loopback", opts: hypervisor.DiskServeOptions{Listen: ":10809"},
+			args: "--read-only --port 10809 --bind 127.0.0.1", uri: "nbd://127.0.0.1:10809"},
+		{name: "public without TLS", opts: hypervisor.DiskServeOptions{Listen: "0.0.0.0:10809"}, wantErr: true},
+		{name: "public with TLS", opts: hypervisor.DiskServeOptions{Listen: "0.0.0.0:10809", TLSCreds: "/etc/cocoon/nbd"},
+			args: "--read-only --object tls-creds-x509,id=tls0,endpoint=server,dir=/etc/cocoon/nbd --tls-creds tls0 --port 10809 --bind 0.0.0.0",
+			uri:  "nbds://0.0.0.0:10809"},
+		{name: "TLS on a unix socket", opts: hypervisor.DiskServeOptions{TLSCreds: "/etc/cocoon/nbd"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, uri, err := nbdListenArgs(tt.opts, "/run/vm")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("args %v: want error", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(args, " "); got != tt.args || uri != tt.uri {
+				t.Errorf("got %q %s, want %q %s", got, uri, tt.args, tt.uri)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/keystore"
+	"github.com/projecteru2/cocoon/metadata"
+	"github.com/projecteru2/cocoon/storage"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// rootPasswordKeyID is the keystore entry of the key sealing the random
+// root password of VM vmID, apart from any disk key of the VM.
+func rootPasswordKeyID(vmID string) string { return vmID + "-root-password" }
+
+// SetRootPassword gives a cloudimg VM a random root password when the
+// config asks for one and has no default_root_password: the hash goes to
+// vmCfg, where the cidata picks it up, and the password is returned sealed
+// with a new key of keys, for the VM record. The password itself is never
+// stored in the clear.
+func SetRootPassword(ctx context.Context, conf *config.Config, keys keystore.Keystore, vmID string, vmCfg *types.VMConfig) ([]byte, error) {
+	if !conf.RandomRootPassword || conf.DefaultRootPassword != "" || vmCfg.ReplaceUserData {
+		return nil, nil
+	}
+	key, err := keystore.Generate()
+	if err != nil {
+		return nil, err
+	}
+	password := metadata.GeneratePassword()
+	sealed, err := keystore.Seal(key, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("seal root password: %w", err)
+	}
+	if err := keys.Put(ctx, rootPasswordKeyID(vmID), key); err != nil {
+		return nil, fmt.Errorf("store root password key: %w", err)
+	}
+	vmCfg.RootPasswordHash = metadata.HashPassword(password)
+	return sealed, nil
+}
+
+// TakeRootPassword returns the random root password of VM id and forgets
+// it, so it is shown once; hypervisor.ErrNoRootPassword when there is none.
+func TakeRootPassword(ctx context.Context, store storage.Store[hypervisor.VMIndex], keys keystore.Keystore, id string) (string, error) {
+	var sealed []byte
+	if err := store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s: %w", id, hypervisor.ErrNotFound)
+		}
+		sealed = r.RootPassword
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	if sealed == nil {
+		return "", hypervisor.ErrNoRootPassword
+	}
+	key, err := keys.Get(ctx, rootPasswordKeyID(id))
+	if err != nil {
+		return "", err
+	}
+	password, err := keystore.Open(key, sealed)
+	if err != nil {
+		return "", fmt.Errorf("root password of VM %s: %w", id, err)
+	}
+	// Whoever clears the record shows the password; a racing call fails.
+	if err := store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil || r.RootPassword == nil {
+			return hypervisor.ErrNoRootPassword
+		}
+		r.RootPassword = nil
+		return nil
+	}); err != nil {
+		return "", err
+	}
+	DeleteRootPasswordKey(ctx, keys, id, sealed)
+	return string(password), nil
+}
+
+// DeleteRootPasswordKey forgets the key sealing the root password of VM
+// id, if sealed shows it had one.
+func DeleteRootPasswordKey(ctx context.Context, keys keystore.Keystore, id string, sealed []byte) {
+	if sealed == nil {
+		return
+	}
+	if err := keys.Delete(ctx, rootPasswordKeyID(id)); err != nil {
+		log.WithFunc("cloudhypervisor.DeleteRootPasswordKey").Warnf(ctx, "delete root password key of VM %s: %v", id, err)
+	}
+}
+
+// TakeRootPassword implements hypervisor.Hypervisor.
+func (ch *CloudHypervisor) TakeRootPassword(ctx context.Context, ref string) (string, error) {
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return TakeRootPassword(ctx, ch.store, ch.keys, id)
+}
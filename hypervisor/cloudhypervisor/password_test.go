@@ -0,0 +1,74 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestSetRootPassword(t *testing.T) {
+	rec := testRecord("aaa111", "web", types.VMStateCreated)
+	ch := newTestCH(t, rec)
+	ctx := t.Context()
+	conf := &config.Config{RandomRootPassword: true}
+	vmCfg := &types.VMConfig{}
+	sealed, err := SetRootPassword(ctx, conf, ch.keys, rec.ID, vmCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) == 0 || !strings.HasPrefix(vmCfg.RootPasswordHash, "$6$") {
+		t.Fatalf("sealed %q, hash %q", sealed, vmCfg.RootPasswordHash)
+	}
+	meta, err := CidataConfig(ctx, conf, "vm", vmCfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.RootPassword != vmCfg.RootPasswordHash {
+		t.Errorf("cidata root password = %q, want the hash", meta.RootPassword)
+	}
+
+	// The record keeps only the sealed password; it is shown once.
+	if err := ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		idx.VMs[rec.ID].RootPassword = sealed
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	password, err := ch.TakeRootPassword(ctx, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(password) == 0 || bytes.Contains(sealed, []byte(password)) || strings.Contains(vmCfg.RootPasswordHash, password) {
+		t.Fatalf("password %q, sealed %q, hash %q", password, sealed, vmCfg.RootPasswordHash)
+	}
+	if _, err := ch.TakeRootPassword(ctx, "web"); !errors.Is(err, hypervisor.ErrNoRootPassword) {
+		t.Errorf("second take: err = %v, want ErrNoRootPassword", err)
+	}
+	if _, err := ch.keys.Get(ctx, rootPasswordKeyID(rec.ID)); err == nil {
+		t.Error("the sealing key outlived the password")
+	}
+
+	// A configured default password, or user-data replacing cocoon's,
+	// leaves nothing to generate.
+	for _, tt := range []struct {
+		conf  *config.Config
+		vmCfg *types.VMConfig
+	}{
+		{&config.Config{RandomRootPassword: true, DefaultRootPassword: "secret"}, &types.VMConfig{}},
+		{&config.Config{RandomRootPassword: true}, &types.VMConfig{ReplaceUserData: true}},
+		{&config.Config{}, &types.VMConfig{}},
+	} {
+		sealed, err := SetRootPassword(ctx, tt.conf, ch.keys, "bbb222", tt.vmCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sealed != nil || tt.vmCfg.RootPasswordHash != "" {
+			t.Errorf("conf %+v, vmCfg %+v: a password was generated", tt.conf, tt.vmCfg)
+		}
+	}
+}
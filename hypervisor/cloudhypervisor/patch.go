@@ -11,9 +11,11 @@ import (
 
 type patchOptions struct {
 	storageConfigs []*types.StorageConfig
-	consoleSock    string
+	serial         *chRuntimeFile
+	console        *chRuntimeFile
 	directBoot     bool
 	cpu            int
+	affinity       []chCPUAffinity
 	memory         int64
 }
 
@@ -34,13 +36,15 @@ func patchCHConfig(path string, opts *patchOptions) error {
 	}
 
 	// Disk paths: patch only "path" in each element, preserving pci_segment, id, etc.
-	if len(opts.storageConfigs) != len(chCfg.Disks) {
+	// Pmem layers are shared blobs whose paths never change.
+	disks := blockDevices(opts.storageConfigs)
+	if len(disks) != len(chCfg.Disks) {
 		return fmt.Errorf("disk count mismatch: storageConfigs=%d, CH config=%d",
-			len(opts.storageConfigs), len(chCfg.Disks))
+			len(disks), len(chCfg.Disks))
 	}
 	if diskRaw, ok := raw["disks"]; ok {
-		patched, patchErr := patchRawArray(diskRaw, len(opts.storageConfigs), func(i int, elem map[string]json.RawMessage) error {
-			return setField(elem, "path", opts.storageConfigs[i].Path)
+		patched, patchErr := patchRawArray(diskRaw, len(disks), func(i int, elem map[string]json.RawMessage) error {
+			return setField(elem, "path", disks[i].Path)
 		})
 		if patchErr != nil {
 			return fmt.Errorf("patch disks: %w", patchErr)
@@ -49,30 +53,43 @@ func patchCHConfig(path string, opts *patchOptions) error {
 	}
 
 	// Serial/console: full replace (snapshot carries stale /dev/pts/N paths).
-	if opts.directBoot {
-		_ = setField(raw, "serial", &chRuntimeFile{Mode: "Off"})
-		_ = setField(raw, "console", &chRuntimeFile{Mode: "Pty"})
-	} else {
-		_ = setField(raw, "serial", &chRuntimeFile{Mode: "Socket", Socket: opts.consoleSock})
-		_ = setField(raw, "console", &chRuntimeFile{Mode: "Off"})
-	}
-
-	// CPU: patch only "boot_vcpus", preserving topology, max_phys_bits, etc.
-	if opts.cpu > 0 {
-		if cpuRaw, ok := raw["cpus"]; ok {
-			patched, patchErr := patchRawObject(cpuRaw, func(obj map[string]json.RawMessage) error {
+	_ = setField(raw, "serial", opts.serial)
+	_ = setField(raw, "console", opts.console)
+
+	// CPU: patch only "boot_vcpus" and "affinity", preserving topology,
+	// max_phys_bits, etc. Affinity is always replaced so a clone never
+	// inherits the source VM's pins.
+	if cpuRaw, ok := raw["cpus"]; ok {
+		patched, patchErr := patchRawObject(cpuRaw, func(obj map[string]json.RawMessage) error {
+			if opts.affinity == nil {
+				delete(obj, "affinity")
+			} else if err := setField(obj, "affinity", opts.affinity); err != nil {
+				return err
+			}
+			if opts.cpu > 0 {
 				return setField(obj, "boot_vcpus", opts.cpu)
-			})
-			if patchErr != nil {
-				return fmt.Errorf("patch cpus: %w", patchErr)
 			}
-			raw["cpus"] = patched
+			return nil
+		})
+		if patchErr != nil {
+			return fmt.Errorf("patch cpus: %w", patchErr)
 		}
+		raw["cpus"] = patched
 	}
 
-	// Memory + balloon.
+	// Memory + balloon. A NUMA config sizes memory through its zones and
+	// keeps the top-level size at 0, so it cannot be resized here.
+	if opts.memory > 0 && len(chCfg.Memory.Zones) > 0 {
+		var zoned int64
+		for _, z := range chCfg.Memory.Zones {
+			zoned += z.Size
+		}
+		if opts.memory != zoned {
+			return fmt.Errorf("memory of a NUMA VM cannot change from %d to %d bytes", zoned, opts.memory)
+		}
+	}
 	if opts.memory > 0 {
-		if memRaw, ok := raw["memory"]; ok {
+		if memRaw, ok := raw["memory"]; ok && len(chCfg.Memory.Zones) == 0 {
 			patched, patchErr := patchRawObject(memRaw, func(obj map[string]json.RawMessage) error {
 				return setField(obj, "size", opts.memory)
 			})
@@ -93,6 +110,37 @@ func patchCHConfig(path string, opts *patchOptions) error {
 	return os.WriteFile(path, data, 0o600) //nolint:gosec
 }
 
+// patchPayloadInitramfs points the payload of the config.json at path to
+// initrd, or drops it when initrd is empty. A VM started from its per-boot
+// initramfs would otherwise leave a snapshot naming a file of its run dir,
+// which is gone once the VM stops.
+func patchPayloadInitramfs(path, initrd string) error {
+	raw, err := parseRawConfig(path)
+	if err != nil {
+		return err
+	}
+	payloadRaw, ok := raw["payload"]
+	if !ok {
+		return nil
+	}
+	patched, err := patchRawObject(payloadRaw, func(obj map[string]json.RawMessage) error {
+		if initrd == "" {
+			delete(obj, "initramfs")
+			return nil
+		}
+		return setField(obj, "initramfs", initrd)
+	})
+	if err != nil {
+		return fmt.Errorf("patch payload: %w", err)
+	}
+	raw["payload"] = patched
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("marshal patched config: %w", err)
+	}
+	return os.WriteFile(path, data, 0o600) //nolint:gosec
+}
+
 // patchBalloonRaw handles the balloon device in the raw config map.
 func patchBalloonRaw(raw map[string]json.RawMessage, existing *chBalloon, memory int64) error {
 	if memory < minBalloonMemory {
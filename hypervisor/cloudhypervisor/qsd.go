@@ -0,0 +1,118 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	qsdSockName = "qsd.sock"
+	qsdPIDName  = "qsd.pid"
+	qsdLogName  = "qsd.log"
+	// vhostUserBlkSerial is the serial every qemu-storage-daemon
+	// vhost-user-blk export reports; the backend, not CH, answers the
+	// guest's serial query.
+	vhostUserBlkSerial = "vhost_user_blk"
+)
+
+func qsdSockPath(runDir string) string { return filepath.Join(runDir, qsdSockName) }
+
+// cowSerial returns the serial the guest sees on the writable disk of a VM
+// created with vmCfg.
+func cowSerial(vmCfg *types.VMConfig) string {
+	if vmCfg.DiskBackend.VhostUser() {
+		return vhostUserBlkSerial
+	}
+	return CowSerial
+}
+
+// isBackendDisk reports whether sc is the disk an external backend serves:
+// the VM's own writable disk, not a volume, the cidata seed or the scratch
+// disk.
+func isBackendDisk(sc *types.StorageConfig) bool {
+	return !sc.RO && !sc.Pmem && sc.Volume == "" && !isCidataDisk(sc) && !isScratchDisk(sc) && !isSwapDisk(sc)
+}
+
+// backendDisk returns the writable disk of rec an external backend serves,
+// or nil when the VM uses CH's block layer.
+func backendDisk(rec *hypervisor.VMRecord) *types.StorageConfig {
+	if !rec.Config.DiskBackend.VhostUser() {
+		return nil
+	}
+	for _, sc := range rec.StorageConfigs {
+		if isBackendDisk(sc) {
+			return sc
+		}
+	}
+	return nil
+}
+
+// startQSD launches qemu-storage-daemon exporting the VM's writable disk
+// over vhost-user-blk and waits for the export socket. The daemon serves
+// one client: it outlives CH only on the paths stopQSD covers.
+func (ch *CloudHypervisor) startQSD(ctx context.Context, rec *hypervisor.VMRecord, disk *types.StorageConfig, queues int) error {
+	ch.stopQSD(ctx, rec.RunDir)
+
+	format := "raw"
+	if filepath.Ext(disk.Path) == ".qcow2" {
+		format = "qcow2"
+	}
+	sock := qsdSockPath(rec.RunDir)
+	cmd := exec.Command(ch.conf.QSDBinary, //nolint:gosec
+		"--blockdev", fmt.Sprintf("driver=%s,node-name=disk0,discard=unmap,file.driver=file,file.filename=%s,file.aio=threads", format, disk.Path),
+		"--export", fmt.Sprintf("type=vhost-user-blk,id=exp0,node-name=disk0,addr.type=unix,addr.path=%s,writable=on,num-queues=%d", sock, queues),
+	)
+	logFile, err := os.OpenFile(filepath.Join(rec.LogDir, qsdLogName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("open qsd log: %w", err)
+	}
+	defer logFile.Close() //nolint:errcheck
+	cmd.Stdout, cmd.Stderr = logFile, logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err = utils.StartInCgroup(cmd, rec.CgroupPath); err != nil {
+		return fmt.Errorf("exec qemu-storage-daemon: %w", err)
+	}
+	pid := cmd.Process.Pid
+	if err = utils.WritePIDFile(filepath.Join(rec.RunDir, qsdPIDName), pid); err != nil {
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("write qsd PID file: %w", err)
+	}
+	if err = waitForSocket(ctx, sock, pid, ch.conf.SocketWaitTimeout()); err != nil {
+		ch.stopQSD(ctx, rec.RunDir)
+		return fmt.Errorf("qemu-storage-daemon: %w", err)
+	}
+	return nil
+}
+
+// stopQSD terminates a VM's qemu-storage-daemon, if any, and removes its
+// runtime files. qsd flushes the disk on SIGTERM.
+func (ch *CloudHypervisor) stopQSD(ctx context.Context, runDir string) {
+	pidPath := filepath.Join(runDir, qsdPIDName)
+	sock := qsdSockPath(runDir)
+	if pid, err := utils.ReadPIDFile(pidPath); err == nil {
+		if err := utils.TerminateProcess(ctx, pid, filepath.Base(ch.conf.QSDBinary), sock, ch.conf.TerminateGracePeriod()); err != nil {
+			log.WithFunc("cloudhypervisor.stopQSD").Warnf(ctx, "kill qemu-storage-daemon %d: %v", pid, err)
+		}
+	}
+	for _, p := range []string{pidPath, sock} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("cloudhypervisor.stopQSD").Warnf(ctx, "cleanup %s: %v", p, err)
+		}
+	}
+}
+
+// stopSidecars stops every helper process a VM's CH talks to.
+func (ch *CloudHypervisor) stopSidecars(ctx context.Context, runDir string) {
+	ch.stopSwtpm(ctx, runDir)
+	ch.stopQSD(ctx, runDir)
+}
@@ -0,0 +1,60 @@
+package cloudhypervisor
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+)
+
+// resetRootDisk replaces the writable disk of a --read-only VM with a
+// pristine one when it stops and again before it boots, discarding
+// whatever the last run wrote:
+// a fresh ext4 COW for OCI images, an empty overlay on the same base for
+// cloud images. The new disk is built beside the old one and renamed
+// over it, so a failed reset leaves the VM as it was.
+func (ch *CloudHypervisor) resetRootDisk(ctx context.Context, rec *hypervisor.VMRecord) error {
+	directBoot := isDirectBoot(rec.BootConfig)
+	path := ch.cowPath(ch.diskDir(rec), directBoot)
+	tmp := path + ".fresh"
+	_ = os.Remove(tmp)
+
+	var err error
+	if directBoot {
+		err = CreateRawCOW(ctx, tmp, rec.Config.Storage, rec.Config.Prealloc)
+	} else if err = freshOverlay(ctx, path, tmp); err == nil {
+		err = preallocOverlay(ctx, tmp, rec.Config.Prealloc)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("reset root disk: %w", err)
+	}
+	return nil
+}
+
+// freshOverlay creates at dst an empty qcow2 overlay with the backing
+// file and virtual size of the overlay at src.
+func freshOverlay(ctx context.Context, src, dst string) error {
+	info, err := readQcow2Info(ctx, src)
+	if err != nil {
+		return err
+	}
+	if info.Backing == "" {
+		return fmt.Errorf("overlay %s has no backing file", src)
+	}
+	if out, err := exec.CommandContext(ctx, //nolint:gosec
+		"qemu-img", "create", "-f", "qcow2", "-F", cmp.Or(info.BackingFormat, "qcow2"),
+		"-b", info.Backing, dst, strconv.FormatInt(info.VirtualSize, 10),
+	).CombinedOutput(); err != nil {
+		return fmt.Errorf("qemu-img create overlay: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
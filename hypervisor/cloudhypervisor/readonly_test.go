@@ -0,0 +1,66 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestResetRootDisk(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 not found")
+	}
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{RunDir: t.TempDir()}}}
+	rec := &hypervisor.VMRecord{
+		VM:         types.VM{ID: "aaa111", Config: types.VMConfig{Storage: 64 << 20, ReadOnly: true}},
+		BootConfig: &types.BootConfig{KernelPath: "/boot/vmlinuz"},
+	}
+	cow := ch.cowPath(ch.diskDir(rec), true)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRawCOW(t.Context(), cow, rec.Config.Storage, rec.Config.Prealloc); err != nil {
+		t.Fatal(err)
+	}
+	marker := []byte("written by the last run")
+	f, err := os.OpenFile(cow, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt(marker, 32<<20); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if err := ch.resetRootDisk(t.Context(), rec); err != nil {
+		t.Fatalf("resetRootDisk: %v", err)
+	}
+	data, err := os.ReadFile(cow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != rec.Config.Storage || bytes.Contains(data, marker) {
+		t.Errorf("COW not reset: %d bytes, marker kept: %v", len(data), bytes.Contains(data, marker))
+	}
+	if _, err := os.Stat(cow + ".fresh"); !os.IsNotExist(err) {
+		t.Errorf("temporary disk left behind: %v", err)
+	}
+}
+
+func TestBootSkipsDisk_ReadOnly(t *testing.T) {
+	cidata := &types.StorageConfig{Path: "/run/vm/" + cidataFile, RO: true}
+	rec := &hypervisor.VMRecord{VM: types.VM{FirstBooted: true}}
+	if !bootSkipsDisk(rec)(cidata) {
+		t.Error("cidata attached after first boot")
+	}
+	rec.Config.ReadOnly = true
+	if bootSkipsDisk(rec)(cidata) {
+		t.Error("read-only VM lost its cidata after first boot")
+	}
+}
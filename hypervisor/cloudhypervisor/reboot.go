@@ -0,0 +1,61 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Reboot restarts the guest of each running VM in place via vm.reboot.
+// The CH process, PID, API socket, and console PTY are kept; only the
+// guest is reset. The VMM reloads the payload, so an encrypted VM gets its
+// keyed initrd back for the reboot. Returns the IDs that were successfully
+// rebooted.
+func (ch *CloudHypervisor) Reboot(ctx context.Context, refs []string) ([]string, error) {
+	ids, err := ch.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Reboot", ch.rebootOne)
+}
+
+func (ch *CloudHypervisor) rebootOne(ctx context.Context, id string) error {
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := ch.withRunningVM(ctx, &rec, func(_ int) error {
+		if rec.Config.Encrypt {
+			files, err := OCIGuestFiles(ch.conf.Config, &rec)
+			if err != nil {
+				return err
+			}
+			if _, err := ch.bootInitrd(ctx, &rec, files); err != nil {
+				return err
+			}
+		}
+		return rebootVM(ctx, utils.NewSocketHTTPClient(socketPath(rec.RunDir)))
+	}); err != nil {
+		return fmt.Errorf("reboot VM %s: %w", id, err)
+	}
+
+	now := time.Now()
+	if err := ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", id)
+		}
+		r.StartedAt = &now
+		r.UpdatedAt = now
+		r.Health = nil // guest is booting again: health check starts over
+		return nil
+	}); err != nil {
+		return err
+	}
+	ch.recordEvent(ctx, types.EventRebooted, id, rec.Config.Name, "")
+	return nil
+}
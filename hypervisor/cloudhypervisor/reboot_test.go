@@ -0,0 +1,28 @@
+package cloudhypervisor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestReboot_NotRunning(t *testing.T) {
+	ch := newTestCH(t, testRecord("aaa111", "web", types.VMStateStopped))
+
+	ids, err := ch.Reboot(t.Context(), []string{"web"})
+	if !errors.Is(err, hypervisor.ErrNotRunning) {
+		t.Fatalf("got %v, want ErrNotRunning", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("rebooted = %v", ids)
+	}
+	vm, err := ch.Inspect(t.Context(), "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.StartedAt != nil || vm.State != types.VMStateStopped {
+		t.Errorf("record changed: %+v", vm)
+	}
+}
@@ -0,0 +1,67 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// RepairRuntime fixes VMs that are not recorded as running but disagree with
+// the host: a live CH process (e.g. a state update lost to a crash) is
+// adopted by marking the record running, and sockets and PID files left by
+// a dead process are removed together with any leftover swtpm. VMs recorded
+// as running whose process is gone are left to Stop's fast path.
+func (ch *CloudHypervisor) RepairRuntime(ctx context.Context) (*hypervisor.RuntimeRepair, error) {
+	var recs []hypervisor.VMRecord
+	if err := ch.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		for _, rec := range idx.VMs {
+			if rec != nil && rec.State != types.VMStateCreating && rec.State != types.VMStateRunning {
+				recs = append(recs, *rec)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	logger := log.WithFunc("cloudhypervisor.RepairRuntime")
+	repair := &hypervisor.RuntimeRepair{}
+	var errs []error
+	for i := range recs {
+		rec := &recs[i]
+		runErr := ch.withRunningVM(ctx, rec, func(_ int) error {
+			return ch.updateState(ctx, rec.ID, types.VMStateRunning)
+		})
+		switch {
+		case runErr == nil:
+			logger.Infof(ctx, "VM %s has a live VMM while recorded %s, marked running", rec.ID, rec.State)
+			repair.Adopted = append(repair.Adopted, rec.ID)
+		case !errors.Is(runErr, hypervisor.ErrNotRunning):
+			errs = append(errs, fmt.Errorf("adopt running VM %s: %w", rec.ID, runErr))
+		case hasRuntimeFiles(rec.RunDir):
+			cleanupRuntimeFiles(ctx, rec.RunDir)
+			ch.stopSidecars(ctx, rec.RunDir)
+			repair.Cleaned = append(repair.Cleaned, rec.ID)
+		}
+	}
+	return repair, errors.Join(errs...)
+}
+
+// hasRuntimeFiles reports whether any socket or PID file of a previous
+// launch is still present in runDir.
+func hasRuntimeFiles(runDir string) bool {
+	for _, name := range slices.Concat(runtimeFiles, []string{swtpmPIDName, swtpmSockName, qsdPIDName, qsdSockName}) {
+		if _, err := os.Lstat(filepath.Join(runDir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasRuntimeFiles(t *testing.T) {
+	for _, name := range []string{"", pidFileName, apiSockName, swtpmPIDName, "tpm"} {
+		dir := t.TempDir()
+		if name != "" {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := name != "" && name != "tpm"
+		if got := hasRuntimeFiles(dir); got != want {
+			t.Errorf("hasRuntimeFiles with %q = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Rename changes a VM's name. The name index and the record are updated in
+// a single store transaction, so a collision leaves both untouched.
+// Running VMs may be renamed: the name is not part of the CH process state.
+func (ch *CloudHypervisor) Rename(ctx context.Context, ref, name string) error {
+	if err := types.ValidateVMName(name); err != nil {
+		return err
+	}
+	return ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		rec := idx.VMs[id]
+		if rec.Config.Name == name {
+			return nil
+		}
+		if dup, ok := idx.Names[name]; ok {
+			return fmt.Errorf("VM name %q already exists (id: %s)", name, dup)
+		}
+		if idx.Names[rec.Config.Name] == id {
+			delete(idx.Names, rec.Config.Name)
+		}
+		idx.Names[name] = id
+		rec.Config.Name = name
+		rec.UpdatedAt = time.Now()
+		return nil
+	})
+}
@@ -0,0 +1,70 @@
+package cloudhypervisor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// newTestCH returns a CloudHypervisor backed by temp dirs, seeded with recs.
+func newTestCH(t *testing.T, recs ...*hypervisor.VMRecord) *CloudHypervisor {
+	t.Helper()
+	dir := t.TempDir()
+	ch, err := New(&config.Config{RootDir: dir, RunDir: dir + "/run", LogDir: dir + "/log"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := ch.store.Update(t.Context(), func(idx *hypervisor.VMIndex) error {
+		for _, rec := range recs {
+			idx.VMs[rec.ID] = rec
+			idx.Names[rec.Config.Name] = rec.ID
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("seed store: %v", err)
+	}
+	return ch
+}
+
+func testRecord(id, name string, state types.VMState) *hypervisor.VMRecord {
+	return &hypervisor.VMRecord{VM: types.VM{
+		ID: id, State: state, CreatedAt: time.Now(),
+		Config: types.VMConfig{Name: name, CPU: 1, Memory: 1 << 30, Storage: 10 << 30},
+	}}
+}
+
+func TestRename(t *testing.T) {
+	ch := newTestCH(t,
+		testRecord("aaa111", "web", types.VMStateStopped),
+		testRecord("bbb222", "db", types.VMStateStopped),
+	)
+	ctx := t.Context()
+
+	if err := ch.Rename(ctx, "web", "frontend"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	vm, err := ch.Inspect(ctx, "frontend")
+	if err != nil || vm.ID != "aaa111" || vm.Config.Name != "frontend" {
+		t.Fatalf("inspect new name: vm=%+v err=%v", vm, err)
+	}
+	if _, err := ch.Inspect(ctx, "web"); !errors.Is(err, hypervisor.ErrNotFound) {
+		t.Errorf("old name still resolves: %v", err)
+	}
+
+	if err := ch.Rename(ctx, "frontend", "db"); err == nil {
+		t.Error("expected collision error")
+	}
+	if err := ch.Rename(ctx, "frontend", "bad name"); err == nil {
+		t.Error("expected invalid name error")
+	}
+	if err := ch.Rename(ctx, "frontend", "frontend"); err != nil {
+		t.Errorf("rename to same name: %v", err)
+	}
+	if err := ch.Rename(ctx, "missing", "x"); !errors.Is(err, hypervisor.ErrNotFound) {
+		t.Errorf("rename missing VM: %v", err)
+	}
+}
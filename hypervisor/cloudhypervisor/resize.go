@@ -0,0 +1,57 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// ResizeDisk grows the root disk of a created or stopped VM to size bytes
+// and records the new storage size. See GrowRootDisk for what the guest
+// filesystem gets; an encrypted COW cannot be opened on the host, so its
+// guest grows the filesystem on the next boot.
+func (ch *CloudHypervisor) ResizeDisk(ctx context.Context, ref string, size int64) (*types.VM, error) {
+	id, rec, err := ch.loadStopped(ctx, ref, "resize its disk")
+	if err != nil {
+		return nil, err
+	}
+	if size <= rec.Config.Storage {
+		return nil, fmt.Errorf("disk can only grow: VM %s has %d bytes, asked for %d", id, rec.Config.Storage, size)
+	}
+	directBoot := isDirectBoot(rec.BootConfig)
+	grow := GrowRootDisk
+	if rec.Config.Encrypt {
+		grow = ExpandImage
+	}
+	if err := grow(ctx, ch.cowPath(ch.diskDir(&rec), directBoot), size, directBoot); err != nil {
+		return nil, fmt.Errorf("resize COW: %w", err)
+	}
+	return ch.updateStorage(ctx, id, func(r *hypervisor.VMRecord) error {
+		r.Config.Storage = size
+		return nil
+	})
+}
+
+// CompactDisk returns the space a created or stopped VM's root disk no
+// longer uses to the host; see CompactRootDisk.
+func (ch *CloudHypervisor) CompactDisk(ctx context.Context, ref string) (int64, error) {
+	id, rec, err := ch.loadStopped(ctx, ref, "compact its disk")
+	if err != nil {
+		return 0, err
+	}
+	// Only the guest sees free space inside LUKS; it trims it through.
+	if rec.Config.Encrypt {
+		return 0, fmt.Errorf("VM %s is encrypted: its disk is compacted by the guest's TRIM", id)
+	}
+	directBoot := isDirectBoot(rec.BootConfig)
+	if !directBoot && len(rec.DiskSnapshots) > 0 {
+		return 0, fmt.Errorf("VM %s has disk snapshots, which compacting its overlay would drop: remove them first", id)
+	}
+	freed, err := CompactRootDisk(ctx, ch.cowPath(ch.diskDir(&rec), directBoot), directBoot)
+	if err != nil {
+		return 0, fmt.Errorf("compact COW: %w", err)
+	}
+	return freed, nil
+}
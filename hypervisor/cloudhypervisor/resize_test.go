@@ -0,0 +1,120 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestResizeDisk(t *testing.T) {
+	for _, bin := range []string{"mkfs.ext4", "e2fsck", "resize2fs", "dumpe2fs"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not found", bin)
+		}
+	}
+	stopped := testRecord("aaa111", "web", types.VMStateStopped)
+	stopped.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux"}
+	stopped.Config.Storage = 64 << 20
+	running := testRecord("bbb222", "db", types.VMStateRunning)
+	ch := newTestCH(t, stopped, running)
+	ctx := t.Context()
+
+	cow := ch.cowPath(ch.diskDir(stopped), true)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cow, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(cow, stopped.Config.Storage); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.CommandContext(ctx, "mkfs.ext4", "-F", "-q", cow).CombinedOutput(); err != nil {
+		t.Fatalf("mkfs.ext4: %s: %v", out, err)
+	}
+
+	vm, err := ch.ResizeDisk(ctx, "web", 128<<20)
+	if err != nil {
+		t.Fatalf("ResizeDisk: %v", err)
+	}
+	if vm.Config.Storage != 128<<20 {
+		t.Errorf("storage = %d, want %d", vm.Config.Storage, int64(128<<20))
+	}
+	out, err := exec.CommandContext(ctx, "dumpe2fs", "-h", cow).Output()
+	if err != nil {
+		t.Fatalf("dumpe2fs: %v", err)
+	}
+	blocks := regexp.MustCompile(`(?m)^Block count:\s+(\d+)`).FindSubmatch(out)
+	bsize := regexp.MustCompile(`(?m)^Block size:\s+(\d+)`).FindSubmatch(out)
+	if blocks == nil || bsize == nil {
+		t.Fatalf("unexpected dumpe2fs output: %s", out)
+	}
+	n, _ := strconv.ParseInt(string(blocks[1]), 10, 64)
+	b, _ := strconv.ParseInt(string(bsize[1]), 10, 64)
+	if n*b != 128<<20 {
+		t.Errorf("filesystem size = %d, want %d", n*b, int64(128<<20))
+	}
+
+	if _, err := ch.ResizeDisk(ctx, "web", 128<<20); err == nil {
+		t.Error("expected error when not growing")
+	}
+	if _, err := ch.ResizeDisk(ctx, "db", 20<<30); err == nil {
+		t.Error("expected error resizing a running VM")
+	}
+}
+
+func TestCompactDisk(t *testing.T) {
+	for _, bin := range []string{"mkfs.ext4", "e2fsck"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not found", bin)
+		}
+	}
+	stopped := testRecord("aaa111", "web", types.VMStateStopped)
+	stopped.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux"}
+	encrypted := testRecord("bbb222", "db", types.VMStateStopped)
+	encrypted.BootConfig = stopped.BootConfig
+	encrypted.Config.Encrypt = true
+	ch := newTestCH(t, stopped, encrypted)
+	ctx := t.Context()
+
+	cow := ch.cowPath(ch.diskDir(stopped), true)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cow, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(cow, 64<<20); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.CommandContext(ctx, "mkfs.ext4", "-F", "-q", cow).CombinedOutput(); err != nil {
+		t.Fatalf("mkfs.ext4: %s: %v", out, err)
+	}
+	// Stale data in blocks the filesystem considers free, as a deleted
+	// file leaves behind.
+	f, err := os.OpenFile(cow, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteAt(bytes.Repeat([]byte{0xAA}, 4<<20), 48<<20); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	freed, err := ch.CompactDisk(ctx, "web")
+	if err != nil {
+		t.Fatalf("CompactDisk: %v", err)
+	}
+	if freed < 4<<20 {
+		t.Errorf("freed %d bytes, want at least %d", freed, 4<<20)
+	}
+	if _, err := ch.CompactDisk(ctx, "db"); err == nil {
+		t.Error("expected error compacting an encrypted disk")
+	}
+}
@@ -34,12 +34,16 @@ func (ch *CloudHypervisor) Restore(ctx context.Context, vmRef string, vmCfg *typ
 		return nil, fmt.Errorf("extract snapshot: %w", extractErr)
 	}
 
-	return ch.restoreAfterExtract(ctx, vmID, vmCfg, rec, directBoot, cowPath)
+	return ch.restoreAfterExtract(ctx, vmID, vmCfg, rec, rec.RunDir, directBoot, cowPath)
 }
 
 // prepareRestore handles the common setup for Restore and DirectRestore:
 // resolve ref, load record, validate state, kill current CH, cleanup.
 func (ch *CloudHypervisor) prepareRestore(ctx context.Context, vmRef string) (string, *hypervisor.VMRecord, bool, string, error) {
+	// Check before the running VM is killed.
+	if err := ch.requireFeature(featureSnapshot); err != nil {
+		return "", nil, false, "", err
+	}
 	vmID, err := ch.resolveRef(ctx, vmRef)
 	if err != nil {
 		return "", nil, false, "", err
@@ -53,10 +57,21 @@ func (ch *CloudHypervisor) prepareRestore(ctx context.Context, vmRef string) (st
 	if rec.State != types.VMStateRunning {
 		return "", nil, false, "", fmt.Errorf("VM %s is %s, must be running to restore", vmID, rec.State)
 	}
+	if hypervisor.HasColdBootNIC(rec.NetworkConfigs) {
+		return "", nil, false, "", fmt.Errorf("VM %s has macvtap, SR-IOV or usermode NICs: restore is not supported", vmID)
+	}
+	if types.HasVolumes(rec.StorageConfigs) {
+		return "", nil, false, "", fmt.Errorf("VM %s has volumes attached: restore is not supported", vmID)
+	}
+	if rec.Config.EphemeralDisk > 0 {
+		return "", nil, false, "", fmt.Errorf("VM %s has an ephemeral disk: restore is not supported", vmID)
+	}
+	if rec.Config.Swap > 0 {
+		return "", nil, false, "", fmt.Errorf("VM %s has a swap disk: restore is not supported", vmID)
+	}
 
-	sockPath := socketPath(rec.RunDir)
 	killErr := ch.withRunningVM(ctx, &rec, func(pid int) error {
-		return ch.forceTerminate(ctx, utils.NewSocketHTTPClient(sockPath), vmID, sockPath, pid)
+		return ch.forceTerminate(ctx, utils.NewSocketHTTPClient(socketPath(rec.RunDir)), &rec, pid)
 	})
 	if killErr != nil && !errors.Is(killErr, hypervisor.ErrNotRunning) {
 		return "", nil, false, "", fmt.Errorf("stop running VM: %w", killErr)
@@ -64,13 +79,13 @@ func (ch *CloudHypervisor) prepareRestore(ctx context.Context, vmRef string) (st
 	cleanupRuntimeFiles(ctx, rec.RunDir)
 
 	directBoot := isDirectBoot(rec.BootConfig)
-	cowPath := ch.cowPath(vmID, directBoot)
+	cowPath := ch.cowPath(ch.diskDir(&rec), directBoot)
 	return vmID, &rec, directBoot, cowPath, nil
 }
 
 // restoreAfterExtract contains all restore logic after snapshot data is in runDir.
 // Shared by Restore (tar stream) and DirectRestore (direct file copy).
-func (ch *CloudHypervisor) restoreAfterExtract(ctx context.Context, vmID string, vmCfg *types.VMConfig, rec *hypervisor.VMRecord, directBoot bool, cowPath string) (_ *types.VM, err error) {
+func (ch *CloudHypervisor) restoreAfterExtract(ctx context.Context, vmID string, vmCfg *types.VMConfig, rec *hypervisor.VMRecord, stateDir string, directBoot bool, cowPath string) (_ *types.VM, err error) {
 	logger := log.WithFunc("cloudhypervisor.Restore")
 
 	defer func() {
@@ -79,46 +94,61 @@ func (ch *CloudHypervisor) restoreAfterExtract(ctx context.Context, vmID string,
 		}
 	}()
 
-	chConfigPath := filepath.Join(rec.RunDir, "config.json")
+	chConfigPath := filepath.Join(stateDir, "config.json")
+	serial, console := consoleDevices(vmCfg, directBoot, consoleSockPath(rec.RunDir), rec.LogDir)
 	if err = patchCHConfig(chConfigPath, &patchOptions{
 		storageConfigs: rec.StorageConfigs,
-		consoleSock:    consoleSockPath(rec.RunDir),
+		serial:         serial,
+		console:        console,
 		directBoot:     directBoot,
 		cpu:            vmCfg.CPU,
+		affinity:       cpuAffinity(vmCfg.CPUSet, vmCfg.CPU),
 		memory:         vmCfg.Memory,
 	}); err != nil {
 		return nil, fmt.Errorf("patch config: %w", err)
 	}
 
 	if vmCfg.Storage > 0 {
-		if err = qemuExpandImage(ctx, cowPath, vmCfg.Storage, directBoot); err != nil {
+		if err = ExpandImage(ctx, cowPath, vmCfg.Storage, directBoot); err != nil {
 			return nil, fmt.Errorf("resize COW: %w", err)
 		}
 	}
 
 	sockPath := socketPath(rec.RunDir)
-	args := []string{"--api-socket", sockPath}
+	withNetwork := hypervisor.NetnsPath(rec.NetworkConfigs) != ""
+	sandbox, err := ch.forVM(vmCfg).sandboxArgs(vmCfg, rec.RunDir, rec.NetworkConfigs)
+	if err != nil {
+		return nil, err
+	}
+	if rec.CgroupPath, err = ch.setupCgroup(ctx, vmID, vmCfg, rec.RunDir); err != nil {
+		return nil, fmt.Errorf("setup cgroup: %w", err)
+	}
+	args := append([]string{"--api-socket", sockPath}, sandbox...)
+	rec.Config.CHBinary = vmCfg.CHBinary
 	ch.saveCmdline(ctx, rec, args)
 
-	withNetwork := len(rec.NetworkConfigs) > 0
 	pid, launchErr := ch.launchProcess(ctx, rec, sockPath, args, withNetwork)
 	if launchErr != nil {
+		removeCgroup(ctx, rec.CgroupPath)
 		return nil, fmt.Errorf("launch CH: %w", launchErr)
 	}
 
 	defer func() {
 		if err != nil {
-			ch.abortLaunch(ctx, pid, sockPath, rec.RunDir)
+			ch.abortLaunch(ctx, pid, rec)
 		}
 	}()
 
 	hc := utils.NewSocketHTTPClient(sockPath)
-	if err = restoreVM(ctx, hc, rec.RunDir); err != nil {
+	if err = restoreVM(ctx, hc, stateDir); err != nil {
 		return nil, fmt.Errorf("vm.restore: %w", err)
 	}
 	if err = resumeVM(ctx, hc); err != nil {
 		return nil, fmt.Errorf("vm.resume: %w", err)
 	}
+	if err = ch.secureRuntime(ctx, rec); err != nil {
+		return nil, err
+	}
 
 	now := time.Now()
 	if err = ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
@@ -127,6 +157,13 @@ func (ch *CloudHypervisor) restoreAfterExtract(ctx context.Context, vmID string,
 			return fmt.Errorf("VM %s disappeared from index", vmID)
 		}
 		r.Config = *vmCfg
+		if !directBoot {
+			// The restored overlay replaced the one holding the disk
+			// snapshots.
+			r.DiskSnapshots = nil
+		}
+		r.CgroupPath = rec.CgroupPath
+		r.VMM = rec.VMM
 		r.State = types.VMStateRunning
 		r.StartedAt = &now
 		r.UpdatedAt = now
@@ -139,6 +176,9 @@ func (ch *CloudHypervisor) restoreAfterExtract(ctx context.Context, vmID string,
 
 	info := rec.VM
 	info.Config = *vmCfg
+	if !directBoot {
+		info.DiskSnapshots = nil
+	}
 	info.State = types.VMStateRunning
 	info.PID = pid
 	info.SocketPath = socketPath(rec.RunDir)
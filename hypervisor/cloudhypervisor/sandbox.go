@@ -0,0 +1,78 @@
+package cloudhypervisor
+
+import (
+	"fmt"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// tunDevice is opened by CH when it attaches a VM's tap devices.
+const tunDevice = "/dev/net/tun"
+
+// sandboxArgs returns the --seccomp and --landlock flags confining the CH
+// process of a VM. Per-VM modes override the host defaults from config.
+//
+// CH derives Landlock rules for disks, kernel, firmware and console
+// sockets from the VM config itself; the extra rules cover what cocoon's
+// layout needs on top: the VM run dir (API socket, snapshot and restore
+// data), the tun device for tap-backed NICs and the passt socket of
+// usermode NICs.
+func (ch *CloudHypervisor) sandboxArgs(vmCfg *types.VMConfig, runDir string, ncs []*types.NetworkConfig) ([]string, error) {
+	seccomp := vmCfg.Seccomp
+	if seccomp == "" {
+		seccomp = types.SeccompMode(ch.conf.CHSeccomp)
+	}
+	args := []string{"--seccomp", seccompArg(seccomp)}
+
+	landlock := vmCfg.Landlock
+	if landlock == "" {
+		landlock = types.LandlockMode(ch.conf.CHLandlock)
+	}
+	switch landlock {
+	case types.LandlockOff:
+		return args, nil
+	case types.LandlockOn:
+		if err := ch.requireFeature(featureLandlock); err != nil {
+			return nil, err
+		}
+		if !utils.DetectLandlock() {
+			return nil, fmt.Errorf("landlock is not enabled in the host kernel (see /sys/kernel/security/lsm)")
+		}
+	default:
+		// auto: only when both sides are known to support it.
+		if ch.version == nil || !ch.supports(featureLandlock) || !utils.DetectLandlock() {
+			return args, nil
+		}
+	}
+
+	args = append(args, "--landlock", "--landlock-rules", landlockRule(runDir, "rw"))
+	tun := false
+	for _, nc := range ncs {
+		if nc.UserSocket != "" {
+			args = append(args, landlockRule(nc.UserSocket, "rw"))
+			continue
+		}
+		tun = true
+	}
+	if tun {
+		args = append(args, landlockRule(tunDevice, "rw"))
+	}
+	return args, nil
+}
+
+// seccompArg maps a SeccompMode to CH's --seccomp value.
+func seccompArg(m types.SeccompMode) string {
+	switch m {
+	case types.SeccompLog:
+		return "log"
+	case types.SeccompOff:
+		return "false"
+	default:
+		return "true"
+	}
+}
+
+func landlockRule(path, access string) string {
+	return fmt.Sprintf("path=%s,access=%s", path, access)
+}
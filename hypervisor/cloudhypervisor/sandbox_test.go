@@ -0,0 +1,58 @@
+package cloudhypervisor
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestSandboxArgs(t *testing.T) {
+	ch := &CloudHypervisor{
+		conf:    &Config{Config: &config.Config{CHSeccomp: "log", CHLandlock: "off"}},
+		version: &chVersion{38, 0},
+	}
+
+	args, err := ch.sandboxArgs(&types.VMConfig{}, "/run/vm", []*types.NetworkConfig{{Tap: "tap0"}})
+	if err != nil {
+		t.Fatalf("host defaults: %v", err)
+	}
+	if want := []string{"--seccomp", "log"}; !slices.Equal(args, want) {
+		t.Errorf("host defaults = %v, want %v", args, want)
+	}
+
+	args, err = ch.sandboxArgs(&types.VMConfig{Seccomp: types.SeccompOff}, "/run/vm", nil)
+	if err != nil {
+		t.Fatalf("per-VM override: %v", err)
+	}
+	if want := []string{"--seccomp", "false"}; !slices.Equal(args, want) {
+		t.Errorf("per-VM override = %v, want %v", args, want)
+	}
+
+	// auto silently skips landlock on a binary that predates it.
+	args, err = ch.sandboxArgs(&types.VMConfig{Landlock: types.LandlockAuto}, "/run/vm", nil)
+	if err != nil {
+		t.Fatalf("auto on v38: %v", err)
+	}
+	if slices.Contains(args, "--landlock") {
+		t.Errorf("auto on v38 = %v, want no --landlock", args)
+	}
+
+	if _, err = ch.sandboxArgs(&types.VMConfig{Landlock: types.LandlockOn}, "/run/vm", nil); err == nil {
+		t.Error("landlock=on on v38: expected error")
+	}
+}
+
+func TestSeccompArg(t *testing.T) {
+	for mode, want := range map[types.SeccompMode]string{
+		"":               "true",
+		types.SeccompOn:  "true",
+		types.SeccompLog: "log",
+		types.SeccompOff: "false",
+	} {
+		if got := seccompArg(mode); got != want {
+			t.Errorf("seccompArg(%q) = %q, want %q", mode, got, want)
+		}
+	}
+}
@@ -55,13 +55,48 @@ func (ch *CloudHypervisor) Snapshot(ctx context.Context, ref string) (*types.Sna
 	if err != nil {
 		return nil, nil, err
 	}
+	// CH cannot snapshot a vTPM, and swtpm state is not part of the archive.
+	if rec.Config.TPM {
+		return nil, nil, fmt.Errorf("VM %s has a TPM: snapshot is not supported", vmID)
+	}
+	// The memory image would hold the disk key in the clear.
+	if rec.Config.Encrypt {
+		return nil, nil, fmt.Errorf("VM %s is encrypted: snapshot is not supported", vmID)
+	}
+	// CH cannot save the state of a vhost-user-blk device.
+	if rec.Config.DiskBackend.VhostUser() {
+		return nil, nil, fmt.Errorf("VM %s uses disk backend %s: snapshot is not supported", vmID, rec.Config.DiskBackend)
+	}
+	// Encrypted guest memory cannot be saved by the host.
+	if rec.Config.Confidential != "" {
+		return nil, nil, fmt.Errorf("VM %s is a confidential (%s) guest: snapshot is not supported", vmID, rec.Config.Confidential)
+	}
+	// Volumes outlive the VM and are not part of the archive.
+	if types.HasVolumes(rec.StorageConfigs) {
+		return nil, nil, fmt.Errorf("VM %s has volumes attached: snapshot is not supported", vmID)
+	}
+	// The guest's memory refers to scratch data no snapshot could carry.
+	if rec.Config.EphemeralDisk > 0 {
+		return nil, nil, fmt.Errorf("VM %s has an ephemeral disk: snapshot is not supported", vmID)
+	}
+	// Nor does it carry the swap disk holding part of that memory.
+	if rec.Config.Swap > 0 {
+		return nil, nil, fmt.Errorf("VM %s has a swap disk: snapshot is not supported", vmID)
+	}
 
 	sockPath := socketPath(rec.RunDir)
 	hc := utils.NewSocketHTTPClient(sockPath)
 
+	// The running process may predate the installed binary, so ask it.
+	if v, pingErr := pingVMM(ctx, hc); pingErr == nil {
+		if err := checkFeature(&v, featureSnapshot); err != nil {
+			return nil, nil, fmt.Errorf("VM %s: %w", vmID, err)
+		}
+	}
+
 	// Determine COW file path and name inside the tar archive.
 	directBoot := isDirectBoot(rec.BootConfig)
-	cowPath := ch.cowPath(vmID, directBoot)
+	cowPath := ch.cowPath(ch.diskDir(&rec), directBoot)
 	cowName := "overlay.qcow2"
 	if directBoot {
 		cowName = "cow.raw"
@@ -114,6 +149,15 @@ func (ch *CloudHypervisor) Snapshot(ctx context.Context, ref string) (*types.Sna
 		return nil, nil, fmt.Errorf("snapshot VM %s: %w", vmID, err)
 	}
 
+	// The snapshot names the image's initrd, as the record does, not the
+	// per-boot copy the VM may have started from.
+	if directBoot {
+		if patchErr := patchPayloadInitramfs(filepath.Join(tmpDir, "config.json"), rec.BootConfig.InitrdPath); patchErr != nil {
+			os.RemoveAll(tmpDir) //nolint:errcheck,gosec
+			return nil, nil, fmt.Errorf("patch config.json: %w", patchErr)
+		}
+	}
+
 	// For cloudimg VMs, include cidata.img (per-VM cloud-init disk).
 	// cidata is read-only and static, so it can be copied outside the pause window.
 	if !isDirectBoot(rec.BootConfig) {
@@ -7,12 +7,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"syscall"
 	"time"
 
 	"github.com/projecteru2/core/log"
-	"github.com/vishvananda/netns"
 
 	"github.com/projecteru2/cocoon/hypervisor"
 	"github.com/projecteru2/cocoon/types"
@@ -52,12 +50,35 @@ func (ch *CloudHypervisor) startOne(ctx context.Context, id string) error {
 		// VM is running but state update failed — do not re-launch.
 		return fmt.Errorf("reconcile running VM %s: %w", id, runErr)
 	}
+	// A cold boot would run the guest against a disk the saved state still
+	// expects to own.
+	if rec.State == types.VMStateSuspended {
+		return fmt.Errorf("VM %s is suspended: resume it with \"vm resume-from-disk\" or discard the saved state with \"vm stop\"", id)
+	}
 
 	// Ensure per-VM runtime and log directories exist (use persisted paths
 	// from create time — never overwrite them so cleanup stays consistent).
 	if err = utils.EnsureDirs(rec.RunDir, rec.LogDir); err != nil {
 		return fmt.Errorf("ensure dirs: %w", err)
 	}
+	// Hold the VM lock until the PID file is written, so "disk serve"
+	// cannot export the disk between the check and the launch.
+	unlock, err := LockVM(ctx, rec.RunDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlock != nil {
+			unlock()
+		}
+	}()
+	if pid, ok := servingDisk(rec.RunDir); ok {
+		return fmt.Errorf("VM %s disk is served over NBD by %s %d: stop \"disk serve\" first", id, nbdBinary, pid)
+	}
+	// An update may have changed the record before the lock was taken.
+	if rec, err = ch.loadRecord(ctx, id); err != nil {
+		return err
+	}
 
 	// Clean up stale runtime files from any previous run.
 	cleanupRuntimeFiles(ctx, rec.RunDir)
@@ -67,16 +88,88 @@ func (ch *CloudHypervisor) startOne(ctx context.Context, id string) error {
 
 	// Build VM config and convert to CLI args — CH boots immediately on launch.
 	vmCfg := buildVMConfig(ctx, &rec, consoleSock)
-	args := buildCLIArgs(vmCfg, socketPath)
+	vch := ch.forVM(&rec.Config)
+	if err = vch.gateVMConfig(vmCfg); err != nil {
+		return err
+	}
+	if err = ch.applyHugePages(ctx, vmCfg, &rec.Config); err != nil {
+		return err
+	}
+	ch.applyConfidential(vmCfg, rec.Config.Confidential)
+	if seed := IMDSSeed(ch.conf.Config, &rec); seed != "" {
+		if vmCfg.Platform == nil {
+			vmCfg.Platform = &chPlatform{}
+		}
+		vmCfg.Platform.SerialNumber = seed
+	}
+	withNetwork := hypervisor.NetnsPath(rec.NetworkConfigs) != ""
+	sandbox, err := vch.sandboxArgs(&rec.Config, rec.RunDir, rec.NetworkConfigs)
+	if err != nil {
+		return err
+	}
+	if rec.CgroupPath, err = ch.setupCgroup(ctx, id, &rec.Config, rec.RunDir); err != nil {
+		return fmt.Errorf("setup cgroup: %w", err)
+	}
+	// Past the launch, abortLaunch removes the cgroup on failure.
+	launched := false
+	defer func() {
+		if !launched {
+			removeCgroup(ctx, rec.CgroupPath)
+		}
+	}()
+	if rec.Config.ReadOnly {
+		if err = ch.resetRootDisk(ctx, &rec); err != nil {
+			return err
+		}
+	}
+	if err = ch.prepareScratch(&rec); err != nil {
+		return err
+	}
+	if err = ch.prepareSwap(ctx, &rec); err != nil {
+		return err
+	}
+	if rec.Config.TPM {
+		if err = ch.startSwtpm(ctx, &rec); err != nil {
+			return fmt.Errorf("start TPM: %w", err)
+		}
+	}
+	if disk := backendDisk(&rec); disk != nil {
+		if err = ch.startQSD(ctx, &rec, disk, vmCfg.CPUs.BootVCPUs); err != nil {
+			ch.stopSidecars(ctx, rec.RunDir)
+			return fmt.Errorf("start disk backend: %w", err)
+		}
+	}
+	files, err := OCIGuestFiles(ch.conf.Config, &rec)
+	if err != nil {
+		ch.stopSidecars(ctx, rec.RunDir)
+		return err
+	}
+	if needsBootInitrd(&rec, files) {
+		if vmCfg.Payload.Initramfs, err = ch.bootInitrd(ctx, &rec, files); err != nil {
+			ch.stopSidecars(ctx, rec.RunDir)
+			return err
+		}
+	}
+	args := append(buildCLIArgs(vmCfg, socketPath), sandbox...)
 	ch.saveCmdline(ctx, &rec, args)
 
 	// Launch the CH process with full config.
-	withNetwork := len(rec.NetworkConfigs) > 0
 	pid, err := ch.launchProcess(ctx, &rec, socketPath, args, withNetwork)
+	unlock()
+	unlock = nil
 	if err != nil {
+		cleanupRuntimeFiles(ctx, rec.RunDir)
+		ch.stopSidecars(ctx, rec.RunDir)
+		ch.removeScratch(ctx, id)
 		ch.markError(ctx, id)
 		return fmt.Errorf("launch VM: %w", err)
 	}
+	launched = true
+	if err = ch.secureRuntime(ctx, &rec); err != nil {
+		ch.markError(ctx, id)
+		ch.abortLaunch(ctx, pid, &rec)
+		return err
+	}
 
 	// Persist running state. Console path is resolved lazily by Console() on first access.
 	now := time.Now()
@@ -89,21 +182,56 @@ func (ch *CloudHypervisor) startOne(ctx context.Context, id string) error {
 		r.StartedAt = &now
 		r.UpdatedAt = now
 		r.FirstBooted = true
+		// Volumes hot-plugged last boot may be named differently now.
+		if err := hypervisor.RenumberVolumes(r.StorageConfigs, bootSkipsDisk(&rec)); err != nil {
+			log.WithFunc("cloudhypervisor.startOne").Warnf(ctx, "VM %s: %v", id, err)
+		}
+		r.CgroupPath = rec.CgroupPath
+		r.VMM = rec.VMM
+		r.Health = nil // fresh boot: health check starts over
 		return nil
 	}); err != nil {
-		ch.abortLaunch(ctx, pid, socketPath, rec.RunDir)
+		ch.abortLaunch(ctx, pid, &rec)
 		return fmt.Errorf("update state: %w", err)
 	}
+	ch.recordEvent(ctx, types.EventStarted, id, rec.Config.Name, "")
+	if rec.Config.BootProbe != nil {
+		return ch.probeBoot(ctx, &rec, pid)
+	}
 	return nil
 }
 
+// probeBoot waits for the guest console to show the boot pattern. A guest
+// that fails the probe is marked error before its VMM is torn down, so the
+// daemon does not mistake the teardown for a crash and restart it.
+func (ch *CloudHypervisor) probeBoot(ctx context.Context, rec *hypervisor.VMRecord, pid int) error {
+	console, err := ch.Console(ctx, rec.ID)
+	if err != nil {
+		return fmt.Errorf("boot probe: %w", err)
+	}
+	err = hypervisor.ProbeBoot(ctx, console, rec.Config.BootProbe, filepath.Join(rec.LogDir, hypervisor.BootLogName))
+	var bootErr *hypervisor.BootError
+	if !errors.As(err, &bootErr) {
+		return err
+	}
+	ch.markError(ctx, rec.ID)
+	ch.abortLaunch(ctx, pid, rec)
+	ch.recordEvent(ctx, types.EventBootFailed, rec.ID, rec.Config.Name, bootErr.Reason)
+	return err
+}
+
 // launchProcess starts the cloud-hypervisor binary with the given args,
 // writes the PID file, waits for the API socket to be ready, then releases
 // the process handle so CH lives as an independent OS process past the
-// lifetime of this binary.
+// lifetime of this binary. On success rec.VMM describes the launched binary.
 func (ch *CloudHypervisor) launchProcess(ctx context.Context, rec *hypervisor.VMRecord, socketPath string, args []string, withNetwork bool) (int, error) {
-	processLog := filepath.Join(rec.LogDir, "cloud-hypervisor.log")
-	logFile, err := os.Create(processLog) //nolint:gosec
+	processLog := filepath.Join(rec.LogDir, processLogName)
+	// Keep the previous launch's output as a backup segment; CH appends so
+	// the daemon can copy-truncate the live log when it grows too large.
+	if _, err := utils.RotateLog(processLog, 0, false); err != nil {
+		log.WithFunc("cloudhypervisor.launchProcess").Warnf(ctx, "rotate process log: %v", err)
+	}
+	logFile, err := os.OpenFile(processLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640) //nolint:gosec,mnd
 	if err != nil {
 		log.WithFunc("cloudhypervisor.launchProcess").Warnf(ctx, "create process log: %v", err)
 	} else {
@@ -114,7 +242,8 @@ func (ch *CloudHypervisor) launchProcess(ctx context.Context, rec *hypervisor.VM
 		}()
 	}
 
-	cmd := exec.Command(ch.conf.CHBinary, args...) //nolint:gosec
+	binary := ch.vmmBinary(&rec.Config)
+	cmd := exec.Command(binary, args...) //nolint:gosec
 	// Detach from the parent process group so CH survives if this process exits.
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	if logFile != nil {
@@ -122,17 +251,28 @@ func (ch *CloudHypervisor) launchProcess(ctx context.Context, rec *hypervisor.VM
 		cmd.Stderr = logFile
 	}
 
+	// Macvtap queues are opened here and inherited as the fds buildVMConfig
+	// put on --net.
+	if hypervisor.HasMacvtap(rec.NetworkConfigs) {
+		files, openErr := hypervisor.OpenMacvtapQueues(rec.NetworkConfigs)
+		if openErr != nil {
+			return 0, openErr
+		}
+		defer hypervisor.CloseFiles(files)
+		cmd.ExtraFiles = files
+	}
+
 	// If the VM has network, CH must be launched inside the VM's netns
 	// so it can access the tap device. We setns before fork and restore after.
 	if withNetwork {
-		restore, enterErr := enterNetns(rec.NetworkConfigs[0].NetnsPath)
+		restore, enterErr := utils.EnterNetns(rec.NetworkConfigs[0].NetnsPath)
 		if enterErr != nil {
 			return 0, fmt.Errorf("enter netns: %w", enterErr)
 		}
 		defer restore()
 	}
 
-	if startErr := cmd.Start(); startErr != nil {
+	if startErr := utils.StartInCgroup(cmd, rec.CgroupPath); startErr != nil {
 		return 0, fmt.Errorf("exec cloud-hypervisor: %w", startErr)
 	}
 	pid := cmd.Process.Pid
@@ -153,6 +293,13 @@ func (ch *CloudHypervisor) launchProcess(ctx context.Context, rec *hypervisor.VM
 
 	// Release the process handle: CH is fully detached from Go runtime.
 	_ = cmd.Process.Release()
+
+	rec.VMM = &types.VMMInfo{Binary: binary}
+	if v, err := pingVMM(ctx, utils.NewSocketHTTPClient(socketPath)); err == nil {
+		rec.VMM.Version = v.String()
+	} else {
+		log.WithFunc("cloudhypervisor.launchProcess").Warnf(ctx, "query VMM version: %v", err)
+	}
 	return pid, nil
 }
 
@@ -169,37 +316,3 @@ func waitForSocket(ctx context.Context, socketPath string, pid int, timeout time
 		return false, nil
 	})
 }
-
-// enterNetns locks the OS thread, saves the current netns, and switches
-// to the target netns. The forked child process inherits the new netns.
-// Returns a restore function that must be deferred by the caller.
-// No global state — safe for concurrent use.
-func enterNetns(nsPath string) (restore func(), err error) {
-	runtime.LockOSThread()
-
-	orig, err := netns.Get()
-	if err != nil {
-		runtime.UnlockOSThread()
-		return nil, fmt.Errorf("get current netns: %w", err)
-	}
-
-	target, err := netns.GetFromPath(nsPath)
-	if err != nil {
-		_ = orig.Close()
-		runtime.UnlockOSThread()
-		return nil, fmt.Errorf("open netns %s: %w", nsPath, err)
-	}
-	defer target.Close() //nolint:errcheck
-
-	if err := netns.Set(target); err != nil {
-		_ = orig.Close()
-		runtime.UnlockOSThread()
-		return nil, fmt.Errorf("setns %s: %w", nsPath, err)
-	}
-
-	return func() {
-		_ = netns.Set(orig)
-		_ = orig.Close()
-		runtime.UnlockOSThread()
-	}, nil
-}
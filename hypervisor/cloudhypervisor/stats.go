@@ -0,0 +1,101 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Stats samples resource usage of a running VM: CPU time and RSS of the CH
+// process from /proc, device counters from vm.counters, and the balloon-
+// adjusted guest memory from vm.info.
+func (ch *CloudHypervisor) Stats(ctx context.Context, ref string) (*types.VMStats, error) {
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &types.VMStats{ID: id, Name: rec.Config.Name}
+	return stats, ch.withRunningVM(ctx, &rec, func(pid int) error {
+		stats.PID, stats.CollectedAt = pid, time.Now()
+		if stats.CPUTime, stats.MemoryRSS, err = utils.ProcessUsage(pid); err != nil {
+			return fmt.Errorf("read process usage: %w", err)
+		}
+
+		hc := utils.NewSocketHTTPClient(socketPath(rec.RunDir))
+		counters, err := queryCounters(ctx, hc)
+		if err != nil {
+			return err
+		}
+		stats.Counters = counters
+		aggregateCounters(stats, counters)
+
+		if rec.CgroupPath != "" {
+			if cg, cgErr := utils.CgroupStats(rec.CgroupPath); cgErr == nil {
+				if stats.Counters == nil {
+					stats.Counters = make(map[string]map[string]uint64)
+				}
+				stats.Counters["cgroup"] = cg
+			} else {
+				log.WithFunc("cloudhypervisor.Stats").Debugf(ctx, "cgroup stats %s: %v", id, cgErr)
+			}
+		}
+
+		// Best-effort: older CH versions do not report memory_actual_size.
+		if info, infoErr := queryVMInfo(ctx, hc); infoErr == nil {
+			stats.MemoryActual = info.MemoryActualSize
+		} else {
+			log.WithFunc("cloudhypervisor.Stats").Debugf(ctx, "vm.info %s: %v", id, infoErr)
+		}
+		return nil
+	})
+}
+
+func queryCounters(ctx context.Context, hc *http.Client) (chCounters, error) {
+	body, err := utils.DoAPI(ctx, hc, http.MethodGet, "http://localhost/api/v1/vm.counters", nil, http.StatusOK)
+	if err != nil {
+		return nil, fmt.Errorf("query vm.counters: %w", err)
+	}
+	var counters chCounters
+	if err := json.Unmarshal(body, &counters); err != nil {
+		return nil, fmt.Errorf("decode vm.counters: %w", err)
+	}
+	return counters, nil
+}
+
+// aggregateCounters sums block and net device counters into stats.
+// CH names block devices "_disk<N>" and net devices "_net<N>" unless an
+// explicit device ID was given, so devices are classified by their counter
+// names instead of by ID.
+func aggregateCounters(stats *types.VMStats, counters chCounters) {
+	for _, c := range counters {
+		switch {
+		case hasCounter(c, "read_bytes"):
+			stats.BlockReadBytes += c["read_bytes"]
+			stats.BlockWriteBytes += c["write_bytes"]
+			stats.BlockReadOps += c["read_ops"]
+			stats.BlockWriteOps += c["write_ops"]
+		case hasCounter(c, "rx_bytes"):
+			stats.NetRxBytes += c["rx_bytes"]
+			stats.NetTxBytes += c["tx_bytes"]
+			stats.NetRxPackets += c["rx_frames"]
+			stats.NetTxPackets += c["tx_frames"]
+		}
+	}
+}
+
+func hasCounter(c map[string]uint64, name string) bool {
+	_, ok := c[name]
+	return ok
+}
@@ -0,0 +1,38 @@
+package cloudhypervisor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestAggregateCounters(t *testing.T) {
+	counters := chCounters{
+		"_disk0": {"read_bytes": 100, "write_bytes": 200, "read_ops": 1, "write_ops": 2},
+		"_disk1": {"read_bytes": 10, "write_bytes": 20, "read_ops": 3, "write_ops": 4},
+		"_net2":  {"rx_bytes": 1000, "tx_bytes": 500, "rx_frames": 7, "tx_frames": 5},
+		"__rng":  {"entropy_bytes": 64},
+	}
+	var got types.VMStats
+	aggregateCounters(&got, counters)
+
+	want := types.VMStats{
+		BlockReadBytes: 110, BlockWriteBytes: 220, BlockReadOps: 4, BlockWriteOps: 6,
+		NetRxBytes: 1000, NetTxBytes: 500, NetRxPackets: 7, NetTxPackets: 5,
+	}
+	if got.BlockReadBytes != want.BlockReadBytes || got.BlockWriteBytes != want.BlockWriteBytes ||
+		got.BlockReadOps != want.BlockReadOps || got.BlockWriteOps != want.BlockWriteOps ||
+		got.NetRxBytes != want.NetRxBytes || got.NetTxBytes != want.NetTxBytes ||
+		got.NetRxPackets != want.NetRxPackets || got.NetTxPackets != want.NetTxPackets {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStats_NotRunning(t *testing.T) {
+	ch := newTestCH(t, testRecord("vm-1", "web", types.VMStateStopped))
+	if _, err := ch.Stats(t.Context(), "web"); !errors.Is(err, hypervisor.ErrNotRunning) {
+		t.Errorf("expected ErrNotRunning, got %v", err)
+	}
+}
@@ -3,7 +3,10 @@ package cloudhypervisor
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"syscall"
 	"time"
 
 	"github.com/projecteru2/core/log"
@@ -40,38 +43,89 @@ func (ch *CloudHypervisor) stopOne(ctx context.Context, id string) error {
 	sockPath := socketPath(rec.RunDir)
 	hc := utils.NewSocketHTTPClient(sockPath)
 	stopTimeout := time.Duration(ch.conf.StopTimeoutSeconds) * time.Second
+	if d, ok := hypervisor.StopTimeout(ctx); ok {
+		stopTimeout = d
+	}
 
 	shutdownErr := ch.withRunningVM(ctx, &rec, func(pid int) error {
 		if isDirectBoot(rec.BootConfig) {
-			return ch.forceTerminate(ctx, hc, id, sockPath, pid)
+			return ch.forceTerminate(ctx, hc, &rec, pid)
 		}
-		return ch.shutdownUEFI(ctx, hc, id, sockPath, pid, stopTimeout)
+		return ch.shutdownUEFI(ctx, hc, &rec, pid, stopTimeout)
 	})
+	return ch.finishStop(ctx, &rec, shutdownErr)
+}
 
-	switch {
-	case errors.Is(shutdownErr, hypervisor.ErrNotRunning):
-		// Fast path: no running process — clean up and mark stopped.
-		cleanupRuntimeFiles(ctx, rec.RunDir)
-		return ch.updateState(ctx, id, types.VMStateStopped)
-	case shutdownErr != nil:
+// Kill stops each VM by signalling its CH process directly, skipping the
+// ACPI power-button and vm.shutdown paths for hung guests. SIGKILL is
+// immediate; SIGTERM escalates to SIGKILL after the terminate grace period.
+func (ch *CloudHypervisor) Kill(ctx context.Context, refs []string, sig syscall.Signal) ([]string, error) {
+	if sig != syscall.SIGKILL && sig != syscall.SIGTERM {
+		return nil, fmt.Errorf("unsupported signal %v: must be SIGKILL or SIGTERM", sig)
+	}
+	ids, err := ch.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Kill", func(ctx context.Context, id string) error {
+		rec, err := ch.loadRecord(ctx, id)
+		if err != nil {
+			return err
+		}
+		sockPath := socketPath(rec.RunDir)
+		killErr := ch.withRunningVM(ctx, &rec, func(pid int) error {
+			if sig == syscall.SIGKILL {
+				return utils.KillProcess(ctx, pid, ch.processName(&rec), sockPath)
+			}
+			return utils.TerminateProcess(ctx, pid, ch.processName(&rec), sockPath, ch.conf.TerminateGracePeriod())
+		})
+		return ch.finishStop(ctx, &rec, killErr)
+	})
+}
+
+// finishStop settles the record after a shutdown attempt.
+func (ch *CloudHypervisor) finishStop(ctx context.Context, rec *hypervisor.VMRecord, shutdownErr error) error {
+	id := rec.ID
+	if shutdownErr != nil && !errors.Is(shutdownErr, hypervisor.ErrNotRunning) {
 		// Stop failed — do NOT clean runtime files; the process may still be
 		// running and we need socket/PID to control it later.
 		ch.markError(ctx, id)
 		return shutdownErr
-	default:
-		cleanupRuntimeFiles(ctx, rec.RunDir)
-		return ch.updateState(ctx, id, types.VMStateStopped)
 	}
+	// Either the process is gone already (fast path) or it was shut down:
+	// clean up and mark stopped, wiping any scratch disk. Stopping a
+	// suspended VM discards its saved state; the next start is a cold boot.
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+	if rec.State == types.VMStateSuspended {
+		if err := os.RemoveAll(ch.conf.SavedStateDir(id)); err != nil {
+			return fmt.Errorf("discard saved state: %w", err)
+		}
+	}
+	ch.stopSidecars(ctx, rec.RunDir)
+	ch.removeScratch(ctx, id)
+	// A --read-only VM's writes go with the stop; start resets the disk
+	// again in case this fails or the VMM died without a stop.
+	if rec.Config.ReadOnly {
+		if err := ch.resetRootDisk(ctx, rec); err != nil {
+			log.WithFunc("cloudhypervisor.finishStop").Warnf(ctx, "VM %s: %v", id, err)
+		}
+	}
+	removeCgroup(ctx, rec.CgroupPath)
+	if err := ch.updateState(ctx, id, types.VMStateStopped); err != nil {
+		return err
+	}
+	ch.recordEvent(ctx, types.EventStopped, id, rec.Config.Name, "")
+	return nil
 }
 
 // shutdownUEFI shuts down a UEFI-boot VM:
 //  1. Send ACPI power-button — asks the guest OS to shut down cleanly.
 //  2. Poll until the process exits or the timeout fires.
 //  3. Fallback: forceTerminate (vm.shutdown → SIGTERM → SIGKILL).
-func (ch *CloudHypervisor) shutdownUEFI(ctx context.Context, hc *http.Client, vmID, socketPath string, pid int, timeout time.Duration) error {
+func (ch *CloudHypervisor) shutdownUEFI(ctx context.Context, hc *http.Client, rec *hypervisor.VMRecord, pid int, timeout time.Duration) error {
 	if err := powerButton(ctx, hc); err != nil {
-		log.WithFunc("cloudhypervisor.shutdownUEFI").Errorf(ctx, err, "power-button %s — falling back", vmID)
-		return ch.forceTerminate(ctx, hc, vmID, socketPath, pid)
+		log.WithFunc("cloudhypervisor.shutdownUEFI").Errorf(ctx, err, "power-button %s — falling back", rec.ID)
+		return ch.forceTerminate(ctx, hc, rec, pid)
 	}
 
 	// Poll until the process exits or timeout.
@@ -88,18 +142,18 @@ func (ch *CloudHypervisor) shutdownUEFI(ctx context.Context, hc *http.Client, vm
 	}
 
 	// Guest did not power off in time — escalate.
-	log.WithFunc("cloudhypervisor.shutdownUEFI").Warnf(ctx, "VM %s did not respond to power-button within %s, escalating", vmID, timeout)
-	return ch.forceTerminate(ctx, hc, vmID, socketPath, pid)
+	log.WithFunc("cloudhypervisor.shutdownUEFI").Warnf(ctx, "VM %s did not respond to power-button within %s, escalating", rec.ID, timeout)
+	return ch.forceTerminate(ctx, hc, rec, pid)
 }
 
 // forceTerminate shuts down a VM by flushing disk backends via the REST API,
 // then sending SIGTERM → SIGKILL. Verifies the PID still belongs to
 // cloud-hypervisor before sending signals to avoid killing a reused PID.
-func (ch *CloudHypervisor) forceTerminate(ctx context.Context, hc *http.Client, vmID, socketPath string, pid int) error {
+func (ch *CloudHypervisor) forceTerminate(ctx context.Context, hc *http.Client, rec *hypervisor.VMRecord, pid int) error {
 	if err := shutdownVM(ctx, hc); err != nil {
-		log.WithFunc("cloudhypervisor.forceTerminate").Warnf(ctx, "vm.shutdown %s: %v", vmID, err)
+		log.WithFunc("cloudhypervisor.forceTerminate").Warnf(ctx, "vm.shutdown %s: %v", rec.ID, err)
 	}
-	return utils.TerminateProcess(ctx, pid, ch.chBinaryName(), socketPath, ch.conf.TerminateGracePeriod())
+	return utils.TerminateProcess(ctx, pid, ch.processName(rec), socketPath(rec.RunDir), ch.conf.TerminateGracePeriod())
 }
 
 // isDirectBoot returns true when the VM was started with a direct kernel boot
@@ -0,0 +1,146 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Suspend saves each running VM's full state (vCPUs, devices, memory) under
+// root_dir, so it survives a host reboot, and exits the VMM, freeing the guest's memory. The COW
+// disk stays in place, so the saved state and disk remain consistent until
+// ResumeFromDisk or a stop discards the state.
+func (ch *CloudHypervisor) Suspend(ctx context.Context, refs []string) ([]string, error) {
+	if err := ch.requireFeature(featureSnapshot); err != nil {
+		return nil, err
+	}
+	ids, err := ch.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Suspend", ch.suspendOne)
+}
+
+func (ch *CloudHypervisor) suspendOne(ctx context.Context, id string) error {
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rec.Config.TPM {
+		return fmt.Errorf("VM %s has a TPM: suspend is not supported", id)
+	}
+	// Guest memory holds the disk key; it must not land on disk in the clear.
+	if rec.Config.Encrypt {
+		return fmt.Errorf("VM %s is encrypted: suspend is not supported", id)
+	}
+	// The scratch disk lives in RAM; a host reboot would lose what the
+	// saved guest still expects to find on it.
+	if rec.Config.EphemeralDisk > 0 {
+		return fmt.Errorf("VM %s has an ephemeral disk: suspend is not supported", id)
+	}
+	// CH cannot save the state of a vhost-user-blk device.
+	if rec.Config.DiskBackend.VhostUser() {
+		return fmt.Errorf("VM %s uses disk backend %s: suspend is not supported", id, rec.Config.DiskBackend)
+	}
+	if rec.Config.Confidential != "" {
+		return fmt.Errorf("VM %s is a confidential (%s) guest: suspend is not supported", id, rec.Config.Confidential)
+	}
+	if hypervisor.HasColdBootNIC(rec.NetworkConfigs) {
+		return fmt.Errorf("VM %s has macvtap, SR-IOV or usermode NICs: suspend is not supported", id)
+	}
+
+	if err := ch.saveAndExit(ctx, &rec); err != nil {
+		return err
+	}
+	if err := ch.updateState(ctx, id, types.VMStateSuspended); err != nil {
+		return err
+	}
+	ch.recordEvent(ctx, types.EventSuspended, id, rec.Config.Name, "")
+	return nil
+}
+
+// saveAndExit saves a running VM's state into its SavedStateDir and exits
+// the VMM, leaving the guest ready for restoreAfterExtract.
+func (ch *CloudHypervisor) saveAndExit(ctx context.Context, rec *hypervisor.VMRecord) error {
+	hc := utils.NewSocketHTTPClient(socketPath(rec.RunDir))
+	stateDir := ch.conf.SavedStateDir(rec.ID)
+	if err := ch.withRunningVM(ctx, rec, func(pid int) error {
+		if err := os.RemoveAll(stateDir); err != nil {
+			return fmt.Errorf("remove old saved state: %w", err)
+		}
+		if err := os.MkdirAll(stateDir, 0o700); err != nil {
+			return fmt.Errorf("create saved state dir: %w", err)
+		}
+		if err := pauseVM(ctx, hc); err != nil {
+			return fmt.Errorf("pause: %w", err)
+		}
+		if err := snapshotVM(ctx, hc, stateDir); err != nil {
+			if resumeErr := resumeVM(context.WithoutCancel(ctx), hc); resumeErr != nil {
+				log.WithFunc("cloudhypervisor.saveAndExit").Warnf(ctx, "resume VM %s: %v", rec.ID, resumeErr)
+			}
+			_ = os.RemoveAll(stateDir)
+			return fmt.Errorf("snapshot: %w", err)
+		}
+		// The guest stays paused: vm.shutdown flushes the disk backends
+		// before the process exits, so the COW matches the saved state.
+		return ch.forceTerminate(ctx, hc, rec, pid)
+	}); err != nil {
+		return err
+	}
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+	removeCgroup(ctx, rec.CgroupPath)
+	return nil
+}
+
+// ResumeFromDisk restores each suspended VM from the state Suspend saved,
+// with the same disks, netns, tap and MAC. The saved state is removed once
+// the guest runs again; a failed resume leaves the VM suspended so it can
+// be retried.
+func (ch *CloudHypervisor) ResumeFromDisk(ctx context.Context, refs []string) ([]string, error) {
+	if err := ch.requireFeature(featureSnapshot); err != nil {
+		return nil, err
+	}
+	ids, err := ch.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "ResumeFromDisk", ch.resumeFromDiskOne)
+}
+
+func (ch *CloudHypervisor) resumeFromDiskOne(ctx context.Context, id string) error {
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	if rec.State != types.VMStateSuspended {
+		return fmt.Errorf("VM %s is %s, must be suspended to resume from disk", id, rec.State)
+	}
+	if err := utils.EnsureDirs(rec.RunDir, rec.LogDir); err != nil {
+		return fmt.Errorf("ensure dirs: %w", err)
+	}
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+
+	start := time.Now()
+	directBoot := isDirectBoot(rec.BootConfig)
+	vmCfg := rec.Config
+	if _, err := ch.restoreAfterExtract(ctx, id, &vmCfg, &rec, ch.conf.SavedStateDir(id), directBoot, ch.cowPath(ch.diskDir(&rec), directBoot)); err != nil {
+		// restoreAfterExtract marked the VM error, but the saved state is
+		// untouched: keep it resumable.
+		if stateErr := ch.updateState(ctx, id, types.VMStateSuspended); stateErr != nil {
+			log.WithFunc("cloudhypervisor.ResumeFromDisk").Warnf(ctx, "keep VM %s suspended: %v", id, stateErr)
+		}
+		return err
+	}
+	if err := os.RemoveAll(ch.conf.SavedStateDir(id)); err != nil {
+		log.WithFunc("cloudhypervisor.ResumeFromDisk").Warnf(ctx, "remove saved state of VM %s: %v", id, err)
+	}
+	ch.recordEvent(ctx, types.EventResumed, id, rec.Config.Name, fmt.Sprintf("in %s", time.Since(start).Round(time.Millisecond)))
+	return nil
+}
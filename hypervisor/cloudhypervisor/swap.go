@@ -0,0 +1,61 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// SwapSerial is the virtio serial of a VM's --swap disk, so the guest
+// finds it as /dev/disk/by-id/virtio-cocoon-swap.
+const SwapSerial = "cocoon-swap"
+
+// swapPath returns the swap disk of the VM whose disks live in diskDir.
+func swapPath(diskDir string) string { return filepath.Join(diskDir, swapName) }
+
+// isSwapDisk reports whether sc is the VM's --swap disk.
+func isSwapDisk(sc *types.StorageConfig) bool {
+	return sc.Serial == SwapSerial && !sc.RO && sc.Volume == ""
+}
+
+// attachSwap adds the swap disk after a VM's prepared disks.
+func attachSwap(prepared []*types.StorageConfig, path string) []*types.StorageConfig {
+	return attachBeforeCidata(prepared, &types.StorageConfig{Path: path, RO: false, Serial: SwapSerial})
+}
+
+// updateSwapPath points a copied VM's swap disk at the new VM's file.
+func updateSwapPath(storageConfigs []*types.StorageConfig, path string) {
+	for _, sc := range storageConfigs {
+		if isSwapDisk(sc) {
+			sc.Path = path
+		}
+	}
+}
+
+// prepareSwap formats a fresh swap disk for a VM about to boot cold.
+// Nothing swapped out by an earlier boot is still referenced, so the old
+// file's blocks are released rather than carried along.
+func (ch *CloudHypervisor) prepareSwap(ctx context.Context, rec *hypervisor.VMRecord) error {
+	if rec.Config.Swap == 0 {
+		return nil
+	}
+	path := swapPath(ch.diskDir(rec))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create swap disk: %w", err)
+	}
+	_ = f.Close()
+	if err := os.Truncate(path, rec.Config.Swap); err != nil {
+		return fmt.Errorf("truncate swap disk: %w", err)
+	}
+	if out, err := exec.CommandContext(ctx, "mkswap", "-L", SwapSerial, path).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("mkswap: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestAttachSwap(t *testing.T) {
+	overlay := &types.StorageConfig{Path: "/run/vm/overlay.qcow2"}
+	cidata := &types.StorageConfig{Path: "/run/vm/" + cidataFile, RO: true}
+	got := attachSwap([]*types.StorageConfig{overlay, cidata}, "/run/vm/"+swapName)
+	if len(got) != 3 || got[0] != overlay || !isSwapDisk(got[1]) || got[2] != cidata {
+		t.Fatalf("swap must precede cidata, got %+v", got)
+	}
+	if isBackendDisk(got[1]) {
+		t.Error("swap disk must not be served by the disk backend")
+	}
+	if err := updateCOWPath(got, "/run/clone/overlay.qcow2", false); err != nil {
+		t.Fatal(err)
+	}
+	updateSwapPath(got, "/run/clone/"+swapName)
+	if got[0].Path != "/run/clone/overlay.qcow2" || got[1].Path != "/run/clone/"+swapName {
+		t.Errorf("clone paths: %+v", got)
+	}
+
+	cmdline := BuildCmdline(nil, nil, &types.VMConfig{Swap: 1 << 30}, nil)
+	if !strings.Contains(cmdline, " cocoon.swap="+SwapSerial) {
+		t.Errorf("cmdline lacks the swap serial: %s", cmdline)
+	}
+}
+
+func TestPrepareSwap(t *testing.T) {
+	if _, err := exec.LookPath("mkswap"); err != nil {
+		t.Skip("mkswap not found")
+	}
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{RunDir: t.TempDir()}}}
+	rec := &hypervisor.VMRecord{VM: types.VM{ID: "aaa111", Config: types.VMConfig{Swap: 1 << 20}}}
+	if err := os.MkdirAll(ch.diskDir(rec), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.prepareSwap(t.Context(), rec); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(swapPath(ch.diskDir(rec)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1<<20 || !strings.Contains(string(data[:os.Getpagesize()]), "SWAPSPACE2") {
+		t.Errorf("swap disk not formatted: %d bytes", len(data))
+	}
+}
@@ -0,0 +1,186 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// TemplateDirName holds the formatted ext4 COW templates of a backend
+// directory; GC must not mistake it for a VM directory.
+const TemplateDirName = "templates"
+
+// maxCOWTemplates is how many templates a template directory keeps: the
+// sizes used most recently. Disks cloned from a pruned template keep
+// their blocks; the next create of that size formats it again.
+const maxCOWTemplates = 4
+
+// CreateRawCOW creates the ext4-formatted raw COW disk at cowPath: a
+// reflink of a prebuilt template when the filesystem supports it,
+// otherwise a fresh sparse file run through mkfs.ext4. Preallocated
+// disks are always formatted, since a reflink shares the template's
+// sparse extents.
+func CreateRawCOW(ctx context.Context, cowPath string, size int64, prealloc types.Prealloc) error {
+	if !prealloc.Sparse() {
+		return formatCOW(ctx, cowPath, size, prealloc)
+	}
+	err := cloneCOWTemplate(ctx, cowPath, size)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		log.WithFunc("cloudhypervisor.CreateRawCOW").Warnf(ctx, "clone COW template: %v; formatting instead", err)
+	}
+	return formatCOW(ctx, cowPath, size, prealloc)
+}
+
+// cowTemplateDir returns the template directory of the backend directory
+// holding cowPath's VM directory, so templates share the disks' filesystem.
+func cowTemplateDir(cowPath string) string {
+	return filepath.Join(filepath.Dir(filepath.Dir(cowPath)), TemplateDirName)
+}
+
+// cloneCOWTemplate creates the raw COW at cowPath as a reflink of a
+// formatted ext4 template of the same size, built once per size, so create
+// skips mkfs and disks share their untouched blocks. It returns
+// errors.ErrUnsupported when the filesystem cannot reflink.
+func cloneCOWTemplate(ctx context.Context, cowPath string, size int64) error {
+	dir := cowTemplateDir(cowPath)
+	if err := utils.EnsureDirs(dir); err != nil {
+		return fmt.Errorf("ensure template dir: %w", err)
+	}
+	if !utils.SupportsReflink(dir) {
+		return errors.ErrUnsupported
+	}
+	tmpl, err := ensureCOWTemplate(ctx, dir, size)
+	if err != nil {
+		return err
+	}
+	if err := utils.Reflink(cowPath, tmpl); err != nil {
+		return fmt.Errorf("reflink %s: %w", tmpl, err)
+	}
+	// Every clone starts with the template's filesystem UUID; metadata_csum_seed
+	// lets tune2fs change it without rewriting the checksums.
+	if out, err := exec.CommandContext(ctx, "tune2fs", "-U", "random", cowPath).CombinedOutput(); err != nil { //nolint:gosec
+		_ = os.Remove(cowPath)
+		return fmt.Errorf("tune2fs -U COW: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// ensureCOWTemplate returns the ext4 template of size bytes in dir,
+// formatting it first if needed, and prunes the least recently used ones
+// beyond maxCOWTemplates. Concurrent creates may both format one; the
+// rename makes the last one win whole.
+func ensureCOWTemplate(ctx context.Context, dir string, size int64) (string, error) {
+	path := filepath.Join(dir, fmt.Sprintf("ext4-%d.raw", size))
+	if utils.ValidFile(path) {
+		// The mtime tracks use, for pruning.
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return path, nil
+	}
+	f, err := os.CreateTemp(dir, ".ext4-*.raw")
+	if err != nil {
+		return "", fmt.Errorf("create COW template: %w", err)
+	}
+	tmp := f.Name()
+	_ = f.Close()
+	defer os.Remove(tmp) //nolint:errcheck
+	if err := formatCOW(ctx, tmp, size, types.PreallocOff); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("install COW template: %w", err)
+	}
+	pruneCOWTemplates(ctx, dir, path)
+	return path, nil
+}
+
+// pruneCOWTemplates removes the templates in dir beyond maxCOWTemplates,
+// least recently used first; keep, the one just installed, stays.
+func pruneCOWTemplates(ctx context.Context, dir, keep string) {
+	paths, err := filepath.Glob(filepath.Join(dir, "ext4-*.raw"))
+	if err != nil || len(paths) <= maxCOWTemplates {
+		return
+	}
+	used := make(map[string]time.Time, len(paths))
+	for _, p := range paths {
+		if fi, statErr := os.Stat(p); statErr == nil {
+			used[p] = fi.ModTime()
+		}
+	}
+	// keep counts as the most recent, whatever its mtime.
+	used[keep] = time.Now()
+	slices.SortFunc(paths, func(a, b string) int { return used[b].Compare(used[a]) })
+	for _, p := range paths[maxCOWTemplates:] {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("cloudhypervisor.pruneCOWTemplates").Warnf(ctx, "remove COW template %s: %v", p, err)
+		}
+	}
+}
+
+// formatCOW creates a raw file of size bytes at path and formats it as
+// ext4. Sparse disks leave inode tables and journal for the guest kernel
+// to initialize lazily; preallocated ones get them written now, and skip
+// mkfs's discard, which would punch the allocated blocks back out.
+func formatCOW(ctx context.Context, path string, size int64, prealloc types.Prealloc) error {
+	if err := createRaw(path, size, prealloc); err != nil {
+		return err
+	}
+	extended := "lazy_itable_init=1,lazy_journal_init=1,discard"
+	if !prealloc.Sparse() {
+		extended = "lazy_itable_init=0,lazy_journal_init=0,nodiscard"
+	}
+	out, err := exec.CommandContext(ctx, //nolint:gosec
+		"mkfs.ext4", "-F", "-m", "0", "-q",
+		"-O", "metadata_csum_seed",
+		"-E", extended,
+		path,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mkfs.ext4 COW: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// createRaw creates (or truncates) path as a raw file of size bytes,
+// allocated on the host up front for --prealloc full.
+func createRaw(path string, size int64, prealloc types.Prealloc) error {
+	if err := createSparse(path, size); err != nil {
+		return err
+	}
+	if prealloc != types.PreallocFull {
+		return nil
+	}
+	if err := utils.Fallocate(path, size, false); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("preallocate COW: %w", err)
+	}
+	return nil
+}
+
+// createSparse creates (or truncates) path as a sparse file of size bytes.
+func createSparse(path string, size int64) error {
+	// os.Truncate requires the file to exist; create it first.
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create COW: %w", err)
+	}
+	_ = f.Close()
+	if err := os.Truncate(path, size); err != nil {
+		return fmt.Errorf("truncate COW: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package cloudhypervisor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+func TestCreateRawCOW(t *testing.T) {
+	for _, bin := range []string{"mkfs.ext4", "tune2fs", "dumpe2fs"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s not found", bin)
+		}
+	}
+	ctx := t.Context()
+	root := t.TempDir()
+	cow := filepath.Join(root, "aaa111", cowRawName)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 << 20
+	if err := CreateRawCOW(ctx, cow, size, types.PreallocOff); err != nil {
+		t.Fatalf("CreateRawCOW: %v", err)
+	}
+	if fi, err := os.Stat(cow); err != nil || fi.Size() != size {
+		t.Fatalf("COW: %v, %v", fi, err)
+	}
+	if out, err := exec.CommandContext(ctx, "dumpe2fs", "-h", cow).CombinedOutput(); err != nil {
+		t.Fatalf("COW is not ext4: %s", out)
+	}
+
+	tmpl := filepath.Join(root, TemplateDirName, "ext4-67108864.raw")
+	if !utils.SupportsReflink(root) {
+		if _, err := os.Stat(tmpl); !os.IsNotExist(err) {
+			t.Errorf("template built on a filesystem without reflink: %v", err)
+		}
+		return
+	}
+	before, err := os.Stat(tmpl)
+	if err != nil {
+		t.Fatalf("template: %v", err)
+	}
+	second := filepath.Join(root, "bbb222", cowRawName)
+	if err := os.MkdirAll(filepath.Dir(second), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateRawCOW(ctx, second, size, types.PreallocOff); err != nil {
+		t.Fatalf("CreateRawCOW again: %v", err)
+	}
+	if after, err := os.Stat(tmpl); err != nil || !os.SameFile(before, after) {
+		t.Errorf("template rebuilt: %v", err)
+	}
+}
+
+func TestCreateRawCOW_PreallocFull(t *testing.T) {
+	if _, err := exec.LookPath("mkfs.ext4"); err != nil {
+		t.Skip("mkfs.ext4 not found")
+	}
+	root := t.TempDir()
+	cow := filepath.Join(root, "aaa111", cowRawName)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	const size = 64 << 20
+	if err := CreateRawCOW(t.Context(), cow, size, types.PreallocFull); err != nil {
+		t.Fatalf("CreateRawCOW: %v", err)
+	}
+	allocated, err := utils.AllocatedSize(cow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated < size {
+		t.Errorf("COW not preallocated: %d of %d bytes allocated", allocated, size)
+	}
+	if _, err := os.Stat(filepath.Join(root, TemplateDirName)); !os.IsNotExist(err) {
+		t.Errorf("preallocated COW went through the template: %v", err)
+	}
+}
+
+func TestPruneCOWTemplates(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	var paths []string
+	for i := range maxCOWTemplates + 2 {
+		p := filepath.Join(dir, fmt.Sprintf("ext4-%d.raw", i))
+		if err := os.WriteFile(p, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		used := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, used, used); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, p)
+	}
+	// The oldest is the one just installed: it stays, the next two go.
+	pruneCOWTemplates(t.Context(), dir, paths[0])
+	for i, p := range paths {
+		_, err := os.Stat(p)
+		if gone := os.IsNotExist(err); gone != (i == 1 || i == 2) {
+			t.Errorf("%s: removed = %v", filepath.Base(p), gone)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	swtpmSockName = "swtpm.sock"
+	swtpmPIDName  = "swtpm.pid"
+	swtpmLogName  = "swtpm.log"
+	// tpmStateDir names the TPM state directory under the VM's state
+	// directory (and, before that, under its run directory).
+	tpmStateDir = "tpm"
+)
+
+func swtpmSockPath(runDir string) string { return filepath.Join(runDir, swtpmSockName) }
+
+// startSwtpm launches the VM's swtpm emulator and waits for its control
+// socket. swtpm runs with --terminate, so it exits on its own once CH
+// closes the connection; stopSwtpm covers the paths where CH never
+// connected.
+func (ch *CloudHypervisor) startSwtpm(ctx context.Context, rec *hypervisor.VMRecord) error {
+	ch.stopSwtpm(ctx, rec.RunDir)
+
+	stateDir := ch.conf.TPMStateDir(rec.ID)
+	if err := os.MkdirAll(filepath.Dir(stateDir), 0o700); err != nil {
+		return fmt.Errorf("create TPM state dir: %w", err)
+	}
+	// Move state kept in the run directory by earlier versions.
+	if _, err := os.Stat(stateDir); os.IsNotExist(err) {
+		if err := os.Rename(filepath.Join(rec.RunDir, tpmStateDir), stateDir); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("cloudhypervisor.startSwtpm").Warnf(ctx, "move TPM state of VM %s to %s: %v", rec.ID, stateDir, err)
+		}
+	}
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return fmt.Errorf("create TPM state dir: %w", err)
+	}
+	sock := swtpmSockPath(rec.RunDir)
+	cmd := exec.Command(ch.conf.SwtpmBinary, //nolint:gosec
+		"socket", "--tpm2",
+		"--tpmstate", "dir="+stateDir,
+		"--ctrl", "type=unixio,path="+sock,
+		"--log", "file="+filepath.Join(rec.LogDir, swtpmLogName),
+		"--flags", "startup-clear",
+		"--terminate",
+	)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := utils.StartInCgroup(cmd, rec.CgroupPath); err != nil {
+		return fmt.Errorf("exec swtpm: %w", err)
+	}
+	pid := cmd.Process.Pid
+	if err := utils.WritePIDFile(filepath.Join(rec.RunDir, swtpmPIDName), pid); err != nil {
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("write swtpm PID file: %w", err)
+	}
+	if err := waitForSocket(ctx, sock, pid, ch.conf.SocketWaitTimeout()); err != nil {
+		ch.stopSwtpm(ctx, rec.RunDir)
+		return fmt.Errorf("swtpm: %w", err)
+	}
+	return nil
+}
+
+// stopSwtpm terminates a VM's swtpm, if any, and removes its runtime files.
+// The TPM state directory is kept for the next start.
+func (ch *CloudHypervisor) stopSwtpm(ctx context.Context, runDir string) {
+	pidPath := filepath.Join(runDir, swtpmPIDName)
+	sock := swtpmSockPath(runDir)
+	if pid, err := utils.ReadPIDFile(pidPath); err == nil {
+		if err := utils.TerminateProcess(ctx, pid, filepath.Base(ch.conf.SwtpmBinary), sock, ch.conf.TerminateGracePeriod()); err != nil {
+			log.WithFunc("cloudhypervisor.stopSwtpm").Warnf(ctx, "kill swtpm %d: %v", pid, err)
+		}
+	}
+	for _, p := range []string{pidPath, sock} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("cloudhypervisor.stopSwtpm").Warnf(ctx, "cleanup %s: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Update changes CPU, memory, and storage of a created or stopped VM.
+// The new values take effect on the next start, which rebuilds the CH
+// config from the record. A larger Storage grows the COW disk in place;
+// the guest still has to grow its partition/filesystem.
+func (ch *CloudHypervisor) Update(ctx context.Context, ref string, vmCfg *types.VMConfig) (*types.VM, error) {
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Hold the VM lock from the stopped check to the record update, so a
+	// start cannot launch the VM in between on the old disk or sizes.
+	unlock, err := LockVM(ctx, rec.RunDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if rec, err = ch.loadRecord(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if err := ch.requireStopped(ctx, &rec, "update"); err != nil {
+		return nil, err
+	}
+
+	if numa := rec.Config.NUMA; numa != nil {
+		if err := numa.Validate(vmCfg.CPU, vmCfg.Memory); err != nil {
+			return nil, fmt.Errorf("NUMA topology: %w", err)
+		}
+	}
+	if vmCfg.Storage < rec.Config.Storage {
+		return nil, fmt.Errorf("storage cannot shrink from %d to %d bytes", rec.Config.Storage, vmCfg.Storage)
+	}
+	if vmCfg.Storage > rec.Config.Storage {
+		directBoot := isDirectBoot(rec.BootConfig)
+		if err := ExpandImage(ctx, ch.cowPath(ch.diskDir(&rec), directBoot), vmCfg.Storage, directBoot); err != nil {
+			return nil, fmt.Errorf("resize COW: %w", err)
+		}
+	}
+
+	var result *types.VM
+	return result, ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", id)
+		}
+		r.Config.CPU = vmCfg.CPU
+		r.Config.Memory = vmCfg.Memory
+		r.Config.Storage = vmCfg.Storage
+		r.UpdatedAt = time.Now()
+		result = toVM(r)
+		return nil
+	})
+}
@@ -0,0 +1,54 @@
+package cloudhypervisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestUpdate(t *testing.T) {
+	stopped := testRecord("aaa111", "web", types.VMStateStopped)
+	stopped.BootConfig = &types.BootConfig{KernelPath: "/boot/vmlinux"}
+	running := testRecord("bbb222", "db", types.VMStateRunning)
+	ch := newTestCH(t, stopped, running)
+	ctx := t.Context()
+
+	cow := ch.cowPath(ch.diskDir(stopped), true)
+	if err := os.MkdirAll(filepath.Dir(cow), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cow, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(cow, stopped.Config.Storage); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := stopped.Config
+	cfg.CPU, cfg.Memory, cfg.Storage = 4, 4<<30, 20<<30
+	vm, err := ch.Update(ctx, "web", &cfg)
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if vm.Config.CPU != 4 || vm.Config.Memory != 4<<30 || vm.Config.Storage != 20<<30 {
+		t.Errorf("config not updated: %+v", vm.Config)
+	}
+	fi, err := os.Stat(cow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 20<<30 {
+		t.Errorf("COW size = %d, want %d", fi.Size(), int64(20<<30))
+	}
+
+	shrink := cfg
+	shrink.Storage = 10 << 30
+	if _, err := ch.Update(ctx, "web", &shrink); err == nil {
+		t.Error("expected error when shrinking storage")
+	}
+	if _, err := ch.Update(ctx, "db", &running.Config); err == nil {
+		t.Error("expected error updating a running VM")
+	}
+}
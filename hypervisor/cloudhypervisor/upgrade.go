@@ -0,0 +1,133 @@
+package cloudhypervisor
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// UpgradeVMM moves VMs onto binary (empty = the ch_binary config) one at a
+// time, stopping at the first failure so a bad build takes down at most one
+// guest. A running VM is saved, its VMM exited, and the state restored on
+// the new binary: the guest pauses for the round trip but keeps its memory,
+// devices and connections. When the new binary cannot restore the state,
+// the VM is brought back on its previous binary.
+func (ch *CloudHypervisor) UpgradeVMM(ctx context.Context, refs []string, binary string) ([]string, error) {
+	target := cmp.Or(binary, ch.conf.CHBinary)
+	version, err := probeVersion(target)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := ch.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	var done []string
+	for _, id := range ids {
+		if err := ch.upgradeOne(ctx, id, binary, fmt.Sprintf("%s %s", target, version), version); err != nil {
+			return done, fmt.Errorf("upgrade VM %s: %w", id, err)
+		}
+		done = append(done, id)
+	}
+	return done, nil
+}
+
+func (ch *CloudHypervisor) upgradeOne(ctx context.Context, id, binary, target string, version *chVersion) error {
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	from := ch.vmmBinary(&rec.Config)
+	if rec.VMM != nil {
+		from = fmt.Sprintf("%s %s", rec.VMM.Binary, rec.VMM.Version)
+	}
+
+	switch rec.State {
+	case types.VMStateRunning:
+		err = ch.upgradeRunning(ctx, &rec, binary, version)
+	case types.VMStateCreated, types.VMStateStopped, types.VMStateError, types.VMStateSuspended:
+		// Nothing runs: the next start or resume launches the new binary.
+		err = ch.setCHBinary(ctx, id, binary)
+	default:
+		err = fmt.Errorf("VM %s is %s", id, rec.State)
+	}
+	if err != nil {
+		return err
+	}
+	ch.recordEvent(ctx, types.EventVMMUpgraded, id, rec.Config.Name, fmt.Sprintf("%s -> %s", from, target))
+	return nil
+}
+
+func (ch *CloudHypervisor) upgradeRunning(ctx context.Context, rec *hypervisor.VMRecord, binary string, version *chVersion) error {
+	if rec.Config.TPM {
+		return fmt.Errorf("VM %s has a TPM: stop it to change its VMM", rec.ID)
+	}
+	if rec.Config.DiskBackend.VhostUser() {
+		return fmt.Errorf("VM %s uses disk backend %s: stop it to change its VMM", rec.ID, rec.Config.DiskBackend)
+	}
+	if rec.Config.Confidential != "" {
+		return fmt.Errorf("VM %s is a confidential (%s) guest: stop it to change its VMM", rec.ID, rec.Config.Confidential)
+	}
+	if hypervisor.HasColdBootNIC(rec.NetworkConfigs) {
+		return fmt.Errorf("VM %s has macvtap, SR-IOV or usermode NICs: stop it to change its VMM", rec.ID)
+	}
+	if err := checkFeature(version, featureSnapshot); err != nil {
+		return err
+	}
+	// The running VMM may predate the installed binary.
+	if v, err := pingVMM(ctx, utils.NewSocketHTTPClient(socketPath(rec.RunDir))); err == nil {
+		if err := checkFeature(&v, featureSnapshot); err != nil {
+			return err
+		}
+	}
+
+	prevCfg := rec.Config
+	if err := ch.saveAndExit(ctx, rec); err != nil {
+		return fmt.Errorf("save VM state: %w", err)
+	}
+
+	logger := log.WithFunc("cloudhypervisor.UpgradeVMM")
+	directBoot := isDirectBoot(rec.BootConfig)
+	cowPath := ch.cowPath(ch.diskDir(rec), directBoot)
+	vmCfg := prevCfg
+	vmCfg.CHBinary = binary
+	if _, err := ch.restoreAfterExtract(ctx, rec.ID, &vmCfg, rec, ch.conf.SavedStateDir(rec.ID), directBoot, cowPath); err != nil {
+		logger.Warnf(ctx, "restore VM %s on the new binary: %v; falling back to the previous one", rec.ID, err)
+		if _, rollbackErr := ch.restoreAfterExtract(ctx, rec.ID, &prevCfg, rec, ch.conf.SavedStateDir(rec.ID), directBoot, cowPath); rollbackErr != nil {
+			// The saved state is untouched: keep it resumable.
+			if stateErr := ch.updateState(ctx, rec.ID, types.VMStateSuspended); stateErr != nil {
+				logger.Warnf(ctx, "keep VM %s suspended: %v", rec.ID, stateErr)
+			}
+			return fmt.Errorf("restore on new binary: %w; restore on previous binary: %w (VM left suspended)", err, rollbackErr)
+		}
+		if cleanErr := os.RemoveAll(ch.conf.SavedStateDir(rec.ID)); cleanErr != nil {
+			logger.Warnf(ctx, "remove saved state of VM %s: %v", rec.ID, cleanErr)
+		}
+		return fmt.Errorf("restore on new binary: %w (VM is running on its previous binary)", err)
+	}
+	if err := os.RemoveAll(ch.conf.SavedStateDir(rec.ID)); err != nil {
+		logger.Warnf(ctx, "remove saved state of VM %s: %v", rec.ID, err)
+	}
+	return nil
+}
+
+// setCHBinary records the binary a VM launches with next.
+func (ch *CloudHypervisor) setCHBinary(ctx context.Context, id, binary string) error {
+	return ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %q not found in index", id)
+		}
+		r.Config.CHBinary = binary
+		r.UpdatedAt = time.Now()
+		return nil
+	})
+}
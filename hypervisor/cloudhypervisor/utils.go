@@ -1,13 +1,16 @@
 package cloudhypervisor
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	units "github.com/docker/go-units"
 	"github.com/projecteru2/core/log"
 
 	"github.com/projecteru2/cocoon/hypervisor"
@@ -24,8 +27,18 @@ func (ch *CloudHypervisor) loadRecord(ctx context.Context, id string) (hyperviso
 	})
 }
 
-func (ch *CloudHypervisor) chBinaryName() string {
-	return filepath.Base(ch.conf.CHBinary)
+// vmmBinary returns the cloud-hypervisor binary a VM launches with.
+func (ch *CloudHypervisor) vmmBinary(cfg *types.VMConfig) string {
+	return cmp.Or(cfg.CHBinary, ch.conf.CHBinary)
+}
+
+// processName returns the executable name of rec's VMM process: the binary
+// it was last launched with, which an upgrade may since have changed.
+func (ch *CloudHypervisor) processName(rec *hypervisor.VMRecord) string {
+	if rec.VMM != nil && rec.VMM.Binary != "" {
+		return filepath.Base(rec.VMM.Binary)
+	}
+	return filepath.Base(ch.vmmBinary(&rec.Config))
 }
 
 func (ch *CloudHypervisor) withRunningVM(ctx context.Context, rec *hypervisor.VMRecord, fn func(pid int) error) error {
@@ -33,7 +46,7 @@ func (ch *CloudHypervisor) withRunningVM(ctx context.Context, rec *hypervisor.VM
 	if pidErr != nil && !os.IsNotExist(pidErr) {
 		log.WithFunc("cloudhypervisor.withRunningVM").Warnf(ctx, "read PID file: %v", pidErr)
 	}
-	if !utils.VerifyProcessCmdline(pid, ch.chBinaryName(), socketPath(rec.RunDir)) {
+	if !utils.VerifyProcessCmdline(pid, ch.processName(rec), socketPath(rec.RunDir)) {
 		return hypervisor.ErrNotRunning
 	}
 	return fn(pid)
@@ -48,6 +61,9 @@ func (ch *CloudHypervisor) updateState(ctx context.Context, id string, state typ
 		}
 		r.State = state
 		r.UpdatedAt = now
+		if state != types.VMStateError {
+			r.Error = ""
+		}
 		switch state {
 		case types.VMStateRunning:
 			r.StartedAt = &now
@@ -65,7 +81,7 @@ func (ch *CloudHypervisor) markError(ctx context.Context, id string) {
 }
 
 func (ch *CloudHypervisor) saveCmdline(ctx context.Context, rec *hypervisor.VMRecord, args []string) {
-	line := ch.conf.CHBinary + " " + strings.Join(args, " ")
+	line := ch.vmmBinary(&rec.Config) + " " + strings.Join(args, " ")
 	if err := os.WriteFile(filepath.Join(rec.RunDir, "cmdline"), []byte(line), 0o600); err != nil {
 		log.WithFunc("cloudhypervisor.saveCmdline").Warnf(ctx, "save cmdline: %v", err)
 	}
@@ -82,6 +98,12 @@ func (ch *CloudHypervisor) reserveVM(ctx context.Context, id string, vmCfg *type
 		if dup, ok := idx.Names[vmCfg.Name]; ok {
 			return fmt.Errorf("VM name %q already exists (id: %s)", vmCfg.Name, dup)
 		}
+		if err := idx.CheckCPUSet(id, vmCfg); err != nil {
+			return err
+		}
+		if err := ch.checkPoolRoom(idx, vmCfg); err != nil {
+			return err
+		}
 		idx.VMs[id] = &hypervisor.VMRecord{
 			VM: types.VM{
 				ID: id, State: types.VMStateCreating,
@@ -90,12 +112,43 @@ func (ch *CloudHypervisor) reserveVM(ctx context.Context, id string, vmCfg *type
 			ImageBlobIDs: blobIDs,
 			RunDir:       runDir,
 			LogDir:       logDir,
+			DataDir:      ch.vmDataDir(id, vmCfg),
 		}
 		idx.Names[vmCfg.Name] = id
+		if root := ch.conf.DataRoot(vmCfg.DataDir); vmCfg.DataDir != "" && !slices.Contains(idx.DataRoots, root) {
+			idx.DataRoots = append(idx.DataRoots, root)
+		}
 		return nil
 	})
 }
 
+// checkPoolRoom fails when the storage pool of vmCfg has no room left for
+// its disk beside the disks of the VMs in idx. reserveVM calls it under the
+// index lock, so concurrent creates cannot both take the last of a pool.
+func (ch *CloudHypervisor) checkPoolRoom(idx *hypervisor.VMIndex, vmCfg *types.VMConfig) error {
+	if vmCfg.Pool == "" {
+		return nil
+	}
+	pool, ok := ch.conf.Pool(vmCfg.Pool)
+	if !ok {
+		return fmt.Errorf("storage pool %q not found", vmCfg.Pool)
+	}
+	var committed int64
+	for _, rec := range idx.VMs {
+		if rec.Config.Pool == vmCfg.Pool {
+			committed += rec.Config.Storage
+		}
+	}
+	room, err := pool.Room(committed)
+	if err != nil {
+		return err
+	}
+	if room < vmCfg.Storage {
+		return fmt.Errorf("storage pool %s has %s left, VM disk needs %s", pool.Name, units.HumanSize(float64(room)), units.HumanSize(float64(vmCfg.Storage)))
+	}
+	return nil
+}
+
 // rollbackCreate removes a placeholder VM record from the DB.
 func (ch *CloudHypervisor) rollbackCreate(ctx context.Context, id, name string) {
 	if err := ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
@@ -110,16 +163,48 @@ func (ch *CloudHypervisor) rollbackCreate(ctx context.Context, id, name string)
 }
 
 // abortLaunch kills a CH process and removes runtime files after a failed launch sequence.
-func (ch *CloudHypervisor) abortLaunch(ctx context.Context, pid int, sockPath, runDir string) {
-	_ = utils.TerminateProcess(ctx, pid, ch.chBinaryName(), sockPath, ch.conf.TerminateGracePeriod())
-	cleanupRuntimeFiles(ctx, runDir)
+func (ch *CloudHypervisor) abortLaunch(ctx context.Context, pid int, rec *hypervisor.VMRecord) {
+	_ = utils.TerminateProcess(ctx, pid, ch.processName(rec), socketPath(rec.RunDir), ch.conf.TerminateGracePeriod())
+	ch.stopSidecars(ctx, rec.RunDir)
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+	removeCgroup(ctx, rec.CgroupPath)
 }
 
-// cowPath returns the writable COW disk path for a VM.
+// cowPath returns the writable COW disk path in a VM's disk directory.
 // Direct-boot (OCI) uses a raw file; UEFI (cloudimg) uses a qcow2 overlay.
-func (ch *CloudHypervisor) cowPath(vmID string, directBoot bool) string {
+func (ch *CloudHypervisor) cowPath(diskDir string, directBoot bool) string {
 	if directBoot {
-		return ch.conf.COWRawPath(vmID)
+		return filepath.Join(diskDir, cowRawName)
+	}
+	return filepath.Join(diskDir, overlayName)
+}
+
+// diskDir returns the directory holding rec's writable disks.
+func (ch *CloudHypervisor) diskDir(rec *hypervisor.VMRecord) string {
+	return cmp.Or(rec.DataDir, ch.conf.VMRunDir(rec.ID))
+}
+
+// vmDataDir returns the disk directory VM id gets under vmCfg's --data-dir,
+// or "" when its disks stay in the run directory.
+func (ch *CloudHypervisor) vmDataDir(id string, vmCfg *types.VMConfig) string {
+	if vmCfg.DataDir == "" {
+		return ""
+	}
+	return ch.conf.VMDataDir(vmCfg.DataDir, id)
+}
+
+// checkDataDir rejects a --data-dir that is not an existing directory, so a
+// typo fails the create instead of filling a new tree on the wrong disk.
+func checkDataDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("--data-dir: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("--data-dir %s is not a directory", dir)
 	}
-	return ch.conf.OverlayPath(vmID)
+	return nil
 }
@@ -0,0 +1,67 @@
+package cloudhypervisor
+
+import (
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestProcessName(t *testing.T) {
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{CHBinary: "/usr/bin/cloud-hypervisor"}}}
+	tests := []struct {
+		name string
+		rec  hypervisor.VMRecord
+		want string
+	}{
+		{name: "host default", want: "cloud-hypervisor"},
+		{
+			name: "per-VM override",
+			rec:  hypervisor.VMRecord{VM: types.VM{Config: types.VMConfig{CHBinary: "/opt/ch/v44/cloud-hypervisor-static"}}},
+			want: "cloud-hypervisor-static",
+		},
+		{
+			// An upgrade recorded a new binary, but the running VMM is the
+			// one that was launched.
+			name: "launched binary wins",
+			rec: hypervisor.VMRecord{VM: types.VM{
+				Config: types.VMConfig{CHBinary: "/opt/ch/v44/ch-next"},
+				VMM:    &types.VMMInfo{Binary: "/opt/ch/v43/ch-prev", Version: "v43.0"},
+			}},
+			want: "ch-prev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ch.processName(&tt.rec); got != tt.want {
+				t.Errorf("processName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiskDir(t *testing.T) {
+	ch := &CloudHypervisor{conf: &Config{Config: &config.Config{RunDir: "/run/cocoon"}}}
+	rec := &hypervisor.VMRecord{VM: types.VM{ID: "aaa111"}}
+	if got, want := ch.cowPath(ch.diskDir(rec), true), "/run/cocoon/cloudhypervisor/aaa111/cow.raw"; got != want {
+		t.Errorf("default cowPath = %q, want %q", got, want)
+	}
+	rec.DataDir = ch.vmDataDir(rec.ID, &types.VMConfig{DataDir: "/mnt/fastnvme"})
+	if got, want := ch.cowPath(ch.diskDir(rec), false), "/mnt/fastnvme/cloudhypervisor/aaa111/overlay.qcow2"; got != want {
+		t.Errorf("--data-dir cowPath = %q, want %q", got, want)
+	}
+}
+
+func TestCheckDataDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkDataDir(""); err != nil {
+		t.Errorf("empty: %v", err)
+	}
+	if err := checkDataDir(dir); err != nil {
+		t.Errorf("existing dir: %v", err)
+	}
+	if err := checkDataDir(dir + "/missing"); err == nil {
+		t.Error("missing dir: want error")
+	}
+}
@@ -0,0 +1,146 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const versionProbeTimeout = 3 * time.Second
+
+// chVersion is a cloud-hypervisor release number (major.minor).
+type chVersion struct {
+	Major, Minor int
+}
+
+func (v chVersion) String() string { return fmt.Sprintf("v%d.%d", v.Major, v.Minor) }
+
+func (v chVersion) atLeast(o chVersion) bool {
+	return v.Major > o.Major || (v.Major == o.Major && v.Minor >= o.Minor)
+}
+
+// chFeature is a CH capability cocoon relies on that older releases lack.
+type chFeature struct {
+	name  string
+	since chVersion
+}
+
+var (
+	featureFreePageReporting = chFeature{"balloon free_page_reporting", chVersion{23, 0}}
+	featureBackingFiles      = chFeature{"qcow2 backing_files", chVersion{43, 0}}
+	featureSnapshot          = chFeature{"snapshot/restore API", chVersion{31, 0}}
+	featureLandlock          = chFeature{"landlock sandboxing", chVersion{39, 0}}
+)
+
+var versionRe = regexp.MustCompile(`v?(\d+)\.(\d+)`)
+
+// parseCHVersion extracts the release from `cloud-hypervisor --version`
+// output or a vmm.ping version string, e.g. "cloud-hypervisor v41.0.0" or
+// "v40.0-12-gabcdef".
+func parseCHVersion(s string) (chVersion, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return chVersion{}, fmt.Errorf("unrecognized cloud-hypervisor version %q", s)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return chVersion{Major: major, Minor: minor}, nil
+}
+
+// probeVersion runs `<binary> --version`. An error means the version is
+// unknown and no feature is gated.
+func probeVersion(binary string) (*chVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, binary, "--version").Output() //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("%s --version: %w", binary, err)
+	}
+	v, err := parseCHVersion(string(out))
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// validateCHBinary checks that a per-VM binary override runs and reports a
+// cloud-hypervisor version.
+func validateCHBinary(binary string) error {
+	if binary == "" {
+		return nil
+	}
+	if _, err := probeVersion(binary); err != nil {
+		return fmt.Errorf("--ch-binary: %w", err)
+	}
+	return nil
+}
+
+// pingVMM asks a running CH process for its version via vmm.ping, which may
+// differ from the installed binary after an upgrade.
+func pingVMM(ctx context.Context, hc *http.Client) (chVersion, error) {
+	body, err := utils.DoAPI(ctx, hc, http.MethodGet, "http://localhost/api/v1/vmm.ping", nil, http.StatusOK)
+	if err != nil {
+		return chVersion{}, err
+	}
+	var resp struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return chVersion{}, fmt.Errorf("decode vmm.ping: %w", err)
+	}
+	return parseCHVersion(resp.Version)
+}
+
+// checkFeature returns a descriptive error when v is known to predate f.
+func checkFeature(v *chVersion, f chFeature) error {
+	if v == nil || v.atLeast(f.since) {
+		return nil
+	}
+	return fmt.Errorf("%s requires cloud-hypervisor >= %s, found %s: upgrade cloud-hypervisor", f.name, f.since, v)
+}
+
+// supports reports whether the installed binary has f (true when unknown).
+func (ch *CloudHypervisor) supports(f chFeature) bool {
+	return checkFeature(ch.version, f) == nil
+}
+
+// requireFeature fails fast, before any VM state is touched, when the
+// installed binary lacks f.
+func (ch *CloudHypervisor) requireFeature(f chFeature) error {
+	return checkFeature(ch.version, f)
+}
+
+// forVM returns a view of ch whose feature gates follow the binary cfg
+// launches with, when it overrides the host default.
+func (ch *CloudHypervisor) forVM(cfg *types.VMConfig) *CloudHypervisor {
+	if cfg.CHBinary == "" || cfg.CHBinary == ch.conf.CHBinary {
+		return ch
+	}
+	vch := *ch
+	vch.version, _ = probeVersion(cfg.CHBinary)
+	return &vch
+}
+
+// gateVMConfig drops optional features the installed binary lacks and
+// rejects configs that cannot work without them.
+func (ch *CloudHypervisor) gateVMConfig(cfg *chVMConfig) error {
+	if cfg.Balloon != nil && cfg.Balloon.FreePageReporting && !ch.supports(featureFreePageReporting) {
+		cfg.Balloon.FreePageReporting = false
+	}
+	for _, d := range cfg.Disks {
+		if d.BackingFiles {
+			if err := ch.requireFeature(featureBackingFiles); err != nil {
+				return fmt.Errorf("disk %s: %w", d.Path, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package cloudhypervisor
+
+import (
+	"testing"
+)
+
+func TestParseCHVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    chVersion
+		wantErr bool
+	}{
+		{"cloud-hypervisor v41.0.0\n", chVersion{41, 0}, false},
+		{"cloud-hypervisor v40.1-12-gabcdef0", chVersion{40, 1}, false},
+		{"v38.0", chVersion{38, 0}, false},
+		{"44.0.0-dirty", chVersion{44, 0}, false},
+		{"cloud-hypervisor", chVersion{}, true},
+		{"", chVersion{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseCHVersion(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCHVersion(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseCHVersion(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckFeature(t *testing.T) {
+	f := chFeature{"test feature", chVersion{40, 1}}
+	tests := []struct {
+		name    string
+		v       *chVersion
+		wantErr bool
+	}{
+		{"unknown", nil, false},
+		{"equal", &chVersion{40, 1}, false},
+		{"newer minor", &chVersion{40, 2}, false},
+		{"newer major", &chVersion{41, 0}, false},
+		{"older minor", &chVersion{40, 0}, true},
+		{"older major", &chVersion{39, 9}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkFeature(tt.v, f); (err != nil) != tt.wantErr {
+				t.Errorf("checkFeature(%v) err = %v, wantErr %v", tt.v, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGateVMConfig(t *testing.T) {
+	newCfg := func() *chVMConfig {
+		return &chVMConfig{
+			Balloon: &chBalloon{Size: 1 << 30, FreePageReporting: true},
+			Disks:   []chDisk{{Path: "/run/overlay.qcow2", BackingFiles: true}},
+		}
+	}
+
+	ch := &CloudHypervisor{version: &chVersion{22, 0}}
+	cfg := newCfg()
+	if err := ch.gateVMConfig(cfg); err == nil {
+		t.Fatal("expected backing_files error on v22")
+	}
+	if cfg.Balloon.FreePageReporting {
+		t.Error("free_page_reporting should be dropped on v22")
+	}
+
+	ch.version = &chVersion{43, 0}
+	cfg = newCfg()
+	if err := ch.gateVMConfig(cfg); err != nil {
+		t.Fatalf("gateVMConfig on v43: %v", err)
+	}
+	if !cfg.Balloon.FreePageReporting {
+		t.Error("free_page_reporting should be kept on v43")
+	}
+
+	ch.version = nil
+	if err := ch.gateVMConfig(newCfg()); err != nil {
+		t.Fatalf("gateVMConfig with unknown version: %v", err)
+	}
+}
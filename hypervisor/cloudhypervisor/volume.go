@@ -0,0 +1,219 @@
+package cloudhypervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// AttachVolume adds a volume disk to a VM. A running guest gets it
+// hot-plugged and sees it right away; a created or stopped VM gets it on its
+// next start. A disk.Target the guest would not name the disk, now or on
+// the next cold boot, is an error.
+func (ch *CloudHypervisor) AttachVolume(ctx context.Context, ref string, disk *types.StorageConfig) (*types.VM, error) {
+	id, rec, unlock, err := ch.lockVolumeHost(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if slices.ContainsFunc(rec.StorageConfigs, func(sc *types.StorageConfig) bool { return sc.Volume == disk.Volume }) {
+		return nil, fmt.Errorf("volume %s is already attached to VM %s", disk.Volume, id)
+	}
+	sc := *disk
+
+	hot := false
+	runErr := ch.withRunningVM(ctx, &rec, func(_ int) error {
+		hot = true
+		hc := utils.NewSocketHTTPClient(socketPath(rec.RunDir))
+		info, infoErr := queryVMInfo(ctx, hc)
+		if infoErr != nil {
+			return infoErr
+		}
+		sc.Target = hypervisor.HotplugTarget(rec.StorageConfigs, guestDiskIndexes(&rec, info.Config.Disks))
+		if disk.Target != "" && disk.Target != sc.Target {
+			return fmt.Errorf("volume would appear as %s in the guest, not %s", sc.Target, disk.Target)
+		}
+		// CH appends the disk to its config, so a cold boot names it by
+		// its place after the VM's disks.
+		booted := sc
+		if renumberErr := hypervisor.RenumberVolumes(append(cloneStorage(rec.StorageConfigs), &booted), bootSkipsDisk(&rec)); sc.Pinned && renumberErr != nil {
+			return fmt.Errorf("volume would not keep %s after a restart: %w", disk.Target, renumberErr)
+		}
+		d := storageConfigToDisk(&sc, rec.Config.CPU)
+		d.RateLimiter = diskRateLimiter(&rec.Config)
+		if addErr := addDiskVM(ctx, hc, d); addErr != nil {
+			return fmt.Errorf("vm.add-disk: %w", addErr)
+		}
+		return nil
+	})
+	if runErr != nil && !errors.Is(runErr, hypervisor.ErrNotRunning) {
+		return nil, runErr
+	}
+	if !hot {
+		// Numbering a copy gives sc its Target before anything changes.
+		if err := hypervisor.RenumberVolumes(hypervisor.InsertVolume(cloneStorage(rec.StorageConfigs), &sc, isCidataDisk), bootSkipsDisk(&rec)); err != nil {
+			if disk.Target != "" && disk.Target != sc.Target {
+				return nil, fmt.Errorf("volume would appear as %s in the guest, not %s", sc.Target, disk.Target)
+			}
+			return nil, err
+		}
+	}
+
+	result, err := ch.updateStorage(ctx, id, func(r *hypervisor.VMRecord) error {
+		if hot {
+			// CH appends hot-plugged disks to its config; the record
+			// follows that order.
+			r.StorageConfigs = append(r.StorageConfigs, &sc)
+			return nil
+		}
+		r.StorageConfigs = hypervisor.InsertVolume(r.StorageConfigs, &sc, isCidataDisk)
+		return hypervisor.RenumberVolumes(r.StorageConfigs, bootSkipsDisk(r))
+	})
+	if err != nil && hot {
+		if rmErr := removeDeviceVM(context.WithoutCancel(ctx), utils.NewSocketHTTPClient(socketPath(rec.RunDir)), sc.Serial); rmErr != nil {
+			log.WithFunc("cloudhypervisor.AttachVolume").Warnf(ctx, "unplug volume %s from VM %s: %v", sc.Volume, id, rmErr)
+		}
+	}
+	return result, err
+}
+
+// DetachVolume removes the disk of volume volumeID from a VM, hot-unplugging
+// it from a running guest. The guest should have unmounted it: the disk
+// disappears whether or not it is in use. A detach that would move a
+// volume attached with a target of its own on the next cold boot is an
+// error.
+func (ch *CloudHypervisor) DetachVolume(ctx context.Context, ref, volumeID string) (*types.VM, error) {
+	id, rec, unlock, err := ch.lockVolumeHost(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	idx := slices.IndexFunc(rec.StorageConfigs, func(sc *types.StorageConfig) bool { return sc.Volume == volumeID })
+	if idx < 0 {
+		return nil, fmt.Errorf("volume %s is not attached to VM %s", volumeID, id)
+	}
+	serial := rec.StorageConfigs[idx].Serial
+	rest, _ := hypervisor.RemoveVolume(cloneStorage(rec.StorageConfigs), volumeID)
+	if err := hypervisor.RenumberVolumes(rest, bootSkipsDisk(&rec)); err != nil {
+		return nil, fmt.Errorf("detach volume %s: %w; detach the later volumes first", volumeID, err)
+	}
+
+	hot := false
+	runErr := ch.withRunningVM(ctx, &rec, func(_ int) error {
+		hot = true
+		if rmErr := removeDeviceVM(ctx, utils.NewSocketHTTPClient(socketPath(rec.RunDir)), serial); rmErr != nil {
+			return fmt.Errorf("vm.remove-device: %w", rmErr)
+		}
+		return nil
+	})
+	if runErr != nil && !errors.Is(runErr, hypervisor.ErrNotRunning) {
+		return nil, runErr
+	}
+	return ch.updateStorage(ctx, id, func(r *hypervisor.VMRecord) error {
+		r.StorageConfigs, _ = hypervisor.RemoveVolume(r.StorageConfigs, volumeID)
+		if !hot {
+			// The guest keeps the names of the disks it has; a cold boot
+			// closes the gap.
+			return hypervisor.RenumberVolumes(r.StorageConfigs, bootSkipsDisk(r))
+		}
+		return nil
+	})
+}
+
+// lockVolumeHost takes the lock of a VM whose volumes can change (created,
+// stopped or running) and loads it, so attaches and detaches of one VM
+// run one at a time and place each disk against the disks of the last.
+// The caller releases the lock with unlock.
+func (ch *CloudHypervisor) lockVolumeHost(ctx context.Context, ref string) (string, hypervisor.VMRecord, func(), error) {
+	id, err := ch.resolveRef(ctx, ref)
+	if err != nil {
+		return "", hypervisor.VMRecord{}, nil, err
+	}
+	rec, err := ch.loadRecord(ctx, id)
+	if err != nil {
+		return "", rec, nil, err
+	}
+	unlock, err := LockVM(ctx, rec.RunDir)
+	if err != nil {
+		return "", rec, nil, err
+	}
+	if rec, err = ch.loadRecord(ctx, id); err != nil {
+		unlock()
+		return "", rec, nil, err
+	}
+	switch rec.State {
+	case types.VMStateCreated, types.VMStateStopped, types.VMStateRunning:
+	default:
+		unlock()
+		return "", rec, nil, fmt.Errorf("VM %s is %s, must be created, stopped or running to attach or detach volumes", id, rec.State)
+	}
+	return id, rec, unlock, nil
+}
+
+// cloneStorage deep-copies storageConfigs, so numbering the copy leaves
+// the record's disks alone.
+func cloneStorage(storageConfigs []*types.StorageConfig) []*types.StorageConfig {
+	out := make([]*types.StorageConfig, len(storageConfigs))
+	for i, sc := range storageConfigs {
+		c := *sc
+		out[i] = &c
+	}
+	return out
+}
+
+// updateStorage applies fn to VM id's record under the index lock.
+func (ch *CloudHypervisor) updateStorage(ctx context.Context, id string, fn func(*hypervisor.VMRecord) error) (*types.VM, error) {
+	var result *types.VM
+	return result, ch.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", id)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+		r.UpdatedAt = time.Now()
+		result = toVM(r)
+		return nil
+	})
+}
+
+// bootSkipsDisk reports which of rec's disks its next cold boot leaves
+// out: the cidata disk once the guest first booted.
+func bootSkipsDisk(rec *hypervisor.VMRecord) func(*types.StorageConfig) bool {
+	return func(sc *types.StorageConfig) bool {
+		// A read-only guest forgets its first boot with the overlay, so
+		// cloud-init needs the seed on every boot.
+		return rec.FirstBooted && !rec.Config.ReadOnly && !isDirectBoot(rec.BootConfig) && isCidataDisk(sc)
+	}
+}
+
+// guestDiskIndexes returns the virtio-blk indexes the running guest gave
+// the VM's own disks: they come first, in record order, and a cidata disk
+// still in the running config follows the volumes attached before it.
+func guestDiskIndexes(rec *hypervisor.VMRecord, running []chDisk) []int {
+	var indexes []int
+	volumes := 0
+	for _, sc := range rec.StorageConfigs {
+		switch {
+		case sc.Pmem:
+		case sc.Volume != "":
+			volumes++
+		case isCidataDisk(sc):
+			if slices.ContainsFunc(running, func(d chDisk) bool { return d.Path == sc.Path }) {
+				indexes = append(indexes, len(indexes)+volumes)
+			}
+		default:
+			indexes = append(indexes, len(indexes))
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,141 @@
+package cloudhypervisor
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestGuestDiskIndexes(t *testing.T) {
+	rec := &hypervisor.VMRecord{VM: types.VM{StorageConfigs: []*types.StorageConfig{
+		{Path: "/vm/overlay.qcow2"},
+		{Path: "/vol/a.raw", Volume: "a"},
+		{Path: "/vm/cidata.img"},
+		{Path: "/vol/b.raw", Volume: "b"},
+	}}}
+	tests := []struct {
+		name    string
+		running []chDisk
+		want    []int
+	}{
+		{"first boot", []chDisk{{Path: "/vm/overlay.qcow2"}, {Path: "/vol/a.raw"}, {Path: "/vm/cidata.img"}}, []int{0, 2}},
+		{"cidata dropped", []chDisk{{Path: "/vm/overlay.qcow2"}, {Path: "/vol/a.raw"}}, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guestDiskIndexes(rec, tt.running); !slices.Equal(got, tt.want) {
+				t.Errorf("guestDiskIndexes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVolumeDiskID(t *testing.T) {
+	d := storageConfigToDisk(&types.StorageConfig{Path: "/vol/a.raw", Serial: "vol-a", Volume: "a"}, 1)
+	if d.ID != "vol-a" {
+		t.Errorf("ID = %q, want vol-a", d.ID)
+	}
+	if arg := diskToCLIArg(d); !strings.Contains(arg, ",id=vol-a") {
+		t.Errorf("disk arg %q missing id", arg)
+	}
+	if d := storageConfigToDisk(&types.StorageConfig{Path: "/vm/cow.raw", Serial: CowSerial}, 1); d.ID != "" {
+		t.Errorf("COW disk ID = %q, want none", d.ID)
+	}
+}
+
+// stoppedVolumeHost returns a stopped VM with a COW disk, one volume a and
+// a volume b pinned to the device after it.
+func stoppedVolumeHost(t *testing.T) (*CloudHypervisor, *hypervisor.VMRecord) {
+	t.Helper()
+	rec := testRecord("aaa111", "web", types.VMStateStopped)
+	rec.RunDir = t.TempDir()
+	rec.StorageConfigs = []*types.StorageConfig{
+		{Path: "/vm/cow.raw", Serial: CowSerial},
+		{Path: "/vol/a.raw", Volume: "a", Target: "/dev/vdb"},
+		{Path: "/vol/b.raw", Volume: "b", Target: "/dev/vdc", Pinned: true},
+	}
+	return newTestCH(t, rec), rec
+}
+
+func TestDetachVolume_KeepsPinnedTargets(t *testing.T) {
+	ch, _ := stoppedVolumeHost(t)
+	ctx := t.Context()
+	if _, err := ch.DetachVolume(ctx, "web", "a"); err == nil || !strings.Contains(err.Error(), "/dev/vdc") {
+		t.Fatalf("detaching a before pinned b: err = %v", err)
+	}
+	vm, err := ch.DetachVolume(ctx, "web", "b")
+	if err != nil {
+		t.Fatalf("detach b: %v", err)
+	}
+	if len(vm.StorageConfigs) != 2 || vm.StorageConfigs[1].Target != "/dev/vdb" {
+		t.Errorf("disks after detach: %+v", vm.StorageConfigs)
+	}
+
+	// A pinned target the next boot would not give is refused up front.
+	if _, err := ch.AttachVolume(ctx, "web", &types.StorageConfig{Path: "/vol/c.raw", Volume: "c", Target: "/dev/vdd", Pinned: true}); err == nil {
+		t.Error("attached c as /dev/vdd, which the guest names /dev/vdc")
+	}
+}
+
+func TestAttachVolume_Serialized(t *testing.T) {
+	ch, rec := stoppedVolumeHost(t)
+	ctx := t.Context()
+
+	// An attach waits for whoever holds the VM lock.
+	unlock, err := LockVM(ctx, rec.RunDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ch.AttachVolume(ctx, "web", &types.StorageConfig{Path: "/vol/c.raw", Volume: "c"})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("attach ran under another holder of the VM lock: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Attaches racing each other each get a device of their own.
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Go(func() {
+			id := fmt.Sprintf("v%d", i)
+			_, errs[i] = ch.AttachVolume(ctx, "web", &types.StorageConfig{Path: "/vol/" + id + ".raw", Volume: id})
+		})
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ch.loadRecord(ctx, rec.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, sc := range got.StorageConfigs {
+		if sc.Volume == "" {
+			continue
+		}
+		if seen[sc.Target] {
+			t.Errorf("two volumes attached as %s: %+v", sc.Target, got.StorageConfigs)
+		}
+		seen[sc.Target] = true
+	}
+	if len(seen) != 7 {
+		t.Errorf("%d volume devices, want 7", len(seen))
+	}
+}
@@ -0,0 +1,31 @@
+package cloudhypervisor
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// watchdogLogMarker is logged by CH's virtio-watchdog device right before it
+// resets a guest that stopped pinging it.
+var watchdogLogMarker = []byte("Watchdog triggered")
+
+// WatchdogResets counts the watchdog resets in the VM's process log. The log
+// is truncated on every launch, so the count covers the current VMM process
+// only; a log rotation makes it drop, which callers must tolerate.
+func (ch *CloudHypervisor) WatchdogResets(ctx context.Context, ref string) (int, error) {
+	path, err := ch.LogFile(ctx, ref, types.LogProcess)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return bytes.Count(data, watchdogLogMarker), nil
+}
@@ -1,6 +1,8 @@
 package hypervisor
 
 import (
+	"fmt"
+
 	"github.com/projecteru2/cocoon/types"
 	"github.com/projecteru2/cocoon/utils"
 )
@@ -22,12 +24,26 @@ type VMRecord struct {
 	// differ from the values at creation time.
 	RunDir string `json:"run_dir,omitempty"`
 	LogDir string `json:"log_dir,omitempty"`
+	// DataDir is the absolute directory of the VM's writable disks when
+	// created with --data-dir; empty = RunDir.
+	DataDir string `json:"data_dir,omitempty"`
+
+	// CgroupPath is the cgroup v2 directory of the running VMM process;
+	// empty when cgroup placement is disabled or the VM never started.
+	CgroupPath string `json:"cgroup_path,omitempty"`
+
+	// RootPassword is the VM's random root password, sealed with a key of
+	// the keystore, until "vm credentials" shows it.
+	RootPassword []byte `json:"root_password,omitempty"`
 }
 
 // VMIndex is the top-level DB structure for a hypervisor backend.
 type VMIndex struct {
 	VMs   map[string]*VMRecord `json:"vms"`
 	Names map[string]string    `json:"names"` // name → VM ID
+	// DataRoots lists every backend directory under a --data-dir that ever
+	// held VM disks, so GC finds orphans there after the last VM is gone.
+	DataRoots []string `json:"data_roots,omitempty"`
 }
 
 // Init implements storage.Initer.
@@ -44,3 +60,32 @@ func (idx *VMIndex) Resolve(ref string) (string, error) {
 func (idx *VMIndex) ResolveMany(refs []string) ([]string, error) {
 	return utils.ResolveRefs(idx.VMs, idx.Names, refs, ErrNotFound)
 }
+
+// CheckCPUSet rejects cfg's vCPU pin when it overlaps the pin of another
+// VM in the index, unless both pins are shared. id is the VM being
+// configured and is skipped.
+func (idx *VMIndex) CheckCPUSet(id string, cfg *types.VMConfig) error {
+	if cfg.CPUSet == "" {
+		return nil
+	}
+	cpus, err := types.ParseCPUSet(cfg.CPUSet)
+	if err != nil {
+		return err
+	}
+	for otherID, rec := range idx.VMs {
+		if otherID == id || rec == nil || rec.Config.CPUSet == "" {
+			continue
+		}
+		if cfg.CPUSetShared && rec.Config.CPUSetShared {
+			continue
+		}
+		other, err := types.ParseCPUSet(rec.Config.CPUSet)
+		if err != nil {
+			continue
+		}
+		if types.CPUSetsOverlap(cpus, other) {
+			return fmt.Errorf("cpuset %s overlaps cpuset %s of VM %s (%s): pins are exclusive unless both VMs use --cpuset-shared", cfg.CPUSet, rec.Config.CPUSet, rec.Config.Name, otherID)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package hypervisor
 
 import (
+	"archive/tar"
 	"context"
 	"errors"
 	"io"
+	"syscall"
+	"time"
 
 	"github.com/projecteru2/cocoon/gc"
 	"github.com/projecteru2/cocoon/types"
@@ -12,8 +15,25 @@ import (
 var (
 	ErrNotFound   = errors.New("VM not found")
 	ErrNotRunning = errors.New("VM not running")
+	// ErrNoRootPassword is returned by TakeRootPassword when the VM got no
+	// random root password, or it was taken already.
+	ErrNoRootPassword = errors.New("no root password to show")
 )
 
+type stopTimeoutKey struct{}
+
+// WithStopTimeout overrides the configured stop timeout (how long Stop waits
+// for a graceful guest shutdown) for calls made with the returned context.
+func WithStopTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, stopTimeoutKey{}, d)
+}
+
+// StopTimeout returns the override set by WithStopTimeout, if any.
+func StopTimeout(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(stopTimeoutKey{}).(time.Duration)
+	return d, ok
+}
+
 // Hypervisor manages VM lifecycle. Implemented by each backend.
 type Hypervisor interface {
 	Type() string
@@ -21,12 +41,20 @@ type Hypervisor interface {
 	Create(ctx context.Context, vmID string, vmCfg *types.VMConfig, storage []*types.StorageConfig, network []*types.NetworkConfig, boot *types.BootConfig) (*types.VM, error)
 	Start(ctx context.Context, refs []string) ([]string, error)
 	Stop(ctx context.Context, refs []string) ([]string, error)
+	Reboot(ctx context.Context, refs []string) ([]string, error)
+	Kill(ctx context.Context, refs []string, sig syscall.Signal) ([]string, error)
 	Inspect(ctx context.Context, ref string) (*types.VM, error)
 	List(context.Context) ([]*types.VM, error)
+	Stats(ctx context.Context, ref string) (*types.VMStats, error)
+	LogFile(ctx context.Context, ref string, source types.LogSource) (string, error)
+	TakeRootPassword(ctx context.Context, ref string) (string, error)
 	Delete(ctx context.Context, refs []string, force bool) ([]string, error)
+	Rename(ctx context.Context, ref, name string) error
+	Update(ctx context.Context, ref string, vmCfg *types.VMConfig) (*types.VM, error)
 	Console(ctx context.Context, ref string) (io.ReadWriteCloser, error)
 	Snapshot(ctx context.Context, ref string) (*types.SnapshotConfig, io.ReadCloser, error)
 	Clone(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, snapshotConfig *types.SnapshotConfig, snapshot io.Reader) (*types.VM, error)
+	CloneVM(ctx context.Context, srcRef, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig) (*types.VM, error)
 	Restore(ctx context.Context, vmRef string, vmCfg *types.VMConfig, snapshot io.Reader) (*types.VM, error)
 
 	RegisterGC(*gc.Orchestrator)
@@ -38,3 +66,125 @@ type Direct interface {
 	DirectClone(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, snapshotConfig *types.SnapshotConfig, srcDir string) (*types.VM, error)
 	DirectRestore(ctx context.Context, vmRef string, vmCfg *types.VMConfig, srcDir string) (*types.VM, error)
 }
+
+// Suspender is an optional interface for hypervisors that can park a running
+// VM on disk, freeing its memory, and restore it later.
+type Suspender interface {
+	Suspend(ctx context.Context, refs []string) ([]string, error)
+	ResumeFromDisk(ctx context.Context, refs []string) ([]string, error)
+}
+
+// VMMUpgrader is an optional interface for hypervisors that can move VMs
+// onto another VMM binary (empty = the host default). Running guests are
+// carried across with a local save/restore; the others just record the
+// binary for their next launch.
+type VMMUpgrader interface {
+	UpgradeVMM(ctx context.Context, refs []string, binary string) ([]string, error)
+}
+
+// LogRotator is an optional interface for hypervisors whose VMM process logs
+// must be rotated by the daemon while the VM is running.
+type LogRotator interface {
+	RotateLogs(ctx context.Context) error
+}
+
+// WatchdogCounter is an optional interface for hypervisors whose VMM resets
+// a hung guest through an emulated watchdog device. WatchdogResets returns
+// how many resets the current VMM process has logged so far.
+type WatchdogCounter interface {
+	WatchdogResets(ctx context.Context, ref string) (int, error)
+}
+
+// RuntimeRepair lists what a RuntimeRepairer changed.
+type RuntimeRepair struct {
+	Adopted []string // VMs with a live VMM whose record was not running
+	Cleaned []string // VMs whose leftover sockets/PID files were removed
+}
+
+// RuntimeRepairer is an optional interface for hypervisors that can bring
+// records of non-running VMs back in line with the host: adopting live VMM
+// processes and removing runtime files left by dead ones.
+type RuntimeRepairer interface {
+	RepairRuntime(ctx context.Context) (*RuntimeRepair, error)
+}
+
+// GuestIPRecorder is an optional interface for hypervisors that persist
+// addresses learned from guest traffic on NICs without static config.
+type GuestIPRecorder interface {
+	SetGuestIP(ctx context.Context, ref, mac, ip string) error
+}
+
+// ErrorRecorder is an optional interface for hypervisors that can mark a
+// VM as failed, with the reason, on behalf of the caller (e.g. when its
+// network could not be set up).
+type ErrorRecorder interface {
+	SetError(ctx context.Context, ref, reason string) error
+}
+
+// VolumeAttacher is an optional interface for hypervisors that can add and
+// remove volume disks after creation, hot-plugging them on running VMs.
+// The returned VM carries each volume's Target.
+type VolumeAttacher interface {
+	AttachVolume(ctx context.Context, ref string, disk *types.StorageConfig) (*types.VM, error)
+	DetachVolume(ctx context.Context, ref, volumeID string) (*types.VM, error)
+}
+
+// DiskResizer is an optional interface for hypervisors that can grow a
+// stopped VM's root disk, filesystem included where the host can reach it.
+type DiskResizer interface {
+	ResizeDisk(ctx context.Context, ref string, size int64) (*types.VM, error)
+}
+
+// DiskCompactor is an optional interface for hypervisors that can return
+// the space a stopped VM's root disk no longer uses to the host. It
+// returns the bytes freed.
+type DiskCompactor interface {
+	CompactDisk(ctx context.Context, ref string) (int64, error)
+}
+
+// DiskUsageReporter is an optional interface for hypervisors that can tell
+// the host space allocated to VMs' root disks, not their virtual size. It
+// stats the disks, so callers ask only when the figure is wanted; IDs
+// without a VM are left out.
+type DiskUsageReporter interface {
+	DiskUsage(ctx context.Context, ids []string) (map[string]int64, error)
+}
+
+// DiskSnapshotter is an optional interface for hypervisors that keep save
+// points of a stopped VM's root disk. The returned VM lists them.
+type DiskSnapshotter interface {
+	SnapshotDisk(ctx context.Context, ref, name string) (*types.VM, error)
+	RevertDisk(ctx context.Context, ref, name string) (*types.VM, error)
+	DeleteDiskSnapshot(ctx context.Context, ref, name string) (*types.VM, error)
+}
+
+// DiskServer is an optional interface for hypervisors that can export a
+// stopped VM's root disk over NBD for inspection from the host. ServeDisk
+// blocks until ctx is done, calling ready with the export's NBD URI once
+// clients can connect; the VM cannot start meanwhile.
+type DiskServer interface {
+	ServeDisk(ctx context.Context, ref string, opts DiskServeOptions, ready func(uri string)) error
+}
+
+// DiskServeOptions configures a DiskServer export. Exports are read-only
+// unless Writable, and TCP ones off the loopback need TLSCreds.
+type DiskServeOptions struct {
+	Listen   string // "host:port" to serve over TCP; empty = a unix socket in the VM's run dir
+	Writable bool   // accept client writes
+	TLSCreds string // directory of x509 server credentials (ca-cert.pem, server-cert.pem, server-key.pem)
+}
+
+// Backuper is an optional interface for hypervisors that can export a
+// stopped VM as a self-contained archive (see BackupManifest) written to w,
+// and create a VM from one. RestoreBackup reads the files following the
+// manifest m from tr.
+type Backuper interface {
+	Backup(ctx context.Context, ref string, w io.Writer) error
+	RestoreBackup(ctx context.Context, vmID string, vmCfg *types.VMConfig, networkConfigs []*types.NetworkConfig, m *BackupManifest, tr *tar.Reader) (*types.VM, error)
+}
+
+// HealthRecorder is an optional interface for hypervisors that persist
+// daemon health check results on the VM record.
+type HealthRecorder interface {
+	SetHealth(ctx context.Context, ref string, health *types.Health) error
+}
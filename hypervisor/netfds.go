@@ -0,0 +1,96 @@
+package hypervisor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// firstExtraFD is the fd the first of a child's ExtraFiles gets.
+const firstExtraFD = 3
+
+// HasMacvtap reports whether any NIC in ncs is a macvtap link.
+func HasMacvtap(ncs []*types.NetworkConfig) bool {
+	for _, nc := range ncs {
+		if nc != nil && nc.Macvtap != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasColdBootNIC reports whether any NIC in ncs only works on a cold boot:
+// macvtap queue fds are handed over at launch, VFIO devices cannot be
+// snapshotted, and a vhost-user backend's state lives in passt. Such VMs
+// cannot be saved and restored.
+func HasColdBootNIC(ncs []*types.NetworkConfig) bool {
+	for _, nc := range ncs {
+		if nc != nil && (nc.Macvtap != "" || nc.VFIODevice != "" || nc.UserSocket != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// NetnsPath returns the network namespace the VMM starts in to reach the
+// NICs' host devices, or "" when there is none: no NICs, or usermode NICs
+// served over a passt socket.
+func NetnsPath(ncs []*types.NetworkConfig) string {
+	for _, nc := range ncs {
+		if nc != nil && nc.NetnsPath != "" {
+			return nc.NetnsPath
+		}
+	}
+	return ""
+}
+
+// MacvtapFDs returns, per NIC, the fds its macvtap queues get in a child
+// started with OpenMacvtapQueues(ncs) as ExtraFiles; nil for tap NICs.
+func MacvtapFDs(ncs []*types.NetworkConfig) [][]int {
+	out := make([][]int, len(ncs))
+	next := firstExtraFD
+	for i, nc := range ncs {
+		if nc == nil || nc.Macvtap == "" {
+			continue
+		}
+		for range macvtapQueues(nc) {
+			out[i] = append(out[i], next)
+			next++
+		}
+	}
+	return out
+}
+
+// OpenMacvtapQueues opens the queues of every macvtap NIC in ncs, in the
+// order MacvtapFDs numbers them. The caller closes the files once the
+// child has started.
+func OpenMacvtapQueues(ncs []*types.NetworkConfig) ([]*os.File, error) {
+	var files []*os.File
+	for _, nc := range ncs {
+		if nc == nil || nc.Macvtap == "" {
+			continue
+		}
+		queues, err := utils.OpenMacvtap(nc.Macvtap, macvtapQueues(nc))
+		if err != nil {
+			CloseFiles(files)
+			return nil, fmt.Errorf("NIC %s: %w", nc.Mac, err)
+		}
+		files = append(files, queues...)
+	}
+	return files, nil
+}
+
+// CloseFiles closes every file in files.
+func CloseFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// macvtapQueues is the number of queue pairs of nc: NumQueues counts RX
+// and TX queues, and each open of the macvtap device is one pair.
+func macvtapQueues(nc *types.NetworkConfig) int {
+	return max(1, nc.NumQueues/2) //nolint:mnd
+}
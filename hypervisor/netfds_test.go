@@ -0,0 +1,23 @@
+package hypervisor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestMacvtapFDs(t *testing.T) {
+	ncs := []*types.NetworkConfig{
+		{Tap: "tap0", NumQueues: 4},
+		{Macvtap: "mvt1", NumQueues: 4},
+		{Macvtap: "mvt2", NumQueues: 1},
+	}
+	want := [][]int{nil, {3, 4}, {5}}
+	if got := MacvtapFDs(ncs); !reflect.DeepEqual(got, want) {
+		t.Errorf("MacvtapFDs = %v, want %v", got, want)
+	}
+	if !HasMacvtap(ncs) || HasMacvtap(ncs[:1]) {
+		t.Error("HasMacvtap mismatch")
+	}
+}
@@ -0,0 +1,42 @@
+package hypervisor
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// runDirPerm opens run directories to vm_socket_group for traversal and
+// listing only; the sockets inside carry their own mode.
+const runDirPerm os.FileMode = 0o750
+
+// SecureRuntime applies vm_socket_group and vm_socket_mode to a launched
+// VM's control endpoints (API socket, console socket or PTY). Endpoints the
+// VMM has not created are skipped. With a group set, dirs — the run
+// directories leading to the endpoints, outermost first — are handed to
+// the group as well so its members can reach them.
+func SecureRuntime(conf *config.Config, dirs []string, endpoints ...string) error {
+	gid, err := conf.VMSocketGID()
+	if err != nil {
+		return err
+	}
+	perm, err := conf.VMSocketPerm()
+	if err != nil {
+		return err
+	}
+	if gid >= 0 {
+		for _, dir := range dirs {
+			if err := utils.EnforcePerm(dir, gid, runDirPerm); err != nil {
+				return fmt.Errorf("secure run dir: %w", err)
+			}
+		}
+	}
+	for _, p := range endpoints {
+		if err := utils.EnforcePerm(p, gid, perm); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("secure %s: %w", p, err)
+		}
+	}
+	return nil
+}
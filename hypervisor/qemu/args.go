@@ -0,0 +1,163 @@
+package qemu
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+const (
+	// minBalloonMemory matches the cloud-hypervisor backend: smaller guests
+	// get no balloon device.
+	minBalloonMemory = 256 << 20
+	// defaultBalloon is the memory divisor for the initial balloon size
+	// (25% of guest memory), mirroring the cloud-hypervisor backend.
+	defaultBalloon = 4
+)
+
+// buildArgs converts a VM record into qemu-system arguments. Direct-boot
+// (OCI) VMs get a virtio console so the kernel's console=hvc0 works; UEFI
+// (cloudimg) VMs get a serial port. Both are exposed on console.sock.
+// vhostNet moves tap NICs' datapath into the kernel's vhost-net; a
+// non-empty seed is set as the SMBIOS serial number for cloud-init.
+func buildArgs(rec *hypervisor.VMRecord, firmware, seed string, vhostNet bool) []string {
+	runDir := rec.RunDir
+	cpu := min(rec.Config.CPU, runtime.NumCPU())
+	directBoot := isDirectBoot(rec.BootConfig)
+
+	args := []string{
+		"-name", qemuEscape(rec.Config.Name),
+		"-machine", machineType(),
+		"-cpu", "host",
+		"-smp", smp(cpu, rec.Config.MaxCPU),
+		"-m", fmt.Sprintf("%dM", rec.Config.Memory>>20), //nolint:mnd
+		"-nodefaults", "-no-user-config", "-display", "none",
+		"-qmp", "unix:" + qemuEscape(qmpSockPath(runDir)) + ",server=on,wait=off",
+		"-chardev", "socket,id=console,path=" + qemuEscape(consoleSockPath(runDir)) + ",server=on,wait=off",
+		"-object", "rng-random,id=rng0,filename=/dev/urandom",
+		"-device", "virtio-rng-pci,rng=rng0",
+	}
+
+	if directBoot {
+		boot := rec.BootConfig
+		args = append(args,
+			"-device", "virtio-serial-pci",
+			"-device", "virtconsole,chardev=console",
+			"-kernel", boot.KernelPath,
+		)
+		if boot.InitrdPath != "" {
+			args = append(args, "-initrd", boot.InitrdPath)
+		}
+		args = append(args, "-append", boot.Cmdline)
+	} else {
+		args = append(args, "-serial", "chardev:console", "-bios", firmware)
+	}
+	if seed != "" {
+		args = append(args, "-smbios", "type=1,serial="+qemuEscape(seed))
+	}
+
+	if rec.Config.Memory >= minBalloonMemory {
+		args = append(args, "-device", "virtio-balloon-pci,id=balloon0,deflate-on-oom=on,free-page-reporting=on")
+	}
+
+	for i, sc := range rec.StorageConfigs {
+		if rec.FirstBooted && !directBoot && isCidataDisk(sc) {
+			continue
+		}
+		drive, device := diskArgs(i, sc, cpu)
+		args = append(args, "-drive", drive, "-device", device)
+	}
+
+	fds := hypervisor.MacvtapFDs(rec.NetworkConfigs)
+	for i, nc := range rec.NetworkConfigs {
+		if nc.VFIODevice != "" {
+			args = append(args, "-device", "vfio-pci,host="+filepath.Base(nc.VFIODevice))
+			continue
+		}
+		netdev, device := netArgs(i, nc, fds[i], vhostNet)
+		args = append(args, "-netdev", netdev, "-device", device)
+	}
+	return args
+}
+
+func diskArgs(i int, sc *types.StorageConfig, cpu int) (drive, device string) {
+	format := "raw"
+	if filepath.Ext(sc.Path) == ".qcow2" {
+		format = "qcow2"
+	}
+	drive = fmt.Sprintf("file=%s,if=none,id=disk%d,format=%s,cache=writeback", qemuEscape(sc.Path), i, format)
+	if sc.RO {
+		drive += ",readonly=on"
+	} else {
+		drive += ",discard=unmap"
+	}
+	device = fmt.Sprintf("virtio-blk-pci,drive=disk%d,num-queues=%d", i, cpu)
+	if sc.Serial != "" {
+		device += ",serial=" + qemuEscape(sc.Serial)
+	}
+	return drive, device
+}
+
+// netArgs builds NIC i's netdev and device. fds, set for a macvtap NIC,
+// are its inherited queue fds; QEMU derives the queue count from them. A
+// usermode NIC connects to its passt socket instead.
+func netArgs(i int, nc *types.NetworkConfig, fds []int, vhostNet bool) (netdev, device string) {
+	device = fmt.Sprintf("virtio-net-pci,netdev=net%d,mac=%s", i, nc.Mac)
+	if nc.UserSocket != "" {
+		// passt serves a single queue pair over its stream socket.
+		return fmt.Sprintf("stream,id=net%d,server=off,addr.type=unix,addr.path=%s", i, qemuEscape(nc.UserSocket)), device
+	}
+	netdev = fmt.Sprintf("tap,id=net%d,ifname=%s,script=no,downscript=no", i, nc.Tap)
+	if len(fds) > 0 {
+		strs := make([]string, len(fds))
+		for j, fd := range fds {
+			strs[j] = strconv.Itoa(fd)
+		}
+		netdev = fmt.Sprintf("tap,id=net%d,fds=%s", i, strings.Join(strs, ":"))
+	}
+	if vhostNet {
+		netdev += ",vhost=on"
+	}
+	// NumQueues counts RX and TX queues, QEMU counts queue pairs.
+	if pairs := nc.NumQueues / 2; pairs > 1 { //nolint:mnd
+		if len(fds) == 0 {
+			netdev += fmt.Sprintf(",queues=%d", pairs)
+		}
+		device += fmt.Sprintf(",mq=on,vectors=%d", 2*pairs+2) //nolint:mnd
+	}
+	return netdev, device
+}
+
+// smp returns the -smp value: cpu boot vCPUs, plus a hotplug ceiling when
+// maxCPU is set.
+func smp(cpu, maxCPU int) string {
+	if maxCPU <= 0 {
+		return strconv.Itoa(cpu)
+	}
+	return fmt.Sprintf("%d,maxcpus=%d", cpu, maxCPU)
+}
+
+func machineType() string {
+	if runtime.GOARCH == "arm64" {
+		return "virt,accel=kvm,gic-version=host"
+	}
+	return "q35,accel=kvm"
+}
+
+// qemuEscape doubles commas, QEMU's escape inside option values.
+func qemuEscape(s string) string { return strings.ReplaceAll(s, ",", ",,") }
+
+func isCidataDisk(sc *types.StorageConfig) bool {
+	return filepath.Base(sc.Path) == cidataFile
+}
+
+// isDirectBoot returns true when the VM boots a kernel directly (OCI
+// images). False means UEFI boot (cloudimg).
+func isDirectBoot(boot *types.BootConfig) bool {
+	return boot != nil && boot.KernelPath != ""
+}
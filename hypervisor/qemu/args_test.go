@@ -0,0 +1,134 @@
+package qemu
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// argValues returns every value following flag in args.
+func argValues(args []string, flag string) []string {
+	var vals []string
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			vals = append(vals, args[i+1])
+		}
+	}
+	return vals
+}
+
+func TestBuildArgsDirectBoot(t *testing.T) {
+	rec := &hypervisor.VMRecord{
+		VM: types.VM{
+			Config: types.VMConfig{Name: "web", CPU: 1, Memory: 512 << 20},
+			StorageConfigs: []*types.StorageConfig{
+				{Path: "/blobs/abc.erofs", RO: true, Serial: "layer0"},
+				{Path: "/run/vm/cow.raw", Serial: "cocoon-cow"},
+			},
+			NetworkConfigs: []*types.NetworkConfig{{Tap: "tap0", Mac: "aa:bb:cc:dd:ee:ff", NumQueues: 4}},
+		},
+		BootConfig: &types.BootConfig{KernelPath: "/boot/vmlinuz", InitrdPath: "/boot/initrd", Cmdline: "console=hvc0"},
+		RunDir:     "/run/vm",
+	}
+	args := buildArgs(rec, "/fw/OVMF.fd", "", true)
+
+	if got := argValues(args, "-kernel"); !slices.Equal(got, []string{"/boot/vmlinuz"}) {
+		t.Errorf("-kernel = %v", got)
+	}
+	if got := argValues(args, "-append"); !slices.Equal(got, []string{"console=hvc0"}) {
+		t.Errorf("-append = %v", got)
+	}
+	if slices.Contains(args, "-bios") {
+		t.Error("direct boot must not pass -bios")
+	}
+	devices := argValues(args, "-device")
+	if !slices.Contains(devices, "virtconsole,chardev=console") {
+		t.Errorf("missing virtio console in %v", devices)
+	}
+	if !slices.Contains(devices, "virtio-balloon-pci,id=balloon0,deflate-on-oom=on,free-page-reporting=on") {
+		t.Errorf("missing balloon in %v", devices)
+	}
+
+	drives := argValues(args, "-drive")
+	if len(drives) != 2 {
+		t.Fatalf("drives = %v, want 2", drives)
+	}
+	if !strings.Contains(drives[0], "format=raw") || !strings.Contains(drives[0], "readonly=on") {
+		t.Errorf("layer drive = %q", drives[0])
+	}
+	if !slices.Contains(devices, "virtio-blk-pci,drive=disk1,num-queues=1,serial=cocoon-cow") {
+		t.Errorf("missing COW device in %v", devices)
+	}
+
+	if got := argValues(args, "-netdev"); !slices.Equal(got, []string{"tap,id=net0,ifname=tap0,script=no,downscript=no,vhost=on,queues=2"}) {
+		t.Errorf("-netdev = %v", got)
+	}
+	if !slices.Contains(devices, "virtio-net-pci,netdev=net0,mac=aa:bb:cc:dd:ee:ff,mq=on,vectors=6") {
+		t.Errorf("missing net device in %v", devices)
+	}
+}
+
+func TestBuildArgsUEFI(t *testing.T) {
+	rec := &hypervisor.VMRecord{
+		VM: types.VM{
+			Config: types.VMConfig{Name: "db", CPU: 1, Memory: 128 << 20},
+			StorageConfigs: []*types.StorageConfig{
+				{Path: "/run/vm/overlay.qcow2"},
+				{Path: "/run/vm/cidata.img", RO: true},
+			},
+			FirstBooted: true,
+		},
+		RunDir: "/run/vm",
+	}
+	args := buildArgs(rec, "/fw/OVMF.fd", "ds=nocloud;s=http://10.88.0.1:8775/", false)
+
+	if got := argValues(args, "-bios"); !slices.Equal(got, []string{"/fw/OVMF.fd"}) {
+		t.Errorf("-bios = %v", got)
+	}
+	if got := argValues(args, "-smbios"); !slices.Equal(got, []string{"type=1,serial=ds=nocloud;s=http://10.88.0.1:8775/"}) {
+		t.Errorf("-smbios = %v", got)
+	}
+	if got := argValues(args, "-serial"); !slices.Equal(got, []string{"chardev:console"}) {
+		t.Errorf("-serial = %v", got)
+	}
+	drives := argValues(args, "-drive")
+	if len(drives) != 1 || !strings.Contains(drives[0], "format=qcow2") {
+		t.Errorf("drives = %v, want only the qcow2 overlay after first boot", drives)
+	}
+	for _, d := range argValues(args, "-device") {
+		if strings.HasPrefix(d, "virtio-balloon") {
+			t.Errorf("unexpected balloon for 128 MiB guest: %q", d)
+		}
+	}
+}
+
+func TestNetArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		nc       *types.NetworkConfig
+		fds      []int
+		vhostNet bool
+		want     string
+	}{
+		{"tap", &types.NetworkConfig{Tap: "tap0", NumQueues: 4}, nil, true, "tap,id=net0,ifname=tap0,script=no,downscript=no,vhost=on,queues=2"},
+		{"tap without vhost-net", &types.NetworkConfig{Tap: "tap0", NumQueues: 2}, nil, false, "tap,id=net0,ifname=tap0,script=no,downscript=no"},
+		{"macvtap", &types.NetworkConfig{Macvtap: "mvt0", NumQueues: 4}, []int{3, 4}, true, "tap,id=net0,fds=3:4,vhost=on"},
+		{"usermode", &types.NetworkConfig{UserSocket: "/run/passt.sock", NumQueues: 2}, nil, true, "stream,id=net0,server=off,addr.type=unix,addr.path=/run/passt.sock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := netArgs(0, tt.nc, tt.fds, tt.vhostNet); got != tt.want {
+				t.Errorf("netdev = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQEMUEscape(t *testing.T) {
+	if got := qemuEscape("/a,b/c"); got != "/a,,b/c" {
+		t.Errorf("qemuEscape = %q", got)
+	}
+}
@@ -0,0 +1,96 @@
+package qemu
+
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	defaultSocketWaitTimeout    = 5 * time.Second
+	defaultTerminateGracePeriod = 5 * time.Second
+)
+
+// Config holds QEMU specific configuration, embedding the global config.
+type Config struct {
+	*config.Config
+}
+
+// EnsureDirs creates all static directories required by the QEMU backend.
+func (c *Config) EnsureDirs() error {
+	return utils.EnsureDirs(
+		c.dbDir(),
+		c.RunDir(),
+		c.LogDir(),
+	)
+}
+
+// Binary returns the QEMU system emulator for the host architecture unless
+// qemu_binary overrides it.
+func (c *Config) Binary() string {
+	if c.QEMUBinary != "" {
+		return c.QEMUBinary
+	}
+	if runtime.GOARCH == "arm64" {
+		return "qemu-system-aarch64"
+	}
+	return "qemu-system-x86_64"
+}
+
+// Firmware returns the UEFI firmware used for cloud images.
+func (c *Config) Firmware() string { return c.QEMUFirmware }
+
+// RunDir returns the top-level QEMU runtime directory.
+func (c *Config) RunDir() string { return filepath.Join(c.Config.RunDir, "qemu") }
+
+// LogDir returns the top-level QEMU log directory.
+func (c *Config) LogDir() string { return filepath.Join(c.Config.LogDir, "qemu") }
+
+// IndexFile returns the VM index store path.
+func (c *Config) IndexFile() string { return filepath.Join(c.dbDir(), "vms.json") }
+
+// IndexLock returns the VM index lock path.
+func (c *Config) IndexLock() string { return filepath.Join(c.dbDir(), "vms.lock") }
+
+// VMRunDir returns the per-VM runtime directory.
+func (c *Config) VMRunDir(vmID string) string { return filepath.Join(c.RunDir(), vmID) }
+
+// VMLogDir returns the per-VM log directory.
+func (c *Config) VMLogDir(vmID string) string { return filepath.Join(c.LogDir(), vmID) }
+
+// COWRawPath returns the path for the OCI COW raw disk.
+func (c *Config) COWRawPath(vmID string) string {
+	return filepath.Join(c.VMRunDir(vmID), "cow.raw")
+}
+
+// OverlayPath returns the path for the cloudimg qcow2 overlay.
+func (c *Config) OverlayPath(vmID string) string {
+	return filepath.Join(c.VMRunDir(vmID), "overlay.qcow2")
+}
+
+// CidataPath returns the path for the cloud-init NoCloud cidata disk.
+func (c *Config) CidataPath(vmID string) string {
+	return filepath.Join(c.VMRunDir(vmID), cidataFile)
+}
+
+// SocketWaitTimeout returns the configured QMP socket wait timeout or the default.
+func (c *Config) SocketWaitTimeout() time.Duration {
+	if c.SocketWaitTimeoutSeconds > 0 {
+		return time.Duration(c.SocketWaitTimeoutSeconds) * time.Second
+	}
+	return defaultSocketWaitTimeout
+}
+
+// TerminateGracePeriod returns the configured SIGTERM→SIGKILL grace period or the default.
+func (c *Config) TerminateGracePeriod() time.Duration {
+	if c.TerminateGracePeriodSeconds > 0 {
+		return time.Duration(c.TerminateGracePeriodSeconds) * time.Second
+	}
+	return defaultTerminateGracePeriod
+}
+
+func (c *Config) dir() string   { return filepath.Join(c.RootDir, "qemu") }
+func (c *Config) dbDir() string { return filepath.Join(c.dir(), "db") }
@@ -0,0 +1,74 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Console connects to the VM's console socket: the virtio console for
+// direct-boot VMs, the serial port for UEFI VMs. The caller closes it.
+func (q *QEMU) Console(ctx context.Context, ref string) (io.ReadWriteCloser, error) {
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn io.ReadWriteCloser
+	if err := q.withRunningVM(ctx, &rec, func(_ int) error {
+		path := consoleSockPath(rec.RunDir)
+		c, dialErr := (&net.Dialer{}).DialContext(ctx, "unix", path)
+		if dialErr != nil {
+			return fmt.Errorf("connect to console socket %s: %w", path, dialErr)
+		}
+		conn = c
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("console %s: %w", id, err)
+	}
+	return conn, nil
+}
+
+// LogFile returns the path of the VM's QEMU process log (stdout and stderr
+// of the last launch) or the boot probe's console capture. QEMU VMs have
+// no serial or console files.
+func (q *QEMU) LogFile(ctx context.Context, ref string, source types.LogSource) (string, error) {
+	name := processLogName
+	switch source {
+	case "", types.LogProcess:
+	case types.LogBoot:
+		name = hypervisor.BootLogName
+	case types.LogSerial, types.LogConsole:
+		return "", unsupported(string(source) + " logs")
+	default:
+		return "", source.Validate()
+	}
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(rec.LogDir, name), nil
+}
+
+// TakeRootPassword implements hypervisor.Hypervisor.
+func (q *QEMU) TakeRootPassword(ctx context.Context, ref string) (string, error) {
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return cloudhypervisor.TakeRootPassword(ctx, q.store, q.keys, id)
+}
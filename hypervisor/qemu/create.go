@@ -0,0 +1,203 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Create registers a new VM, prepares the COW disk (and cidata for cloud
+// images), and persists the record in Created state. The disk layout and
+// kernel cmdline match the cloud-hypervisor backend, so the same OCI and
+// cloud images boot unchanged.
+func (q *QEMU) Create(ctx context.Context, id string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, bootCfg *types.BootConfig) (_ *types.VM, err error) {
+	if vmCfg.CPUSet != "" {
+		return nil, unsupported("--cpuset")
+	}
+	if vmCfg.NUMA != nil {
+		return nil, unsupported("--numa-nodes")
+	}
+	if vmCfg.Confidential != "" {
+		return nil, unsupported("--confidential")
+	}
+	if vmCfg.TPM {
+		return nil, unsupported("--tpm")
+	}
+	if vmCfg.Encrypt {
+		return nil, unsupported("--encrypt")
+	}
+	if vmCfg.Pool != "" {
+		return nil, unsupported("--pool")
+	}
+	if vmCfg.DataDir != "" {
+		return nil, unsupported("--data-dir")
+	}
+	if vmCfg.ReadOnly {
+		return nil, unsupported("--read-only")
+	}
+	if !vmCfg.Prealloc.Sparse() {
+		return nil, unsupported("--prealloc")
+	}
+	if vmCfg.Swap > 0 {
+		return nil, unsupported("--swap")
+	}
+	if vmCfg.EphemeralDisk > 0 {
+		return nil, unsupported("--ephemeral-disk")
+	}
+	if vmCfg.DiskBackend.VhostUser() {
+		return nil, unsupported("--disk-backend")
+	}
+	if vmCfg.DiskThrottled() {
+		return nil, unsupported("--disk-iops/--disk-bandwidth")
+	}
+	if vmCfg.CHBinary != "" {
+		return nil, unsupported("--ch-binary")
+	}
+	if vmCfg.Serial != "" || vmCfg.Console != "" {
+		return nil, unsupported("--serial/--console")
+	}
+	if vmCfg.PmemLayers {
+		return nil, unsupported("--pmem-layers")
+	}
+	if vmCfg.HugePages.Required() {
+		return nil, unsupported("--hugepages " + string(vmCfg.HugePages))
+	}
+	if vmCfg.UsesCloudInit() && isDirectBoot(bootCfg) {
+		return nil, fmt.Errorf("--user-data, --ssh-key, --run-cmd and --metadata-format require a cloud image; OCI images do not run cloud-init")
+	}
+	if vmCfg.HasGuestFiles() && isDirectBoot(bootCfg) && bootCfg.InitrdPath == "" {
+		return nil, fmt.Errorf("--copy-in and --env require an OCI image booting with an initrd")
+	}
+	now := time.Now()
+	runDir := q.conf.VMRunDir(id)
+	logDir := q.conf.VMLogDir(id)
+	var rootPassword []byte // sealed, for the record
+
+	storageConfigs, volumes := hypervisor.SplitVolumes(storageConfigs)
+	blobIDs := cloudhypervisor.ExtractBlobIDs(storageConfigs, bootCfg)
+
+	defer func() {
+		if err != nil {
+			_ = removeVMDirs(runDir, logDir)
+			cloudhypervisor.DeleteRootPasswordKey(ctx, q.keys, id, rootPassword)
+			q.rollbackCreate(ctx, id, vmCfg.Name)
+		}
+	}()
+
+	if err = q.reserveVM(ctx, id, vmCfg, blobIDs, runDir, logDir); err != nil {
+		return nil, fmt.Errorf("reserve VM record: %w", err)
+	}
+	if err = utils.EnsureDirs(runDir, logDir); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	if err = cloudhypervisor.StoreGuestFiles(runDir, vmCfg); err != nil {
+		return nil, err
+	}
+
+	var bootCopy *types.BootConfig
+	if bootCfg != nil {
+		b := *bootCfg
+		bootCopy = &b
+	}
+
+	var preparedStorage []*types.StorageConfig
+	if isDirectBoot(bootCopy) {
+		preparedStorage, err = q.prepareOCI(ctx, id, vmCfg, storageConfigs, networkConfigs, bootCopy)
+	} else {
+		// Before the cidata, which carries the password's hash.
+		if rootPassword, err = cloudhypervisor.SetRootPassword(ctx, q.conf.Config, q.keys, id, vmCfg); err != nil {
+			return nil, err
+		}
+		preparedStorage, err = q.prepareCloudimg(ctx, id, vmCfg, storageConfigs, networkConfigs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if preparedStorage, err = hypervisor.AttachVolumes(preparedStorage, volumes, isCidataDisk); err != nil {
+		return nil, err
+	}
+
+	info := types.VM{
+		ID: id, State: types.VMStateCreated,
+		Config:         *vmCfg,
+		StorageConfigs: preparedStorage,
+		NetworkConfigs: networkConfigs,
+		CreatedAt:      now, UpdatedAt: now,
+	}
+	rec := hypervisor.VMRecord{
+		VM:           info,
+		BootConfig:   bootCopy,
+		ImageBlobIDs: blobIDs,
+		RunDir:       runDir,
+		LogDir:       logDir,
+		RootPassword: rootPassword,
+	}
+	if err := q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		idx.VMs[id] = &rec
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("finalize VM record: %w", err)
+	}
+
+	q.recordEvent(ctx, types.EventCreated, id, vmCfg.Name, "image "+vmCfg.Image)
+	return &info, nil
+}
+
+// prepareOCI creates a raw ext4 COW disk and builds the kernel cmdline.
+func (q *QEMU) prepareOCI(ctx context.Context, vmID string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig, boot *types.BootConfig) ([]*types.StorageConfig, error) {
+	cowPath := q.conf.COWRawPath(vmID)
+	if err := cloudhypervisor.CreateRawCOW(ctx, cowPath, vmCfg.Storage, vmCfg.Prealloc); err != nil {
+		return nil, err
+	}
+
+	storageConfigs = append(storageConfigs, &types.StorageConfig{
+		Path:   cowPath,
+		RO:     false,
+		Serial: cloudhypervisor.CowSerial,
+	})
+
+	dns, err := q.conf.DNSServers()
+	if err != nil {
+		return nil, fmt.Errorf("parse DNS servers: %w", err)
+	}
+	boot.Cmdline = cloudhypervisor.BuildCmdline(storageConfigs, networkConfigs, vmCfg, dns)
+	return storageConfigs, nil
+}
+
+// prepareCloudimg creates a qcow2 overlay backed by the base image blob and
+// the cidata disk. QEMU always follows qcow2 backing chains.
+func (q *QEMU) prepareCloudimg(ctx context.Context, vmID string, vmCfg *types.VMConfig, storageConfigs []*types.StorageConfig, networkConfigs []*types.NetworkConfig) ([]*types.StorageConfig, error) {
+	if len(storageConfigs) == 0 {
+		return nil, fmt.Errorf("cloudimg: no base image StorageConfig")
+	}
+	basePath := storageConfigs[0].Path
+	overlayPath := q.conf.OverlayPath(vmID)
+
+	if out, err := exec.CommandContext(ctx, //nolint:gosec
+		"qemu-img", "create", "-f", "qcow2", "-F", "qcow2",
+		"-b", basePath, overlayPath,
+	).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("qemu-img create overlay: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	if vmCfg.Storage > 0 {
+		if err := cloudhypervisor.ExpandImage(ctx, overlayPath, vmCfg.Storage, false); err != nil {
+			return nil, fmt.Errorf("expand overlay: %w", err)
+		}
+	}
+
+	cidataPath := q.conf.CidataPath(vmID)
+	if err := cloudhypervisor.GenerateCidata(ctx, cidataPath, q.conf.Config, vmID, vmCfg, networkConfigs); err != nil {
+		return nil, err
+	}
+	return []*types.StorageConfig{
+		{Path: overlayPath, RO: false},
+		{Path: cidataPath, RO: true},
+	}, nil
+}
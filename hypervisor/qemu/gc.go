@@ -0,0 +1,124 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const creatingStateGCGrace = 24 * time.Hour
+
+type qemuSnapshot struct {
+	blobIDs     map[string]struct{} // union of all VMs' ImageBlobIDs
+	vmIDs       map[string]struct{} // all VM IDs in the DB
+	staleCreate []string            // IDs in stale "creating" state (crash remnants)
+	runDirs     []string            // subdirectory names under the QEMU run dir
+	logDirs     []string            // subdirectory names under the QEMU log dir
+}
+
+func (s qemuSnapshot) UsedBlobIDs() map[string]struct{} { return s.blobIDs }
+func (s qemuSnapshot) ActiveVMIDs() map[string]struct{} { return s.vmIDs }
+
+// GCModule returns the GC module for cross-module blob pinning and orphan cleanup.
+func (q *QEMU) GCModule() gc.Module[qemuSnapshot] {
+	return gc.Module[qemuSnapshot]{
+		Name:   typ,
+		Locker: q.locker,
+		ReadDB: func(_ context.Context) (qemuSnapshot, error) {
+			var snap qemuSnapshot
+			cutoff := time.Now().Add(-creatingStateGCGrace)
+			if err := q.store.ReadRaw(func(idx *hypervisor.VMIndex) error {
+				snap.blobIDs = make(map[string]struct{})
+				snap.vmIDs = make(map[string]struct{})
+				for id, rec := range idx.VMs {
+					if rec == nil {
+						continue
+					}
+					snap.vmIDs[id] = struct{}{}
+					for hex := range rec.ImageBlobIDs {
+						snap.blobIDs[hex] = struct{}{}
+					}
+					if rec.State == types.VMStateCreating && rec.UpdatedAt.Before(cutoff) {
+						snap.staleCreate = append(snap.staleCreate, id)
+					}
+				}
+				return nil
+			}); err != nil {
+				return snap, err
+			}
+			var err error
+			if snap.runDirs, err = utils.ScanSubdirs(q.conf.RunDir()); err != nil {
+				return snap, err
+			}
+			if snap.logDirs, err = utils.ScanSubdirs(q.conf.LogDir()); err != nil {
+				return snap, err
+			}
+			return snap, nil
+		},
+		Resolve: func(snap qemuSnapshot, _ map[string]any) []string {
+			reserved := map[string]struct{}{"db": {}, cloudhypervisor.TemplateDirName: {}}
+			runOrphans := utils.FilterUnreferenced(snap.runDirs, snap.vmIDs, reserved)
+			logOrphans := utils.FilterUnreferenced(snap.logDirs, snap.vmIDs, reserved)
+			candidates := slices.Concat(runOrphans, logOrphans, snap.staleCreate)
+			slices.Sort(candidates)
+			return slices.Compact(candidates)
+		},
+		Collect: func(ctx context.Context, ids []string) error {
+			var errs []error
+			for _, id := range ids {
+				runDir, logDir := q.conf.VMRunDir(id), q.conf.VMLogDir(id)
+				if rec, loadErr := q.loadRecord(ctx, id); loadErr == nil {
+					runDir, logDir = rec.RunDir, rec.LogDir
+				}
+				if err := removeVMDirs(runDir, logDir); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				q.recordEvent(ctx, types.EventGCRemoved, id, "", "")
+			}
+			if err := q.cleanStalePlaceholders(ids); err != nil {
+				errs = append(errs, err)
+			}
+			return errors.Join(errs...)
+		},
+		Usage: func(snap qemuSnapshot, ids []string) ([]gc.Usage, error) {
+			var vmDirs []string
+			for _, d := range snap.runDirs {
+				if d != "db" {
+					vmDirs = append(vmDirs, filepath.Join(q.conf.RunDir(), d))
+				}
+			}
+			return cloudhypervisor.VMDirUsage(vmDirs, q.conf.LogDir(), utils.SetOf(ids))
+		},
+	}
+}
+
+// RegisterGC registers the QEMU GC module with the given Orchestrator.
+func (q *QEMU) RegisterGC(orch *gc.Orchestrator) {
+	gc.Register(orch, q.GCModule())
+}
+
+// cleanStalePlaceholders removes selected DB records stuck in stale "creating" state.
+func (q *QEMU) cleanStalePlaceholders(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-creatingStateGCGrace)
+	return q.store.WriteRaw(func(idx *hypervisor.VMIndex) error {
+		utils.CleanStaleRecords(idx.VMs, idx.Names, ids,
+			func(r *hypervisor.VMRecord) string { return r.Config.Name },
+			func(r *hypervisor.VMRecord) bool {
+				return r.State == types.VMStateCreating && r.UpdatedAt.Before(cutoff)
+			},
+		)
+		return nil
+	})
+}
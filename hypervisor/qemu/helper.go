@@ -0,0 +1,231 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	qmpSockName     = "qmp.sock"
+	pidFileName     = "qemu.pid"
+	cmdlineFileName = "cmdline"
+	consoleSockName = "console.sock"
+	processLogName  = "qemu.log"
+	cidataFile      = "cidata.img"
+)
+
+var runtimeFiles = []string{qmpSockName, pidFileName, cmdlineFileName, consoleSockName, cloudhypervisor.BootInitrdName}
+
+// qmpSockPath returns the QMP socket path under a VM's run directory.
+func qmpSockPath(runDir string) string { return filepath.Join(runDir, qmpSockName) }
+
+// pidFile returns the PID file path under a VM's run directory.
+func pidFile(runDir string) string { return filepath.Join(runDir, pidFileName) }
+
+// consoleSockPath returns the console socket path under a VM's run directory.
+func consoleSockPath(runDir string) string { return filepath.Join(runDir, consoleSockName) }
+
+// hasTapNIC reports whether any NIC is backed by a tap or macvtap device,
+// the NICs vhost-net accelerates.
+func hasTapNIC(ncs []*types.NetworkConfig) bool {
+	for _, nc := range ncs {
+		if nc != nil && nc.VFIODevice == "" && nc.UserSocket == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func toVM(rec *hypervisor.VMRecord) *types.VM {
+	info := rec.VM // value copy — detached from the DB record
+	if info.State == types.VMStateRunning {
+		info.SocketPath = qmpSockPath(rec.RunDir)
+		info.PID, _ = utils.ReadPIDFile(pidFile(rec.RunDir))
+	}
+	return &info
+}
+
+// rootDiskUsage returns the host space allocated to a VM's COW or
+// overlay; 0 when the disk is missing.
+func (q *QEMU) rootDiskUsage(rec *hypervisor.VMRecord) int64 {
+	path := q.conf.OverlayPath(rec.ID)
+	if isDirectBoot(rec.BootConfig) {
+		path = q.conf.COWRawPath(rec.ID)
+	}
+	size, _ := utils.AllocatedSize(path)
+	return size
+}
+
+// forEachVM runs fn for each ID, collects successes, and logs failures.
+func forEachVM(ctx context.Context, ids []string, op string, fn func(context.Context, string) error) ([]string, error) {
+	logger := log.WithFunc("qemu." + op)
+	result := utils.ForEach(ctx, ids, fn)
+	for _, err := range result.Errors {
+		logger.Warnf(ctx, "%s: %v", op, err)
+	}
+	return result.Succeeded, result.Err()
+}
+
+// recordEvent appends a lifecycle event for a VM to the host journal.
+func (q *QEMU) recordEvent(ctx context.Context, typ types.EventType, id, name, msg string) {
+	events.Record(ctx, q.conf.Config, types.Event{Type: typ, ID: id, Name: name, Message: msg})
+}
+
+func (q *QEMU) loadRecord(ctx context.Context, id string) (hypervisor.VMRecord, error) {
+	var rec hypervisor.VMRecord
+	return rec, q.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		var err error
+		rec, err = utils.LookupCopy(idx.VMs, id)
+		return err
+	})
+}
+
+func (q *QEMU) binaryName() string {
+	return filepath.Base(q.conf.Binary())
+}
+
+// firmware returns the UEFI firmware for a cloud-image VM: the build picked
+// with --firmware, else qemu_firmware (CLOUDHV.fd only boots under CH).
+func (q *QEMU) firmware(rec *hypervisor.VMRecord) string {
+	if rec.Config.Firmware != "" && rec.BootConfig != nil && rec.BootConfig.FirmwarePath != "" {
+		return rec.BootConfig.FirmwarePath
+	}
+	return q.conf.Firmware()
+}
+
+func (q *QEMU) withRunningVM(ctx context.Context, rec *hypervisor.VMRecord, fn func(pid int) error) error {
+	pid, pidErr := utils.ReadPIDFile(pidFile(rec.RunDir))
+	if pidErr != nil && !os.IsNotExist(pidErr) {
+		log.WithFunc("qemu.withRunningVM").Warnf(ctx, "read PID file: %v", pidErr)
+	}
+	if !utils.VerifyProcessCmdline(pid, q.binaryName(), qmpSockPath(rec.RunDir)) {
+		return hypervisor.ErrNotRunning
+	}
+	return fn(pid)
+}
+
+// requireStopped fails unless the VM is created or stopped and its QEMU
+// process is gone.
+func (q *QEMU) requireStopped(ctx context.Context, rec *hypervisor.VMRecord, op string) error {
+	switch rec.State {
+	case types.VMStateCreated, types.VMStateStopped:
+	default:
+		return fmt.Errorf("VM %s is %s, must be created or stopped to %s", rec.ID, rec.State, op)
+	}
+	if runErr := q.withRunningVM(ctx, rec, func(_ int) error {
+		return fmt.Errorf("VM %s process is still running", rec.ID)
+	}); !errors.Is(runErr, hypervisor.ErrNotRunning) {
+		return runErr
+	}
+	return nil
+}
+
+func (q *QEMU) updateState(ctx context.Context, id string, state types.VMState) error {
+	now := time.Now()
+	return q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %q not found in index", id)
+		}
+		r.State = state
+		r.UpdatedAt = now
+		if state != types.VMStateError {
+			r.Error = ""
+		}
+		switch state {
+		case types.VMStateRunning:
+			r.StartedAt = &now
+		case types.VMStateStopped:
+			r.StoppedAt = &now
+		}
+		return nil
+	})
+}
+
+func (q *QEMU) markError(ctx context.Context, id string) {
+	if err := q.updateState(ctx, id, types.VMStateError); err != nil {
+		log.WithFunc("qemu.markError").Warnf(ctx, "mark VM %s error: %v", id, err)
+	}
+}
+
+func (q *QEMU) saveCmdline(ctx context.Context, rec *hypervisor.VMRecord, args []string) {
+	line := q.conf.Binary() + " " + strings.Join(args, " ")
+	if err := os.WriteFile(filepath.Join(rec.RunDir, cmdlineFileName), []byte(line), 0o600); err != nil {
+		log.WithFunc("qemu.saveCmdline").Warnf(ctx, "save cmdline: %v", err)
+	}
+}
+
+// reserveVM writes a placeholder VMRecord (state=Creating) so that GC won't
+// treat the VM's directories as orphans.
+func (q *QEMU) reserveVM(ctx context.Context, id string, vmCfg *types.VMConfig, blobIDs map[string]struct{}, runDir, logDir string) error {
+	now := time.Now()
+	return q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		if idx.VMs[id] != nil {
+			return fmt.Errorf("ID collision %q (retry)", id)
+		}
+		if dup, ok := idx.Names[vmCfg.Name]; ok {
+			return fmt.Errorf("VM name %q already exists (id: %s)", vmCfg.Name, dup)
+		}
+		idx.VMs[id] = &hypervisor.VMRecord{
+			VM: types.VM{
+				ID: id, State: types.VMStateCreating,
+				Config: *vmCfg, CreatedAt: now, UpdatedAt: now,
+			},
+			ImageBlobIDs: blobIDs,
+			RunDir:       runDir,
+			LogDir:       logDir,
+		}
+		idx.Names[vmCfg.Name] = id
+		return nil
+	})
+}
+
+// rollbackCreate removes a placeholder VM record from the DB.
+func (q *QEMU) rollbackCreate(ctx context.Context, id, name string) {
+	if err := q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		delete(idx.VMs, id)
+		if name != "" && idx.Names[name] == id {
+			delete(idx.Names, name)
+		}
+		return nil
+	}); err != nil {
+		log.WithFunc("qemu.rollbackCreate").Warnf(ctx, "rollback VM %s (name=%s): %v", id, name, err)
+	}
+}
+
+// cowPath returns the writable COW disk path for a VM.
+func (q *QEMU) cowPath(vmID string, directBoot bool) string {
+	if directBoot {
+		return q.conf.COWRawPath(vmID)
+	}
+	return q.conf.OverlayPath(vmID)
+}
+
+func cleanupRuntimeFiles(ctx context.Context, runDir string) {
+	for _, name := range runtimeFiles {
+		p := filepath.Join(runDir, name)
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("qemu.cleanupRuntimeFiles").Warnf(ctx, "cleanup %s: %v", p, err)
+		}
+	}
+}
+
+func removeVMDirs(runDir, logDir string) error {
+	return errors.Join(
+		os.RemoveAll(runDir),
+		os.RemoveAll(logDir),
+	)
+}
@@ -0,0 +1,359 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/keystore"
+	"github.com/projecteru2/cocoon/lock"
+	"github.com/projecteru2/cocoon/lock/flock"
+	"github.com/projecteru2/cocoon/storage"
+	storejson "github.com/projecteru2/cocoon/storage/json"
+	"github.com/projecteru2/cocoon/types"
+)
+
+const typ = "qemu"
+
+var (
+	_ hypervisor.Hypervisor     = (*QEMU)(nil)
+	_ hypervisor.HealthRecorder = (*QEMU)(nil)
+)
+
+// QEMU implements hypervisor.Hypervisor on top of qemu-system/KVM, driven
+// through QMP. It reuses the VMIndex schema and image backends of the
+// cloud-hypervisor backend; VM memory snapshots are not supported.
+type QEMU struct {
+	conf   *Config
+	store  storage.Store[hypervisor.VMIndex]
+	locker lock.Locker
+	keys   keystore.Keystore // seals random root passwords
+}
+
+// New creates a QEMU backend.
+func New(conf *config.Config) (*QEMU, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	cfg := &Config{Config: conf}
+	if err := cfg.EnsureDirs(); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	locker := flock.New(cfg.IndexLock())
+	store := storejson.New[hypervisor.VMIndex](cfg.IndexFile(), locker)
+	keys, err := keystore.New(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &QEMU{conf: cfg, store: store, locker: locker, keys: keys}, nil
+}
+
+func (q *QEMU) Type() string { return typ }
+
+// Inspect returns VM for a single VM by ref (ID, name, or prefix).
+func (q *QEMU) Inspect(ctx context.Context, ref string) (*types.VM, error) {
+	var result *types.VM
+	return result, q.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		result = toVM(idx.VMs[id])
+		return nil
+	})
+}
+
+// List returns VM for all known VMs.
+func (q *QEMU) List(ctx context.Context) ([]*types.VM, error) {
+	var result []*types.VM
+	return result, q.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		for _, rec := range idx.VMs {
+			if rec == nil {
+				continue
+			}
+			result = append(result, toVM(rec))
+		}
+		return nil
+	})
+}
+
+// DiskUsage implements hypervisor.DiskUsageReporter.
+func (q *QEMU) DiskUsage(ctx context.Context, ids []string) (map[string]int64, error) {
+	usage := make(map[string]int64, len(ids))
+	return usage, q.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		for _, id := range ids {
+			if rec := idx.VMs[id]; rec != nil {
+				usage[id] = q.rootDiskUsage(rec)
+			}
+		}
+		return nil
+	})
+}
+
+// SetGuestIP implements hypervisor.GuestIPRecorder.
+func (q *QEMU) SetGuestIP(ctx context.Context, ref, mac, ip string) error {
+	return q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		for _, nc := range idx.VMs[id].NetworkConfigs {
+			if nc != nil && strings.EqualFold(nc.Mac, mac) {
+				nc.GuestIP = ip
+				return nil
+			}
+		}
+		return fmt.Errorf("VM %s has no NIC %s", id, mac)
+	})
+}
+
+// SetError implements hypervisor.ErrorRecorder.
+func (q *QEMU) SetError(ctx context.Context, ref, reason string) error {
+	return q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		rec := idx.VMs[id]
+		rec.State = types.VMStateError
+		rec.Error = reason
+		rec.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// SetHealth implements hypervisor.HealthRecorder.
+func (q *QEMU) SetHealth(ctx context.Context, ref string, health *types.Health) error {
+	return q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		idx.VMs[id].Health = health
+		return nil
+	})
+}
+
+// Delete removes VMs. Running VMs require force=true (stops them first).
+func (q *QEMU) Delete(ctx context.Context, refs []string, force bool) ([]string, error) {
+	ids, err := q.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Delete", func(ctx context.Context, id string) error {
+		rec, loadErr := q.loadRecord(ctx, id)
+		if loadErr != nil {
+			return loadErr
+		}
+		if err := q.withRunningVM(ctx, &rec, func(_ int) error {
+			if !force {
+				return fmt.Errorf("running (force required)")
+			}
+			return q.stopOne(ctx, id)
+		}); err != nil && !errors.Is(err, hypervisor.ErrNotRunning) {
+			return fmt.Errorf("stop before delete: %w", err)
+		}
+		if err := removeVMDirs(rec.RunDir, rec.LogDir); err != nil {
+			return fmt.Errorf("cleanup VM dirs: %w", err)
+		}
+		if err := q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+			r := idx.VMs[id]
+			if r == nil {
+				return hypervisor.ErrNotFound
+			}
+			delete(idx.Names, r.Config.Name)
+			delete(idx.VMs, id)
+			return nil
+		}); err != nil {
+			return err
+		}
+		cloudhypervisor.DeleteRootPasswordKey(ctx, q.keys, id, rec.RootPassword)
+		q.recordEvent(ctx, types.EventDeleted, id, rec.Config.Name, "")
+		return nil
+	})
+}
+
+// Rename changes a VM's name; running VMs may be renamed.
+func (q *QEMU) Rename(ctx context.Context, ref, name string) error {
+	if err := types.ValidateVMName(name); err != nil {
+		return err
+	}
+	return q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		id, err := idx.Resolve(ref)
+		if err != nil {
+			return err
+		}
+		rec := idx.VMs[id]
+		if rec.Config.Name == name {
+			return nil
+		}
+		if dup, ok := idx.Names[name]; ok {
+			return fmt.Errorf("VM name %q already exists (id: %s)", name, dup)
+		}
+		if idx.Names[rec.Config.Name] == id {
+			delete(idx.Names, rec.Config.Name)
+		}
+		idx.Names[name] = id
+		rec.Config.Name = name
+		rec.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// Update changes CPU, memory, and storage of a created or stopped VM; the
+// new values take effect on the next start.
+func (q *QEMU) Update(ctx context.Context, ref string, vmCfg *types.VMConfig) (*types.VM, error) {
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Hold the VM lock from the stopped check to the record update, so a
+	// start cannot launch the VM in between on the old disk or sizes.
+	unlock, err := cloudhypervisor.LockVM(ctx, rec.RunDir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if rec, err = q.loadRecord(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := q.requireStopped(ctx, &rec, "update"); err != nil {
+		return nil, err
+	}
+
+	if vmCfg.Storage < rec.Config.Storage {
+		return nil, fmt.Errorf("storage cannot shrink from %d to %d bytes", rec.Config.Storage, vmCfg.Storage)
+	}
+	if vmCfg.Storage > rec.Config.Storage {
+		directBoot := isDirectBoot(rec.BootConfig)
+		if err := cloudhypervisor.ExpandImage(ctx, q.cowPath(id, directBoot), vmCfg.Storage, directBoot); err != nil {
+			return nil, fmt.Errorf("resize COW: %w", err)
+		}
+	}
+
+	var result *types.VM
+	return result, q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", id)
+		}
+		r.Config.CPU = vmCfg.CPU
+		r.Config.Memory = vmCfg.Memory
+		r.Config.Storage = vmCfg.Storage
+		r.UpdatedAt = time.Now()
+		result = toVM(r)
+		return nil
+	})
+}
+
+// ResizeDisk grows the root disk of a created or stopped VM to size bytes;
+// see cloudhypervisor.GrowRootDisk.
+func (q *QEMU) ResizeDisk(ctx context.Context, ref string, size int64) (*types.VM, error) {
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.requireStopped(ctx, &rec, "resize its disk"); err != nil {
+		return nil, err
+	}
+	if size <= rec.Config.Storage {
+		return nil, fmt.Errorf("disk can only grow: VM %s has %d bytes, asked for %d", id, rec.Config.Storage, size)
+	}
+	directBoot := isDirectBoot(rec.BootConfig)
+	if err := cloudhypervisor.GrowRootDisk(ctx, q.cowPath(id, directBoot), size, directBoot); err != nil {
+		return nil, fmt.Errorf("resize COW: %w", err)
+	}
+
+	var result *types.VM
+	return result, q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", id)
+		}
+		r.Config.Storage = size
+		r.UpdatedAt = time.Now()
+		result = toVM(r)
+		return nil
+	})
+}
+
+// CompactDisk returns the space a created or stopped VM's root disk no
+// longer uses to the host; see cloudhypervisor.CompactRootDisk.
+func (q *QEMU) CompactDisk(ctx context.Context, ref string) (int64, error) {
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return 0, err
+	}
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := q.requireStopped(ctx, &rec, "compact its disk"); err != nil {
+		return 0, err
+	}
+	directBoot := isDirectBoot(rec.BootConfig)
+	freed, err := cloudhypervisor.CompactRootDisk(ctx, q.cowPath(id, directBoot), directBoot)
+	if err != nil {
+		return 0, fmt.Errorf("compact COW: %w", err)
+	}
+	return freed, nil
+}
+
+// Snapshot is not supported: QEMU migration streams are not compatible
+// with cocoon's snapshot format.
+func (q *QEMU) Snapshot(context.Context, string) (*types.SnapshotConfig, io.ReadCloser, error) {
+	return nil, nil, unsupported("snapshot")
+}
+
+// Clone is not supported; see Snapshot.
+func (q *QEMU) Clone(context.Context, string, *types.VMConfig, []*types.NetworkConfig, *types.SnapshotConfig, io.Reader) (*types.VM, error) {
+	return nil, unsupported("clone from snapshot")
+}
+
+// CloneVM is not supported by the qemu backend yet.
+func (q *QEMU) CloneVM(context.Context, string, string, *types.VMConfig, []*types.NetworkConfig) (*types.VM, error) {
+	return nil, unsupported("clone")
+}
+
+// Restore is not supported; see Snapshot.
+func (q *QEMU) Restore(context.Context, string, *types.VMConfig, io.Reader) (*types.VM, error) {
+	return nil, unsupported("restore")
+}
+
+func unsupported(op string) error {
+	return fmt.Errorf("%s is not supported by the %s backend: %w", op, typ, errors.ErrUnsupported)
+}
+
+// resolveRef resolves a single ref (ID, name, or prefix) to an exact VM ID.
+func (q *QEMU) resolveRef(ctx context.Context, ref string) (string, error) {
+	var id string
+	return id, q.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		var err error
+		id, err = idx.Resolve(ref)
+		return err
+	})
+}
+
+// resolveRefs batch-resolves refs to exact VM IDs under a single lock.
+func (q *QEMU) resolveRefs(ctx context.Context, refs []string) ([]string, error) {
+	var ids []string
+	return ids, q.store.With(ctx, func(idx *hypervisor.VMIndex) error {
+		var err error
+		ids, err = idx.ResolveMany(refs)
+		return err
+	})
+}
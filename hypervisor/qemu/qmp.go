@@ -0,0 +1,101 @@
+package qemu
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// qmpTimeout bounds a QMP exchange when the caller's context has no deadline.
+const qmpTimeout = 10 * time.Second
+
+// qmpError is an error reply from QEMU's machine protocol.
+type qmpError struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *qmpError) Error() string { return e.Class + ": " + e.Desc }
+
+// qmpClient is a minimal synchronous QMP client: one command in flight,
+// asynchronous events are skipped.
+type qmpClient struct {
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+// dialQMP connects to a QMP socket, consumes the greeting, and negotiates
+// command mode.
+func dialQMP(ctx context.Context, path string) (*qmpClient, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("connect QMP %s: %w", path, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(qmpTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c := &qmpClient{conn: conn, dec: json.NewDecoder(conn)}
+	var greeting struct {
+		QMP json.RawMessage `json:"QMP"`
+	}
+	if err := c.dec.Decode(&greeting); err != nil || greeting.QMP == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("read QMP greeting: %w", err)
+	}
+	if err := c.execute("qmp_capabilities", nil, nil); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("qmp_capabilities: %w", err)
+	}
+	return c, nil
+}
+
+// execute runs cmd and decodes its return value into out (if non-nil).
+func (c *qmpClient) execute(cmd string, args, out any) error {
+	req := map[string]any{"execute": cmd}
+	if args != nil {
+		req["arguments"] = args
+	}
+	if err := json.NewEncoder(c.conn).Encode(req); err != nil {
+		return fmt.Errorf("send %s: %w", cmd, err)
+	}
+	for {
+		var resp struct {
+			Return json.RawMessage `json:"return"`
+			Error  *qmpError       `json:"error"`
+			Event  string          `json:"event"`
+		}
+		if err := c.dec.Decode(&resp); err != nil {
+			return fmt.Errorf("read %s reply: %w", cmd, err)
+		}
+		switch {
+		case resp.Event != "":
+			continue
+		case resp.Error != nil:
+			return resp.Error
+		case out != nil && resp.Return != nil:
+			return json.Unmarshal(resp.Return, out)
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *qmpClient) Close() error { return c.conn.Close() }
+
+// qmpCommand runs a single QMP command on a fresh connection.
+func qmpCommand(ctx context.Context, path, cmd string, args, out any) error {
+	c, err := dialQMP(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer c.Close() //nolint:errcheck
+	if err := c.execute(cmd, args, out); err != nil {
+		return fmt.Errorf("%s: %w", cmd, err)
+	}
+	return nil
+}
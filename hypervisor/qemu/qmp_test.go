@@ -0,0 +1,82 @@
+package qemu
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// serveQMP runs a fake QMP server that answers each command from replies
+// (keyed by command name), emitting an event before every reply.
+func serveQMP(t *testing.T, replies map[string]string) string {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "qmp.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() //nolint:errcheck
+		w := bufio.NewWriter(conn)
+		_, _ = w.WriteString(`{"QMP": {"version": {}, "capabilities": []}}` + "\n")
+		_ = w.Flush()
+		dec := json.NewDecoder(conn)
+		for {
+			var req struct {
+				Execute string `json:"execute"`
+			}
+			if dec.Decode(&req) != nil {
+				return
+			}
+			reply, ok := replies[req.Execute]
+			if !ok {
+				reply = `{"return": {}}`
+			}
+			_, _ = w.WriteString(`{"event": "NIC_RX_FILTER_CHANGED", "data": {}}` + "\n" + reply + "\n")
+			_ = w.Flush()
+		}
+	}()
+	return sock
+}
+
+func TestQMPCommand(t *testing.T) {
+	sock := serveQMP(t, map[string]string{
+		"query-balloon": `{"return": {"actual": 1073741824}}`,
+		"bogus":         `{"error": {"class": "CommandNotFound", "desc": "The command bogus has not been found"}}`,
+	})
+
+	c, err := dialQMP(t.Context(), sock)
+	if err != nil {
+		t.Fatalf("dialQMP: %v", err)
+	}
+	defer c.Close() //nolint:errcheck
+
+	var balloon struct {
+		Actual int64 `json:"actual"`
+	}
+	if err := c.execute("query-balloon", nil, &balloon); err != nil {
+		t.Fatalf("query-balloon: %v", err)
+	}
+	if balloon.Actual != 1<<30 {
+		t.Errorf("actual = %d, want %d", balloon.Actual, 1<<30)
+	}
+
+	err = c.execute("bogus", nil, nil)
+	var qe *qmpError
+	if !errors.As(err, &qe) || qe.Class != "CommandNotFound" {
+		t.Errorf("bogus: err = %v, want CommandNotFound", err)
+	}
+
+	if err := c.execute("system_powerdown", nil, nil); err != nil {
+		t.Errorf("system_powerdown: %v", err)
+	}
+}
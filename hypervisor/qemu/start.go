@@ -0,0 +1,241 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Start launches the QEMU process for each VM ref.
+// Returns the IDs that were successfully started.
+func (q *QEMU) Start(ctx context.Context, refs []string) ([]string, error) {
+	ids, err := q.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Start", q.startOne)
+}
+
+func (q *QEMU) startOne(ctx context.Context, id string) error {
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Idempotent: skip if the QEMU process is already running.
+	runErr := q.withRunningVM(ctx, &rec, func(_ int) error {
+		if rec.State != types.VMStateRunning {
+			return q.updateState(ctx, id, types.VMStateRunning)
+		}
+		return nil
+	})
+	switch {
+	case runErr == nil:
+		return nil
+	case errors.Is(runErr, hypervisor.ErrNotRunning):
+	default:
+		return fmt.Errorf("reconcile running VM %s: %w", id, runErr)
+	}
+
+	fw := q.firmware(&rec)
+	if !isDirectBoot(rec.BootConfig) {
+		if _, statErr := os.Stat(fw); statErr != nil {
+			return fmt.Errorf("UEFI firmware %q: %w (install OVMF or set qemu_firmware)", fw, statErr)
+		}
+	}
+	if err = utils.EnsureDirs(rec.RunDir, rec.LogDir); err != nil {
+		return fmt.Errorf("ensure dirs: %w", err)
+	}
+	// Hold the VM lock until the PID file is written, so an update cannot
+	// change the disk or sizes under the launch.
+	unlock, err := cloudhypervisor.LockVM(ctx, rec.RunDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlock != nil {
+			unlock()
+		}
+	}()
+	if rec, err = q.loadRecord(ctx, id); err != nil {
+		return err
+	}
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+
+	vhostNet := utils.DetectVhostNet()
+	if !vhostNet && hasTapNIC(rec.NetworkConfigs) {
+		log.WithFunc("qemu.startOne").Warnf(ctx,
+			"/dev/vhost-net is not usable, VM %s NICs use QEMU's userspace datapath (modprobe vhost_net)", id)
+	}
+	files, err := cloudhypervisor.OCIGuestFiles(q.conf.Config, &rec)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 && rec.BootConfig.InitrdPath != "" {
+		initrd, initrdErr := cloudhypervisor.BootInitrd(&rec, files, nil)
+		if initrdErr != nil {
+			return initrdErr
+		}
+		boot := *rec.BootConfig
+		boot.InitrdPath = initrd
+		rec.BootConfig = &boot
+	}
+	args := buildArgs(&rec, fw, cloudhypervisor.IMDSSeed(q.conf.Config, &rec), vhostNet)
+	q.saveCmdline(ctx, &rec, args)
+
+	pid, err := q.launchProcess(ctx, &rec, args)
+	unlock()
+	unlock = nil
+	if err != nil {
+		q.markError(ctx, id)
+		return fmt.Errorf("launch VM: %w", err)
+	}
+	dirs := []string{q.conf.Config.RunDir, q.conf.RunDir(), rec.RunDir}
+	if err = hypervisor.SecureRuntime(q.conf.Config, dirs, qmpSockPath(rec.RunDir), consoleSockPath(rec.RunDir)); err != nil {
+		q.markError(ctx, id)
+		q.abortLaunch(ctx, pid, rec.RunDir)
+		return err
+	}
+
+	now := time.Now()
+	if err := q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+		r := idx.VMs[id]
+		if r == nil {
+			return fmt.Errorf("VM %s disappeared from index", id)
+		}
+		r.State = types.VMStateRunning
+		r.StartedAt = &now
+		r.UpdatedAt = now
+		r.FirstBooted = true
+		r.Health = nil
+		return nil
+	}); err != nil {
+		q.abortLaunch(ctx, pid, rec.RunDir)
+		return fmt.Errorf("update state: %w", err)
+	}
+
+	// Match the cloud-hypervisor backend: start with 25% of memory ballooned
+	// out, leaving deflate-on-oom headroom.
+	if rec.Config.Memory >= minBalloonMemory {
+		target := rec.Config.Memory - rec.Config.Memory/defaultBalloon
+		if err := qmpCommand(ctx, qmpSockPath(rec.RunDir), "balloon", map[string]int64{"value": target}, nil); err != nil {
+			log.WithFunc("qemu.startOne").Warnf(ctx, "set balloon for %s: %v", id, err)
+		}
+	}
+	q.recordEvent(ctx, types.EventStarted, id, rec.Config.Name, "")
+	if rec.Config.BootProbe != nil {
+		return q.probeBoot(ctx, &rec, pid)
+	}
+	return nil
+}
+
+// probeBoot waits for the guest console to show the boot pattern. A guest
+// that fails the probe is marked error before its VMM is torn down, so the
+// daemon does not mistake the teardown for a crash and restart it.
+func (q *QEMU) probeBoot(ctx context.Context, rec *hypervisor.VMRecord, pid int) error {
+	console, err := q.Console(ctx, rec.ID)
+	if err != nil {
+		return fmt.Errorf("boot probe: %w", err)
+	}
+	err = hypervisor.ProbeBoot(ctx, console, rec.Config.BootProbe, filepath.Join(rec.LogDir, hypervisor.BootLogName))
+	var bootErr *hypervisor.BootError
+	if !errors.As(err, &bootErr) {
+		return err
+	}
+	q.markError(ctx, rec.ID)
+	q.abortLaunch(ctx, pid, rec.RunDir)
+	q.recordEvent(ctx, types.EventBootFailed, rec.ID, rec.Config.Name, bootErr.Reason)
+	return err
+}
+
+// launchProcess starts qemu-system with args, writes the PID file, waits for
+// the QMP socket, then releases the process so QEMU outlives this binary.
+func (q *QEMU) launchProcess(ctx context.Context, rec *hypervisor.VMRecord, args []string) (int, error) {
+	logger := log.WithFunc("qemu.launchProcess")
+	logFile, err := os.OpenFile(filepath.Join(rec.LogDir, processLogName), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640) //nolint:gosec,mnd
+	if err != nil {
+		logger.Warnf(ctx, "create process log: %v", err)
+	} else {
+		defer func() {
+			if closeErr := logFile.Close(); closeErr != nil {
+				logger.Warnf(ctx, "close log file: %v", closeErr)
+			}
+		}()
+	}
+
+	cmd := exec.Command(q.conf.Binary(), args...) //nolint:gosec
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if logFile != nil {
+		cmd.Stdout = logFile
+		cmd.Stderr = logFile
+	}
+
+	// Macvtap queues are opened here and inherited as the fds netArgs
+	// put on -netdev.
+	if hypervisor.HasMacvtap(rec.NetworkConfigs) {
+		files, openErr := hypervisor.OpenMacvtapQueues(rec.NetworkConfigs)
+		if openErr != nil {
+			return 0, openErr
+		}
+		defer hypervisor.CloseFiles(files)
+		cmd.ExtraFiles = files
+	}
+
+	// The tap devices live in the VM's netns; QEMU must open them there.
+	if nsPath := hypervisor.NetnsPath(rec.NetworkConfigs); nsPath != "" {
+		restore, enterErr := utils.EnterNetns(nsPath)
+		if enterErr != nil {
+			return 0, fmt.Errorf("enter netns: %w", enterErr)
+		}
+		defer restore()
+	}
+
+	if startErr := cmd.Start(); startErr != nil {
+		return 0, fmt.Errorf("exec %s: %w", q.conf.Binary(), startErr)
+	}
+	pid := cmd.Process.Pid
+
+	pidPath := pidFile(rec.RunDir)
+	if err := utils.WritePIDFile(pidPath, pid); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, fmt.Errorf("write PID file: %w", err)
+	}
+
+	sock := qmpSockPath(rec.RunDir)
+	if err := utils.WaitFor(ctx, q.conf.SocketWaitTimeout(), 100*time.Millisecond, func() (bool, error) { //nolint:mnd
+		if utils.CheckSocket(sock) == nil {
+			return true, nil
+		}
+		if !utils.IsProcessAlive(pid) {
+			return false, fmt.Errorf("%s exited before QMP socket was ready (see %s)", q.binaryName(), processLogName)
+		}
+		return false, nil
+	}); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		_ = os.Remove(pidPath)
+		return 0, err
+	}
+
+	_ = cmd.Process.Release()
+	return pid, nil
+}
+
+// abortLaunch kills a QEMU process and removes runtime files after a failed launch.
+func (q *QEMU) abortLaunch(ctx context.Context, pid int, runDir string) {
+	_ = utils.TerminateProcess(ctx, pid, q.binaryName(), qmpSockPath(runDir), q.conf.TerminateGracePeriod())
+	cleanupRuntimeFiles(ctx, runDir)
+}
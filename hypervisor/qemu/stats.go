@@ -0,0 +1,83 @@
+package qemu
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+type qmpBlockStats struct {
+	Device string `json:"device"`
+	Stats  struct {
+		RdBytes      uint64 `json:"rd_bytes"`
+		WrBytes      uint64 `json:"wr_bytes"`
+		RdOperations uint64 `json:"rd_operations"`
+		WrOperations uint64 `json:"wr_operations"`
+	} `json:"stats"`
+}
+
+// Stats samples resource usage of a running VM: CPU time and RSS of the
+// QEMU process from /proc, block counters from query-blockstats, and the
+// balloon-adjusted guest memory from query-balloon. Network counters are
+// not reported by QMP; callers read them from the host devices.
+func (q *QEMU) Stats(ctx context.Context, ref string) (*types.VMStats, error) {
+	id, err := q.resolveRef(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &types.VMStats{ID: id, Name: rec.Config.Name}
+	return stats, q.withRunningVM(ctx, &rec, func(pid int) error {
+		stats.PID, stats.CollectedAt = pid, time.Now()
+		if stats.CPUTime, stats.MemoryRSS, err = utils.ProcessUsage(pid); err != nil {
+			return fmt.Errorf("read process usage: %w", err)
+		}
+
+		c, err := dialQMP(ctx, qmpSockPath(rec.RunDir))
+		if err != nil {
+			return err
+		}
+		defer c.Close() //nolint:errcheck
+
+		var blocks []qmpBlockStats
+		if err := c.execute("query-blockstats", nil, &blocks); err != nil {
+			return fmt.Errorf("query-blockstats: %w", err)
+		}
+		aggregateBlockStats(stats, blocks)
+
+		// Best-effort: guests without a balloon device reject query-balloon.
+		var balloon struct {
+			Actual int64 `json:"actual"`
+		}
+		if err := c.execute("query-balloon", nil, &balloon); err == nil {
+			stats.MemoryActual = balloon.Actual
+		} else {
+			log.WithFunc("qemu.Stats").Debugf(ctx, "query-balloon %s: %v", id, err)
+		}
+		return nil
+	})
+}
+
+func aggregateBlockStats(stats *types.VMStats, blocks []qmpBlockStats) {
+	stats.Counters = make(map[string]map[string]uint64, len(blocks))
+	for _, b := range blocks {
+		s := b.Stats
+		stats.Counters[b.Device] = map[string]uint64{
+			"read_bytes": s.RdBytes, "write_bytes": s.WrBytes,
+			"read_ops": s.RdOperations, "write_ops": s.WrOperations,
+		}
+		stats.BlockReadBytes += s.RdBytes
+		stats.BlockWriteBytes += s.WrBytes
+		stats.BlockReadOps += s.RdOperations
+		stats.BlockWriteOps += s.WrOperations
+	}
+}
@@ -0,0 +1,157 @@
+package qemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// acpiPollInterval is how often we check if the guest has powered off
+// after system_powerdown.
+const acpiPollInterval = 500 * time.Millisecond
+
+// Stop shuts down the QEMU process for each VM ref:
+//   - UEFI boot (cloudimg): system_powerdown → poll → fallback quit/SIGTERM/SIGKILL
+//   - Direct boot (OCI):    quit (flushes disks) → SIGTERM → SIGKILL
+func (q *QEMU) Stop(ctx context.Context, refs []string) ([]string, error) {
+	ids, err := q.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Stop", q.stopOne)
+}
+
+func (q *QEMU) stopOne(ctx context.Context, id string) error {
+	rec, err := q.loadRecord(ctx, id)
+	if err != nil {
+		return err
+	}
+	stopTimeout := time.Duration(q.conf.StopTimeoutSeconds) * time.Second
+	if d, ok := hypervisor.StopTimeout(ctx); ok {
+		stopTimeout = d
+	}
+
+	shutdownErr := q.withRunningVM(ctx, &rec, func(pid int) error {
+		if isDirectBoot(rec.BootConfig) {
+			return q.forceTerminate(ctx, &rec, pid)
+		}
+		return q.shutdownACPI(ctx, &rec, pid, stopTimeout)
+	})
+	return q.finishStop(ctx, &rec, shutdownErr)
+}
+
+// Kill signals the QEMU process directly, skipping the guest shutdown path.
+// SIGKILL is immediate; SIGTERM escalates after the terminate grace period.
+func (q *QEMU) Kill(ctx context.Context, refs []string, sig syscall.Signal) ([]string, error) {
+	if sig != syscall.SIGKILL && sig != syscall.SIGTERM {
+		return nil, fmt.Errorf("unsupported signal %v: must be SIGKILL or SIGTERM", sig)
+	}
+	ids, err := q.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Kill", func(ctx context.Context, id string) error {
+		rec, err := q.loadRecord(ctx, id)
+		if err != nil {
+			return err
+		}
+		sock := qmpSockPath(rec.RunDir)
+		killErr := q.withRunningVM(ctx, &rec, func(pid int) error {
+			if sig == syscall.SIGKILL {
+				return utils.KillProcess(ctx, pid, q.binaryName(), sock)
+			}
+			return utils.TerminateProcess(ctx, pid, q.binaryName(), sock, q.conf.TerminateGracePeriod())
+		})
+		return q.finishStop(ctx, &rec, killErr)
+	})
+}
+
+// Reboot resets the guest of each running VM in place via system_reset.
+func (q *QEMU) Reboot(ctx context.Context, refs []string) ([]string, error) {
+	ids, err := q.resolveRefs(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	return forEachVM(ctx, ids, "Reboot", func(ctx context.Context, id string) error {
+		rec, err := q.loadRecord(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := q.withRunningVM(ctx, &rec, func(_ int) error {
+			return qmpCommand(ctx, qmpSockPath(rec.RunDir), "system_reset", nil, nil)
+		}); err != nil {
+			return fmt.Errorf("reboot VM %s: %w", id, err)
+		}
+		now := time.Now()
+		if err := q.store.Update(ctx, func(idx *hypervisor.VMIndex) error {
+			r := idx.VMs[id]
+			if r == nil {
+				return fmt.Errorf("VM %s disappeared from index", id)
+			}
+			r.StartedAt = &now
+			r.UpdatedAt = now
+			r.Health = nil
+			return nil
+		}); err != nil {
+			return err
+		}
+		q.recordEvent(ctx, types.EventRebooted, id, rec.Config.Name, "")
+		return nil
+	})
+}
+
+// finishStop settles the record after a shutdown attempt.
+func (q *QEMU) finishStop(ctx context.Context, rec *hypervisor.VMRecord, shutdownErr error) error {
+	if shutdownErr != nil && !errors.Is(shutdownErr, hypervisor.ErrNotRunning) {
+		q.markError(ctx, rec.ID)
+		return shutdownErr
+	}
+	cleanupRuntimeFiles(ctx, rec.RunDir)
+	if err := q.updateState(ctx, rec.ID, types.VMStateStopped); err != nil {
+		return err
+	}
+	q.recordEvent(ctx, types.EventStopped, rec.ID, rec.Config.Name, "")
+	return nil
+}
+
+// shutdownACPI presses the virtual power button and waits for the guest to
+// power off, escalating to forceTerminate on timeout.
+func (q *QEMU) shutdownACPI(ctx context.Context, rec *hypervisor.VMRecord, pid int, timeout time.Duration) error {
+	logger := log.WithFunc("qemu.shutdownACPI")
+	if err := qmpCommand(ctx, qmpSockPath(rec.RunDir), "system_powerdown", nil, nil); err != nil {
+		logger.Errorf(ctx, err, "system_powerdown %s — falling back", rec.ID)
+		return q.forceTerminate(ctx, rec, pid)
+	}
+	if err := utils.WaitFor(ctx, timeout, acpiPollInterval, func() (bool, error) {
+		return !utils.IsProcessAlive(pid), nil
+	}); err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	logger.Warnf(ctx, "VM %s did not respond to power-button within %s, escalating", rec.ID, timeout)
+	return q.forceTerminate(ctx, rec, pid)
+}
+
+// forceTerminate asks QEMU to quit (which flushes disk caches), then falls
+// back to SIGTERM → SIGKILL if the process lingers.
+func (q *QEMU) forceTerminate(ctx context.Context, rec *hypervisor.VMRecord, pid int) error {
+	sock := qmpSockPath(rec.RunDir)
+	if err := qmpCommand(ctx, sock, "quit", nil, nil); err != nil {
+		log.WithFunc("qemu.forceTerminate").Warnf(ctx, "quit %s: %v", rec.ID, err)
+	} else if utils.WaitFor(ctx, q.conf.TerminateGracePeriod(), acpiPollInterval, func() (bool, error) {
+		return !utils.IsProcessAlive(pid), nil
+	}) == nil {
+		return nil
+	}
+	return utils.TerminateProcess(ctx, pid, q.binaryName(), sock, q.conf.TerminateGracePeriod())
+}
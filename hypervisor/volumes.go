@@ -0,0 +1,122 @@
+package hypervisor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// SplitVolumes separates the volume disks CreateVM appended to a VM's
+// image disks, so the backend prepares the image disks alone.
+func SplitVolumes(storageConfigs []*types.StorageConfig) (image, volumes []*types.StorageConfig) {
+	for _, sc := range storageConfigs {
+		if sc.Volume != "" {
+			volumes = append(volumes, sc)
+		} else {
+			image = append(image, sc)
+		}
+	}
+	return image, volumes
+}
+
+// AttachVolumes places volume disks after a VM's prepared disks, but
+// before a trailing cidata disk: cidata is dropped once the guest first
+// booted, and must not shift the volumes' device names when it is. Each
+// volume gets the virtio-blk device name it will have in the guest as its
+// Target; a volume that asked for another one is an error.
+func AttachVolumes(prepared, volumes []*types.StorageConfig, isCidata func(*types.StorageConfig) bool) ([]*types.StorageConfig, error) {
+	if len(volumes) == 0 {
+		return prepared, nil
+	}
+	head, tail := prepared, []*types.StorageConfig(nil)
+	if n := len(prepared); n > 0 && isCidata(prepared[n-1]) {
+		head, tail = prepared[:n-1], prepared[n-1:]
+	}
+	disks := 0
+	for _, sc := range head {
+		if !sc.Pmem {
+			disks++
+		}
+	}
+	out := make([]*types.StorageConfig, 0, len(prepared)+len(volumes))
+	out = append(out, head...)
+	for i, sc := range volumes {
+		v := *sc
+		dev := types.VirtioDiskName(disks + i)
+		if v.Target != "" && v.Target != dev {
+			return nil, fmt.Errorf("volume %d appears as %s in the guest, not %s: the VM's own disks take %s-%s, and volumes follow in --volume order",
+				i+1, dev, v.Target, types.VirtioDiskName(0), types.VirtioDiskName(disks-1))
+		}
+		v.Target = dev
+		out = append(out, &v)
+	}
+	return append(out, tail...), nil
+}
+
+// InsertVolume adds a volume disk to a VM that is not running, where
+// AttachVolumes would have put it: after the VM's disks and volumes, before
+// a trailing cidata disk.
+func InsertVolume(storageConfigs []*types.StorageConfig, disk *types.StorageConfig, isCidata func(*types.StorageConfig) bool) []*types.StorageConfig {
+	n := len(storageConfigs)
+	if n > 0 && isCidata(storageConfigs[n-1]) {
+		return append(storageConfigs[:n-1:n-1], disk, storageConfigs[n-1])
+	}
+	return append(storageConfigs, disk)
+}
+
+// RemoveVolume drops the disk of volume volumeID from storageConfigs,
+// reporting whether it was there.
+func RemoveVolume(storageConfigs []*types.StorageConfig, volumeID string) ([]*types.StorageConfig, bool) {
+	out := make([]*types.StorageConfig, 0, len(storageConfigs))
+	for _, sc := range storageConfigs {
+		if sc.Volume != volumeID {
+			out = append(out, sc)
+		}
+	}
+	return out, len(out) < len(storageConfigs)
+}
+
+// RenumberVolumes sets each volume's Target to the device it gets on the
+// next cold boot: virtio-blk disks are named in attach order, skipping
+// disks the boot leaves out. A Pinned volume that gets another device is
+// reported.
+func RenumberVolumes(storageConfigs []*types.StorageConfig, skip func(*types.StorageConfig) bool) error {
+	var errs []error
+	i := 0
+	for _, sc := range storageConfigs {
+		if sc.Pmem || skip(sc) {
+			continue
+		}
+		if sc.Volume != "" {
+			dev := types.VirtioDiskName(i)
+			if sc.Pinned && sc.Target != dev {
+				errs = append(errs, fmt.Errorf("volume %s attached as %s would appear as %s", sc.Volume, sc.Target, dev))
+			}
+			sc.Target = dev
+		}
+		i++
+	}
+	return errors.Join(errs...)
+}
+
+// HotplugTarget returns the device a disk hot-added to a running guest
+// gets: the lowest virtio-blk name no attached disk holds, as the guest
+// reuses names of unplugged disks. used lists the indexes of the guest's
+// disks that are not volumes; volumes hold their Target.
+func HotplugTarget(storageConfigs []*types.StorageConfig, used []int) string {
+	taken := make(map[string]bool, len(storageConfigs)+len(used))
+	for _, i := range used {
+		taken[types.VirtioDiskName(i)] = true
+	}
+	for _, sc := range storageConfigs {
+		if sc.Volume != "" {
+			taken[sc.Target] = true
+		}
+	}
+	for i := 0; ; i++ {
+		if dev := types.VirtioDiskName(i); !taken[dev] {
+			return dev
+		}
+	}
+}
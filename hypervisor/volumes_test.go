@@ -0,0 +1,108 @@
+package hypervisor
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func isCidata(sc *types.StorageConfig) bool { return filepath.Base(sc.Path) == "cidata.img" }
+
+func targets(scs []*types.StorageConfig) map[string]string {
+	out := map[string]string{}
+	for _, sc := range scs {
+		if sc.Volume != "" {
+			out[sc.Volume] = sc.Target
+		}
+	}
+	return out
+}
+
+func TestAttachVolumes(t *testing.T) {
+	prepared := []*types.StorageConfig{{Path: "/vm/overlay.qcow2"}, {Path: "/vm/cidata.img", RO: true}}
+	volumes := []*types.StorageConfig{{Volume: "a"}, {Volume: "b", Target: "/dev/vdc"}}
+	got, err := AttachVolumes(prepared, volumes, isCidata)
+	if err != nil {
+		t.Fatalf("AttachVolumes: %v", err)
+	}
+	if len(got) != 4 || !isCidata(got[3]) {
+		t.Fatalf("cidata not last: %+v", got)
+	}
+	if tg := targets(got); tg["a"] != "/dev/vdb" || tg["b"] != "/dev/vdc" {
+		t.Errorf("targets = %v", tg)
+	}
+	if _, err := AttachVolumes(prepared, []*types.StorageConfig{{Volume: "a", Target: "/dev/vdd"}}, isCidata); err == nil {
+		t.Error("expected error for a target the guest would not use")
+	}
+}
+
+func TestInsertAndRenumberVolumes(t *testing.T) {
+	scs := []*types.StorageConfig{{Path: "/vm/overlay.qcow2"}, {Volume: "a"}, {Path: "/vm/cidata.img"}}
+	scs = InsertVolume(scs, &types.StorageConfig{Volume: "b"}, isCidata)
+	if !isCidata(scs[3]) || scs[2].Volume != "b" {
+		t.Fatalf("b not inserted before cidata: %+v", scs)
+	}
+	if err := RenumberVolumes(scs, func(*types.StorageConfig) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if tg := targets(scs); tg["a"] != "/dev/vdb" || tg["b"] != "/dev/vdc" {
+		t.Errorf("targets = %v", tg)
+	}
+
+	scs, ok := RemoveVolume(scs, "a")
+	if !ok || len(scs) != 3 {
+		t.Fatalf("RemoveVolume = %+v, %v", scs, ok)
+	}
+	if _, ok := RemoveVolume(scs, "a"); ok {
+		t.Error("RemoveVolume reported a missing volume as removed")
+	}
+	if err := RenumberVolumes(scs, isCidata); err != nil {
+		t.Fatal(err)
+	}
+	if tg := targets(scs); tg["b"] != "/dev/vdb" {
+		t.Errorf("targets = %v", tg)
+	}
+}
+
+func TestRenumberVolumes_Pinned(t *testing.T) {
+	scs := []*types.StorageConfig{
+		{Path: "/vm/overlay.qcow2"},
+		{Volume: "a", Target: "/dev/vdb"},
+		{Volume: "b", Target: "/dev/vdc", Pinned: true},
+	}
+	if err := RenumberVolumes(scs, isCidata); err != nil {
+		t.Fatalf("unchanged numbering: %v", err)
+	}
+	scs, _ = RemoveVolume(scs, "a")
+	err := RenumberVolumes(scs, isCidata)
+	if err == nil || !strings.Contains(err.Error(), "volume b attached as /dev/vdc would appear as /dev/vdb") {
+		t.Errorf("err = %v, want b reported", err)
+	}
+
+	// An unpinned volume follows its place.
+	scs = []*types.StorageConfig{{Path: "/vm/overlay.qcow2"}, {Volume: "c", Target: "/dev/vdd"}}
+	if err := RenumberVolumes(scs, isCidata); err != nil || scs[1].Target != "/dev/vdb" {
+		t.Errorf("unpinned: target %s, err %v", scs[1].Target, err)
+	}
+}
+
+func TestHotplugTarget(t *testing.T) {
+	scs := []*types.StorageConfig{{Path: "/vm/overlay.qcow2"}, {Volume: "a", Target: "/dev/vdc"}}
+	tests := []struct {
+		name string
+		used []int
+		want string
+	}{
+		{"gap left by an unplugged disk", []int{0}, "/dev/vdb"},
+		{"cidata in use", []int{0, 1}, "/dev/vdd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HotplugTarget(scs, tt.used); got != tt.want {
+				t.Errorf("HotplugTarget = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
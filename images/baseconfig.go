@@ -1,7 +1,11 @@
 package images
 
 import (
+	"fmt"
 	"path/filepath"
+	"slices"
+
+	units "github.com/docker/go-units"
 
 	"github.com/projecteru2/cocoon/config"
 	"github.com/projecteru2/cocoon/utils"
@@ -18,16 +22,76 @@ type BaseConfig struct {
 // BackendDir returns the root directory for this image backend.
 func (c *BaseConfig) BackendDir() string { return filepath.Join(c.Root.RootDir, c.Subdir) }
 func (c *BaseConfig) DBDir() string      { return filepath.Join(c.BackendDir(), "db") }
-func (c *BaseConfig) TempDir() string    { return filepath.Join(c.BackendDir(), "temp") }
-func (c *BaseConfig) BlobsDir() string   { return filepath.Join(c.BackendDir(), "blobs") }
 func (c *BaseConfig) IndexFile() string  { return filepath.Join(c.DBDir(), "images.json") }
 func (c *BaseConfig) IndexLock() string  { return filepath.Join(c.DBDir(), "images.lock") }
 
-// BlobPath returns the full path for a blob with the given digest hex.
+// BlobBaseDir returns the directory new blobs are placed under: the
+// backend directory in the default storage pool, or BackendDir without one.
+func (c *BaseConfig) BlobBaseDir() string {
+	if pool, ok := c.Root.DefaultPool(); ok {
+		return filepath.Join(pool.Path, c.Subdir)
+	}
+	return c.BackendDir()
+}
+
+// TempDir sits next to BlobsDir so finished blobs are renamed into place.
+func (c *BaseConfig) TempDir() string  { return filepath.Join(c.BlobBaseDir(), "temp") }
+func (c *BaseConfig) BlobsDir() string { return filepath.Join(c.BlobBaseDir(), "blobs") }
+
+// BlobDirs returns every directory blobs may live in: BlobsDir first, then
+// the other storage pools and BackendDir, which hold blobs pulled before
+// the default pool changed.
+func (c *BaseConfig) BlobDirs() []string {
+	dirs := []string{c.BlobsDir()}
+	add := func(dir string) {
+		if !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, pool := range c.Root.StoragePools {
+		add(filepath.Join(pool.Path, c.Subdir, "blobs"))
+	}
+	add(filepath.Join(c.BackendDir(), "blobs"))
+	return dirs
+}
+
+// BlobPath returns the full path for a blob with the given digest hex:
+// where it already is, or where a new one goes.
 func (c *BaseConfig) BlobPath(hex string) string {
+	for _, dir := range c.BlobDirs() {
+		if p := filepath.Join(dir, hex+c.BlobExt); utils.ValidFile(p) {
+			return p
+		}
+	}
 	return filepath.Join(c.BlobsDir(), hex+c.BlobExt)
 }
 
+// CheckBlobRoom fails when the filesystem new blobs go to has less than
+// need bytes free.
+func (c *BaseConfig) CheckBlobRoom(need int64) error {
+	avail, err := utils.FSAvailable(c.BlobBaseDir())
+	if err != nil {
+		return err
+	}
+	if avail < need {
+		return fmt.Errorf("%s has %s free, the image needs %s", c.BlobBaseDir(), units.HumanSize(float64(avail)), units.HumanSize(float64(need)))
+	}
+	return nil
+}
+
+// ScanBlobs returns the digest hexes of the blobs in every BlobDirs entry.
+func (c *BaseConfig) ScanBlobs() ([]string, error) {
+	var hexes []string
+	for _, dir := range c.BlobDirs() {
+		found, err := utils.ScanFileStems(dir, c.BlobExt)
+		if err != nil {
+			return nil, err
+		}
+		hexes = append(hexes, found...)
+	}
+	return hexes, nil
+}
+
 // EnsureBaseDirs creates the common directories (db, temp, blobs).
 func (c *BaseConfig) EnsureBaseDirs() error {
 	return utils.EnsureDirs(c.DBDir(), c.TempDir(), c.BlobsDir())
@@ -9,6 +9,8 @@ import (
 	"github.com/projecteru2/core/log"
 
 	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/events"
+	"github.com/projecteru2/cocoon/firmware"
 	"github.com/projecteru2/cocoon/images"
 	"github.com/projecteru2/cocoon/lock"
 	"github.com/projecteru2/cocoon/progress"
@@ -62,6 +64,9 @@ func (c *CloudImg) Pull(ctx context.Context, url string, tracker progress.Tracke
 	_, err, _ := c.pullGroup.Do(url, func() (any, error) {
 		return nil, pull(ctx, c.conf, c.store, url, tracker)
 	})
+	if err == nil {
+		events.Record(ctx, c.conf.Root, types.Event{Type: types.EventImagePulled, ID: url})
+	}
 	return err
 }
 
@@ -111,9 +116,9 @@ func (c *CloudImg) Config(ctx context.Context, vms []*types.VMConfig) (result []
 				Serial: "cocoon-base",
 			}}
 
-			firmwarePath := c.conf.FirmwarePath()
-			if !utils.ValidFile(firmwarePath) {
-				return fmt.Errorf("firmware not found: %s", firmwarePath)
+			firmwarePath, err := firmware.Resolve(c.conf.Root, vm.Firmware)
+			if err != nil {
+				return err
 			}
 			boot[i] = &types.BootConfig{
 				FirmwarePath: firmwarePath,
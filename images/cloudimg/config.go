@@ -1,8 +1,6 @@
 package cloudimg
 
 import (
-	"path/filepath"
-
 	"github.com/projecteru2/cocoon/config"
 	"github.com/projecteru2/cocoon/images"
 )
@@ -23,8 +21,3 @@ func NewConfig(conf *config.Config) *Config {
 func (c *Config) EnsureDirs() error {
 	return c.EnsureBaseDirs()
 }
-
-// FirmwarePath returns the path to the UEFI firmware blob (CLOUDHV.fd).
-func (c *Config) FirmwarePath() string {
-	return filepath.Join(c.Root.RootDir, "firmware", "CLOUDHV.fd")
-}
@@ -5,7 +5,6 @@ import (
 
 	"github.com/projecteru2/cocoon/gc"
 	"github.com/projecteru2/cocoon/images"
-	"github.com/projecteru2/cocoon/utils"
 )
 
 // GCModule returns a typed gc.Module for the cloud image backend.
@@ -15,12 +14,14 @@ func (c *CloudImg) GCModule() gc.Module[images.ImageGCSnapshot] {
 		Locker:   c.locker,
 		Store:    c.store,
 		ReadRefs: func(idx *imageIndex) map[string]struct{} { return images.ReferencedDigests(idx.Images) },
-		ScanDisk: func() ([]string, error) { return utils.ScanFileStems(c.conf.BlobsDir(), ".qcow2") },
+		ScanDisk: c.conf.ScanBlobs,
 		Removers: []func(string) error{
 			func(hex string) error { return os.Remove(c.conf.BlobPath(hex)) },
 		},
-		TempDir: c.conf.TempDir(),
-		DirOnly: false,
+		BlobPath: c.conf.BlobPath,
+		BlobType: "cloud images",
+		TempDir:  c.conf.TempDir(),
+		DirOnly:  false,
 	})
 }
 
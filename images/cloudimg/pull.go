@@ -142,7 +142,7 @@ func downloadAndConvert(ctx context.Context, conf *Config, url string, tracker p
 	defer os.Remove(tmpPath) //nolint:errcheck
 
 	// Download.
-	digestHex, err := download(ctx, url, tmpFile, tracker)
+	digestHex, err := download(ctx, conf, url, tmpFile, tracker)
 	if err != nil {
 		return "", "", err
 	}
@@ -158,6 +158,13 @@ func downloadAndConvert(ctx context.Context, conf *Config, url string, tracker p
 	// Detect format and convert.
 	tracker.OnEvent(cloudimgProgress.Event{Phase: cloudimgProgress.PhaseConvert})
 
+	// The qcow2 blob takes about as much as the download.
+	if info, statErr := os.Stat(tmpPath); statErr == nil {
+		if err = conf.CheckBlobRoom(info.Size()); err != nil {
+			return "", "", err
+		}
+	}
+
 	format, err := detectImageFormat(ctx, tmpPath)
 	if err != nil {
 		return "", "", fmt.Errorf("detect format: %w", err)
@@ -186,8 +193,9 @@ func downloadAndConvert(ctx context.Context, conf *Config, url string, tracker p
 	return digestHex, tmpBlobPath, nil
 }
 
-// download fetches the URL content into dst, computing SHA-256 along the way.
-func download(ctx context.Context, url string, dst *os.File, tracker progress.Tracker) (string, error) {
+// download fetches the URL content into dst, computing SHA-256 along the
+// way. A known length must fit in the blob directory's filesystem.
+func download(ctx context.Context, conf *Config, url string, dst *os.File, tracker progress.Tracker) (string, error) {
 	defer dst.Close() //nolint:errcheck
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
@@ -207,6 +215,11 @@ func download(ctx context.Context, url string, dst *os.File, tracker progress.Tr
 	}
 
 	contentLength := resp.ContentLength
+	if contentLength > 0 {
+		if err := conf.CheckBlobRoom(contentLength); err != nil {
+			return "", err
+		}
+	}
 	tracker.OnEvent(cloudimgProgress.Event{
 		Phase:      cloudimgProgress.PhaseDownload,
 		BytesTotal: contentLength,
@@ -12,8 +12,9 @@ import (
 
 // ImageGCSnapshot is the unified GC snapshot for image backends.
 type ImageGCSnapshot struct {
-	refs    map[string]struct{} // digest hexes referenced by the index
-	diskIDs []string            // digest hexes found on disk (blobs + optional extras)
+	refs     map[string]struct{} // digest hexes referenced by the index
+	blobIDs  []string            // digest hexes of the blobs found on disk
+	extraIDs []string            // digest hexes of the extras found on disk
 }
 
 // GCModuleConfig configures a generic image GC module.
@@ -27,6 +28,12 @@ type GCModuleConfig[I any] struct {
 	ScanDisk func() ([]string, error)
 	// ExtraDisk returns additional hex IDs on disk (e.g., OCI boot dirs). Optional.
 	ExtraDisk func() ([]string, error)
+	// BlobPath and ExtraPath locate a hex ID's blob and extra for system df;
+	// BlobType and ExtraType name them there.
+	BlobPath  func(string) string
+	ExtraPath func(string) string
+	BlobType  string
+	ExtraType string
 	// Removers are called per hex ID during collect.
 	Removers []func(string) error
 	// TempDir for stale temp cleanup.
@@ -50,27 +57,56 @@ func BuildGCModule[I any](cfg GCModuleConfig[I]) gc.Module[ImageGCSnapshot] {
 				return snap, err
 			}
 			var err error
-			if snap.diskIDs, err = cfg.ScanDisk(); err != nil {
+			if snap.blobIDs, err = cfg.ScanDisk(); err != nil {
 				return snap, err
 			}
 			if cfg.ExtraDisk != nil {
-				extra, err := cfg.ExtraDisk()
-				if err != nil {
+				if snap.extraIDs, err = cfg.ExtraDisk(); err != nil {
 					return snap, err
 				}
-				snap.diskIDs = append(snap.diskIDs, extra...)
 			}
 			return snap, nil
 		},
 		Resolve: func(snap ImageGCSnapshot, others map[string]any) []string {
 			used := gc.Collect(others, gc.BlobIDs)
 			allRefs := utils.MergeSets(snap.refs, used)
-			candidates := utils.FilterUnreferenced(snap.diskIDs, allRefs)
+			candidates := utils.FilterUnreferenced(slices.Concat(snap.blobIDs, snap.extraIDs), allRefs)
 			slices.Sort(candidates)
 			return slices.Compact(candidates)
 		},
 		Collect: func(ctx context.Context, ids []string) error {
 			return GCCollectBlobs(ctx, cfg.TempDir, cfg.DirOnly, ids, cfg.Removers...)
 		},
+		Usage: func(snap ImageGCSnapshot, ids []string) ([]gc.Usage, error) {
+			collected := utils.SetOf(ids)
+			size := func(u *gc.Usage, hexes []string, path func(string) string) error {
+				for _, hex := range slices.Compact(slices.Sorted(slices.Values(hexes))) {
+					n, err := utils.DirUsage(path(hex))
+					if err != nil {
+						return err
+					}
+					_, ok := collected[hex]
+					u.Add(n, ok)
+				}
+				return nil
+			}
+			blobs := gc.Usage{Type: cfg.BlobType}
+			if err := size(&blobs, snap.blobIDs, cfg.BlobPath); err != nil {
+				return nil, err
+			}
+			usage := []gc.Usage{blobs}
+			if cfg.ExtraPath != nil {
+				extras := gc.Usage{Type: cfg.ExtraType}
+				if err := size(&extras, snap.extraIDs, cfg.ExtraPath); err != nil {
+					return nil, err
+				}
+				usage = append(usage, extras)
+			}
+			temp, err := TempUsage(cfg.TempDir, cfg.DirOnly)
+			if err != nil {
+				return nil, err
+			}
+			return append(usage, temp), nil
+		},
 	}
 }
@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/projecteru2/core/log"
 
+	"github.com/projecteru2/cocoon/gc"
 	"github.com/projecteru2/cocoon/types"
 	"github.com/projecteru2/cocoon/utils"
 )
@@ -143,14 +145,38 @@ func listImages[E Entry](images map[string]*E, typ string, sizer func(*E) int64)
 // GCStaleTemp removes temp entries older than StaleTempAge.
 // Set dirOnly=true to only remove directories (OCI uses dirs, cloudimg uses files).
 func GCStaleTemp(ctx context.Context, dir string, dirOnly bool) []error {
+	return utils.RemoveMatching(ctx, dir, staleTemp(dirOnly))
+}
+
+// TempUsage sizes the entries of temp dir, counting those GCStaleTemp
+// would remove as reclaimable.
+func TempUsage(dir string, dirOnly bool) (gc.Usage, error) {
+	usage := gc.Usage{Type: "temp files"}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return usage, err
+	}
+	stale := staleTemp(dirOnly)
+	for _, e := range entries {
+		n, err := utils.DirUsage(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return usage, err
+		}
+		usage.Add(n, stale(e))
+	}
+	return usage, nil
+}
+
+// staleTemp matches temp entries older than StaleTempAge.
+func staleTemp(dirOnly bool) func(os.DirEntry) bool {
 	cutoff := time.Now().Add(-utils.StaleTempAge)
-	return utils.RemoveMatching(ctx, dir, func(e os.DirEntry) bool {
+	return func(e os.DirEntry) bool {
 		if dirOnly && !e.IsDir() {
 			return false
 		}
 		info, err := e.Info()
 		return err == nil && info.ModTime().Before(cutoff)
-	})
+	}
 }
 
 // GCCollectBlobs removes temp files and blob artifacts by hex ID.
@@ -5,12 +5,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 )
 
 const (
 	erofsBlockSize   = 4096
 	erofsCompression = "lz4hc"
+	// erofsAlign is the size granularity of virtio-pmem backing files.
+	// Blobs are padded to it when written, so they can be attached as
+	// pmem layers as they are.
+	erofsAlign = 2 << 20
 )
 
 // startErofsConversion starts mkfs.erofs to convert a tar stream into an EROFS filesystem.
@@ -44,3 +49,16 @@ func startErofsConversion(ctx context.Context, uuid, outputPath string) (cmd *ex
 	}
 	return cmd, stdin, output, nil
 }
+
+// alignErofs pads the EROFS image at path to a multiple of erofsAlign.
+// EROFS records its own size, so the zero tail is never read.
+func alignErofs(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if rem := info.Size() % erofsAlign; rem != 0 {
+		return os.Truncate(path, info.Size()+erofsAlign-rem)
+	}
+	return nil
+}
@@ -15,14 +15,18 @@ func (o *OCI) GCModule() gc.Module[images.ImageGCSnapshot] {
 		Locker:    o.locker,
 		Store:     o.store,
 		ReadRefs:  func(idx *imageIndex) map[string]struct{} { return images.ReferencedDigests(idx.Images) },
-		ScanDisk:  func() ([]string, error) { return utils.ScanFileStems(o.conf.BlobsDir(), ".erofs") },
+		ScanDisk:  o.conf.ScanBlobs,
 		ExtraDisk: func() ([]string, error) { return utils.ScanSubdirs(o.conf.BootBaseDir()) },
 		Removers: []func(string) error{
 			func(hex string) error { return os.Remove(o.conf.BlobPath(hex)) },
 			func(hex string) error { return os.RemoveAll(o.conf.BootDir(hex)) },
 		},
-		TempDir: o.conf.TempDir(),
-		DirOnly: true,
+		BlobPath:  o.conf.BlobPath,
+		ExtraPath: o.conf.BootDir,
+		BlobType:  "OCI blobs",
+		ExtraType: "boot files",
+		TempDir:   o.conf.TempDir(),
+		DirOnly:   true,
 	})
 }
 
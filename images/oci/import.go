@@ -133,6 +133,9 @@ func processLocalTar(ctx context.Context, conf *Config, idx, total int, tarPath,
 	if scanErr != nil {
 		return fmt.Errorf("scan boot files: %w", scanErr)
 	}
+	if err := alignErofs(tmpErofsPath); err != nil {
+		return fmt.Errorf("align erofs: %w", err)
+	}
 
 	digestHex := hex.EncodeToString(hasher.Sum(nil))
 	result.digest = images.NewDigest(digestHex)
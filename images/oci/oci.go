@@ -10,6 +10,7 @@ import (
 	"github.com/projecteru2/core/log"
 
 	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/events"
 	"github.com/projecteru2/cocoon/images"
 	"github.com/projecteru2/cocoon/lock"
 	"github.com/projecteru2/cocoon/progress"
@@ -69,6 +70,9 @@ func (o *OCI) Pull(ctx context.Context, image string, tracker progress.Tracker)
 	_, err, _ := o.pullGroup.Do(image, func() (any, error) {
 		return nil, pull(ctx, o.conf, o.store, image, tracker)
 	})
+	if err == nil {
+		events.Record(ctx, o.conf.Root, types.Event{Type: types.EventImagePulled, ID: image})
+	}
 	return err
 }
 
@@ -46,6 +46,9 @@ func pull(ctx context.Context, conf *Config, store storage.Store[imageIndex], im
 	if err != nil {
 		return err
 	}
+	if err = conf.CheckBlobRoom(missingLayersSize(conf, layers)); err != nil {
+		return err
+	}
 
 	// Phase 2: lock → idempotency check → process layers → commit.
 	// GC uses the same locker, so it will wait until we finish.
@@ -100,6 +103,22 @@ func pull(ctx context.Context, conf *Config, store storage.Store[imageIndex], im
 	})
 }
 
+// missingLayersSize sums the compressed sizes of the layers without a blob
+// yet, the least their EROFS blobs take.
+func missingLayersSize(conf *Config, layers []v1.Layer) int64 {
+	var size int64
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil || utils.ValidFile(conf.BlobPath(digest.Hex)) {
+			continue
+		}
+		if n, err := layer.Size(); err == nil {
+			size += n
+		}
+	}
+	return size
+}
+
 // fetchImage resolves the image reference, fetches the manifest, and returns
 // the layer descriptors. No lock is held — this is pure network I/O.
 func fetchImage(ctx context.Context, imageRef string) (ref, digestHex string, layers []v1.Layer, err error) {
@@ -456,6 +475,9 @@ func processLayer(ctx context.Context, conf *Config, idx, total int, layer v1.La
 	if scanErr != nil {
 		return fmt.Errorf("scan boot files: %w", scanErr)
 	}
+	if err := alignErofs(erofsPath); err != nil {
+		return fmt.Errorf("align erofs: %w", err)
+	}
 
 	result.kernelPath = kernelPath
 	result.initrdPath = initrdPath
@@ -0,0 +1,49 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// commandStore hands keys to an external program, e.g. a wrapper around a
+// KMS or Vault: "<command> put|get|delete <vm-id>", the key on stdin for
+// put and on stdout for get. An empty get output means no key.
+type commandStore struct {
+	command string
+}
+
+func (s *commandStore) run(ctx context.Context, op, vmID string, stdin []byte) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command, op, vmID) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("keystore command %s %s: %s: %w", op, vmID, strings.TrimSpace(stderr.String()), err)
+	}
+	return out, nil
+}
+
+func (s *commandStore) Put(ctx context.Context, vmID string, key []byte) error {
+	_, err := s.run(ctx, "put", vmID, key)
+	return err
+}
+
+func (s *commandStore) Get(ctx context.Context, vmID string) ([]byte, error) {
+	key, err := s.run(ctx, "get", vmID, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("VM %s: %w", vmID, ErrNotFound)
+	}
+	return key, nil
+}
+
+func (s *commandStore) Delete(ctx context.Context, vmID string) error {
+	_, err := s.run(ctx, "delete", vmID, nil)
+	return err
+}
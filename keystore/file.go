@@ -0,0 +1,55 @@
+package keystore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const keyExt = ".key"
+
+// fileStore keeps each key in a 0600 file of a 0700 directory.
+type fileStore struct {
+	dir string
+	ext string // file extension; empty = keyExt
+}
+
+func (s *fileStore) path(vmID string) string {
+	ext := s.ext
+	if ext == "" {
+		ext = keyExt
+	}
+	return filepath.Join(s.dir, vmID+ext)
+}
+
+func (s *fileStore) Put(_ context.Context, vmID string, key []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("create keystore dir: %w", err)
+	}
+	if err := utils.AtomicWriteFile(s.path(vmID), key, 0o600); err != nil {
+		return fmt.Errorf("store key of VM %s: %w", vmID, err)
+	}
+	return nil
+}
+
+func (s *fileStore) Get(_ context.Context, vmID string) ([]byte, error) {
+	key, err := os.ReadFile(s.path(vmID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("VM %s: %w", vmID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read key of VM %s: %w", vmID, err)
+	}
+	return key, nil
+}
+
+func (s *fileStore) Delete(_ context.Context, vmID string) error {
+	if err := os.Remove(s.path(vmID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove key of VM %s: %w", vmID, err)
+	}
+	return nil
+}
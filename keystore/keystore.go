@@ -0,0 +1,58 @@
+// Package keystore keeps the disk keys of encrypted VMs, and the keys
+// sealing random root passwords (see Seal). A key never enters the VM
+// index: it is handed to a Keystore on create and fetched back when
+// needed, so the record and the disk can sit on shared storage without
+// giving the data away.
+package keystore
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/projecteru2/cocoon/config"
+)
+
+// KeySize is the size in bytes of the keys Generate returns.
+const KeySize = 64
+
+// ErrNotFound is returned by Get when no key is stored for a VM.
+var ErrNotFound = errors.New("key not found")
+
+// Keystore stores one key per VM ID.
+type Keystore interface {
+	// Put stores key for vmID, replacing any key it had.
+	Put(ctx context.Context, vmID string, key []byte) error
+	// Get returns the key of vmID, or ErrNotFound.
+	Get(ctx context.Context, vmID string) ([]byte, error)
+	// Delete forgets the key of vmID; deleting a missing key is not an error.
+	Delete(ctx context.Context, vmID string) error
+}
+
+// New returns the keystore conf.Keystore selects.
+func New(conf *config.Config) (Keystore, error) {
+	switch conf.Keystore {
+	case "", config.KeystoreFile:
+		return &fileStore{dir: Dir(conf)}, nil
+	case config.KeystoreTPM:
+		return &tpmStore{fileStore{dir: Dir(conf), ext: credExt}}, nil
+	case config.KeystoreCommand:
+		return &commandStore{command: conf.KeystoreCommand}, nil
+	default:
+		return nil, fmt.Errorf("unknown keystore %q", conf.Keystore)
+	}
+}
+
+// Dir returns the directory the file and tpm keystores keep keys in.
+func Dir(conf *config.Config) string { return filepath.Join(conf.RootDir, "keys") }
+
+// Generate returns a new random key.
+func Generate() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return key, nil
+}
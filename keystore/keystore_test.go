@@ -0,0 +1,113 @@
+package keystore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+)
+
+func TestKeystore(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "keys.sh")
+	// A command keystore keeping keys as files next to the script.
+	if err := os.WriteFile(script, []byte(`#!/bin/sh
+f="$(dirname "$0")/$2.bin"
+case "$1" in
+put) cat > "$f" ;;
+get) [ ! -f "$f" ] || cat "$f" ;;
+delete) rm -f "$f" ;;
+*) exit 2 ;;
+esac
+`), 0o700); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		conf *config.Config
+	}{
+		{"file", &config.Config{RootDir: t.TempDir()}},
+		{"command", &config.Config{RootDir: t.TempDir(), Keystore: config.KeystoreCommand, KeystoreCommand: script}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks, err := New(tt.conf)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			ctx := t.Context()
+			if _, err = ks.Get(ctx, "vm1"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get missing key: err = %v, want ErrNotFound", err)
+			}
+			key, err := Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = ks.Put(ctx, "vm1", key); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			got, err := ks.Get(ctx, "vm1")
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Errorf("Get returned a different key")
+			}
+			if err = ks.Delete(ctx, "vm1"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if err = ks.Delete(ctx, "vm1"); err != nil {
+				t.Errorf("Delete missing key: %v", err)
+			}
+			if _, err = ks.Get(ctx, "vm1"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestFileStorePerm(t *testing.T) {
+	conf := &config.Config{RootDir: t.TempDir()}
+	ks, err := New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.Put(t.Context(), "vm1", []byte("secret")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(Dir(conf), "vm1"+keyExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("key file mode = %o, want 600", perm)
+	}
+}
+
+func TestSeal(t *testing.T) {
+	key, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("secret")) {
+		t.Fatal("sealed data holds the plaintext")
+	}
+	if plain, err := Open(key, sealed); err != nil || string(plain) != "secret" {
+		t.Fatalf("Open = %q, %v", plain, err)
+	}
+	other, _ := Generate()
+	if _, err := Open(other, sealed); err == nil {
+		t.Error("opened with another key")
+	}
+	if _, err := Open(key, sealed[:4]); err == nil {
+		t.Error("opened truncated data")
+	}
+}
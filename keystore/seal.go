@@ -0,0 +1,53 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Seal encrypts data with key, as returned by Generate, so the result can
+// sit beside a VM record while the key stays in the keystore.
+func Seal(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// Open decrypts data sealed with key.
+func Open(key, sealed []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data is truncated")
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("open sealed data: %w", err)
+	}
+	return plain, nil
+}
+
+// newAEAD returns AES-256-GCM keyed with the first 32 bytes of key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	const aesKeySize = 32
+	if len(key) < aesKeySize {
+		return nil, fmt.Errorf("key is %d bytes, want at least %d", len(key), aesKeySize)
+	}
+	block, err := aes.NewCipher(key[:aesKeySize])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,45 @@
+package keystore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const credExt = ".cred"
+
+// tpmStore keeps each key as a systemd credential sealed to the host TPM:
+// the files are useless on another host or with the TPM reset.
+type tpmStore struct {
+	fileStore
+}
+
+func (s *tpmStore) Put(ctx context.Context, vmID string, key []byte) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("create keystore dir: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, "systemd-creds", "encrypt", "--with-key=tpm2", "--name="+vmID, "-", s.path(vmID)) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(key)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("seal key of VM %s: %s: %w", vmID, strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+func (s *tpmStore) Get(ctx context.Context, vmID string) ([]byte, error) {
+	if _, err := os.Stat(s.path(vmID)); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("VM %s: %w", vmID, ErrNotFound)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "systemd-creds", "decrypt", "--name="+vmID, s.path(vmID), "-") //nolint:gosec
+	cmd.Stderr = &stderr
+	key, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("unseal key of VM %s: %s: %w", vmID, strings.TrimSpace(stderr.String()), err)
+	}
+	return key, nil
+}
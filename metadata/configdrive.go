@@ -0,0 +1,108 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// configDriveLabel is the volume label cloud-init's ConfigDrive datasource
+// looks for; FAT labels are upper case, which it accepts as well.
+const configDriveLabel = "CONFIG-2"
+
+// configDriveDir holds the OpenStack metadata. cloud-init falls back to
+// "latest" when none of the dated versions it knows is present.
+const configDriveDir = "openstack/latest/"
+
+// configDriveMeta is openstack/latest/meta_data.json.
+type configDriveMeta struct {
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+}
+
+// configDriveNetwork is openstack/latest/network_data.json.
+type configDriveNetwork struct {
+	Links    []configDriveLink    `json:"links"`
+	Networks []configDriveNet     `json:"networks"`
+	Services []configDriveService `json:"services"`
+}
+
+type configDriveLink struct {
+	ID   string `json:"id"`
+	Name string `json:"name"` // pins the guest name like set-name in network-config
+	Type string `json:"type"`
+	Mac  string `json:"ethernet_mac_address"`
+	MTU  int    `json:"mtu,omitempty"`
+}
+
+type configDriveNet struct {
+	ID      string             `json:"id"`
+	Type    string             `json:"type"` // "ipv4" or "ipv4_dhcp"
+	Link    string             `json:"link"`
+	IP      string             `json:"ip_address,omitempty"`
+	Netmask string             `json:"netmask,omitempty"`
+	Routes  []configDriveRoute `json:"routes,omitempty"`
+}
+
+type configDriveRoute struct {
+	Network string `json:"network"`
+	Netmask string `json:"netmask"`
+	Gateway string `json:"gateway"`
+}
+
+type configDriveService struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+// configDrive lays out the rendered NoCloud files as an OpenStack
+// ConfigDrive: meta-data becomes meta_data.json, user-data is kept as is
+// and network-config is translated to network_data.json.
+func configDrive(cfg *Config, nocloud map[string][]byte) (map[string][]byte, error) {
+	hostname := cfg.Hostname
+	if cfg.FQDN != "" {
+		hostname = cfg.FQDN
+	}
+	meta, err := json.Marshal(configDriveMeta{UUID: cfg.InstanceID, Name: cfg.Hostname, Hostname: hostname})
+	if err != nil {
+		return nil, fmt.Errorf("render meta_data.json: %w", err)
+	}
+	files := map[string][]byte{
+		configDriveDir + "meta_data.json": meta,
+		configDriveDir + "user_data":      nocloud["user-data"],
+	}
+	if len(cfg.Networks) == 0 {
+		return files, nil
+	}
+
+	nd := configDriveNetwork{Services: []configDriveService{}}
+	for i, n := range cfg.Networks {
+		name := fmt.Sprintf("eth%d", i)
+		nd.Links = append(nd.Links, configDriveLink{ID: name, Name: name, Type: "phy", Mac: n.Mac, MTU: n.MTU})
+		nw := configDriveNet{ID: fmt.Sprintf("network%d", i), Type: "ipv4_dhcp", Link: name}
+		if n.IP != "" {
+			nw.Type = "ipv4"
+			nw.IP = n.IP
+			nw.Netmask = net4Mask(n.Prefix)
+			if n.Gateway != "" {
+				nw.Routes = []configDriveRoute{{Network: "0.0.0.0", Netmask: "0.0.0.0", Gateway: n.Gateway}}
+			}
+		}
+		nd.Networks = append(nd.Networks, nw)
+	}
+	for _, dns := range cfg.DNS {
+		nd.Services = append(nd.Services, configDriveService{Type: "dns", Address: dns})
+	}
+	data, err := json.Marshal(nd)
+	if err != nil {
+		return nil, fmt.Errorf("render network_data.json: %w", err)
+	}
+	files[configDriveDir+"network_data.json"] = data
+	return files, nil
+}
+
+// net4Mask returns an IPv4 prefix length as a dotted netmask.
+func net4Mask(prefix int) string {
+	return net.IP(net.CIDRMask(prefix, 32)).String() //nolint:mnd
+}
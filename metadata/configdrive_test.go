@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestGenerate_ConfigDrive(t *testing.T) {
+	cfg := &Config{
+		InstanceID: "vm-1",
+		Hostname:   "web1",
+		FQDN:       "web1.example.com",
+		Networks: []NetworkInfo{
+			{IP: "10.0.0.2", Prefix: 24, Gateway: "10.0.0.1", Mac: "aa:bb:cc:dd:ee:01", MTU: 9000},
+			{Mac: "aa:bb:cc:dd:ee:02"},
+		},
+		DNS:    []string{"8.8.8.8"},
+		Format: types.MetadataConfigDrive,
+	}
+	var buf bytes.Buffer
+	if err := Generate(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+	if label := img[43:54]; string(label) != "CONFIG-2   " {
+		t.Errorf("volume label = %q", label)
+	}
+
+	var meta configDriveMeta
+	if err := json.Unmarshal(readFAT12(t, img, "openstack/latest/meta_data.json"), &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta != (configDriveMeta{UUID: "vm-1", Name: "web1", Hostname: "web1.example.com"}) {
+		t.Errorf("meta_data.json = %+v", meta)
+	}
+
+	files, err := Render(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFAT12(t, img, "openstack/latest/user_data"); !bytes.Equal(got, files["user-data"]) {
+		t.Errorf("user_data differs from the NoCloud user-data:\n%s", got)
+	}
+
+	var nd configDriveNetwork
+	if err := json.Unmarshal(readFAT12(t, img, "openstack/latest/network_data.json"), &nd); err != nil {
+		t.Fatal(err)
+	}
+	if len(nd.Links) != 2 || nd.Links[0] != (configDriveLink{ID: "eth0", Name: "eth0", Type: "phy", Mac: "aa:bb:cc:dd:ee:01", MTU: 9000}) {
+		t.Errorf("links = %+v", nd.Links)
+	}
+	if len(nd.Networks) != 2 {
+		t.Fatalf("networks = %+v", nd.Networks)
+	}
+	if n := nd.Networks[0]; n.Type != "ipv4" || n.IP != "10.0.0.2" || n.Netmask != "255.255.255.0" ||
+		len(n.Routes) != 1 || n.Routes[0].Gateway != "10.0.0.1" {
+		t.Errorf("static network = %+v", n)
+	}
+	if n := nd.Networks[1]; n.Type != "ipv4_dhcp" || n.Link != "eth1" {
+		t.Errorf("dhcp network = %+v", n)
+	}
+	if len(nd.Services) != 1 || nd.Services[0] != (configDriveService{Type: "dns", Address: "8.8.8.8"}) {
+		t.Errorf("services = %+v", nd.Services)
+	}
+}
@@ -0,0 +1,70 @@
+package metadata
+
+import (
+	"os"
+	"strings"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// Guest paths of the files carrying --env: systemd passes DefaultEnvironment
+// to every service, and login shells source profile.d.
+const (
+	envSystemdPath = "/etc/systemd/system.conf.d/90-cocoon-env.conf"
+	envProfilePath = "/etc/profile.d/90-cocoon-env.sh"
+)
+
+// EnvFiles returns the guest files that set env, a list of KEY=VALUE
+// entries, for the guest's services and login shells; nil when empty.
+func EnvFiles(env []string) []types.GuestFile {
+	if len(env) == 0 {
+		return nil
+	}
+	var systemd, profile strings.Builder
+	systemd.WriteString("[Manager]\nDefaultEnvironment=")
+	for i, e := range env {
+		k, v, _ := strings.Cut(e, "=")
+		if i > 0 {
+			systemd.WriteByte(' ')
+		}
+		systemd.WriteString(`"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(e) + `"`)
+		profile.WriteString("export " + k + "='" + strings.ReplaceAll(v, "'", `'\''`) + "'\n")
+	}
+	systemd.WriteByte('\n')
+	return []types.GuestFile{
+		{Path: envSystemdPath, Mode: 0o644, Content: []byte(systemd.String())}, //nolint:mnd
+		{Path: envProfilePath, Mode: 0o644, Content: []byte(profile.String())}, //nolint:mnd
+	}
+}
+
+// GuestFiles returns every file cfg places in the guest: its --copy-in
+// files, read back from where they are stored, then those carrying its
+// --env.
+func GuestFiles(cfg *types.VMConfig) ([]types.GuestFile, error) {
+	files, err := InlineGuestFiles(cfg.Files)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, EnvFiles(cfg.Env)...), nil
+}
+
+// LocaleFiles returns the guest files that set timezone and locale in an
+// image without cloud-init: /etc/localtime as a symlink into the image's
+// zoneinfo, /etc/timezone, and the LANG files read by systemd and PAM.
+func LocaleFiles(timezone, locale string) []types.GuestFile {
+	var files []types.GuestFile
+	if timezone != "" {
+		files = append(files,
+			types.GuestFile{Path: "/etc/localtime", Mode: os.ModeSymlink | 0o777, Content: []byte("/usr/share/zoneinfo/" + timezone)}, //nolint:mnd
+			types.GuestFile{Path: "/etc/timezone", Mode: 0o644, Content: []byte(timezone + "\n")},                                     //nolint:mnd
+		)
+	}
+	if locale != "" {
+		lang := []byte("LANG=" + locale + "\n")
+		files = append(files,
+			types.GuestFile{Path: "/etc/default/locale", Mode: 0o644, Content: lang}, //nolint:mnd
+			types.GuestFile{Path: "/etc/locale.conf", Mode: 0o644, Content: lang},    //nolint:mnd
+		)
+	}
+	return files
+}
@@ -0,0 +1,58 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestEnvFiles(t *testing.T) {
+	if files := EnvFiles(nil); files != nil {
+		t.Errorf("EnvFiles(nil) = %+v, want nil", files)
+	}
+	files := EnvFiles([]string{"FOO=bar", `MSG=it's "ok" \o/`})
+	if len(files) != 2 {
+		t.Fatalf("EnvFiles = %+v, want 2 files", files)
+	}
+	want := map[string]string{
+		envSystemdPath: "[Manager]\nDefaultEnvironment=\"FOO=bar\" \"MSG=it's \\\"ok\\\" \\\\o/\"\n",
+		envProfilePath: "export FOO='bar'\nexport MSG='it'\\''s \"ok\" \\o/'\n",
+	}
+	for _, f := range files {
+		if got := string(f.Content); got != want[f.Path] {
+			t.Errorf("%s = %q, want %q", f.Path, got, want[f.Path])
+		}
+		if f.Mode != 0o644 {
+			t.Errorf("%s mode = %o, want 644", f.Path, f.Mode)
+		}
+	}
+}
+
+func TestStoreGuestFiles(t *testing.T) {
+	files := []types.GuestFile{{Path: "/etc/app.conf", Mode: 0o640, Content: []byte("x=1\n")}}
+	stored, err := StoreGuestFiles(t.TempDir(), files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := stored[0]; f.Content != nil || f.Source == "" || f.Path != "/etc/app.conf" || f.Mode != 0o640 {
+		t.Fatalf("stored = %+v, want a reference", f)
+	}
+	// A second VM gets its own copy of the contents.
+	copied, err := StoreGuestFiles(t.TempDir(), stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied[0].Source == stored[0].Source {
+		t.Errorf("copy shares %s", copied[0].Source)
+	}
+	got, err := GuestFiles(&types.VMConfig{Files: copied, Env: []string{"A=b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || string(got[0].Content) != "x=1\n" || got[0].Source != "" {
+		t.Errorf("GuestFiles = %+v", got)
+	}
+	if _, err := GuestFiles(&types.VMConfig{Files: []types.GuestFile{{Path: "/x", Source: "/nonexistent"}}}); err == nil {
+		t.Error("expected error for a missing source")
+	}
+}
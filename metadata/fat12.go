@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"path"
 	"sort"
 	"strings"
 	"time"
@@ -27,7 +28,9 @@ const (
 )
 
 // CreateFAT12 streams a 1 MiB FAT12 image with VFAT long-filename support to w.
-// label is the volume label (e.g. "CIDATA"); files maps filename → content.
+// label is the volume label (e.g. "CIDATA"); files maps filename → content,
+// where a name containing "/" (e.g. "openstack/latest/user_data") is placed
+// in subdirectories created as needed.
 func CreateFAT12(w io.Writer, label string, files map[string][]byte) error {
 	b := newFAT12Builder(label)
 
@@ -46,15 +49,15 @@ func CreateFAT12(w io.Writer, label string, files map[string][]byte) error {
 	return b.writeTo(w)
 }
 
-// fat12Builder constructs a FAT12 image in memory (FAT + root dir only)
+// fat12Builder constructs a FAT12 image in memory (FAT + directories only)
 // and streams the full image on writeTo.
 type fat12Builder struct {
 	label       string
 	fat         []byte      // single FAT copy (written twice)
 	rootDir     []byte      // root directory area
+	root        *fatDir     // root directory tree
 	data        []dataEntry // file data in cluster-allocation order
 	nextCluster uint16      // next free cluster (starts at 2)
-	rootUsed    int         // root directory entries consumed
 	shortSeq    int         // counter for ~N short-name suffixes
 }
 
@@ -63,11 +66,23 @@ type dataEntry struct {
 	numClusters int
 }
 
+// fatDir is a directory being built. The root directory lives in the fixed
+// root area; a subdirectory is a cluster chain that grows one cluster at a
+// time as entries are added.
+type fatDir struct {
+	cluster  uint16   // first cluster; 0 = root directory
+	last     uint16   // last cluster of the chain
+	sectors  [][]byte // subdirectory contents, one per cluster
+	used     int      // directory entries consumed
+	children map[string]*fatDir
+}
+
 func newFAT12Builder(label string) *fat12Builder {
 	b := &fat12Builder{
 		label:       label,
 		fat:         make([]byte, sectorsPerFAT*sectorSize),
 		rootDir:     make([]byte, rootEntryCount*dirEntrySize),
+		root:        &fatDir{children: map[string]*fatDir{}},
 		nextCluster: 2, //nolint:mnd
 	}
 	// Reserved FAT entries.
@@ -79,68 +94,152 @@ func newFAT12Builder(label string) *fat12Builder {
 
 // addVolumeLabel writes the volume-label directory entry (attribute 0x08).
 func (b *fat12Builder) addVolumeLabel() {
+	entry := make([]byte, dirEntrySize)
 	name := padLabel(b.label)
-	off := b.rootUsed * dirEntrySize
-	copy(b.rootDir[off:], name[:])
-	b.rootDir[off+11] = 0x08 //nolint:mnd
-	putTimestamps(b.rootDir[off:], time.Now())
-	b.rootUsed++
+	copy(entry, name[:])
+	entry[11] = 0x08 //nolint:mnd
+	putTimestamps(entry, time.Now())
+	_ = b.putEntry(b.root, entry)
 }
 
-// addFile registers a file: allocates FAT clusters, writes LFN + SFN directory entries.
+// addFile registers a file: allocates FAT clusters, writes LFN + SFN
+// directory entries into its directory, creating the directory if needed.
 func (b *fat12Builder) addFile(name string, content []byte) error {
+	dirName, base := path.Split(name)
+	dir, err := b.mkdirAll(strings.Trim(dirName, "/"))
+	if err != nil {
+		return err
+	}
 	numClusters := (len(content) + sectorSize - 1) / sectorSize
 
 	var startCluster uint16
 	if numClusters > 0 {
-		if int(b.nextCluster)+numClusters > (totalSectors-firstDataSec)+2 { //nolint:mnd
-			return fmt.Errorf("fat12: not enough space for %s", name)
+		if startCluster, err = b.allocClusters(numClusters, name); err != nil {
+			return err
 		}
-		startCluster = b.nextCluster
-		for i := range numClusters {
-			c := int(b.nextCluster) + i
-			if i == numClusters-1 {
-				setFATEntry(b.fat, c, fatEntryEOC)
-			} else {
-				setFATEntry(b.fat, c, uint16(c+1)) //nolint:gosec
+		b.data = append(b.data, dataEntry{data: content, numClusters: numClusters})
+	}
+	return b.addEntry(dir, base, 0x20, startCluster, uint32(len(content))) //nolint:mnd,gosec // archive
+}
+
+// mkdirAll returns the directory at p ("" = root), creating missing
+// directories along the way.
+func (b *fat12Builder) mkdirAll(p string) (*fatDir, error) {
+	dir := b.root
+	if p == "" {
+		return dir, nil
+	}
+	for elem := range strings.SplitSeq(p, "/") {
+		child, ok := dir.children[elem]
+		if !ok {
+			cluster, err := b.allocClusters(1, p)
+			if err != nil {
+				return nil, err
+			}
+			child = &fatDir{cluster: cluster, last: cluster, children: map[string]*fatDir{}}
+			child.sectors = append(child.sectors, make([]byte, sectorSize))
+			b.data = append(b.data, dataEntry{data: child.sectors[0], numClusters: 1})
+
+			// "." and ".." come first; ".." of a top-level directory is 0.
+			if err := b.putEntry(child, dotEntry(".", cluster)); err != nil {
+				return nil, err
 			}
+			if err := b.putEntry(child, dotEntry("..", dir.cluster)); err != nil {
+				return nil, err
+			}
+			if err := b.addEntry(dir, elem, 0x10, cluster, 0); err != nil { //nolint:mnd // directory
+				return nil, err
+			}
+			dir.children[elem] = child
 		}
-		b.data = append(b.data, dataEntry{data: content, numClusters: numClusters})
-		b.nextCluster += uint16(numClusters)
+		dir = child
 	}
+	return dir, nil
+}
+
+// allocClusters reserves n consecutive clusters chained in the FAT and
+// returns the first. The caller appends the matching dataEntry.
+func (b *fat12Builder) allocClusters(n int, name string) (uint16, error) {
+	if int(b.nextCluster)+n > (totalSectors-firstDataSec)+2 { //nolint:mnd
+		return 0, fmt.Errorf("fat12: not enough space for %s", name)
+	}
+	start := b.nextCluster
+	for i := range n {
+		c := int(start) + i
+		if i == n-1 {
+			setFATEntry(b.fat, c, fatEntryEOC)
+		} else {
+			setFATEntry(b.fat, c, uint16(c+1)) //nolint:gosec
+		}
+	}
+	b.nextCluster += uint16(n) //nolint:gosec
+	return start, nil
+}
 
+// addEntry writes the directory entries for name into dir: LFN entries
+// when the name does not fit 8.3, then the SFN entry.
+func (b *fat12Builder) addEntry(dir *fatDir, name string, attr byte, startCluster uint16, size uint32) error {
 	// Generate 8.3 short name — with ~N suffix when LFN is needed.
-	lfn := needsLFN(name)
 	var shortName [11]byte
-	if lfn {
+	if needsLFN(name) {
 		b.shortSeq++
 		shortName = generateShortName(name, b.shortSeq)
-		lfnEntries := makeLFNEntries(name, shortName)
-		for _, entry := range lfnEntries {
-			if b.rootUsed >= rootEntryCount {
-				return fmt.Errorf("fat12: root directory full")
+		for _, entry := range makeLFNEntries(name, shortName) {
+			if err := b.putEntry(dir, entry); err != nil {
+				return err
 			}
-			off := b.rootUsed * dirEntrySize
-			copy(b.rootDir[off:], entry)
-			b.rootUsed++
 		}
 	} else {
 		shortName = toShortName(name)
 	}
 
-	if b.rootUsed >= rootEntryCount {
-		return fmt.Errorf("fat12: root directory full")
+	entry := make([]byte, dirEntrySize)
+	copy(entry, shortName[:])
+	entry[11] = attr
+	putTimestamps(entry, time.Now())
+	binary.LittleEndian.PutUint16(entry[26:], startCluster) //nolint:mnd
+	binary.LittleEndian.PutUint32(entry[28:], size)         //nolint:mnd
+	return b.putEntry(dir, entry)
+}
+
+// putEntry appends one 32-byte entry to dir. The root directory is capped
+// at rootEntryCount; a subdirectory chains another cluster when full.
+func (b *fat12Builder) putEntry(dir *fatDir, entry []byte) error {
+	if dir == b.root {
+		if dir.used >= rootEntryCount {
+			return fmt.Errorf("fat12: root directory full")
+		}
+		copy(b.rootDir[dir.used*dirEntrySize:], entry)
+		dir.used++
+		return nil
 	}
-	off := b.rootUsed * dirEntrySize
-	copy(b.rootDir[off:], shortName[:])
-	b.rootDir[off+11] = 0x20 // archive //nolint:mnd
-	putTimestamps(b.rootDir[off:], time.Now())
-	binary.LittleEndian.PutUint16(b.rootDir[off+26:], startCluster)         //nolint:mnd
-	binary.LittleEndian.PutUint32(b.rootDir[off+28:], uint32(len(content))) //nolint:mnd,gosec
-	b.rootUsed++
+	const perCluster = sectorSize / dirEntrySize
+	if dir.used == len(dir.sectors)*perCluster {
+		cluster, err := b.allocClusters(1, "directory")
+		if err != nil {
+			return err
+		}
+		setFATEntry(b.fat, int(dir.last), cluster)
+		dir.last = cluster
+		dir.sectors = append(dir.sectors, make([]byte, sectorSize))
+		b.data = append(b.data, dataEntry{data: dir.sectors[len(dir.sectors)-1], numClusters: 1})
+	}
+	copy(dir.sectors[dir.used/perCluster][dir.used%perCluster*dirEntrySize:], entry)
+	dir.used++
 	return nil
 }
 
+// dotEntry builds the "." or ".." entry of a subdirectory.
+func dotEntry(name string, cluster uint16) []byte {
+	entry := make([]byte, dirEntrySize)
+	copy(entry, "           ")
+	copy(entry, name)
+	entry[11] = 0x10 //nolint:mnd
+	putTimestamps(entry, time.Now())
+	binary.LittleEndian.PutUint16(entry[26:], cluster) //nolint:mnd
+	return entry
+}
+
 // writeTo streams: boot sector → FAT ×2 → root directory → data → zero padding.
 func (b *fat12Builder) writeTo(w io.Writer) error {
 	if _, err := w.Write(b.makeBootSector()); err != nil {
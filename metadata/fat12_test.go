@@ -0,0 +1,107 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// readFAT12 returns the file at path ("dir/name") of a CreateFAT12 image,
+// following LFN names and cluster chains the way a guest would.
+func readFAT12(t *testing.T, img []byte, path string) []byte {
+	t.Helper()
+	fat := img[reservedSec*sectorSize:]
+	chain := func(start uint16, size int) []byte {
+		var out []byte
+		for c := int(start); c >= 2 && c < fatEntryEOC; { //nolint:mnd
+			off := (firstDataSec + c - 2) * sectorSize //nolint:mnd
+			out = append(out, img[off:off+sectorSize]...)
+			word := binary.LittleEndian.Uint16(fat[c+c/2:])
+			if c%2 == 0 {
+				c = int(word & 0x0FFF)
+			} else {
+				c = int(word >> 4)
+			}
+		}
+		if size >= 0 {
+			out = out[:size]
+		}
+		return out
+	}
+	dir := img[firstDataSec*sectorSize-rootDirSectors*sectorSize : firstDataSec*sectorSize]
+	elems := strings.Split(path, "/")
+	for i, elem := range elems {
+		var (
+			lfn   []uint16
+			found bool
+		)
+		for off := 0; off+dirEntrySize <= len(dir) && dir[off] != 0; off += dirEntrySize {
+			e := dir[off : off+dirEntrySize]
+			if e[11] == 0x0F {
+				var part []uint16
+				for _, r := range [][2]int{{1, 11}, {14, 26}, {28, 32}} {
+					for j := r[0]; j < r[1]; j += 2 {
+						part = append(part, binary.LittleEndian.Uint16(e[j:]))
+					}
+				}
+				lfn = append(part, lfn...)
+				continue
+			}
+			name := strings.TrimSpace(string(e[:8]))
+			if ext := strings.TrimSpace(string(e[8:11])); ext != "" {
+				name += "." + ext
+			}
+			if lfn != nil {
+				if end := slices.Index(lfn, 0); end >= 0 {
+					lfn = lfn[:end]
+				}
+				name = string(utf16.Decode(lfn))
+				lfn = nil
+			}
+			if name != elem {
+				continue
+			}
+			start := binary.LittleEndian.Uint16(e[26:])
+			if i == len(elems)-1 {
+				return chain(start, int(binary.LittleEndian.Uint32(e[28:])))
+			}
+			if e[11]&0x10 == 0 {
+				t.Fatalf("%s: %s is not a directory", path, elem)
+			}
+			dir, found = chain(start, -1), true
+			break
+		}
+		if !found {
+			t.Fatalf("%s: %s not found", path, elem)
+		}
+	}
+	return nil
+}
+
+func TestCreateFAT12_Subdirectories(t *testing.T) {
+	files := map[string][]byte{
+		"top.txt":                         []byte("top"),
+		"openstack/latest/meta_data.json": []byte(`{"uuid":"x"}`),
+		"openstack/latest/user_data":      bytes.Repeat([]byte("u"), 3*sectorSize+7),
+	}
+	// Enough long names to push a subdirectory past its first cluster.
+	for i := range 10 {
+		files[fmt.Sprintf("openstack/many/long-file-name-%02d.json", i)] = fmt.Appendf(nil, "file %d", i)
+	}
+	var buf bytes.Buffer
+	if err := CreateFAT12(&buf, configDriveLabel, files); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != totalSectors*sectorSize {
+		t.Fatalf("image size = %d", buf.Len())
+	}
+	for name, want := range files {
+		if got := readFAT12(t, buf.Bytes(), name); !bytes.Equal(got, want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// StoreGuestFiles writes the contents of files into dir, each named by its
+// SHA-256, and returns the files referring to them through Source, so a VM
+// record keeps paths instead of contents. Files already stored elsewhere
+// are copied, so each VM owns its contents.
+func StoreGuestFiles(dir string, files []types.GuestFile) ([]types.GuestFile, error) {
+	if len(files) == 0 {
+		return files, nil
+	}
+	files, err := InlineGuestFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.EnsureDirs(dir); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	out := make([]types.GuestFile, 0, len(files))
+	for _, f := range files {
+		sum := sha256.Sum256(f.Content)
+		path := filepath.Join(dir, hex.EncodeToString(sum[:]))
+		if err := utils.AtomicWriteFile(path, f.Content, 0o600); err != nil { //nolint:mnd
+			return nil, fmt.Errorf("store %s: %w", f.Path, err)
+		}
+		out = append(out, types.GuestFile{Path: f.Path, Mode: f.Mode, Source: path})
+	}
+	return out, nil
+}
+
+// InlineGuestFiles returns files with the contents of those stored by
+// StoreGuestFiles read back into Content.
+func InlineGuestFiles(files []types.GuestFile) ([]types.GuestFile, error) {
+	out := make([]types.GuestFile, 0, len(files))
+	for _, f := range files {
+		if f.Source != "" {
+			content, err := os.ReadFile(f.Source)
+			if err != nil {
+				return nil, fmt.Errorf("read contents of %s: %w", f.Path, err)
+			}
+			f.Content, f.Source = content, ""
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
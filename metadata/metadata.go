@@ -2,10 +2,13 @@ package metadata
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"strings"
 	"text/template"
+
+	"github.com/projecteru2/cocoon/types"
 )
 
 const cidataLabel = "CIDATA"
@@ -16,6 +19,7 @@ var (
 		"yamlQuote": func(s string) string {
 			return strings.ReplaceAll(s, "'", "''")
 		},
+		"base64": base64.StdEncoding.EncodeToString,
 	}
 
 	metaDataTmpl = template.Must(template.New("meta-data").Parse(
@@ -28,15 +32,50 @@ var (
 	userDataTmpl = template.Must(template.New("user-data").Funcs(tmplFuncs).Parse(`#cloud-config
 warnings:
   dsid_missing_source: off
+{{- if .FQDN}}
+fqdn: {{.FQDN}}
+{{- end}}
+{{- if .Timezone}}
+timezone: '{{yamlQuote .Timezone}}'
+{{- end}}
+{{- if .Locale}}
+locale: '{{yamlQuote .Locale}}'
+{{- end}}
+# Grow the root partition and filesystem into a --storage larger than the
+# base image; some images turn these off in their own cloud.cfg.
+growpart:
+  mode: auto
+resize_rootfs: true
+# Trim freed blocks weekly so the host's sparse overlay shrinks with them.
+runcmd:
+  - [systemctl, enable, --now, fstrim.timer]
+{{- range .RunCmds}}
+  - '{{yamlQuote .}}'
+{{- end}}
+{{- if .SwapDevice}}
+# The host formats the swap disk; mounts adds it to fstab and swaps on.
+mounts:
+  - ['{{yamlQuote .SwapDevice}}', none, swap, sw, '0', '0']
+{{- end}}
+{{- if .SSHKeys}}
+# cloud-init installs these for the default user and, with disable_root
+# off, for root as well.
+ssh_authorized_keys:
+{{- range .SSHKeys}}
+  - '{{yamlQuote .}}'
+{{- end}}
+{{- end}}
 {{- if .RootPassword}}
 chpasswd:
   expire: false
   list:
     - 'root:{{yamlQuote .RootPassword}}'
 ssh_pwauth: true
+{{- end}}
+{{- if or .RootPassword .SSHKeys}}
 disable_root: false
 {{- end}}
-{{- if .Networks}}
+{{- if or .Networks .Files}}
 write_files:
 {{- range $i, $n := .Networks}}
   - path: /etc/systemd/network/15-cocoon-id{{$i}}.network
@@ -63,6 +102,17 @@ write_files:
 {{- else}}
       RequiredForOnline=no
 {{- end}}
+{{- if $n.MTU}}
+
+      [Link]
+      MTUBytes={{$n.MTU}}
+{{- end}}
+{{- end}}
+{{- range .Files}}
+  - path: '{{yamlQuote .Path}}'
+    permissions: '{{printf "%04o" .Mode}}'
+    encoding: b64
+    content: {{base64 .Content}}
 {{- end}}
 {{- end}}
 `))
@@ -73,12 +123,17 @@ write_files:
 	//   - systemd-networkd configures interfaces before network-online.target
 	// Clone reinit fallback for netplan PERM-MAC mismatch is provided by
 	// user-data write_files that emit direct systemd-networkd units.
+	// set-name pins NIC i to eth{i} so guest names follow the VM's NIC order.
 	networkConfigTmpl = template.Must(template.New("network-config").Parse(`version: 2
 ethernets:
 {{- range $i, $n := .Networks}}
   id{{$i}}:
     match:
       macaddress: "{{$n.Mac}}"
+    set-name: eth{{$i}}
+{{- if $n.MTU}}
+    mtu: {{$n.MTU}}
+{{- end}}
 {{- if $n.IP}}
     addresses:
       - {{$n.IP}}/{{$n.Prefix}}
@@ -104,10 +159,23 @@ ethernets:
 // Config holds the inputs for generating cloud-init NoCloud metadata.
 type Config struct {
 	InstanceID   string
+	VMName       string
 	Hostname     string
+	FQDN         string // empty = cloud-init derives it from Hostname
+	Timezone     string // tz database name; empty = the image's
+	Locale       string // e.g. "en_US.UTF-8"; empty = the image's
 	RootPassword string
+	SSHKeys      []string // authorized_keys lines for the default user and root
 	Networks     []NetworkInfo
 	DNS          []string // e.g. ["8.8.8.8", "8.8.4.4"]
+	SwapDevice   string   // swap disk the guest enables via fstab; empty = none
+	Files        []types.GuestFile
+	RunCmds      []string // shell commands run once, after the generated ones
+	Format       types.MetadataFormat
+
+	UserData         string // user-supplied user-data, merged into the generated cloud-config
+	ReplaceUserData  bool   // UserData replaces the generated user-data instead
+	TemplateUserData bool   // UserData is a Go template over UserDataVars
 }
 
 // NetworkInfo describes a single guest network interface for cloud-init.
@@ -116,31 +184,52 @@ type NetworkInfo struct {
 	Prefix  int    // CIDR prefix length, e.g. 24
 	Gateway string // e.g. "10.0.0.1"
 	Mac     string // MAC address for match:macaddress in network-config
+	MTU     int    // --mtu override; 0 leaves the guest's default
 }
 
-// Generate streams a cloud-init NoCloud cidata disk image (FAT12) to w.
+// Generate streams a cloud-init cidata disk image (FAT12) to w: the NoCloud
+// files, or the same metadata laid out as an OpenStack ConfigDrive.
 func Generate(w io.Writer, cfg *Config) error {
+	files, err := Render(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Format == types.MetadataConfigDrive {
+		if files, err = configDrive(cfg, files); err != nil {
+			return err
+		}
+		return CreateFAT12(w, configDriveLabel, files)
+	}
+	return CreateFAT12(w, cidataLabel, files)
+}
+
+// Render returns the NoCloud files for cfg by name: meta-data, user-data
+// and, when cfg has networks, network-config.
+func Render(cfg *Config) (map[string][]byte, error) {
 	files := make(map[string][]byte, 3) //nolint:mnd
 
 	var buf bytes.Buffer
 	if err := metaDataTmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("render meta-data: %w", err)
+		return nil, fmt.Errorf("render meta-data: %w", err)
 	}
 	files["meta-data"] = bytes.Clone(buf.Bytes())
 
 	buf.Reset()
 	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
-		return fmt.Errorf("render user-data: %w", err)
+		return nil, fmt.Errorf("render user-data: %w", err)
+	}
+	userData, err := renderUserData(bytes.Clone(buf.Bytes()), cfg)
+	if err != nil {
+		return nil, err
 	}
-	files["user-data"] = bytes.Clone(buf.Bytes())
+	files["user-data"] = userData
 
 	if len(cfg.Networks) > 0 {
 		buf.Reset()
 		if err := networkConfigTmpl.Execute(&buf, cfg); err != nil {
-			return fmt.Errorf("render network-config: %w", err)
+			return nil, fmt.Errorf("render network-config: %w", err)
 		}
 		files["network-config"] = bytes.Clone(buf.Bytes())
 	}
-
-	return CreateFAT12(w, cidataLabel, files)
+	return files, nil
 }
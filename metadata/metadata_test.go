@@ -2,8 +2,13 @@ package metadata
 
 import (
 	"bytes"
+	"encoding/base64"
 	"strings"
 	"testing"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/projecteru2/cocoon/types"
 )
 
 func TestUserData_NoBootcmd(t *testing.T) {
@@ -29,6 +34,9 @@ func TestUserData_NoBootcmd(t *testing.T) {
 	if !strings.Contains(out, "dsid_missing_source: off") {
 		t.Errorf("cloud-init warning suppression missing: %s", out)
 	}
+	if !strings.Contains(out, "fstrim.timer") {
+		t.Errorf("periodic trim missing: %s", out)
+	}
 	if !strings.Contains(out, "write_files:") {
 		t.Errorf("write_files missing: %s", out)
 	}
@@ -136,6 +144,9 @@ func TestNetworkConfig_MultiNIC(t *testing.T) {
 	if !strings.Contains(out, `macaddress: "11:22:33:44:55:66"`) {
 		t.Errorf("second MAC missing: %s", out)
 	}
+	if !strings.Contains(out, "set-name: eth0") || !strings.Contains(out, "set-name: eth1") {
+		t.Errorf("NIC names missing: %s", out)
+	}
 	if !strings.Contains(out, "10.0.0.2/16") {
 		t.Errorf("first IP missing: %s", out)
 	}
@@ -245,3 +256,116 @@ func TestGenerate_NoNetworks(t *testing.T) {
 		t.Error("write_files should not appear without networks")
 	}
 }
+
+func TestMTU(t *testing.T) {
+	cfg := &Config{
+		Networks: []NetworkInfo{
+			{IP: "10.0.0.2", Prefix: 24, Mac: "aa:bb:cc:dd:ee:f0", MTU: 1400},
+			{Mac: "11:22:33:44:55:66"},
+		},
+	}
+
+	var nc bytes.Buffer
+	if err := networkConfigTmpl.Execute(&nc, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(nc.String(), "mtu: 1400"); got != 1 {
+		t.Errorf("network-config has %d mtu entries, want 1: %s", got, nc.String())
+	}
+
+	var ud bytes.Buffer
+	if err := userDataTmpl.Execute(&ud, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(ud.String(), "MTUBytes=1400"); got != 1 {
+		t.Errorf("user-data has %d MTUBytes entries, want 1: %s", got, ud.String())
+	}
+}
+
+func TestUserData_Swap(t *testing.T) {
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "mounts:") {
+		t.Errorf("mounts without a swap disk: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := userDataTmpl.Execute(&buf, &Config{SwapDevice: "/dev/disk/by-id/virtio-cocoon-swap"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "- ['/dev/disk/by-id/virtio-cocoon-swap', none, swap, sw, '0', '0']") {
+		t.Errorf("swap fstab entry missing: %s", buf.String())
+	}
+}
+
+func TestUserData_FQDN(t *testing.T) {
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, &Config{Hostname: "web1", FQDN: "web1.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\nfqdn: web1.example.com\n") {
+		t.Errorf("fqdn missing: %s", buf.String())
+	}
+	buf.Reset()
+	if err := userDataTmpl.Execute(&buf, &Config{Hostname: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "fqdn:") {
+		t.Errorf("fqdn set without a domain: %s", buf.String())
+	}
+}
+
+func TestUserData_TimezoneLocale(t *testing.T) {
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, &Config{Timezone: "Europe/Berlin", Locale: "de_DE.UTF-8"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "\ntimezone: 'Europe/Berlin'\nlocale: 'de_DE.UTF-8'\n") {
+		t.Errorf("timezone/locale missing: %s", buf.String())
+	}
+	buf.Reset()
+	if err := userDataTmpl.Execute(&buf, &Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "timezone:") || strings.Contains(buf.String(), "locale:") {
+		t.Errorf("timezone/locale set without a value: %s", buf.String())
+	}
+}
+
+func TestUserData_FilesAndRunCmds(t *testing.T) {
+	cfg := &Config{
+		Files:   []types.GuestFile{{Path: "/etc/app's.conf", Mode: 0o600, Content: []byte("key: value\n")}},
+		RunCmds: []string{"echo 'hi' > /tmp/hi", "systemctl restart app"},
+	}
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Runcmd     []any `yaml:"runcmd"`
+		WriteFiles []struct {
+			Path        string `yaml:"path"`
+			Permissions string `yaml:"permissions"`
+			Encoding    string `yaml:"encoding"`
+			Content     string `yaml:"content"`
+		} `yaml:"write_files"`
+	}
+	if err := yaml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid YAML: %v\n%s", err, buf.String())
+	}
+	if n := len(doc.Runcmd); n != 3 || doc.Runcmd[1] != cfg.RunCmds[0] || doc.Runcmd[2] != cfg.RunCmds[1] {
+		t.Errorf("runcmd = %v, want fstrim then %v", doc.Runcmd, cfg.RunCmds)
+	}
+	if len(doc.WriteFiles) != 1 {
+		t.Fatalf("write_files = %+v, want 1 entry", doc.WriteFiles)
+	}
+	f := doc.WriteFiles[0]
+	if f.Path != "/etc/app's.conf" || f.Permissions != "0600" || f.Encoding != "b64" {
+		t.Errorf("write_files entry = %+v", f)
+	}
+	if got, _ := base64.StdEncoding.DecodeString(f.Content); string(got) != "key: value\n" {
+		t.Errorf("content = %q", got)
+	}
+}
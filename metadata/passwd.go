@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"strings"
+)
+
+// cryptRounds is the SHA-crypt default, so hashes need no "rounds=" field.
+const cryptRounds = 5000
+
+// cryptAlphabet is crypt(3)'s base64 alphabet.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// GeneratePassword returns a random password of 26 base32 characters
+// (128 bits), easy to type on a console.
+func GeneratePassword() string {
+	return rand.Text()
+}
+
+// HashPassword returns password as a SHA-512 crypt(3) hash ("$6$salt$...")
+// with a random salt. cloud-init's chpasswd sets a hash like this as is,
+// so the password itself never has to enter the metadata.
+func HashPassword(password string) string {
+	return sha512Crypt(password, rand.Text()[:16])
+}
+
+// sha512Crypt implements Ulrich Drepper's SHA-crypt with SHA-512 at the
+// default rounds; salt is at most 16 characters.
+func sha512Crypt(password, salt string) string {
+	key, s := []byte(password), []byte(salt)
+
+	b := sha512.New()
+	b.Write(key)
+	b.Write(s)
+	b.Write(key)
+	sumB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(key)
+	a.Write(s)
+	for i := len(key); i > 0; i -= sha512.Size {
+		a.Write(sumB[:min(i, sha512.Size)])
+	}
+	for i := len(key); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(key)
+		}
+	}
+	sum := a.Sum(nil)
+
+	dp := sha512.New()
+	for range key {
+		dp.Write(key)
+	}
+	p := repeatTo(dp.Sum(nil), len(key))
+
+	ds := sha512.New()
+	for range 16 + int(sum[0]) {
+		ds.Write(s)
+	}
+	sp := repeatTo(ds.Sum(nil), len(s))
+
+	for i := range cryptRounds {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(p)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(sp)
+		}
+		if i%7 != 0 {
+			c.Write(p)
+		}
+		if i&1 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(p)
+		}
+		sum = c.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$" + salt + "$")
+	encode := func(b2, b1, b0 byte, n int) {
+		w := uint(b2)<<16 | uint(b1)<<8 | uint(b0)
+		for range n {
+			out.WriteByte(cryptAlphabet[w&0x3f])
+			w >>= 6
+		}
+	}
+	// Bytes go out in triples (i, i+21, i+42), rotated by i%3.
+	for i := range 21 {
+		t := [3]byte{sum[i], sum[i+21], sum[i+42]}
+		r := i % 3 //nolint:mnd
+		encode(t[r], t[(r+1)%3], t[(r+2)%3], 4)
+	}
+	encode(0, 0, sum[63], 2)
+	return out.String()
+}
+
+// repeatTo returns sum repeated to n bytes.
+func repeatTo(sum []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, sum[:min(n-len(out), len(sum))]...)
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package metadata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSHA512Crypt(t *testing.T) {
+	// The first vector is from the SHA-crypt specification, the second
+	// from openssl passwd -6.
+	for _, tt := range []struct{ password, salt, want string }{
+		{"Hello world!", "saltstring", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+		{"p@ss w0rd", "abcdefgh", "$6$abcdefgh$xht0OiByfcohZLdTl3Wc8SJauyEUO4zPkAaTxlmbZjwL6iGC3yCDTCKNuAeyS0i/bcfRT319UHhP0MioPJKQ61"},
+	} {
+		if got := sha512Crypt(tt.password, tt.salt); got != tt.want {
+			t.Errorf("sha512Crypt(%q, %q) = %s, want %s", tt.password, tt.salt, got, tt.want)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	password := GeneratePassword()
+	if len(password) < 20 {
+		t.Fatalf("password %q is too short", password)
+	}
+	hash := HashPassword(password)
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[1] != "6" || len(parts[2]) != 16 || len(parts[3]) != 86 {
+		t.Fatalf("hash %q is not a SHA-512 crypt hash", hash)
+	}
+	if got := sha512Crypt(password, parts[2]); got != hash {
+		t.Errorf("rehash = %s, want %s", got, hash)
+	}
+	if HashPassword(password) == hash {
+		t.Error("two hashes share a salt")
+	}
+}
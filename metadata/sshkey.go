@@ -0,0 +1,77 @@
+package metadata
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadSSHKeys returns the SSH public keys named by spec: a key itself
+// ("ssh-ed25519 AAAA... comment") or a file of them in authorized_keys
+// format, such as ~/.ssh/id_ed25519.pub.
+func LoadSSHKeys(spec string) ([]string, error) {
+	if key := strings.TrimSpace(spec); strings.ContainsAny(key, " \t") {
+		if err := checkSSHKey(key); err != nil {
+			return nil, err
+		}
+		return []string{key}, nil
+	}
+	path := spec
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("expand %s: %w", spec, err)
+		}
+		path = filepath.Join(home, rest)
+	}
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("read SSH key: %w", err)
+	}
+	var keys []string
+	for line := range strings.SplitSeq(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := checkSSHKey(line); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, line)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no SSH public key found", path)
+	}
+	return keys, nil
+}
+
+// checkSSHKey checks that key is a public key line: its type, then a
+// base64 blob that encodes the same type. A private key or a truncated
+// paste fails here rather than inside the guest.
+func checkSSHKey(key string) error {
+	fields := strings.Fields(key)
+	if len(fields) < 2 { //nolint:mnd
+		return fmt.Errorf("invalid SSH public key %q", abbrev(key))
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(blob) < 4 { //nolint:mnd
+		return fmt.Errorf("invalid SSH public key %q: bad base64 data", abbrev(key))
+	}
+	n := binary.BigEndian.Uint32(blob)
+	if uint64(n) > uint64(len(blob)-4) || string(blob[4:4+n]) != fields[0] {
+		return fmt.Errorf("invalid SSH public key %q: data is not a %s key", abbrev(key), fields[0])
+	}
+	return nil
+}
+
+// abbrev shortens a key for error messages.
+func abbrev(key string) string {
+	const limit = 40
+	if len(key) <= limit {
+		return key
+	}
+	return key[:limit] + "..."
+}
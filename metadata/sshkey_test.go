@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testSSHKey builds a well-formed public key line of type typ.
+func testSSHKey(typ, comment string) string {
+	var blob bytes.Buffer
+	_ = binary.Write(&blob, binary.BigEndian, uint32(len(typ)))
+	blob.WriteString(typ)
+	_ = binary.Write(&blob, binary.BigEndian, uint32(32))
+	blob.Write(make([]byte, 32))
+	return typ + " " + base64.StdEncoding.EncodeToString(blob.Bytes()) + " " + comment
+}
+
+func TestLoadSSHKeys(t *testing.T) {
+	ed := testSSHKey("ssh-ed25519", "alice@laptop")
+	got, err := LoadSSHKeys(ed)
+	if err != nil || len(got) != 1 || got[0] != ed {
+		t.Fatalf("literal key: %v, %v", got, err)
+	}
+
+	rsa := testSSHKey("ssh-rsa", "bob@desk")
+	path := filepath.Join(t.TempDir(), "keys.pub")
+	if err := os.WriteFile(path, []byte("# team keys\n"+ed+"\n\n"+rsa+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = LoadSSHKeys(path)
+	if err != nil || len(got) != 2 || got[0] != ed || got[1] != rsa {
+		t.Fatalf("key file: %v, %v", got, err)
+	}
+
+	for _, bad := range []string{
+		"ssh-ed25519 not-base64!",
+		strings.Replace(ed, "ssh-ed25519", "ssh-rsa", 1),
+		filepath.Join(t.TempDir(), "missing.pub"),
+	} {
+		if _, err := LoadSSHKeys(bad); err == nil {
+			t.Errorf("LoadSSHKeys(%q) accepted", bad)
+		}
+	}
+}
+
+func TestUserData_SSHKeys(t *testing.T) {
+	key := testSSHKey("ssh-ed25519", "alice@laptop")
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, &Config{SSHKeys: []string{key}}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "ssh_authorized_keys:\n  - '"+key+"'") {
+		t.Errorf("ssh_authorized_keys missing: %s", out)
+	}
+	if !strings.Contains(out, "disable_root: false") || strings.Contains(out, "ssh_pwauth") {
+		t.Errorf("want key-only root login without password auth: %s", out)
+	}
+}
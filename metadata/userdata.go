@@ -0,0 +1,169 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const cloudConfigHeader = "#cloud-config"
+
+// UserDataVars are the variables templated user-data can use, e.g.
+// "{{.Hostname}}". They are resolved whenever the cidata is generated, so
+// one file can provision many VMs.
+type UserDataVars struct {
+	VMName   string
+	VMID     string
+	Hostname string
+	FQDN     string // empty without --domain
+	IP       string // the first NIC's address; empty when it uses DHCP
+}
+
+// ValidateUserData checks user-supplied user-data before it is stored.
+// Merged user-data must be a #cloud-config YAML mapping; replacing
+// user-data may also be any other cloud-init format (e.g. a "#!" script),
+// which is passed to the guest unchecked. Templated user-data must expand
+// without errors and is then checked the same way.
+func ValidateUserData(data string, replace, tmpl bool) error {
+	if tmpl {
+		var err error
+		if data, err = executeUserData(data, UserDataVars{}); err != nil {
+			return err
+		}
+	}
+	if !isCloudConfig(data) {
+		if replace {
+			return nil
+		}
+		return fmt.Errorf("user-data must start with %q to be merged with the generated cloud-config", cloudConfigHeader)
+	}
+	_, err := parseCloudConfig(data)
+	return err
+}
+
+// renderUserData returns the user-data file for cfg: the generated
+// cloud-config, the user's in its place, or the two merged.
+func renderUserData(generated []byte, cfg *Config) ([]byte, error) {
+	if cfg.UserData == "" {
+		return generated, nil
+	}
+	userData, err := expandUserData(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReplaceUserData {
+		return []byte(userData), nil
+	}
+	base, err := parseCloudConfig(string(generated))
+	if err != nil {
+		return nil, fmt.Errorf("generated %w", err)
+	}
+	user, err := parseCloudConfig(userData)
+	if err != nil {
+		return nil, err
+	}
+	mergeMapping(base, user)
+
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigHeader + "\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) //nolint:mnd
+	if err := enc.Encode(base); err != nil {
+		return nil, fmt.Errorf("encode user-data: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encode user-data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// expandUserData returns cfg.UserData, with its template variables
+// resolved when cfg.TemplateUserData is set.
+func expandUserData(cfg *Config) (string, error) {
+	if !cfg.TemplateUserData {
+		return cfg.UserData, nil
+	}
+	vars := UserDataVars{VMName: cfg.VMName, VMID: cfg.InstanceID, Hostname: cfg.Hostname, FQDN: cfg.FQDN}
+	if len(cfg.Networks) > 0 {
+		vars.IP = cfg.Networks[0].IP
+	}
+	return executeUserData(cfg.UserData, vars)
+}
+
+// executeUserData expands the user-data template data with vars and the
+// functions of the generated cloud-config, so values can be quoted.
+func executeUserData(data string, vars UserDataVars) (string, error) {
+	tmpl, err := template.New("user-data").Funcs(tmplFuncs).Parse(data)
+	if err != nil {
+		return "", fmt.Errorf("user-data template: %w", err)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("user-data template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func isCloudConfig(data string) bool {
+	line, _, _ := strings.Cut(data, "\n")
+	return strings.TrimSpace(line) == cloudConfigHeader
+}
+
+// parseCloudConfig parses a cloud-config document into its top-level
+// mapping; an empty document yields an empty mapping. The header line is
+// dropped so it cannot end up as a comment inside the merged document.
+func parseCloudConfig(data string) (*yaml.Node, error) {
+	if isCloudConfig(data) {
+		_, data, _ = strings.Cut(data, "\n")
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("user-data: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("user-data: cloud-config must be a YAML mapping")
+	}
+	return root, nil
+}
+
+// mergeMapping merges over into base the way cloud-init's list(append)
+// +dict(recurse_array) merger does: lists such as runcmd or write_files
+// are appended to, mappings are merged key by key, and any other value
+// from over wins.
+func mergeMapping(base, over *yaml.Node) {
+	for i := 0; i+1 < len(over.Content); i += 2 {
+		key, val := over.Content[i], over.Content[i+1]
+		j := mappingIndex(base, key.Value)
+		if j < 0 {
+			base.Content = append(base.Content, key, val)
+			continue
+		}
+		cur := base.Content[j+1]
+		switch {
+		case cur.Kind == yaml.SequenceNode && val.Kind == yaml.SequenceNode:
+			cur.Content = append(cur.Content, val.Content...)
+		case cur.Kind == yaml.MappingNode && val.Kind == yaml.MappingNode:
+			mergeMapping(cur, val)
+		default:
+			base.Content[j+1] = val
+		}
+	}
+}
+
+// mappingIndex returns the index of key's node in mapping m, or -1.
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
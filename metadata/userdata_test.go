@@ -0,0 +1,173 @@
+package metadata
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func TestRenderUserData_Merge(t *testing.T) {
+	cfg := &Config{
+		RootPassword: "test",
+		Networks:     []NetworkInfo{{IP: "10.0.0.2", Prefix: 24, Mac: "aa:bb:cc:dd:ee:f0"}},
+		UserData: `#cloud-config
+runcmd:
+  - echo hello
+packages: [nginx]
+chpasswd:
+  expire: true
+ssh_pwauth: false
+`,
+	}
+	var buf bytes.Buffer
+	if err := userDataTmpl.Execute(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	got, err := renderUserData(buf.Bytes(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(got)
+	if !strings.HasPrefix(out, "#cloud-config\n") || strings.Count(out, "#cloud-config") != 1 {
+		t.Errorf("want exactly one leading header: %s", out)
+	}
+	for _, want := range []string{"fstrim.timer", "echo hello", "nginx", "root:test", "15-cocoon-id0.network", "expire: true", "ssh_pwauth: false"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q missing from merged user-data: %s", want, out)
+		}
+	}
+	if strings.Count(out, "runcmd:") != 1 || strings.Index(out, "fstrim.timer") > strings.Index(out, "echo hello") {
+		t.Errorf("user runcmd must follow the generated one: %s", out)
+	}
+	if strings.Contains(out, "expire: false") {
+		t.Errorf("user chpasswd.expire must win: %s", out)
+	}
+}
+
+func TestRenderUserData_Replace(t *testing.T) {
+	script := "#!/bin/sh\necho hi\n"
+	cfg := &Config{RootPassword: "test", UserData: script, ReplaceUserData: true}
+	got, err := renderUserData([]byte("#cloud-config\n"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != script {
+		t.Errorf("replaced user-data = %q, want %q", got, script)
+	}
+}
+
+func TestRenderUserData_Template(t *testing.T) {
+	tmpl := "#!/bin/sh\necho {{.VMName}} {{.VMID}} {{.Hostname}} {{.FQDN}} {{.IP}} > /etc/motd\n"
+	cfg := &Config{
+		InstanceID: "vm-1", VMName: "web_1", Hostname: "web-1", FQDN: "web-1.example.com",
+		Networks:         []NetworkInfo{{IP: "10.0.0.2", Prefix: 24, Mac: "aa:bb:cc:dd:ee:ff"}},
+		UserData:         tmpl,
+		ReplaceUserData:  true,
+		TemplateUserData: true,
+	}
+	got, err := renderUserData([]byte("#cloud-config\n"), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "#!/bin/sh\necho web_1 vm-1 web-1 web-1.example.com 10.0.0.2 > /etc/motd\n"; string(got) != want {
+		t.Errorf("expanded user-data = %q, want %q", got, want)
+	}
+
+	// yamlQuote escapes values for single-quoted YAML strings.
+	quoted := *cfg
+	quoted.UserData = "#cloud-config\nbootcmd: ['echo {{yamlQuote .FQDN}}']\n"
+	quoted.FQDN = "it's.example.com"
+	if got, err = renderUserData([]byte("#cloud-config\n"), &quoted); err != nil {
+		t.Fatal(err)
+	}
+	if want := "#cloud-config\nbootcmd: ['echo it''s.example.com']\n"; string(got) != want {
+		t.Errorf("expanded user-data = %q, want %q", got, want)
+	}
+
+	// Without the option, template actions reach the guest untouched
+	// (e.g. for cloud-init's own jinja templates).
+	cfg.TemplateUserData = false
+	if got, _ = renderUserData([]byte("#cloud-config\n"), cfg); string(got) != tmpl {
+		t.Errorf("user-data = %q, want it unexpanded", got)
+	}
+}
+
+func TestValidateUserData(t *testing.T) {
+	cases := []struct {
+		data    string
+		replace bool
+		tmpl    bool
+		ok      bool
+	}{
+		{"#cloud-config\npackages: [git]\n", false, false, true},
+		{"#cloud-config\n", false, false, true},
+		{"#cloud-config\npackages: [git\n", false, false, false},
+		{"#cloud-config\n- not a mapping\n", false, false, false},
+		{"#!/bin/sh\necho hi\n", false, false, false},
+		{"#!/bin/sh\necho hi\n", true, false, true},
+		{"#cloud-config\nfoo: : bar\n", true, false, false},
+		{"#cloud-config\nfqdn: {{.Hostname}}.lan\n", false, true, true},
+		{"#cloud-config\nfqdn: {{.Hostname\n", false, true, false},
+		{"#cloud-config\nfqdn: {{.Nope}}\n", false, true, false},
+		{"#cloud-config\nfqdn: {{.Nope}}\n", false, false, true},
+	}
+	for _, c := range cases {
+		if err := ValidateUserData(c.data, c.replace, c.tmpl); (err == nil) != c.ok {
+			t.Errorf("ValidateUserData(%q, %v, %v) = %v, want ok=%v", c.data, c.replace, c.tmpl, err, c.ok)
+		}
+	}
+}
+
+func TestGenerate_ReplacedUserDataKeepsNetworkConfig(t *testing.T) {
+	cfg := &Config{
+		InstanceID:      "test-id",
+		Hostname:        "test-vm",
+		Networks:        []NetworkInfo{{IP: "10.0.0.2", Prefix: 24, Mac: "aa:bb:cc:dd:ee:ff"}},
+		UserData:        "#!/bin/sh\necho hi\n",
+		ReplaceUserData: true,
+	}
+	var buf bytes.Buffer
+	if err := Generate(&buf, cfg); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.String()
+	if !strings.Contains(raw, `macaddress: "aa:bb:cc:dd:ee:ff"`) || !strings.Contains(raw, "10.0.0.2/24") {
+		t.Error("network-config must not depend on the generated user-data")
+	}
+	if strings.Contains(raw, "15-cocoon-id0.network") {
+		t.Error("replaced user-data still carries the generated fallback units")
+	}
+}
+
+func TestUserData_GrowpartOverride(t *testing.T) {
+	files, err := Render(&Config{InstanceID: "vm-1", Hostname: "vm-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := string(files["user-data"]); !strings.Contains(out, "growpart:\n  mode: auto\nresize_rootfs: true\n") {
+		t.Errorf("growpart defaults missing: %s", out)
+	}
+
+	files, err = Render(&Config{
+		InstanceID: "vm-1", Hostname: "vm-1",
+		UserData: "#cloud-config\ngrowpart:\n  mode: off\n  devices: [/data]\nresize_rootfs: false\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Growpart struct {
+			Mode    string   `yaml:"mode"`
+			Devices []string `yaml:"devices"`
+		} `yaml:"growpart"`
+		ResizeRootfs bool `yaml:"resize_rootfs"`
+	}
+	if err := yaml.Unmarshal(files["user-data"], &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Growpart.Mode != "off" || len(doc.Growpart.Devices) != 1 || doc.ResizeRootfs {
+		t.Errorf("user growpart settings must win: %+v", doc)
+	}
+}
@@ -0,0 +1,85 @@
+package cni
+
+import (
+	"github.com/containernetworking/cni/libcni"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// handedCapabilities are the capabilities cocoon fills in, in the order
+// they are recorded on a NIC.
+var handedCapabilities = []string{types.CapPortMappings, types.CapBandwidth, types.CapIPs}
+
+// declaredCapabilities returns the capabilities some plugin of cl declares;
+// libcni passes a capability arg only to the plugins declaring it.
+func declaredCapabilities(cl *libcni.NetworkConfigList) map[string]bool {
+	declared := map[string]bool{}
+	for _, p := range cl.Plugins {
+		if p == nil || p.Network == nil {
+			continue
+		}
+		for c, on := range p.Network.Capabilities {
+			declared[c] = declared[c] || on
+		}
+	}
+	return declared
+}
+
+// capabilityArgs builds the RuntimeConf.CapabilityArgs of one NIC from its
+// per-VM settings, keeping only what cl declares. publish only applies to
+// NIC 0, whose IP the mappings target; limit is in bits/s; ip is the
+// address IPAM should assign ("" = any). The second result lists the
+// capabilities handed over, for types.NetworkConfig.Capabilities.
+func capabilityArgs(cl *libcni.NetworkConfigList, publish []types.PortMapping, limit uint64, ip string) (map[string]any, []string) {
+	declared := declaredCapabilities(cl)
+	args := map[string]any{}
+	if declared[types.CapPortMappings] && len(publish) > 0 {
+		maps := make([]map[string]any, 0, len(publish))
+		for _, m := range publish {
+			maps = append(maps, map[string]any{
+				"hostPort":      m.HostPort,
+				"containerPort": m.GuestPort,
+				"protocol":      m.Protocol,
+				"hostIP":        m.HostIP,
+			})
+		}
+		args[types.CapPortMappings] = maps
+	}
+	if declared[types.CapBandwidth] && limit > 0 {
+		// Rates and bursts in bits; the burst matches addTBF's 10ms.
+		burst := max(limit/100, 8*64<<10) //nolint:mnd
+		args[types.CapBandwidth] = map[string]uint64{
+			"ingressRate":  limit,
+			"ingressBurst": burst,
+			"egressRate":   limit,
+			"egressBurst":  burst,
+		}
+	}
+	if declared[types.CapIPs] && ip != "" {
+		args[types.CapIPs] = []string{ip}
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	var handed []string
+	for _, c := range handedCapabilities {
+		if _, ok := args[c]; ok {
+			handed = append(handed, c)
+		}
+	}
+	return args, handed
+}
+
+// cniArgs builds the CNI_ARGS of one NIC: the IP IPAM should assign
+// ("" = any), which host-local honors, and the VM's --cni-arg values.
+// IgnoreUnknown keeps plugins that do not know an arg from failing.
+func cniArgs(ip string, extra [][2]string) [][2]string {
+	if ip == "" && len(extra) == 0 {
+		return nil
+	}
+	args := [][2]string{{"IgnoreUnknown", "1"}}
+	if ip != "" {
+		args = append(args, [2]string{"IP", ip})
+	}
+	return append(args, extra...)
+}
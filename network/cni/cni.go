@@ -6,6 +6,7 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/containernetworking/cni/libcni"
 	"github.com/projecteru2/core/log"
@@ -24,12 +25,14 @@ const typ = "cni"
 
 // CNI implements network.Network using CNI plugins with per-VM netns + bridge + tap.
 type CNI struct {
-	conf        *Config
-	store       storage.Store[networkIndex]
-	locker      lock.Locker
+	conf    *Config
+	store   storage.Store[networkIndex]
+	locker  lock.Locker
+	cniConf *libcni.CNIConfig
+
+	mu          sync.RWMutex                         // guards confLists and defaultName
 	confLists   map[string]*libcni.NetworkConfigList // name → conflist
 	defaultName string                               // first conflist name (backward compat)
-	cniConf     *libcni.CNIConfig
 }
 
 // New creates a CNI network provider.
@@ -53,16 +56,16 @@ func New(conf *config.Config) (*CNI, error) {
 		store:     store,
 		locker:    locker,
 		confLists: make(map[string]*libcni.NetworkConfigList),
+		cniConf: libcni.NewCNIConfigWithCacheDir(
+			[]string{cfg.CNIBinDir},
+			cfg.CacheDir(),
+			nil,
+		),
 	}
 
-	if lists, defaultName, loadErr := loadConfLists(cfg.CNIConfDir); loadErr == nil {
+	if lists, defaultName, loadErr := loadConfLists(cfg.CNIConfDir, cfg.ConfDir()); loadErr == nil {
 		c.confLists = lists
 		c.defaultName = defaultName
-		c.cniConf = libcni.NewCNIConfigWithCacheDir(
-			[]string{cfg.CNIBinDir},
-			cfg.CacheDir(),
-			nil,
-		)
 	}
 
 	return c, nil
@@ -109,6 +112,41 @@ func (c *CNI) List(ctx context.Context) ([]*types.Network, error) {
 	})
 }
 
+// InspectNICs describes vm's NICs, joining each with its network index
+// record: the record ID, the CNI interface in the netns, the published
+// ports, and the IPAM address when the VM record has none.
+func (c *CNI) InspectNICs(ctx context.Context, vm *types.VM) ([]*types.NICInfo, error) {
+	nics := network.DescribeNICs(vm)
+	var recs []networkRecord
+	if err := c.store.With(ctx, func(idx *networkIndex) error {
+		recs = idx.byVMID(vm.ID)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read network index: %w", err)
+	}
+	byIf := make(map[string]*networkRecord, len(recs))
+	for i := range recs {
+		byIf[recs[i].IfName] = &recs[i]
+	}
+	for _, nic := range nics {
+		rec := byIf[fmt.Sprintf("eth%d", nic.Index)]
+		if rec == nil {
+			continue
+		}
+		nic.ID, nic.Ports = rec.ID, rec.Ports
+		if nic.Network == "" {
+			nic.Network = rec.Type
+		}
+		if nic.Kind == types.NICKindTap {
+			nic.Veth = rec.IfName
+		}
+		if nic.IP == "" {
+			nic.IP, nic.Prefix, nic.Gateway = rec.IP, rec.Prefix, rec.Gateway
+		}
+	}
+	return nics, nil
+}
+
 // Delete removes all network resources for the given VM IDs:
 //  1. CNI DEL for each NIC (releases IP from IPAM, removes veth pair).
 //  2. Remove the named netns (kernel cleans up bridge + tap automatically).
@@ -164,18 +202,26 @@ func (c *CNI) deleteVM(ctx context.Context, vmID string) error {
 	})
 }
 
-// delNICs performs best-effort CNI DEL for each NIC record.
+// delNICs performs best-effort CNI DEL for each NIC record, removes
+// macvtap links, which live in the host netns, and returns SR-IOV VFs to
+// their host driver.
 // Failures are logged but never returned — netns deletion cleans up
 // devices anyway; CNI DEL is primarily for IPAM bookkeeping.
 func (c *CNI) delNICs(ctx context.Context, vmID, nsPath string, records []networkRecord) {
-	if c.cniConf == nil {
-		return
-	}
 	logger := log.WithFunc("cni.delNICs")
 	for _, rec := range records {
-		cl, err := c.confListByName(rec.Type)
-		if err != nil {
-			logger.Warnf(ctx, "conflist %q not found for CNI DEL %s/%s: %v", rec.Type, vmID, rec.IfName, err)
+		if rec.Macvtap != "" {
+			if err := deleteMacvtap(rec.Macvtap); err != nil {
+				logger.Warnf(ctx, "delete macvtap %s of %s: %v", rec.Macvtap, vmID, err)
+			}
+			continue
+		}
+		if rec.VF != "" {
+			if sn, _, err := parseSRIOV(rec.Type); err == nil {
+				if err := releaseVF(sn.PF, rec.VF); err != nil {
+					logger.Warnf(ctx, "release VF %s of %s: %v", rec.VF, vmID, err)
+				}
+			}
 			continue
 		}
 		rt := &libcni.RuntimeConf{
@@ -183,15 +229,41 @@ func (c *CNI) delNICs(ctx context.Context, vmID, nsPath string, records []networ
 			NetNS:       nsPath,
 			IfName:      rec.IfName,
 		}
-		if err := c.cniConf.DelNetworkList(ctx, cl, rt); err != nil {
+		cl, err := c.confListByName(rec.Type)
+		if err != nil {
+			// The conflist left the conf dir since ADD: DEL through the
+			// plugin chain libcni cached for this NIC instead.
+			cached, cacheErr := c.cachedConfList(rec.Type, rt)
+			if cacheErr != nil {
+				logger.Warnf(ctx, "conflist %q not found for CNI DEL %s/%s: %v (cache: %v)", rec.Type, vmID, rec.IfName, err, cacheErr)
+				continue
+			}
+			cl = cached
+		}
+		if err := c.delNetworkList(ctx, cl, rt); err != nil {
 			logger.Warnf(ctx, "CNI DEL %s/%s: %v", vmID, rec.IfName, err)
 		}
 	}
 }
 
+// cachedConfList returns the conflist libcni cached when it added the NIC
+// described by rt to network name.
+func (c *CNI) cachedConfList(name string, rt *libcni.RuntimeConf) (*libcni.NetworkConfigList, error) {
+	data, _, err := c.cniConf.GetNetworkListCachedConfig(&libcni.NetworkConfigList{Name: name}, rt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no cached config for %s/%s", rt.ContainerID, rt.IfName)
+	}
+	return libcni.ConfListFromBytes(data)
+}
+
 // confListByName resolves a conflist by name.
 // Empty name returns the default (first alphabetically).
 func (c *CNI) confListByName(name string) (*libcni.NetworkConfigList, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	if len(c.confLists) == 0 {
 		return nil, fmt.Errorf("%w: no conflist found in %s", network.ErrNotConfigured, c.conf.CNIConfDir)
 	}
@@ -210,28 +282,35 @@ func (c *CNI) confListByName(name string) (*libcni.NetworkConfigList, error) {
 	return cl, nil
 }
 
-// loadConfLists loads all .conflist files from dir.
-// Returns the map of name→conflist and the default name (first file, alphabetically).
-func loadConfLists(dir string) (map[string]*libcni.NetworkConfigList, string, error) {
-	files, err := libcni.ConfFiles(dir, []string{".conflist"})
-	if err != nil {
-		return nil, "", err
-	}
-	if len(files) == 0 {
-		return nil, "", fmt.Errorf("no .conflist files in %s", dir)
-	}
-	// files are already sorted by ConfFiles.
-	lists := make(map[string]*libcni.NetworkConfigList, len(files))
+// loadConfLists loads all .conflist files from dirs, in order; a name
+// already loaded from an earlier dir is not overridden.
+// Returns the map of name→conflist and the default name (first file, alphabetically,
+// of the first dir that has any).
+func loadConfLists(dirs ...string) (map[string]*libcni.NetworkConfigList, string, error) {
+	lists := make(map[string]*libcni.NetworkConfigList)
 	var defaultName string
-	for _, f := range files {
-		cl, parseErr := libcni.ConfListFromFile(f)
-		if parseErr != nil {
-			return nil, "", fmt.Errorf("parse %s: %w", f, parseErr)
+	for _, dir := range dirs {
+		files, err := libcni.ConfFiles(dir, []string{".conflist"})
+		if err != nil {
+			return nil, "", err
 		}
-		lists[cl.Name] = cl
-		if defaultName == "" {
-			defaultName = cl.Name
+		// files are already sorted by ConfFiles.
+		for _, f := range files {
+			cl, parseErr := libcni.ConfListFromFile(f)
+			if parseErr != nil {
+				return nil, "", fmt.Errorf("parse %s: %w", f, parseErr)
+			}
+			if _, ok := lists[cl.Name]; ok {
+				continue
+			}
+			lists[cl.Name] = cl
+			if defaultName == "" {
+				defaultName = cl.Name
+			}
 		}
 	}
+	if len(lists) == 0 {
+		return nil, "", fmt.Errorf("no .conflist files in %s", strings.Join(dirs, ", "))
+	}
 	return lists, defaultName, nil
 }
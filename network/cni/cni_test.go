@@ -0,0 +1,211 @@
+package cni
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+	current "github.com/containernetworking/cni/pkg/types/100"
+
+	"github.com/projecteru2/cocoon/lock/flock"
+	storejson "github.com/projecteru2/cocoon/storage/json"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestCachedConfList(t *testing.T) {
+	dir := t.TempDir()
+	c := &CNI{cniConf: libcni.NewCNIConfigWithCacheDir(nil, dir, nil)}
+	rt := &libcni.RuntimeConf{ContainerID: "vm1", IfName: "eth0"}
+
+	if _, err := c.cachedConfList("gone", rt); err == nil {
+		t.Fatal("expected error without a cached config")
+	}
+
+	conflist := `{"cniVersion":"1.0.0","name":"gone","plugins":[{"type":"bridge","bridge":"cni0"}]}`
+	data, err := json.Marshal(map[string]any{"kind": libcni.CNICacheV1, "containerId": "vm1", "ifName": "eth0", "networkName": "gone", "config": []byte(conflist)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "results", "gone-vm1-eth0")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cl, err := c.cachedConfList("gone", rt)
+	if err != nil {
+		t.Fatalf("cachedConfList: %v", err)
+	}
+	if cl.Name != "gone" || len(cl.Plugins) != 1 || cl.Plugins[0].Network.Type != "bridge" {
+		t.Errorf("conflist = %+v, want gone with one bridge plugin", cl)
+	}
+}
+
+func TestHostVeth(t *testing.T) {
+	res := &current.Result{CNIVersion: cniVersion, Interfaces: []*current.Interface{
+		{Name: "cc-net"},
+		{Name: "veth1a2b3c4d"},
+		{Name: "eth0", Sandbox: "/run/netns/cocoon-vm1"},
+	}}
+	if got, err := hostVeth(res, "cc-net"); err != nil || got != "veth1a2b3c4d" {
+		t.Errorf("hostVeth = %q, %v; want veth1a2b3c4d", got, err)
+	}
+	res.Interfaces = res.Interfaces[:1]
+	if _, err := hostVeth(res, "cc-net"); err == nil {
+		t.Error("expected error without a host veth")
+	}
+}
+
+func TestCapabilityArgs(t *testing.T) {
+	conflist := func(caps string) *libcni.NetworkConfigList {
+		cl, err := libcni.ConfListFromBytes([]byte(`{"cniVersion":"1.0.0","name":"net","plugins":[{"type":"bridge"}` + caps + `]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cl
+	}
+	publish := []types.PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: "tcp"}}
+	all := conflist(`,{"type":"portmap","capabilities":{"portMappings":true}},{"type":"bandwidth","capabilities":{"bandwidth":true}},{"type":"static","capabilities":{"ips":true}}`)
+
+	tests := []struct {
+		name    string
+		cl      *libcni.NetworkConfigList
+		publish []types.PortMapping
+		limit   uint64
+		ip      string
+		want    []string
+	}{
+		{"nothing declared", conflist(""), publish, 100_000_000, "10.0.0.5", nil},
+		{"declared but unset", all, nil, 0, "", nil},
+		{"all", all, publish, 100_000_000, "10.0.0.5/24", []string{types.CapPortMappings, types.CapBandwidth, types.CapIPs}},
+		{"disabled capability", conflist(`,{"type":"portmap","capabilities":{"portMappings":false}}`), publish, 0, "", nil},
+		{"bandwidth only", all, nil, 1_000_000, "", []string{types.CapBandwidth}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, handed := capabilityArgs(tt.cl, tt.publish, tt.limit, tt.ip)
+			if !slices.Equal(handed, tt.want) {
+				t.Fatalf("handed = %v, want %v", handed, tt.want)
+			}
+			if len(args) != len(tt.want) {
+				t.Errorf("args = %v, want keys %v", args, tt.want)
+			}
+		})
+	}
+
+	args, _ := capabilityArgs(all, publish, 100_000_000, "10.0.0.5/24")
+	if pm := args[types.CapPortMappings].([]map[string]any); pm[0]["hostPort"] != 8080 || pm[0]["containerPort"] != 80 {
+		t.Errorf("portMappings = %v", pm)
+	}
+	if bw := args[types.CapBandwidth].(map[string]uint64); bw["ingressRate"] != 100_000_000 || bw["egressBurst"] != 1_000_000 {
+		t.Errorf("bandwidth = %v", bw)
+	}
+}
+
+func TestCNIArgs(t *testing.T) {
+	tests := []struct {
+		ip    string
+		extra [][2]string
+		want  [][2]string
+	}{
+		{"", nil, nil},
+		{"10.0.0.5", nil, [][2]string{{"IgnoreUnknown", "1"}, {"IP", "10.0.0.5"}}},
+		{"", [][2]string{{"K", "v"}}, [][2]string{{"IgnoreUnknown", "1"}, {"K", "v"}}},
+		{"10.0.0.5", [][2]string{{"K", "v"}}, [][2]string{{"IgnoreUnknown", "1"}, {"IP", "10.0.0.5"}, {"K", "v"}}},
+	}
+	for _, tt := range tests {
+		if got := cniArgs(tt.ip, tt.extra); !slices.Equal(got, tt.want) {
+			t.Errorf("cniArgs(%q, %v) = %v, want %v", tt.ip, tt.extra, got, tt.want)
+		}
+	}
+}
+
+func TestSubnetCIDR(t *testing.T) {
+	data, err := buildConfList(&types.NetworkSpec{Name: "n", Bridge: "cc-n", Subnet: "10.89.4.0/22", Gateway: "10.89.4.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := libcni.ConfListFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := subnetCIDR("10.89.5.7", cl); got != "10.89.5.7/22" {
+		t.Errorf("subnetCIDR in subnet = %s, want 10.89.5.7/22", got)
+	}
+	if got := subnetCIDR("192.168.0.7", cl); got != "192.168.0.7" {
+		t.Errorf("subnetCIDR outside subnet = %s, want the bare IP", got)
+	}
+}
+
+func TestCheckFixedIP(t *testing.T) {
+	dir := t.TempDir()
+	c := &CNI{store: storejson.New[networkIndex](filepath.Join(dir, "networks.json"), flock.New(filepath.Join(dir, "networks.lock")))}
+	if err := c.store.Update(t.Context(), func(idx *networkIndex) error {
+		idx.Defs["lan"] = &types.NetworkSpec{Name: "lan", Subnet: "10.89.1.0/24", Gateway: "10.89.1.1"}
+		idx.Networks["n1"] = &networkRecord{Network: types.Network{IP: "10.89.1.7"}, Type: "lan", VMID: "vm1"}
+		idx.Networks["n2"] = &networkRecord{Network: types.Network{IP: "10.0.0.5"}, Type: "external", VMID: "vm2"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		network string
+		ip      string
+		wantErr string
+	}{
+		{name: "free host address", network: "lan", ip: "10.89.1.8"},
+		{name: "outside the subnet", network: "lan", ip: "10.89.2.8", wantErr: "outside network lan"},
+		{name: "gateway", network: "lan", ip: "10.89.1.1", wantErr: "gateway"},
+		{name: "network address", network: "lan", ip: "10.89.1.0", wantErr: "not a host address"},
+		{name: "broadcast address", network: "lan", ip: "10.89.1.255", wantErr: "not a host address"},
+		{name: "in use", network: "lan", ip: "10.89.1.7", wantErr: "already used by VM vm1"},
+		{name: "in use on a conflist", network: "external", ip: "10.0.0.5", wantErr: "already used by VM vm2"},
+		{name: "same address on another network", network: "external", ip: "10.89.1.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.checkFixedIP(t.Context(), tt.network, tt.ip)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkFixedIP(%s) = %v", tt.ip, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkFixedIP(%s) = %v, want %q", tt.ip, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckAssignedIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		info    *types.Network
+		wantErr string
+	}{
+		{name: "honored", info: &types.Network{IP: "10.89.1.8"}},
+		{name: "other address", info: &types.Network{IP: "10.89.1.2"}, wantErr: "assigned 10.89.1.2 instead of --ip 10.89.1.8"},
+		{name: "no address", wantErr: "assigned no address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAssignedIP("lan", "10.89.1.8", tt.info)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkAssignedIP = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkAssignedIP = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
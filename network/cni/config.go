@@ -2,6 +2,7 @@ package cni
 
 import (
 	"path/filepath"
+	"time"
 
 	"github.com/projecteru2/cocoon/config"
 	"github.com/projecteru2/cocoon/utils"
@@ -23,6 +24,7 @@ type Config struct {
 func (c *Config) EnsureDirs() error {
 	return utils.EnsureDirs(
 		c.dbDir(),
+		c.ConfDir(),
 	)
 }
 
@@ -30,6 +32,18 @@ func (c *Config) IndexFile() string { return filepath.Join(c.dbDir(), "networks.
 func (c *Config) IndexLock() string { return filepath.Join(c.dbDir(), "networks.lock") }
 func (c *Config) CacheDir() string  { return filepath.Join(c.dir(), "cache") }
 
+// ConfDir holds the conflists generated by "network create"; they load
+// after the ones in CNIConfDir.
+func (c *Config) ConfDir() string { return filepath.Join(c.dir(), "net.d") }
+
+// CNITimeout returns the configured per-attempt CNI ADD/DEL timeout or the default.
+func (c *Config) CNITimeout() time.Duration {
+	if c.CNITimeoutSeconds > 0 {
+		return time.Duration(c.CNITimeoutSeconds) * time.Second
+	}
+	return defaultCNITimeout
+}
+
 func (c *Config) dir() string   { return filepath.Join(c.RootDir, "cni") }
 func (c *Config) dbDir() string { return filepath.Join(c.dir(), "db") }
 
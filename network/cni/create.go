@@ -3,13 +3,15 @@ package cni
 import (
 	"context"
 	"fmt"
+	"net"
+	"slices"
+	"strings"
 
 	"github.com/containernetworking/cni/libcni"
 	cnitypes "github.com/containernetworking/cni/pkg/types"
 	current "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/projecteru2/core/log"
 
-	"github.com/projecteru2/cocoon/network"
 	"github.com/projecteru2/cocoon/types"
 	"github.com/projecteru2/cocoon/utils"
 )
@@ -21,22 +23,143 @@ const defaultQueueSize = 256
 //
 // Flow per NIC:
 //  1. Create named netns cocoon-{vmID}
-//  2. CNI ADD (containerID=vmID, netns path, ifName=eth{i})
+//  2. CNI ADD on the NIC's conflist (containerID=vmID, netns path, ifName=eth{i})
 //  3. Inside netns: flush eth{i} IP, create tap{i}, wire via TC ingress mirred
 //  4. Return NetworkConfig{Tap: "tap{i}", Mac: generated, Network: CNI result}
+//
+// A NIC on a macvtap network skips CNI: it gets a macvtap link on the
+// network's parent in the host netns and no static address. So does an
+// "sriov:<pf>" NIC, which gets a VF of the PF bound to vfio-pci for the
+// hypervisor to pass through.
 func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types.VMConfig, existing ...*types.NetworkConfig) (configs []*types.NetworkConfig, retErr error) {
-	if c.cniConf == nil {
-		return nil, fmt.Errorf("%w: no conflist found in %s", network.ErrNotConfigured, c.conf.CNIConfDir)
+	var defs map[string]*types.NetworkSpec
+	if err := c.store.With(ctx, func(idx *networkIndex) error {
+		defs = idx.Defs
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read network index: %w", err)
 	}
-	confList, err := c.confListByName(vmCfg.Network)
-	if err != nil {
-		return nil, err
+	// Resolve every NIC's network before touching the host. On recovery
+	// the persisted per-NIC name wins.
+	names := make([]string, numNICs)
+	confLists := make([]*libcni.NetworkConfigList, numNICs)
+	macvtaps := make([]*types.NetworkSpec, numNICs)
+	sriovs := make([]*sriovNet, numNICs)
+	for i := range numNICs {
+		name := vmCfg.NICNetwork(i)
+		if i < len(existing) && existing[i] != nil && existing[i].Conflist != "" {
+			name = existing[i].Conflist
+		}
+		if sn, ok, err := parseSRIOV(name); ok {
+			if err != nil {
+				return nil, fmt.Errorf("NIC %d: %w", i, err)
+			}
+			names[i], sriovs[i] = name, &sn
+			continue
+		}
+		if def := defs[name]; def != nil && def.IsMacvtap() {
+			names[i], macvtaps[i] = name, def
+			continue
+		}
+		cl, err := c.confListByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("NIC %d: %w", i, err)
+		}
+		names[i], confLists[i] = cl.Name, cl
 	}
-	// Record the resolved name so it's persisted in the VM record.
-	// Ensures recovery uses the exact same conflist even if the default changes.
+	// Record the resolved names so they're persisted in the VM record.
+	// Ensures recovery uses the exact same conflists even if the default changes.
 	// This intentionally mutates the caller's VMConfig (documented on the interface).
-	vmCfg.Network = confList.Name
+	for i, name := range names {
+		if i < len(vmCfg.Networks) {
+			vmCfg.Networks[i] = name
+		} else {
+			vmCfg.Network = name
+		}
+	}
 	logger := log.WithFunc("cni.Config")
+	// A fixed IP is requested on the first NIC at creation; recovery
+	// requests each NIC's persisted IP instead.
+	fixedIP := ""
+	if len(existing) == 0 && numNICs > 0 && vmCfg.IP != "" {
+		if macvtaps[0] != nil || sriovs[0] != nil {
+			return nil, fmt.Errorf("--ip is not supported on network %s: the guest leases its address from the host NIC's LAN", names[0])
+		}
+		fixedIP = vmCfg.IP
+		if err := c.checkFixedIP(ctx, names[0], fixedIP); err != nil {
+			return nil, err
+		}
+	}
+
+	extraArgs, err := types.ParseCNIArgs(vmCfg.CNIArgs)
+	if err != nil {
+		return nil, fmt.Errorf("--cni-arg %w", err)
+	}
+
+	// Bandwidth caps are tbf qdiscs on the tap and veth, or the bandwidth
+	// plugin's when the chain declares it; recovery keeps the persisted ones.
+	limits := make([]uint64, numNICs)
+	for i := range numNICs {
+		limits[i] = vmCfg.NICLimit(i)
+		if i < len(existing) && existing[i] != nil {
+			limits[i] = existing[i].RateLimit
+		}
+		if limits[i] > 0 && (macvtaps[i] != nil || sriovs[i] != nil) {
+			return nil, fmt.Errorf("NIC %d: --net-limit is not supported on network %s: it has no tap to shape", i, names[i])
+		}
+	}
+
+	// A pinned MAC is applied at creation; recovery restores the persisted
+	// one so anti-spoofing plugins and DHCP reservations keep matching.
+	macs := make([]string, numNICs)
+	for i := range numNICs {
+		if i < len(existing) && existing[i] != nil {
+			macs[i] = existing[i].Mac
+		} else if len(existing) == 0 {
+			macs[i] = vmCfg.NICMAC(i)
+		}
+	}
+	if len(existing) == 0 {
+		if err := c.checkMACs(ctx, macs); err != nil {
+			return nil, err
+		}
+	}
+
+	// An MTU override applies to every NIC; recovery keeps the persisted one.
+	mtus := make([]int, numNICs)
+	for i := range numNICs {
+		mtus[i] = vmCfg.MTU
+		if i < len(existing) && existing[i] != nil {
+			mtus[i] = existing[i].MTU
+		}
+	}
+
+	// A VLAN tags the NIC on the host side: a VLAN link on the veth for
+	// tap NICs, on the parent for macvtap ones, the VF's own tag for
+	// SR-IOV. Recovery keeps the persisted one.
+	vlans := make([]int, numNICs)
+	for i := range numNICs {
+		vlans[i] = vmCfg.NICVLAN(i)
+		if i < len(existing) && existing[i] != nil {
+			vlans[i] = existing[i].VLAN
+		}
+		if sn := sriovs[i]; sn != nil && vlans[i] > 0 {
+			if sn.VLAN > 0 && sn.VLAN != vlans[i] {
+				return nil, fmt.Errorf("NIC %d: --vlan %d conflicts with network %s", i, vlans[i], names[i])
+			}
+			sn.VLAN = vlans[i]
+		}
+	}
+
+	vfs, claimIDs, err := c.assignVFs(ctx, vmID, names, sriovs, existing, vmCfg.Publish)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if retErr != nil {
+			c.dropRecords(ctx, claimIDs)
+		}
+	}()
 
 	nsName := netnsName(vmID)
 	nsPath := netnsPath(vmID)
@@ -49,19 +172,31 @@ func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types
 	// Track successfully added CNI interfaces for rollback.
 	// If store.Update at the end fails, retErr != nil triggers this defer.
 	// CNI DEL can run without persisted records (it uses RuntimeConf, not our DB).
-	var addedIFs []string
+	var addedIFs, addedVFs []int
+	var addedLinks []string
 	defer func() {
 		if retErr == nil {
 			return
 		}
+		for _, link := range addedLinks {
+			if delErr := deleteMacvtap(link); delErr != nil {
+				logger.Warnf(ctx, "rollback macvtap %s: %v", link, delErr)
+			}
+		}
+		for _, i := range addedVFs {
+			if relErr := releaseVF(sriovs[i].PF, vfs[i].Addr); relErr != nil {
+				logger.Warnf(ctx, "rollback VF %s: %v", vfs[i].Addr, relErr)
+			}
+		}
 		// Rollback: CNI DEL for each successfully added NIC to release IPAM.
-		for _, ifn := range addedIFs {
+		for _, i := range addedIFs {
+			ifn := fmt.Sprintf("eth%d", i)
 			rt := &libcni.RuntimeConf{
 				ContainerID: vmID,
 				NetNS:       nsPath,
 				IfName:      ifn,
 			}
-			if delErr := c.cniConf.DelNetworkList(ctx, confList, rt); delErr != nil {
+			if delErr := c.delNetworkList(ctx, confLists[i], rt); delErr != nil {
 				logger.Warnf(ctx, "rollback CNI DEL %s/%s: %v", vmID, ifn, delErr)
 			}
 		}
@@ -71,6 +206,46 @@ func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types
 	for i := range numNICs {
 		ifName := fmt.Sprintf("eth%d", i)
 		tapName := fmt.Sprintf("tap%d", i)
+		confList := confLists[i]
+
+		if def := macvtaps[i]; def != nil {
+			link, parent := macvtapName(vmID, i), def.Parent
+			if vlans[i] > 0 {
+				if parent, err = ensureVLAN(def.Parent, vlans[i]); err != nil {
+					return nil, fmt.Errorf("NIC %d: %w", i, err)
+				}
+			}
+			mac, err := createMacvtap(link, parent, macs[i], mtus[i], def.Isolated)
+			if err != nil {
+				return nil, fmt.Errorf("create macvtap %s on %s: %w", link, parent, err)
+			}
+			addedLinks = append(addedLinks, link)
+			configs = append(configs, &types.NetworkConfig{
+				Macvtap:   link,
+				Mac:       mac,
+				MTU:       mtus[i],
+				VLAN:      vlans[i],
+				NumQueues: netNumQueues(vmCfg.CPU),
+				QueueSize: defaultQueueSize,
+				NetnsPath: nsPath,
+				Conflist:  def.Name,
+			})
+			logger.Debugf(ctx, "NIC %d: %s network=%s macvtap=%s parent=%s mac=%s",
+				i, ifName, def.Name, link, parent, mac)
+			continue
+		}
+		if sn := sriovs[i]; sn != nil {
+			nc, err := setupVF(*sn, vfs[i], macs[i])
+			if err != nil {
+				return nil, fmt.Errorf("NIC %d: %w", i, err)
+			}
+			addedVFs = append(addedVFs, i)
+			// The VF's MTU is the guest's to set; the PF's must allow it.
+			nc.NetnsPath, nc.Conflist, nc.MTU, nc.VLAN = nsPath, names[i], mtus[i], vlans[i]
+			configs = append(configs, nc)
+			logger.Debugf(ctx, "NIC %d: %s network=%s vf=%s mac=%s", i, ifName, names[i], vfs[i].Addr, nc.Mac)
+			continue
+		}
 
 		// Step 2: CNI ADD — creates veth pair, assigns IP via IPAM.
 		rt := &libcni.RuntimeConf{
@@ -82,49 +257,92 @@ func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types
 		// Recovery: release stale IPAM allocation, then re-add requesting
 		// the same IP. After host reboot, IPAM state files survive on disk
 		// but the netns is gone. DEL clears the old record; the IP= CNI_ARG
-		// tells host-local to allocate exactly the original address so the
-		// guest's static IP config still matches.
+		// (or the ips capability) tells IPAM to allocate exactly the
+		// original address so the guest's static IP config still matches.
+		ip, ipCIDR := "", ""
 		if i < len(existing) && existing[i] != nil {
-			if delErr := c.cniConf.DelNetworkList(ctx, confList, rt); delErr != nil {
+			if delErr := c.delNetworkList(ctx, confList, rt); delErr != nil {
 				logger.Warnf(ctx, "pre-recovery CNI DEL %s/%s: %v (continuing)", vmID, ifName, delErr)
 			}
-			if existing[i].Network != nil && existing[i].Network.IP != "" {
-				rt.Args = [][2]string{{"IgnoreUnknown", "1"}, {"IP", existing[i].Network.IP}}
+			if n := existing[i].Network; n != nil && n.IP != "" {
+				ip, ipCIDR = n.IP, n.IP
+				if n.Prefix > 0 {
+					ipCIDR = fmt.Sprintf("%s/%d", n.IP, n.Prefix)
+				}
 			}
 		}
+		if i == 0 && fixedIP != "" {
+			ip, ipCIDR = fixedIP, subnetCIDR(fixedIP, confList)
+		}
+		rt.Args = cniArgs(ip, extraArgs)
+		var publish []types.PortMapping
+		if i == 0 {
+			publish = vmCfg.Publish
+		}
+		var caps []string
+		rt.CapabilityArgs, caps = capabilityArgs(confList, publish, limits[i], ipCIDR)
+		// A chain with the bandwidth plugin shapes the NIC instead of tbf.
+		rate := limits[i]
+		if slices.Contains(caps, types.CapBandwidth) {
+			rate = 0
+		}
 
-		cniResult, err := c.cniConf.AddNetworkList(ctx, confList, rt)
+		cniResult, err := c.addNetworkList(ctx, confList, rt)
 		if err != nil {
 			return nil, fmt.Errorf("CNI ADD %s/%s: %w", vmID, ifName, err)
 		}
-		addedIFs = append(addedIFs, ifName)
+		addedIFs = append(addedIFs, i)
 
 		netInfo, err := extractNetworkInfo(cniResult)
 		if err != nil {
 			return nil, fmt.Errorf("parse CNI result: %w", err)
 		}
+		// An isolated network's VMs only reach the bridge itself.
+		if def := defs[names[i]]; def != nil && def.Isolated {
+			veth, vethErr := hostVeth(cniResult, def.Bridge)
+			if vethErr == nil {
+				vethErr = isolatePort(veth)
+			}
+			if vethErr != nil {
+				return nil, fmt.Errorf("NIC %d: isolate on network %s: %w", i, def.Name, vethErr)
+			}
+		}
+		if i == 0 && fixedIP != "" {
+			if err := checkAssignedIP(confList.Name, fixedIP, netInfo); err != nil {
+				return nil, err
+			}
+		}
 
 		// Step 3: inside netns — flush IP, create tap, wire via TC redirect (platform-specific).
 		// Returns eth0's MAC so the guest virtio-net uses the same address,
 		// required for anti-spoofing CNI plugins (Cilium, Calico eBPF, VPC ENI).
-		// On recovery, overrideMAC restores the original veth MAC to match
-		// the persisted CH --net mac= value.
-		var overrideMAC string
+		// A pinned or persisted MAC is set on the veth first, so it matches
+		// the CH --net mac= value.
+		// The tap gets one queue per virtio queue pair; recovery keeps the
+		// persisted num_queues even if the CPU count changed since.
+		numQueues := netNumQueues(vmCfg.CPU)
 		if i < len(existing) && existing[i] != nil {
-			overrideMAC = existing[i].Mac
+			if existing[i].NumQueues > 0 {
+				numQueues = existing[i].NumQueues
+			}
 		}
-		mac, setupErr := setupTCRedirect(nsPath, ifName, tapName, vmCfg.CPU, overrideMAC)
+		mac, setupErr := setupTCRedirect(nsPath, ifName, tapName, numQueues/2, macs[i], mtus[i], vlans[i], rate) //nolint:mnd
 		if setupErr != nil {
 			return nil, fmt.Errorf("setup tc-redirect %s: %w", vmID, setupErr)
 		}
 
 		configs = append(configs, &types.NetworkConfig{
-			Tap:       tapName,
-			Mac:       mac,
-			NumQueues: netNumQueues(vmCfg.CPU),
-			QueueSize: defaultQueueSize,
-			NetnsPath: nsPath,
-			Network:   netInfo,
+			Tap:          tapName,
+			Mac:          mac,
+			NumQueues:    numQueues,
+			QueueSize:    defaultQueueSize,
+			NetnsPath:    nsPath,
+			Conflist:     confList.Name,
+			MTU:          mtus[i],
+			VLAN:         vlans[i],
+			RateLimit:    limits[i],
+			Capabilities: caps,
+			Network:      netInfo,
 		})
 
 		var logIP, logGW string
@@ -132,8 +350,8 @@ func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types
 			logIP = netInfo.IP
 			logGW = netInfo.Gateway
 		}
-		logger.Debugf(ctx, "NIC %d: %s ip=%s gw=%s tap=%s mac=%s",
-			i, ifName, logIP, logGW, tapName, mac)
+		logger.Debugf(ctx, "NIC %d: %s network=%s ip=%s gw=%s tap=%s mac=%s",
+			i, ifName, confList.Name, logIP, logGW, tapName, mac)
 	}
 
 	// Recovery: DB records survived reboot, nothing to write.
@@ -141,9 +359,25 @@ func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types
 		return configs, nil
 	}
 
-	// Step 4: persist network records to DB.
+	// Step 4: persist network records to DB. The MACs are checked again
+	// in the same update, so two creates pinning one MAC cannot both
+	// pass checkMACs and record it.
 	return configs, c.store.Update(ctx, func(idx *networkIndex) error {
 		for i, cfg := range configs {
+			if err := macInUse(idx, cfg.Mac, vmID); err != nil {
+				return fmt.Errorf("NIC %d: %w", i, err)
+			}
+		}
+		for i, cfg := range configs {
+			if sriovs[i] != nil {
+				// Recorded by assignVFs; add the MAC setupVF programmed.
+				for _, rec := range idx.Networks {
+					if rec != nil && rec.VF == vfs[i].Addr {
+						rec.Mac = cfg.Mac
+					}
+				}
+				continue
+			}
 			netID, genErr := utils.GenerateID()
 			if genErr != nil {
 				return genErr
@@ -152,18 +386,44 @@ func (c *CNI) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types
 			if cfg.Network != nil {
 				net = *cfg.Network
 			}
-			idx.Networks[netID] = &networkRecord{
+			rec := &networkRecord{
 				ID:      netID,
-				Type:    confList.Name,
+				Type:    cfg.Conflist,
 				Network: net,
 				VMID:    vmID,
 				IfName:  fmt.Sprintf("eth%d", i),
+				Macvtap: cfg.Macvtap,
+				Mac:     cfg.Mac,
 			}
+			// Published ports are forwarded to the first NIC.
+			if i == 0 {
+				rec.Ports = vmCfg.Publish
+			}
+			idx.Networks[netID] = rec
 		}
 		return nil
 	})
 }
 
+// subnetCIDR returns ip in CIDR form with the prefix length of the
+// conflist subnet holding it, or ip alone when no subnet does.
+func subnetCIDR(ip string, cl *libcni.NetworkConfigList) string {
+	addr := net.ParseIP(ip)
+	for _, subnet := range confListSubnets(cl.Bytes) {
+		if subnet.Contains(addr) {
+			ones, _ := subnet.Mask.Size()
+			return fmt.Sprintf("%s/%d", ip, ones)
+		}
+	}
+	return ip
+}
+
+// macvtapName names NIC i's macvtap link after the VM, within the 15-char
+// interface name limit.
+func macvtapName(vmID string, i int) string {
+	return fmt.Sprintf("mvt%.10s%d", vmID, i)
+}
+
 // netNumQueues returns the virtio-net num_queues for a given CPU count.
 // Each vCPU gets a TX/RX queue pair: cpu <= 1 → 2 (single pair), cpu > 1 → cpu * 2.
 func netNumQueues(cpu int) int {
@@ -201,3 +461,98 @@ func extractNetworkInfo(result cnitypes.Result) (*types.Network, error) {
 	}
 	return nil, nil
 }
+
+// hostVeth returns the host end of the NIC's veth from a bridge plugin
+// result: the interface outside the sandbox that is not the bridge.
+func hostVeth(result cnitypes.Result, bridge string) (string, error) {
+	res, err := current.NewResultFromResult(result)
+	if err != nil {
+		return "", fmt.Errorf("convert CNI result: %w", err)
+	}
+	for _, iface := range res.Interfaces {
+		if iface.Sandbox == "" && iface.Name != bridge {
+			return iface.Name, nil
+		}
+	}
+	return "", fmt.Errorf("CNI result names no host veth")
+}
+
+// checkMACs fails early on a pinned MAC that another NIC in the network index
+// already holds; empty entries are left to the plugins.
+func (c *CNI) checkMACs(ctx context.Context, macs []string) error {
+	if !slices.ContainsFunc(macs, func(mac string) bool { return mac != "" }) {
+		return nil
+	}
+	return c.store.With(ctx, func(idx *networkIndex) error {
+		for i, mac := range macs {
+			if err := macInUse(idx, mac, ""); err != nil {
+				return fmt.Errorf("NIC %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
+
+// macInUse rejects mac when a NIC of a VM other than vmID records it.
+func macInUse(idx *networkIndex, mac, vmID string) error {
+	if mac == "" {
+		return nil
+	}
+	for _, rec := range idx.Networks {
+		if rec != nil && rec.VMID != vmID && strings.EqualFold(mac, rec.Mac) {
+			return fmt.Errorf("MAC %s is already used by VM %s", mac, rec.VMID)
+		}
+	}
+	return nil
+}
+
+// checkFixedIP rejects a fixed IP that is already held by another NIC on
+// netName, or that is not a host address of its subnet other than the
+// gateway when "network create" made it.
+func (c *CNI) checkFixedIP(ctx context.Context, netName, ip string) error {
+	return c.store.With(ctx, func(idx *networkIndex) error {
+		if def := idx.Defs[netName]; def != nil {
+			if _, subnet, err := net.ParseCIDR(def.Subnet); err == nil {
+				addr := net.ParseIP(ip).To4()
+				if !subnet.Contains(addr) {
+					return fmt.Errorf("--ip %s is outside network %s (%s)", ip, netName, def.Subnet)
+				}
+				if addr.Equal(subnet.IP) || addr.Equal(broadcast(subnet)) {
+					return fmt.Errorf("--ip %s is not a host address of network %s (%s)", ip, netName, def.Subnet)
+				}
+			}
+			if ip == def.Gateway {
+				return fmt.Errorf("--ip %s is the gateway of network %s", ip, netName)
+			}
+		}
+		for _, rec := range idx.Networks {
+			if rec != nil && rec.Type == netName && rec.IP == ip {
+				return fmt.Errorf("--ip %s on network %s is already used by VM %s", ip, netName, rec.VMID)
+			}
+		}
+		return nil
+	})
+}
+
+// broadcast returns the last address of subnet.
+func broadcast(subnet *net.IPNet) net.IP {
+	ip := make(net.IP, len(subnet.IP))
+	for i := range ip {
+		ip[i] = subnet.IP[i] | ^subnet.Mask[i]
+	}
+	return ip
+}
+
+// checkAssignedIP rejects the address the IPAM of network netName gave
+// the first NIC when it is not the fixed IP asked for: plugins that ignore
+// the IP arg hand out any address.
+func checkAssignedIP(netName, fixedIP string, netInfo *types.Network) error {
+	if netInfo != nil && netInfo.IP == fixedIP {
+		return nil
+	}
+	got := "no address"
+	if netInfo != nil {
+		got = netInfo.IP
+	}
+	return fmt.Errorf("network %s assigned %s instead of --ip %s: its IPAM plugin must honor the IP CNI arg (host-local does)", netName, got, fixedIP)
+}
@@ -3,6 +3,7 @@ package cni
 import (
 	"context"
 	"errors"
+	"net"
 )
 
 var errNotSupported = errors.New("network namespace operations are not supported on darwin")
@@ -15,6 +16,30 @@ func deleteNetns(_ context.Context, _ string) error {
 	return errNotSupported
 }
 
-func setupTCRedirect(_, _, _ string, _ int, _ string) (string, error) {
+func setupTCRedirect(_, _, _ string, _ int, _ string, _, _ int, _ uint64) (string, error) {
 	return "", errNotSupported
 }
+
+func deleteBridge(_ string) error {
+	return nil
+}
+
+func createMacvtap(_, _, _ string, _ int, _ bool) (string, error) {
+	return "", errNotSupported
+}
+
+func isolatePort(_ string) error {
+	return errNotSupported
+}
+
+func ensureVLAN(_ string, _ int) (string, error) {
+	return "", errNotSupported
+}
+
+func deleteMacvtap(_ string) error {
+	return nil
+}
+
+func setVF(_ string, _ int, _ net.HardwareAddr, _ int) error {
+	return errNotSupported
+}
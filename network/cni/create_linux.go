@@ -2,7 +2,9 @@ package cni
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"runtime"
@@ -57,33 +59,38 @@ func deleteNetns(ctx context.Context, name string) error {
 // TC ingress + mirred redirect, and returns ifName's MAC address.
 // The caller should pass this MAC to CH so the guest's virtio-net MAC
 // matches the CNI veth — required for anti-spoofing CNI plugins.
-// When overrideMAC is non-empty (recovery), the veth's hardware address is
-// set to the given value before proceeding, so the returned MAC matches
-// the persisted CH --net mac= value.
-func setupTCRedirect(nsPath, ifName, tapName string, queues int, overrideMAC string) (string, error) {
+// When overrideMAC is non-empty (--mac, or recovery), the veth's hardware
+// address is set to the given value before proceeding, so the returned MAC
+// matches the pinned or persisted CH --net mac= value. A non-zero mtu
+// overrides the veth's and the tap's; a non-zero vlan wires the tap to a
+// VLAN link on the veth instead, so the guest's traffic leaves tagged; a
+// non-zero rate (bits/s) caps both directions.
+func setupTCRedirect(nsPath, ifName, tapName string, queues int, overrideMAC string, mtu, vlan int, rate uint64) (string, error) {
 	var mac string
 	err := cns.WithNetNSPath(nsPath, func(_ cns.NetNS) error {
 		var nsErr error
-		mac, nsErr = tcRedirectInNS(ifName, tapName, queues, overrideMAC)
+		mac, nsErr = tcRedirectInNS(ifName, tapName, queues, overrideMAC, mtu, vlan, rate)
 		return nsErr
 	})
 	return mac, err
 }
 
 // tcRedirectInNS runs inside the target netns.
-//  1. Flush IP from ifName (guest owns it, not the netns).
+//  1. Flush IP from ifName (guest owns it, not the netns), and optionally
+//     put a VLAN link on it as the tap's uplink.
 //  2. Create tap device.
-//  3. Bring both interfaces up.
-//  4. Attach ingress qdisc to both.
+//  3. Bring the interfaces up.
+//  4. Attach ingress qdisc to the uplink and the tap.
 //  5. Add U32+mirred filters for bidirectional redirect.
-func tcRedirectInNS(ifName, tapName string, queues int, overrideMAC string) (string, error) {
+//  6. Optionally shape both egresses with tbf.
+func tcRedirectInNS(ifName, tapName string, queues int, overrideMAC string, mtu, vlan int, rate uint64) (string, error) {
 	// 1. Find CNI veth, optionally restore its MAC (recovery), then flush IP addresses.
 	link, err := netlink.LinkByName(ifName)
 	if err != nil {
 		return "", fmt.Errorf("find %s: %w", ifName, err)
 	}
 
-	// Recovery: set veth MAC back to persisted value so anti-spoofing
+	// --mac or recovery: set veth MAC to the pinned/persisted value so anti-spoofing
 	// plugins (Cilium, Calico eBPF) see the same MAC as CH --net mac=.
 	if overrideMAC != "" {
 		hwAddr, parseErr := net.ParseMAC(overrideMAC)
@@ -107,6 +114,15 @@ func tcRedirectInNS(ifName, tapName string, queues int, overrideMAC string) (str
 		}
 	}
 
+	// --vlan: the tap is wired to <ifName>.<vlan> instead, which tags what
+	// the guest sends and only passes it frames carrying the same tag.
+	uplink := link
+	if vlan > 0 {
+		if uplink, err = addVLAN(link, vlan); err != nil {
+			return "", err
+		}
+	}
+
 	// 2. Create tap device.
 	// VNET_HDR: allows kernel to parse virtio_net headers for checksum/GSO offload.
 	// Multi-queue: match CH num_queues so each vCPU gets its own TX/RX ring.
@@ -137,21 +153,35 @@ func tcRedirectInNS(ifName, tapName string, queues int, overrideMAC string) (str
 
 	// Sync MTU: tap must match veth to avoid silent large-packet drops
 	// when CNI uses non-default MTU (e.g. 1450 for overlay, 9000 for jumbo).
-	if mtu := link.Attrs().MTU; mtu > 0 {
-		if mtuErr := netlink.LinkSetMTU(tapLink, mtu); mtuErr != nil {
-			return "", fmt.Errorf("set tap %s mtu %d: %w", tapName, mtu, mtuErr)
+	// An --mtu override is applied to the veth first so all agree.
+	if mtu > 0 && mtu != link.Attrs().MTU {
+		if mtuErr := netlink.LinkSetMTU(link, mtu); mtuErr != nil {
+			return "", fmt.Errorf("set %s mtu %d: %w", ifName, mtu, mtuErr)
+		}
+	} else {
+		mtu = link.Attrs().MTU
+	}
+	if mtu > 0 {
+		synced := []netlink.Link{tapLink}
+		if uplink != link {
+			synced = append(synced, uplink)
+		}
+		for _, l := range synced {
+			if mtuErr := netlink.LinkSetMTU(l, mtu); mtuErr != nil {
+				return "", fmt.Errorf("set %s mtu %d: %w", l.Attrs().Name, mtu, mtuErr)
+			}
 		}
 	}
 
-	// 3. Bring both interfaces up.
-	for _, l := range []netlink.Link{link, tapLink} {
+	// 3. Bring the interfaces up; a VLAN link needs its veth up too.
+	for _, l := range []netlink.Link{link, uplink, tapLink} {
 		if upErr := netlink.LinkSetUp(l); upErr != nil {
 			return "", fmt.Errorf("set %s up: %w", l.Attrs().Name, upErr)
 		}
 	}
 
-	// 4. Attach ingress qdisc to both interfaces.
-	for _, l := range []netlink.Link{link, tapLink} {
+	// 4. Attach ingress qdisc to the uplink and the tap.
+	for _, l := range []netlink.Link{uplink, tapLink} {
 		qdisc := &netlink.Ingress{
 			QdiscAttrs: netlink.QdiscAttrs{
 				LinkIndex: l.Attrs().Index,
@@ -164,15 +194,50 @@ func tcRedirectInNS(ifName, tapName string, queues int, overrideMAC string) (str
 	}
 
 	// 5. Bidirectional redirect: eth0 ingress → tap0, tap0 ingress → eth0.
-	if err := addTCRedirect(link, tapLink); err != nil {
-		return "", fmt.Errorf("redirect %s -> %s: %w", ifName, tapName, err)
+	upName := uplink.Attrs().Name
+	if err := addTCRedirect(uplink, tapLink); err != nil {
+		return "", fmt.Errorf("redirect %s -> %s: %w", upName, tapName, err)
+	}
+	if err := addTCRedirect(tapLink, uplink); err != nil {
+		return "", fmt.Errorf("redirect %s -> %s: %w", tapName, upName, err)
 	}
-	if err := addTCRedirect(tapLink, link); err != nil {
-		return "", fmt.Errorf("redirect %s -> %s: %w", tapName, ifName, err)
+
+	// 6. Redirected packets leave through the target's root qdisc: the
+	// tap's shapes traffic to the guest, the veth's traffic from it.
+	if rate > 0 {
+		for _, l := range []netlink.Link{tapLink, uplink} {
+			if err := addTBF(l, rate); err != nil {
+				return "", fmt.Errorf("add tbf on %s: %w", l.Attrs().Name, err)
+			}
+		}
 	}
 	return mac, nil
 }
 
+// addTBF replaces l's root qdisc with a token bucket limited to rate
+// bits/s, sized like the CNI bandwidth plugin's: a burst of 10ms of
+// traffic (at least one 64KiB GSO segment) and 25ms of queueing.
+func addTBF(l netlink.Link, rate uint64) error {
+	const (
+		minBurst  = 64 << 10
+		latencyUs = 25_000
+	)
+	rateBytes := rate / 8                                 //nolint:mnd
+	burst := max(rateBytes/100, minBurst)                 //nolint:mnd
+	bufferUs := float64(burst) * 1e6 / float64(rateBytes) //nolint:mnd
+	qdisc := &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: l.Attrs().Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   rateBytes,
+		Limit:  uint32(min(rateBytes*latencyUs/1e6+burst, math.MaxUint32)), //nolint:gosec,mnd
+		Buffer: uint32(min(bufferUs*netlink.TickInUsec(), math.MaxUint32)), //nolint:gosec
+	}
+	return netlink.QdiscReplace(qdisc)
+}
+
 // addTCRedirect adds a U32 catch-all filter on from's ingress that redirects
 // all packets to to's egress via mirred. TC_ACT_STOLEN ensures the packet is
 // consumed and never reaches the netns host stack.
@@ -200,3 +265,138 @@ func addTCRedirect(from, to netlink.Link) error {
 	}
 	return netlink.FilterAdd(filter)
 }
+
+// deleteBridge removes a bridge left behind by the bridge plugin.
+func deleteBridge(name string) error {
+	return deleteLink(name)
+}
+
+// deleteLink removes a host link; one that is already gone is not an error.
+func deleteLink(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+	return netlink.LinkDel(link)
+}
+
+// createMacvtap creates a bridge-mode macvtap link on parent in the host
+// netns and returns its MAC. A non-empty mac (--mac, or recovery) is applied so the
+// guest keeps its address; a leftover link of the same name is replaced.
+// A non-zero mtu overrides the one inherited from parent. A private link
+// (private mode) cannot talk to the other macvtaps on parent, only to its
+// LAN.
+func createMacvtap(name, parent, mac string, mtu int, private bool) (string, error) {
+	parentLink, err := netlink.LinkByName(parent)
+	if err != nil {
+		return "", fmt.Errorf("find parent %s: %w", parent, err)
+	}
+	if err := deleteMacvtap(name); err != nil {
+		return "", fmt.Errorf("remove stale %s: %w", name, err)
+	}
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = name
+	attrs.ParentIndex = parentLink.Attrs().Index
+	attrs.MTU = mtu
+	if mac != "" {
+		if attrs.HardwareAddr, err = net.ParseMAC(mac); err != nil {
+			return "", fmt.Errorf("parse MAC %q: %w", mac, err)
+		}
+	}
+	mode := netlink.MACVLAN_MODE_BRIDGE
+	if private {
+		mode = netlink.MACVLAN_MODE_PRIVATE
+	}
+	link := &netlink.Macvtap{Macvlan: netlink.Macvlan{LinkAttrs: attrs, Mode: mode}}
+	if err := netlink.LinkAdd(link); err != nil {
+		return "", fmt.Errorf("add macvtap: %w", err)
+	}
+	created, err := netlink.LinkByName(name)
+	if err == nil {
+		err = netlink.LinkSetUp(created)
+	}
+	if err != nil {
+		_ = netlink.LinkDel(link)
+		return "", fmt.Errorf("bring up %s: %w", name, err)
+	}
+	return created.Attrs().HardwareAddr.String(), nil
+}
+
+// isolatePort sets the isolated flag on bridge port name: isolated ports
+// forward only to non-isolated ones, such as the bridge itself.
+func isolatePort(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return fmt.Errorf("find %s: %w", name, err)
+	}
+	if err := netlink.LinkSetIsolated(link, true); err != nil {
+		return fmt.Errorf("set %s isolated: %w", name, err)
+	}
+	return nil
+}
+
+// ensureVLAN returns the 802.1Q link of parent for id in the host netns,
+// creating it if needed. It is shared by every macvtap NIC on that VLAN
+// and left in place when they go.
+func ensureVLAN(parent string, id int) (string, error) {
+	parentLink, err := netlink.LinkByName(parent)
+	if err != nil {
+		return "", fmt.Errorf("find parent %s: %w", parent, err)
+	}
+	link, err := addVLAN(parentLink, id)
+	if err != nil {
+		return "", err
+	}
+	return link.Attrs().Name, nil
+}
+
+// addVLAN adds the 802.1Q link of parent for id, named <parent>.<id>, or
+// v<parent index>.<id> when that exceeds the kernel's name limit, and
+// brings it up. One that already exists is reused.
+func addVLAN(parent netlink.Link, id int) (netlink.Link, error) {
+	name := fmt.Sprintf("%s.%d", parent.Attrs().Name, id)
+	if len(name) > maxIfNameLen {
+		name = fmt.Sprintf("v%d.%d", parent.Attrs().Index, id)
+	}
+	attrs := netlink.NewLinkAttrs()
+	attrs.Name = name
+	attrs.ParentIndex = parent.Attrs().Index
+	if err := netlink.LinkAdd(&netlink.Vlan{LinkAttrs: attrs, VlanId: id}); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("add VLAN %d on %s: %w", id, parent.Attrs().Name, err)
+	}
+	link, err := netlink.LinkByName(name)
+	if err == nil {
+		err = netlink.LinkSetUp(link)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bring up %s: %w", name, err)
+	}
+	return link, nil
+}
+
+// deleteMacvtap removes a macvtap link; one already gone is not an error.
+func deleteMacvtap(name string) error {
+	return deleteLink(name)
+}
+
+// setVF programs VF index of pf: its MAC when mac is set, and its VLAN
+// (0 = untagged).
+func setVF(pf string, index int, mac net.HardwareAddr, vlan int) error {
+	link, err := netlink.LinkByName(pf)
+	if err != nil {
+		return fmt.Errorf("find PF %s: %w", pf, err)
+	}
+	if mac != nil {
+		if err := netlink.LinkSetVfHardwareAddr(link, index, mac); err != nil {
+			return fmt.Errorf("set MAC of %s VF %d: %w", pf, index, err)
+		}
+	}
+	if err := netlink.LinkSetVfVlan(link, index, vlan); err != nil {
+		return fmt.Errorf("set VLAN of %s VF %d: %w", pf, index, err)
+	}
+	return nil
+}
@@ -16,6 +16,16 @@ type networkRecord struct {
 	VMID string `json:"vm_id"`
 	// IfName is the CNI interface name inside the netns (eth0, eth1, ...).
 	IfName string `json:"if_name"`
+	// Mac is the NIC's MAC address, kept so pinned MACs stay unique.
+	Mac string `json:"mac,omitempty"`
+	// Macvtap is the host macvtap link of a NIC on a macvtap network;
+	// such NICs have no CNI state to DEL.
+	Macvtap string `json:"macvtap,omitempty"`
+	// VF is the PCI address of the SR-IOV VF an "sriov:<pf>" NIC holds;
+	// no two records share one.
+	VF string `json:"vf,omitempty"`
+	// Ports lists the host ports published to this NIC's IP.
+	Ports []types.PortMapping `json:"ports,omitempty"`
 }
 
 // networkIndex is the top-level DB structure for the CNI network provider.
@@ -23,6 +33,8 @@ type networkIndex struct {
 	// Networks is keyed by network ID (not VM ID).
 	// A VM with 2 NICs has 2 entries here.
 	Networks map[string]*networkRecord `json:"networks"`
+	// Defs holds the networks created by "network create", keyed by name.
+	Defs map[string]*types.NetworkSpec `json:"defs,omitempty"`
 }
 
 // Init implements storage.Initer.
@@ -30,6 +42,9 @@ func (idx *networkIndex) Init() {
 	if idx.Networks == nil {
 		idx.Networks = make(map[string]*networkRecord)
 	}
+	if idx.Defs == nil {
+		idx.Defs = make(map[string]*types.NetworkSpec)
+	}
 }
 
 // byVMID returns copies of all network records belonging to vmID.
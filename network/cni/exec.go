@@ -0,0 +1,98 @@
+package cni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
+	"github.com/projecteru2/core/log"
+)
+
+const (
+	defaultCNITimeout = 60 * time.Second
+	// retryBackoff is the pause before the first retry; it doubles per
+	// attempt up to maxRetryBackoff.
+	retryBackoff    = time.Second
+	maxRetryBackoff = 10 * time.Second
+)
+
+// addNetworkList runs CNI ADD for rt with the configured per-attempt
+// timeout, retrying failed attempts. Retries start with a DEL (inside the
+// same attempt) so a half-configured interface or leaked IPAM lease from
+// the previous attempt does not fail them.
+func (c *CNI) addNetworkList(ctx context.Context, cl *libcni.NetworkConfigList, rt *libcni.RuntimeConf) (cnitypes.Result, error) {
+	logger := log.WithFunc("cni.addNetworkList")
+	var result cnitypes.Result
+	attempt := 0
+	err := c.retry(ctx, "ADD", rt, func(ctx context.Context) error {
+		if attempt++; attempt > 1 {
+			if delErr := c.cniConf.DelNetworkList(ctx, cl, rt); delErr != nil {
+				logger.Warnf(ctx, "CNI DEL %s/%s before retry: %v", rt.ContainerID, rt.IfName, delErr)
+			}
+		}
+		var err error
+		result, err = c.cniConf.AddNetworkList(ctx, cl, rt)
+		return err
+	})
+	return result, err
+}
+
+// delNetworkList runs CNI DEL for rt with the configured per-attempt
+// timeout, retrying failed attempts. Without args of its own, rt takes the
+// CNI_ARGS and capability args libcni cached at ADD, so plugins such as
+// portmap find what to undo.
+func (c *CNI) delNetworkList(ctx context.Context, cl *libcni.NetworkConfigList, rt *libcni.RuntimeConf) error {
+	if rt.Args == nil && rt.CapabilityArgs == nil {
+		if _, cached, err := c.cniConf.GetNetworkListCachedConfig(cl, rt); err == nil && cached != nil {
+			rt = cached
+		}
+	}
+	return c.retry(ctx, "DEL", rt, func(ctx context.Context) error {
+		return c.cniConf.DelNetworkList(ctx, cl, rt)
+	})
+}
+
+// retry runs fn up to cni_retries+1 times, each attempt bounded by
+// cni_timeout_seconds. Plugins run under the attempt's context, so a hung
+// plugin is killed when its attempt times out.
+func (c *CNI) retry(ctx context.Context, op string, rt *libcni.RuntimeConf, fn func(context.Context) error) error {
+	return retryOp(ctx, c.conf.CNITimeout(), c.conf.CNIRetries, retryBackoff, fn,
+		func(attempt int, err error) {
+			log.WithFunc("cni.retry").Warnf(ctx, "CNI %s %s/%s attempt %d failed: %v (retrying)", op, rt.ContainerID, rt.IfName, attempt, err)
+		})
+}
+
+// retryOp runs fn up to retries+1 times, each attempt under its own
+// timeout, sleeping backoff (doubling, capped at maxRetryBackoff) between
+// attempts. onRetry is called before each retry. Cancellation of ctx stops
+// retrying immediately.
+func retryOp(ctx context.Context, timeout time.Duration, retries int, backoff time.Duration, fn func(context.Context) error, onRetry func(int, error)) error {
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := fn(attemptCtx)
+		timedOut := errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if timedOut && ctx.Err() == nil {
+			err = fmt.Errorf("timed out after %s (plugin hung?): %w", timeout, err)
+		}
+		if ctx.Err() != nil || attempt > retries {
+			if attempt > 1 {
+				return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+		onRetry(attempt, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff) //nolint:mnd
+	}
+}
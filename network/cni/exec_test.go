@@ -0,0 +1,65 @@
+package cni
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryOp(t *testing.T) {
+	errBoom := errors.New("boom")
+	tests := []struct {
+		name     string
+		retries  int
+		failures int  // attempts that fail before one succeeds
+		hang     bool // failing attempts block until their timeout
+		wantErr  string
+		wantRuns int
+	}{
+		{"ok first try", 2, 0, false, "", 1},
+		{"ok after retry", 2, 2, false, "", 3},
+		{"no retries", 0, 1, false, "boom", 1},
+		{"gives up", 1, 5, false, "gave up after 2 attempts: boom", 2},
+		{"hung plugin", 1, 5, true, "gave up after 2 attempts: timed out after 10ms (plugin hung?)", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, retried := 0, 0
+			err := retryOp(t.Context(), 10*time.Millisecond, tt.retries, time.Millisecond, func(ctx context.Context) error {
+				runs++
+				if runs > tt.failures {
+					return nil
+				}
+				if tt.hang {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return errBoom
+			}, func(int, error) { retried++ })
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if runs != tt.wantRuns || retried != runs-1 {
+				t.Errorf("runs = %d, retried = %d, want %d runs", runs, retried, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestRetryOp_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	runs := 0
+	err := retryOp(ctx, time.Second, 5, time.Millisecond, func(context.Context) error {
+		runs++
+		cancel()
+		return errors.New("boom")
+	}, func(int, error) {})
+	if err == nil || runs != 1 {
+		t.Fatalf("err = %v, runs = %d; want error after 1 run", err, runs)
+	}
+}
@@ -0,0 +1,395 @@
+package cni
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	cniVersion = "1.0.0"
+	// autoSubnetBase is carved into /24s for networks created without --subnet.
+	autoSubnetBase = "10.89.0.0/16"
+	bridgePrefix   = "cc-"
+	maxIfNameLen   = 15
+)
+
+// CreateNetwork implements network.Manager: it writes a bridge + host-local
+// conflist for spec into the managed conf dir and records spec. A macvtap
+// network needs no conflist: its NICs bypass CNI.
+func (c *CNI) CreateNetwork(ctx context.Context, spec *types.NetworkSpec) (*types.NetworkSpec, error) {
+	var (
+		created *types.NetworkSpec
+		wrote   bool
+	)
+	err := c.store.Update(ctx, func(idx *networkIndex) error {
+		if c.hasConfList(spec.Name) {
+			return fmt.Errorf("network %q already exists", spec.Name)
+		}
+		if _, ok := idx.Defs[spec.Name]; ok {
+			return fmt.Errorf("network %q already exists", spec.Name)
+		}
+		s := *spec
+		if s.IsMacvtap() {
+			if err := s.Validate(); err != nil {
+				return err
+			}
+			if _, err := net.InterfaceByName(s.Parent); err != nil {
+				return fmt.Errorf("--parent %s: %w", s.Parent, err)
+			}
+		} else {
+			if err := c.writeBridgeConfList(&s, idx.Defs); err != nil {
+				return err
+			}
+			wrote = true
+		}
+		now := time.Now()
+		s.Managed = true
+		s.CreatedAt = &now
+		idx.Defs[s.Name] = &s
+		created = &s
+		return nil
+	})
+	if err != nil {
+		// The index was not saved: a conflist without its record would
+		// block the name and serve a network cocoon does not know.
+		if wrote {
+			c.dropConfList(ctx, spec.Name)
+		}
+		return nil, err
+	}
+	return created, nil
+}
+
+// writeBridgeConfList defaults and validates a bridge network spec, then
+// writes and loads its conflist.
+func (c *CNI) writeBridgeConfList(s *types.NetworkSpec, defs map[string]*types.NetworkSpec) error {
+	if err := fillSpec(s, defs, c.externalSubnets(defs)); err != nil {
+		return err
+	}
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if err := checkConflicts(s, defs, c.externalSubnets(defs)); err != nil {
+		return err
+	}
+	data, err := buildConfList(s)
+	if err != nil {
+		return err
+	}
+	cl, err := libcni.ConfListFromBytes(data)
+	if err != nil {
+		return fmt.Errorf("generated conflist: %w", err)
+	}
+	if err := utils.AtomicWriteFile(c.confListPath(s.Name), data, 0o644); err != nil { //nolint:mnd
+		return fmt.Errorf("write conflist: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confLists[s.Name] = cl
+	if c.defaultName == "" {
+		c.defaultName = s.Name
+	}
+	return nil
+}
+
+// dropConfList removes the conflist of network name from disk and memory.
+func (c *CNI) dropConfList(ctx context.Context, name string) {
+	if err := os.Remove(c.confListPath(name)); err != nil && !os.IsNotExist(err) {
+		log.WithFunc("cni.dropConfList").Warnf(ctx, "remove conflist of %q: %v", name, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.confLists, name)
+	if c.defaultName == name {
+		c.defaultName = ""
+	}
+}
+
+func (c *CNI) hasConfList(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.confLists[name]
+	return ok
+}
+
+// externalSubnets returns the IPAM subnets of the loaded conflists that
+// are not managed networks in defs, by network name.
+func (c *CNI) externalSubnets(defs map[string]*types.NetworkSpec) map[string][]*net.IPNet {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := map[string][]*net.IPNet{}
+	for name, cl := range c.confLists {
+		if _, managed := defs[name]; !managed {
+			out[name] = confListSubnets(cl.Bytes)
+		}
+	}
+	return out
+}
+
+// confListSubnets returns the subnets of the IPAM sections of a conflist,
+// in either the "subnet" or the "ranges" form of host-local.
+func confListSubnets(data []byte) []*net.IPNet {
+	var list struct {
+		Plugins []struct {
+			IPAM struct {
+				Subnet string `json:"subnet"`
+				Ranges [][]struct {
+					Subnet string `json:"subnet"`
+				} `json:"ranges"`
+			} `json:"ipam"`
+		} `json:"plugins"`
+	}
+	if json.Unmarshal(data, &list) != nil {
+		return nil
+	}
+	var out []*net.IPNet
+	add := func(s string) {
+		if _, n, err := net.ParseCIDR(s); err == nil {
+			out = append(out, n)
+		}
+	}
+	for _, p := range list.Plugins {
+		add(p.IPAM.Subnet)
+		for _, set := range p.IPAM.Ranges {
+			for _, r := range set {
+				add(r.Subnet)
+			}
+		}
+	}
+	return out
+}
+
+// ListNetworks implements network.Manager: managed networks first, then the
+// conflists found in the CNI conf dir, each sorted by name.
+func (c *CNI) ListNetworks(ctx context.Context) ([]*types.NetworkSpec, error) {
+	var managed, external []*types.NetworkSpec
+	err := c.store.With(ctx, func(idx *networkIndex) error {
+		nics := map[string]int{}
+		for _, rec := range idx.Networks {
+			if rec != nil {
+				nics[rec.Type]++
+			}
+		}
+		for name, def := range idx.Defs {
+			s := *def
+			s.NICs = nics[name]
+			managed = append(managed, &s)
+		}
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		for name := range c.confLists {
+			if _, ok := idx.Defs[name]; !ok {
+				external = append(external, &types.NetworkSpec{Name: name, NICs: nics[name]})
+			}
+		}
+		return nil
+	})
+	byName := func(a, b *types.NetworkSpec) int { return strings.Compare(a.Name, b.Name) }
+	slices.SortFunc(managed, byName)
+	slices.SortFunc(external, byName)
+	return append(managed, external...), err
+}
+
+// RemoveNetworks implements network.Manager. A network with attached NICs
+// is refused with network.ErrInUse; conflists cocoon did not create are
+// never touched.
+func (c *CNI) RemoveNetworks(ctx context.Context, names []string) ([]string, error) {
+	var removed, bridges []string
+	var errs []error
+	if err := c.store.Update(ctx, func(idx *networkIndex) error {
+		// Check every name first so a typo does not leave a partial removal.
+		for _, name := range names {
+			if err := c.checkRemovable(idx, name); err != nil {
+				return err
+			}
+		}
+		for _, name := range names {
+			def := idx.Defs[name]
+			if err := os.Remove(c.confListPath(name)); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("remove conflist of %q: %w", name, err))
+				continue
+			}
+			delete(idx.Defs, name)
+			c.mu.Lock()
+			delete(c.confLists, name)
+			c.mu.Unlock()
+			removed = append(removed, name)
+			if def.Bridge != "" {
+				bridges = append(bridges, def.Bridge)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	// The bridge plugin leaves the bridge behind on CNI DEL.
+	for _, br := range bridges {
+		if delErr := deleteBridge(br); delErr != nil {
+			log.WithFunc("cni.RemoveNetworks").Warnf(ctx, "delete bridge %s: %v", br, delErr)
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+func (c *CNI) checkRemovable(idx *networkIndex, name string) error {
+	if _, ok := idx.Defs[name]; !ok {
+		if c.hasConfList(name) {
+			return fmt.Errorf("network %q was not created by cocoon: remove its conflist from %s", name, c.conf.CNIConfDir)
+		}
+		return fmt.Errorf("network %q: %w", name, network.ErrNotFound)
+	}
+	for _, rec := range idx.Networks {
+		if rec != nil && rec.Type == name {
+			return fmt.Errorf("network %q: %w by VM %s", name, network.ErrInUse, rec.VMID)
+		}
+	}
+	return nil
+}
+
+func (c *CNI) confListPath(name string) string {
+	return filepath.Join(c.conf.ConfDir(), name+".conflist")
+}
+
+// fillSpec defaults the bridge, subnet and gateway of spec.
+func fillSpec(spec *types.NetworkSpec, defs map[string]*types.NetworkSpec, external map[string][]*net.IPNet) error {
+	if spec.Bridge == "" {
+		spec.Bridge = defaultBridge(spec.Name)
+	}
+	if spec.Subnet == "" {
+		subnet, err := freeSubnet(defs, external)
+		if err != nil {
+			return err
+		}
+		spec.Subnet = subnet
+	}
+	if spec.Gateway == "" {
+		_, subnet, err := net.ParseCIDR(spec.Subnet)
+		if err != nil || subnet.IP.To4() == nil {
+			return fmt.Errorf("--subnet %q is invalid: want an IPv4 CIDR", spec.Subnet)
+		}
+		spec.Gateway = nthIP(subnet.IP.To4(), 1).String()
+	}
+	return nil
+}
+
+// defaultBridge names the bridge after the network, hashing names too long
+// for an interface name.
+func defaultBridge(name string) string {
+	if len(bridgePrefix)+len(name) <= maxIfNameLen {
+		return bridgePrefix + name
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return fmt.Sprintf("%s%08x", bridgePrefix, h.Sum32())
+}
+
+// freeSubnet returns the first /24 of autoSubnetBase no managed network
+// or other conflist overlaps.
+func freeSubnet(defs map[string]*types.NetworkSpec, external map[string][]*net.IPNet) (string, error) {
+	_, base, _ := net.ParseCIDR(autoSubnetBase)
+	for i := range 256 { //nolint:mnd
+		candidate := &net.IPNet{IP: nthIP(base.IP.To4(), uint32(i)<<8), Mask: net.CIDRMask(24, 32)} //nolint:mnd,gosec
+		if !overlapsAny(candidate, defs) && overlappedExternal(candidate, external) == "" {
+			return candidate.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no free /24 left in %s: pass --subnet", autoSubnetBase)
+}
+
+// checkConflicts rejects a subnet or bridge another managed network uses,
+// and a subnet overlapping one of the other conflists.
+func checkConflicts(spec *types.NetworkSpec, defs map[string]*types.NetworkSpec, external map[string][]*net.IPNet) error {
+	_, subnet, _ := net.ParseCIDR(spec.Subnet)
+	for _, def := range defs {
+		if def.Bridge == spec.Bridge {
+			return fmt.Errorf("bridge %s is used by network %q", spec.Bridge, def.Name)
+		}
+		if _, other, err := net.ParseCIDR(def.Subnet); err == nil && overlaps(subnet, other) {
+			return fmt.Errorf("subnet %s overlaps network %q (%s)", spec.Subnet, def.Name, def.Subnet)
+		}
+	}
+	if name := overlappedExternal(subnet, external); name != "" {
+		return fmt.Errorf("subnet %s overlaps conflist %q", spec.Subnet, name)
+	}
+	return nil
+}
+
+// overlappedExternal returns the first network, by name, of external with
+// a subnet overlapping n.
+func overlappedExternal(n *net.IPNet, external map[string][]*net.IPNet) string {
+	for _, name := range slices.Sorted(maps.Keys(external)) {
+		for _, other := range external[name] {
+			if overlaps(n, other) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func overlapsAny(n *net.IPNet, defs map[string]*types.NetworkSpec) bool {
+	for _, def := range defs {
+		if _, other, err := net.ParseCIDR(def.Subnet); err == nil && overlaps(n, other) {
+			return true
+		}
+	}
+	return false
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// nthIP returns ip + n.
+func nthIP(ip net.IP, n uint32) net.IP {
+	out := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(out, binary.BigEndian.Uint32(ip.To4())+n)
+	return out
+}
+
+// buildConfList renders spec as a bridge + host-local conflist. The guest
+// gets its address from the CNI result (cocoon wires the tap itself), so
+// the chain needs nothing beyond the bridge.
+func buildConfList(spec *types.NetworkSpec) ([]byte, error) {
+	rng := map[string]string{"subnet": spec.Subnet, "gateway": spec.Gateway}
+	if spec.RangeStart != "" {
+		rng["rangeStart"] = spec.RangeStart
+		rng["rangeEnd"] = spec.RangeEnd
+	}
+	conf := map[string]any{
+		"cniVersion": cniVersion,
+		"name":       spec.Name,
+		"plugins": []any{
+			map[string]any{
+				"type":      "bridge",
+				"bridge":    spec.Bridge,
+				"isGateway": true,
+				"ipMasq":    true,
+				"ipam": map[string]any{
+					"type":   "host-local",
+					"ranges": [][]map[string]string{{rng}},
+					"routes": []map[string]string{{"dst": "0.0.0.0/0"}},
+				},
+			},
+		},
+	}
+	return json.MarshalIndent(conf, "", "  ")
+}
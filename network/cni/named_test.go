@@ -0,0 +1,75 @@
+package cni
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/containernetworking/cni/libcni"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestFillSpec(t *testing.T) {
+	defs := map[string]*types.NetworkSpec{
+		"a": {Name: "a", Bridge: "cc-a", Subnet: "10.89.0.0/24"},
+		"b": {Name: "b", Bridge: "cc-b", Subnet: "10.89.1.0/24"},
+	}
+	spec := &types.NetworkSpec{Name: "a-network-with-a-long-name"}
+	external := map[string][]*net.IPNet{"host": confListSubnets([]byte(`{"plugins":[{"type":"bridge","ipam":{"type":"host-local","subnet":"10.89.2.0/23"}}]}`))}
+	if err := fillSpec(spec, defs, external); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Subnet != "10.89.4.0/24" || spec.Gateway != "10.89.4.1" {
+		t.Errorf("subnet/gateway = %s/%s, want 10.89.4.0/24 and 10.89.4.1", spec.Subnet, spec.Gateway)
+	}
+	if len(spec.Bridge) > maxIfNameLen || !strings.HasPrefix(spec.Bridge, bridgePrefix) {
+		t.Errorf("bridge = %q, want a %s name of at most %d chars", spec.Bridge, bridgePrefix, maxIfNameLen)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	overlap := &types.NetworkSpec{Name: "c", Bridge: "cc-c", Subnet: "10.89.0.0/16", Gateway: "10.89.0.1"}
+	if err := checkConflicts(overlap, defs, nil); err == nil {
+		t.Error("overlapping subnet accepted")
+	}
+	overlapExternal := &types.NetworkSpec{Name: "e", Bridge: "cc-e", Subnet: "10.89.3.0/24", Gateway: "10.89.3.1"}
+	if err := checkConflicts(overlapExternal, defs, external); err == nil || !strings.Contains(err.Error(), `conflist "host"`) {
+		t.Errorf("subnet overlapping a conflist: err = %v", err)
+	}
+	sameBridge := &types.NetworkSpec{Name: "d", Bridge: "cc-a", Subnet: "10.90.0.0/24"}
+	if err := checkConflicts(sameBridge, defs, external); err == nil {
+		t.Error("shared bridge accepted")
+	}
+}
+
+func TestBuildConfList(t *testing.T) {
+	spec := &types.NetworkSpec{
+		Name:       "tenant1",
+		Bridge:     "cc-tenant1",
+		Subnet:     "10.89.3.0/24",
+		Gateway:    "10.89.3.1",
+		RangeStart: "10.89.3.100",
+		RangeEnd:   "10.89.3.200",
+	}
+	data, err := buildConfList(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := libcni.ConfListFromBytes(data)
+	if err != nil {
+		t.Fatalf("parse generated conflist: %v", err)
+	}
+	if cl.Name != "tenant1" || len(cl.Plugins) != 1 || cl.Plugins[0].Network.Type != "bridge" {
+		t.Fatalf("conflist = %s", data)
+	}
+	for _, want := range []string{`"bridge": "cc-tenant1"`, `"rangeStart": "10.89.3.100"`, `"type": "host-local"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("conflist missing %s: %s", want, data)
+		}
+	}
+	if subnets := confListSubnets(data); len(subnets) != 1 || subnets[0].String() != "10.89.3.0/24" {
+		t.Errorf("confListSubnets = %v, want [10.89.3.0/24]", subnets)
+	}
+}
@@ -0,0 +1,285 @@
+package cni
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	// sriovPrefix marks a --network value that assigns a VF of a PF
+	// instead of naming a conflist: "sriov:<pf>[:<vlan>]".
+	sriovPrefix = "sriov:"
+	vfioDriver  = "vfio-pci"
+)
+
+// sysfsRoot is where sysfs is mounted; tests point it at a fake tree.
+var sysfsRoot = "/sys"
+
+// sriovNet is a parsed "sriov:<pf>[:<vlan>]" network.
+type sriovNet struct {
+	PF   string
+	VLAN int // 0 = untagged
+}
+
+// parseSRIOV parses name as an SR-IOV network; ok is false for any other
+// network name.
+func parseSRIOV(name string) (sn sriovNet, ok bool, err error) {
+	rest, ok := strings.CutPrefix(name, sriovPrefix)
+	if !ok {
+		return sriovNet{}, false, nil
+	}
+	pf, vlan, hasVLAN := strings.Cut(rest, ":")
+	if pf == "" || len(pf) > maxIfNameLen {
+		return sriovNet{}, true, fmt.Errorf("--network %q is invalid: want sriov:<pf>[:<vlan>]", name)
+	}
+	sn.PF = pf
+	if hasVLAN {
+		if sn.VLAN, err = strconv.Atoi(vlan); err != nil || sn.VLAN < 1 || sn.VLAN > types.MaxVLAN {
+			return sriovNet{}, true, fmt.Errorf("--network %q is invalid: VLAN must be 1-%d", name, types.MaxVLAN)
+		}
+	}
+	return sn, true, nil
+}
+
+// virtFn is one virtual function of a PF.
+type virtFn struct {
+	Index int
+	Addr  string // PCI address, e.g. 0000:3b:02.1
+}
+
+// listVFs returns the VFs of pf ordered by index.
+func listVFs(pf string) ([]virtFn, error) {
+	links, err := filepath.Glob(filepath.Join(sysfsRoot, "class", "net", pf, "device", "virtfn*"))
+	if err != nil {
+		return nil, err
+	}
+	var vfs []virtFn
+	for _, link := range links {
+		idx, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(link), "virtfn"))
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(link)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", link, err)
+		}
+		vfs = append(vfs, virtFn{Index: idx, Addr: filepath.Base(target)})
+	}
+	if len(vfs) == 0 {
+		return nil, fmt.Errorf("%s has no SR-IOV VFs: enable them with echo N > %s", pf,
+			filepath.Join(sysfsRoot, "class", "net", pf, "device", "sriov_numvfs"))
+	}
+	slices.SortFunc(vfs, func(a, b virtFn) int { return a.Index - b.Index })
+	return vfs, nil
+}
+
+// findVF returns the VF of pf at PCI address addr.
+func findVF(pf, addr string) (virtFn, error) {
+	vfs, err := listVFs(pf)
+	if err != nil {
+		return virtFn{}, err
+	}
+	for _, vf := range vfs {
+		if vf.Addr == addr {
+			return vf, nil
+		}
+	}
+	return virtFn{}, fmt.Errorf("VF %s not found on %s", addr, pf)
+}
+
+// freeVF returns the lowest-index VF of pf not in claimed.
+func freeVF(pf string, claimed map[string]bool) (virtFn, error) {
+	vfs, err := listVFs(pf)
+	if err != nil {
+		return virtFn{}, err
+	}
+	for _, vf := range vfs {
+		if !claimed[vf.Addr] {
+			return vf, nil
+		}
+	}
+	return virtFn{}, fmt.Errorf("all %d VFs of %s are assigned", len(vfs), pf)
+}
+
+// pciDevicePath is the sysfs directory of the PCI device at addr; the
+// hypervisor passes it through.
+func pciDevicePath(addr string) string {
+	return filepath.Join(sysfsRoot, "bus", "pci", "devices", addr)
+}
+
+// bindVFIO hands the PCI device at addr to vfio-pci.
+func bindVFIO(addr string) error {
+	dev := pciDevicePath(addr)
+	if _, err := os.Stat(filepath.Join(dev, "iommu_group")); err != nil {
+		return fmt.Errorf("VF %s has no IOMMU group (is the IOMMU enabled?): %w", addr, err)
+	}
+	if pciDriver(addr) == vfioDriver {
+		return nil
+	}
+	if err := writeSysfs(filepath.Join(dev, "driver_override"), vfioDriver); err != nil {
+		return err
+	}
+	if pciDriver(addr) != "" {
+		if err := writeSysfs(filepath.Join(dev, "driver", "unbind"), addr); err != nil {
+			return err
+		}
+	}
+	if err := writeSysfs(filepath.Join(sysfsRoot, "bus", "pci", "drivers_probe"), addr); err != nil {
+		return err
+	}
+	if drv := pciDriver(addr); drv != vfioDriver {
+		return fmt.Errorf("VF %s bound to %q, not %s (is the vfio-pci module loaded?)", addr, drv, vfioDriver)
+	}
+	return nil
+}
+
+// unbindVFIO returns the PCI device at addr from vfio-pci to its host
+// driver.
+func unbindVFIO(addr string) error {
+	dev := pciDevicePath(addr)
+	// A newline clears the override.
+	if err := writeSysfs(filepath.Join(dev, "driver_override"), "\n"); err != nil {
+		return err
+	}
+	if pciDriver(addr) == vfioDriver {
+		if err := writeSysfs(filepath.Join(dev, "driver", "unbind"), addr); err != nil {
+			return err
+		}
+	}
+	return writeSysfs(filepath.Join(sysfsRoot, "bus", "pci", "drivers_probe"), addr)
+}
+
+// pciDriver returns the driver bound to the PCI device at addr, or "".
+func pciDriver(addr string) string {
+	target, err := os.Readlink(filepath.Join(pciDevicePath(addr), "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+func writeSysfs(path, value string) error {
+	if err := os.WriteFile(path, []byte(value), 0o200); err != nil { //nolint:mnd
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
+
+// releaseVF returns the VF at addr to its host driver and clears its VLAN.
+func releaseVF(pf, addr string) error {
+	errs := []error{unbindVFIO(addr)}
+	if vf, err := findVF(pf, addr); err == nil {
+		errs = append(errs, setVF(pf, vf.Index, nil, 0))
+	}
+	return errors.Join(errs...)
+}
+
+// assignVFs picks a VF for every SR-IOV NIC (sriovs[i] set). On creation
+// the picks are recorded in the index right away, so concurrent creates
+// never share a VF, and the IDs of those records are returned. On
+// recovery each NIC keeps the VF of its persisted config.
+func (c *CNI) assignVFs(ctx context.Context, vmID string, names []string, sriovs []*sriovNet, existing []*types.NetworkConfig, ports []types.PortMapping) ([]virtFn, []string, error) {
+	vfs := make([]virtFn, len(sriovs))
+	if !slices.ContainsFunc(sriovs, func(sn *sriovNet) bool { return sn != nil }) {
+		return vfs, nil, nil
+	}
+	if len(existing) > 0 {
+		for i, sn := range sriovs {
+			if sn == nil {
+				continue
+			}
+			if i >= len(existing) || existing[i] == nil || existing[i].VFIODevice == "" {
+				return nil, nil, fmt.Errorf("NIC %d: no VF recorded for %s", i, names[i])
+			}
+			vf, err := findVF(sn.PF, filepath.Base(existing[i].VFIODevice))
+			if err != nil {
+				return nil, nil, fmt.Errorf("NIC %d: %w", i, err)
+			}
+			vfs[i] = vf
+		}
+		return vfs, nil, nil
+	}
+	var ids []string
+	if err := c.store.Update(ctx, func(idx *networkIndex) error {
+		claimed := map[string]bool{}
+		for _, rec := range idx.Networks {
+			if rec != nil && rec.VF != "" {
+				claimed[rec.VF] = true
+			}
+		}
+		for i, sn := range sriovs {
+			if sn == nil {
+				continue
+			}
+			vf, err := freeVF(sn.PF, claimed)
+			if err != nil {
+				return fmt.Errorf("NIC %d: %w", i, err)
+			}
+			id, err := utils.GenerateID()
+			if err != nil {
+				return err
+			}
+			claimed[vf.Addr] = true
+			rec := &networkRecord{ID: id, Type: names[i], VMID: vmID, IfName: fmt.Sprintf("eth%d", i), VF: vf.Addr}
+			// Published ports are forwarded to the first NIC.
+			if i == 0 {
+				rec.Ports = ports
+			}
+			idx.Networks[id] = rec
+			ids = append(ids, id)
+			vfs[i] = vf
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	return vfs, ids, nil
+}
+
+// setupVF programs vf's MAC (mac, or a random one) and VLAN, then binds
+// it to vfio-pci. The returned config has no static address: the guest
+// leases one on the PF's LAN.
+func setupVF(sn sriovNet, vf virtFn, mac string) (*types.NetworkConfig, error) {
+	hw, err := network.RandomMAC()
+	if mac != "" {
+		hw, err = net.ParseMAC(mac)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("VF MAC: %w", err)
+	}
+	if err := setVF(sn.PF, vf.Index, hw, sn.VLAN); err != nil {
+		return nil, err
+	}
+	if err := bindVFIO(vf.Addr); err != nil {
+		return nil, err
+	}
+	return &types.NetworkConfig{VFIODevice: pciDevicePath(vf.Addr), Mac: hw.String()}, nil
+}
+
+// dropRecords removes the records with ids, rolling back assignVFs.
+func (c *CNI) dropRecords(ctx context.Context, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := c.store.Update(ctx, func(idx *networkIndex) error {
+		for _, id := range ids {
+			delete(idx.Networks, id)
+		}
+		return nil
+	}); err != nil {
+		log.WithFunc("cni.dropRecords").Warnf(ctx, "drop records %v: %v", ids, err)
+	}
+}
@@ -0,0 +1,63 @@
+package cni
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSRIOV(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    sriovNet
+		ok      bool
+		wantErr bool
+	}{
+		{name: "bridge"},
+		{name: "sriov:ens1f0", want: sriovNet{PF: "ens1f0"}, ok: true},
+		{name: "sriov:ens1f0:100", want: sriovNet{PF: "ens1f0", VLAN: 100}, ok: true},
+		{name: "sriov:", ok: true, wantErr: true},
+		{name: "sriov:ens1f0:0", ok: true, wantErr: true},
+		{name: "sriov:ens1f0:vlan", ok: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := parseSRIOV(tt.name)
+			if ok != tt.ok || (err != nil) != tt.wantErr {
+				t.Fatalf("parseSRIOV = ok %v, err %v; want ok %v, wantErr %v", ok, err, tt.ok, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeVF(t *testing.T) {
+	root := t.TempDir()
+	old := sysfsRoot
+	sysfsRoot = root
+	t.Cleanup(func() { sysfsRoot = old })
+
+	dev := filepath.Join(root, "class", "net", "pf0", "device")
+	if err := os.MkdirAll(dev, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// virtfn10 sorts before virtfn2 by name, not by index.
+	for idx, addr := range map[string]string{"0": "0000:3b:02.0", "2": "0000:3b:02.2", "10": "0000:3b:03.2"} {
+		if err := os.Symlink("../"+addr, filepath.Join(dev, "virtfn"+idx)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	vf, err := freeVF("pf0", map[string]bool{"0000:3b:02.0": true})
+	if err != nil || vf.Index != 2 || vf.Addr != "0000:3b:02.2" {
+		t.Errorf("freeVF = %+v, %v; want VF 2 at 0000:3b:02.2", vf, err)
+	}
+	if _, err := freeVF("pf0", map[string]bool{"0000:3b:02.0": true, "0000:3b:02.2": true, "0000:3b:03.2": true}); err == nil {
+		t.Error("freeVF with every VF claimed succeeded")
+	}
+	if _, err := freeVF("pf1", nil); err == nil {
+		t.Error("freeVF on a PF without VFs succeeded")
+	}
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/vishvananda/netlink"
+)
+
+// NeighborMAC returns the MAC the host's neighbor table holds for addr on
+// the link the host routes addr through, i.e. the machine replies to addr
+// are delivered to. It fails when addr is not on a directly attached link.
+func NeighborMAC(addr netip.Addr) (net.HardwareAddr, error) {
+	routes, err := netlink.RouteGet(addr.AsSlice())
+	if err != nil || len(routes) == 0 {
+		return nil, fmt.Errorf("route to %s: %w", addr, err)
+	}
+	family := netlink.FAMILY_V4
+	if addr.Is6() {
+		family = netlink.FAMILY_V6
+	}
+	neighs, err := netlink.NeighList(routes[0].LinkIndex, family)
+	if err != nil {
+		return nil, fmt.Errorf("list neighbors: %w", err)
+	}
+	for _, n := range neighs {
+		if n.State&(netlink.NUD_INCOMPLETE|netlink.NUD_FAILED) != 0 || len(n.HardwareAddr) == 0 {
+			continue
+		}
+		if ip, ok := netip.AddrFromSlice(n.IP); ok && ip.Unmap() == addr {
+			return n.HardwareAddr, nil
+		}
+	}
+	return nil, fmt.Errorf("no neighbor entry for %s", addr)
+}
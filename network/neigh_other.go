@@ -0,0 +1,14 @@
+//go:build !linux
+
+package network
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+)
+
+// NeighborMAC always fails on non-Linux platforms.
+func NeighborMAC(netip.Addr) (net.HardwareAddr, error) {
+	return nil, errors.New("reading the neighbor table is only supported on Linux")
+}
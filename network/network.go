@@ -3,6 +3,7 @@ package network
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/projecteru2/cocoon/gc"
 	"github.com/projecteru2/cocoon/types"
@@ -11,6 +12,7 @@ import (
 var (
 	ErrNotFound      = errors.New("network not found")
 	ErrNotConfigured = errors.New("network provider not configured")
+	ErrInUse         = errors.New("network in use")
 )
 
 type Network interface {
@@ -22,7 +24,9 @@ type Network interface {
 	// Config creates network namespace, bridge, and tap for a VM.
 	// When existing configs are provided (recovery after host reboot),
 	// the netns and tap devices are recreated using the persisted MAC addresses.
-	// NOTE: vmCfg.Network may be mutated to record the resolved conflist name.
+	// NIC i is attached to vmCfg.NICNetwork(i), or to existing[i].Conflist
+	// on recovery. NOTE: vmCfg.Network and vmCfg.Networks may be mutated to
+	// record the resolved conflist names.
 	Config(ctx context.Context, vmID string, numNICs int, vmCfg *types.VMConfig, existing ...*types.NetworkConfig) ([]*types.NetworkConfig, error)
 	Delete(context.Context, []string) ([]string, error)
 	Inspect(context.Context, string) (*types.Network, error)
@@ -30,3 +34,33 @@ type Network interface {
 
 	RegisterGC(*gc.Orchestrator)
 }
+
+// Manager is implemented by providers that manage named networks
+// ("cocoon network create/ls/rm").
+type Manager interface {
+	// CreateNetwork fills in spec's defaults, generates its configuration
+	// and records it; the network is usable with --network right away.
+	CreateNetwork(ctx context.Context, spec *types.NetworkSpec) (*types.NetworkSpec, error)
+	// ListNetworks returns every network VMs can attach to.
+	ListNetworks(ctx context.Context) ([]*types.NetworkSpec, error)
+	// RemoveNetworks removes managed networks no VM is attached to and
+	// returns the names removed.
+	RemoveNetworks(ctx context.Context, names []string) ([]string, error)
+}
+
+// Recover recreates missing network plumbing (netns, tap, TC redirect) for a
+// VM whose netns was lost, e.g. after host reboot. The persisted configs are
+// passed as existing so MACs and IPs are preserved. Returns false when the
+// VM has no NICs or its netns is still present.
+func Recover(ctx context.Context, p Network, vm *types.VM) (bool, error) {
+	if p == nil || vm == nil || len(vm.NetworkConfigs) == 0 {
+		return false, nil
+	}
+	if p.Verify(ctx, vm.ID) == nil {
+		return false, nil
+	}
+	if _, err := p.Config(ctx, vm.ID, len(vm.NetworkConfigs), &vm.Config, vm.NetworkConfigs...); err != nil {
+		return true, fmt.Errorf("recover network for VM %s: %w", vm.ID, err)
+	}
+	return true, nil
+}
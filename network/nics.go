@@ -0,0 +1,71 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// NICInspector is implemented by providers that keep their own per-NIC
+// records, to merge them into the view "network inspect" shows.
+type NICInspector interface {
+	// InspectNICs describes each of vm's NICs, in order.
+	InspectNICs(ctx context.Context, vm *types.VM) ([]*types.NICInfo, error)
+}
+
+// DescribeNICs builds the NIC view of vm from its persisted network configs
+// alone. Published ports belong to the first NIC.
+func DescribeNICs(vm *types.VM) []*types.NICInfo {
+	nics := make([]*types.NICInfo, 0, len(vm.NetworkConfigs))
+	for i, nc := range vm.NetworkConfigs {
+		if nc == nil {
+			continue
+		}
+		info := &types.NICInfo{
+			Index:      i,
+			Network:    nc.Conflist,
+			Kind:       nicKind(nc),
+			NetnsPath:  nc.NetnsPath,
+			Tap:        nc.Tap,
+			Macvtap:    nc.Macvtap,
+			VFIODevice: nc.VFIODevice,
+			UserSocket: nc.UserSocket,
+			Mac:        nc.Mac,
+			IP:         nc.IP(),
+			VLAN:       nc.VLAN,
+			RateLimit:  nc.RateLimit,
+		}
+		if nc.Network != nil {
+			info.Prefix, info.Gateway = nc.Network.Prefix, nc.Network.Gateway
+		}
+		if i == 0 {
+			info.Ports = vm.Config.Publish
+		}
+		nics = append(nics, info)
+	}
+	return nics
+}
+
+func nicKind(nc *types.NetworkConfig) string {
+	switch {
+	case nc.UserSocket != "":
+		return types.NICKindUsermode
+	case nc.VFIODevice != "":
+		return types.NICKindSRIOV
+	case nc.Macvtap != "":
+		return types.NICKindMacvtap
+	}
+	return types.NICKindTap
+}
+
+// RandomMAC returns a random locally administered unicast MAC address.
+func RandomMAC() (net.HardwareAddr, error) {
+	mac := make(net.HardwareAddr, 6) //nolint:mnd
+	if _, err := rand.Read(mac); err != nil {
+		return nil, err
+	}
+	mac[0] = mac[0]&0xfe | 0x02 //nolint:mnd
+	return mac, nil
+}
@@ -0,0 +1,46 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestDescribeNICs(t *testing.T) {
+	vm := &types.VM{
+		Config: types.VMConfig{Publish: []types.PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: "tcp"}}},
+		NetworkConfigs: []*types.NetworkConfig{
+			{
+				Tap: "tap0", Mac: "02:00:00:00:00:01", NetnsPath: "/var/run/netns/cocoon-vm1", Conflist: "cocoon",
+				Network: &types.Network{IP: "10.88.0.5", Gateway: "10.88.0.1", Prefix: 16},
+			},
+			{Macvtap: "mvtvm11", Mac: "02:00:00:00:00:02", Conflist: "lan", GuestIP: "192.168.1.20"},
+			nil,
+			{VFIODevice: "/sys/bus/pci/devices/0000:3b:02.0", Mac: "02:00:00:00:00:03"},
+			{UserSocket: "/run/cocoon/usermode/vm1/passt.sock", Mac: "02:00:00:00:00:04"},
+		},
+	}
+	nics := DescribeNICs(vm)
+	if len(nics) != 4 {
+		t.Fatalf("got %d NICs, want 4", len(nics))
+	}
+	for i, want := range []struct {
+		index int
+		kind  string
+		ip    string
+		ports int
+	}{
+		{0, types.NICKindTap, "10.88.0.5", 1},
+		{1, types.NICKindMacvtap, "192.168.1.20", 0},
+		{3, types.NICKindSRIOV, "", 0},
+		{4, types.NICKindUsermode, "", 0},
+	} {
+		n := nics[i]
+		if n.Index != want.index || n.Kind != want.kind || n.IP != want.ip || len(n.Ports) != want.ports {
+			t.Errorf("NIC %d = {index %d, kind %s, ip %q, %d ports}, want %+v", i, n.Index, n.Kind, n.IP, len(n.Ports), want)
+		}
+	}
+	if nics[0].Gateway != "10.88.0.1" || nics[0].Prefix != 16 || nics[0].Network != "cocoon" {
+		t.Errorf("tap NIC addressing = %+v", nics[0])
+	}
+}
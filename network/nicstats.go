@@ -0,0 +1,32 @@
+package network
+
+import "github.com/projecteru2/cocoon/types"
+
+// hostCounters are a host device's own counters: rx is what the device
+// received.
+type hostCounters struct {
+	rxBytes, txBytes     uint64
+	rxPackets, txPackets uint64
+	rxDropped, txDropped uint64
+}
+
+// guestView turns the counters of NIC i's host device into the guest's
+// view. A tap receives what the VMM writes, i.e. what the guest sends; a
+// macvtap transmits it onto its parent.
+func guestView(i int, dev string, c hostCounters, tap bool) types.NICStats {
+	if tap {
+		c.rxBytes, c.txBytes = c.txBytes, c.rxBytes
+		c.rxPackets, c.txPackets = c.txPackets, c.rxPackets
+		c.rxDropped, c.txDropped = c.txDropped, c.rxDropped
+	}
+	return types.NICStats{
+		Index:     i,
+		Device:    dev,
+		RxBytes:   c.rxBytes,
+		TxBytes:   c.txBytes,
+		RxPackets: c.rxPackets,
+		TxPackets: c.txPackets,
+		RxDropped: c.rxDropped,
+		TxDropped: c.txDropped,
+	}
+}
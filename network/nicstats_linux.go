@@ -0,0 +1,79 @@
+//go:build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+// CollectNICStats reads the traffic counters of each NIC's host device over
+// netlink: the tap inside the VM's netns, or the macvtap in the host netns.
+// NICs without one (SR-IOV, usermode) are skipped, as are NICs whose
+// device cannot be read; their errors are joined.
+func CollectNICStats(configs []*types.NetworkConfig) ([]types.NICStats, error) {
+	handles := map[string]*netlink.Handle{}
+	defer func() {
+		for _, h := range handles {
+			h.Close()
+		}
+	}()
+
+	var stats []types.NICStats
+	var errs []error
+	for i, nc := range configs {
+		if nc == nil {
+			continue
+		}
+		dev, nsPath, tap := nc.Tap, nc.NetnsPath, true
+		if nc.Macvtap != "" {
+			dev, nsPath, tap = nc.Macvtap, "", false
+		}
+		if dev == "" || nc.VFIODevice != "" || nc.UserSocket != "" {
+			continue
+		}
+		h, ok := handles[nsPath]
+		if !ok {
+			var err error
+			if h, err = netlinkHandle(nsPath); err != nil {
+				errs = append(errs, fmt.Errorf("NIC %d: %w", i, err))
+				continue
+			}
+			handles[nsPath] = h
+		}
+		link, err := h.LinkByName(dev)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("NIC %d: find %s: %w", i, dev, err))
+			continue
+		}
+		s := link.Attrs().Statistics
+		if s == nil {
+			continue
+		}
+		stats = append(stats, guestView(i, dev, hostCounters{
+			rxBytes: s.RxBytes, txBytes: s.TxBytes,
+			rxPackets: s.RxPackets, txPackets: s.TxPackets,
+			rxDropped: s.RxDropped, txDropped: s.TxDropped,
+		}, tap))
+	}
+	return stats, errors.Join(errs...)
+}
+
+// netlinkHandle opens a netlink handle in the netns at nsPath, or in the
+// current one when nsPath is empty.
+func netlinkHandle(nsPath string) (*netlink.Handle, error) {
+	if nsPath == "" {
+		return netlink.NewHandle()
+	}
+	ns, err := netns.GetFromPath(nsPath)
+	if err != nil {
+		return nil, fmt.Errorf("open netns %s: %w", nsPath, err)
+	}
+	defer ns.Close() //nolint:errcheck
+	return netlink.NewHandleAt(ns)
+}
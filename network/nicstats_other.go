@@ -0,0 +1,11 @@
+//go:build !linux
+
+package network
+
+import "github.com/projecteru2/cocoon/types"
+
+// CollectNICStats reports nothing on non-Linux platforms, which have no
+// tap or macvtap devices to read.
+func CollectNICStats([]*types.NetworkConfig) ([]types.NICStats, error) {
+	return nil, nil
+}
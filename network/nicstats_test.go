@@ -0,0 +1,25 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestGuestView(t *testing.T) {
+	host := hostCounters{rxBytes: 100, txBytes: 200, rxPackets: 1, txPackets: 2, rxDropped: 3, txDropped: 4}
+	for _, tt := range []struct {
+		name string
+		tap  bool
+		want types.NICStats
+	}{
+		{"tap", true, types.NICStats{Index: 1, Device: "dev", RxBytes: 200, TxBytes: 100, RxPackets: 2, TxPackets: 1, RxDropped: 4, TxDropped: 3}},
+		{"macvtap", false, types.NICStats{Index: 1, Device: "dev", RxBytes: 100, TxBytes: 200, RxPackets: 1, TxPackets: 2, RxDropped: 3, TxDropped: 4}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guestView(1, "dev", host, tt.tap); got != tt.want {
+				t.Errorf("guestView = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeVLAN = 0x8100
+
+	dhcpServerPort = 67
+	dhcpClientPort = 68
+	dhcpOptionType = 53
+	dhcpTypeAck    = 5
+	dhcpOptionEnd  = 255
+	dhcpOptionPad  = 0
+)
+
+var dhcpMagicCookie = []byte{99, 130, 83, 99}
+
+// parseGuestIP extracts the IPv4 address a guest with the given MAC claims
+// in one Ethernet frame: the sender address of its ARP packets, or the
+// address a DHCP server acknowledged for it. ARP probes (sender 0.0.0.0)
+// are ignored.
+func parseGuestIP(frame []byte, mac net.HardwareAddr) (string, bool) {
+	if len(frame) < 14 { //nolint:mnd
+		return "", false
+	}
+	etherType := binary.BigEndian.Uint16(frame[12:14])
+	payload := frame[14:]
+	if etherType == etherTypeVLAN && len(payload) >= 4 {
+		etherType = binary.BigEndian.Uint16(payload[2:4])
+		payload = payload[4:]
+	}
+	switch etherType {
+	case etherTypeARP:
+		return parseARP(payload, mac)
+	case etherTypeIPv4:
+		return parseDHCPAck(payload, mac)
+	}
+	return "", false
+}
+
+func parseARP(p []byte, mac net.HardwareAddr) (string, bool) {
+	// htype(2) ptype(2) hlen(1) plen(1) oper(2) sha(6) spa(4) tha(6) tpa(4)
+	if len(p) < 28 || p[4] != 6 || p[5] != 4 { //nolint:mnd
+		return "", false
+	}
+	if !bytes.Equal(p[8:14], mac) {
+		return "", false
+	}
+	spa := net.IP(p[14:18])
+	if spa.IsUnspecified() {
+		return "", false
+	}
+	return spa.String(), true
+}
+
+func parseDHCPAck(p []byte, mac net.HardwareAddr) (string, bool) {
+	if len(p) < 20 || p[0]>>4 != 4 || p[9] != 17 { //nolint:mnd // IPv4, UDP
+		return "", false
+	}
+	ihl := int(p[0]&0x0f) * 4 //nolint:mnd
+	if len(p) < ihl+8 {
+		return "", false
+	}
+	udp := p[ihl:]
+	if binary.BigEndian.Uint16(udp[0:2]) != dhcpServerPort || binary.BigEndian.Uint16(udp[2:4]) != dhcpClientPort {
+		return "", false
+	}
+	// BOOTP: op(1) ... yiaddr at 16, chaddr at 28, magic cookie at 236.
+	bootp := udp[8:]
+	if len(bootp) < 240 || bootp[0] != 2 || !bytes.Equal(bootp[28:34], mac) { //nolint:mnd
+		return "", false
+	}
+	if !bytes.Equal(bootp[236:240], dhcpMagicCookie) {
+		return "", false
+	}
+	if !dhcpIsAck(bootp[240:]) {
+		return "", false
+	}
+	yiaddr := net.IP(bootp[16:20])
+	if yiaddr.IsUnspecified() {
+		return "", false
+	}
+	return yiaddr.String(), true
+}
+
+// dhcpIsAck walks the DHCP options for a message type of DHCPACK.
+func dhcpIsAck(opts []byte) bool {
+	for len(opts) > 0 {
+		code := opts[0]
+		switch code {
+		case dhcpOptionEnd:
+			return false
+		case dhcpOptionPad:
+			opts = opts[1:]
+			continue
+		}
+		if len(opts) < 2 || len(opts) < 2+int(opts[1]) { //nolint:mnd
+			return false
+		}
+		value := opts[2 : 2+int(opts[1])]
+		if code == dhcpOptionType {
+			return len(value) == 1 && value[0] == dhcpTypeAck
+		}
+		opts = opts[2+int(opts[1]):]
+	}
+	return false
+}
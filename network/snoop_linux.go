@@ -0,0 +1,95 @@
+//go:build linux
+
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// snoopPollInterval bounds how long a blocked read delays noticing ctx.
+const snoopPollInterval = 200 * time.Millisecond
+
+// IPSnooper watches a VM's tap device for the IPv4 address the guest claims
+// through DHCP or ARP. Open it before starting the VM so the guest's first
+// DHCP exchange is not missed.
+type IPSnooper struct {
+	fd  int
+	mac net.HardwareAddr
+}
+
+// NewIPSnooper opens a packet socket on the NIC's tap inside its netns, or
+// on its macvtap link in the host netns.
+func NewIPSnooper(nc *types.NetworkConfig) (*IPSnooper, error) {
+	mac, err := net.ParseMAC(nc.Mac)
+	if err != nil {
+		return nil, fmt.Errorf("parse MAC %q: %w", nc.Mac, err)
+	}
+	dev, nsPath := nc.Tap, nc.NetnsPath
+	if nc.Macvtap != "" {
+		dev, nsPath = nc.Macvtap, ""
+	}
+	if nsPath != "" {
+		restore, enterErr := utils.EnterNetns(nsPath)
+		if enterErr != nil {
+			return nil, enterErr
+		}
+		defer restore()
+	}
+	link, err := net.InterfaceByName(dev)
+	if err != nil {
+		return nil, fmt.Errorf("find %s: %w", dev, err)
+	}
+	proto := htons(unix.ETH_P_ALL)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(proto))
+	if err != nil {
+		return nil, fmt.Errorf("open packet socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: proto, Ifindex: link.Index}); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("bind packet socket to %s: %w", dev, err)
+	}
+	tv := unix.NsecToTimeval(snoopPollInterval.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("set receive timeout: %w", err)
+	}
+	return &IPSnooper{fd: fd, mac: mac}, nil
+}
+
+// Wait blocks until the guest claims an address or ctx is done.
+func (s *IPSnooper) Wait(ctx context.Context) (string, error) {
+	buf := make([]byte, 2048) //nolint:mnd
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, _, err := unix.Recvfrom(s.fd, buf, 0)
+		switch {
+		case errors.Is(err, unix.EAGAIN), errors.Is(err, unix.EINTR):
+			continue
+		case err != nil:
+			return "", fmt.Errorf("read packet socket: %w", err)
+		}
+		if ip, ok := parseGuestIP(buf[:n], s.mac); ok {
+			return ip, nil
+		}
+	}
+}
+
+// Close releases the packet socket.
+func (s *IPSnooper) Close() error {
+	return unix.Close(s.fd)
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8 //nolint:mnd
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package network
+
+import (
+	"context"
+	"errors"
+
+	"github.com/projecteru2/cocoon/types"
+)
+
+var errSnoopUnsupported = errors.New("learning guest IPs from traffic is only supported on Linux")
+
+// IPSnooper watches a VM's tap device for the IPv4 address the guest claims.
+// Not supported on this platform.
+type IPSnooper struct{}
+
+// NewIPSnooper always fails on non-Linux platforms.
+func NewIPSnooper(*types.NetworkConfig) (*IPSnooper, error) {
+	return nil, errSnoopUnsupported
+}
+
+// Wait always fails on non-Linux platforms.
+func (*IPSnooper) Wait(context.Context) (string, error) {
+	return "", errSnoopUnsupported
+}
+
+// Close is a no-op on non-Linux platforms.
+func (*IPSnooper) Close() error { return nil }
@@ -0,0 +1,71 @@
+package network
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+var (
+	guestMAC = net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	otherMAC = net.HardwareAddr{0x52, 0x54, 0x00, 0xaa, 0xbb, 0xcc}
+)
+
+func ethernet(etherType uint16, payload []byte) []byte {
+	frame := make([]byte, 14, 14+len(payload))
+	binary.BigEndian.PutUint16(frame[12:], etherType)
+	return append(frame, payload...)
+}
+
+func arp(sha net.HardwareAddr, spa string) []byte {
+	p := []byte{0, 1, 8, 0, 6, 4, 0, 1}
+	p = append(p, sha...)
+	p = append(p, net.ParseIP(spa).To4()...)
+	p = append(p, make([]byte, 10)...) // tha, tpa
+	return ethernet(etherTypeARP, p)
+}
+
+func dhcp(chaddr net.HardwareAddr, yiaddr string, msgType byte) []byte {
+	bootp := make([]byte, 240)
+	bootp[0] = 2 // BOOTREPLY
+	copy(bootp[16:], net.ParseIP(yiaddr).To4())
+	copy(bootp[28:], chaddr)
+	copy(bootp[236:], dhcpMagicCookie)
+	bootp = append(bootp, 1, 4, 255, 255, 255, 0) // subnet mask first
+	bootp = append(bootp, dhcpOptionType, 1, msgType, dhcpOptionEnd)
+
+	udp := make([]byte, 8, 8+len(bootp))
+	binary.BigEndian.PutUint16(udp[0:], dhcpServerPort)
+	binary.BigEndian.PutUint16(udp[2:], dhcpClientPort)
+	udp = append(udp, bootp...)
+
+	ip := make([]byte, 20, 20+len(udp))
+	ip[0] = 0x45
+	ip[9] = 17
+	return ethernet(etherTypeIPv4, append(ip, udp...))
+}
+
+func TestParseGuestIP(t *testing.T) {
+	tests := []struct {
+		name   string
+		frame  []byte
+		want   string
+		wantOK bool
+	}{
+		{name: "arp from guest", frame: arp(guestMAC, "10.0.0.7"), want: "10.0.0.7", wantOK: true},
+		{name: "arp probe", frame: arp(guestMAC, "0.0.0.0")},
+		{name: "arp from other", frame: arp(otherMAC, "10.0.0.8")},
+		{name: "dhcp ack", frame: dhcp(guestMAC, "192.168.1.20", dhcpTypeAck), want: "192.168.1.20", wantOK: true},
+		{name: "dhcp offer", frame: dhcp(guestMAC, "192.168.1.20", 2)},
+		{name: "dhcp ack for other", frame: dhcp(otherMAC, "192.168.1.21", dhcpTypeAck)},
+		{name: "truncated", frame: []byte{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseGuestIP(tt.frame, guestMAC)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseGuestIP() = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package usermode
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	defaultSocketWaitTimeout    = 5 * time.Second
+	defaultTerminateGracePeriod = 5 * time.Second
+
+	passtSockName = "passt.sock"
+	passtPIDName  = "passt.pid"
+	passtLogName  = "passt.log"
+	macName       = "mac"
+)
+
+// Config holds usermode network provider specific configuration, embedding the global config.
+type Config struct {
+	*config.Config
+}
+
+// EnsureDirs creates all static directories required by the usermode network provider.
+func (c *Config) EnsureDirs() error {
+	return utils.EnsureDirs(
+		c.RunDir(),
+		c.LogDir(),
+	)
+}
+
+// RunDir holds one directory per VM with its passt socket and PID file.
+func (c *Config) RunDir() string { return filepath.Join(c.Config.RunDir, "usermode") }
+
+// LogDir holds one directory per VM with its passt log.
+func (c *Config) LogDir() string { return filepath.Join(c.Config.LogDir, "usermode") }
+
+func (c *Config) IndexLock() string { return filepath.Join(c.RunDir(), "usermode.lock") }
+
+func (c *Config) VMRunDir(vmID string) string { return filepath.Join(c.RunDir(), vmID) }
+func (c *Config) VMLogDir(vmID string) string { return filepath.Join(c.LogDir(), vmID) }
+
+func (c *Config) SockPath(vmID string) string { return filepath.Join(c.VMRunDir(vmID), passtSockName) }
+
+func (c *Config) PIDPath(vmID string) string { return filepath.Join(c.VMRunDir(vmID), passtPIDName) }
+
+func (c *Config) LogPath(vmID string) string { return filepath.Join(c.VMLogDir(vmID), passtLogName) }
+
+// MACPath holds the MAC reserved for the VM's NIC.
+func (c *Config) MACPath(vmID string) string { return filepath.Join(c.VMRunDir(vmID), macName) }
+
+// SocketWaitTimeout returns the configured socket wait timeout or the default.
+func (c *Config) SocketWaitTimeout() time.Duration {
+	if c.SocketWaitTimeoutSeconds > 0 {
+		return time.Duration(c.SocketWaitTimeoutSeconds) * time.Second
+	}
+	return defaultSocketWaitTimeout
+}
+
+// TerminateGracePeriod returns the configured SIGTERM→SIGKILL grace period or the default.
+func (c *Config) TerminateGracePeriod() time.Duration {
+	if c.TerminateGracePeriodSeconds > 0 {
+		return time.Duration(c.TerminateGracePeriodSeconds) * time.Second
+	}
+	return defaultTerminateGracePeriod
+}
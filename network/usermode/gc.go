@@ -0,0 +1,44 @@
+package usermode
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/projecteru2/cocoon/gc"
+)
+
+// GCModule returns the GC module that stops passt processes of VMs that
+// no longer exist and removes their directories.
+func (u *Usermode) GCModule() gc.Module[[]string] {
+	return gc.Module[[]string]{
+		Name:   typ,
+		Locker: u.locker,
+		ReadDB: func(_ context.Context) ([]string, error) {
+			return u.vmIDs()
+		},
+		Resolve: func(ids []string, others map[string]any) []string {
+			active := gc.Collect(others, gc.VMIDs)
+			var orphans []string
+			for _, id := range ids {
+				if _, ok := active[id]; !ok {
+					orphans = append(orphans, id)
+				}
+			}
+			slices.Sort(orphans)
+			return orphans
+		},
+		Collect: func(ctx context.Context, ids []string) error {
+			var errs []error
+			for _, id := range ids {
+				errs = append(errs, u.deleteVM(ctx, id))
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
+
+// RegisterGC registers the usermode GC module with the given Orchestrator.
+func (u *Usermode) RegisterGC(orch *gc.Orchestrator) {
+	gc.Register(orch, u.GCModule())
+}
@@ -0,0 +1,112 @@
+package usermode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// startPasst (re)launches the VM's passt and waits for its socket. passt
+// outlives VM stops, accepting the next VMM connection, until Delete.
+func (u *Usermode) startPasst(ctx context.Context, vmID string, mtu int, publish []types.PortMapping) error {
+	u.stopPasst(ctx, vmID)
+
+	if err := utils.EnsureDirs(u.conf.VMRunDir(vmID), u.conf.VMLogDir(vmID)); err != nil {
+		return err
+	}
+	sock := u.conf.SockPath(vmID)
+	vhostUser := u.conf.Hypervisor != config.HypervisorQEMU
+	cmd := exec.Command(u.conf.PasstBinary, passtArgs(sock, u.conf.LogPath(vmID), vhostUser, mtu, publish)...) //nolint:gosec
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("exec passt: %w", err)
+	}
+	pid := cmd.Process.Pid
+
+	if err := utils.WritePIDFile(u.conf.PIDPath(vmID), pid); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("write passt PID file: %w", err)
+	}
+	if err := utils.WaitFor(ctx, u.conf.SocketWaitTimeout(), 50*time.Millisecond, func() (bool, error) { //nolint:mnd
+		if _, err := os.Stat(sock); err == nil {
+			return true, nil
+		}
+		if !utils.IsProcessAlive(pid) {
+			return false, fmt.Errorf("passt exited before its socket was ready (see %s)", u.conf.LogPath(vmID))
+		}
+		return false, nil
+	}); err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		u.stopPasst(ctx, vmID)
+		return fmt.Errorf("passt: %w", err)
+	}
+
+	// Release the process handle: passt is fully detached from Go runtime.
+	_ = cmd.Process.Release()
+	return nil
+}
+
+// stopPasst terminates a VM's passt, if any, and removes its socket and
+// PID file.
+func (u *Usermode) stopPasst(ctx context.Context, vmID string) {
+	pidPath := u.conf.PIDPath(vmID)
+	sock := u.conf.SockPath(vmID)
+	if pid, err := utils.ReadPIDFile(pidPath); err == nil {
+		if err := utils.TerminateProcess(ctx, pid, u.binaryName(), sock, u.conf.TerminateGracePeriod()); err != nil {
+			log.WithFunc("usermode.stopPasst").Warnf(ctx, "kill passt %d: %v", pid, err)
+		}
+	}
+	for _, p := range []string{pidPath, sock} {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			log.WithFunc("usermode.stopPasst").Warnf(ctx, "cleanup %s: %v", p, err)
+		}
+	}
+}
+
+func (u *Usermode) binaryName() string { return filepath.Base(u.conf.PasstBinary) }
+
+// passtArgs builds passt's command line: foreground, listening on sock
+// (as a vhost-user backend for cloud-hypervisor, a stream socket for QEMU),
+// with fixed guest addressing, the MTU passt advertises over DHCP/NDP when
+// mtu is non-zero, and one -t/-u forward per published port.
+func passtArgs(sock, logFile string, vhostUser bool, mtu int, publish []types.PortMapping) []string {
+	args := []string{
+		"--foreground",
+		"--socket", sock,
+		"--log-file", logFile,
+		"--address", guestIP,
+		"--netmask", strconv.Itoa(guestPrefix),
+		"--gateway", gatewayIP,
+	}
+	if vhostUser {
+		args = append(args, "--vhost-user")
+	}
+	if mtu > 0 {
+		args = append(args, "--mtu", strconv.Itoa(mtu))
+	}
+	for _, m := range publish {
+		flag := "-t"
+		if m.Protocol == types.ProtocolUDP {
+			flag = "-u"
+		}
+		spec := fmt.Sprintf("%d:%d", m.HostPort, m.GuestPort)
+		if m.HostIP != "" {
+			spec = m.HostIP + "/" + spec
+		}
+		args = append(args, flag, spec)
+	}
+	return args
+}
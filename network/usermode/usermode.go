@@ -0,0 +1,221 @@
+// Package usermode implements network.Network without privileges: each VM
+// gets one passt process that NATs the guest's traffic through host
+// sockets and forwards its published ports.
+package usermode
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/lock"
+	"github.com/projecteru2/cocoon/lock/flock"
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	typ = "usermode"
+
+	// Guest addressing handed out by passt; passt maps the gateway
+	// address to the host.
+	guestIP     = "10.0.2.15"
+	gatewayIP   = "10.0.2.2"
+	guestPrefix = 24
+
+	defaultQueueSize = 256
+)
+
+// Usermode implements network.Network with one passt process per VM.
+type Usermode struct {
+	conf   *Config
+	locker lock.Locker
+}
+
+// New creates a usermode network provider.
+func New(conf *config.Config) (*Usermode, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	cfg := &Config{Config: conf}
+	if err := cfg.EnsureDirs(); err != nil {
+		return nil, fmt.Errorf("ensure usermode dirs: %w", err)
+	}
+	return &Usermode{conf: cfg, locker: flock.New(cfg.IndexLock())}, nil
+}
+
+func (u *Usermode) Type() string { return typ }
+
+// Verify checks whether the VM's passt process is running.
+func (u *Usermode) Verify(_ context.Context, vmID string) error {
+	pid, err := utils.ReadPIDFile(u.conf.PIDPath(vmID))
+	if err != nil {
+		return fmt.Errorf("passt of %s: %w", vmID, err)
+	}
+	if !utils.VerifyProcessCmdline(pid, u.binaryName(), u.conf.SockPath(vmID)) {
+		return fmt.Errorf("passt of %s (pid %d) is not running", vmID, pid)
+	}
+	return nil
+}
+
+// Config starts the VM's passt process and returns its single NIC. On
+// recovery the persisted MAC and MTU are kept and passt is restarted;
+// otherwise --mac and --mtu pin them.
+func (u *Usermode) Config(ctx context.Context, vmID string, numNICs int, vmCfg *types.VMConfig, existing ...*types.NetworkConfig) ([]*types.NetworkConfig, error) {
+	if numNICs != 1 {
+		return nil, fmt.Errorf("usermode networking gives a VM exactly one NIC, %d requested", numNICs)
+	}
+	if vmCfg.Network != "" || len(vmCfg.Networks) > 0 {
+		return nil, fmt.Errorf("usermode networking has no named networks: drop --network")
+	}
+	if vmCfg.IP != "" {
+		return nil, fmt.Errorf("usermode networking always gives the guest %s: drop --ip", guestIP)
+	}
+	if len(vmCfg.NetLimits) > 0 {
+		return nil, fmt.Errorf("usermode networking cannot shape bandwidth: drop --net-limit")
+	}
+	if slices.ContainsFunc(vmCfg.VLANs, func(id int) bool { return id > 0 }) {
+		return nil, fmt.Errorf("usermode networking has no host link to tag: drop --vlan")
+	}
+	if len(vmCfg.CNIArgs) > 0 {
+		return nil, fmt.Errorf("usermode networking runs no CNI plugins: drop --cni-arg")
+	}
+
+	var mac string
+	mtu := vmCfg.MTU
+	if len(existing) > 0 && existing[0] != nil {
+		if existing[0].UserSocket == "" {
+			return nil, fmt.Errorf("NIC %s was not created by usermode networking", existing[0].Mac)
+		}
+		mac, mtu = existing[0].Mac, existing[0].MTU
+	} else if mac = vmCfg.NICMAC(0); mac == "" {
+		hw, err := network.RandomMAC()
+		if err != nil {
+			return nil, fmt.Errorf("generate MAC: %w", err)
+		}
+		mac = hw.String()
+	}
+
+	if err := u.locker.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("lock usermode networks: %w", err)
+	}
+	defer u.locker.Unlock(ctx) //nolint:errcheck
+
+	if len(existing) == 0 {
+		if err := u.reserveMAC(vmID, mac); err != nil {
+			return nil, err
+		}
+	}
+	if err := u.startPasst(ctx, vmID, mtu, vmCfg.Publish); err != nil {
+		return nil, err
+	}
+	return []*types.NetworkConfig{{
+		UserSocket: u.conf.SockPath(vmID),
+		Mac:        mac,
+		MTU:        mtu,
+		NumQueues:  2, //nolint:mnd // passt serves a single queue pair
+		QueueSize:  defaultQueueSize,
+		Network:    guestNetwork(),
+	}}, nil
+}
+
+// Delete stops the passt process of each VM and removes its runtime files.
+// Returns the VM IDs that were fully cleaned.
+func (u *Usermode) Delete(ctx context.Context, vmIDs []string) ([]string, error) {
+	if err := u.locker.Lock(ctx); err != nil {
+		return nil, fmt.Errorf("lock usermode networks: %w", err)
+	}
+	defer u.locker.Unlock(ctx) //nolint:errcheck
+
+	result := utils.ForEach(ctx, vmIDs, u.deleteVM)
+	return result.Succeeded, result.Err()
+}
+
+// deleteVM stops a VM's passt and removes its directories.
+func (u *Usermode) deleteVM(ctx context.Context, vmID string) error {
+	u.stopPasst(ctx, vmID)
+	if err := os.RemoveAll(u.conf.VMRunDir(vmID)); err != nil {
+		return fmt.Errorf("remove %s: %w", u.conf.VMRunDir(vmID), err)
+	}
+	if err := os.RemoveAll(u.conf.VMLogDir(vmID)); err != nil {
+		return fmt.Errorf("remove %s: %w", u.conf.VMLogDir(vmID), err)
+	}
+	return nil
+}
+
+// Inspect returns the guest addressing of a VM's NIC, keyed by VM ID.
+// Returns (nil, nil) if the VM has no usermode network.
+func (u *Usermode) Inspect(_ context.Context, vmID string) (*types.Network, error) {
+	if _, err := os.Stat(u.conf.VMRunDir(vmID)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return guestNetwork(), nil
+}
+
+// List returns the guest addressing of every VM with a usermode network.
+func (u *Usermode) List(_ context.Context) ([]*types.Network, error) {
+	ids, err := u.vmIDs()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*types.Network, 0, len(ids))
+	for range ids {
+		result = append(result, guestNetwork())
+	}
+	return result, nil
+}
+
+// vmIDs returns the VMs with a usermode run directory, sorted.
+func (u *Usermode) vmIDs() ([]string, error) {
+	entries, err := os.ReadDir(u.conf.RunDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read %s: %w", u.conf.RunDir(), err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() {
+			ids = append(ids, e.Name())
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// reserveMAC records mac in vmID's run directory, failing when another
+// usermode VM holds it. The caller holds the usermode lock.
+func (u *Usermode) reserveMAC(vmID, mac string) error {
+	ids, err := u.vmIDs()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == vmID {
+			continue
+		}
+		held, err := os.ReadFile(u.conf.MACPath(id))
+		if err != nil {
+			continue // no MAC recorded (created before reservations)
+		}
+		if strings.EqualFold(strings.TrimSpace(string(held)), mac) {
+			return fmt.Errorf("MAC %s is already used by VM %s", mac, id)
+		}
+	}
+	if err := utils.EnsureDirs(u.conf.VMRunDir(vmID)); err != nil {
+		return err
+	}
+	return utils.AtomicWriteFile(u.conf.MACPath(vmID), []byte(mac+"\n"), 0o600) //nolint:mnd
+}
+
+func guestNetwork() *types.Network {
+	return &types.Network{IP: guestIP, Gateway: gatewayIP, Prefix: guestPrefix}
+}
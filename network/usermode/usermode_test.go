@@ -0,0 +1,82 @@
+package usermode
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestPasstArgs(t *testing.T) {
+	publish := []types.PortMapping{
+		{HostPort: 8080, GuestPort: 80, Protocol: types.ProtocolTCP},
+		{HostIP: "127.0.0.1", HostPort: 5353, GuestPort: 53, Protocol: types.ProtocolUDP},
+	}
+	args := passtArgs("/run/vm1/passt.sock", "/log/vm1/passt.log", true, 1400, publish)
+	want := []string{
+		"--foreground",
+		"--socket", "/run/vm1/passt.sock",
+		"--log-file", "/log/vm1/passt.log",
+		"--address", guestIP,
+		"--netmask", "24",
+		"--gateway", gatewayIP,
+		"--vhost-user",
+		"--mtu", "1400",
+		"-t", "8080:80",
+		"-u", "127.0.0.1/5353:53",
+	}
+	if !slices.Equal(args, want) {
+		t.Errorf("passtArgs = %v, want %v", args, want)
+	}
+	if args := passtArgs("/s", "/l", false, 0, nil); slices.Contains(args, "--vhost-user") || slices.Contains(args, "--mtu") {
+		t.Errorf("QEMU passt args %v must not use vhost-user or --mtu", args)
+	}
+}
+
+func TestConfig_Rejects(t *testing.T) {
+	u, err := New(&config.Config{RootDir: t.TempDir(), RunDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	for _, tt := range []struct {
+		name     string
+		nics     int
+		vmCfg    types.VMConfig
+		existing []*types.NetworkConfig
+	}{
+		{"two NICs", 2, types.VMConfig{}, nil},
+		{"named network", 1, types.VMConfig{Network: "cocoon"}, nil},
+		{"fixed IP", 1, types.VMConfig{IP: "10.0.2.20"}, nil},
+		{"bandwidth cap", 1, types.VMConfig{NetLimits: []uint64{100_000_000}}, nil},
+		{"VLAN", 1, types.VMConfig{VLANs: []int{100}}, nil},
+		{"CNI args", 1, types.VMConfig{CNIArgs: []string{"K=V"}}, nil},
+		{"CNI NIC", 1, types.VMConfig{}, []*types.NetworkConfig{{Tap: "tap0", Mac: "02:00:00:00:00:01"}}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := u.Config(t.Context(), "vm1", tt.nics, &tt.vmCfg, tt.existing...); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestReserveMAC(t *testing.T) {
+	u, err := New(&config.Config{RootDir: t.TempDir(), RunDir: t.TempDir(), LogDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := u.reserveMAC("vm1", "02:00:00:00:00:01"); err != nil {
+		t.Fatal(err)
+	}
+	// The VM itself may reserve its MAC again; another VM may not.
+	if err := u.reserveMAC("vm1", "02:00:00:00:00:01"); err != nil {
+		t.Errorf("re-reserve own MAC: %v", err)
+	}
+	if err := u.reserveMAC("vm2", "02:00:00:00:00:01"); err == nil {
+		t.Error("duplicate MAC reserved")
+	}
+	if err := u.reserveMAC("vm2", "02:00:00:00:00:02"); err != nil {
+		t.Errorf("distinct MAC: %v", err)
+	}
+}
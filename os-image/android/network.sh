@@ -23,6 +23,26 @@ cmdline_ip() {
     return 1
 }
 
+# cocoon.dns= lists every DNS server the host configured, with or without ip=.
+cmdline_dns() {
+    for x in $(cat /proc/cmdline); do
+        case "$x" in
+            cocoon.dns=*) echo "${x#cocoon.dns=}"; return 0 ;;
+        esac
+    done
+    return 1
+}
+
+# cocoon.mtu= carries the --mtu override; ip= has no MTU field.
+cmdline_mtu() {
+    for x in $(cat /proc/cmdline); do
+        case "$x" in
+            cocoon.mtu=*) echo "${x#cocoon.mtu=}"; return 0 ;;
+        esac
+    done
+    return 1
+}
+
 main_gw() {
     ip -4 route show table main 2>/dev/null \
         | sed -n 's/^default via \([0-9.]*\).*$/\1/p' \
@@ -50,6 +70,8 @@ if [ -n "$CMDLINE_IP" ]; then
     CMDLINE_DNS2="$(printf '%s' "$CMDLINE_IP" | cut -d: -f9)"
 fi
 
+CMDLINE_MTU="$(cmdline_mtu || true)"
+[ -n "$CMDLINE_MTU" ] && { ip link set "$IFACE" mtu "$CMDLINE_MTU" 2>/dev/null || true; }
 ip link set "$IFACE" up 2>/dev/null || true
 
 # Wait for netd to finish setting up its ip rules (policy tables + 32000 unreachable).
@@ -94,9 +116,14 @@ else
 fi
 
 # Set DNS (no ConnectivityService to configure resolvers).
+CMDLINE_DNS="$(cmdline_dns || true)"
+if [ -n "$CMDLINE_DNS" ]; then
+    CMDLINE_DNS1="$(printf '%s' "$CMDLINE_DNS" | cut -d, -f1)"
+    CMDLINE_DNS2="$(printf '%s' "$CMDLINE_DNS" | cut -s -d, -f2)"
+fi
 DNS1="${CMDLINE_DNS1:-8.8.8.8}"
 DNS2="${CMDLINE_DNS2:-1.1.1.1}"
 setprop net.dns1 "$DNS1"
 setprop net.dns2 "$DNS2"
 
-log -t cocoon-network "iface=$IFACE gw=${GW:-none} tables=[$TABLES] dns=[$DNS1,$DNS2]"
+log -t cocoon-network "iface=$IFACE mtu=${CMDLINE_MTU:-default} gw=${GW:-none} tables=[$TABLES] dns=[$DNS1,$DNS2]"
@@ -9,6 +9,15 @@ resolve_disk() {
     case "$timeout" in ''|*[!0-9]*) timeout=10 ;; esac
 
     while [ $i -lt $timeout ]; do
+        # virtio-pmem layers are named by pmem region, not serial.
+        case "$serial" in
+            pmem[0-9]*)
+                [ -b "/dev/${serial}" ] && { echo "/dev/${serial}"; return 0; }
+                sleep 1
+                i=$((i + 1))
+                continue
+                ;;
+        esac
         for sysdev in /sys/block/vd*; do
             [ -d "$sysdev" ] || continue
             local s=""
@@ -42,6 +51,7 @@ mountroot() {
 
     # Native environment: modprobe automatically resolves all underlying dependencies.
     modprobe erofs 2>/dev/null || true
+    modprobe virtio_pmem 2>/dev/null || true
     modprobe overlay 2>/dev/null || true
     modprobe ext4 2>/dev/null || true
 
@@ -70,7 +80,11 @@ mountroot() {
         dev=$(resolve_disk "$serial") || panic "device ${serial} not found"
         mnt="${COCOON_INTERNAL}/layers/${serial}"
         mkdir -p "$mnt"
-        mount -t erofs -o ro "$dev" "$mnt" || panic "mount ${serial} failed"
+        # pmem layers are mapped with DAX: reads hit the host page cache directly.
+        case "$serial" in
+            pmem[0-9]*) mount -t erofs -o ro,dax=always "$dev" "$mnt" 2>/dev/null || mount -t erofs -o ro "$dev" "$mnt" || panic "mount ${serial} failed" ;;
+            *) mount -t erofs -o ro "$dev" "$mnt" || panic "mount ${serial} failed" ;;
+        esac
         [ -n "$LOWER" ] && LOWER="${LOWER}:"
         LOWER="${LOWER}${mnt}"
         LAYER_DEVS="${LAYER_DEVS} ${dev}"
@@ -81,7 +95,8 @@ mountroot() {
     cow_dev=$(resolve_disk "$COW") || panic "COW device ${COW} not found"
     mkdir -p "${COCOON_INTERNAL}/cow"
     # [Performance] Added noatime to reduce unnecessary write operations on the COW disk.
-    mount -t ext4 -o noatime "$cow_dev" "${COCOON_INTERNAL}/cow" || panic "mount COW failed"
+    # discard passes deletes down as TRIM, so the host's sparse COW file shrinks with them.
+    mount -t ext4 -o noatime,discard "$cow_dev" "${COCOON_INTERNAL}/cow" || panic "mount COW failed"
     mkdir -p "${COCOON_INTERNAL}/cow/upper" "${COCOON_INTERNAL}/cow/work"
 
     # Assemble Overlayfs
@@ -17,12 +17,30 @@ case "$1" in prereqs) prereqs; exit 0 ;; esac
 # $rootmnt is set by initramfs — points to the mounted root filesystem.
 [ -z "$rootmnt" ] && exit 0
 
-# Set hostname from cocoon.hostname= kernel parameter.
+# Set hostname from cocoon.hostname= kernel parameter (and its FQDN from
+# cocoon.domain=), and collect the host's DNS servers from cocoon.dns=
+# (comma separated; ip= holds only two) and the --mtu override from
+# cocoon.mtu= (ip= has no MTU field).
+_cocoon_hostname=""
+_cocoon_domain=""
+_cocoon_dns=""
+_cocoon_mtu=""
 for _arg in $(cat /proc/cmdline); do
     case "$_arg" in
-        cocoon.hostname=*) echo "${_arg#cocoon.hostname=}" > "${rootmnt}/etc/hostname" ;;
+        cocoon.hostname=*) _cocoon_hostname="${_arg#cocoon.hostname=}" ;;
+        cocoon.domain=*) _cocoon_domain="${_arg#cocoon.domain=}" ;;
+        cocoon.dns=*) _cocoon_dns=$(echo "${_arg#cocoon.dns=}" | tr ',' ' ') ;;
+        cocoon.mtu=*) _cocoon_mtu="${_arg#cocoon.mtu=}" ;;
     esac
 done
+if [ -n "$_cocoon_hostname" ]; then
+    echo "$_cocoon_hostname" > "${rootmnt}/etc/hostname"
+    # Debian convention: the FQDN resolves to 127.0.1.1 so "hostname -f" works.
+    if [ -n "$_cocoon_domain" ]; then
+        sed -i '/^127\.0\.1\.1[[:space:]]/d' "${rootmnt}/etc/hosts" 2>/dev/null
+        printf "127.0.1.1\t%s.%s %s\n" "$_cocoon_hostname" "$_cocoon_domain" "$_cocoon_hostname" >> "${rootmnt}/etc/hosts"
+    fi
+fi
 
 _dns_servers=""
 _has_static=false
@@ -67,12 +85,17 @@ EOF
     {
         printf "[Match]\nMACAddress=%s\n\n[Network]\nAddress=%s/%d\n" "$HWADDR" "$IPV4ADDR" "$prefix"
         [ -n "$IPV4GATEWAY" ] && [ "$IPV4GATEWAY" != "0.0.0.0" ] && printf "Gateway=%s\n" "$IPV4GATEWAY"
-        [ -n "$IPV4DNS0" ] && [ "$IPV4DNS0" != "0.0.0.0" ] && printf "DNS=%s\n" "$IPV4DNS0"
-        [ -n "$IPV4DNS1" ] && [ "$IPV4DNS1" != "0.0.0.0" ] && printf "DNS=%s\n" "$IPV4DNS1"
-        # Fallback DNS if none provided.
-        if [ -z "$IPV4DNS0" ] || [ "$IPV4DNS0" = "0.0.0.0" ]; then
-            printf "DNS=8.8.8.8\nDNS=8.8.4.4\n"
+        if [ -n "$_cocoon_dns" ]; then
+            for _ns in $_cocoon_dns; do printf "DNS=%s\n" "$_ns"; done
+        else
+            [ -n "$IPV4DNS0" ] && [ "$IPV4DNS0" != "0.0.0.0" ] && printf "DNS=%s\n" "$IPV4DNS0"
+            [ -n "$IPV4DNS1" ] && [ "$IPV4DNS1" != "0.0.0.0" ] && printf "DNS=%s\n" "$IPV4DNS1"
+            # Fallback DNS if none provided.
+            if [ -z "$IPV4DNS0" ] || [ "$IPV4DNS0" = "0.0.0.0" ]; then
+                printf "DNS=8.8.8.8\nDNS=8.8.4.4\n"
+            fi
         fi
+        [ -n "$_cocoon_mtu" ] && printf "\n[Link]\nMTUBytes=%s\n" "$_cocoon_mtu"
     } > "${rootmnt}/etc/systemd/network/10-${mac_sanitized}.network"
 
     # Collect DNS servers for resolv.conf.
@@ -97,11 +120,15 @@ if [ "$_has_static" = false ]; then
         mac_sanitized=$(echo "$mac" | tr -d ':')
         {
             printf "[Match]\nMACAddress=%s\n\n[Network]\nDHCP=ipv4\n" "$mac"
+            # Host-configured servers come first; the lease's are added after.
+            for _ns in $_cocoon_dns; do printf "DNS=%s\n" "$_ns"; done
+            [ -n "$_cocoon_mtu" ] && printf "\n[Link]\nMTUBytes=%s\n" "$_cocoon_mtu"
         } > "${rootmnt}/etc/systemd/network/10-${mac_sanitized}.network"
     done
 fi
 
-# Write /etc/resolv.conf from DNS servers collected above.
+# Write /etc/resolv.conf from cocoon.dns=, else the DNS servers collected above.
+[ -n "$_cocoon_dns" ] && _dns_servers="$_cocoon_dns"
 [ -z "$_dns_servers" ] && _dns_servers="8.8.8.8 8.8.4.4"
 : > "${rootmnt}/etc/resolv.conf"
 for _ns in $_dns_servers; do
@@ -9,6 +9,15 @@ resolve_disk() {
     case "$timeout" in ''|*[!0-9]*) timeout=10 ;; esac
 
     while [ $i -lt $timeout ]; do
+        # virtio-pmem layers are named by pmem region, not serial.
+        case "$serial" in
+            pmem[0-9]*)
+                [ -b "/dev/${serial}" ] && { echo "/dev/${serial}"; return 0; }
+                sleep 1
+                i=$((i + 1))
+                continue
+                ;;
+        esac
         for sysdev in /sys/block/vd*; do
             [ -d "$sysdev" ] || continue
             local s=""
@@ -42,6 +51,7 @@ mountroot() {
 
     # Native environment: modprobe automatically resolves all underlying dependencies.
     modprobe erofs 2>/dev/null || true
+    modprobe virtio_pmem 2>/dev/null || true
     modprobe overlay 2>/dev/null || true
     modprobe ext4 2>/dev/null || true
 
@@ -50,6 +60,7 @@ mountroot() {
             cocoon.layers=*) LAYERS="${x#cocoon.layers=}" ;;
             cocoon.cow=*)    COW="${x#cocoon.cow=}" ;;
             cocoon.timeout=*) COCOON_TIMEOUT="${x#cocoon.timeout=}" ;;
+            cocoon.swap=*)   SWAP="${x#cocoon.swap=}" ;;
         esac
     done
 
@@ -70,7 +81,11 @@ mountroot() {
         dev=$(resolve_disk "$serial") || panic "device ${serial} not found"
         mnt="${COCOON_INTERNAL}/layers/${serial}"
         mkdir -p "$mnt"
-        mount -t erofs -o ro "$dev" "$mnt" || panic "mount ${serial} failed"
+        # pmem layers are mapped with DAX: reads hit the host page cache directly.
+        case "$serial" in
+            pmem[0-9]*) mount -t erofs -o ro,dax=always "$dev" "$mnt" 2>/dev/null || mount -t erofs -o ro "$dev" "$mnt" || panic "mount ${serial} failed" ;;
+            *) mount -t erofs -o ro "$dev" "$mnt" || panic "mount ${serial} failed" ;;
+        esac
         [ -n "$LOWER" ] && LOWER="${LOWER}:"
         LOWER="${LOWER}${mnt}"
         LAYER_DEVS="${LAYER_DEVS} ${dev}"
@@ -79,9 +94,31 @@ mountroot() {
 
     # Mount COW disk
     cow_dev=$(resolve_disk "$COW") || panic "COW device ${COW} not found"
+    cow_blk="${cow_dev##*/}"
+
+    # Encrypted COW (vm create --encrypt): the host appended its key to the
+    # initramfs as /cocoon.key. The host only writes the LUKS2 header, so
+    # the filesystem inside is made on first boot and grown to fill a disk
+    # resized since.
+    if [ "$(dd if="$cow_dev" bs=4 count=1 2>/dev/null)" = "LUKS" ]; then
+        command -v cryptsetup >/dev/null || panic "COW is encrypted but cryptsetup is not in the initramfs"
+        [ -f /cocoon.key ] || panic "COW is encrypted but no key was provided"
+        modprobe dm_crypt 2>/dev/null || true
+        cryptsetup open --key-file /cocoon.key --allow-discards "$cow_dev" cocoon-cow || panic "unlock COW failed"
+        rm -f /cocoon.key
+        cow_dev=/dev/mapper/cocoon-cow
+        if blkid "$cow_dev" >/dev/null 2>&1; then
+            e2fsck -p "$cow_dev" >/dev/null 2>&1
+            resize2fs "$cow_dev" >/dev/null 2>&1 || true
+        else
+            mkfs.ext4 -F -m 0 -q -E lazy_itable_init=1,lazy_journal_init=1,discard "$cow_dev" || panic "format COW failed"
+        fi
+    fi
+
     mkdir -p "${COCOON_INTERNAL}/cow"
     # [Performance] Added noatime to reduce unnecessary write operations on the COW disk.
-    mount -t ext4 -o noatime "$cow_dev" "${COCOON_INTERNAL}/cow" || panic "mount COW failed"
+    # discard passes deletes down as TRIM, so the host's sparse COW file shrinks with them.
+    mount -t ext4 -o noatime,discard "$cow_dev" "${COCOON_INTERNAL}/cow" || panic "mount COW failed"
     mkdir -p "${COCOON_INTERNAL}/cow/upper" "${COCOON_INTERNAL}/cow/work"
 
     # Assemble Overlayfs
@@ -103,7 +140,6 @@ mountroot() {
         blk="${dev##*/}"
         [ -e "/sys/block/${blk}/queue/scheduler" ] && echo "none" > "/sys/block/${blk}/queue/scheduler" 2>/dev/null || true
     done
-    cow_blk="${cow_dev##*/}"
     [ -e "/sys/block/${cow_blk}/queue/scheduler" ] && echo "mq-deadline" > "/sys/block/${cow_blk}/queue/scheduler" 2>/dev/null || true
 
     # Note: The systemd compatibility hacks (clearing fstab, masking fsck) 
@@ -113,5 +149,31 @@ mountroot() {
     rm -f "${rootmnt}/etc/machine-id" 2>/dev/null || true
     : > "${rootmnt}/etc/machine-id"
 
+    # Guest files (vm create --copy-in, --env, --timezone, --locale): the
+    # host appended them to the initramfs as /cocoon.d/<n>, listed in its
+    # manifest as "<n> <mode> <path>"; mode "link" makes <n> hold a symlink
+    # target. They are installed on every boot, so the host's copy wins
+    # over changes made in the guest.
+    if [ -f /cocoon.d/manifest ]; then
+        while read -r n mode path; do
+            mkdir -p "${rootmnt}${path%/*}"
+            if [ "$mode" = link ]; then
+                ln -sfn "$(cat "/cocoon.d/${n}")" "${rootmnt}${path}"
+            else
+                cp "/cocoon.d/${n}" "${rootmnt}${path}" && chmod "$mode" "${rootmnt}${path}"
+            fi || log_warning_msg "Cocoon: installing ${path} failed"
+        done < /cocoon.d/manifest
+        rm -rf /cocoon.d
+    fi
+
+    # Swap disk (vm create --swap): the host runs mkswap on every cold boot,
+    # so systemd only has to swap on. The unit name is the escaped device path.
+    if [ -n "$SWAP" ]; then
+        swap_unit="$(echo "dev/disk/by-id/virtio-${SWAP}" | sed 's/-/\\x2d/g; s|/|-|g').swap"
+        mkdir -p "${rootmnt}/etc/systemd/system/swap.target.wants"
+        printf '[Swap]\nWhat=/dev/disk/by-id/virtio-%s\n' "$SWAP" > "${rootmnt}/etc/systemd/system/${swap_unit}"
+        ln -sf "../${swap_unit}" "${rootmnt}/etc/systemd/system/swap.target.wants/${swap_unit}"
+    fi
+
     log_success_msg "Cocoon: stealth overlay rootfs ready"
 }
\ No newline at end of file
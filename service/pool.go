@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"os"
+
+	units "github.com/docker/go-units"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// PoolUsage is the space accounting of one storage pool.
+type PoolUsage struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Default   bool   `json:"default,omitempty"`
+	Capacity  int64  `json:"capacity"`  // bytes; 0 = unlimited
+	Committed int64  `json:"committed"` // bytes of VM disk sizes placed in the pool
+	Used      int64  `json:"used"`      // bytes of files under Path
+	Available int64  `json:"available"` // bytes free on Path's filesystem
+}
+
+// Free returns the bytes a new VM disk may still take in the pool: what
+// Capacity leaves after the committed disks, bounded by the filesystem's
+// free space.
+func (u *PoolUsage) Free() int64 {
+	if u.Capacity == 0 {
+		return u.Available
+	}
+	return max(0, min(u.Capacity-u.Committed, u.Available))
+}
+
+// StoragePoolUsage measures every configured storage pool holding the
+// disks of vms. It walks each pool for Used, so it is meant for reports,
+// not for placing disks.
+func StoragePoolUsage(conf *config.Config, vms []*types.VM) ([]PoolUsage, error) {
+	committed := poolCommitted(vms)
+	usage := make([]PoolUsage, 0, len(conf.StoragePools))
+	for i := range conf.StoragePools {
+		pool := &conf.StoragePools[i]
+		u := PoolUsage{Name: pool.Name, Path: pool.Path, Default: pool.Default, Committed: committed[pool.Name]}
+		var err error
+		if u.Capacity, err = pool.CapacityBytes(); err != nil {
+			return nil, err
+		}
+		if _, err = os.Stat(pool.Path); err != nil {
+			return nil, fmt.Errorf("storage pool %s: %w", pool.Name, err)
+		}
+		if u.Used, err = utils.DirUsage(pool.Path); err != nil {
+			return nil, fmt.Errorf("storage pool %s: %w", pool.Name, err)
+		}
+		if u.Available, err = utils.FSAvailable(pool.Path); err != nil {
+			return nil, fmt.Errorf("storage pool %s: %w", pool.Name, err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, nil
+}
+
+// poolCommitted sums the disk sizes of vms by the pool they are in.
+func poolCommitted(vms []*types.VM) map[string]int64 {
+	committed := map[string]int64{}
+	for _, vm := range vms {
+		if vm.Config.Pool != "" {
+			committed[vm.Config.Pool] += vm.Config.Storage
+		}
+	}
+	return committed
+}
+
+// PlaceVMDisk picks the storage pool a new VM's writable disk goes to and
+// points vmCfg.DataDir at it, given the existing vms. An explicit --pool
+// must have room for the disk; otherwise the default pool is used while it
+// has room, then the pool with the most room. Without pools, or with
+// --data-dir, the config is left alone. The hypervisor checks the room
+// again when it reserves the VM, under its index lock.
+func PlaceVMDisk(conf *config.Config, vmCfg *types.VMConfig, vms []*types.VM) error {
+	if vmCfg.Pool != "" && vmCfg.DataDir != "" {
+		return fmt.Errorf("--pool and --data-dir are mutually exclusive")
+	}
+	committed := poolCommitted(vms)
+	if vmCfg.Pool != "" {
+		pool, ok := conf.Pool(vmCfg.Pool)
+		if !ok {
+			return fmt.Errorf("storage pool %q not found", vmCfg.Pool)
+		}
+		room, err := pool.Room(committed[pool.Name])
+		if err != nil {
+			return err
+		}
+		if room < vmCfg.Storage {
+			return fmt.Errorf("storage pool %s has %s left, VM disk needs %s", pool.Name, units.HumanSize(float64(room)), units.HumanSize(float64(vmCfg.Storage)))
+		}
+		vmCfg.DataDir = pool.Path
+		return nil
+	}
+	// QEMU keeps every disk in the run directory.
+	if vmCfg.DataDir != "" || conf.Hypervisor == config.HypervisorQEMU {
+		return nil
+	}
+	if _, ok := conf.DefaultPool(); !ok {
+		return nil
+	}
+	var (
+		best     *config.StoragePool
+		bestRoom int64
+	)
+	for i := range conf.StoragePools {
+		pool := &conf.StoragePools[i]
+		room, err := pool.Room(committed[pool.Name])
+		if err != nil {
+			return err
+		}
+		if room < vmCfg.Storage {
+			continue
+		}
+		if pool.Default {
+			best = pool
+			break
+		}
+		if best == nil || room > bestRoom {
+			best, bestRoom = pool, room
+		}
+	}
+	if best == nil {
+		return fmt.Errorf("no storage pool has %s left for the VM disk", units.HumanSize(float64(vmCfg.Storage)))
+	}
+	vmCfg.Pool, vmCfg.DataDir = best.Name, best.Path
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+func TestPlaceVMDisk(t *testing.T) {
+	fast, slow := t.TempDir(), t.TempDir()
+	conf := &config.Config{StoragePools: []config.StoragePool{
+		{Name: "fast", Path: fast, Capacity: "64M", Default: true},
+		{Name: "slow", Path: slow},
+	}}
+
+	vmCfg := &types.VMConfig{Storage: 32 << 20}
+	if err := PlaceVMDisk(conf, vmCfg, nil); err != nil || vmCfg.Pool != "fast" || vmCfg.DataDir != fast {
+		t.Fatalf("default pool: pool=%q dir=%q err=%v", vmCfg.Pool, vmCfg.DataDir, err)
+	}
+
+	// Too big for the default pool's capacity: spills to the other one.
+	vmCfg = &types.VMConfig{Storage: 128 << 20}
+	if err := PlaceVMDisk(conf, vmCfg, nil); err != nil || vmCfg.Pool != "slow" || vmCfg.DataDir != slow {
+		t.Fatalf("spill: pool=%q dir=%q err=%v", vmCfg.Pool, vmCfg.DataDir, err)
+	}
+
+	// The disks already placed in the default pool count against it.
+	vms := []*types.VM{{Config: types.VMConfig{Pool: "fast", Storage: 48 << 20}}}
+	vmCfg = &types.VMConfig{Storage: 32 << 20}
+	if err := PlaceVMDisk(conf, vmCfg, vms); err != nil || vmCfg.Pool != "slow" {
+		t.Fatalf("committed: pool=%q err=%v", vmCfg.Pool, err)
+	}
+
+	// An explicit pool never spills.
+	vmCfg = &types.VMConfig{Storage: 128 << 20, Pool: "fast"}
+	if err := PlaceVMDisk(conf, vmCfg, nil); err == nil {
+		t.Fatal("explicit full pool: want error")
+	}
+	vmCfg = &types.VMConfig{Pool: "missing"}
+	if err := PlaceVMDisk(conf, vmCfg, nil); err == nil {
+		t.Fatal("unknown pool: want error")
+	}
+	vmCfg = &types.VMConfig{Pool: "fast", DataDir: "/mnt/x"}
+	if err := PlaceVMDisk(conf, vmCfg, nil); err == nil {
+		t.Fatal("--pool with --data-dir: want error")
+	}
+
+	// --data-dir bypasses the pools.
+	vmCfg = &types.VMConfig{Storage: 32 << 20, DataDir: "/mnt/x"}
+	if err := PlaceVMDisk(conf, vmCfg, nil); err != nil || vmCfg.Pool != "" || vmCfg.DataDir != "/mnt/x" {
+		t.Fatalf("data dir: pool=%q dir=%q err=%v", vmCfg.Pool, vmCfg.DataDir, err)
+	}
+}
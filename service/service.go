@@ -0,0 +1,173 @@
+// Package service holds the operations the CLI and the daemon share:
+// building the storage, image, network and hypervisor backends from the
+// config, and the VM create/delete/start flows that span several of them.
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/hypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/cloudhypervisor"
+	"github.com/projecteru2/cocoon/hypervisor/qemu"
+	imagebackend "github.com/projecteru2/cocoon/images"
+	"github.com/projecteru2/cocoon/images/cloudimg"
+	"github.com/projecteru2/cocoon/images/oci"
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/network/cni"
+	"github.com/projecteru2/cocoon/network/usermode"
+	"github.com/projecteru2/cocoon/snapshot"
+	"github.com/projecteru2/cocoon/snapshot/localfile"
+	"github.com/projecteru2/cocoon/volume"
+)
+
+// InitBackends initializes all image backends and the hypervisor.
+func InitBackends(ctx context.Context, conf *config.Config) ([]imagebackend.Images, hypervisor.Hypervisor, error) {
+	backends, err := InitImageBackends(ctx, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	hyper, err := InitHypervisor(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return backends, hyper, nil
+}
+
+// InitImageBackends initializes only image backends (no hypervisor needed).
+func InitImageBackends(ctx context.Context, conf *config.Config) ([]imagebackend.Images, error) {
+	ociStore, err := oci.New(ctx, conf)
+	if err != nil {
+		return nil, fmt.Errorf("init oci backend: %w", err)
+	}
+	cloudimgStore, err := cloudimg.New(ctx, conf)
+	if err != nil {
+		return nil, fmt.Errorf("init cloudimg backend: %w", err)
+	}
+	return []imagebackend.Images{ociStore, cloudimgStore}, nil
+}
+
+// InitImageBackendsForPull returns concrete backend types needed by Pull.
+func InitImageBackendsForPull(ctx context.Context, conf *config.Config) (*oci.OCI, *cloudimg.CloudImg, error) {
+	ociStore, err := oci.New(ctx, conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("init oci backend: %w", err)
+	}
+	cloudimgStore, err := cloudimg.New(ctx, conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("init cloudimg backend: %w", err)
+	}
+	return ociStore, cloudimgStore, nil
+}
+
+// InitHypervisor initializes the hypervisor backend selected by conf.Hypervisor.
+func InitHypervisor(conf *config.Config) (hypervisor.Hypervisor, error) {
+	var (
+		hyper hypervisor.Hypervisor
+		err   error
+	)
+	switch conf.Hypervisor {
+	case config.HypervisorQEMU:
+		hyper, err = qemu.New(conf)
+	default:
+		hyper, err = cloudhypervisor.New(conf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("init hypervisor: %w", err)
+	}
+	return hyper, nil
+}
+
+// InitNetwork creates the network provider selected by conf.NetworkProvider.
+func InitNetwork(conf *config.Config) (network.Network, error) {
+	var (
+		p   network.Network
+		err error
+	)
+	switch conf.NetworkProvider {
+	case config.NetworkProviderUsermode:
+		p, err = usermode.New(conf)
+	default:
+		p, err = cni.New(conf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("init network: %w", err)
+	}
+	return p, nil
+}
+
+// InitSnapshot initializes the snapshot backend.
+func InitSnapshot(conf *config.Config) (snapshot.Snapshot, error) {
+	s, err := localfile.New(conf)
+	if err != nil {
+		return nil, fmt.Errorf("init snapshot backend: %w", err)
+	}
+	return s, nil
+}
+
+// InitVolumes initializes the volume store.
+func InitVolumes(conf *config.Config) (*volume.Volumes, error) {
+	v, err := volume.New(conf)
+	if err != nil {
+		return nil, fmt.Errorf("init volumes: %w", err)
+	}
+	return v, nil
+}
+
+// InitGC builds a GC orchestrator with every storage module registered:
+// image backends, hypervisor, network, snapshots, and volumes.
+func InitGC(ctx context.Context, conf *config.Config) (*gc.Orchestrator, error) {
+	backends, hyper, err := InitBackends(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	netProvider, err := InitNetwork(conf)
+	if err != nil {
+		return nil, err
+	}
+	snapBackend, err := InitSnapshot(conf)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := InitVolumes(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	o := gc.New()
+	for _, b := range backends {
+		b.RegisterGC(o)
+	}
+	hyper.RegisterGC(o)
+	if other := inactiveHypervisor(conf); other != nil {
+		other.RegisterGC(o)
+	}
+	netProvider.RegisterGC(o)
+	snapBackend.RegisterGC(o)
+	volumes.RegisterGC(o)
+	return o, nil
+}
+
+// inactiveHypervisor returns the backend not selected by conf if it has a VM
+// index on disk, so GC keeps honoring its VMs' image pins and directories
+// after the hypervisor setting was switched.
+func inactiveHypervisor(conf *config.Config) hypervisor.Hypervisor {
+	other := *conf
+	index := (&qemu.Config{Config: &other}).IndexFile()
+	other.Hypervisor = config.HypervisorQEMU
+	if conf.Hypervisor == config.HypervisorQEMU {
+		index = (&cloudhypervisor.Config{Config: &other}).IndexFile()
+		other.Hypervisor = config.HypervisorCH
+	}
+	if _, err := os.Stat(index); err != nil {
+		return nil
+	}
+	hyper, err := InitHypervisor(&other)
+	if err != nil {
+		return nil
+	}
+	return hyper
+}
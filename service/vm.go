@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/firmware"
+	"github.com/projecteru2/cocoon/hypervisor"
+	imagebackend "github.com/projecteru2/cocoon/images"
+	"github.com/projecteru2/cocoon/network"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+	"github.com/projecteru2/cocoon/volume"
+)
+
+// CreateVM resolves the image, attaches volumes, allocates network, and
+// registers a new VM in Created state. Volumes and network resources are
+// released if creation fails. Shared by the CLI create/run commands and the
+// daemon API.
+func CreateVM(ctx context.Context, conf *config.Config, vmCfg *types.VMConfig, nics int) (_ *types.VM, _ hypervisor.Hypervisor, err error) {
+	if len(vmCfg.Networks) > 0 && nics != len(vmCfg.Networks) {
+		return nil, nil, fmt.Errorf("%d NIC(s) requested but %d networks given", nics, len(vmCfg.Networks))
+	}
+	if vmCfg.IP != "" && nics == 0 {
+		return nil, nil, fmt.Errorf("--ip needs a NIC")
+	}
+	if vmCfg.MTU == 0 {
+		vmCfg.MTU = conf.MTU
+	}
+	if n := len(vmCfg.MACs); n > nics {
+		return nil, nil, fmt.Errorf("%d NIC(s) requested but %d --mac values given", nics, n)
+	}
+	if n := len(vmCfg.NetLimits); n > 1 && n != nics {
+		return nil, nil, fmt.Errorf("%d NIC(s) requested but %d --net-limit values given (give one for all NICs or one per NIC)", nics, n)
+	}
+	if n := len(vmCfg.VLANs); n > 1 && n != nics {
+		return nil, nil, fmt.Errorf("%d NIC(s) requested but %d --vlan values given (give one for all NICs or one per NIC)", nics, n)
+	}
+
+	backends, hyper, err := InitBackends(ctx, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	var vms []*types.VM
+	if len(conf.StoragePools) > 0 {
+		if vms, err = hyper.List(ctx); err != nil {
+			return nil, nil, fmt.Errorf("list VMs: %w", err)
+		}
+	}
+	if err = PlaceVMDisk(conf, vmCfg, vms); err != nil {
+		return nil, nil, err
+	}
+
+	storageConfigs, bootCfg, err := ResolveImage(ctx, backends, vmCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if vmCfg.Firmware != "" && bootCfg.KernelPath != "" {
+		return nil, nil, fmt.Errorf("--firmware only applies to cloud images; %s boots its kernel directly", vmCfg.Image)
+	}
+	if vmCfg.CmdlineAppend != "" && bootCfg.KernelPath == "" {
+		return nil, nil, fmt.Errorf("--cmdline-append only applies to OCI images; %s boots through firmware (set the cmdline in its bootloader)", vmCfg.Image)
+	}
+	EnsureFirmwarePath(conf, bootCfg)
+
+	vmID, err := utils.GenerateID()
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate VM ID: %w", err)
+	}
+
+	var volumes *volume.Volumes
+	if len(vmCfg.Volumes) > 0 {
+		if volumes, err = InitVolumes(conf); err != nil {
+			return nil, nil, err
+		}
+		volumeDisks, attachErr := volumes.Attach(ctx, vmID, vmCfg.Volumes)
+		if attachErr != nil {
+			return nil, nil, fmt.Errorf("attach volumes: %w", attachErr)
+		}
+		defer func() {
+			if err != nil {
+				releaseVolumes(ctx, volumes, []string{vmID})
+			}
+		}()
+		storageConfigs = append(storageConfigs, volumeDisks...)
+	}
+
+	netProvider, networkConfigs, err := InitVMNetwork(ctx, conf, vmID, nics, vmCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, createErr := hyper.Create(ctx, vmID, vmCfg, storageConfigs, networkConfigs, bootCfg)
+	if createErr != nil {
+		RollbackNetwork(ctx, netProvider, vmID)
+		return nil, nil, fmt.Errorf("create VM: %w", createErr)
+	}
+	if volumes != nil {
+		if attachErr := volumes.Attached(ctx, vmID, info.StorageConfigs); attachErr != nil {
+			log.WithFunc("service.CreateVM").Warnf(ctx, "record volume targets of VM %s: %v", vmID, attachErr)
+		}
+	}
+	return info, hyper, nil
+}
+
+// DeleteVMs deletes VMs and then releases their volumes and network
+// resources. hyper.Delete uses best-effort semantics, so the returned slice
+// lists every VM that was deleted even when err != nil; cleanup runs for
+// those VMs before the delete error is reported. A volume that fails to
+// release is left to GC.
+func DeleteVMs(ctx context.Context, conf *config.Config, hyper hypervisor.Hypervisor, refs []string, force bool) ([]string, error) {
+	deleted, deleteErr := hyper.Delete(ctx, refs, force)
+	if len(deleted) > 0 {
+		if volumes, initErr := InitVolumes(conf); initErr == nil {
+			releaseVolumes(ctx, volumes, deleted)
+		}
+		if netProvider, initErr := InitNetwork(conf); initErr == nil {
+			if _, delErr := netProvider.Delete(ctx, deleted); delErr != nil {
+				return deleted, fmt.Errorf("VM(s) deleted but network cleanup failed: %w", delErr)
+			}
+		}
+	}
+	return deleted, deleteErr
+}
+
+// CollectStats samples refs, or every running VM when refs is empty. VMs
+// that stop between listing and sampling are skipped in the latter case.
+// Each sample also carries per-NIC counters read from the host devices.
+func CollectStats(ctx context.Context, hyper hypervisor.Hypervisor, refs []string) (map[string]*types.VMStats, error) {
+	explicit := len(refs) > 0
+	if !explicit {
+		vms, err := hyper.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list: %w", err)
+		}
+		for _, vm := range vms {
+			if vm.State == types.VMStateRunning && utils.IsProcessAlive(vm.PID) {
+				refs = append(refs, vm.ID)
+			}
+		}
+	}
+	result := make(map[string]*types.VMStats, len(refs))
+	for _, ref := range refs {
+		s, err := hyper.Stats(ctx, ref)
+		if err != nil {
+			if !explicit && errors.Is(err, hypervisor.ErrNotRunning) {
+				continue
+			}
+			return nil, fmt.Errorf("stats %s: %w", ref, err)
+		}
+		addNICStats(ctx, hyper, s)
+		result[s.ID] = s
+	}
+	return result, nil
+}
+
+// addNICStats fills s.NICs, best effort. Hypervisors without net device
+// counters (QEMU) get their totals from the NICs instead.
+func addNICStats(ctx context.Context, hyper hypervisor.Hypervisor, s *types.VMStats) {
+	logger := log.WithFunc("service.addNICStats")
+	vm, err := hyper.Inspect(ctx, s.ID)
+	if err != nil {
+		logger.Debugf(ctx, "inspect %s: %v", s.ID, err)
+		return
+	}
+	if s.NICs, err = network.CollectNICStats(vm.NetworkConfigs); err != nil {
+		logger.Debugf(ctx, "NIC stats %s: %v", s.ID, err)
+	}
+	if s.NetRxBytes != 0 || s.NetTxBytes != 0 {
+		return
+	}
+	for _, n := range s.NICs {
+		s.NetRxBytes += n.RxBytes
+		s.NetTxBytes += n.TxBytes
+		s.NetRxPackets += n.RxPackets
+		s.NetTxPackets += n.TxPackets
+	}
+}
+
+// InitVMNetwork sets up network for a new VM. Returns nil provider and configs when nics == 0.
+func InitVMNetwork(ctx context.Context, conf *config.Config, vmID string, nics int, vmCfg *types.VMConfig) (network.Network, []*types.NetworkConfig, error) {
+	if nics <= 0 {
+		return nil, nil, nil
+	}
+	if conf.Rootless && conf.NetworkProvider != config.NetworkProviderUsermode {
+		return nil, nil, fmt.Errorf("%d NIC(s) requested but rootless mode has no CNI networking (netns and tap devices need root): set network_provider to usermode or use --nics 0", nics)
+	}
+	netProvider, err := InitNetwork(conf)
+	if err != nil {
+		return nil, nil, fmt.Errorf("init network: %w", err)
+	}
+	configs, err := netProvider.Config(ctx, vmID, nics, vmCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configure network: %w", err)
+	}
+	return netProvider, configs, nil
+}
+
+// RollbackNetwork cleans up network resources on VM creation/clone failure.
+func RollbackNetwork(ctx context.Context, netProvider network.Network, vmID string) {
+	if netProvider == nil {
+		return
+	}
+	if _, delErr := netProvider.Delete(ctx, []string{vmID}); delErr != nil {
+		log.WithFunc("service.rollbackNetwork").Warnf(ctx, "rollback network for %s: %v", vmID, delErr)
+	}
+}
+
+// releaseVolumes detaches the volumes of vmIDs, logging failures: GC
+// releases volumes of VMs that no longer exist anyway.
+func releaseVolumes(ctx context.Context, volumes *volume.Volumes, vmIDs []string) {
+	if err := volumes.Release(ctx, vmIDs); err != nil {
+		log.WithFunc("service.releaseVolumes").Warnf(ctx, "release volumes of %v: %v", vmIDs, err)
+	}
+}
+
+// RecoverNetwork recreates the network plumbing (netns, CNI ADD with the
+// persisted IPs, tap and TC redirect) of VMs in refs that lost it, e.g. to
+// a host reboot, so they can start again. Best-effort: a VM whose network
+// cannot be recovered is marked error with the reason, but the start that
+// follows still runs and reports the real error.
+func RecoverNetwork(ctx context.Context, conf *config.Config, hyper hypervisor.Hypervisor, refs []string) {
+	netProvider, err := InitNetwork(conf)
+	if err != nil {
+		return
+	}
+	logger := log.WithFunc("service.recoverNetwork")
+	for _, ref := range refs {
+		vm, err := hyper.Inspect(ctx, ref)
+		if err != nil {
+			continue
+		}
+		recovered, recoverErr := network.Recover(ctx, netProvider, vm)
+		switch {
+		case recoverErr != nil:
+			logger.Warnf(ctx, "%v (start will fail)", recoverErr)
+			if rec, ok := hyper.(hypervisor.ErrorRecorder); ok {
+				if setErr := rec.SetError(ctx, vm.ID, recoverErr.Error()); setErr != nil {
+					logger.Warnf(ctx, "mark VM %s error: %v", vm.ID, setErr)
+				}
+			}
+		case recovered:
+			logger.Warnf(ctx, "network missing for VM %s, recovered", vm.ID)
+		}
+	}
+}
+
+// ResolveImage resolves an image reference to StorageConfigs + BootConfig.
+func ResolveImage(ctx context.Context, backends []imagebackend.Images, vmCfg *types.VMConfig) ([]*types.StorageConfig, *types.BootConfig, error) {
+	vms := []*types.VMConfig{vmCfg}
+	var storageConfigs []*types.StorageConfig
+	var bootCfg *types.BootConfig
+	var backendErrs []string
+	for _, b := range backends {
+		confs, boots, err := b.Config(ctx, vms)
+		if err != nil {
+			backendErrs = append(backendErrs, fmt.Sprintf("%s: %v", b.Type(), err))
+			continue
+		}
+		storageConfigs = confs[0]
+		bootCfg = boots[0]
+		break
+	}
+	if bootCfg == nil {
+		return nil, nil, fmt.Errorf("image %q not resolved: %s", vmCfg.Image, strings.Join(backendErrs, "; "))
+	}
+	return storageConfigs, bootCfg, nil
+}
+
+// EnsureFirmwarePath sets default firmware path for cloudimg boot.
+func EnsureFirmwarePath(conf *config.Config, bootCfg *types.BootConfig) {
+	if bootCfg != nil && bootCfg.KernelPath == "" && bootCfg.FirmwarePath == "" {
+		if p, err := firmware.Resolve(conf, ""); err == nil {
+			bootCfg.FirmwarePath = p
+		}
+	}
+}
+
+// IsURL reports whether ref is a cloud image URL rather than an OCI reference.
+func IsURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
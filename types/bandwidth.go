@@ -0,0 +1,58 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bandwidthUnits maps tc-style rate suffixes to bits per second: "bit"
+// units count bits, "bps" units count bytes.
+var bandwidthUnits = []struct {
+	suffix string
+	bits   uint64
+}{
+	{"tbit", 1e12},
+	{"gbit", 1e9},
+	{"mbit", 1e6},
+	{"kbit", 1e3},
+	{"bit", 1},
+	{"tbps", 8e12},
+	{"gbps", 8e9},
+	{"mbps", 8e6},
+	{"kbps", 8e3},
+	{"bps", 8},
+}
+
+// ParseBandwidth parses a tc-style rate such as "100mbit" or "10mbps"
+// into bits per second. A unit is required.
+func ParseBandwidth(s string) (uint64, error) {
+	spec := strings.ToLower(strings.TrimSpace(s))
+	for _, u := range bandwidthUnits {
+		num, ok := strings.CutSuffix(spec, u.suffix)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("bandwidth %q is invalid: want a positive number", s)
+		}
+		bps := uint64(v * float64(u.bits))
+		if bps < 8 { //nolint:mnd
+			return 0, fmt.Errorf("bandwidth %q is below one byte per second", s)
+		}
+		return bps, nil
+	}
+	return 0, fmt.Errorf("bandwidth %q is invalid: want a number with a unit such as 100mbit, 1gbit or 10mbps", s)
+}
+
+// FormatBandwidth renders bits per second with the largest exact tc unit,
+// e.g. 100000000 → "100mbit".
+func FormatBandwidth(bps uint64) string {
+	for _, u := range bandwidthUnits[:4] {
+		if bps%u.bits == 0 {
+			return fmt.Sprintf("%d%s", bps/u.bits, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dbit", bps)
+}
@@ -0,0 +1,69 @@
+package types
+
+import "testing"
+
+func TestParseBandwidth(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{"100mbit", 100_000_000, false},
+		{"1Gbit", 1_000_000_000, false},
+		{"1.5gbit", 1_500_000_000, false},
+		{"10mbps", 80_000_000, false},
+		{"512kbit", 512_000, false},
+		{" 64bps ", 512, false},
+		{"100", 0, true},
+		{"mbit", 0, true},
+		{"0mbit", 0, true},
+		{"-1mbit", 0, true},
+		{"1bit", 0, true},
+		{"10mb", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseBandwidth(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBandwidth(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseBandwidth(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBandwidth(t *testing.T) {
+	for bps, want := range map[uint64]string{
+		100_000_000:   "100mbit",
+		1_000_000_000: "1gbit",
+		1_500_000_000: "1500mbit",
+		80_000_000:    "80mbit",
+		1234:          "1234bit",
+	} {
+		if got := FormatBandwidth(bps); got != want {
+			t.Errorf("FormatBandwidth(%d) = %q, want %q", bps, got, want)
+		}
+	}
+}
+
+func TestNICLimit(t *testing.T) {
+	all := &VMConfig{NetLimits: []uint64{100}}
+	perNIC := &VMConfig{NetLimits: []uint64{100, 200}}
+	for _, tt := range []struct {
+		cfg  *VMConfig
+		i    int
+		want uint64
+	}{
+		{&VMConfig{}, 0, 0},
+		{all, 0, 100},
+		{all, 3, 100},
+		{perNIC, 1, 200},
+		{perNIC, 2, 0},
+	} {
+		if got := tt.cfg.NICLimit(tt.i); got != tt.want {
+			t.Errorf("NICLimit(%d) with %v = %d, want %d", tt.i, tt.cfg.NetLimits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DefaultBootPattern matches the login prompt getty prints once the guest
+// has finished booting.
+const DefaultBootPattern = `login: *$`
+
+// BootFailurePattern matches console output that means the guest will never
+// finish booting.
+var BootFailurePattern = regexp.MustCompile(`Kernel panic - not syncing|end Kernel panic|Attempted to kill init`)
+
+// BootProbe makes start wait for the guest console to print Pattern,
+// failing the start when the kernel panics or TimeoutSeconds pass first.
+type BootProbe struct {
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	Pattern        string `json:"pattern,omitempty"` // regexp; empty = DefaultBootPattern
+}
+
+// Validate checks the timeout and that the pattern compiles.
+func (bp *BootProbe) Validate() error {
+	if bp.TimeoutSeconds <= 0 {
+		return fmt.Errorf("--boot-timeout must be positive, got %ds", bp.TimeoutSeconds)
+	}
+	if _, err := bp.Regexp(); err != nil {
+		return fmt.Errorf("--boot-pattern %q is invalid: %w", bp.Pattern, err)
+	}
+	return nil
+}
+
+// Timeout returns how long start waits for the guest to boot.
+func (bp *BootProbe) Timeout() time.Duration {
+	return time.Duration(bp.TimeoutSeconds) * time.Second
+}
+
+// Regexp compiles Pattern, falling back to DefaultBootPattern. Patterns
+// match multi-line so "^" and "$" anchor at console line boundaries.
+func (bp *BootProbe) Regexp() (*regexp.Regexp, error) {
+	pattern := bp.Pattern
+	if pattern == "" {
+		pattern = DefaultBootPattern
+	}
+	return regexp.Compile("(?m)" + pattern)
+}
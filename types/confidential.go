@@ -0,0 +1,21 @@
+package types
+
+import "fmt"
+
+// ConfidentialMode selects a hardware memory-encryption technology for a
+// confidential guest; empty means a regular VM.
+type ConfidentialMode string
+
+const (
+	ConfidentialSEVSNP ConfidentialMode = "sev-snp" // AMD SEV-SNP
+	ConfidentialTDX    ConfidentialMode = "tdx"     // Intel TDX
+)
+
+// Validate accepts the known modes and empty.
+func (m ConfidentialMode) Validate() error {
+	switch m {
+	case "", ConfidentialSEVSNP, ConfidentialTDX:
+		return nil
+	}
+	return fmt.Errorf("confidential mode %q is invalid: must be %q or %q", m, ConfidentialSEVSNP, ConfidentialTDX)
+}
@@ -0,0 +1,34 @@
+package types
+
+import "fmt"
+
+// ConsoleMode selects how a VM's serial port or virtio console is exposed.
+type ConsoleMode string
+
+const (
+	ConsoleOff    ConsoleMode = "off"
+	ConsolePty    ConsoleMode = "pty"
+	ConsoleSocket ConsoleMode = "socket" // unix socket; serial port only
+	ConsoleFile   ConsoleMode = "file"   // output appended to a log file, no input
+)
+
+// Interactive reports whether the device accepts a "vm console" session.
+func (m ConsoleMode) Interactive() bool { return m == ConsolePty || m == ConsoleSocket }
+
+// ValidateSerial accepts the serial port modes; empty means "boot default".
+func (m ConsoleMode) ValidateSerial() error {
+	switch m {
+	case "", ConsoleOff, ConsolePty, ConsoleSocket, ConsoleFile:
+		return nil
+	}
+	return fmt.Errorf("serial mode %q is invalid: must be %q, %q, %q or %q", m, ConsoleFile, ConsoleSocket, ConsolePty, ConsoleOff)
+}
+
+// ValidateConsole accepts the virtio console modes; empty means "boot default".
+func (m ConsoleMode) ValidateConsole() error {
+	switch m {
+	case "", ConsoleOff, ConsolePty, ConsoleFile:
+		return nil
+	}
+	return fmt.Errorf("console mode %q is invalid: must be %q, %q or %q", m, ConsoleFile, ConsolePty, ConsoleOff)
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MaxCPU is the highest CPU number a cpuset may name: Linux supports at
+// most 8192 CPUs (NR_CPUS), which also bounds what "0-N" expands to.
+const MaxCPU = 8191
+
+// ParseCPUSet parses a Linux CPU list such as "2-5,8" into sorted,
+// de-duplicated CPU numbers.
+func ParseCPUSet(s string) ([]int, error) {
+	var cpus []int
+	for part := range strings.SplitSeq(strings.TrimSpace(s), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("cpuset %q has an empty entry", s)
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("cpuset %q: invalid CPU %q", s, lo)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil || last < first {
+				return nil, fmt.Errorf("cpuset %q: invalid range %q", s, part)
+			}
+		}
+		if last > MaxCPU {
+			return nil, fmt.Errorf("cpuset %q: CPU %d is above the maximum %d", s, last, MaxCPU)
+		}
+		for c := first; c <= last; c++ {
+			cpus = append(cpus, c)
+		}
+	}
+	slices.Sort(cpus)
+	return slices.Compact(cpus), nil
+}
+
+// CPUSetsOverlap reports whether two parsed CPU sets share a CPU.
+func CPUSetsOverlap(a, b []int) bool {
+	for _, c := range a {
+		if _, found := slices.BinarySearch(b, c); found {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCPUSet(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []int
+		wantErr bool
+	}{
+		{"3", []int{3}, false},
+		{"2-5", []int{2, 3, 4, 5}, false},
+		{"8,0-1, 1", []int{0, 1, 8}, false},
+		{"", nil, true},
+		{"1,,2", nil, true},
+		{"5-2", nil, true},
+		{"a-b", nil, true},
+		{"-1", nil, true},
+		{"0-99999999", nil, true},
+		{"8192", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseCPUSet(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCPUSet(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseCPUSet(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCPUSetsOverlap(t *testing.T) {
+	if !CPUSetsOverlap([]int{1, 2, 3}, []int{3, 4}) {
+		t.Error("expected overlap on CPU 3")
+	}
+	if CPUSetsOverlap([]int{0, 1}, []int{2, 3}) {
+		t.Error("unexpected overlap")
+	}
+}
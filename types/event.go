@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+// EventType names a lifecycle transition recorded in the event journal.
+type EventType string
+
+const (
+	EventCreated     EventType = "created"
+	EventStarted     EventType = "started"
+	EventStopped     EventType = "stopped"
+	EventRebooted    EventType = "rebooted"
+	EventSuspended   EventType = "suspended"      // guest state saved to disk and the VMM exited
+	EventResumed     EventType = "resumed"        // suspended guest restored from disk
+	EventBootFailed  EventType = "boot-failed"    // guest failed its boot probe
+	EventVMMUpgraded EventType = "vmm-upgraded"   // VM moved onto another VMM binary
+	EventCrashed     EventType = "crashed"        // VMM process found dead by the daemon
+	EventUnhealthy   EventType = "unhealthy"      // health check crossed its failure threshold
+	EventWatchdog    EventType = "watchdog-reset" // guest watchdog expired and the VMM reset the guest
+	EventDeleted     EventType = "deleted"
+	EventGCRemoved   EventType = "gc-removed"
+	EventImagePulled EventType = "image-pulled"
+)
+
+// Event is one entry of the host event journal.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	ID      string    `json:"id"`             // VM ID, or image reference for image events
+	Name    string    `json:"name,omitempty"` // VM name
+	Message string    `json:"message,omitempty"`
+}
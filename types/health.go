@@ -0,0 +1,139 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HealthCheckType selects how the daemon probes a running VM. Probes run
+// from the host against the guest's IP; cocoon has no guest agent to run
+// commands inside the guest, so there is no command probe.
+type HealthCheckType string
+
+const (
+	HealthCheckTCP  HealthCheckType = "tcp"  // connect to <vm-ip>:<port>
+	HealthCheckHTTP HealthCheckType = "http" // GET http://<vm-ip>:<port><path>, expect 2xx/3xx
+)
+
+// Health check defaults applied when the corresponding field is zero.
+const (
+	DefaultHealthInterval = 30 * time.Second
+	DefaultHealthTimeout  = 5 * time.Second
+	DefaultHealthRetries  = 3
+)
+
+// HealthCheck describes a probe run by the daemon against the VM's first IP.
+type HealthCheck struct {
+	Type            HealthCheckType `json:"type"`
+	Port            int             `json:"port"`
+	Path            string          `json:"path,omitempty"`             // HTTP only; default "/"
+	IntervalSeconds int             `json:"interval_seconds,omitempty"` // 0 = DefaultHealthInterval
+	TimeoutSeconds  int             `json:"timeout_seconds,omitempty"`  // 0 = DefaultHealthTimeout
+	Retries         int             `json:"retries,omitempty"`          // consecutive failures before unhealthy; 0 = DefaultHealthRetries
+}
+
+// ParseHealthCheck parses the --health-check flag: "tcp:<port>" or
+// "http:<port>[/path]".
+func ParseHealthCheck(spec string) (*HealthCheck, error) {
+	kind, rest, ok := strings.Cut(spec, ":")
+	if !ok {
+		return nil, fmt.Errorf("--health-check %q is invalid: want tcp:<port> or http:<port>[/path]", spec)
+	}
+	hc := &HealthCheck{Type: HealthCheckType(kind)}
+	portStr := rest
+	if hc.Type == HealthCheckHTTP {
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			portStr, hc.Path = rest[:i], rest[i:]
+		}
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("--health-check %q: invalid port %q", spec, portStr)
+	}
+	hc.Port = port
+	if err := hc.Validate(); err != nil {
+		return nil, err
+	}
+	return hc, nil
+}
+
+// Validate checks the probe type and ranges.
+func (hc *HealthCheck) Validate() error {
+	switch hc.Type {
+	case HealthCheckTCP, HealthCheckHTTP:
+	default:
+		return fmt.Errorf("health check type %q is invalid: must be %q or %q", hc.Type, HealthCheckTCP, HealthCheckHTTP)
+	}
+	if hc.Port < 1 || hc.Port > 65535 {
+		return fmt.Errorf("health check port must be 1-65535, got %d", hc.Port)
+	}
+	if hc.IntervalSeconds < 0 || hc.TimeoutSeconds < 0 || hc.Retries < 0 {
+		return fmt.Errorf("health check interval, timeout and retries must not be negative")
+	}
+	return nil
+}
+
+// Interval returns the probe period.
+func (hc *HealthCheck) Interval() time.Duration {
+	return secondsOr(hc.IntervalSeconds, DefaultHealthInterval)
+}
+
+// Timeout returns the per-probe timeout.
+func (hc *HealthCheck) Timeout() time.Duration {
+	return secondsOr(hc.TimeoutSeconds, DefaultHealthTimeout)
+}
+
+// FailureThreshold returns how many consecutive failures mark a VM unhealthy.
+func (hc *HealthCheck) FailureThreshold() int {
+	if hc.Retries > 0 {
+		return hc.Retries
+	}
+	return DefaultHealthRetries
+}
+
+func secondsOr(n int, def time.Duration) time.Duration {
+	if n > 0 {
+		return time.Duration(n) * time.Second
+	}
+	return def
+}
+
+// HealthStatus is the last known outcome of a VM's health check.
+type HealthStatus string
+
+const (
+	HealthStarting  HealthStatus = "starting"  // no conclusive result since the last start
+	HealthHealthy   HealthStatus = "healthy"   // last probe succeeded
+	HealthUnhealthy HealthStatus = "unhealthy" // FailureThreshold consecutive probes failed
+)
+
+// Health is the health check state recorded by the daemon.
+type Health struct {
+	Status        HealthStatus `json:"status"`
+	FailingStreak int          `json:"failing_streak,omitempty"`
+	LastError     string       `json:"last_error,omitempty"`
+	CheckedAt     time.Time    `json:"checked_at"`
+}
+
+// Observe folds a probe result into h and returns the updated state.
+// A nil h is treated as a fresh "starting" state.
+func (h *Health) Observe(hc *HealthCheck, probeErr error, now time.Time) *Health {
+	next := &Health{Status: HealthStarting, CheckedAt: now}
+	if h != nil {
+		next.Status = h.Status
+		next.FailingStreak = h.FailingStreak
+	}
+	if probeErr == nil {
+		next.Status = HealthHealthy
+		next.FailingStreak = 0
+		return next
+	}
+	next.FailingStreak++
+	next.LastError = probeErr.Error()
+	if next.FailingStreak >= hc.FailureThreshold() {
+		next.Status = HealthUnhealthy
+	}
+	return next
+}
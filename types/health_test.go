@@ -0,0 +1,64 @@
+package types
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    HealthCheck
+		wantErr bool
+	}{
+		{spec: "tcp:22", want: HealthCheck{Type: HealthCheckTCP, Port: 22}},
+		{spec: "http:8080", want: HealthCheck{Type: HealthCheckHTTP, Port: 8080}},
+		{spec: "http:8080/healthz", want: HealthCheck{Type: HealthCheckHTTP, Port: 8080, Path: "/healthz"}},
+		{spec: "tcp:22/x", wantErr: true},
+		{spec: "udp:53", wantErr: true},
+		{spec: "tcp:0", wantErr: true},
+		{spec: "tcp", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseHealthCheck(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthObserve(t *testing.T) {
+	hc := &HealthCheck{Type: HealthCheckTCP, Port: 22, Retries: 2}
+	now := time.Now()
+	fail := errors.New("connection refused")
+
+	var h *Health
+	h = h.Observe(hc, fail, now)
+	if h.Status != HealthStarting || h.FailingStreak != 1 {
+		t.Fatalf("after 1 failure: %+v", h)
+	}
+	h = h.Observe(hc, fail, now)
+	if h.Status != HealthUnhealthy || h.LastError != fail.Error() {
+		t.Fatalf("after 2 failures: %+v", h)
+	}
+	h = h.Observe(hc, nil, now)
+	if h.Status != HealthHealthy || h.FailingStreak != 0 {
+		t.Fatalf("after success: %+v", h)
+	}
+	h = h.Observe(hc, fail, now)
+	if h.Status != HealthHealthy {
+		t.Fatalf("single failure should not flip healthy: %+v", h)
+	}
+}
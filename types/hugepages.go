@@ -0,0 +1,27 @@
+package types
+
+import "fmt"
+
+// HugePagesMode selects how guest memory is backed by host hugepages.
+type HugePagesMode string
+
+const (
+	HugePagesAuto     HugePagesMode = "auto"     // use hugepages when the free pool can hold the VM (default)
+	HugePagesOn       HugePagesMode = "on"       // require hugepages; fail to start otherwise
+	HugePagesOff      HugePagesMode = "off"      // regular pages
+	HugePagesPrefault HugePagesMode = "prefault" // require hugepages and fault them all in at boot
+)
+
+// Validate accepts the known modes; empty means "use the host default".
+func (m HugePagesMode) Validate() error {
+	switch m {
+	case "", HugePagesAuto, HugePagesOn, HugePagesOff, HugePagesPrefault:
+		return nil
+	}
+	return fmt.Errorf("hugepages mode %q is invalid: must be %q, %q, %q or %q", m, HugePagesAuto, HugePagesOn, HugePagesOff, HugePagesPrefault)
+}
+
+// Required reports whether the mode refuses to fall back to regular pages.
+func (m HugePagesMode) Required() bool {
+	return m == HugePagesOn || m == HugePagesPrefault
+}
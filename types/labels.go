@@ -0,0 +1,41 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const maxLabelValueLen = 255
+
+var validLabelKey = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._/-]{0,61}[a-zA-Z0-9])?$`)
+
+// ParseLabels parses repeated --label flags of the form "key=value"
+// ("key" alone means an empty value). Later keys override earlier ones.
+func ParseLabels(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		k, v, _ := strings.Cut(spec, "=")
+		labels[k] = v
+	}
+	if err := ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+// ValidateLabels checks label keys and values.
+func ValidateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if !validLabelKey.MatchString(k) {
+			return fmt.Errorf("label key %q is invalid: must match %s", k, validLabelKey.String())
+		}
+		if len(v) > maxLabelValueLen || strings.ContainsAny(v, "\n\r") {
+			return fmt.Errorf("label %q value is invalid: max %d chars, single line", k, maxLabelValueLen)
+		}
+	}
+	return nil
+}
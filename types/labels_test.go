@@ -0,0 +1,38 @@
+package types
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "pairs", specs: []string{"env=prod", "team=infra"}, want: map[string]string{"env": "prod", "team": "infra"}},
+		{name: "key only", specs: []string{"canary"}, want: map[string]string{"canary": ""}},
+		{name: "value with equals", specs: []string{"q=a=b"}, want: map[string]string{"q": "a=b"}},
+		{name: "override", specs: []string{"env=dev", "env=prod"}, want: map[string]string{"env": "prod"}},
+		{name: "domain key", specs: []string{"example.com/role=db"}, want: map[string]string{"example.com/role": "db"}},
+		{name: "empty key", specs: []string{"=x"}, wantErr: true},
+		{name: "bad key", specs: []string{"-env=x"}, wantErr: true},
+		{name: "multiline value", specs: []string{"k=a\nb"}, wantErr: true},
+		{name: "long value", specs: []string{"k=" + strings.Repeat("x", 256)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLabels(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
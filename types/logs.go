@@ -0,0 +1,22 @@
+package types
+
+import "fmt"
+
+// LogSource selects which of a VM's log files "vm logs" shows.
+type LogSource string
+
+const (
+	LogProcess LogSource = "process" // the VMM's own stdout and stderr
+	LogSerial  LogSource = "serial"  // serial port output (--serial file)
+	LogConsole LogSource = "console" // virtio console output (--console file)
+	LogBoot    LogSource = "boot"    // console output seen by the last boot probe
+)
+
+// Validate accepts the known sources; empty means LogProcess.
+func (s LogSource) Validate() error {
+	switch s {
+	case "", LogProcess, LogSerial, LogConsole, LogBoot:
+		return nil
+	}
+	return fmt.Errorf("log source %q is invalid: must be %q, %q, %q or %q", s, LogProcess, LogSerial, LogConsole, LogBoot)
+}
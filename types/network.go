@@ -1,5 +1,15 @@
 package types
 
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
 // NetworkConfig describes a single NIC attached to a VM.
 type NetworkConfig struct {
 	Tap       string `json:"tap"`
@@ -12,9 +22,167 @@ type NetworkConfig struct {
 	// Empty when the network backend does not use network namespaces (e.g. macOS vmnet).
 	NetnsPath string `json:"netns_path,omitempty"`
 
+	// Conflist is the CNI conflist the NIC is attached to, resolved at
+	// Config time so recovery reuses it even if the default changes.
+	Conflist string `json:"conflist,omitempty"`
+
+	// Macvtap is the host macvtap link backing the NIC; the hypervisor
+	// opens its queues and passes them as fds instead of using Tap.
+	Macvtap string `json:"macvtap,omitempty"`
+
+	// MTU overrides the MTU of the NIC's host device and guest interface;
+	// 0 keeps the one the network plugin chose.
+	MTU int `json:"mtu,omitempty"`
+
+	// VLAN is the 802.1Q ID the NIC's traffic is tagged with on the host
+	// side; the guest sees untagged frames. 0 = untagged.
+	VLAN int `json:"vlan,omitempty"`
+
+	// RateLimit caps the NIC's bandwidth in bits per second, in each
+	// direction, with tc tbf qdiscs on its tap and veth; 0 = unlimited.
+	RateLimit uint64 `json:"rate_limit,omitempty"`
+
+	// Capabilities lists the CNI capabilities (CapPortMappings,
+	// CapBandwidth, CapIPs) the NIC's plugin chain declared and was handed
+	// at ADD; cocoon leaves port forwarding and shaping to it for those.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// UserSocket is the passt socket of a usermode NIC: a vhost-user
+	// backend for cloud-hypervisor, a stream netdev for QEMU. Such NICs
+	// have no tap or netns.
+	UserSocket string `json:"user_socket,omitempty"`
+
+	// VFIODevice is the sysfs path of the SR-IOV VF passed through to the
+	// guest in place of a virtio-net device.
+	VFIODevice string `json:"vfio_device,omitempty"`
+
 	// Guest-side IP configuration returned by the network plugin.
 	// nil means DHCP / no static config.
 	Network *Network `json:"network,omitempty"`
+
+	// GuestIP is the address last seen in the guest's DHCP/ARP traffic on a
+	// NIC without static config ("vm start --wait-for-ip").
+	GuestIP string `json:"guest_ip,omitempty"`
+}
+
+// HasCapability reports whether the NIC's plugin chain took over capability c.
+func (nc *NetworkConfig) HasCapability(c string) bool {
+	return slices.Contains(nc.Capabilities, c)
+}
+
+// IP returns the NIC's static address, falling back to the learned GuestIP.
+func (nc *NetworkConfig) IP() string {
+	if nc.Network != nil && nc.Network.IP != "" {
+		return nc.Network.IP
+	}
+	return nc.GuestIP
+}
+
+// NIC kinds reported by "network inspect".
+const (
+	NICKindTap      = "tap"
+	NICKindMacvtap  = "macvtap"
+	NICKindSRIOV    = "sriov"
+	NICKindUsermode = "usermode"
+)
+
+// NICInfo ties together one VM NIC's host plumbing and guest addressing,
+// as shown by "network inspect".
+type NICInfo struct {
+	Index   int    `json:"index"`
+	ID      string `json:"id,omitempty"`      // network index record
+	Network string `json:"network,omitempty"` // conflist the NIC is attached to
+	Kind    string `json:"kind"`
+
+	NetnsPath  string `json:"netns_path,omitempty"`
+	Tap        string `json:"tap,omitempty"`
+	Veth       string `json:"veth,omitempty"` // CNI interface in the netns
+	Macvtap    string `json:"macvtap,omitempty"`
+	VFIODevice string `json:"vfio_device,omitempty"`
+	UserSocket string `json:"user_socket,omitempty"`
+
+	Mac       string        `json:"mac"`
+	IP        string        `json:"ip,omitempty"`
+	Prefix    int           `json:"prefix,omitempty"`
+	Gateway   string        `json:"gateway,omitempty"`
+	VLAN      int           `json:"vlan,omitempty"`
+	RateLimit uint64        `json:"rate_limit,omitempty"`
+	Ports     []PortMapping `json:"ports,omitempty"`
+}
+
+// MTU bounds of a NIC: the IPv4 minimum and the largest frame virtio-net
+// and tap devices carry.
+const (
+	MinMTU = 68
+	MaxMTU = 65535
+)
+
+// ValidateMTU accepts 0 (no override) or an MTU within [MinMTU, MaxMTU].
+func ValidateMTU(mtu int) error {
+	if mtu != 0 && (mtu < MinMTU || mtu > MaxMTU) {
+		return fmt.Errorf("%d is out of range: want %d-%d", mtu, MinMTU, MaxMTU)
+	}
+	return nil
+}
+
+// MaxVLAN is the largest usable 802.1Q VLAN ID.
+const MaxVLAN = 4094
+
+// ValidateVLAN accepts 0 (untagged) or a VLAN ID within [1, MaxVLAN].
+func ValidateVLAN(id int) error {
+	if id < 0 || id > MaxVLAN {
+		return fmt.Errorf("%d is out of range: want 1-%d (0 = untagged)", id, MaxVLAN)
+	}
+	return nil
+}
+
+// CNI capabilities cocoon hands to plugin chains that declare them in
+// their config, e.g. "capabilities": {"portMappings": true} on portmap.
+const (
+	CapPortMappings = "portMappings" // --publish, NIC 0 only
+	CapBandwidth    = "bandwidth"    // --net-limit
+	CapIPs          = "ips"          // --ip, or the persisted IP on recovery
+)
+
+// reservedCNIArgs are CNI_ARGS cocoon sets itself.
+var reservedCNIArgs = map[string]string{
+	"IgnoreUnknown": "it is always set",
+	"IP":            "use --ip",
+}
+
+// ParseCNIArgs parses "KEY=VALUE" CNI_ARGS. Keys and values cannot
+// contain ';', the CNI_ARGS separator.
+func ParseCNIArgs(args []string) ([][2]string, error) {
+	out := make([][2]string, 0, len(args))
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%q is invalid: want KEY=VALUE", arg)
+		}
+		if strings.Contains(arg, ";") {
+			return nil, fmt.Errorf("%q is invalid: must not contain ';'", arg)
+		}
+		if why, ok := reservedCNIArgs[k]; ok {
+			return nil, fmt.Errorf("%q is reserved: %s", k, why)
+		}
+		out = append(out, [2]string{k, v})
+	}
+	return out, nil
+}
+
+// ValidateMAC rejects anything but a 48-bit unicast MAC address.
+func ValidateMAC(mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 { //nolint:mnd
+		return fmt.Errorf("--mac %q is invalid: want a 48-bit MAC such as 02:00:00:00:00:01", mac)
+	}
+	if hw[0]&1 != 0 {
+		return fmt.Errorf("--mac %s is invalid: it is a multicast address", mac)
+	}
+	if bytes.Equal(hw, make(net.HardwareAddr, 6)) { //nolint:mnd
+		return fmt.Errorf("--mac %s is invalid: it is all zeros", mac)
+	}
+	return nil
 }
 
 // Network holds guest-visible IP configuration for a NIC.
@@ -25,3 +193,98 @@ type Network struct {
 	Gateway string `json:"gateway,omitempty"` // dotted decimal, e.g. "10.0.0.1"
 	Prefix  int    `json:"prefix,omitempty"`  // CIDR prefix length, e.g. 24
 }
+
+// Network drivers of "network create".
+const (
+	NetworkDriverBridge  = "bridge"
+	NetworkDriverMacvtap = "macvtap"
+)
+
+// NetworkSpec describes a named network VMs attach to with --network: a
+// bridge conflist generated by "network create", a macvtap network on a
+// host NIC, or a conflist found in the CNI conf dir (Managed false,
+// addresses unknown).
+type NetworkSpec struct {
+	Name       string     `json:"name"`
+	Managed    bool       `json:"managed"`
+	Driver     string     `json:"driver,omitempty"` // empty = bridge
+	Parent     string     `json:"parent,omitempty"` // host NIC of a macvtap network
+	Bridge     string     `json:"bridge,omitempty"`
+	Subnet     string     `json:"subnet,omitempty"`      // CIDR, e.g. "10.89.0.0/24"
+	Gateway    string     `json:"gateway,omitempty"`     // default: first host of Subnet
+	RangeStart string     `json:"range_start,omitempty"` // IPAM pool; empty = whole subnet
+	RangeEnd   string     `json:"range_end,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+
+	// Isolated keeps VMs on the network from reaching each other while
+	// they still reach the gateway: their bridge ports are isolated, or
+	// their macvtaps are in private mode.
+	Isolated bool `json:"isolated,omitempty"`
+
+	// NICs counts the VM NICs attached to the network; filled on listing.
+	NICs int `json:"nics,omitempty"`
+}
+
+// IsMacvtap reports whether NICs on the network are macvtap links on
+// Parent rather than CNI-managed.
+func (s *NetworkSpec) IsMacvtap() bool {
+	return s.Driver == NetworkDriverMacvtap
+}
+
+// Validate checks the addresses of a fully defaulted spec.
+func (s *NetworkSpec) Validate() error {
+	if !validName.MatchString(s.Name) {
+		return fmt.Errorf("network name %q is invalid: must match %s (max 63 chars)", s.Name, validName.String())
+	}
+	switch s.Driver {
+	case "", NetworkDriverBridge:
+		if s.Parent != "" {
+			return fmt.Errorf("--parent is only valid with --driver %s", NetworkDriverMacvtap)
+		}
+	case NetworkDriverMacvtap:
+		// Addresses come from the parent's L2 network (DHCP in the guest).
+		if !validBridge.MatchString(s.Parent) {
+			return fmt.Errorf("--parent %q is invalid: want a host interface name", s.Parent)
+		}
+		if s.Bridge != "" || s.Subnet != "" || s.Gateway != "" || s.RangeStart != "" {
+			return fmt.Errorf("--driver %s takes no --bridge, --subnet, --gateway or --ip-range", NetworkDriverMacvtap)
+		}
+		return nil
+	default:
+		return fmt.Errorf("--driver %q is invalid: must be %s or %s", s.Driver, NetworkDriverBridge, NetworkDriverMacvtap)
+	}
+	if !validBridge.MatchString(s.Bridge) {
+		return fmt.Errorf("--bridge %q is invalid: must match %s (max 15 chars)", s.Bridge, validBridge.String())
+	}
+	ip, subnet, err := net.ParseCIDR(s.Subnet)
+	if err != nil || ip.To4() == nil {
+		return fmt.Errorf("--subnet %q is invalid: want an IPv4 CIDR", s.Subnet)
+	}
+	if !ip.Equal(subnet.IP) {
+		return fmt.Errorf("--subnet %q is invalid: host bits set (did you mean %s?)", s.Subnet, subnet)
+	}
+	if ones, _ := subnet.Mask.Size(); ones > 30 { //nolint:mnd
+		return fmt.Errorf("--subnet %q is too small: need at least a /30", s.Subnet)
+	}
+	for _, a := range []struct{ flag, val string }{
+		{"--gateway", s.Gateway},
+		{"--ip-range start", s.RangeStart},
+		{"--ip-range end", s.RangeEnd},
+	} {
+		if a.val == "" {
+			continue
+		}
+		if ip := net.ParseIP(a.val); ip == nil || !subnet.Contains(ip) {
+			return fmt.Errorf("%s %q is invalid: must be an address in %s", a.flag, a.val, s.Subnet)
+		}
+	}
+	if (s.RangeStart == "") != (s.RangeEnd == "") {
+		return fmt.Errorf("--ip-range needs both a start and an end")
+	}
+	if s.RangeStart != "" && bytes.Compare(net.ParseIP(s.RangeStart).To4(), net.ParseIP(s.RangeEnd).To4()) > 0 {
+		return fmt.Errorf("--ip-range %s-%s is invalid: start after end", s.RangeStart, s.RangeEnd)
+	}
+	return nil
+}
+
+var validBridge = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,14}$`)
@@ -0,0 +1,139 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNetworkSpecValidate(t *testing.T) {
+	valid := NetworkSpec{Name: "tenant1", Bridge: "cc-tenant1", Subnet: "10.89.0.0/24", Gateway: "10.89.0.1"}
+	tests := []struct {
+		name    string
+		mutate  func(*NetworkSpec)
+		wantErr bool
+	}{
+		{name: "valid", mutate: func(*NetworkSpec) {}},
+		{name: "range", mutate: func(s *NetworkSpec) { s.RangeStart, s.RangeEnd = "10.89.0.10", "10.89.0.20" }},
+		{name: "bad name", mutate: func(s *NetworkSpec) { s.Name = "-x" }, wantErr: true},
+		{name: "long bridge", mutate: func(s *NetworkSpec) { s.Bridge = "bridge-name-too-long" }, wantErr: true},
+		{name: "ipv6 subnet", mutate: func(s *NetworkSpec) { s.Subnet = "fd00::/64" }, wantErr: true},
+		{name: "host bits", mutate: func(s *NetworkSpec) { s.Subnet = "10.89.0.5/24" }, wantErr: true},
+		{name: "tiny subnet", mutate: func(s *NetworkSpec) { s.Subnet = "10.89.0.0/31" }, wantErr: true},
+		{name: "gateway outside", mutate: func(s *NetworkSpec) { s.Gateway = "10.90.0.1" }, wantErr: true},
+		{name: "half range", mutate: func(s *NetworkSpec) { s.RangeStart = "10.89.0.10" }, wantErr: true},
+		{name: "reversed range", mutate: func(s *NetworkSpec) { s.RangeStart, s.RangeEnd = "10.89.0.20", "10.89.0.10" }, wantErr: true},
+		{name: "bad driver", mutate: func(s *NetworkSpec) { s.Driver = "ipvlan" }, wantErr: true},
+		{name: "parent on bridge", mutate: func(s *NetworkSpec) { s.Parent = "eth0" }, wantErr: true},
+		{name: "macvtap", mutate: func(s *NetworkSpec) { *s = NetworkSpec{Name: "lan", Driver: NetworkDriverMacvtap, Parent: "eth0"} }},
+		{name: "macvtap without parent", mutate: func(s *NetworkSpec) { *s = NetworkSpec{Name: "lan", Driver: NetworkDriverMacvtap} }, wantErr: true},
+		{name: "macvtap with subnet", mutate: func(s *NetworkSpec) { s.Driver, s.Parent, s.Bridge = NetworkDriverMacvtap, "eth0", "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid
+			tt.mutate(&s)
+			if err := s.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMAC(t *testing.T) {
+	for _, tt := range []struct {
+		mac     string
+		wantErr bool
+	}{
+		{"02:42:ac:11:00:02", false},
+		{"52:54:00:12:34:56", false},
+		{"not-a-mac", true},
+		{"02:00:00:00:00:00:00:01", true}, // EUI-64
+		{"01:00:5e:00:00:01", true},       // multicast
+		{"00:00:00:00:00:00", true},
+	} {
+		if err := ValidateMAC(tt.mac); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateMAC(%q) = %v, wantErr %v", tt.mac, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateMTU(t *testing.T) {
+	for _, tt := range []struct {
+		mtu     int
+		wantErr bool
+	}{
+		{0, false},
+		{MinMTU, false},
+		{1400, false},
+		{9000, false},
+		{MaxMTU, false},
+		{MinMTU - 1, true},
+		{MaxMTU + 1, true},
+		{-1, true},
+	} {
+		if err := ValidateMTU(tt.mtu); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateMTU(%d) = %v, wantErr %v", tt.mtu, err, tt.wantErr)
+		}
+	}
+}
+
+func TestVLAN(t *testing.T) {
+	for _, tt := range []struct {
+		id      int
+		wantErr bool
+	}{
+		{0, false},
+		{1, false},
+		{MaxVLAN, false},
+		{MaxVLAN + 1, true},
+		{-1, true},
+	} {
+		if err := ValidateVLAN(tt.id); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateVLAN(%d) = %v, wantErr %v", tt.id, err, tt.wantErr)
+		}
+	}
+
+	all := &VMConfig{VLANs: []int{100}}
+	perNIC := &VMConfig{VLANs: []int{0, 200}}
+	for _, tt := range []struct {
+		cfg  *VMConfig
+		i    int
+		want int
+	}{
+		{&VMConfig{}, 0, 0},
+		{all, 2, 100},
+		{perNIC, 0, 0},
+		{perNIC, 1, 200},
+		{perNIC, 2, 0},
+	} {
+		if got := tt.cfg.NICVLAN(tt.i); got != tt.want {
+			t.Errorf("NICVLAN(%d) with %v = %d, want %d", tt.i, tt.cfg.VLANs, got, tt.want)
+		}
+	}
+}
+
+func TestParseCNIArgs(t *testing.T) {
+	for _, tt := range []struct {
+		args    []string
+		want    [][2]string
+		wantErr bool
+	}{
+		{nil, [][2]string{}, false},
+		{[]string{"K8S_POD_NAME=web", "EMPTY="}, [][2]string{{"K8S_POD_NAME", "web"}, {"EMPTY", ""}}, false},
+		{[]string{"A=b=c"}, [][2]string{{"A", "b=c"}}, false},
+		{[]string{"novalue"}, nil, true},
+		{[]string{"=v"}, nil, true},
+		{[]string{"A=1;B=2"}, nil, true},
+		{[]string{"IP=10.0.0.5"}, nil, true},
+		{[]string{"IgnoreUnknown=0"}, nil, true},
+	} {
+		got, err := ParseCNIArgs(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCNIArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("ParseCNIArgs(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
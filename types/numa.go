@@ -0,0 +1,77 @@
+package types
+
+import "fmt"
+
+// NUMAConfig describes the guest NUMA topology. vCPUs are split into
+// contiguous, near-equal ranges across nodes.
+type NUMAConfig struct {
+	Nodes     int     `json:"nodes"`
+	Memory    []int64 `json:"memory,omitempty"`     // bytes per node; empty = even split
+	HostNodes []int   `json:"host_nodes,omitempty"` // host node per guest node; empty = unbound
+}
+
+// Validate checks the topology against the VM's vCPUs and memory.
+func (n *NUMAConfig) Validate(cpu int, memory int64) error {
+	if n.Nodes < 1 {
+		return fmt.Errorf("--numa-nodes must be at least 1, got %d", n.Nodes)
+	}
+	if n.Nodes > cpu {
+		return fmt.Errorf("--numa-nodes %d exceeds --cpu %d: every node needs a vCPU", n.Nodes, cpu)
+	}
+	if len(n.Memory) > 0 {
+		if len(n.Memory) != n.Nodes {
+			return fmt.Errorf("--numa-memory has %d entries, want one per node (%d)", len(n.Memory), n.Nodes)
+		}
+		var total int64
+		for i, m := range n.Memory {
+			if m <= 0 {
+				return fmt.Errorf("--numa-memory: node %d size must be positive", i)
+			}
+			total += m
+		}
+		if total != memory {
+			return fmt.Errorf("--numa-memory adds up to %d bytes, want --memory (%d bytes)", total, memory)
+		}
+	}
+	if len(n.HostNodes) > 0 {
+		if len(n.HostNodes) != n.Nodes {
+			return fmt.Errorf("--numa-host-nodes has %d entries, want one per node (%d)", len(n.HostNodes), n.Nodes)
+		}
+		for _, h := range n.HostNodes {
+			if h < 0 {
+				return fmt.Errorf("--numa-host-nodes: invalid host node %d", h)
+			}
+		}
+	}
+	return nil
+}
+
+// NodeMemory returns the memory of each node: the explicit split, or
+// memory divided evenly with the remainder on the last node.
+func (n *NUMAConfig) NodeMemory(memory int64) []int64 {
+	if len(n.Memory) > 0 {
+		return n.Memory
+	}
+	sizes := make([]int64, n.Nodes)
+	per := memory / int64(n.Nodes)
+	for i := range sizes {
+		sizes[i] = per
+	}
+	sizes[n.Nodes-1] += memory - per*int64(n.Nodes)
+	return sizes
+}
+
+// NodeCPUs returns the first and last vCPU of each node.
+func (n *NUMAConfig) NodeCPUs(cpu int) [][2]int {
+	ranges := make([][2]int, n.Nodes)
+	start := 0
+	for i := range ranges {
+		count := cpu / n.Nodes
+		if i < cpu%n.Nodes {
+			count++
+		}
+		ranges[i] = [2]int{start, start + count - 1}
+		start += count
+	}
+	return ranges
+}
@@ -0,0 +1,41 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNUMAConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		numa    NUMAConfig
+		wantErr bool
+	}{
+		{"even", NUMAConfig{Nodes: 2}, false},
+		{"explicit", NUMAConfig{Nodes: 2, Memory: []int64{3 << 30, 1 << 30}, HostNodes: []int{0, 1}}, false},
+		{"zero nodes", NUMAConfig{Nodes: 0}, true},
+		{"more nodes than cpus", NUMAConfig{Nodes: 5}, true},
+		{"memory count", NUMAConfig{Nodes: 2, Memory: []int64{4 << 30}}, true},
+		{"memory sum", NUMAConfig{Nodes: 2, Memory: []int64{1 << 30, 1 << 30}}, true},
+		{"host node count", NUMAConfig{Nodes: 2, HostNodes: []int{0}}, true},
+		{"negative host node", NUMAConfig{Nodes: 2, HostNodes: []int{0, -1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.numa.Validate(4, 4<<30)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNUMAConfigSplit(t *testing.T) {
+	numa := NUMAConfig{Nodes: 3}
+	if got, want := numa.NodeMemory(10), []int64{3, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("NodeMemory(10) = %v, want %v", got, want)
+	}
+	if got, want := numa.NodeCPUs(5), [][2]int{{0, 1}, {2, 3}, {4, 4}}; !slices.Equal(got, want) {
+		t.Errorf("NodeCPUs(5) = %v, want %v", got, want)
+	}
+}
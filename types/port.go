@@ -0,0 +1,119 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Port forwarding protocols.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+// PortMapping publishes a guest port on the host ("--publish").
+type PortMapping struct {
+	HostIP    string `json:"host_ip,omitempty"` // empty = all interfaces
+	HostPort  int    `json:"host_port"`
+	GuestPort int    `json:"guest_port"`
+	Protocol  string `json:"protocol"` // tcp or udp
+}
+
+// ParsePortMappings parses repeated --publish flags of the form
+// "[hostIP:]hostPort:guestPort[/tcp|/udp]" ("port" alone publishes it on
+// the same host port). The protocol defaults to tcp.
+func ParsePortMappings(specs []string) ([]PortMapping, error) {
+	var out []PortMapping
+	for _, spec := range specs {
+		m, err := parsePortMapping(spec)
+		if err != nil {
+			return nil, fmt.Errorf("--publish %q is invalid: %w", spec, err)
+		}
+		out = append(out, m)
+	}
+	if err := ValidatePortMappings(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func parsePortMapping(spec string) (PortMapping, error) {
+	m := PortMapping{Protocol: ProtocolTCP}
+	addr, proto, ok := strings.Cut(spec, "/")
+	if ok {
+		m.Protocol = strings.ToLower(proto)
+	}
+	// The host IP may be a bracketed IPv6 address.
+	if i := strings.LastIndex(addr, "]:"); strings.HasPrefix(addr, "[") && i > 0 {
+		m.HostIP = addr[1:i]
+		addr = addr[i+2:]
+	}
+	parts := strings.Split(addr, ":")
+	switch {
+	case len(parts) == 3 && m.HostIP == "":
+		m.HostIP = parts[0]
+		parts = parts[1:]
+	case len(parts) == 1 && m.HostIP == "":
+		parts = []string{parts[0], parts[0]}
+	case len(parts) != 2:
+		return m, fmt.Errorf("want [hostIP:]hostPort:guestPort[/tcp|/udp]")
+	}
+	var err error
+	if m.HostPort, err = strconv.Atoi(parts[0]); err != nil {
+		return m, fmt.Errorf("host port %q is not a number", parts[0])
+	}
+	if m.GuestPort, err = strconv.Atoi(parts[1]); err != nil {
+		return m, fmt.Errorf("guest port %q is not a number", parts[1])
+	}
+	return m, m.Validate()
+}
+
+// Validate checks the ports, protocol and host address.
+func (m PortMapping) Validate() error {
+	if m.HostPort < 1 || m.HostPort > 65535 {
+		return fmt.Errorf("host port %d out of range 1-65535", m.HostPort)
+	}
+	if m.GuestPort < 1 || m.GuestPort > 65535 {
+		return fmt.Errorf("guest port %d out of range 1-65535", m.GuestPort)
+	}
+	if m.Protocol != ProtocolTCP && m.Protocol != ProtocolUDP {
+		return fmt.Errorf("protocol %q is invalid: must be %q or %q", m.Protocol, ProtocolTCP, ProtocolUDP)
+	}
+	if m.HostIP != "" && net.ParseIP(m.HostIP) == nil {
+		return fmt.Errorf("host IP %q is invalid", m.HostIP)
+	}
+	return nil
+}
+
+// ValidatePortMappings checks each mapping and rejects two mappings that
+// claim the same host port.
+func ValidatePortMappings(ms []PortMapping) error {
+	seen := map[string]bool{}
+	for _, m := range ms {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("--publish %s is invalid: %w", m, err)
+		}
+		key := fmt.Sprintf("%d/%s", m.HostPort, m.Protocol)
+		if seen[key] {
+			return fmt.Errorf("--publish host port %s is used twice", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// HostAddr returns the host address to listen on.
+func (m PortMapping) HostAddr() string {
+	return net.JoinHostPort(m.HostIP, strconv.Itoa(m.HostPort))
+}
+
+// String formats the mapping as "hostIP:hostPort->guestPort/proto".
+func (m PortMapping) String() string {
+	host := m.HostIP
+	if host == "" {
+		host = "0.0.0.0"
+	}
+	return fmt.Sprintf("%s->%d/%s", net.JoinHostPort(host, strconv.Itoa(m.HostPort)), m.GuestPort, m.Protocol)
+}
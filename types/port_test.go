@@ -0,0 +1,57 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePortMappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    []PortMapping
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "host and guest", specs: []string{"8080:80"}, want: []PortMapping{{HostPort: 8080, GuestPort: 80, Protocol: ProtocolTCP}}},
+		{name: "same port", specs: []string{"53/udp"}, want: []PortMapping{{HostPort: 53, GuestPort: 53, Protocol: ProtocolUDP}}},
+		{name: "host ip", specs: []string{"127.0.0.1:2222:22/tcp"}, want: []PortMapping{{HostIP: "127.0.0.1", HostPort: 2222, GuestPort: 22, Protocol: ProtocolTCP}}},
+		{name: "ipv6 host", specs: []string{"[::1]:8443:443"}, want: []PortMapping{{HostIP: "::1", HostPort: 8443, GuestPort: 443, Protocol: ProtocolTCP}}},
+		{name: "tcp and udp on one port", specs: []string{"53:53", "53:53/udp"}, want: []PortMapping{
+			{HostPort: 53, GuestPort: 53, Protocol: ProtocolTCP},
+			{HostPort: 53, GuestPort: 53, Protocol: ProtocolUDP},
+		}},
+		{name: "duplicate host port", specs: []string{"8080:80", "8080:81"}, wantErr: true},
+		{name: "bad protocol", specs: []string{"8080:80/sctp"}, wantErr: true},
+		{name: "out of range", specs: []string{"70000:80"}, wantErr: true},
+		{name: "not a number", specs: []string{"http:80"}, wantErr: true},
+		{name: "bad host ip", specs: []string{"host:8080:80"}, wantErr: true},
+		{name: "too many parts", specs: []string{"1:2:3:4"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePortMappings(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortMappingString(t *testing.T) {
+	tests := []struct {
+		m    PortMapping
+		want string
+	}{
+		{PortMapping{HostPort: 8080, GuestPort: 80, Protocol: ProtocolTCP}, "0.0.0.0:8080->80/tcp"},
+		{PortMapping{HostIP: "::1", HostPort: 53, GuestPort: 53, Protocol: ProtocolUDP}, "[::1]:53->53/udp"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
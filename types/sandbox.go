@@ -0,0 +1,40 @@
+package types
+
+import "fmt"
+
+// SeccompMode selects the VMM's seccomp filtering.
+type SeccompMode string
+
+const (
+	SeccompOn  SeccompMode = "on"  // kill the VMM on a disallowed syscall (default)
+	SeccompLog SeccompMode = "log" // log disallowed syscalls but let them through
+	SeccompOff SeccompMode = "off" // no seccomp filter
+)
+
+// Validate accepts the known modes; empty means "use the host default".
+func (m SeccompMode) Validate() error {
+	switch m {
+	case "", SeccompOn, SeccompLog, SeccompOff:
+		return nil
+	}
+	return fmt.Errorf("seccomp mode %q is invalid: must be %q, %q or %q", m, SeccompOn, SeccompLog, SeccompOff)
+}
+
+// LandlockMode selects whether the VMM confines its own filesystem access
+// with Landlock.
+type LandlockMode string
+
+const (
+	LandlockAuto LandlockMode = "auto" // enable when both kernel and VMM support it (default)
+	LandlockOn   LandlockMode = "on"   // require Landlock; fail to start otherwise
+	LandlockOff  LandlockMode = "off"  // never enable Landlock
+)
+
+// Validate accepts the known modes; empty means "use the host default".
+func (m LandlockMode) Validate() error {
+	switch m {
+	case "", LandlockAuto, LandlockOn, LandlockOff:
+		return nil
+	}
+	return fmt.Errorf("landlock mode %q is invalid: must be %q, %q or %q", m, LandlockAuto, LandlockOn, LandlockOff)
+}
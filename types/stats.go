@@ -0,0 +1,63 @@
+package types
+
+import "time"
+
+// VMStats is a point-in-time resource usage sample for a running VM.
+// Host-side fields come from the VMM process; guest-side fields from the
+// hypervisor's device counters.
+type VMStats struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	PID  int    `json:"pid"`
+
+	// CPUTime is the cumulative user+system CPU time of the VMM process,
+	// which includes all vCPU threads.
+	CPUTime time.Duration `json:"cpu_time_ns"`
+	// MemoryRSS is the resident set size of the VMM process, bytes.
+	MemoryRSS int64 `json:"memory_rss"`
+	// MemoryActual is guest memory minus the balloon, bytes; 0 if unknown.
+	MemoryActual int64 `json:"memory_actual,omitempty"`
+
+	BlockReadBytes  uint64 `json:"block_read_bytes"`
+	BlockWriteBytes uint64 `json:"block_write_bytes"`
+	BlockReadOps    uint64 `json:"block_read_ops"`
+	BlockWriteOps   uint64 `json:"block_write_ops"`
+	NetRxBytes      uint64 `json:"net_rx_bytes"`
+	NetTxBytes      uint64 `json:"net_tx_bytes"`
+	NetRxPackets    uint64 `json:"net_rx_packets"`
+	NetTxPackets    uint64 `json:"net_tx_packets"`
+
+	// NICs holds each NIC's traffic as counted on its host device.
+	NICs []NICStats `json:"nics,omitempty"`
+
+	// Counters holds the raw per-device counters reported by the hypervisor.
+	Counters map[string]map[string]uint64 `json:"counters,omitempty"`
+
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// NICStats is one NIC's traffic, read from its host device (tap or macvtap)
+// and seen from the guest: Rx is what the guest received.
+type NICStats struct {
+	Index     int    `json:"index"`
+	Device    string `json:"device"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+	RxDropped uint64 `json:"rx_dropped"`
+	TxDropped uint64 `json:"tx_dropped"`
+}
+
+// CPUPercent returns CPU usage between prev and s as a percentage of one
+// host CPU (200% = two CPUs busy). Returns 0 without a usable baseline.
+func (s *VMStats) CPUPercent(prev *VMStats) float64 {
+	if prev == nil {
+		return 0
+	}
+	wall := s.CollectedAt.Sub(prev.CollectedAt)
+	if wall <= 0 || s.CPUTime < prev.CPUTime {
+		return 0
+	}
+	return float64(s.CPUTime-prev.CPUTime) / float64(wall) * 100 //nolint:mnd
+}
@@ -0,0 +1,30 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCPUPercent(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	prev := &VMStats{CPUTime: 1 * time.Second, CollectedAt: t0}
+	tests := []struct {
+		name string
+		cur  VMStats
+		prev *VMStats
+		want float64
+	}{
+		{name: "one cpu busy", cur: VMStats{CPUTime: 3 * time.Second, CollectedAt: t0.Add(2 * time.Second)}, prev: prev, want: 100},
+		{name: "two cpus busy", cur: VMStats{CPUTime: 5 * time.Second, CollectedAt: t0.Add(2 * time.Second)}, prev: prev, want: 200},
+		{name: "no baseline", cur: VMStats{CPUTime: 3 * time.Second, CollectedAt: t0.Add(time.Second)}, want: 0},
+		{name: "process restarted", cur: VMStats{CPUTime: 0, CollectedAt: t0.Add(time.Second)}, prev: prev, want: 0},
+		{name: "same instant", cur: VMStats{CPUTime: 2 * time.Second, CollectedAt: t0}, prev: prev, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cur.CPUPercent(tt.prev); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
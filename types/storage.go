@@ -1,7 +1,98 @@
 package types
 
+import (
+	"fmt"
+	"time"
+)
+
 type StorageConfig struct {
 	Path   string `json:"path"`
 	RO     bool   `json:"ro"`
 	Serial string `json:"serial"`
+	// Pmem exposes a read-only layer as a virtio-pmem (DAX) device instead
+	// of a virtio-blk disk; the guest finds it by pmem region, not serial.
+	Pmem bool `json:"pmem,omitempty"`
+	// Volume is the ID of the volume backing the disk; empty for the
+	// VM's own disks.
+	Volume string `json:"volume,omitempty"`
+	// Target is the guest device a volume disk appears as, e.g. /dev/vdc.
+	Target string `json:"target,omitempty"`
+	// Pinned marks a Target the user asked for, which must not change.
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// DiskBackend selects what serves a VM's writable disk to the VMM.
+type DiskBackend string
+
+const (
+	DiskBackendBuiltin DiskBackend = "builtin" // the VMM's own block layer (default)
+	DiskBackendQSD     DiskBackend = "qsd"     // a qemu-storage-daemon vhost-user-blk export
+)
+
+// Validate accepts the known backends; empty means builtin.
+func (b DiskBackend) Validate() error {
+	switch b {
+	case "", DiskBackendBuiltin, DiskBackendQSD:
+		return nil
+	}
+	return fmt.Errorf("disk-backend %q is invalid: must be %q or %q", b, DiskBackendBuiltin, DiskBackendQSD)
+}
+
+// VhostUser reports whether the disk is served over vhost-user-blk.
+func (b DiskBackend) VhostUser() bool { return b == DiskBackendQSD }
+
+// Prealloc selects how much of a VM's writable disk is allocated on the
+// host when it is created.
+type Prealloc string
+
+const (
+	PreallocOff      Prealloc = "off"      // sparse; blocks are allocated as the guest writes (default)
+	PreallocMetadata Prealloc = "metadata" // filesystem metadata is written up front, data stays sparse
+	PreallocFull     Prealloc = "full"     // every block is reserved, so the guest never hits ENOSPC
+)
+
+// Validate accepts the known modes; empty means off.
+func (p Prealloc) Validate() error {
+	switch p {
+	case "", PreallocOff, PreallocMetadata, PreallocFull:
+		return nil
+	}
+	return fmt.Errorf("prealloc %q is invalid: must be %q, %q or %q", p, PreallocFull, PreallocMetadata, PreallocOff)
+}
+
+// Sparse reports whether the disk is created without preallocation.
+func (p Prealloc) Sparse() bool { return p == "" || p == PreallocOff }
+
+// HasVolumes reports whether any of storageConfigs is a volume disk.
+func HasVolumes(storageConfigs []*StorageConfig) bool {
+	for _, sc := range storageConfigs {
+		if sc != nil && sc.Volume != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// DiskSnapshot is a save point of a VM's root disk, taken while the VM was
+// stopped.
+type DiskSnapshot struct {
+	Name      string    `json:"name"`
+	Storage   int64     `json:"storage"` // root disk size when taken
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ValidateDiskSnapshotName checks that name is usable as a disk snapshot name.
+func ValidateDiskSnapshotName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("disk snapshot name %q is invalid: must match %s (max 63 chars)", name, validName.String())
+	}
+	return nil
+}
+
+// ValidatePoolName checks that name is usable as a storage pool name.
+func ValidatePoolName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("storage pool name %q is invalid: must match %s (max 63 chars)", name, validName.String())
+	}
+	return nil
 }
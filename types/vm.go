@@ -2,52 +2,554 @@ package types
 
 import (
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type VMState string
 
 const (
-	VMStateCreating VMState = "creating" // DB placeholder written, dirs/disks being prepared
-	VMStateCreated  VMState = "created"  // registered, CH process not yet started
-	VMStateRunning  VMState = "running"  // CH process alive, guest is up
-	VMStateStopped  VMState = "stopped"  // CH process has exited cleanly
-	VMStateError    VMState = "error"    // start or stop failed
+	VMStateCreating  VMState = "creating"  // DB placeholder written, dirs/disks being prepared
+	VMStateCreated   VMState = "created"   // registered, CH process not yet started
+	VMStateRunning   VMState = "running"   // CH process alive, guest is up
+	VMStateStopped   VMState = "stopped"   // CH process has exited cleanly
+	VMStateSuspended VMState = "suspended" // CH process exited after saving the guest state to disk
+	VMStateError     VMState = "error"     // start or stop failed
 )
 
-var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+// RestartPolicy controls whether the daemon restarts a VM whose
+// cloud-hypervisor process exited without going through Stop.
+type RestartPolicy string
+
+const (
+	RestartPolicyNo     RestartPolicy = "no"     // never restart (default)
+	RestartPolicyAlways RestartPolicy = "always" // restart whenever the VMM exits unexpectedly
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,62}$`)
+	// validLabel is an RFC 1123 hostname label.
+	validLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+	// validEnvKey is a shell variable name.
+	validEnvKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// validTimezone is a tz database name such as "UTC" or
+	// "America/Argentina/Buenos_Aires".
+	validTimezone = regexp.MustCompile(`^[A-Za-z0-9_+-]+(/[A-Za-z0-9_+-]+)*$`)
+	// validLocale is a POSIX locale name such as "en_US.UTF-8".
+	validLocale = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+)
 
 // VMConfig describes the resources requested for a new VM.
 type VMConfig struct {
 	Name    string `json:"name"`
 	CPU     int    `json:"cpu"`
-	Memory  int64  `json:"memory"`  // bytes
-	Storage int64  `json:"storage"` // COW disk size, bytes
+	MaxCPU  int    `json:"max_cpu,omitempty"` // vCPU hotplug ceiling; 0 = host cores
+	Memory  int64  `json:"memory"`            // bytes
+	Storage int64  `json:"storage"`           // COW disk size, bytes
 	Image   string `json:"image"`
 	Network string `json:"network,omitempty"` // CNI conflist name; empty = default
+
+	// Hostname is the guest hostname; empty = derived from Name. Domain,
+	// when set, makes Hostname.Domain the guest's FQDN.
+	Hostname string `json:"hostname,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+
+	// Networks names the CNI conflist of each NIC in order (eth0, eth1, ...)
+	// when "--network" is repeated; NICs beyond the list use Network.
+	Networks []string `json:"networks,omitempty"`
+
+	// IP fixes the IPv4 address of the first NIC; empty = allocated by IPAM.
+	IP string `json:"ip,omitempty"`
+
+	// DHCP leaves guest addressing to the guest's DHCP client instead of
+	// the static config cocoon derives from the CNI result.
+	DHCP bool `json:"dhcp,omitempty"`
+
+	// NetLimits caps each NIC's bandwidth in bits per second, in both
+	// directions; a single entry applies to every NIC.
+	NetLimits []uint64 `json:"net_limits,omitempty"`
+
+	// MTU overrides the MTU of every NIC, host and guest side; 0 keeps
+	// the one the network plugin chose.
+	MTU int `json:"mtu,omitempty"`
+
+	// VLANs tags each NIC's traffic with an 802.1Q ID on the host side;
+	// a single entry applies to every NIC, 0 leaves a NIC untagged.
+	VLANs []int `json:"vlans,omitempty"`
+
+	// CNIArgs are extra "KEY=VALUE" CNI_ARGS passed to the plugin chain
+	// of every CNI NIC, on creation and recovery.
+	CNIArgs []string `json:"cni_args,omitempty"`
+
+	// Volumes lists the volumes attached to the VM at creation.
+	Volumes []VolumeAttachment `json:"volumes,omitempty"`
+
+	// MACs pins the MAC address of each NIC in order; NICs beyond the
+	// list get one from the network plugin.
+	MACs []string `json:"macs,omitempty"`
+
+	// Publish lists guest ports the daemon forwards from the host to the
+	// VM's IP.
+	Publish []PortMapping `json:"publish,omitempty"`
+
+	RestartPolicy RestartPolicy `json:"restart_policy,omitempty"` // empty = no
+	Autostart     bool          `json:"autostart,omitempty"`      // started by "vm start --autostarted" at host boot
+	HealthCheck   *HealthCheck  `json:"health_check,omitempty"`   // nil = no health check
+	BootProbe     *BootProbe    `json:"boot_probe,omitempty"`     // nil = start returns once the VMM is up
+
+	// CPUSet pins the vCPUs to host CPUs (Linux CPU list, e.g. "2-5").
+	// Pins are exclusive unless CPUSetShared is set on both VMs.
+	CPUSet       string `json:"cpuset,omitempty"`
+	CPUSetShared bool   `json:"cpuset_shared,omitempty"`
+
+	NUMA *NUMAConfig `json:"numa,omitempty"` // nil = single node
+
+	Seccomp  SeccompMode  `json:"seccomp,omitempty"`  // empty = host default
+	Landlock LandlockMode `json:"landlock,omitempty"` // empty = host default
+
+	HugePages HugePagesMode `json:"hugepages,omitempty"` // empty = host default
+
+	// PmemLayers attaches OCI image layers as virtio-pmem devices so the
+	// guest maps them with DAX instead of caching a copy in its page cache.
+	PmemLayers bool `json:"pmem_layers,omitempty"`
+
+	// TPM attaches a per-VM swtpm-backed TPM 2.0 device whose state
+	// persists across restarts.
+	TPM bool `json:"tpm,omitempty"`
+
+	// Encrypt formats the writable COW disk of an OCI VM with LUKS2; its
+	// key lives in the host keystore and reaches the guest's initramfs
+	// on every start.
+	Encrypt bool `json:"encrypt,omitempty"`
+
+	// ReadOnly discards everything the guest wrote to its root disk on
+	// every start, so each boot sees the pristine image.
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// DataDir is the absolute directory the VM's writable disks live
+	// under instead of the run directory, e.g. a faster filesystem.
+	DataDir string `json:"data_dir,omitempty"`
+	// Pool names the storage pool DataDir was taken from.
+	Pool string `json:"pool,omitempty"`
+
+	// EphemeralDisk attaches a blank scratch disk of this many bytes,
+	// backed by a file in host RAM and wiped on every stop; 0 = none.
+	EphemeralDisk int64 `json:"ephemeral_disk,omitempty"`
+
+	// Prealloc controls how much of the writable disk is allocated on the
+	// host at creation; empty = off (sparse).
+	Prealloc Prealloc `json:"prealloc,omitempty"`
+
+	// SSHKeys are the authorized_keys lines cloud-init installs in cloud
+	// images, for the default user and root.
+	SSHKeys []string `json:"ssh_keys,omitempty"`
+	// RootPasswordHash is the SHA-512 crypt hash of the random root
+	// password generated at create (config random_root_password).
+	RootPasswordHash string `json:"root_password_hash,omitempty"`
+
+	// Files are written into the guest: by cloud-init on first boot for
+	// cloud images, by the initramfs on every boot for OCI images.
+	Files []GuestFile `json:"files,omitempty"`
+	// Env holds KEY=VALUE variables set for the guest's services and
+	// login shells.
+	Env []string `json:"env,omitempty"`
+	// Timezone and Locale set the guest's clock zone and language;
+	// empty = the default_timezone / default_locale config.
+	Timezone string `json:"timezone,omitempty"`
+	Locale   string `json:"locale,omitempty"`
+	// RunCmds are shell commands cloud-init runs once on first boot.
+	RunCmds []string `json:"run_cmds,omitempty"`
+
+	// UserData is user-supplied cloud-init user-data for cloud images,
+	// merged into the generated #cloud-config, or replacing it when
+	// ReplaceUserData is set. Kept so regenerated cidata matches.
+	UserData        string `json:"user_data,omitempty"`
+	ReplaceUserData bool   `json:"replace_user_data,omitempty"`
+	// TemplateUserData expands UserData as a Go template each time the
+	// cidata is generated.
+	TemplateUserData bool `json:"template_user_data,omitempty"`
+	// MetadataFormat is the datasource layout of the cidata disk of
+	// cloud images; empty = NoCloud.
+	MetadataFormat MetadataFormat `json:"metadata_format,omitempty"`
+
+	// Swap attaches a disk of this many bytes that the guest swaps to,
+	// formatted afresh on every cold boot; 0 = none.
+	Swap int64 `json:"swap,omitempty"`
+
+	// DiskIOPS and DiskBandwidth cap the operations and bytes per second
+	// of each of the VM's disks; 0 = unlimited.
+	DiskIOPS      int64 `json:"disk_iops,omitempty"`
+	DiskBandwidth int64 `json:"disk_bandwidth,omitempty"`
+
+	// DiskBackend serves the writable disk from an external vhost-user-blk
+	// backend instead of the VMM's block layer; empty = builtin.
+	DiskBackend DiskBackend `json:"disk_backend,omitempty"`
+
+	// Serial and Console choose how the serial port and the virtio console
+	// are exposed; empty = the boot default (OCI: console pty, serial off;
+	// cloud image: serial socket, console off).
+	Serial  ConsoleMode `json:"serial,omitempty"`
+	Console ConsoleMode `json:"console,omitempty"`
+
+	// CmdlineAppend is appended to the kernel cmdline of direct-boot (OCI)
+	// VMs, after the arguments cocoon generates.
+	CmdlineAppend string `json:"cmdline_append,omitempty"`
+
+	// Firmware names a firmware store entry or a path to the UEFI firmware
+	// a cloud image boots with; empty = the default build.
+	Firmware string `json:"firmware,omitempty"`
+
+	Confidential ConfidentialMode `json:"confidential,omitempty"` // empty = regular VM
+
+	// CHBinary overrides the host's cloud-hypervisor binary for this VM;
+	// empty = the configured default.
+	CHBinary string `json:"ch_binary,omitempty"`
+
+	Labels map[string]string `json:"labels,omitempty"` // user metadata for filtering
+}
+
+// DiskThrottled reports whether the VM's disks are rate limited.
+func (cfg *VMConfig) DiskThrottled() bool {
+	return cfg.DiskIOPS > 0 || cfg.DiskBandwidth > 0
+}
+
+// GuestHostname returns the hostname the guest is given: Hostname, or
+// Name turned into a valid hostname label.
+func (cfg *VMConfig) GuestHostname() string {
+	if cfg.Hostname != "" {
+		return cfg.Hostname
+	}
+	h := strings.Map(func(r rune) rune {
+		if r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '-'
+	}, cfg.Name)
+	h = strings.Trim(h, "-")
+	if len(h) > 63 { //nolint:mnd
+		h = strings.TrimRight(h[:63], "-")
+	}
+	if h == "" {
+		return "cocoon"
+	}
+	return h
+}
+
+// FQDN returns the guest's fully qualified name, or "" without a Domain.
+func (cfg *VMConfig) FQDN() string {
+	if cfg.Domain == "" {
+		return ""
+	}
+	return cfg.GuestHostname() + "." + cfg.Domain
+}
+
+// validateHostname checks --hostname and --domain.
+func (cfg *VMConfig) validateHostname() error {
+	if cfg.Hostname != "" && !validLabel.MatchString(cfg.Hostname) {
+		return fmt.Errorf("--hostname %q is invalid: must be a single label of letters, digits and inner hyphens (max 63 chars)", cfg.Hostname)
+	}
+	if cfg.Domain == "" {
+		return nil
+	}
+	for label := range strings.SplitSeq(cfg.Domain, ".") {
+		if !validLabel.MatchString(label) {
+			return fmt.Errorf("--domain %q is invalid: label %q must be letters, digits and inner hyphens (max 63 chars)", cfg.Domain, label)
+		}
+	}
+	if fqdn := cfg.FQDN(); len(fqdn) > 253 { //nolint:mnd
+		return fmt.Errorf("FQDN %q exceeds 253 characters", fqdn)
+	}
+	return nil
 }
 
 // Validate checks that VMConfig fields are within acceptable ranges.
 func (cfg *VMConfig) Validate() error {
-	if cfg.Name == "" {
-		return fmt.Errorf("VM name cannot be empty")
+	if err := ValidateVMName(cfg.Name); err != nil {
+		return err
 	}
-	if !validName.MatchString(cfg.Name) {
-		return fmt.Errorf("VM name %q is invalid: must match %s (max 63 chars)", cfg.Name, validName.String())
+	if err := cfg.validateHostname(); err != nil {
+		return err
 	}
 	if cfg.CPU <= 0 {
 		return fmt.Errorf("--cpu must be at least 1, got %d", cfg.CPU)
 	}
+	if cfg.MaxCPU < 0 {
+		return fmt.Errorf("--max-cpu must not be negative, got %d", cfg.MaxCPU)
+	}
+	if cfg.MaxCPU > 0 && cfg.CPU > cfg.MaxCPU {
+		return fmt.Errorf("--cpu %d exceeds --max-cpu %d", cfg.CPU, cfg.MaxCPU)
+	}
 	if cfg.Memory < 512<<20 {
 		return fmt.Errorf("--memory must be at least 512M, got %d", cfg.Memory)
 	}
 	if cfg.Storage < 10<<30 {
 		return fmt.Errorf("--storage must be at least 10G, got %d", cfg.Storage)
 	}
+	if cfg.Swap < 0 {
+		return fmt.Errorf("--swap must not be negative, got %d", cfg.Swap)
+	}
+	if cfg.Swap > 0 && cfg.Swap < 40<<10 {
+		return fmt.Errorf("--swap must be at least 40K, got %d", cfg.Swap)
+	}
+	if cfg.EphemeralDisk < 0 {
+		return fmt.Errorf("--ephemeral-disk must not be negative, got %d", cfg.EphemeralDisk)
+	}
+	switch cfg.RestartPolicy {
+	case "", RestartPolicyNo, RestartPolicyAlways:
+	default:
+		return fmt.Errorf("--restart %q is invalid: must be %q or %q", cfg.RestartPolicy, RestartPolicyNo, RestartPolicyAlways)
+	}
+	if cfg.HealthCheck != nil {
+		if err := cfg.HealthCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.BootProbe != nil {
+		if err := cfg.BootProbe.Validate(); err != nil {
+			return err
+		}
+	}
+	if cfg.CPUSet != "" {
+		if _, err := ParseCPUSet(cfg.CPUSet); err != nil {
+			return fmt.Errorf("--%w", err)
+		}
+	}
+	if cfg.NUMA != nil {
+		if err := cfg.NUMA.Validate(cfg.CPU, cfg.Memory); err != nil {
+			return err
+		}
+	}
+	if err := cfg.Confidential.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := cfg.HugePages.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := cfg.Serial.ValidateSerial(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := cfg.Console.ValidateConsole(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if cfg.Pool != "" {
+		if err := ValidatePoolName(cfg.Pool); err != nil {
+			return fmt.Errorf("--pool: %w", err)
+		}
+	}
+	if cfg.ReadOnly && cfg.Encrypt {
+		return fmt.Errorf("--read-only cannot be combined with --encrypt: a pristine disk would need a new key on every start")
+	}
+	if cfg.DataDir != "" && !filepath.IsAbs(cfg.DataDir) {
+		return fmt.Errorf("--data-dir %q is invalid: must be an absolute path", cfg.DataDir)
+	}
+	if err := cfg.DiskBackend.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := cfg.MetadataFormat.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := validateEnv(cfg.Env); err != nil {
+		return err
+	}
+	if err := ValidateTimezone(cfg.Timezone); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := ValidateLocale(cfg.Locale); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := cfg.Prealloc.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if cfg.DiskIOPS < 0 {
+		return fmt.Errorf("--disk-iops must not be negative, got %d", cfg.DiskIOPS)
+	}
+	if cfg.DiskBandwidth < 0 {
+		return fmt.Errorf("--disk-bandwidth must not be negative, got %d", cfg.DiskBandwidth)
+	}
+	if cfg.DiskThrottled() && cfg.DiskBackend.VhostUser() {
+		return fmt.Errorf("--disk-iops and --disk-bandwidth cannot throttle disk backend %s", cfg.DiskBackend)
+	}
+	if err := cfg.Seccomp.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if err := cfg.Landlock.Validate(); err != nil {
+		return fmt.Errorf("--%w", err)
+	}
+	if strings.ContainsFunc(cfg.CmdlineAppend, unicode.IsControl) {
+		return fmt.Errorf("--cmdline-append %q is invalid: must not contain control characters", cfg.CmdlineAppend)
+	}
+	if cfg.IP != "" {
+		if ip := net.ParseIP(cfg.IP); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("--ip %q is invalid: want an IPv4 address", cfg.IP)
+		} else if !ip.IsGlobalUnicast() {
+			return fmt.Errorf("--ip %s is invalid: want a unicast address, not a loopback, link-local, multicast or broadcast one", cfg.IP)
+		}
+	}
+	if err := ValidateMTU(cfg.MTU); err != nil {
+		return fmt.Errorf("--mtu %w", err)
+	}
+	for _, id := range cfg.VLANs {
+		if err := ValidateVLAN(id); err != nil {
+			return fmt.Errorf("--vlan %w", err)
+		}
+	}
+	if _, err := ParseCNIArgs(cfg.CNIArgs); err != nil {
+		return fmt.Errorf("--cni-arg %w", err)
+	}
+	volumes := make([]string, len(cfg.Volumes))
+	for i, v := range cfg.Volumes {
+		volumes[i] = v.String()
+	}
+	if _, err := ParseVolumeAttachments(volumes); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(cfg.MACs))
+	for _, mac := range cfg.MACs {
+		if err := ValidateMAC(mac); err != nil {
+			return err
+		}
+		if seen[mac] {
+			return fmt.Errorf("--mac %s is given twice", mac)
+		}
+		seen[mac] = true
+	}
+	if err := ValidatePortMappings(cfg.Publish); err != nil {
+		return err
+	}
+	return ValidateLabels(cfg.Labels)
+}
+
+// NICNetwork returns the CNI conflist name for NIC i (empty = default).
+func (cfg *VMConfig) NICNetwork(i int) string {
+	if i < len(cfg.Networks) && cfg.Networks[i] != "" {
+		return cfg.Networks[i]
+	}
+	return cfg.Network
+}
+
+// NICMAC returns the pinned MAC of NIC i (empty = chosen by the network plugin).
+func (cfg *VMConfig) NICMAC(i int) string {
+	if i < len(cfg.MACs) {
+		return cfg.MACs[i]
+	}
+	return ""
+}
+
+// NICLimit returns the bandwidth cap of NIC i in bits per second (0 = unlimited).
+func (cfg *VMConfig) NICLimit(i int) uint64 {
+	switch {
+	case len(cfg.NetLimits) == 1:
+		return cfg.NetLimits[0]
+	case i < len(cfg.NetLimits):
+		return cfg.NetLimits[i]
+	}
+	return 0
+}
+
+// NICVLAN returns the VLAN ID of NIC i (0 = untagged).
+func (cfg *VMConfig) NICVLAN(i int) int {
+	switch {
+	case len(cfg.VLANs) == 1:
+		return cfg.VLANs[0]
+	case i < len(cfg.VLANs):
+		return cfg.VLANs[i]
+	}
+	return 0
+}
+
+// ValidateVMName checks that name is usable as a VM name.
+func ValidateVMName(name string) error {
+	if name == "" {
+		return fmt.Errorf("VM name cannot be empty")
+	}
+	if !validName.MatchString(name) {
+		return fmt.Errorf("VM name %q is invalid: must match %s (max 63 chars)", name, validName.String())
+	}
 	return nil
 }
 
+// GuestFile is a file placed in the guest ("--copy-in", "--env"). With
+// os.ModeSymlink in Mode it is a symlink to Content instead. A VM record
+// keeps the content in the host file Source rather than in Content.
+type GuestFile struct {
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	Content []byte      `json:"content,omitempty"`
+	Source  string      `json:"source,omitempty"`
+}
+
+// UsesCloudInit reports whether the config carries settings only
+// cloud-init applies, which OCI images do not run.
+func (cfg *VMConfig) UsesCloudInit() bool {
+	return cfg.UserData != "" || len(cfg.SSHKeys) > 0 || len(cfg.RunCmds) > 0 || cfg.MetadataFormat != ""
+}
+
+// HasGuestFiles reports whether files or environment variables are to be
+// placed in the guest, which OCI images get through their initramfs.
+func (cfg *VMConfig) HasGuestFiles() bool {
+	return len(cfg.Files) > 0 || len(cfg.Env) > 0
+}
+
+// validateEnv checks --env entries: a shell variable name, "=", and a
+// single-line value.
+func validateEnv(env []string) error {
+	for _, e := range env {
+		k, v, ok := strings.Cut(e, "=")
+		if !ok || !validEnvKey.MatchString(k) {
+			return fmt.Errorf("--env %q is invalid: want KEY=VALUE with KEY matching %s", e, validEnvKey)
+		}
+		if strings.ContainsAny(v, "\n\r\x00") {
+			return fmt.Errorf("--env %s: value must be a single line", k)
+		}
+	}
+	return nil
+}
+
+// ValidateTimezone checks a tz database name; empty is allowed.
+func ValidateTimezone(tz string) error {
+	if tz != "" && (!validTimezone.MatchString(tz) || len(tz) > 64) { //nolint:mnd
+		return fmt.Errorf("timezone %q is invalid: want a tz database name such as UTC or Europe/Berlin", tz)
+	}
+	return nil
+}
+
+// ValidateLocale checks a POSIX locale name; empty is allowed.
+func ValidateLocale(locale string) error {
+	if locale != "" && (!validLocale.MatchString(locale) || len(locale) > 64) { //nolint:mnd
+		return fmt.Errorf("locale %q is invalid: want a name such as en_US.UTF-8", locale)
+	}
+	return nil
+}
+
+// MetadataFormat selects the cloud-init datasource a cloud image's cidata
+// disk is laid out for.
+type MetadataFormat string
+
+const (
+	MetadataNoCloud     MetadataFormat = "nocloud"     // NoCloud files on a "CIDATA" volume (default)
+	MetadataConfigDrive MetadataFormat = "configdrive" // OpenStack ConfigDrive tree on a "CONFIG-2" volume
+)
+
+// Validate accepts the known formats; empty means nocloud.
+func (f MetadataFormat) Validate() error {
+	switch f {
+	case "", MetadataNoCloud, MetadataConfigDrive:
+		return nil
+	}
+	return fmt.Errorf("metadata-format %q is invalid: must be %q or %q", f, MetadataNoCloud, MetadataConfigDrive)
+}
+
+// VMMInfo identifies the hypervisor binary a VM was launched with.
+type VMMInfo struct {
+	Binary  string `json:"binary"`
+	Version string `json:"version,omitempty"` // as reported by the running VMM
+}
+
 // VM is the runtime record for a VM, persisted by the hypervisor backend.
 type VM struct {
 	ID     string   `json:"id"`
@@ -66,13 +568,48 @@ type VM struct {
 	// Used to skip cidata attachment on subsequent starts (cloudimg only).
 	FirstBooted bool `json:"first_booted"`
 
+	// VMM records the hypervisor binary of the latest launch, so a host
+	// upgrade does not change which binary a running VM is attributed to.
+	VMM *VMMInfo `json:"vmm,omitempty"`
+
+	// Health is the daemon's latest health check result; reset on start.
+	// nil when the VM has no health check or has not been probed yet.
+	Health *Health `json:"health,omitempty"`
+
+	// Error describes why the VM entered VMStateError, when known; it is
+	// cleared on the next state change.
+	Error string `json:"error,omitempty"`
+
 	// SnapshotIDs tracks snapshots created from this VM.
 	// Populated at runtime by toVM() from VMRecord.SnapshotIDs.
 	SnapshotIDs map[string]struct{} `json:"snapshot_ids,omitempty"`
 
+	// DiskSnapshots are the root disk save points, oldest first.
+	DiskSnapshots []DiskSnapshot `json:"disk_snapshots,omitempty"`
+
 	// Timestamps.
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	StartedAt *time.Time `json:"started_at,omitempty"`
 	StoppedAt *time.Time `json:"stopped_at,omitempty"`
 }
+
+// Redacted returns a copy of vm fit for inspect and API output: the
+// user-data, which often carries secrets, is replaced by its size.
+func (vm *VM) Redacted() *VM {
+	out := *vm
+	if out.Config.UserData != "" {
+		out.Config.UserData = fmt.Sprintf("<redacted: %d bytes>", len(out.Config.UserData))
+	}
+	return &out
+}
+
+// PrimaryIP returns the first guest IP address, or "" if none is assigned.
+func (vm *VM) PrimaryIP() string {
+	for _, nc := range vm.NetworkConfigs {
+		if nc != nil && nc.IP() != "" {
+			return nc.IP()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package types
+
+import "testing"
+
+func TestGuestHostname(t *testing.T) {
+	cases := []struct {
+		cfg        VMConfig
+		host, fqdn string
+	}{
+		{VMConfig{Name: "web"}, "web", ""},
+		{VMConfig{Name: "cocoon-ubuntu_24.04"}, "cocoon-ubuntu-24-04", ""},
+		{VMConfig{Name: "_tmp."}, "tmp", ""},
+		{VMConfig{Name: "__"}, "cocoon", ""},
+		{VMConfig{Name: "vm", Hostname: "web1", Domain: "example.com"}, "web1", "web1.example.com"},
+		{VMConfig{Name: "db.1", Domain: "lan"}, "db-1", "db-1.lan"},
+	}
+	for _, c := range cases {
+		if got := c.cfg.GuestHostname(); got != c.host {
+			t.Errorf("%+v: hostname %q, want %q", c.cfg, got, c.host)
+		}
+		if got := c.cfg.FQDN(); got != c.fqdn {
+			t.Errorf("%+v: FQDN %q, want %q", c.cfg, got, c.fqdn)
+		}
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	cases := []struct {
+		hostname, domain string
+		ok               bool
+	}{
+		{"", "", true},
+		{"web1", "example.com", true},
+		{"web-1", "", true},
+		{"web_1", "", false},
+		{"-web", "", false},
+		{"web.example", "", false},
+		{"web", "example..com", false},
+		{"web", "exa_mple.com", false},
+	}
+	for _, c := range cases {
+		cfg := &VMConfig{Name: "vm", Hostname: c.hostname, Domain: c.domain}
+		if err := cfg.validateHostname(); (err == nil) != c.ok {
+			t.Errorf("hostname %q domain %q: %v, want ok=%v", c.hostname, c.domain, err, c.ok)
+		}
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	cases := []struct {
+		env string
+		ok  bool
+	}{
+		{"FOO=bar", true},
+		{"_X1=", true},
+		{"URL=http://a/?b=c d", true},
+		{"FOO", false},
+		{"1FOO=bar", false},
+		{"FOO-BAR=1", false},
+		{"FOO=a\nb", false},
+	}
+	for _, c := range cases {
+		if err := validateEnv([]string{c.env}); (err == nil) != c.ok {
+			t.Errorf("env %q: %v, want ok=%v", c.env, err, c.ok)
+		}
+	}
+}
+
+func TestValidateTimezoneLocale(t *testing.T) {
+	for _, tz := range []string{"", "UTC", "Europe/Berlin", "America/Argentina/Buenos_Aires", "Etc/GMT+8"} {
+		if err := ValidateTimezone(tz); err != nil {
+			t.Errorf("timezone %q: %v", tz, err)
+		}
+	}
+	for _, tz := range []string{"../etc/passwd", "/UTC", "Europe//Berlin", "UTC "} {
+		if err := ValidateTimezone(tz); err == nil {
+			t.Errorf("timezone %q accepted", tz)
+		}
+	}
+	for _, l := range []string{"", "C", "C.UTF-8", "en_US.UTF-8", "de_DE.utf8@euro"} {
+		if err := ValidateLocale(l); err != nil {
+			t.Errorf("locale %q: %v", l, err)
+		}
+	}
+	for _, l := range []string{"en US", "en_US.UTF-8\n", "en_US/UTF-8"} {
+		if err := ValidateLocale(l); err == nil {
+			t.Errorf("locale %q accepted", l)
+		}
+	}
+}
+
+func TestValidateFixedIP(t *testing.T) {
+	cases := []struct {
+		ip string
+		ok bool
+	}{
+		{"", true},
+		{"10.89.1.8", true},
+		{"192.168.0.10", true},
+		{"fd00::8", false},
+		{"10.89.1", false},
+		{"not-an-ip", false},
+		{"0.0.0.0", false},
+		{"127.0.0.1", false},
+		{"169.254.1.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, c := range cases {
+		cfg := &VMConfig{Name: "vm", CPU: 1, Memory: 1 << 30, Storage: 10 << 30, IP: c.ip}
+		if err := cfg.Validate(); (err == nil) != c.ok {
+			t.Errorf("ip %q: %v, want ok=%v", c.ip, err, c.ok)
+		}
+	}
+}
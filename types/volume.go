@@ -0,0 +1,100 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MinVolumeSize is the smallest volume "volume create" accepts.
+const MinVolumeSize = 1 << 20
+
+// Filesystems "volume create --fs" can format a volume with.
+const (
+	VolumeFSNone = ""
+	VolumeFSExt4 = "ext4"
+	VolumeFSXFS  = "xfs"
+)
+
+// validVolumeTarget matches the guest device a volume is attached as.
+var validVolumeTarget = regexp.MustCompile(`^/dev/vd[a-z]{1,2}$`)
+
+// Volume is a named raw disk that lives independently of any VM: it is
+// attached to at most one VM at a time and survives that VM's deletion.
+type Volume struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"` // bytes
+	FS        string    `json:"fs,omitempty"`
+	Path      string    `json:"path"`
+	VMID      string    `json:"vm_id,omitempty"`  // VM the volume is attached to
+	Target    string    `json:"target,omitempty"` // guest device, e.g. /dev/vdc
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// VolumeAttachment is one "--volume NAME[:/dev/vdX]" of a VM.
+type VolumeAttachment struct {
+	Name   string `json:"name"`
+	Target string `json:"target,omitempty"` // empty = next free device
+}
+
+// ValidateVolumeName checks that name is usable as a volume name.
+func ValidateVolumeName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("volume name %q is invalid: must match %s (max 63 chars)", name, validName.String())
+	}
+	return nil
+}
+
+// ValidateVolumeTarget checks that target, if set, names a virtio disk.
+func ValidateVolumeTarget(target string) error {
+	if target != "" && !validVolumeTarget.MatchString(target) {
+		return fmt.Errorf("target %q must be a virtio disk such as /dev/vdc", target)
+	}
+	return nil
+}
+
+// ParseVolumeAttachments parses repeated --volume flags of the form
+// "NAME[:/dev/vdX]".
+func ParseVolumeAttachments(specs []string) ([]VolumeAttachment, error) {
+	var out []VolumeAttachment
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		name, target, _ := strings.Cut(spec, ":")
+		if err := ValidateVolumeName(name); err != nil {
+			return nil, fmt.Errorf("--volume %q: %w", spec, err)
+		}
+		if err := ValidateVolumeTarget(target); err != nil {
+			return nil, fmt.Errorf("--volume %q: %w", spec, err)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("--volume %s is given twice", name)
+		}
+		if target != "" && seen[target] {
+			return nil, fmt.Errorf("--volume target %s is given twice", target)
+		}
+		seen[name], seen[target] = true, target != ""
+		out = append(out, VolumeAttachment{Name: name, Target: target})
+	}
+	return out, nil
+}
+
+// String renders the attachment in --volume form.
+func (a VolumeAttachment) String() string {
+	if a.Target == "" {
+		return a.Name
+	}
+	return a.Name + ":" + a.Target
+}
+
+// VirtioDiskName returns the Linux name of the i-th (0-based) virtio-blk
+// disk: vda..vdz, then vdaa, vdab, ...
+func VirtioDiskName(i int) string {
+	const letters = 26
+	name := ""
+	for i++; i > 0; i = (i - 1) / letters {
+		name = string(rune('a'+(i-1)%letters)) + name
+	}
+	return "/dev/vd" + name
+}
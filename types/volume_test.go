@@ -0,0 +1,42 @@
+package types
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseVolumeAttachments(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		want    []VolumeAttachment
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "name only", specs: []string{"data"}, want: []VolumeAttachment{{Name: "data"}}},
+		{name: "with target", specs: []string{"data:/dev/vdc", "logs"}, want: []VolumeAttachment{{Name: "data", Target: "/dev/vdc"}, {Name: "logs"}}},
+		{name: "bad name", specs: []string{"-data"}, wantErr: true},
+		{name: "bad target", specs: []string{"data:/dev/sda"}, wantErr: true},
+		{name: "duplicate name", specs: []string{"data", "data:/dev/vdc"}, wantErr: true},
+		{name: "duplicate target", specs: []string{"a:/dev/vdc", "b:/dev/vdc"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVolumeAttachments(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseVolumeAttachments() = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseVolumeAttachments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVirtioDiskName(t *testing.T) {
+	for i, want := range map[int]string{0: "/dev/vda", 2: "/dev/vdc", 25: "/dev/vdz", 26: "/dev/vdaa", 27: "/dev/vdab"} {
+		if got := VirtioDiskName(i); got != want {
+			t.Errorf("VirtioDiskName(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
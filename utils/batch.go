@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 )
 
 // BatchResult holds the outcome of a best-effort batch operation.
@@ -28,3 +29,34 @@ func ForEach(ctx context.Context, ids []string, fn func(context.Context, string)
 	}
 	return r
 }
+
+// ForEachParallel is ForEach with up to n calls in flight. Ids are
+// dispatched in order and results keep the order of ids; n <= 1 runs them
+// one by one.
+func ForEachParallel(ctx context.Context, ids []string, n int, fn func(context.Context, string) error) BatchResult {
+	if n <= 1 {
+		return ForEach(ctx, ids, fn)
+	}
+	errs := make([]error, len(ids))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = fn(ctx, id)
+		}()
+	}
+	wg.Wait()
+
+	var r BatchResult
+	for i, id := range ids {
+		if errs[i] != nil {
+			r.Errors = append(r.Errors, fmt.Errorf("%s: %w", id, errs[i]))
+			continue
+		}
+		r.Succeeded = append(r.Succeeded, id)
+	}
+	return r
+}
@@ -3,7 +3,10 @@ package utils
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestForEach_AllSucceed(t *testing.T) {
@@ -79,3 +82,33 @@ func TestBatchResult_Err_NilForNoErrors(t *testing.T) {
 		t.Errorf("expected nil, got %v", r.Err())
 	}
 }
+
+func TestForEachParallel(t *testing.T) {
+	ids := []string{"a", "fail", "c", "d", "e"}
+	var inFlight, peak atomic.Int32
+	result := ForEachParallel(context.Background(), ids, 2, func(_ context.Context, id string) error {
+		cur := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if cur <= old || peak.CompareAndSwap(old, cur) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if id == "fail" {
+			return fmt.Errorf("error on %s", id)
+		}
+		return nil
+	})
+
+	if got := strings.Join(result.Succeeded, ","); got != "a,c,d,e" {
+		t.Errorf("succeeded: got %s, want input order a,c,d,e", got)
+	}
+	if len(result.Errors) != 1 {
+		t.Errorf("errors: got %d, want 1", len(result.Errors))
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("peak concurrency %d exceeds limit 2", p)
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CgroupRoot is the mount point of the cgroup v2 unified hierarchy.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUPeriod is the cpu.max period in microseconds (the kernel default).
+const cgroupCPUPeriod = 100000
+
+// CgroupLimits are cgroup v2 controller settings for one cgroup. Zero
+// values leave the corresponding limit at the kernel default (unlimited).
+type CgroupLimits struct {
+	CPUs      float64 // cpu.max, in CPUs
+	MemoryMax int64   // memory.max, bytes
+	IOWeight  int     // io.weight, 1-10000
+
+	// IODevice ("major:minor") is the block device IOReadBPS and
+	// IOWriteBPS apply to via io.max.
+	IODevice   string
+	IOReadBPS  int64
+	IOWriteBPS int64
+}
+
+// files renders the limits as controller interface file → content.
+func (l CgroupLimits) files() map[string]string {
+	files := make(map[string]string)
+	if l.CPUs > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(l.CPUs*cgroupCPUPeriod), cgroupCPUPeriod)
+	}
+	if l.MemoryMax > 0 {
+		files["memory.max"] = strconv.FormatInt(l.MemoryMax, 10)
+	}
+	if l.IOWeight > 0 {
+		files["io.weight"] = fmt.Sprintf("default %d", l.IOWeight)
+	}
+	if l.IODevice != "" && (l.IOReadBPS > 0 || l.IOWriteBPS > 0) {
+		files["io.max"] = fmt.Sprintf("%s rbps=%s wbps=%s", l.IODevice, cgroupMax(l.IOReadBPS), cgroupMax(l.IOWriteBPS))
+	}
+	return files
+}
+
+func cgroupMax(v int64) string {
+	if v <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// parseFlatKeyed parses a cgroup flat-keyed file ("key value" per line)
+// into out, prefixing every key. Non-numeric values are skipped.
+func parseFlatKeyed(data, prefix string, out map[string]uint64) {
+	for line := range strings.SplitSeq(data, "\n") {
+		key, val, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(val, 10, 64); err == nil {
+			out[prefix+key] = n
+		}
+	}
+}
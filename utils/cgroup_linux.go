@@ -0,0 +1,135 @@
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupControllers are delegated down to every cgroup cocoon creates.
+var cgroupControllers = []string{"cpu", "memory", "io"}
+
+// SetupCgroup creates the cgroup at path (an absolute path under
+// CgroupRoot), enables the cpu, memory and io controllers along its
+// parent chain, and applies limits. An existing cgroup is reused.
+func SetupCgroup(path string, limits CgroupLimits) error {
+	if _, err := os.Stat(filepath.Join(CgroupRoot, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at %s: %w", CgroupRoot, err)
+	}
+	rel, err := filepath.Rel(CgroupRoot, filepath.Dir(path))
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("cgroup %s is outside %s", path, CgroupRoot)
+	}
+
+	dir := CgroupRoot
+	enableControllers(dir)
+	if rel != "." {
+		for part := range strings.SplitSeq(rel, string(filepath.Separator)) {
+			dir = filepath.Join(dir, part)
+			if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) { //nolint:mnd
+				return fmt.Errorf("create cgroup %s: %w", dir, err)
+			}
+			enableControllers(dir)
+		}
+	}
+	if err := os.Mkdir(path, 0o755); err != nil && !os.IsExist(err) { //nolint:mnd
+		return fmt.Errorf("create cgroup %s: %w", path, err)
+	}
+
+	for name, content := range limits.files() {
+		if err := os.WriteFile(filepath.Join(path, name), []byte(content), 0o644); err != nil { //nolint:gosec,mnd
+			return fmt.Errorf("set %s in %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+// enableControllers delegates cgroupControllers to dir's children one by
+// one, so an unavailable controller does not block the others; a missing
+// controller surfaces later when its limit file cannot be written.
+func enableControllers(dir string) {
+	for _, c := range cgroupControllers {
+		_ = os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+c), 0o644) //nolint:gosec,mnd
+	}
+}
+
+// StartInCgroup starts cmd inside the cgroup at path (clone3 with
+// CLONE_INTO_CGROUP), so the process never runs outside it, not even
+// between fork and exec. An empty path starts cmd where it is.
+func StartInCgroup(cmd *exec.Cmd, path string) error {
+	if path == "" {
+		return cmd.Start()
+	}
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open cgroup %s: %w", path, err)
+	}
+	defer unix.Close(fd) //nolint:errcheck
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+	return cmd.Start()
+}
+
+// RemoveCgroup removes the cgroup at path once its processes have exited.
+// A missing cgroup is not an error.
+func RemoveCgroup(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove cgroup %s: %w", path, err)
+	}
+	return nil
+}
+
+// CgroupStats returns the usage counters of the cgroup at path: cpu.stat
+// (cpu_*), memory.events (memory_events_*) and memory.current.
+func CgroupStats(path string) (map[string]uint64, error) {
+	stats := make(map[string]uint64)
+	cpu, err := os.ReadFile(filepath.Join(path, "cpu.stat")) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	parseFlatKeyed(string(cpu), "cpu_", stats)
+	if events, err := os.ReadFile(filepath.Join(path, "memory.events")); err == nil { //nolint:gosec
+		parseFlatKeyed(string(events), "memory_events_", stats)
+	}
+	if cur, err := os.ReadFile(filepath.Join(path, "memory.current")); err == nil { //nolint:gosec
+		if n, err := strconv.ParseUint(strings.TrimSpace(string(cur)), 10, 64); err == nil {
+			stats["memory_current"] = n
+		}
+	}
+	return stats, nil
+}
+
+// BlockDevice returns the "major:minor" of the whole disk backing the
+// filesystem that holds path; partitions resolve to their parent disk,
+// since io.max only accepts whole devices.
+func BlockDevice(path string) (string, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return "", fmt.Errorf("stat %s: %w", path, err)
+	}
+	dev := fmt.Sprintf("%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev))
+	sysDir := filepath.Join("/sys/dev/block", dev)
+	if _, err := os.Stat(sysDir); err != nil {
+		return "", fmt.Errorf("%s is not on a block device (%s)", path, dev)
+	}
+	if _, err := os.Stat(filepath.Join(sysDir, "partition")); err != nil {
+		return dev, nil
+	}
+	parent, err := os.ReadFile(filepath.Join(sysDir, "..", "dev")) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("resolve parent disk of %s: %w", dev, err)
+	}
+	return strings.TrimSpace(string(parent)), nil
+}
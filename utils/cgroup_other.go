@@ -0,0 +1,30 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errNoCgroups = errors.New("cgroups require Linux")
+
+// SetupCgroup is not supported on non-Linux platforms.
+func SetupCgroup(_ string, _ CgroupLimits) error { return errNoCgroups }
+
+// StartInCgroup starts cmd; a cgroup is not supported on non-Linux platforms.
+func StartInCgroup(cmd *exec.Cmd, path string) error {
+	if path != "" {
+		return errNoCgroups
+	}
+	return cmd.Start()
+}
+
+// RemoveCgroup is a no-op on non-Linux platforms.
+func RemoveCgroup(_ string) error { return nil }
+
+// CgroupStats is not supported on non-Linux platforms.
+func CgroupStats(_ string) (map[string]uint64, error) { return nil, errNoCgroups }
+
+// BlockDevice is not supported on non-Linux platforms.
+func BlockDevice(_ string) (string, error) { return "", errNoCgroups }
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestCgroupLimitsFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits CgroupLimits
+		want   map[string]string
+	}{
+		{"unlimited", CgroupLimits{}, map[string]string{}},
+		{
+			"cpu and memory",
+			CgroupLimits{CPUs: 2.5, MemoryMax: 1 << 30},
+			map[string]string{"cpu.max": "250000 100000", "memory.max": "1073741824"},
+		},
+		{
+			"io",
+			CgroupLimits{IOWeight: 200, IODevice: "8:0", IOWriteBPS: 1 << 20},
+			map[string]string{"io.weight": "default 200", "io.max": "8:0 rbps=max wbps=1048576"},
+		},
+		{"io.max without device", CgroupLimits{IOReadBPS: 1 << 20}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.files(); !maps.Equal(got, tt.want) {
+				t.Errorf("files() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFlatKeyed(t *testing.T) {
+	got := make(map[string]uint64)
+	parseFlatKeyed("usage_usec 1200\nnr_throttled 3\nbogus x\n\n", "cpu_", got)
+	want := map[string]uint64{"cpu_usage_usec": 1200, "cpu_nr_throttled": 3}
+	if !maps.Equal(got, want) {
+		t.Errorf("parseFlatKeyed = %v, want %v", got, want)
+	}
+}
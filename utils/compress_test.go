@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	for _, name := range []string{"b.tar.zst", "b.tar.gz", "b.tar"} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := CompressWriter(&buf, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte("payload")); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if name == "b.tar" && buf.String() != "payload" {
+				t.Errorf("plain output = %q", buf.String())
+			}
+			r, err := DecompressReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close() //nolint:errcheck
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "payload" {
+				t.Errorf("got %q, want %q", got, "payload")
+			}
+		})
+	}
+}
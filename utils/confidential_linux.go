@@ -0,0 +1,26 @@
+//go:build linux
+
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// DetectSEVSNP reports whether KVM on this host can launch AMD SEV-SNP
+// guests. Returns false on any error.
+func DetectSEVSNP() bool { return kvmParamEnabled("/sys/module/kvm_amd/parameters/sev_snp") }
+
+// DetectTDX reports whether KVM on this host can launch Intel TDX guests.
+// Returns false on any error.
+func DetectTDX() bool { return kvmParamEnabled("/sys/module/kvm_intel/parameters/tdx") }
+
+// kvmParamEnabled reads a boolean kernel module parameter ("Y"/"1").
+func kvmParamEnabled(path string) bool {
+	data, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return false
+	}
+	v := strings.TrimSpace(string(data))
+	return v == "Y" || v == "1"
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package utils
+
+// DetectSEVSNP returns false on non-Linux platforms.
+func DetectSEVSNP() bool { return false }
+
+// DetectTDX returns false on non-Linux platforms.
+func DetectTDX() bool { return false }
@@ -0,0 +1,26 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// OnlineCPUs returns the host's online CPUs as a Linux CPU list ("0-7"),
+// read from /sys/devices/system/cpu/online. Falls back to 0..NumCPU-1.
+func OnlineCPUs() string {
+	data, err := os.ReadFile("/sys/devices/system/cpu/online")
+	if err != nil || strings.TrimSpace(string(data)) == "" {
+		return fmt.Sprintf("0-%d", runtime.NumCPU()-1)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// NUMANodeExists reports whether host NUMA node n is present in sysfs.
+func NUMANodeExists(n int) bool {
+	_, err := os.Stat(fmt.Sprintf("/sys/devices/system/node/node%d", n))
+	return err == nil
+}
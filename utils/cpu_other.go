@@ -0,0 +1,14 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// OnlineCPUs returns 0..NumCPU-1 as a CPU list on non-Linux platforms.
+func OnlineCPUs() string { return fmt.Sprintf("0-%d", runtime.NumCPU()-1) }
+
+// NUMANodeExists treats non-Linux hosts as a single node 0.
+func NUMANodeExists(n int) bool { return n == 0 }
@@ -24,6 +24,34 @@ func EnsureDirs(dirs ...string) error {
 	return nil
 }
 
+// EnforcePerm gives path the group gid (gid < 0 keeps it) and the
+// permission bits perm, then verifies the mode took. Symlinks are refused
+// so a link swapped in for a socket cannot redirect the change.
+func EnforcePerm(path string, gid int, perm os.FileMode) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symlink", path)
+	}
+	if gid >= 0 {
+		if err := os.Lchown(path, -1, gid); err != nil {
+			return fmt.Errorf("chown %s: %w", path, err)
+		}
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		return fmt.Errorf("chmod %s: %w", path, err)
+	}
+	if fi, err = os.Lstat(path); err != nil {
+		return err
+	}
+	if got := fi.Mode().Perm(); got != perm {
+		return fmt.Errorf("%s has mode %o after chmod, want %o", path, got, perm)
+	}
+	return nil
+}
+
 // ValidFile returns true if path is a regular file with size > 0.
 func ValidFile(path string) bool {
 	info, err := os.Stat(path)
@@ -116,3 +144,33 @@ func RemoveMatching(ctx context.Context, dir string, match func(os.DirEntry) boo
 	}
 	return errs
 }
+
+// DirUsage returns the bytes the regular files under dir occupy on disk.
+// A missing dir uses nothing.
+func DirUsage(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		n, err := AllocatedSize(path)
+		if err != nil {
+			if os.IsNotExist(err) { // removed while walking
+				return nil
+			}
+			return err
+		}
+		total += n
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("usage of %s: %w", dir, err)
+	}
+	return total, nil
+}
@@ -59,6 +59,47 @@ func TestEnsureDirs_FailsUnderFile(t *testing.T) {
 	}
 }
 
+// --- EnforcePerm ---
+
+func TestEnforcePerm(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "api.sock")
+	os.WriteFile(file, nil, 0o755) //nolint:errcheck,gosec
+
+	if err := EnforcePerm(file, os.Getegid(), 0o660); err != nil {
+		t.Fatalf("EnforcePerm: %v", err)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o660 {
+		t.Errorf("mode = %o, want 660", fi.Mode().Perm())
+	}
+}
+
+func TestEnforcePerm_RefusesSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	os.WriteFile(target, nil, 0o644) //nolint:errcheck,gosec
+	link := filepath.Join(dir, "api.sock")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnforcePerm(link, -1, 0o600); err == nil {
+		t.Fatal("expected error for symlink")
+	}
+	if fi, _ := os.Stat(target); fi.Mode().Perm() != 0o644 {
+		t.Errorf("symlink target mode changed to %o", fi.Mode().Perm())
+	}
+}
+
+func TestEnforcePerm_Missing(t *testing.T) {
+	if err := EnforcePerm(filepath.Join(t.TempDir(), "missing"), -1, 0o600); !os.IsNotExist(err) {
+		t.Fatalf("EnforcePerm on missing path = %v, want not-exist", err)
+	}
+}
+
 // --- ValidFile ---
 
 func TestValidFile_RegularFile(t *testing.T) {
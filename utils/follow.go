@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+const followPollInterval = 250 * time.Millisecond
+
+// FollowFile copies data appended to path after offset into w until ctx is
+// canceled, like tail -f. A file that shrinks (truncated on VM restart) is
+// re-read from the start; a file that does not exist yet is waited for.
+func FollowFile(ctx context.Context, path string, offset int64, w io.Writer) error {
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	for {
+		n, err := copyFrom(path, offset, w)
+		switch {
+		case err == nil:
+			offset = n
+		case errors.Is(err, errTruncated):
+			offset = 0
+			continue
+		case !os.IsNotExist(err):
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+var errTruncated = errors.New("file truncated")
+
+// copyFrom copies path from offset to EOF into w and returns the new offset.
+func copyFrom(path string, offset int64, w io.Writer) (int64, error) {
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close() //nolint:errcheck
+	fi, err := f.Stat()
+	if err != nil {
+		return offset, err
+	}
+	if fi.Size() < offset {
+		return 0, errTruncated
+	}
+	if fi.Size() == offset {
+		return offset, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	n, err := io.Copy(w, f)
+	return offset + n, err
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for one writer and one reader goroutine.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestFollowFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ch.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	var out syncBuffer
+	done := make(chan error, 1)
+	go func() { done <- FollowFile(ctx, path, 4, &out) }()
+
+	waitOutput := func(want string) {
+		t.Helper()
+		if err := WaitFor(t.Context(), 5*time.Second, 10*time.Millisecond, func() (bool, error) {
+			return strings.Contains(out.String(), want), nil
+		}); err != nil {
+			t.Fatalf("waiting for %q: %v (got %q)", want, err, out.String())
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("appended\n")
+	_ = f.Close()
+	waitOutput("appended\n")
+
+	// Truncate and rewrite, as a VM restart does.
+	if err := os.WriteFile(path, []byte("new\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitOutput("new\n")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("FollowFile: %v", err)
+	}
+	if strings.Contains(out.String(), "old") {
+		t.Errorf("content before offset was copied: %q", out.String())
+	}
+}
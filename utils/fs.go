@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// FSAvailable returns the bytes available to unprivileged users on the
+// filesystem holding path.
+func FSAvailable(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil //nolint:gosec,unconvert // Bsize is uint32 on darwin
+}
@@ -3,6 +3,7 @@
 package utils
 
 import (
+	"bufio"
 	"os"
 	"strconv"
 	"strings"
@@ -19,3 +20,41 @@ func DetectHugePages() bool {
 	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
 	return err == nil && n > 0
 }
+
+// HugePagesAvailable returns the bytes of the default-size hugepage pool
+// that are neither in use nor reserved, from /proc/meminfo.
+// Returns 0 on any error.
+func HugePagesAvailable() int64 {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	return parseHugePagesAvailable(string(data))
+}
+
+func parseHugePagesAvailable(meminfo string) int64 {
+	var free, rsvd, sizeKB int64
+	scanner := bufio.NewScanner(strings.NewReader(meminfo))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 { //nolint:mnd
+			continue
+		}
+		v, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "HugePages_Free:":
+			free = v
+		case "HugePages_Rsvd:":
+			rsvd = v
+		case "Hugepagesize:":
+			sizeKB = v
+		}
+	}
+	if free <= rsvd {
+		return 0
+	}
+	return (free - rsvd) * sizeKB << 10 //nolint:mnd
+}
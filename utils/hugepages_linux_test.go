@@ -0,0 +1,25 @@
+//go:build linux
+
+package utils
+
+import "testing"
+
+func TestParseHugePagesAvailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		meminfo string
+		want    int64
+	}{
+		{"free", "HugePages_Total:    1024\nHugePages_Free:     512\nHugePages_Rsvd:       0\nHugepagesize:       2048 kB\n", 512 * 2 << 20},
+		{"reserved", "HugePages_Free:     512\nHugePages_Rsvd:     500\nHugepagesize:       2048 kB\n", 12 * 2 << 20},
+		{"exhausted", "HugePages_Free:       4\nHugePages_Rsvd:       4\nHugepagesize:       2048 kB\n", 0},
+		{"none", "MemTotal:       16384 kB\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseHugePagesAvailable(tt.meminfo); got != tt.want {
+				t.Errorf("parseHugePagesAvailable() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
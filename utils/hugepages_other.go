@@ -5,3 +5,6 @@ package utils
 // DetectHugePages returns false on non-Linux platforms where
 // /proc/sys/vm/nr_hugepages is not available.
 func DetectHugePages() bool { return false }
+
+// HugePagesAvailable returns 0 on non-Linux platforms.
+func HugePagesAvailable() int64 { return 0 }
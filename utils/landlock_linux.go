@@ -0,0 +1,19 @@
+//go:build linux
+
+package utils
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// DetectLandlock reports whether the Landlock LSM is active on the host,
+// according to /sys/kernel/security/lsm. Returns false on any error.
+func DetectLandlock() bool {
+	data, err := os.ReadFile("/sys/kernel/security/lsm")
+	if err != nil {
+		return false
+	}
+	return slices.Contains(strings.Split(strings.TrimSpace(string(data)), ","), "landlock")
+}
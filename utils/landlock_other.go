@@ -0,0 +1,6 @@
+//go:build !linux
+
+package utils
+
+// DetectLandlock returns false on non-Linux platforms, which have no Landlock LSM.
+func DetectLandlock() bool { return false }
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// logBackupTimeFormat matches lumberjack's backup naming so rotated segments
+// look the same as cocoon's own rotated logs.
+const logBackupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateLog moves path aside as a timestamped backup when it is non-empty
+// and at least maxSize bytes. When live is true another process still has
+// path open (with O_APPEND), so the content is copied and path truncated in
+// place instead of renamed. Reports whether a rotation happened.
+func RotateLog(path string, maxSize int64, live bool) (bool, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() == 0 || fi.Size() < maxSize {
+		return false, nil
+	}
+	backup := logBackupName(path, time.Now())
+	if !live {
+		return true, os.Rename(path, backup)
+	}
+	if err := copyFile(path, backup); err != nil {
+		return false, fmt.Errorf("copy %s: %w", path, err)
+	}
+	return true, os.Truncate(path, 0)
+}
+
+// ExpiredLogBackups returns rotated segments of path that are older than
+// maxAge or beyond the newest maxBackups. Zero disables either limit.
+func ExpiredLogBackups(path string, maxAge time.Duration, maxBackups int, now time.Time) ([]string, error) {
+	prefix, ext := logBackupParts(path)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	type backup struct {
+		path string
+		at   time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		stamp, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if stamp, ok = strings.CutSuffix(stamp, ext); !ok {
+			continue
+		}
+		at, err := time.ParseInLocation(logBackupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(filepath.Dir(path), e.Name()), at: at})
+	}
+	slices.SortFunc(backups, func(a, b backup) int { return b.at.Compare(a.at) }) // newest first
+
+	var expired []string
+	for i, b := range backups {
+		if (maxBackups > 0 && i >= maxBackups) || (maxAge > 0 && now.Sub(b.at) > maxAge) {
+			expired = append(expired, b.path)
+		}
+	}
+	return expired, nil
+}
+
+// logBackupName returns "<dir>/<name>-<timestamp><ext>" for path "<dir>/<name><ext>".
+func logBackupName(path string, t time.Time) string {
+	prefix, ext := logBackupParts(path)
+	return filepath.Join(filepath.Dir(path), prefix+t.Format(logBackupTimeFormat)+ext)
+}
+
+func logBackupParts(path string) (prefix, ext string) {
+	base := filepath.Base(path)
+	ext = filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-", ext
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o640) //nolint:gosec,mnd
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
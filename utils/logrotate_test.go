@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRotateLog(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		maxSize     int64
+		live        bool
+		wantRotated bool
+	}{
+		{name: "missing", maxSize: 0},
+		{name: "empty", content: "", maxSize: 0},
+		{name: "below limit", content: "abc", maxSize: 10},
+		{name: "rename", content: "abc", maxSize: 0, wantRotated: true},
+		{name: "copy-truncate", content: "abcdef", maxSize: 4, live: true, wantRotated: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "ch.log")
+			if tt.name != "missing" {
+				if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rotated, err := RotateLog(path, tt.maxSize, tt.live)
+			if err != nil {
+				t.Fatalf("RotateLog: %v", err)
+			}
+			if rotated != tt.wantRotated {
+				t.Fatalf("rotated = %v, want %v", rotated, tt.wantRotated)
+			}
+			backups, _ := filepath.Glob(filepath.Join(dir, "ch-*.log"))
+			if !tt.wantRotated {
+				if len(backups) != 0 {
+					t.Errorf("unexpected backups %v", backups)
+				}
+				return
+			}
+			if len(backups) != 1 {
+				t.Fatalf("expected 1 backup, got %v", backups)
+			}
+			if data, _ := os.ReadFile(backups[0]); string(data) != tt.content {
+				t.Errorf("backup content %q, want %q", data, tt.content)
+			}
+			fi, err := os.Stat(path)
+			if tt.live {
+				if err != nil || fi.Size() != 0 {
+					t.Errorf("live log should be truncated in place: %v", err)
+				}
+			} else if !os.IsNotExist(err) {
+				t.Errorf("log should have been renamed away: %v", err)
+			}
+		})
+	}
+}
+
+func TestExpiredLogBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ch.log")
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	var names []string
+	for _, age := range []time.Duration{time.Hour, 24 * time.Hour, 48 * time.Hour, 40 * 24 * time.Hour} {
+		name := logBackupName(path, now.Add(-age))
+		names = append(names, name)
+		if err := os.WriteFile(name, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Unrelated files are never returned.
+	for _, other := range []string{"ch.log", "ch-garbage.log", "other-2026-01-01T00-00-00.000.log"} {
+		if err := os.WriteFile(filepath.Join(dir, other), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		maxAge     time.Duration
+		maxBackups int
+		want       []string
+	}{
+		{name: "no limits"},
+		{name: "max backups", maxBackups: 2, want: names[2:]},
+		{name: "max age", maxAge: 30 * 24 * time.Hour, want: names[3:]},
+		{name: "both", maxAge: 36 * time.Hour, maxBackups: 3, want: names[2:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpiredLogBackups(path, tt.maxAge, tt.maxBackups, now)
+			if err != nil {
+				t.Fatalf("ExpiredLogBackups: %v", err)
+			}
+			slices.Sort(got)
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
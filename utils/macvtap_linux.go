@@ -0,0 +1,58 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// OpenMacvtap opens n queues of the macvtap link name through its
+// /dev/tap<ifindex> character device, creating the node when udev has not.
+func OpenMacvtap(name string, n int) ([]*os.File, error) {
+	sysDir := filepath.Join("/sys/class/net", name)
+	data, err := os.ReadFile(filepath.Join(sysDir, "ifindex")) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("find macvtap %s: %w", name, err)
+	}
+	ifindex := strings.TrimSpace(string(data))
+	devPath := "/dev/tap" + ifindex
+	if _, statErr := os.Stat(devPath); os.IsNotExist(statErr) {
+		if err := mknodMacvtap(devPath, filepath.Join(sysDir, "macvtap", "tap"+ifindex, "dev")); err != nil {
+			return nil, fmt.Errorf("create %s for %s: %w", devPath, name, err)
+		}
+	}
+	files := make([]*os.File, 0, n)
+	for range n {
+		f, err := os.OpenFile(devPath, os.O_RDWR, 0) //nolint:gosec
+		if err != nil {
+			for _, opened := range files {
+				_ = opened.Close()
+			}
+			return nil, fmt.Errorf("open %s: %w", devPath, err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// mknodMacvtap creates the character device at path from the "major:minor"
+// in sysDev.
+func mknodMacvtap(path, sysDev string) error {
+	data, err := os.ReadFile(sysDev) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	var major, minor uint32
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(data)), "%d:%d", &major, &minor); err != nil {
+		return fmt.Errorf("parse %s: %w", sysDev, err)
+	}
+	if err := unix.Mknod(path, unix.S_IFCHR|0o600, int(unix.Mkdev(major, minor))); err != nil && !os.IsExist(err) { //nolint:gosec,mnd
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+)
+
+// OpenMacvtap is not supported on non-Linux platforms.
+func OpenMacvtap(string, int) ([]*os.File, error) {
+	return nil, errors.New("macvtap is only supported on Linux")
+}
@@ -31,3 +31,12 @@ func MergeSets[K comparable](sets ...map[K]struct{}) map[K]struct{} {
 	}
 	return out
 }
+
+// SetOf returns the set of keys.
+func SetOf[K comparable](keys []K) map[K]struct{} {
+	out := make(map[K]struct{}, len(keys))
+	for _, k := range keys {
+		out[k] = struct{}{}
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/vishvananda/netns"
+)
+
+// EnterNetns locks the OS thread, saves the current netns, and switches
+// to the target netns. The forked child process inherits the new netns.
+// Returns a restore function that must be deferred by the caller.
+// No global state — safe for concurrent use.
+func EnterNetns(nsPath string) (restore func(), err error) {
+	runtime.LockOSThread()
+
+	orig, err := netns.Get()
+	if err != nil {
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("get current netns: %w", err)
+	}
+
+	target, err := netns.GetFromPath(nsPath)
+	if err != nil {
+		_ = orig.Close()
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("open netns %s: %w", nsPath, err)
+	}
+	defer target.Close() //nolint:errcheck
+
+	if err := netns.Set(target); err != nil {
+		_ = orig.Close()
+		runtime.UnlockOSThread()
+		return nil, fmt.Errorf("setns %s: %w", nsPath, err)
+	}
+
+	return func() {
+		_ = netns.Set(orig)
+		_ = orig.Close()
+		runtime.UnlockOSThread()
+	}, nil
+}
@@ -100,6 +100,19 @@ func TerminateProcess(ctx context.Context, pid int, binaryName, expectArg string
 	return killAndWait(ctx, proc, pid)
 }
 
+// KillProcess verifies the PID belongs to binaryName (with optional cmdline
+// arg check), then sends SIGKILL immediately and waits for it to exit.
+func KillProcess(ctx context.Context, pid int, binaryName, expectArg string) error {
+	if !VerifyProcessCmdline(pid, binaryName, expectArg) {
+		return nil
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("find process %d: %w", pid, err)
+	}
+	return killAndWait(ctx, proc, pid)
+}
+
 func killAndWait(ctx context.Context, proc *os.Process, pid int) error {
 	_ = proc.Kill()
 	return WaitFor(ctx, killWaitTimeout, 50*time.Millisecond, func() (bool, error) { //nolint:mnd
@@ -308,3 +308,29 @@ func TestTerminateProcess_ContextCancelled(t *testing.T) {
 	// It may return context error from WaitFor, but the process should be killed.
 	_ = TerminateProcess(ctx, pid, "sleep", "60", 100*time.Millisecond)
 }
+
+// --- KillProcess ---
+
+func TestKillProcess(t *testing.T) {
+	cmd := exec.Command("sleep", "300")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	pid := cmd.Process.Pid
+	// Reap in the background so the killed child does not linger as a zombie.
+	go cmd.Wait() //nolint:errcheck
+
+	if err := KillProcess(t.Context(), pid, "sleep", "300"); err != nil {
+		t.Fatalf("KillProcess: %v", err)
+	}
+	if IsProcessAlive(pid) {
+		t.Error("process still alive after KillProcess")
+	}
+}
+
+func TestKillProcess_WrongBinary(t *testing.T) {
+	// PID belongs to the test binary, not "sleep": must be left alone.
+	if err := KillProcess(t.Context(), os.Getpid(), "sleep", "300"); err != nil {
+		t.Fatalf("KillProcess: %v", err)
+	}
+}
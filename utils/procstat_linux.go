@@ -0,0 +1,72 @@
+//go:build linux
+
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ; 100 on every mainstream Linux architecture.
+const clockTicks = 100
+
+// ProcessUsage returns the cumulative user+system CPU time of all threads
+// of pid and its resident set size in bytes.
+func ProcessUsage(pid int) (time.Duration, int64, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	cpu, err := parseStatCPU(string(stat))
+	if err != nil {
+		return 0, 0, fmt.Errorf("parse /proc/%d/stat: %w", pid, err)
+	}
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cpu, parseStatusRSS(string(status)), nil
+}
+
+// parseStatCPU extracts utime+stime (fields 14 and 15) from /proc/<pid>/stat.
+// The comm field may contain spaces, so fields are counted after the last ')'.
+func parseStatCPU(stat string) (time.Duration, error) {
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("malformed stat")
+	}
+	fields := strings.Fields(stat[i+1:])
+	// fields[0] is state (field 3), so utime (14) is fields[11].
+	if len(fields) < 13 { //nolint:mnd
+		return 0, fmt.Errorf("short stat: %d fields", len(fields))
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, nil
+}
+
+// parseStatusRSS extracts VmRSS (reported in kB) from /proc/<pid>/status.
+func parseStatusRSS(status string) int64 {
+	for line := range strings.SplitSeq(status, "\n") {
+		rest, ok := strings.CutPrefix(line, "VmRSS:")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return 0
+		}
+		kb, _ := strconv.ParseInt(fields[0], 10, 64)
+		return kb << 10 //nolint:mnd
+	}
+	return 0
+}
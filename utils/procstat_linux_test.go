@@ -0,0 +1,68 @@
+//go:build linux
+
+package utils
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseStatCPU(t *testing.T) {
+	tests := []struct {
+		name    string
+		stat    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "plain comm",
+			stat: "1234 (cloud-hypervis) S 1 1234 1234 0 -1 4194560 100 0 0 0 250 150 0 0 20 0 8 0",
+			want: 4 * time.Second,
+		},
+		{
+			name: "comm with spaces and parens",
+			stat: "1234 (a (b) c) S 1 1234 1234 0 -1 4194560 100 0 0 0 5 5 0 0 20 0 8 0",
+			want: 100 * time.Millisecond,
+		},
+		{name: "no comm", stat: "1234 S 1", wantErr: true},
+		{name: "short", stat: "1234 (x) S 1 2 3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStatCPU(tt.stat)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatusRSS(t *testing.T) {
+	status := "Name:\tcloud-hypervisor\nVmPeak:\t  2048 kB\nVmRSS:\t  1024 kB\nThreads:\t8\n"
+	if got := parseStatusRSS(status); got != 1024<<10 {
+		t.Errorf("got %d, want %d", got, 1024<<10)
+	}
+	if got := parseStatusRSS("Name:\tkthreadd\n"); got != 0 {
+		t.Errorf("kernel thread: got %d, want 0", got)
+	}
+}
+
+func TestProcessUsage_Self(t *testing.T) {
+	_, rss, err := ProcessUsage(os.Getpid())
+	if err != nil {
+		t.Fatalf("ProcessUsage: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("expected positive RSS, got %d", rss)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// ProcessUsage is not supported on non-Linux platforms.
+func ProcessUsage(_ int) (time.Duration, int64, error) {
+	return 0, 0, errors.New("process usage requires /proc (Linux only)")
+}
@@ -20,6 +20,31 @@ func ReflinkCopy(dst, src string) error {
 	return SparseCopy(dst, src)
 }
 
+// Reflink clones src to dst with FICLONE only, failing (with dst removed)
+// when the filesystem cannot share the blocks.
+func Reflink(dst, src string) error {
+	return tryFiclone(dst, src)
+}
+
+// SupportsReflink reports whether the filesystem holding dir can FICLONE.
+func SupportsReflink(dir string) bool {
+	src, err := os.CreateTemp(dir, ".reflink-probe-*")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(src.Name()) //nolint:errcheck
+	_, err = src.Write([]byte{0})
+	if closeErr := src.Close(); err != nil || closeErr != nil {
+		return false
+	}
+	dst := src.Name() + ".clone"
+	if err := tryFiclone(dst, src.Name()); err != nil {
+		return false
+	}
+	_ = os.Remove(dst)
+	return true
+}
+
 func tryFiclone(dst, src string) error {
 	srcFile, err := os.Open(src) //nolint:gosec
 	if err != nil {
@@ -2,7 +2,15 @@
 
 package utils
 
+import "errors"
+
 // ReflinkCopy copies a single file. On non-Linux, falls back to SparseCopy.
 func ReflinkCopy(dst, src string) error {
 	return SparseCopy(dst, src)
 }
+
+// Reflink is not supported on non-Linux platforms.
+func Reflink(_, _ string) error { return errors.ErrUnsupported }
+
+// SupportsReflink always reports false on non-Linux platforms.
+func SupportsReflink(_ string) bool { return false }
@@ -109,3 +109,32 @@ func SparseCopy(dst, src string) error {
 	cleanup = false
 	return dstFile.Close()
 }
+
+// Fallocate allocates the first size bytes of path on disk. With keepSize
+// the file's length is left alone, reserving blocks past EOF for it to
+// grow into.
+func Fallocate(path string, size int64, keepSize bool) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close() //nolint:errcheck
+	var mode uint32
+	if keepSize {
+		mode = 1 // FALLOC_FL_KEEP_SIZE
+	}
+	if err := syscall.Fallocate(int(f.Fd()), mode, 0, size); err != nil {
+		return fmt.Errorf("fallocate %s: %w", path, err)
+	}
+	return nil
+}
+
+// AllocatedSize returns the bytes of disk path occupies, which for a
+// sparse file is less than its size.
+func AllocatedSize(path string) (int64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, fmt.Errorf("stat %s: %w", path, err)
+	}
+	return st.Blocks * 512, nil //nolint:mnd // st_blocks counts 512-byte units
+}
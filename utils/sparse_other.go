@@ -3,6 +3,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -34,3 +35,18 @@ func SparseCopy(dst, src string) error {
 	cleanup = false
 	return dstFile.Close()
 }
+
+// Fallocate is unsupported on non-Linux platforms.
+func Fallocate(_ string, _ int64, _ bool) error {
+	return errors.ErrUnsupported
+}
+
+// AllocatedSize returns the size of path. On non-Linux platforms, holes
+// are not accounted for.
+func AllocatedSize(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
@@ -66,6 +66,12 @@ func tarFileFrom(tw *tar.Writer, f *os.File, fi os.FileInfo, nameInTar string) e
 	return nil
 }
 
+// TarFile writes the regular file at path into tw as nameInTar. On Linux,
+// only the data segments of a sparse file are stored.
+func TarFile(tw *tar.Writer, path, nameInTar string) error {
+	return tarFileMaybeSparse(tw, path, nameInTar)
+}
+
 // ExtractTar extracts tar entries as flat files into dir.
 // Only regular files are extracted; the base name is used to prevent path traversal.
 //
@@ -73,7 +79,12 @@ func tarFileFrom(tw *tar.Writer, f *os.File, fi os.FileInfo, nameInTar string) e
 // sparse map, writing data segments to their original offsets and leaving
 // holes untouched. This preserves sparsity without scanning for zero blocks.
 func ExtractTar(dir string, r io.Reader) error {
-	tr := tar.NewReader(r)
+	return ExtractTarEntries(dir, tar.NewReader(r))
+}
+
+// ExtractTarEntries extracts the remaining regular-file entries of tr into
+// dir by base name, restoring sparse files written by TarFile/TarDir.
+func ExtractTarEntries(dir string, tr *tar.Reader) error {
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
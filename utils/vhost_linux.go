@@ -0,0 +1,14 @@
+//go:build linux
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+// vhostNetDevice is the kernel vhost-net accelerator for tap-backed NICs.
+const vhostNetDevice = "/dev/vhost-net"
+
+// DetectVhostNet reports whether the current user can open /dev/vhost-net
+// (the vhost_net module is loaded and the device is accessible).
+func DetectVhostNet() bool {
+	return unix.Access(vhostNetDevice, unix.R_OK|unix.W_OK) == nil
+}
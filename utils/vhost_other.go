@@ -0,0 +1,6 @@
+//go:build !linux
+
+package utils
+
+// DetectVhostNet returns false on non-Linux platforms.
+func DetectVhostNet() bool { return false }
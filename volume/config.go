@@ -0,0 +1,36 @@
+package volume
+
+import (
+	"path/filepath"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// Config holds volume module configuration, embedding the global config.
+type Config struct {
+	*config.Config
+}
+
+// EnsureDirs creates all required directories for the volume module.
+func (c *Config) EnsureDirs() error {
+	return utils.EnsureDirs(
+		c.dbDir(),
+		c.DataDir(),
+	)
+}
+
+func (c *Config) dir() string   { return filepath.Join(c.RootDir, "volume") }
+func (c *Config) dbDir() string { return filepath.Join(c.dir(), "db") }
+
+// DataDir holds one raw disk file per volume.
+func (c *Config) DataDir() string { return filepath.Join(c.dir(), "data") }
+
+// VolumePath returns the raw disk file of a volume.
+func (c *Config) VolumePath(id string) string { return filepath.Join(c.DataDir(), id+".raw") }
+
+// IndexFile returns the volume index store path.
+func (c *Config) IndexFile() string { return filepath.Join(c.dbDir(), "volumes.json") }
+
+// IndexLock returns the volume index lock path.
+func (c *Config) IndexLock() string { return filepath.Join(c.dbDir(), "volumes.lock") }
@@ -0,0 +1,42 @@
+package volume
+
+import (
+	"errors"
+	"time"
+
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+var ErrNotFound = errors.New("volume not found")
+
+// volumeRecord is the persisted record for a single volume.
+type volumeRecord struct {
+	types.Volume
+	Pending    bool      `json:"pending,omitempty"`    // true while Create is in progress
+	AttachedAt time.Time `json:"attached_at,omitzero"` // when VMID was set
+}
+
+// volumeIndex is the top-level DB structure for the volume module.
+type volumeIndex struct {
+	Volumes map[string]*volumeRecord `json:"volumes"`
+	Names   map[string]string        `json:"names"` // name → volume ID
+}
+
+// Init implements storage.Initer.
+func (idx *volumeIndex) Init() {
+	utils.InitNamedIndex(&idx.Volumes, &idx.Names)
+}
+
+// resolve resolves a ref (exact ID, name, or ID prefix ≥3 chars) to a
+// full volume ID, skipping volumes still being created.
+func (idx *volumeIndex) resolve(ref string) (string, error) {
+	id, err := utils.ResolveRef(idx.Volumes, idx.Names, ref, ErrNotFound)
+	if err != nil {
+		return "", err
+	}
+	if idx.Volumes[id].Pending {
+		return "", ErrNotFound
+	}
+	return id, nil
+}
@@ -0,0 +1,109 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/lock"
+	"github.com/projecteru2/cocoon/storage"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+const (
+	// pendingGCGrace is the age after which a pending (incomplete) volume
+	// record is considered stale; formatting takes seconds.
+	pendingGCGrace = time.Hour
+	// attachGCGrace is how long an attachment may point at a VM no VM index
+	// knows: CreateVM reserves volumes before the VM record is written.
+	attachGCGrace = time.Hour
+)
+
+// volumeGCSnapshot is the typed GC snapshot for the volume module.
+type volumeGCSnapshot struct {
+	volumeIDs    map[string]struct{} // all volume IDs in the DB
+	files        []string            // volume IDs with a file under DataDir
+	stalePending []string            // IDs in stale "pending" state (crash remnants)
+	attached     map[string]string   // volume ID → VM ID, for attachments past attachGCGrace
+}
+
+// gcModule returns the GC module for volumes. Besides orphan files and
+// stale pending records it releases volumes still attached to a VM that
+// no longer exists (e.g. deleted while the volume DB was locked).
+func gcModule(conf *Config, store storage.Store[volumeIndex], locker lock.Locker) gc.Module[volumeGCSnapshot] {
+	return gc.Module[volumeGCSnapshot]{
+		Name:   "volume",
+		Locker: locker,
+		ReadDB: func(_ context.Context) (volumeGCSnapshot, error) {
+			var snap volumeGCSnapshot
+			now := time.Now()
+			if err := store.ReadRaw(func(idx *volumeIndex) error {
+				snap.volumeIDs = make(map[string]struct{})
+				snap.attached = make(map[string]string)
+				for id, rec := range idx.Volumes {
+					if rec == nil {
+						continue
+					}
+					snap.volumeIDs[id] = struct{}{}
+					if rec.Pending && rec.CreatedAt.Before(now.Add(-pendingGCGrace)) {
+						snap.stalePending = append(snap.stalePending, id)
+					}
+					if rec.VMID != "" && rec.AttachedAt.Before(now.Add(-attachGCGrace)) {
+						snap.attached[id] = rec.VMID
+					}
+				}
+				return nil
+			}); err != nil {
+				return snap, err
+			}
+			var err error
+			if snap.files, err = utils.ScanFileStems(conf.DataDir(), ".raw"); err != nil {
+				return snap, err
+			}
+			return snap, nil
+		},
+		Resolve: func(snap volumeGCSnapshot, others map[string]any) []string {
+			candidates := slices.Concat(utils.FilterUnreferenced(snap.files, snap.volumeIDs), snap.stalePending)
+			vmIDs := gc.Collect(others, gc.VMIDs)
+			for id, vmID := range snap.attached {
+				if _, ok := vmIDs[vmID]; !ok {
+					candidates = append(candidates, id)
+				}
+			}
+			slices.Sort(candidates)
+			return slices.Compact(candidates)
+		},
+		Collect: func(_ context.Context, ids []string) error {
+			var errs []error
+			cutoff := time.Now().Add(-pendingGCGrace)
+			if err := store.WriteRaw(func(idx *volumeIndex) error {
+				for _, id := range ids {
+					rec := idx.Volumes[id]
+					switch {
+					case rec == nil:
+						if err := os.Remove(conf.VolumePath(id)); err != nil && !os.IsNotExist(err) {
+							errs = append(errs, err)
+						}
+					case rec.Pending && rec.CreatedAt.Before(cutoff):
+						if err := os.Remove(conf.VolumePath(id)); err != nil && !os.IsNotExist(err) {
+							errs = append(errs, err)
+						}
+						delete(idx.Names, rec.Name)
+						delete(idx.Volumes, id)
+					case rec.VMID != "":
+						// Resolve found the VM gone; the locks held for the
+						// whole cycle keep that true.
+						detach(rec)
+					}
+				}
+				return nil
+			}); err != nil {
+				errs = append(errs, err)
+			}
+			return errors.Join(errs...)
+		},
+	}
+}
@@ -0,0 +1,328 @@
+package volume
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"time"
+
+	"github.com/projecteru2/core/log"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/gc"
+	"github.com/projecteru2/cocoon/lock"
+	"github.com/projecteru2/cocoon/lock/flock"
+	"github.com/projecteru2/cocoon/storage"
+	storejson "github.com/projecteru2/cocoon/storage/json"
+	"github.com/projecteru2/cocoon/types"
+	"github.com/projecteru2/cocoon/utils"
+)
+
+// serialPrefix prefixes the disk serial of a volume, so the guest finds it
+// as /dev/disk/by-id/virtio-vol-<id> whatever device name it got.
+const serialPrefix = "vol-"
+
+// Volumes manages named volumes: raw disk files under RootDir that live
+// independently of any VM and attach to one VM at a time.
+type Volumes struct {
+	conf   *Config
+	store  storage.Store[volumeIndex]
+	locker lock.Locker
+}
+
+// New creates the volume manager.
+func New(conf *config.Config) (*Volumes, error) {
+	if conf == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	cfg := &Config{Config: conf}
+	if err := cfg.EnsureDirs(); err != nil {
+		return nil, fmt.Errorf("ensure dirs: %w", err)
+	}
+	locker := flock.New(cfg.IndexLock())
+	store := storejson.New[volumeIndex](cfg.IndexFile(), locker)
+	return &Volumes{conf: cfg, store: store, locker: locker}, nil
+}
+
+// Create allocates a sparse volume of size bytes and, when fs is set,
+// formats it. Uses a two-phase pattern (placeholder → allocate → finalize)
+// so a crash in between leaves a pending record GC cleans up, rather than
+// an orphan file with no DB entry.
+func (v *Volumes) Create(ctx context.Context, name string, size int64, fs string) (_ *types.Volume, err error) {
+	if err = types.ValidateVolumeName(name); err != nil {
+		return nil, err
+	}
+	if size < types.MinVolumeSize {
+		return nil, fmt.Errorf("--size %d is too small: minimum is %d bytes", size, types.MinVolumeSize)
+	}
+	switch fs {
+	case types.VolumeFSNone, types.VolumeFSExt4, types.VolumeFSXFS:
+	default:
+		return nil, fmt.Errorf("--fs %q is invalid: want %s or %s", fs, types.VolumeFSExt4, types.VolumeFSXFS)
+	}
+	id, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("generate volume ID: %w", err)
+	}
+	vol := types.Volume{
+		ID: id, Name: name, Size: size, FS: fs,
+		Path:      v.conf.VolumePath(id),
+		CreatedAt: time.Now(),
+	}
+
+	// Phase 1: write placeholder record so GC won't orphan our file.
+	if err = v.store.Update(ctx, func(idx *volumeIndex) error {
+		if existingID, ok := idx.Names[name]; ok {
+			return fmt.Errorf("volume name %q already in use by %s", name, existingID)
+		}
+		idx.Volumes[id] = &volumeRecord{Volume: vol, Pending: true}
+		idx.Names[name] = id
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// Rollback on failure: remove file + placeholder record.
+	defer func() {
+		if err != nil {
+			os.Remove(vol.Path) //nolint:errcheck,gosec
+			v.remove(ctx, id)
+		}
+	}()
+
+	// Phase 2: allocate and format.
+	if err = allocate(vol.Path, size); err != nil {
+		return nil, err
+	}
+	if err = mkfs(ctx, fs, vol.Path); err != nil {
+		return nil, err
+	}
+
+	// Phase 3: finalize — clear pending flag.
+	if err = v.store.Update(ctx, func(idx *volumeIndex) error {
+		rec := idx.Volumes[id]
+		if rec == nil {
+			return fmt.Errorf("volume %q disappeared from index", id)
+		}
+		rec.Pending = false
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("finalize volume: %w", err)
+	}
+	return &vol, nil
+}
+
+// List returns all volumes (excluding pending ones).
+func (v *Volumes) List(ctx context.Context) ([]*types.Volume, error) {
+	var result []*types.Volume
+	return result, v.store.With(ctx, func(idx *volumeIndex) error {
+		for _, rec := range idx.Volumes {
+			if rec == nil || rec.Pending {
+				continue
+			}
+			vol := rec.Volume // value copy
+			result = append(result, &vol)
+		}
+		return nil
+	})
+}
+
+// Inspect returns a single volume by ref (ID, name, or ID prefix).
+func (v *Volumes) Inspect(ctx context.Context, ref string) (*types.Volume, error) {
+	var result *types.Volume
+	return result, v.store.With(ctx, func(idx *volumeIndex) error {
+		id, err := idx.resolve(ref)
+		if err != nil {
+			return err
+		}
+		vol := idx.Volumes[id].Volume // value copy
+		result = &vol
+		return nil
+	})
+}
+
+// Delete removes volumes by ref. Attached volumes are refused: detach them
+// first. Returns the list of actually deleted IDs.
+func (v *Volumes) Delete(ctx context.Context, refs []string) ([]string, error) {
+	var ids []string
+	if err := v.store.With(ctx, func(idx *volumeIndex) error {
+		for _, ref := range refs {
+			id, err := idx.resolve(ref)
+			if err != nil {
+				return fmt.Errorf("resolve %q: %w", ref, err)
+			}
+			if vmID := idx.Volumes[id].VMID; vmID != "" {
+				return fmt.Errorf("volume %s is attached to VM %s", ref, vmID)
+			}
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, id := range ids {
+		// Drop the record first: a crash afterwards leaves an orphan file
+		// for GC, never a record pointing at a missing file.
+		var attached string
+		if err := v.store.Update(ctx, func(idx *volumeIndex) error {
+			rec := idx.Volumes[id]
+			if rec == nil {
+				return nil
+			}
+			if attached = rec.VMID; attached != "" {
+				return nil
+			}
+			delete(idx.Names, rec.Name)
+			delete(idx.Volumes, id)
+			return nil
+		}); err != nil {
+			return deleted, fmt.Errorf("delete DB record %s: %w", id, err)
+		}
+		if attached != "" {
+			return deleted, fmt.Errorf("volume %s was attached to VM %s meanwhile", id, attached)
+		}
+		if err := os.Remove(v.conf.VolumePath(id)); err != nil && !os.IsNotExist(err) {
+			return deleted, fmt.Errorf("remove volume file %s: %w", id, err)
+		}
+		deleted = append(deleted, id)
+	}
+	return deleted, nil
+}
+
+// Attach reserves the volumes in atts for VM vmID and returns their disks
+// in order, ready to append to the VM's storage configs. Either every
+// volume is reserved or none is; a volume already attached, to any VM, is
+// an error.
+func (v *Volumes) Attach(ctx context.Context, vmID string, atts []types.VolumeAttachment) ([]*types.StorageConfig, error) {
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	var disks []*types.StorageConfig
+	return disks, v.store.Update(ctx, func(idx *volumeIndex) error {
+		recs := make([]*volumeRecord, len(atts))
+		for i, att := range atts {
+			id, err := idx.resolve(att.Name)
+			if err != nil {
+				return fmt.Errorf("volume %s: %w", att.Name, err)
+			}
+			rec := idx.Volumes[id]
+			if rec.VMID != "" {
+				return fmt.Errorf("volume %s is already attached to VM %s", att.Name, rec.VMID)
+			}
+			recs[i] = rec
+		}
+		now := time.Now()
+		for i, rec := range recs {
+			rec.VMID, rec.Target, rec.AttachedAt = vmID, atts[i].Target, now
+			disks = append(disks, &types.StorageConfig{
+				Path:   rec.Path,
+				Serial: serialPrefix + rec.ID,
+				Volume: rec.ID,
+				Target: atts[i].Target,
+				Pinned: atts[i].Target != "",
+			})
+		}
+		return nil
+	})
+}
+
+// Attached records the guest device each volume disk of VM vmID ended up
+// as, once the hypervisor placed them.
+func (v *Volumes) Attached(ctx context.Context, vmID string, storageConfigs []*types.StorageConfig) error {
+	if !types.HasVolumes(storageConfigs) {
+		return nil
+	}
+	return v.store.Update(ctx, func(idx *volumeIndex) error {
+		for _, sc := range storageConfigs {
+			if rec := idx.Volumes[sc.Volume]; rec != nil && rec.VMID == vmID {
+				rec.Target = sc.Target
+			}
+		}
+		return nil
+	})
+}
+
+// Detach releases volume id from VM vmID; it is a no-op when the volume is
+// not attached to that VM.
+func (v *Volumes) Detach(ctx context.Context, id, vmID string) error {
+	return v.store.Update(ctx, func(idx *volumeIndex) error {
+		if rec := idx.Volumes[id]; rec != nil && rec.VMID == vmID {
+			detach(rec)
+		}
+		return nil
+	})
+}
+
+// Release detaches every volume attached to one of vmIDs, e.g. after the
+// VMs were deleted or failed to create.
+func (v *Volumes) Release(ctx context.Context, vmIDs []string) error {
+	if len(vmIDs) == 0 {
+		return nil
+	}
+	return v.store.Update(ctx, func(idx *volumeIndex) error {
+		for _, rec := range idx.Volumes {
+			if rec != nil && rec.VMID != "" && slices.Contains(vmIDs, rec.VMID) {
+				detach(rec)
+			}
+		}
+		return nil
+	})
+}
+
+// RegisterGC registers the volume GC module with the orchestrator.
+func (v *Volumes) RegisterGC(orch *gc.Orchestrator) {
+	gc.Register(orch, gcModule(v.conf, v.store, v.locker))
+}
+
+// remove deletes a volume record from the DB.
+func (v *Volumes) remove(ctx context.Context, id string) {
+	if err := v.store.Update(ctx, func(idx *volumeIndex) error {
+		if rec := idx.Volumes[id]; rec != nil {
+			delete(idx.Names, rec.Name)
+			delete(idx.Volumes, id)
+		}
+		return nil
+	}); err != nil {
+		log.WithFunc("volume.remove").Warnf(ctx, "remove volume record %s: %v", id, err)
+	}
+}
+
+func detach(rec *volumeRecord) {
+	rec.VMID, rec.Target, rec.AttachedAt = "", "", time.Time{}
+}
+
+// allocate creates a sparse file of size bytes at path.
+func allocate(path string, size int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("create volume file: %w", err)
+	}
+	defer f.Close() //nolint:errcheck
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("size volume file: %w", err)
+	}
+	return nil
+}
+
+// mkfs formats the volume at path with fs; VolumeFSNone leaves it blank.
+func mkfs(ctx context.Context, fs, path string) error {
+	var args []string
+	switch fs {
+	case types.VolumeFSNone:
+		return nil
+	case types.VolumeFSExt4:
+		args = []string{"-F", "-q", path}
+	case types.VolumeFSXFS:
+		args = []string{"-f", "-q", path}
+	}
+	if out, err := exec.CommandContext(ctx, "mkfs."+fs, args...).CombinedOutput(); err != nil { //nolint:gosec
+		return fmt.Errorf("mkfs.%s: %s: %w", fs, out, err)
+	}
+	return nil
+}
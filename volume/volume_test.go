@@ -0,0 +1,245 @@
+package volume
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/projecteru2/cocoon/config"
+	"github.com/projecteru2/cocoon/types"
+)
+
+// vmSnapshot stands in for a hypervisor GC snapshot listing live VMs.
+type vmSnapshot map[string]struct{}
+
+func (s vmSnapshot) ActiveVMIDs() map[string]struct{} { return s }
+
+func newTestVolumes(t *testing.T) *Volumes {
+	t.Helper()
+	v, err := New(&config.Config{RootDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return v
+}
+
+func mustCreate(t *testing.T, v *Volumes, name string) *types.Volume {
+	t.Helper()
+	vol, err := v.Create(t.Context(), name, types.MinVolumeSize, types.VolumeFSNone)
+	if err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	return vol
+}
+
+func TestCreate(t *testing.T) {
+	v := newTestVolumes(t)
+	vol := mustCreate(t, v, "data")
+
+	info, err := os.Stat(vol.Path)
+	if err != nil {
+		t.Fatalf("stat volume file: %v", err)
+	}
+	if info.Size() != types.MinVolumeSize {
+		t.Errorf("size = %d, want %d", info.Size(), types.MinVolumeSize)
+	}
+	got, err := v.Inspect(t.Context(), "data")
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+	if got.ID != vol.ID || got.Path != v.conf.VolumePath(vol.ID) {
+		t.Errorf("Inspect = %+v, want %+v", got, vol)
+	}
+}
+
+func TestCreate_Invalid(t *testing.T) {
+	tests := []struct {
+		name, volName, fs string
+		size              int64
+		want              string
+	}{
+		{"bad name", "-data", "", types.MinVolumeSize, "invalid"},
+		{"too small", "data", "", types.MinVolumeSize - 1, "too small"},
+		{"bad fs", "data", "btrfs", types.MinVolumeSize, "--fs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVolumes(t)
+			_, err := v.Create(t.Context(), tt.volName, tt.size, tt.fs)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreate_DuplicateName(t *testing.T) {
+	v := newTestVolumes(t)
+	mustCreate(t, v, "data")
+	if _, err := v.Create(t.Context(), "data", types.MinVolumeSize, ""); err == nil {
+		t.Fatal("expected error for duplicate name")
+	}
+	vols, err := v.List(t.Context())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(vols) != 1 {
+		t.Errorf("got %d volumes, want 1", len(vols))
+	}
+}
+
+func TestAttach(t *testing.T) {
+	v := newTestVolumes(t)
+	ctx := t.Context()
+	a, b := mustCreate(t, v, "a"), mustCreate(t, v, "b")
+
+	disks, err := v.Attach(ctx, "vm1", []types.VolumeAttachment{{Name: "a"}, {Name: "b", Target: "/dev/vdd"}})
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	if len(disks) != 2 || disks[0].Volume != a.ID || disks[1].Volume != b.ID {
+		t.Fatalf("disks = %+v", disks)
+	}
+	if disks[0].Serial != "vol-"+a.ID || disks[0].RO || disks[1].Target != "/dev/vdd" {
+		t.Errorf("disks = %+v, %+v", disks[0], disks[1])
+	}
+
+	// A volume attaches to one VM at a time, and a failed Attach reserves nothing.
+	c := mustCreate(t, v, "c")
+	if _, err := v.Attach(ctx, "vm2", []types.VolumeAttachment{{Name: "c"}, {Name: "a"}}); err == nil {
+		t.Fatal("expected error attaching a volume held by another VM")
+	}
+	if got, _ := v.Inspect(ctx, c.ID); got.VMID != "" {
+		t.Errorf("c attached to %q after failed Attach", got.VMID)
+	}
+
+	disks[0].Target = "/dev/vdc"
+	if err := v.Attached(ctx, "vm1", disks); err != nil {
+		t.Fatalf("Attached: %v", err)
+	}
+	if got, _ := v.Inspect(ctx, "a"); got.VMID != "vm1" || got.Target != "/dev/vdc" {
+		t.Errorf("a = %+v, want attached to vm1 as /dev/vdc", got)
+	}
+
+	if _, err := v.Attach(ctx, "vm1", []types.VolumeAttachment{{Name: "a"}}); err == nil {
+		t.Error("expected error attaching a volume twice")
+	}
+	if err := v.Detach(ctx, b.ID, "vm2"); err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+	if got, _ := v.Inspect(ctx, "b"); got.VMID != "vm1" {
+		t.Errorf("Detach for another VM released b")
+	}
+	if err := v.Detach(ctx, b.ID, "vm1"); err != nil {
+		t.Fatalf("Detach: %v", err)
+	}
+	if got, _ := v.Inspect(ctx, "b"); got.VMID != "" {
+		t.Errorf("b attached to %q after Detach", got.VMID)
+	}
+
+	if err := v.Release(ctx, []string{"vm1"}); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if got, _ := v.Inspect(ctx, "a"); got.VMID != "" || got.Target != "" {
+		t.Errorf("a = %+v, want detached", got)
+	}
+	if _, err := v.Attach(ctx, "vm2", []types.VolumeAttachment{{Name: "a"}}); err != nil {
+		t.Errorf("Attach after Release: %v", err)
+	}
+}
+
+func TestAttach_NotFound(t *testing.T) {
+	v := newTestVolumes(t)
+	_, err := v.Attach(t.Context(), "vm1", []types.VolumeAttachment{{Name: "missing"}})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	v := newTestVolumes(t)
+	ctx := t.Context()
+	a, b := mustCreate(t, v, "a"), mustCreate(t, v, "b")
+	if _, err := v.Attach(ctx, "vm1", []types.VolumeAttachment{{Name: "b"}}); err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+
+	if _, err := v.Delete(ctx, []string{"a", "b"}); err == nil || !strings.Contains(err.Error(), "attached") {
+		t.Fatalf("err = %v, want attached error", err)
+	}
+	deleted, err := v.Delete(ctx, []string{"a", a.ID})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != a.ID {
+		t.Errorf("deleted = %v, want [%s]", deleted, a.ID)
+	}
+	if _, err := os.Stat(a.Path); !os.IsNotExist(err) {
+		t.Errorf("volume file still exists: %v", err)
+	}
+	if _, err := v.Inspect(ctx, b.ID); err != nil {
+		t.Errorf("b: %v", err)
+	}
+}
+
+func TestGC(t *testing.T) {
+	v := newTestVolumes(t)
+	ctx := context.Background()
+	live, gone := mustCreate(t, v, "live"), mustCreate(t, v, "gone")
+	fresh := mustCreate(t, v, "fresh")
+	for vmID, name := range map[string]string{"vm-live": "live", "vm-gone": "gone", "vm-new": "fresh"} {
+		if _, err := v.Attach(ctx, vmID, []types.VolumeAttachment{{Name: name}}); err != nil {
+			t.Fatalf("Attach: %v", err)
+		}
+	}
+	orphan := v.conf.VolumePath("orphan")
+	if err := os.WriteFile(orphan, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Age every attachment but fresh's past the grace period.
+	if err := v.store.Update(ctx, func(idx *volumeIndex) error {
+		for id, rec := range idx.Volumes {
+			if id != fresh.ID {
+				rec.AttachedAt = time.Now().Add(-2 * attachGCGrace)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := gcModule(v.conf, v.store, v.locker)
+	snap, err := m.ReadDB(ctx)
+	if err != nil {
+		t.Fatalf("ReadDB: %v", err)
+	}
+	ids := m.Resolve(snap, map[string]any{"vm": vmSnapshot{"vm-live": {}}})
+	want := []string{gone.ID, "orphan"}
+	slices.Sort(want)
+	if !slices.Equal(ids, want) {
+		t.Fatalf("Resolve = %v, want %v", ids, want)
+	}
+	if err := m.Collect(ctx, ids); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("orphan file still exists: %v", err)
+	}
+	for _, tt := range []struct {
+		vol    *types.Volume
+		wantVM string
+	}{{live, "vm-live"}, {gone, ""}, {fresh, "vm-new"}} {
+		got, err := v.Inspect(ctx, tt.vol.ID)
+		if err != nil {
+			t.Fatalf("Inspect %s: %v", tt.vol.Name, err)
+		}
+		if got.VMID != tt.wantVM {
+			t.Errorf("%s attached to %q, want %q", tt.vol.Name, got.VMID, tt.wantVM)
+		}
+	}
+}